@@ -0,0 +1,105 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"fmt"
+	"hash/fnv"
+	"path"
+)
+
+// actionTmpDirVariable is the Ninja variable that holds the temporary
+// directory of a build statement when SetActionTmpDir is used.
+const actionTmpDirVariable = "tmpdir"
+
+// SetActionTmpDir gives every build statement its own temporary directory
+// under dir, which is usually a directory in the build directory.  The
+// directory is named after a hash of the first output of the build statement,
+// so it is stable across runs, and is set in the "tmpdir" variable of the
+// build statement, which commands can refer to as ${tmpdir}.  The command of
+// every rule that is not a generator is wrapped to delete and create the
+// directory, run with TMPDIR set to it, and delete it again afterwards while
+// preserving the exit status of the command, so actions can't interfere with
+// each other through files in a shared temporary directory.  The wrapped
+// commands require a POSIX shell.  SetActionTmpDir must be called before
+// PrepareBuildActions.
+func (c *Context) SetActionTmpDir(dir string) {
+	c.actionTmpDir = dir
+}
+
+// applyActionTmpDir sets the temporary directory of every build statement
+// and wraps the commands of their rules.
+func (c *Context) applyActionTmpDir() {
+	if c.actionTmpDir == "" {
+		return
+	}
+
+	wrapped := make(map[*ruleDef]bool)
+
+	apply := func(defs []*buildDef) {
+		for _, def := range defs {
+			rule := def.RuleDef
+			if rule == nil || rule.Variables["generator"] != nil {
+				// Built-in rules like phony have no command.
+				continue
+			}
+
+			if !wrapped[rule] {
+				rule.Variables["command"] = wrapActionTmpDirCommand(rule.Variables["command"])
+				wrapped[rule] = true
+			}
+
+			if def.Variables == nil {
+				def.Variables = make(map[string]*ninjaString)
+			}
+			def.Variables[actionTmpDirVariable] = simpleNinjaString(
+				path.Join(c.actionTmpDir, actionTmpDirName(def.Outputs[0].Value(c.pkgNames))))
+		}
+	}
+
+	for _, module := range c.modulesSorted {
+		apply(module.actionDefs.buildDefs)
+	}
+	for _, info := range c.singletonInfo {
+		apply(info.actionDefs.buildDefs)
+	}
+}
+
+// actionTmpDirName returns the name of the temporary directory of the build
+// statement with the given first output.
+func actionTmpDirName(output string) string {
+	h := fnv.New64a()
+	h.Write([]byte(output))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// wrapActionTmpDirCommand returns command wrapped to run in a fresh
+// ${tmpdir} that is removed afterwards.
+func wrapActionTmpDirCommand(command *ninjaString) *ninjaString {
+	const (
+		prefix = "rm -rf ${" + actionTmpDirVariable + "} && mkdir -p ${" + actionTmpDirVariable + "} && " +
+			"export TMPDIR=${" + actionTmpDirVariable + "} && ("
+		suffix = "); status=$$?; rm -rf ${" + actionTmpDirVariable + "}; exit $$status"
+	)
+
+	strs := append([]string(nil), command.strings...)
+	strs[0] = prefix + strs[0]
+	strs[len(strs)-1] += suffix
+
+	return &ninjaString{
+		strings:   strs,
+		variables: command.variables,
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestActionTmpDir(t *testing.T) {
+	ctx := NewContext()
+	ctx.RegisterModuleType("outputs_module", newOutputsModule)
+	ctx.SetActionTmpDir("out/.tmp")
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			outputs_module {
+			    name: "A",
+			    outs: ["a.txt", "b.txt"],
+			}
+		`),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) == 0 {
+		_, errs = ctx.PrepareBuildActions(nil)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := ctx.WriteBuildFile(buf); err != nil {
+		t.Fatalf("unexpected error writing build file: %s", err)
+	}
+	out := buf.String()
+
+	command := "    command = rm -rf ${tmpdir} && mkdir -p ${tmpdir} && export TMPDIR=${tmpdir} && " +
+		"(touch ${out}); status=$$?; rm -rf ${tmpdir}; exit $$status\n"
+	if strings.Count(out, command) != 1 {
+		t.Errorf("expected a single wrapped command %q in:\n%s", command, out)
+	}
+
+	for _, output := range []string{"${g.verifytest.outDir}/a.txt", "${g.verifytest.outDir}/b.txt"} {
+		expected := "build " + output + ": g.verifytest.touch\n" +
+			"    tmpdir = out/.tmp/" + actionTmpDirName(output) + "\n"
+		if !strings.Contains(out, expected) {
+			t.Errorf("missing build statement %q in:\n%s", expected, out)
+		}
+	}
+
+	if actionTmpDirName("a") == actionTmpDirName("b") {
+		t.Errorf("expected different temporary directories for different outputs")
+	}
+}
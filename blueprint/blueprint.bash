@@ -1,5 +1,8 @@
 #!/bin/bash
 
+# This file is generated by minibp -wrappers from bootstrap/wrapper.go, do not
+# edit it directly.
+
 # This script is intented to wrap the execution of ninja so that we
 # can do some checks before each ninja run.
 #
@@ -11,6 +14,10 @@
 #
 #   BUILDDIR
 #   SKIP_NINJA
+#   FAILURE_REPORT
+#   MINIBOOTSTRAP_NINJA_ARGS
+#   BOOTSTRAP_NINJA_ARGS
+#   NINJA_ARGS
 #
 # When run in a standalone Blueprint checkout, bootstrap.bash will install
 # this script into the $BUILDDIR, where it may be executed.
@@ -30,6 +37,46 @@ set -e
 # is just "ninja", and will be looked up in $PATH.
 [ -z "$NINJA" ] && NINJA=ninja
 
+# check_ninja_args verifies that the extra arguments for a ninja invocation
+# only change how ninja builds (-j, -k, -l, -d, -w, -v, ...), and not which
+# manifest it reads or whether it builds at all.
+check_ninja_args() {
+    local name="$1"
+    shift
+    for arg in "$@"; do
+        case "$arg" in
+            -f*|-C*|-t*|-n*|-h|--help|--version)
+                echo "Unsupported ninja argument \"$arg\" in $name" >&2
+                exit 1
+                ;;
+        esac
+    done
+}
+
+# FAILURE_REPORT can be set to the path of a JSON file to write a report of
+# the failed build statements to when a ninja invocation fails, for continuous
+# integration systems.  The output of ninja is then also written to
+# .ninja-<stage>.log in $BUILDDIR, with the default NINJA_STATUS.
+#
+# run_ninja runs ninja for the stage named by its first argument.
+run_ninja() {
+    local stage="$1"
+    shift
+    if [ -z "$FAILURE_REPORT" ]; then
+        "${NINJA}" "$@"
+        return
+    fi
+
+    local log="${BUILDDIR}/.ninja-${stage}.log"
+    NINJA_STATUS="[%f/%t] " "${NINJA}" "$@" 2>&1 | tee "$log"
+    local status=${PIPESTATUS[0]}
+    if [ $status -ne 0 ]; then
+        "${BUILDDIR}/.bootstrap/bin/minibp" -b "${BUILDDIR}" -failure_report "${FAILURE_REPORT}" \
+            -failure_stage "$stage" "$log" || true
+        exit $status
+    fi
+}
+[ -n "$FAILURE_REPORT" ] && rm -f "$FAILURE_REPORT"
 
 if [ ! -f "${BUILDDIR}/.blueprint.bootstrap" ]; then
     echo "Please run bootstrap.bash (.blueprint.bootstrap missing)" >&2
@@ -41,8 +88,23 @@ fi
 #   BOOTSTRAP
 #   BOOTSTRAP_MANIFEST
 #
+# It may also provide defaults for the per-stage ninja arguments, which are
+# only used if the variables are unset in the environment:
+#
+#   MINIBOOTSTRAP_NINJA_ARGS
+#   BOOTSTRAP_NINJA_ARGS
+#   NINJA_ARGS
+#
 source "${BUILDDIR}/.blueprint.bootstrap"
 
+# MINIBOOTSTRAP_NINJA_ARGS, BOOTSTRAP_NINJA_ARGS and NINJA_ARGS are extra
+# arguments passed to the ninja invocations of the bootstrap, primary and main
+# stages, for example "-j 4 -k 0 -d explain".  Arguments passed to this script
+# are passed to the main stage after NINJA_ARGS.
+check_ninja_args MINIBOOTSTRAP_NINJA_ARGS ${MINIBOOTSTRAP_NINJA_ARGS}
+check_ninja_args BOOTSTRAP_NINJA_ARGS ${BOOTSTRAP_NINJA_ARGS}
+check_ninja_args NINJA_ARGS ${NINJA_ARGS}
+
 GEN_BOOTSTRAP_MANIFEST="${BUILDDIR}/.minibootstrap/build.ninja.in"
 if [ -f "${GEN_BOOTSTRAP_MANIFEST}" ]; then
     if [ "${BOOTSTRAP_MANIFEST}" -nt "${GEN_BOOTSTRAP_MANIFEST}" ]; then
@@ -53,14 +115,14 @@ else
 fi
 
 # Build minibp and the primary build.ninja
-"${NINJA}" -w dupbuild=err -f "${BUILDDIR}/.minibootstrap/build.ninja"
+run_ninja bootstrap -w dupbuild=err ${MINIBOOTSTRAP_NINJA_ARGS} -f "${BUILDDIR}/.minibootstrap/build.ninja"
 
 # Build the primary builder and the main build.ninja
-"${NINJA}" -w dupbuild=err -f "${BUILDDIR}/.bootstrap/build.ninja"
+run_ninja primary -w dupbuild=err ${BOOTSTRAP_NINJA_ARGS} -f "${BUILDDIR}/.bootstrap/build.ninja"
 
 # SKIP_NINJA can be used by wrappers that wish to run ninja themselves.
 if [ -z "$SKIP_NINJA" ]; then
-    "${NINJA}" -w dupbuild=err -f "${BUILDDIR}/build.ninja" "$@"
+    run_ninja main -w dupbuild=err ${NINJA_ARGS} -f "${BUILDDIR}/build.ninja" "$@"
 else
     exit 0
 fi
@@ -0,0 +1,7 @@
+@echo off
+rem This file is generated by minibp -wrappers from bootstrap/wrapper.go, do not
+rem edit it directly.
+
+rem Runs blueprint.ps1 from the same directory, for use from cmd.exe.
+powershell -NoProfile -ExecutionPolicy Bypass -File "%~dp0blueprint.ps1" %*
+exit /b %ERRORLEVEL%
@@ -0,0 +1,91 @@
+# This file is generated by minibp -wrappers from bootstrap/wrapper.go, do not
+# edit it directly.
+
+# This script is the PowerShell equivalent of blueprint.bash, wrapping the
+# execution of ninja so that we can do some checks before each ninja run.  It
+# reads the same environment variables:
+#
+#   BUILDDIR
+#   SKIP_NINJA
+#   NINJA
+#   MINIBOOTSTRAP_NINJA_ARGS
+#   BOOTSTRAP_NINJA_ARGS
+#   NINJA_ARGS
+#
+# The bootstrap script is still a bash script, and is run with the bash found
+# in $PATH.
+
+$ErrorActionPreference = "Stop"
+
+$BuildDir = $env:BUILDDIR
+if (-not $BuildDir) { $BuildDir = $PSScriptRoot }
+
+$Ninja = $env:NINJA
+if (-not $Ninja) { $Ninja = "ninja" }
+
+function Split-NinjaArgs($Name, $Value) {
+    $result = @()
+    if ($Value) { $result = @($Value -split '\s+' | Where-Object { $_ }) }
+    foreach ($arg in $result) {
+        if ($arg -match '^(-f|-C|-t|-n)' -or $arg -in @("-h", "--help", "--version")) {
+            [Console]::Error.WriteLine("Unsupported ninja argument ""$arg"" in $Name")
+            exit 1
+        }
+    }
+    return ,$result
+}
+
+function Invoke-Checked($Exe) {
+    & $Exe @args
+    if ($LASTEXITCODE -ne 0) { exit $LASTEXITCODE }
+}
+
+$BootstrapFile = Join-Path $BuildDir ".blueprint.bootstrap"
+if (-not (Test-Path $BootstrapFile)) {
+    [Console]::Error.WriteLine("Please run bootstrap.bash (.blueprint.bootstrap missing)")
+    exit 1
+}
+
+# .blueprint.bootstrap is written by bootstrap.bash as bash assignments, either
+# NAME="value", or : ${NAME="value"} for defaults that are only used if the
+# variable is unset in the environment.
+$Saved = @{}
+foreach ($line in Get-Content $BootstrapFile) {
+    if ($line -match '^(\w+)="(.*)"$') {
+        $Saved[$Matches[1]] = $Matches[2]
+    } elseif ($line -match '^: \$\{(\w+)="(.*)"\}$') {
+        if ($null -eq [Environment]::GetEnvironmentVariable($Matches[1])) {
+            $Saved[$Matches[1]] = $Matches[2]
+        }
+    }
+}
+
+function Get-Setting($Name) {
+    if ($Saved.ContainsKey($Name)) { return $Saved[$Name] }
+    return [Environment]::GetEnvironmentVariable($Name)
+}
+
+$Bootstrap = Get-Setting "BOOTSTRAP"
+$BootstrapManifest = Get-Setting "BOOTSTRAP_MANIFEST"
+
+$MINIBOOTSTRAP_NINJA_ARGS = Split-NinjaArgs "MINIBOOTSTRAP_NINJA_ARGS" (Get-Setting "MINIBOOTSTRAP_NINJA_ARGS")
+$BOOTSTRAP_NINJA_ARGS = Split-NinjaArgs "BOOTSTRAP_NINJA_ARGS" (Get-Setting "BOOTSTRAP_NINJA_ARGS")
+$NINJA_ARGS = Split-NinjaArgs "NINJA_ARGS" (Get-Setting "NINJA_ARGS")
+
+$GenBootstrapManifest = Join-Path $BuildDir ".minibootstrap\build.ninja.in"
+if (-not (Test-Path $GenBootstrapManifest) -or
+    (Get-Item $BootstrapManifest).LastWriteTime -gt (Get-Item $GenBootstrapManifest).LastWriteTime) {
+    Invoke-Checked bash $Bootstrap -i $BootstrapManifest
+}
+
+# Build minibp and the primary build.ninja
+Invoke-Checked $Ninja -w dupbuild=err @MINIBOOTSTRAP_NINJA_ARGS -f (Join-Path $BuildDir ".minibootstrap\build.ninja")
+
+# Build the primary builder and the main build.ninja
+Invoke-Checked $Ninja -w dupbuild=err @BOOTSTRAP_NINJA_ARGS -f (Join-Path $BuildDir ".bootstrap\build.ninja")
+
+# SKIP_NINJA can be used by wrappers that wish to run ninja themselves.
+if (-not $env:SKIP_NINJA) {
+    Invoke-Checked $Ninja -w dupbuild=err @NINJA_ARGS -f (Join-Path $BuildDir "build.ninja") @args
+}
+exit 0
@@ -0,0 +1,558 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// blueprint-gen generates the boilerplate of module types from a manifest
+// describing their property schemas.  For each module type it generates a
+// documented property struct that bpdoc can read, a base struct holding the
+// properties, and a factory function that sets the default values of the
+// properties, which bpdoc lists with their documentation, plus a function
+// registering all the module types.  The module implementation is written by
+// hand, in a type that embeds the base struct and implements
+// GenerateBuildActions.
+//
+// The manifest is a Go file containing a single Manifest composite literal, so
+// that it can be formatted with gofmt, commented, and use raw strings for
+// struct tags.  It is read with go/parser and never compiled, so it should be
+// excluded from the build with a build constraint.  The package of the
+// generated file defaults to the package of the manifest.  An example
+// manifest:
+//
+//	// +build ignore
+//
+//	package example
+//
+//	var manifest = Manifest{
+//		ModuleTypes: []ModuleType{
+//			{
+//				Name: "example_library",
+//				Doc:  "example_library builds a library.",
+//				Properties: []Property{
+//					{Name: "srcs", Type: "[]string", Doc: "the source files"},
+//					{Name: "enabled", Type: "*bool", Default: "true"},
+//					{Name: "target", Type: "struct", Properties: []Property{
+//						{Name: "cflags", Type: "[]string", Tag: `variant:"target"`},
+//					}},
+//				},
+//			},
+//		},
+//	}
+//
+// generates an ExampleLibraryProperties struct, an exampleLibraryBase struct
+// to embed in the hand-written exampleLibrary type, an exampleLibraryFactory
+// function and a registerModuleTypes function.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/google/blueprint/proptools"
+)
+
+var (
+	output   = flag.String("o", "", "output filename, defaults to stdout")
+	register = flag.String("register", "registerModuleTypes", "name of the generated registration function")
+)
+
+// A Manifest describes the module types to generate.
+type Manifest struct {
+	// Package is the name of the Go package of the generated file.  It
+	// defaults to the package of the manifest file.
+	Package string
+
+	ModuleTypes []ModuleType
+}
+
+// A ModuleType describes a module type and its properties.
+type ModuleType struct {
+	// Name is the module type name used in Blueprints files.
+	Name string
+
+	// GoType is the name of the hand-written Go type implementing the module,
+	// which must embed the generated <GoType>Base struct.  It defaults to the
+	// module type name in camel case.
+	GoType string
+
+	// Doc is the documentation of the module type, which is added to the
+	// property struct.
+	Doc string
+
+	Properties []Property
+}
+
+// A Property describes a property of a module type.
+type Property struct {
+	// Name is the property name used in Blueprints files.
+	Name string
+
+	// Type is one of bool, string, []string, *bool, *string or struct, the
+	// types supported by the Blueprints file unpacker.
+	Type string
+
+	// Doc is the documentation of the property.
+	Doc string
+
+	// Default is the value the factory sets the property to, as it would be
+	// written in a Blueprints file but without the quotes of strings, for
+	// example "true" or "lib".  Only properties of type bool, string, *bool
+	// and *string can have a default.
+	Default string
+
+	// Tag is the struct tag of the property's field, without the back quotes.
+	Tag string
+
+	// Properties are the nested properties of a property of type struct.
+	Properties []Property
+}
+
+var propertyTypes = map[string]bool{
+	"bool":     true,
+	"string":   true,
+	"[]string": true,
+	"*bool":    true,
+	"*string":  true,
+	"struct":   true,
+}
+
+func main() {
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: blueprint-gen [-o output] [-register name] manifest.go")
+		os.Exit(1)
+	}
+
+	err := run(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func run(manifestFile string) error {
+	data, err := ioutil.ReadFile(manifestFile)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := parseManifest(manifestFile, data)
+	if err != nil {
+		return err
+	}
+
+	src, err := generate(manifest, filepath.Base(manifestFile), *register)
+	if err != nil {
+		return fmt.Errorf("%s: %s", manifestFile, err)
+	}
+
+	if *output == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return ioutil.WriteFile(*output, src, 0666)
+}
+
+// parseManifest parses a Go file containing a single top level variable
+// initialized with a Manifest composite literal.
+func parseManifest(filename string, data []byte) (*Manifest, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, data, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []ast.Expr
+	for _, decl := range file.Decls {
+		if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.VAR {
+			for _, spec := range genDecl.Specs {
+				values = append(values, spec.(*ast.ValueSpec).Values...)
+			}
+		}
+	}
+	if len(values) != 1 {
+		return nil, fmt.Errorf("%s: expected a single variable initialized with a Manifest, found %d values",
+			filename, len(values))
+	}
+
+	manifest := &Manifest{}
+	err = decodeManifestValue(values[0], reflect.ValueOf(manifest).Elem())
+	if err != nil {
+		if err, ok := err.(*manifestError); ok {
+			return nil, fmt.Errorf("%s: %s", fset.Position(err.pos), err.err)
+		}
+		return nil, err
+	}
+
+	if manifest.Package == "" {
+		manifest.Package = file.Name.Name
+	}
+
+	return manifest, nil
+}
+
+type manifestError struct {
+	pos token.Pos
+	err error
+}
+
+func (e *manifestError) Error() string {
+	return e.err.Error()
+}
+
+// decodeManifestValue sets v, a string, a slice or one of the manifest structs,
+// to the value of the Go expression e, which may only use string literals,
+// concatenations of them, and composite literals.
+func decodeManifestValue(e ast.Expr, v reflect.Value) error {
+	errorf := func(format string, args ...interface{}) error {
+		return &manifestError{e.Pos(), fmt.Errorf(format, args...)}
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		s, err := stringValue(e)
+		if err != nil {
+			return errorf("%s", err)
+		}
+		v.SetString(s)
+		return nil
+
+	case reflect.Slice:
+		lit, ok := e.(*ast.CompositeLit)
+		if !ok {
+			return errorf("expected a %s literal", v.Type())
+		}
+		for _, elt := range lit.Elts {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := decodeManifestValue(elt, elem); err != nil {
+				return err
+			}
+			v.Set(reflect.Append(v, elem))
+		}
+		return nil
+
+	case reflect.Struct:
+		lit, ok := e.(*ast.CompositeLit)
+		if !ok {
+			return errorf("expected a %s literal", v.Type().Name())
+		}
+		if ident, ok := lit.Type.(*ast.Ident); lit.Type != nil && (!ok || ident.Name != v.Type().Name()) {
+			return errorf("expected a %s literal", v.Type().Name())
+		}
+		for _, elt := range lit.Elts {
+			kv, ok := elt.(*ast.KeyValueExpr)
+			if !ok {
+				return &manifestError{elt.Pos(), fmt.Errorf("expected a field name")}
+			}
+			key, ok := kv.Key.(*ast.Ident)
+			if !ok {
+				return &manifestError{kv.Key.Pos(), fmt.Errorf("expected a field name")}
+			}
+			field := v.FieldByName(key.Name)
+			if !field.IsValid() {
+				return &manifestError{kv.Key.Pos(), fmt.Errorf("unknown %s field %s", v.Type().Name(), key.Name)}
+			}
+			if err := decodeManifestValue(kv.Value, field); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		panic(fmt.Errorf("unsupported manifest field type %s", v.Type()))
+	}
+}
+
+// stringValue returns the value of a string literal or of a concatenation of
+// string literals.
+func stringValue(e ast.Expr) (string, error) {
+	switch e := e.(type) {
+	case *ast.BasicLit:
+		if e.Kind == token.STRING {
+			return strconv.Unquote(e.Value)
+		}
+	case *ast.BinaryExpr:
+		if e.Op == token.ADD {
+			x, err := stringValue(e.X)
+			if err != nil {
+				return "", err
+			}
+			y, err := stringValue(e.Y)
+			if err != nil {
+				return "", err
+			}
+			return x + y, nil
+		}
+	case *ast.ParenExpr:
+		return stringValue(e.X)
+	}
+	return "", fmt.Errorf("expected a string literal")
+}
+
+// generate returns the formatted Go source for the module types described by
+// manifest.
+func generate(manifest *Manifest, source, registerFunc string) ([]byte, error) {
+	err := validate(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintf(buf, "// Code generated by blueprint-gen from %s. DO NOT EDIT.\n\n", source)
+	fmt.Fprintf(buf, "package %s\n\n", manifest.Package)
+	if hasDefaults(manifest) {
+		fmt.Fprintf(buf, "import (\n")
+		fmt.Fprintf(buf, "\t\"github.com/google/blueprint\"\n")
+		fmt.Fprintf(buf, "\t\"github.com/google/blueprint/proptools\"\n")
+		fmt.Fprintf(buf, ")\n\n")
+	} else {
+		fmt.Fprintf(buf, "import \"github.com/google/blueprint\"\n\n")
+	}
+
+	for _, mt := range manifest.ModuleTypes {
+		goType := goTypeName(mt)
+		propsType := exported(goType) + "Properties"
+
+		fmt.Fprintf(buf, "// %s contains the properties of %s modules.\n", propsType, mt.Name)
+		if mt.Doc != "" {
+			fmt.Fprintf(buf, "//\n")
+			writeComment(buf, mt.Doc, "")
+		}
+		fmt.Fprintf(buf, "type %s struct {\n", propsType)
+		writeFields(buf, mt.Properties, "\t")
+		fmt.Fprintf(buf, "}\n\n")
+
+		fmt.Fprintf(buf, "// %sBase contains the generated fields of %s, which must embed it.\n",
+			goType, goType)
+		fmt.Fprintf(buf, "type %sBase struct {\n", goType)
+		fmt.Fprintf(buf, "\tblueprint.SimpleName\n")
+		fmt.Fprintf(buf, "\tproperties %s\n", propsType)
+		fmt.Fprintf(buf, "}\n\n")
+
+		fmt.Fprintf(buf, "// %sFactory creates %s modules.\n", goType, mt.Name)
+		fmt.Fprintf(buf, "func %sFactory() (blueprint.Module, []interface{}) {\n", goType)
+		fmt.Fprintf(buf, "\tmodule := &%s{}\n", goType)
+		writeDefaults(buf, mt.Properties, "module.properties.")
+		fmt.Fprintf(buf, "\treturn module, []interface{}{&module.properties, &module.SimpleName.Properties}\n")
+		fmt.Fprintf(buf, "}\n\n")
+	}
+
+	fmt.Fprintf(buf, "// %s registers the module types generated from %s.\n", registerFunc, source)
+	fmt.Fprintf(buf, "func %s(ctx *blueprint.Context) {\n", registerFunc)
+	for _, mt := range manifest.ModuleTypes {
+		fmt.Fprintf(buf, "\tctx.RegisterModuleType(%q, %sFactory)\n", mt.Name, goTypeName(mt))
+	}
+	fmt.Fprintf(buf, "}\n")
+
+	return format.Source(buf.Bytes())
+}
+
+func hasDefaults(manifest *Manifest) bool {
+	var visit func(props []Property) bool
+	visit = func(props []Property) bool {
+		for _, prop := range props {
+			if prop.Default != "" || visit(prop.Properties) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, mt := range manifest.ModuleTypes {
+		if visit(mt.Properties) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeDefaults writes the statements setting the properties with a default
+// value in the factory.
+func writeDefaults(w io.Writer, props []Property, prefix string) {
+	for _, prop := range props {
+		field := prefix + proptools.FieldNameForProperty(prop.Name)
+		switch prop.Type {
+		case "struct":
+			writeDefaults(w, prop.Properties, field+".")
+			continue
+		}
+		if prop.Default == "" {
+			continue
+		}
+		switch prop.Type {
+		case "bool":
+			fmt.Fprintf(w, "\t%s = %s\n", field, prop.Default)
+		case "string":
+			fmt.Fprintf(w, "\t%s = %q\n", field, prop.Default)
+		case "*bool":
+			fmt.Fprintf(w, "\t%s = proptools.BoolPtr(%s)\n", field, prop.Default)
+		case "*string":
+			fmt.Fprintf(w, "\t%s = proptools.StringPtr(%q)\n", field, prop.Default)
+		}
+	}
+}
+
+func writeFields(w io.Writer, props []Property, indent string) {
+	for i, prop := range props {
+		if i > 0 {
+			fmt.Fprintf(w, "\n")
+		}
+		if prop.Doc != "" {
+			writeComment(w, prop.Doc, indent)
+		}
+
+		field := proptools.FieldNameForProperty(prop.Name)
+		if prop.Type == "struct" {
+			fmt.Fprintf(w, "%s%s struct {\n", indent, field)
+			writeFields(w, prop.Properties, indent+"\t")
+			fmt.Fprintf(w, "%s}", indent)
+		} else {
+			fmt.Fprintf(w, "%s%s %s", indent, field, prop.Type)
+		}
+
+		if prop.Tag != "" {
+			fmt.Fprintf(w, " `%s`", prop.Tag)
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
+
+func writeComment(w io.Writer, text, indent string) {
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		fmt.Fprintf(w, "%s// %s\n", indent, strings.TrimRightFunc(line, unicode.IsSpace))
+	}
+}
+
+// validate returns an error for the first invalid module type or property in
+// the manifest.
+func validate(manifest *Manifest) error {
+	if !isIdentifier(manifest.Package) {
+		return fmt.Errorf("invalid package name %q", manifest.Package)
+	}
+
+	moduleTypes := make(map[string]bool)
+	goTypes := make(map[string]bool)
+	for _, mt := range manifest.ModuleTypes {
+		if !isIdentifier(mt.Name) {
+			return fmt.Errorf("invalid module type name %q", mt.Name)
+		}
+		if moduleTypes[mt.Name] {
+			return fmt.Errorf("module type %q is listed more than once", mt.Name)
+		}
+		moduleTypes[mt.Name] = true
+
+		goType := goTypeName(mt)
+		if !isIdentifier(goType) {
+			return fmt.Errorf("module type %q: invalid Go type name %q", mt.Name, goType)
+		}
+		if goTypes[goType] {
+			return fmt.Errorf("module type %q: Go type %q is used more than once", mt.Name, goType)
+		}
+		goTypes[goType] = true
+
+		err := validateProperties(mt.Properties, "")
+		if err != nil {
+			return fmt.Errorf("module type %q: %s", mt.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func validateProperties(props []Property, prefix string) error {
+	names := make(map[string]bool)
+	for _, prop := range props {
+		name := prefix + prop.Name
+		if !isIdentifier(prop.Name) || !unicode.IsLower(rune(prop.Name[0])) {
+			return fmt.Errorf("invalid property name %q, must be an identifier starting with a lower case letter", name)
+		}
+		if names[prop.Name] {
+			return fmt.Errorf("property %q is listed more than once", name)
+		}
+		names[prop.Name] = true
+
+		if !propertyTypes[prop.Type] {
+			return fmt.Errorf("property %q has unsupported type %q", name, prop.Type)
+		}
+		if strings.Contains(prop.Tag, "`") {
+			return fmt.Errorf("property %q: tag must not contain back quotes", name)
+		}
+
+		if prop.Default != "" {
+			switch prop.Type {
+			case "bool", "*bool":
+				if prop.Default != "true" && prop.Default != "false" {
+					return fmt.Errorf("property %q: invalid bool default %q", name, prop.Default)
+				}
+			case "string", "*string":
+			default:
+				return fmt.Errorf("property %q of type %s can't have a default", name, prop.Type)
+			}
+		}
+
+		if prop.Type == "struct" {
+			err := validateProperties(prop.Properties, name+".")
+			if err != nil {
+				return err
+			}
+		} else if len(prop.Properties) > 0 {
+			return fmt.Errorf("property %q has nested properties but is not a struct", name)
+		}
+	}
+
+	return nil
+}
+
+func goTypeName(mt ModuleType) string {
+	if mt.GoType != "" {
+		return mt.GoType
+	}
+
+	parts := strings.Split(mt.Name, "_")
+	for i := 1; i < len(parts); i++ {
+		parts[i] = exported(parts[i])
+	}
+	return strings.Join(parts, "")
+}
+
+func exported(name string) string {
+	if name == "" {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if !(r == '_' || unicode.IsLetter(r) || i > 0 && unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,243 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "testing"
+
+const testManifest = `// +build ignore
+
+package example
+
+var manifest = Manifest{
+	ModuleTypes: []ModuleType{
+		{
+			Name: "example_library",
+			Doc:  "example_library builds a library.",
+			Properties: []Property{
+				{Name: "srcs", Type: "[]string", Doc: "the source files"},
+				{Name: "enabled", Type: "*bool", Default: "true"},
+				{Name: "stem", Type: "string", Doc: "the name of " + "the output", Default: "lib"},
+				{Name: "target", Type: "struct", Properties: []Property{
+					{Name: "cflags", Type: "[]string", Tag: ` + "`variant:\"target\"`" + `},
+				}},
+			},
+		},
+		{
+			Name:   "example_binary",
+			GoType: "binary",
+		},
+	},
+}
+`
+
+const expectedOutput = `// Code generated by blueprint-gen from example.go. DO NOT EDIT.
+
+package example
+
+import (
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/proptools"
+)
+
+// ExampleLibraryProperties contains the properties of example_library modules.
+//
+// example_library builds a library.
+type ExampleLibraryProperties struct {
+	// the source files
+	Srcs []string
+
+	Enabled *bool
+
+	// the name of the output
+	Stem string
+
+	Target struct {
+		Cflags []string ` + "`variant:\"target\"`" + `
+	}
+}
+
+// exampleLibraryBase contains the generated fields of exampleLibrary, which must embed it.
+type exampleLibraryBase struct {
+	blueprint.SimpleName
+	properties ExampleLibraryProperties
+}
+
+// exampleLibraryFactory creates example_library modules.
+func exampleLibraryFactory() (blueprint.Module, []interface{}) {
+	module := &exampleLibrary{}
+	module.properties.Enabled = proptools.BoolPtr(true)
+	module.properties.Stem = "lib"
+	return module, []interface{}{&module.properties, &module.SimpleName.Properties}
+}
+
+// BinaryProperties contains the properties of example_binary modules.
+type BinaryProperties struct {
+}
+
+// binaryBase contains the generated fields of binary, which must embed it.
+type binaryBase struct {
+	blueprint.SimpleName
+	properties BinaryProperties
+}
+
+// binaryFactory creates example_binary modules.
+func binaryFactory() (blueprint.Module, []interface{}) {
+	module := &binary{}
+	return module, []interface{}{&module.properties, &module.SimpleName.Properties}
+}
+
+// registerModuleTypes registers the module types generated from example.go.
+func registerModuleTypes(ctx *blueprint.Context) {
+	ctx.RegisterModuleType("example_library", exampleLibraryFactory)
+	ctx.RegisterModuleType("example_binary", binaryFactory)
+}
+`
+
+func TestGenerate(t *testing.T) {
+	manifest, err := parseManifest("example.go", []byte(testManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := generate(manifest, "example.go", "registerModuleTypes")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if string(src) != expectedOutput {
+		t.Errorf("incorrect output:\n%s\nexpected:\n%s", src, expectedOutput)
+	}
+}
+
+func TestParseManifestErrors(t *testing.T) {
+	testCases := []struct {
+		manifest string
+		err      string
+	}{
+		{
+			manifest: "package p\n",
+			err:      "test.go: expected a single variable initialized with a Manifest, found 0 values",
+		},
+		{
+			manifest: "package p\nvar m = Manifest{Package: p}\n",
+			err:      "test.go:2:27: expected a string literal",
+		},
+		{
+			manifest: "package p\nvar m = Manifest{Modules: nil}\n",
+			err:      "test.go:2:18: unknown Manifest field Modules",
+		},
+		{
+			manifest: "package p\nvar m = Manifest{ModuleTypes: []ModuleType{{\"m\"}}}\n",
+			err:      "test.go:2:45: expected a field name",
+		},
+		{
+			manifest: "package p\nvar m = Manifest{ModuleTypes: []ModuleType{Property{}}}\n",
+			err:      "test.go:2:44: expected a ModuleType literal",
+		},
+	}
+
+	for _, testCase := range testCases {
+		_, err := parseManifest("test.go", []byte(testCase.manifest))
+		if err == nil {
+			t.Errorf("expected error %q", testCase.err)
+		} else if err.Error() != testCase.err {
+			t.Errorf("expected error %q, got %q", testCase.err, err.Error())
+		}
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	testCases := []struct {
+		manifest Manifest
+		err      string
+	}{
+		{
+			manifest: Manifest{Package: "a-b"},
+			err:      `invalid package name "a-b"`,
+		},
+		{
+			manifest: Manifest{
+				Package:     "p",
+				ModuleTypes: []ModuleType{{Name: "m"}, {Name: "m"}},
+			},
+			err: `module type "m" is listed more than once`,
+		},
+		{
+			manifest: Manifest{
+				Package: "p",
+				ModuleTypes: []ModuleType{{Name: "m", Properties: []Property{
+					{Name: "Srcs", Type: "[]string"},
+				}}},
+			},
+			err: `module type "m": invalid property name "Srcs", must be an identifier starting with a lower case letter`,
+		},
+		{
+			manifest: Manifest{
+				Package: "p",
+				ModuleTypes: []ModuleType{{Name: "m", Properties: []Property{
+					{Name: "arch", Type: "struct", Properties: []Property{
+						{Name: "cflags", Type: "[]int"},
+					}},
+				}}},
+			},
+			err: `module type "m": property "arch.cflags" has unsupported type "[]int"`,
+		},
+		{
+			manifest: Manifest{
+				Package: "p",
+				ModuleTypes: []ModuleType{{Name: "m", Properties: []Property{
+					{Name: "srcs", Type: "[]string", Tag: "variant:`x`"},
+				}}},
+			},
+			err: `module type "m": property "srcs": tag must not contain back quotes`,
+		},
+		{
+			manifest: Manifest{
+				Package: "p",
+				ModuleTypes: []ModuleType{{Name: "m", Properties: []Property{
+					{Name: "size", Type: "int64"},
+				}}},
+			},
+			err: `module type "m": property "size" has unsupported type "int64"`,
+		},
+		{
+			manifest: Manifest{
+				Package: "p",
+				ModuleTypes: []ModuleType{{Name: "m", Properties: []Property{
+					{Name: "enabled", Type: "bool", Default: "yes"},
+				}}},
+			},
+			err: `module type "m": property "enabled": invalid bool default "yes"`,
+		},
+		{
+			manifest: Manifest{
+				Package: "p",
+				ModuleTypes: []ModuleType{{Name: "m", Properties: []Property{
+					{Name: "srcs", Type: "[]string", Default: "a.c"},
+				}}},
+			},
+			err: `module type "m": property "srcs" of type []string can't have a default`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		_, err := generate(&testCase.manifest, "test.go", "register")
+		if err == nil {
+			t.Errorf("expected error %q", testCase.err)
+		} else if err.Error() != testCase.err {
+			t.Errorf("expected error %q, got %q", testCase.err, err.Error())
+		}
+	}
+}
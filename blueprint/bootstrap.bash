@@ -18,6 +18,13 @@
 #   GOOS
 #   GOARCH
 #   GOCHAR
+#   MINIBOOTSTRAP_NINJA_ARGS
+#   BOOTSTRAP_NINJA_ARGS
+#   NINJA_ARGS
+#
+# The primary builder may also add placeholders of the form @@NAME@@ to the
+# bootstrap Ninja file with bootstrap.TemplateVariable, which require the
+# environment variable NAME to be set.
 #
 # The invoking script should then run this script, passing along all of its
 # command line arguments.
@@ -64,9 +71,20 @@ fi
 [ -z "$GOARCH" ] && GOARCH=`go env GOHOSTARCH`
 [ -z "$GOCHAR" ] && GOCHAR=`go env GOCHAR`
 
+# MINIBOOTSTRAP_NINJA_ARGS, BOOTSTRAP_NINJA_ARGS and NINJA_ARGS can be set to
+# the default extra ninja arguments for the bootstrap, primary and main stages
+# of the wrapper script.  They are saved in .blueprint.bootstrap, and can still
+# be overridden from the environment when the wrapper script is run.
+
 # If RUN_TESTS is set, behave like -t was passed in as an option.
 [ ! -z "$RUN_TESTS" ] && EXTRA_ARGS="$EXTRA_ARGS -t"
 
+# If RUN_VET is set, behave like -v was passed in as an option.
+[ ! -z "$RUN_VET" ] && EXTRA_ARGS="$EXTRA_ARGS -vet"
+
+# If SHOW_PROGRESS is set, behave like -p was passed in as an option.
+[ ! -z "$SHOW_PROGRESS" ] && EXTRA_ARGS="$EXTRA_ARGS -progress"
+
 GOTOOLDIR="$GOROOT/pkg/tool/${GOOS}_$GOARCH"
 GOCOMPILE="$GOTOOLDIR/${GOCHAR}g"
 GOLINK="$GOTOOLDIR/${GOCHAR}l"
@@ -87,12 +105,14 @@ usage() {
     echo "  -h: print a help message and exit"
     echo "  -r: regenerate ${BOOTSTRAP_MANIFEST}"
     echo "  -t: include tests when regenerating manifest"
+    echo "  -v: include go vet checks when regenerating manifest"
+    echo "  -p: show the progress of generating build.ninja when regenerating manifest"
 }
 
 # Parse the command line flags.
 IN="$BOOTSTRAP_MANIFEST"
 REGEN_BOOTSTRAP_MANIFEST=false
-while getopts ":b:hi:rt" opt; do
+while getopts ":b:hi:prtv" opt; do
     case $opt in
         b) BUILDDIR="$OPTARG";;
         h)
@@ -100,8 +120,10 @@ while getopts ":b:hi:rt" opt; do
             exit 1
             ;;
         i) IN="$OPTARG";;
+        p) EXTRA_ARGS="$EXTRA_ARGS -progress";;
         r) REGEN_BOOTSTRAP_MANIFEST=true;;
         t) EXTRA_ARGS="$EXTRA_ARGS -t";;
+        v) EXTRA_ARGS="$EXTRA_ARGS -vet";;
         \?)
             echo "Invalid option: -$OPTARG" >&2
             usage
@@ -128,6 +150,24 @@ fi
 
 mkdir -p $BUILDDIR/.minibootstrap
 
+# Placeholders of the form @@NAME@@, added by primary builders with
+# bootstrap.TemplateVariable, are replaced with the value of the environment
+# variable NAME.
+TEMPLATE_VARS=$(grep -o '@@[A-Z_][A-Z0-9_]*@@' $IN | sort -u | tr -d @)
+TEMPLATE_SED_ARGS=()
+for var in $TEMPLATE_VARS; do
+    if [ -z "${!var+set}" ]; then
+        echo "$IN requires the environment variable $var to be set" >&2
+        exit 1
+    fi
+    if [[ "${!var}" == *$'\n'* ]]; then
+        echo "The environment variable $var can't contain a newline" >&2
+        exit 1
+    fi
+    value=$(printf '%s' "${!var}" | sed -e 's/[\\|&]/\\&/g')
+    TEMPLATE_SED_ARGS+=(-e "s|@@${var}@@|${value}|g")
+done
+
 sed -e "s|@@SrcDir@@|$SRCDIR|g"                        \
     -e "s|@@BuildDir@@|$BUILDDIR|g"                    \
     -e "s|@@GoRoot@@|$GOROOT|g"                        \
@@ -135,10 +175,21 @@ sed -e "s|@@SrcDir@@|$SRCDIR|g"                        \
     -e "s|@@GoLink@@|$GOLINK|g"                        \
     -e "s|@@Bootstrap@@|$BOOTSTRAP|g"                  \
     -e "s|@@BootstrapManifest@@|$BOOTSTRAP_MANIFEST|g" \
+    "${TEMPLATE_SED_ARGS[@]}"                          \
     $IN > $BUILDDIR/.minibootstrap/build.ninja
 
 echo "BOOTSTRAP=\"${BOOTSTRAP}\"" > $BUILDDIR/.blueprint.bootstrap
 echo "BOOTSTRAP_MANIFEST=\"${BOOTSTRAP_MANIFEST}\"" >> $BUILDDIR/.blueprint.bootstrap
+for var in MINIBOOTSTRAP_NINJA_ARGS BOOTSTRAP_NINJA_ARGS NINJA_ARGS; do
+    if [ ! -z "${!var}" ]; then
+        printf ': ${%s=%s}\n' $var "$(printf '%q' "${!var}")" >> $BUILDDIR/.blueprint.bootstrap
+    fi
+done
+# The values of the template variables are exported for when the bootstrap
+# stage reruns this script, unless they are overridden from the environment.
+for var in $TEMPLATE_VARS; do
+    printf ': ${%s=%s}\nexport %s\n' $var "$(printf '%q' "${!var}")" $var >> $BUILDDIR/.blueprint.bootstrap
+done
 
 if [ ! -z "$WRAPPER" ]; then
     cp $WRAPPER $BUILDDIR/
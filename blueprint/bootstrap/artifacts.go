@@ -0,0 +1,132 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/blueprint/pathtools"
+)
+
+// artifactManifestFile is the name of the manifest of the binaries promoted by
+// the bootstrap and primary stages, in the .bootstrap directory.
+const artifactManifestFile = "artifacts.json"
+
+// An Artifact is a binary built by the bootstrap or primary stage that is
+// published to the main stage because its module sets `promote: true`.
+type Artifact struct {
+	// Name is the name of the module that built the artifact.
+	Name string
+
+	// Path is the path of the artifact relative to the directory Ninja is
+	// run from.
+	Path string
+
+	// Hash is the hex encoded SHA-256 hash of the contents of the artifact.
+	Hash string
+}
+
+// ReadArtifactManifest reads the artifacts promoted by the bootstrap and
+// primary stages from the manifest in the .bootstrap directory of buildDir,
+// and checks that the artifacts still have the hashes listed in the manifest.
+// It returns an error that satisfies os.IsNotExist if the manifest has not
+// been written, for example because no binary sets `promote: true`.
+func ReadArtifactManifest(buildDir string) ([]Artifact, error) {
+	manifest := artifactManifestPath(buildDir)
+	data, err := ioutil.ReadFile(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	var artifacts []Artifact
+	if err := json.Unmarshal(data, &artifacts); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %s", manifest, err)
+	}
+
+	for _, artifact := range artifacts {
+		hash, err := hashFile(artifact.Path)
+		if err != nil {
+			return nil, fmt.Errorf("artifact %q listed in %s: %s", artifact.Name, manifest, err)
+		}
+		if hash != artifact.Hash {
+			return nil, fmt.Errorf("artifact %q listed in %s was modified after the manifest was written",
+				artifact.Name, manifest)
+		}
+	}
+	return artifacts, nil
+}
+
+func artifactManifestPath(buildDir string) string {
+	return filepath.Join(buildDir, bootstrapSubDir, artifactManifestFile)
+}
+
+// writeArtifactManifest hashes the artifacts described by specs, each of the
+// form <name>=<path>, and writes them to the manifest.  The manifest is left
+// untouched if its contents didn't change, so that the Ninja files that depend
+// on it are not regenerated after a rebuild that produced identical binaries.
+// The manifest is removed if there are no specs, so that the main stage
+// doesn't keep using binaries that are no longer promoted.
+func writeArtifactManifest(manifest string, specs []string) error {
+	if len(specs) == 0 {
+		err := os.Remove(manifest)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return err
+	}
+
+	artifacts := make([]Artifact, 0, len(specs))
+	for _, spec := range specs {
+		i := strings.IndexByte(spec, '=')
+		if i < 1 {
+			return fmt.Errorf("invalid artifact %q, expected <name>=<path>", spec)
+		}
+
+		hash, err := hashFile(spec[i+1:])
+		if err != nil {
+			return err
+		}
+
+		artifacts = append(artifacts, Artifact{
+			Name: spec[:i],
+			Path: spec[i+1:],
+			Hash: hash,
+		})
+	}
+
+	data, err := json.MarshalIndent(artifacts, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if old, err := ioutil.ReadFile(manifest); err == nil && bytes.Equal(old, data) {
+		return nil
+	}
+	return ioutil.WriteFile(manifest, data, 0666)
+}
+
+func hashFile(filename string) (string, error) {
+	if _, err := os.Stat(filename); err != nil {
+		return "", err
+	}
+	return pathtools.ContentFingerprint.Fingerprint(filename)
+}
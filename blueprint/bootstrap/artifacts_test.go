@@ -0,0 +1,122 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setupArtifactTest(t *testing.T) (buildDir, manifest, binary string, cleanup func()) {
+	buildDir, err := ioutil.TempDir("", "blueprint_artifacts_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup = func() { os.RemoveAll(buildDir) }
+
+	if err := os.MkdirAll(filepath.Join(buildDir, bootstrapSubDir), 0777); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	binary = filepath.Join(buildDir, "tool")
+	if err := ioutil.WriteFile(binary, []byte("tool v1"), 0777); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+
+	return buildDir, artifactManifestPath(buildDir), binary, cleanup
+}
+
+func TestArtifactManifest(t *testing.T) {
+	buildDir, manifest, binary, cleanup := setupArtifactTest(t)
+	defer cleanup()
+
+	if _, err := ReadArtifactManifest(buildDir); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error before the manifest is written, got %v", err)
+	}
+
+	if err := writeArtifactManifest(manifest, []string{"tool=" + binary}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	artifacts, err := ReadArtifactManifest(buildDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(artifacts) != 1 || artifacts[0].Name != "tool" || artifacts[0].Path != binary ||
+		artifacts[0].Hash == "" {
+		t.Errorf("unexpected artifacts %+v", artifacts)
+	}
+
+	// The manifest is not rewritten if nothing changed.
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(manifest, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeArtifactManifest(manifest, []string{"tool=" + binary}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if info, err := os.Stat(manifest); err != nil {
+		t.Fatal(err)
+	} else if !info.ModTime().Equal(old) {
+		t.Errorf("expected the unchanged manifest not to be rewritten")
+	}
+
+	// Without specs the manifest is removed, which can be repeated.
+	for i := 0; i < 2; i++ {
+		if err := writeArtifactManifest(manifest, nil); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if _, err := os.Stat(manifest); !os.IsNotExist(err) {
+		t.Errorf("expected the manifest to be removed, got %v", err)
+	}
+}
+
+func TestArtifactManifestErrors(t *testing.T) {
+	buildDir, manifest, binary, cleanup := setupArtifactTest(t)
+	defer cleanup()
+
+	if err := writeArtifactManifest(manifest, []string{binary}); err == nil ||
+		!strings.Contains(err.Error(), "expected <name>=<path>") {
+		t.Errorf("expected an invalid artifact error, got %v", err)
+	}
+
+	if err := writeArtifactManifest(manifest, []string{"tool=" + binary}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// A modified artifact doesn't match its hash anymore.
+	if err := ioutil.WriteFile(binary, []byte("tool v2"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	_, err := ReadArtifactManifest(buildDir)
+	if err == nil || !strings.Contains(err.Error(), `artifact "tool"`) ||
+		!strings.Contains(err.Error(), "was modified after the manifest was written") {
+		t.Errorf("expected a hash mismatch error, got %v", err)
+	}
+
+	// A removed artifact is an error, not a missing manifest.
+	if err := os.Remove(binary); err != nil {
+		t.Fatal(err)
+	}
+	_, err = ReadArtifactManifest(buildDir)
+	if err == nil || os.IsNotExist(err) || !strings.Contains(err.Error(), `artifact "tool"`) {
+		t.Errorf("expected a missing artifact error, got %v", err)
+	}
+}
@@ -18,10 +18,12 @@ import (
 	"fmt"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 
 	"github.com/google/blueprint"
 	"github.com/google/blueprint/pathtools"
+	"github.com/google/blueprint/proptools"
 )
 
 const bootstrapSubDir = ".bootstrap"
@@ -45,11 +47,11 @@ var (
 
 	link = pctx.StaticRule("link",
 		blueprint.RuleParams{
-			Command:     "GOROOT='$goRoot' $linkCmd -o $out $libDirFlags $in",
+			Command:     "GOROOT='$goRoot' $linkCmd -o $out $libDirFlags $ldflags $in",
 			CommandDeps: []string{"$linkCmd"},
 			Description: "link $out",
 		},
-		"libDirFlags")
+		"libDirFlags", "ldflags")
 
 	goTestMain = pctx.StaticRule("gotestmain",
 		blueprint.RuleParams{
@@ -67,6 +69,23 @@ var (
 		},
 		"pkg", "plugins")
 
+	primaryBuilderInvocation = pctx.StaticRule("primaryBuilderInvocation",
+		blueprint.RuleParams{
+			Command:     "${env}$builder $args",
+			CommandDeps: []string{"$builder"},
+			Description: "$builder $out",
+		},
+		"builder", "args", "env")
+
+	promoteArtifacts = pctx.StaticRule("promoteArtifacts",
+		blueprint.RuleParams{
+			Command:     "$builder -promote_artifacts $out $artifacts",
+			CommandDeps: []string{"$builder"},
+			Description: "promote artifacts $out",
+			Restat:      true,
+		},
+		"builder", "artifacts")
+
 	test = pctx.StaticRule("test",
 		blueprint.RuleParams{
 			Command:     "$goTestRunnerCmd -p $pkgSrcDir -f $out -- $in -test.short",
@@ -159,6 +178,9 @@ func pluginDeps(ctx blueprint.BottomUpMutatorContext) {
 type goPackageProducer interface {
 	GoPkgRoot() string
 	GoPackageTarget() string
+
+	// GoTestTargets returns the files written when the tests of the package
+	// and the vet command on its sources passed.
 	GoTestTargets() []string
 }
 
@@ -202,6 +224,20 @@ type goPackage struct {
 		TestSrcs  []string
 		PluginFor []string
 
+		// Vendor_of marks the package as vendored third-party code, and names
+		// the upstream project it was copied from.  See Licenses.
+		Vendor_of string
+
+		// Licenses lists the license files of a vendored package, relative to
+		// the module directory.  They are required if Vendor_of is set, and are
+		// aggregated into the NOTICE file of the primary builder.
+		Licenses []string
+
+		// License_kinds lists the kinds of the licenses of the package, like
+		// "notice" or "restricted", which are checked against the license
+		// policy of the config.  See ConfigLicensePolicy.
+		License_kinds []string
+
 		Darwin struct {
 			Srcs     []string
 			TestSrcs []string
@@ -227,6 +263,12 @@ type goPackage struct {
 
 	// The bootstrap Config
 	config *Config
+
+	// Whether the module is a bootstrap_go_plugin, which must set pluginFor
+	isPlugin bool
+
+	// The sources of the package for IDE project generators
+	ideInfo blueprint.IDEInfo
 }
 
 var _ goPackageProducer = (*goPackage)(nil)
@@ -241,6 +283,23 @@ func newGoPackageModuleFactory(config *Config) func() (blueprint.Module, []inter
 	}
 }
 
+// newGoPluginModuleFactory returns the factory for bootstrap_go_plugin modules.
+// A plugin is a Go package that is linked into the packages and binaries
+// listed in its pluginFor property without them having to depend on it, so
+// that build logic can be split into separately owned packages.  The plugin
+// registers itself with the primary builder from its init functions, which run
+// because the generated plugin loader of each module in pluginFor imports it.
+func newGoPluginModuleFactory(config *Config) func() (blueprint.Module, []interface{}) {
+	return func() (blueprint.Module, []interface{}) {
+		module := &goPackage{
+			config:   config,
+			isPlugin: true,
+		}
+		module.properties.BuildStage = StageMain
+		return module, []interface{}{&module.properties, &module.SimpleName.Properties}
+	}
+}
+
 func (g *goPackage) DynamicDependencies(ctx blueprint.DynamicDependerModuleContext) []string {
 	return g.properties.Deps
 }
@@ -269,6 +328,14 @@ func (g *goPackage) SetBuildStage(buildStage Stage) {
 	g.properties.BuildStage = buildStage
 }
 
+func (g *goPackage) LicenseKinds() []string {
+	return g.properties.License_kinds
+}
+
+func (g *goPackage) IDEInfo() blueprint.IDEInfo {
+	return g.ideInfo
+}
+
 func (g *goPackage) IsPluginFor(name string) bool {
 	for _, plugin := range g.properties.PluginFor {
 		if plugin == name {
@@ -291,6 +358,11 @@ func (g *goPackage) GenerateBuildActions(ctx blueprint.ModuleContext) {
 		return
 	}
 
+	if g.isPlugin && len(g.properties.PluginFor) == 0 {
+		ctx.PropertyErrorf("pluginFor", "bootstrap_go_plugin must list at least one module")
+		return
+	}
+
 	g.pkgRoot = packageRoot(ctx)
 	g.archiveFile = filepath.Join(g.pkgRoot,
 		filepath.FromSlash(g.properties.PkgPath)+".a")
@@ -302,6 +374,17 @@ func (g *goPackage) GenerateBuildActions(ctx blueprint.ModuleContext) {
 		genSrcs = append(genSrcs, pluginSrc)
 	}
 
+	var srcs, testSrcs []string
+	if runtime.GOOS == "darwin" {
+		srcs = append(g.properties.Srcs, g.properties.Darwin.Srcs...)
+		testSrcs = append(g.properties.TestSrcs, g.properties.Darwin.TestSrcs...)
+	} else if runtime.GOOS == "linux" {
+		srcs = append(g.properties.Srcs, g.properties.Linux.Srcs...)
+		testSrcs = append(g.properties.TestSrcs, g.properties.Linux.TestSrcs...)
+	}
+
+	g.ideInfo = goIDEInfo(ctx, srcs, testSrcs, genSrcs)
+
 	// We only actually want to build the builder modules if we're running as
 	// minibp (i.e. we're generating a bootstrap Ninja file).  This is to break
 	// the circular dependence that occurs when the builder requires a new Ninja
@@ -312,15 +395,6 @@ func (g *goPackage) GenerateBuildActions(ctx blueprint.ModuleContext) {
 			return
 		}
 
-		var srcs, testSrcs []string
-		if runtime.GOOS == "darwin" {
-			srcs = append(g.properties.Srcs, g.properties.Darwin.Srcs...)
-			testSrcs = append(g.properties.TestSrcs, g.properties.Darwin.TestSrcs...)
-		} else if runtime.GOOS == "linux" {
-			srcs = append(g.properties.Srcs, g.properties.Linux.Srcs...)
-			testSrcs = append(g.properties.TestSrcs, g.properties.Linux.TestSrcs...)
-		}
-
 		if g.config.runGoTests {
 			testArchiveFile := filepath.Join(testRoot(ctx),
 				filepath.FromSlash(g.properties.PkgPath)+".a")
@@ -328,6 +402,8 @@ func (g *goPackage) GenerateBuildActions(ctx blueprint.ModuleContext) {
 				g.properties.PkgPath, srcs, genSrcs,
 				testSrcs)
 		}
+		g.testResultFile = append(g.testResultFile,
+			buildGoVet(ctx, g.config.vet, g.properties.PkgPath, srcs, genSrcs)...)
 
 		buildGoPackage(ctx, g.pkgRoot, g.properties.PkgPath, g.archiveFile,
 			srcs, genSrcs)
@@ -343,6 +419,18 @@ type goBinary struct {
 		TestSrcs       []string
 		PrimaryBuilder bool
 
+		// Stamp links the build information returned by the config's Stamp
+		// method into the binary.  See StampInfo.
+		Stamp bool
+
+		// Promote publishes the binary in the artifact manifest, so that the
+		// main stage can use it as a prebuilt host tool.  See Artifact.
+		Promote bool
+
+		// License_kinds lists the kinds of the licenses of the binary.  See
+		// the property of the same name of bootstrap_go_package.
+		License_kinds []string
+
 		Darwin struct {
 			Srcs     []string
 			TestSrcs []string
@@ -358,6 +446,9 @@ type goBinary struct {
 
 	// The bootstrap Config
 	config *Config
+
+	// The sources of the binary for IDE project generators
+	ideInfo blueprint.IDEInfo
 }
 
 func newGoBinaryModuleFactory(config *Config, buildStage Stage) func() (blueprint.Module, []interface{}) {
@@ -389,7 +480,37 @@ func (g *goBinary) InstallPath() string {
 	return "$BinDir"
 }
 
+var _ blueprint.HostToolProvider = (*goBinary)(nil)
+
+// HostToolPath returns the path of the binary in the main stage if it was
+// promoted by the bootstrap or primary stage, so that main stage modules can
+// depend on it with blueprint.AddHostToolDependencies.
+func (g *goBinary) HostToolPath() string {
+	if artifact, ok := g.config.artifacts[g.Name()]; ok && g.properties.Promote {
+		return artifact.Path
+	}
+	return ""
+}
+
+func (g *goBinary) LicenseKinds() []string {
+	return g.properties.License_kinds
+}
+
+func (g *goBinary) IDEInfo() blueprint.IDEInfo {
+	return g.ideInfo
+}
+
 func (g *goBinary) GenerateBuildActions(ctx blueprint.ModuleContext) {
+	if g.properties.Promote {
+		if g.BuildStage() == StageMain {
+			ctx.PropertyErrorf("promote", "only binaries built by the bootstrap or primary stage can be promoted")
+			return
+		}
+		if _, ok := g.config.artifacts[ctx.ModuleName()]; g.config.stage == StageMain && !ok {
+			ctx.ModuleErrorf("promoted binary is missing from the artifact manifest")
+		}
+	}
+
 	var (
 		name            = ctx.ModuleName()
 		objDir          = moduleObjDir(ctx)
@@ -409,6 +530,17 @@ func (g *goBinary) GenerateBuildActions(ctx blueprint.ModuleContext) {
 		genSrcs = append(genSrcs, pluginSrc)
 	}
 
+	var srcs, testSrcs []string
+	if runtime.GOOS == "darwin" {
+		srcs = append(g.properties.Srcs, g.properties.Darwin.Srcs...)
+		testSrcs = append(g.properties.TestSrcs, g.properties.Darwin.TestSrcs...)
+	} else if runtime.GOOS == "linux" {
+		srcs = append(g.properties.Srcs, g.properties.Linux.Srcs...)
+		testSrcs = append(g.properties.TestSrcs, g.properties.Linux.TestSrcs...)
+	}
+
+	g.ideInfo = goIDEInfo(ctx, srcs, testSrcs, genSrcs)
+
 	if g.config.stage == g.BuildStage() {
 		var deps []string
 
@@ -416,19 +548,11 @@ func (g *goBinary) GenerateBuildActions(ctx blueprint.ModuleContext) {
 			return
 		}
 
-		var srcs, testSrcs []string
-		if runtime.GOOS == "darwin" {
-			srcs = append(g.properties.Srcs, g.properties.Darwin.Srcs...)
-			testSrcs = append(g.properties.TestSrcs, g.properties.Darwin.TestSrcs...)
-		} else if runtime.GOOS == "linux" {
-			srcs = append(g.properties.Srcs, g.properties.Linux.Srcs...)
-			testSrcs = append(g.properties.TestSrcs, g.properties.Linux.TestSrcs...)
-		}
-
 		if g.config.runGoTests {
 			deps = buildGoTest(ctx, testRoot(ctx), testArchiveFile,
 				name, srcs, genSrcs, testSrcs)
 		}
+		deps = append(deps, buildGoVet(ctx, g.config.vet, name, srcs, genSrcs)...)
 
 		buildGoPackage(ctx, objDir, name, archiveFile, srcs, genSrcs)
 
@@ -445,6 +569,9 @@ func (g *goBinary) GenerateBuildActions(ctx blueprint.ModuleContext) {
 		if len(libDirFlags) > 0 {
 			linkArgs["libDirFlags"] = strings.Join(libDirFlags, " ")
 		}
+		if g.properties.Stamp {
+			linkArgs["ldflags"] = stampFlags(ctx.Config())
+		}
 
 		ctx.Build(pctx, blueprint.BuildParams{
 			Rule:    link,
@@ -462,6 +589,37 @@ func (g *goBinary) GenerateBuildActions(ctx blueprint.ModuleContext) {
 	}
 }
 
+// stampFlags returns the Go linker flags that set the variables described by
+// the StampInfo returned by the config.
+func stampFlags(config interface{}) string {
+	var info StampInfo
+	if c, ok := config.(ConfigStamp); ok {
+		info = c.Stamp()
+	}
+
+	vars := map[string]string{
+		"main.BuildRevision": info.Revision,
+		"main.BuildTime":     info.BuildTime,
+	}
+	for name, value := range info.Vars {
+		vars[name] = value
+	}
+
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	flags := make([]string, len(names))
+	for i, name := range names {
+		flags[i] = name + "=" + vars[name]
+	}
+	flags = proptools.NinjaAndShellEscape(flags)
+
+	return "-X " + strings.Join(flags, " -X ")
+}
+
 func buildGoPluginLoader(ctx blueprint.ModuleContext, pkgPath, pluginSrc string, stage Stage) bool {
 	ret := true
 	name := ctx.ModuleName()
@@ -490,6 +648,19 @@ func buildGoPluginLoader(ctx blueprint.ModuleContext, pkgPath, pluginSrc string,
 	return ret
 }
 
+// goIDEInfo returns the IDEInfo of a Go package or binary, with the sources
+// relative to the top of the source tree.
+func goIDEInfo(ctx blueprint.ModuleContext, srcs, testSrcs, genSrcs []string) blueprint.IDEInfo {
+	moduleDir := ctx.ModuleDir()
+	return blueprint.IDEInfo{
+		Language: "go",
+		Srcs: append(pathtools.PrefixPaths(srcs, moduleDir),
+			pathtools.PrefixPaths(testSrcs, moduleDir)...),
+		GeneratedSrcs: genSrcs,
+		Pctx:          pctx,
+	}
+}
+
 func buildGoPackage(ctx blueprint.ModuleContext, pkgRoot string,
 	pkgPath string, archiveFile string, srcs []string, genSrcs []string) {
 
@@ -616,6 +787,9 @@ func (s *singleton) GenerateBuildActions(ctx blueprint.SingletonContext) {
 	var primaryBuilders []*goBinary
 	// blueprintTools contains blueprint go binaries that will be built in StageMain
 	var blueprintTools []string
+	// promotedArtifacts contains the <name>=<path> arguments for the binaries
+	// that are published to StageMain, and promotedFiles their paths
+	var promotedArtifacts, promotedFiles []string
 	ctx.VisitAllModulesIf(isBootstrapBinaryModule,
 		func(module blueprint.Module) {
 			binaryModule := module.(*goBinary)
@@ -624,6 +798,9 @@ func (s *singleton) GenerateBuildActions(ctx blueprint.SingletonContext) {
 
 			if binaryModule.BuildStage() == StageMain {
 				blueprintTools = append(blueprintTools, installPath)
+			} else if binaryModule.properties.Promote {
+				promotedArtifacts = append(promotedArtifacts, binaryModuleName+"="+installPath)
+				promotedFiles = append(promotedFiles, installPath)
 			}
 			if binaryModule.properties.PrimaryBuilder {
 				primaryBuilders = append(primaryBuilders, binaryModule)
@@ -634,6 +811,10 @@ func (s *singleton) GenerateBuildActions(ctx blueprint.SingletonContext) {
 	if s.config.runGoTests {
 		extraTestFlags = " -t"
 	}
+	extraTestFlags += s.config.vet.flags()
+	if s.config.showProgress {
+		extraTestFlags += " -progress"
+	}
 
 	var primaryBuilderName, primaryBuilderExtraFlags string
 	switch len(primaryBuilders) {
@@ -679,26 +860,12 @@ func (s *singleton) GenerateBuildActions(ctx blueprint.SingletonContext) {
 		ctx.SetNinjaBuildDir(pctx, miniBootstrapDir)
 
 		// Generate the Ninja file to build the primary builder.
-		ctx.Build(pctx, blueprint.BuildParams{
-			Rule:    generateBuildNinja,
-			Outputs: []string{primaryBuilderNinjaFile},
-			Inputs:  []string{topLevelBlueprints},
-			Args: map[string]string{
-				"builder": minibpFile,
-				"extra":   "--build-primary" + extraTestFlags,
-			},
-		})
+		regenerateNinjaFile(ctx, primaryBuilderNinjaFile, topLevelBlueprints,
+			minibpFile, "--build-primary"+extraTestFlags, false, false)
 
 		// Rebuild the bootstrap Ninja file using the minibp that we just built.
-		ctx.Build(pctx, blueprint.BuildParams{
-			Rule:    generateBuildNinja,
-			Outputs: []string{bootstrapNinjaFileTemplate},
-			Inputs:  []string{topLevelBlueprints},
-			Args: map[string]string{
-				"builder": minibpFile,
-				"extra":   extraTestFlags,
-			},
-		})
+		regenerateNinjaFile(ctx, bootstrapNinjaFileTemplate, topLevelBlueprints,
+			minibpFile, extraTestFlags, false, false)
 
 		ctx.Build(pctx, blueprint.BuildParams{
 			Rule:    bootstrap,
@@ -715,27 +882,37 @@ func (s *singleton) GenerateBuildActions(ctx blueprint.SingletonContext) {
 		ctx.SetNinjaBuildDir(pctx, bootstrapDir)
 
 		// Add a way to rebuild the primary build.ninja so that globs works
-		ctx.Build(pctx, blueprint.BuildParams{
-			Rule:    generateBuildNinja,
-			Outputs: []string{primaryBuilderNinjaFile},
-			Inputs:  []string{topLevelBlueprints},
-			Args: map[string]string{
-				"builder":   minibpFile,
-				"extra":     "--build-primary" + extraTestFlags,
-				"generator": "true",
-			},
-		})
+		regenerateNinjaFile(ctx, primaryBuilderNinjaFile, topLevelBlueprints,
+			minibpFile, "--build-primary"+extraTestFlags, true, false)
+
+		// Publish the promoted binaries before the primary builder reads
+		// the manifest while building the main build.ninja
+		var mainNinjaImplicits []string
+		if len(promotedArtifacts) > 0 {
+			manifest := filepath.Join(bootstrapDir, artifactManifestFile)
+			ctx.Build(pctx, blueprint.BuildParams{
+				Rule:      promoteArtifacts,
+				Outputs:   []string{manifest},
+				Implicits: promotedFiles,
+				Args: map[string]string{
+					"builder":   minibpFile,
+					"artifacts": strings.Join(promotedArtifacts, " "),
+				},
+			})
+			mainNinjaImplicits = append(mainNinjaImplicits, manifest)
+		} else if !dryRun {
+			// No rule writes the manifest anymore, remove the one left by
+			// an earlier build so that the primary builder doesn't read it.
+			err := writeArtifactManifest(artifactManifestPath(BuildDir), nil)
+			if err != nil {
+				ctx.Errorf("error removing the artifact manifest: %s", err)
+			}
+		}
 
 		// Build the main build.ninja
-		ctx.Build(pctx, blueprint.BuildParams{
-			Rule:    generateBuildNinja,
-			Outputs: []string{mainNinjaFile},
-			Inputs:  []string{topLevelBlueprints},
-			Args: map[string]string{
-				"builder": primaryBuilderFile,
-				"extra":   primaryBuilderExtraFlags,
-			},
-		})
+		regenerateNinjaFile(ctx, mainNinjaFile, topLevelBlueprints,
+			primaryBuilderFile, primaryBuilderExtraFlags, false, s.config.showProgress,
+			mainNinjaImplicits...)
 
 		// Generate build system docs for the primary builder.  Generating docs reads the source
 		// files used to build the primary builder, but that dependency will be picked up through
@@ -755,21 +932,28 @@ func (s *singleton) GenerateBuildActions(ctx blueprint.SingletonContext) {
 			Outputs: []string{docsFile},
 		})
 
+		if c, ok := ctx.Config().(ConfigBootstrap); ok {
+			for _, invocation := range c.PrimaryBuilderInvocations() {
+				ctx.Build(pctx, blueprint.BuildParams{
+					Rule:    primaryBuilderInvocation,
+					Outputs: invocation.Outputs,
+					Inputs:  invocation.Inputs,
+					Args: map[string]string{
+						"builder": primaryBuilderFile,
+						"args":    strings.Join(proptools.NinjaAndShellEscape(invocation.Args), " "),
+						"env":     invocationEnv(invocation.Env),
+					},
+				})
+			}
+		}
+
 	case StageMain:
 		ctx.SetNinjaBuildDir(pctx, "${buildDir}")
 
 		// Add a way to rebuild the main build.ninja in case it creates rules that
 		// it will depend on itself. (In Android, globs with soong_glob)
-		ctx.Build(pctx, blueprint.BuildParams{
-			Rule:    generateBuildNinja,
-			Outputs: []string{mainNinjaFile},
-			Inputs:  []string{topLevelBlueprints},
-			Args: map[string]string{
-				"builder":   primaryBuilderFile,
-				"extra":     primaryBuilderExtraFlags,
-				"generator": "true",
-			},
-		})
+		regenerateNinjaFile(ctx, mainNinjaFile, topLevelBlueprints,
+			primaryBuilderFile, primaryBuilderExtraFlags, true, s.config.showProgress)
 
 		if primaryBuilderName == "minibp" {
 			// This is a standalone Blueprint build, so we copy the minibp
@@ -787,6 +971,12 @@ func (s *singleton) GenerateBuildActions(ctx blueprint.SingletonContext) {
 			Outputs: []string{"blueprint_tools"},
 			Inputs:  blueprintTools,
 		})
+
+		if c, ok := ctx.Config().(ConfigBootstrap); ok {
+			for _, subninja := range c.Subninjas() {
+				ctx.AddSubninja(pctx, subninja)
+			}
+		}
 	}
 }
 
@@ -819,3 +1009,25 @@ func moduleObjDir(ctx blueprint.ModuleContext) string {
 func moduleGenSrcDir(ctx blueprint.ModuleContext) string {
 	return filepath.Join(bootstrapDir, ctx.ModuleName(), "gen")
 }
+
+// invocationEnv returns the assignments that set the environment variables for
+// a command, sorted by name and followed by a space, or an empty string if env is
+// empty.
+func invocationEnv(env map[string]string) string {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ret := ""
+	for _, name := range names {
+		value := proptools.NinjaAndShellEscape([]string{env[name]})[0]
+		// ShellEscape leaves spaces unquoted, which would end the assignment.
+		if value == "" || strings.Contains(value, " ") && value[0] != '\'' {
+			value = "'" + value + "'"
+		}
+		ret += name + "=" + value + " "
+	}
+	return ret
+}
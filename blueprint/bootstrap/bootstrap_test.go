@@ -0,0 +1,173 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/blueprint"
+)
+
+// runBootstrapTest generates the Ninja file of stage for a Blueprints file
+// using the bootstrap module types, and returns it, or the errors of
+// generating the build actions.
+func runBootstrapTest(t *testing.T, stage Stage, blueprints string) (string, []error) {
+	config := &Config{stage: stage}
+
+	ctx := blueprint.NewContext()
+	ctx.RegisterBottomUpMutator("bootstrap_plugin_deps", pluginDeps)
+	ctx.RegisterModuleType("bootstrap_go_package", newGoPackageModuleFactory(config))
+	ctx.RegisterModuleType("bootstrap_go_plugin", newGoPluginModuleFactory(config))
+	ctx.RegisterModuleType("bootstrap_core_go_binary", newGoBinaryModuleFactory(config, StageBootstrap))
+	ctx.RegisterModuleType("bootstrap_go_binary", newGoBinaryModuleFactory(config, StagePrimary))
+	ctx.RegisterModuleType("blueprint_go_binary", newGoBinaryModuleFactory(config, StageMain))
+	ctx.RegisterTopDownMutator("bootstrap_stage", propagateStageBootstrap)
+	ctx.RegisterSingletonType("bootstrap_licenses", newLicensesSingletonFactory(config))
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(blueprints),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) > 0 {
+		t.Fatalf("unexpected parse errors: %v", errs)
+	}
+	errs = ctx.ResolveDependencies(config)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected dependency errors: %v", errs)
+	}
+	_, errs = ctx.PrepareBuildActions(config)
+	if len(errs) > 0 {
+		return "", errs
+	}
+
+	buf := &bytes.Buffer{}
+	if err := ctx.WriteBuildFile(buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String(), nil
+}
+
+func TestGoPlugin(t *testing.T) {
+	out, errs := runBootstrapTest(t, StageMain, `
+		bootstrap_go_package {
+			name: "lib",
+			pkgPath: "example.com/lib",
+			srcs: ["lib.go"],
+		}
+
+		bootstrap_go_plugin {
+			name: "plugin",
+			pkgPath: "example.com/plugin",
+			deps: ["lib"],
+			srcs: ["plugin.go"],
+			pluginFor: ["tool"],
+		}
+
+		blueprint_go_binary {
+			name: "tool",
+			srcs: ["tool.go"],
+		}
+
+		blueprint_go_binary {
+			name: "other",
+			srcs: ["other.go"],
+		}
+	`)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	// tool links a generated loader that imports the plugin without
+	// depending on it, and other doesn't.
+	for _, s := range []string{
+		"default ${g.bootstrap.buildDir}/.bootstrap/tool/gen/plugin.go\n",
+		"    pkg = main\n    plugins = example.com/plugin\n",
+		"    libDirFlags = -L ${g.bootstrap.buildDir}/.bootstrap/lib/pkg -L ${g.bootstrap.buildDir}/.bootstrap/plugin/pkg\n",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("expected the Ninja file to contain %q:\n%s", s, out)
+		}
+	}
+	if strings.Contains(out, ".bootstrap/other/gen/plugin.go") {
+		t.Errorf("unexpected plugin loader for other:\n%s", out)
+	}
+}
+
+func TestGoPluginErrors(t *testing.T) {
+	testCases := []struct {
+		name       string
+		stage      Stage
+		blueprints string
+		err        string
+	}{
+		{
+			name:  "no pluginFor",
+			stage: StageMain,
+			blueprints: `
+				bootstrap_go_plugin {
+					name: "plugin",
+					pkgPath: "example.com/plugin",
+					srcs: ["plugin.go"],
+				}
+			`,
+			err: "bootstrap_go_plugin must list at least one module",
+		},
+		{
+			name:  "core module",
+			stage: StageBootstrap,
+			blueprints: `
+				bootstrap_go_plugin {
+					name: "plugin",
+					pkgPath: "example.com/plugin",
+					srcs: ["plugin.go"],
+					pluginFor: ["minibp"],
+				}
+
+				bootstrap_core_go_binary {
+					name: "minibp",
+					srcs: ["minibp.go"],
+				}
+			`,
+			err: `plugin "plugin" may not be included in core module "minibp"`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		_, errs := runBootstrapTest(t, testCase.stage, testCase.blueprints)
+		if len(errs) != 1 || !strings.Contains(errs[0].Error(), testCase.err) {
+			t.Errorf("%s: expected error containing %q, got %v", testCase.name, testCase.err, errs)
+		}
+	}
+}
+
+func TestInvocationEnv(t *testing.T) {
+	testCases := []struct {
+		env      map[string]string
+		expected string
+	}{
+		{nil, ""},
+		{map[string]string{"FOO": "bar"}, "FOO=bar "},
+		{map[string]string{"B": "2", "A": "1", "C": "3"}, "A=1 B=2 C=3 "},
+		{map[string]string{"FOO": "a b", "BAR": "$x", "BAZ": ""}, "BAR='$$x' BAZ='' FOO='a b' "},
+		{map[string]string{"FOO": "it's a b"}, `FOO='it'\''s a b' `},
+	}
+	for _, testCase := range testCases {
+		if env := invocationEnv(testCase.env); env != testCase.expected {
+			t.Errorf("invocationEnv(%v): expected %q, got %q", testCase.env, testCase.expected, env)
+		}
+	}
+}
@@ -378,6 +378,25 @@ func NewPackageAST(files []string) (*ast.Package, error) {
 	return pkg, nil
 }
 
+// ModuleTypeProperty returns the documentation of the property with the given
+// name, using "." to separate the names of nested properties, from the property
+// structs of a module type.  It returns nil if the property is not documented.
+func (c *Context) ModuleTypeProperty(moduleTypeName string, propertyStructs []interface{},
+	name string) (*Property, error) {
+
+	mt, err := getModuleType(c, moduleTypeName, propertyStructs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ps := range mt.PropertyStructs {
+		if property := ps.GetByName(name); property != nil {
+			return property, nil
+		}
+	}
+	return nil, nil
+}
+
 func Write(filename string, pkgFiles map[string][]string,
 	moduleTypePropertyStructs map[string][]interface{}) error {
 
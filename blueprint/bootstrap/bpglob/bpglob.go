@@ -27,7 +27,8 @@ import (
 )
 
 var (
-	out = flag.String("o", "", "file to write list of files that match glob")
+	out      = flag.String("o", "", "file to write list of files that match glob")
+	symlinks = flag.String("symlinks", "preserve", "how to canonicalize paths that go through symlinks: preserve or resolve")
 
 	excludes multiArg
 )
@@ -69,7 +70,13 @@ func main() {
 		usage()
 	}
 
-	_, err := pathtools.GlobWithDepFile(flag.Arg(0), *out, *out+".d", excludes)
+	policy, err := pathtools.ParseSymlinkPolicy(*symlinks)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		usage()
+	}
+
+	_, err = pathtools.GlobWithDepFileAndSymlinkPolicy(flag.Arg(0), *out, *out+".d", excludes, policy)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
 		os.Exit(1)
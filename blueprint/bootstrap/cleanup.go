@@ -133,7 +133,7 @@ func removeFileAndEmptyDirs(path string) error {
 		}
 		return err
 	}
-	fmt.Printf("removed old ninja-created file %s because it has no rule to generate it\n", path)
+	logger.Scope("cleanup").Infof("removed old ninja-created file %s because it has no rule to generate it", path)
 
 	path, err = filepath.Abs(path)
 	if err != nil {
@@ -16,8 +16,10 @@ package bootstrap
 
 import (
 	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -25,21 +27,98 @@ import (
 	"runtime/debug"
 	"runtime/pprof"
 	"runtime/trace"
+	"strings"
 
 	"github.com/google/blueprint"
-	"github.com/google/blueprint/deptools"
+	"github.com/google/blueprint/logging"
+	"github.com/google/blueprint/pathtools"
 )
 
 var (
 	outFile    string
 	depFile    string
 	docFile    string
+	unusedFile string
 	cpuprofile string
 	memprofile string
 	traceFile  string
 	runGoTests bool
 	noGC       bool
 
+	showProgress bool
+
+	runGoVet    bool
+	goVetStrict bool
+	goVetCmd    string
+
+	memoryBudget bool
+	metricsFile  string
+
+	moduleProfile  bool
+	slowestModules int
+
+	// symlinkPolicy is parsed from -symlinks by Main
+	symlinks      string
+	symlinkPolicy pathtools.SymlinkPolicy
+
+	strictNinjaEscapes bool
+
+	dryRun bool
+
+	overrides propertyOverrideFlags
+
+	actionTmpDirs bool
+
+	patchNinjaFile bool
+
+	provenanceFile string
+
+	hashCacheFile      string
+	chunkHashThreshold int64
+
+	depsBaseline       string
+	updateDepsBaseline bool
+
+	schemaLock       string
+	updateSchemaLock bool
+
+	traceDepsFile    string
+	traceDepsModules string
+
+	distFile   string
+	distAlways bool
+
+	moduleGraphFile            string
+	moduleGraphSplit           bool
+	moduleGraphCompressionFlag string
+
+	ideInfoDir string
+
+	artifactManifest string
+
+	failureReport      string
+	failureStage       string
+	failureOutputLines int
+
+	werror          bool
+	warningLevels   warningLevelFlags
+	diagnosticsFile string
+
+	wrapperDir string
+	wrapperOS  string
+
+	completionShell string
+	complete        bool
+
+	checkMainStageOutputs bool
+
+	// logger is created by Main from the -log_* flags, and scoped to the stage
+	logger *logging.Logger
+
+	logLevel string
+	logFile  string
+	logJSON  string
+
 	BuildDir string
 	SrcDir   string
 )
@@ -49,16 +128,105 @@ func init() {
 	flag.StringVar(&BuildDir, "b", ".", "the build output directory")
 	flag.StringVar(&depFile, "d", "", "the dependency file to output")
 	flag.StringVar(&docFile, "docs", "", "build documentation file to output")
+	flag.StringVar(&unusedFile, "unused", "", "write a report of unused variables and modules to file, as JSON if it ends in .json")
 	flag.StringVar(&cpuprofile, "cpuprofile", "", "write cpu profile to file")
 	flag.StringVar(&traceFile, "trace", "", "write trace to file")
 	flag.StringVar(&memprofile, "memprofile", "", "write memory profile to file")
 	flag.BoolVar(&noGC, "nogc", false, "turn off GC for debugging")
+	flag.BoolVar(&memoryBudget, "memory_budget", false, "allocate parsed Blueprints files and cloned properties from arenas to reduce memory usage")
+	flag.StringVar(&metricsFile, "metrics", "", "write memory metrics to file")
+	flag.StringVar(&symlinks, "symlinks", "preserve", "how to canonicalize the paths of Blueprints files and glob results that go through symlinks: preserve or resolve")
+	flag.BoolVar(&moduleProfile, "module_profile", false, "time the GenerateBuildActions call of every module and count its allocations, and report the slowest in -metrics and -trace")
+	flag.IntVar(&slowestModules, "slowest_modules", 10, "number of the slowest modules to report with -module_profile")
+	flag.BoolVar(&strictNinjaEscapes, "strict_ninja_escapes", false, "fail if the Ninja file would contain strings that Ninja misparses, like newlines in commands")
+	flag.BoolVar(&dryRun, "dry_run", false, "generate the build actions without writing any files to the build directory, and print a summary of them")
+	flag.Var(&overrides, "override", "override a module property with a value in the Blueprints language, as module:property=value, can be repeated")
+	flag.BoolVar(&actionTmpDirs, "action_tmpdirs", false, "run every action with its own TMPDIR in the build directory, available to commands as ${tmpdir}")
+	flag.BoolVar(&patchNinjaFile, "patch_ninja_file", false, "only write the parts of the Ninja file that changed since it was last written with this flag, instead of rewriting all of it")
+	flag.StringVar(&provenanceFile, "provenance", "", "write an in-toto SLSA provenance attestation of the build outputs that exist to file")
+	flag.StringVar(&hashCacheFile, "hash_cache", "", "remember the hashes of the contents of files in file, keyed by their inode and modification time, so that unchanged files are not hashed again")
+	flag.Int64Var(&chunkHashThreshold, "chunk_hash_threshold", 0, "hash the contents of files at least this many bytes large for fingerprints in parallel chunks, 0 to disable")
+	flag.StringVar(&depsBaseline, "deps_baseline", "", "fail if a module depends on a module in another directory without the edge between the directories being listed in file")
+	flag.BoolVar(&updateDepsBaseline, "update_deps_baseline", false, "write the current edges between directories to the -deps_baseline file instead of checking them")
+	flag.StringVar(&schemaLock, "schema_lock", "", "fail if the property schema of a module type doesn't match the one recorded in file")
+	flag.BoolVar(&updateSchemaLock, "update_schema_lock", false, "write the current module type property schemas to the -schema_lock file instead of checking them, not allowed with -dry_run")
+	flag.StringVar(&traceDepsFile, "trace_deps", "", "write the mutator, dependency injector and stack that added each dependency of the -trace_deps_modules to file")
+	flag.StringVar(&traceDepsModules, "trace_deps_modules", "", "comma separated names of the modules whose dependencies are traced with -trace_deps, all modules if empty")
+	flag.StringVar(&distFile, "dist", "", "write the Ninja file, module graph, metrics and diagnostics to file as a gzipped tar archive when generating the Ninja file fails")
+	flag.BoolVar(&distAlways, "dist_always", false, "write the -dist file even if generating the Ninja file succeeds")
+	flag.StringVar(&moduleGraphFile, "module_graph", "", "write the module variants, their types, Blueprints files and direct dependencies to file as JSON")
+	flag.BoolVar(&moduleGraphSplit, "module_graph_split", false, "write the -module_graph, and the module graph in the -dist archive, to a directory with a file for each directory with Blueprints files, listed in module_graph_index.json")
+	flag.StringVar(&moduleGraphCompressionFlag, "module_graph_compression", "", "compress the -module_graph with none, gzip or zstd, which requires the zstd tool, instead of picking by the .gz or .zst extension")
+	flag.StringVar(&ideInfoDir, "ide_info", "", "write the sources, generated sources, flags and dependencies of each module to JSON files in dir for IDE project generators")
 	flag.BoolVar(&runGoTests, "t", false, "build and run go tests during bootstrap")
+	flag.BoolVar(&showProgress, "progress", false, "show the progress of parsing the Blueprints files and generating the build actions, as a progress bar if stderr is a terminal, and run the main stage primary builder in the console pool to draw it")
+	flag.BoolVar(&runGoVet, "vet", false, "run go vet on the sources of the bootstrap Go packages and binaries during bootstrap, and print its findings")
+	flag.BoolVar(&goVetStrict, "vet_strict", false, "fail the build on the findings of -vet, implies -vet")
+	flag.StringVar(&goVetCmd, "vet_cmd", "", "the command -vet runs with the source files of each package as arguments instead of go tool vet, for example another analyzer")
+	flag.StringVar(&logLevel, "log_level", "info", "minimum level of the messages written to stderr: debug, info, warning or error")
+	flag.StringVar(&logFile, "log_file", "", "write all messages to file")
+	flag.StringVar(&logJSON, "log_json", "", "write all messages to file as JSON, one object per line")
+	flag.BoolVar(&werror, "werror", false, "treat warnings as errors")
+	flag.Var(&warningLevels, "W", "set the level of the warnings of a category, as <category>=<level> where the level is error, warning or ignore, can be repeated")
+	flag.StringVar(&diagnosticsFile, "diagnostics", "", "write the warnings and errors to file as JSON")
+	flag.StringVar(&artifactManifest, "promote_artifacts", "", "write the manifest of the <name>=<path> arguments to file and exit")
+	flag.StringVar(&failureReport, "failure_report", "", "write a JSON report of the failed build statements in the ninja output log argument of a -failure_stage run to file and exit")
+	flag.StringVar(&failureStage, "failure_stage", "main", "the stage whose ninja output -failure_report reads: bootstrap, primary or main")
+	flag.IntVar(&failureOutputLines, "failure_output_lines", 50, "the number of lines at the end of the output of each failed command that -failure_report keeps")
+	flag.StringVar(&wrapperDir, "wrappers", "", "write the wrapper scripts for -wrapper_os into directory and exit")
+	flag.StringVar(&wrapperOS, "wrapper_os", runtime.GOOS, "the OS to write wrapper scripts for with -wrappers")
+	flag.StringVar(&completionShell, "completion", "", "print the script that completes the module names and phony targets of the wrapper script in shell, bash, zsh or fish, and exit")
+	flag.BoolVar(&complete, "complete", false, "print the module names and phony targets of the last build in the build directory that start with the argument, and exit")
+	flag.BoolVar(&checkMainStageOutputs, "check_stage_outputs", false, "check the outputs of the main stage against those of the bootstrap and primary stages, which always check theirs")
 }
 
 func Main(ctx *blueprint.Context, config interface{}, extraNinjaFileDeps ...string) {
+	MainProducts([]Product{{Context: ctx, Config: config}}, extraNinjaFileDeps...)
+}
+
+// A Product is a configuration of the build evaluated by MainProducts.  Each
+// Product needs its own Context, with the module types, mutators and
+// singletons of the primary builder registered.
+type Product struct {
+	// Name is added to the names of the files written for the product, so
+	// that -o build.ninja writes build-<Name>.ninja.
+	Name string
+
+	Context *blueprint.Context
+	Config  interface{}
+}
+
+// MainProducts is like Main, but evaluates the module graph once for each
+// product in a single process, and writes a separate Ninja file for each.  The
+// Blueprints files are only parsed once and shared by the products, which
+// amortizes the cost of parsing over all the products of a release build.
+// The products are evaluated one at a time, and the Ninja file, dependency
+// file and the files of the -docs, -unused, -provenance, -metrics and -dist
+// flags are written with the name of the product added, like
+// build-<Name>.ninja.
+func MainProducts(products []Product, extraNinjaFileDeps ...string) {
 	if !flag.Parsed() {
-		flag.Parse()
+		ParseFlags()
+	}
+
+	closeLogs := setupLogger()
+	defer closeLogs()
+
+	if !flagEnvironmentApplied {
+		if err := applyFlagEnvironment(flag.CommandLine, registeredFlags); err != nil {
+			fatalf("%s", err)
+		}
+		flagEnvironmentApplied = true
+	}
+
+	// -complete runs on every tab press, so it exits before doing anything
+	// else.
+	if complete {
+		err := completeTargets(os.Stdout, BuildDir, flag.Arg(0))
+		if err != nil {
+			fatalf("%s", err)
+		}
+		return
 	}
 
 	runtime.GOMAXPROCS(runtime.NumCPU())
@@ -87,12 +255,156 @@ func Main(ctx *blueprint.Context, config interface{}, extraNinjaFileDeps ...stri
 		defer trace.Stop()
 	}
 
+	if hashCacheFile != "" || chunkHashThreshold > 0 {
+		cache, err := pathtools.NewHashCache(hashCacheFile)
+		if err != nil {
+			fatalf("error reading -hash_cache: %s", err)
+		}
+		cache.ChunkThreshold = chunkHashThreshold
+		pathtools.SetHashCache(cache)
+		defer func() {
+			if err := cache.Save(); err != nil {
+				logger.Warningf("error writing -hash_cache: %s", err)
+			}
+		}()
+	}
+
+	if artifactManifest != "" {
+		err := writeArtifactManifest(artifactManifest, flag.Args())
+		if err != nil {
+			fatalf("error writing %s: %s", artifactManifest, err)
+		}
+		return
+	}
+
+	if failureReport != "" {
+		if flag.NArg() != 1 {
+			fatalf("-failure_report requires the ninja output log")
+		}
+		err := writeFailureReport(failureReport, BuildDir, failureStage, flag.Arg(0), failureOutputLines)
+		if err != nil {
+			fatalf("error writing %s: %s", failureReport, err)
+		}
+		return
+	}
+
+	if wrapperDir != "" {
+		err := writeWrapperScripts(wrapperDir, wrapperOS)
+		if err != nil {
+			fatalf("error writing wrapper scripts: %s", err)
+		}
+		return
+	}
+
+	if completionShell != "" {
+		err := writeCompletionScript(os.Stdout, completionShell)
+		if err != nil {
+			fatalf("error writing completion script: %s", err)
+		}
+		return
+	}
+
 	if flag.NArg() != 1 {
 		fatalf("no Blueprints file specified")
 	}
 
+	policy, err := pathtools.ParseSymlinkPolicy(symlinks)
+	if err != nil {
+		fatalf("invalid -symlinks: %s", err)
+	}
+	symlinkPolicy = policy
+
+	if err := checkProducts(products); err != nil {
+		fatalf("%s", err)
+	}
+
+	stageLogger := logger
+
+	var parseCache *blueprint.ParseCache
+	if len(products) > 1 {
+		parseCache = blueprint.NewParseCache()
+	}
+
+	productFiles := []*string{&outFile, &depFile, &docFile, &unusedFile, &provenanceFile, &metricsFile,
+		&diagnosticsFile, &traceDepsFile, &distFile, &ideInfoDir, &moduleGraphFile}
+	filenames := make([]string, len(productFiles))
+	for i, f := range productFiles {
+		filenames[i] = *f
+	}
+
+	for _, p := range products {
+		for i, f := range productFiles {
+			*f = productFile(filenames[i], p.Name)
+		}
+		logger = stageLogger
+		if parseCache != nil {
+			p.Context.SetParseCache(parseCache)
+		}
+
+		mainProduct(p.Context, p.Config, p.Name, extraNinjaFileDeps)
+	}
+
+	if memprofile != "" {
+		f, err := os.Create(memprofile)
+		if err != nil {
+			fatalf("error opening memprofile: %s", err)
+		}
+		defer f.Close()
+		pprof.WriteHeapProfile(f)
+	}
+}
+
+// checkProducts returns an error if two products have the same name, which
+// would make them write the same files.
+func checkProducts(products []Product) error {
+	names := make(map[string]bool)
+	for _, p := range products {
+		if names[p.Name] {
+			return fmt.Errorf("duplicate product %q", p.Name)
+		}
+		names[p.Name] = true
+	}
+	return nil
+}
+
+// productFile returns filename with the name of the product inserted before
+// the first extension, or filename if either is empty.
+func productFile(filename, product string) string {
+	if filename == "" || product == "" {
+		return filename
+	}
+	dir, base := filepath.Split(filename)
+	if dot := strings.IndexByte(base, '.'); dot > 0 {
+		return dir + base[:dot] + "-" + product + base[dot:]
+	}
+	return filename + "-" + product
+}
+
+// mainProduct generates the Ninja file of a product.
+func mainProduct(ctx *blueprint.Context, config interface{}, product string, extraNinjaFileDeps []string) {
+	var err error
 	SrcDir = filepath.Dir(flag.Arg(0))
 
+	if c, ok := config.(ConfigBootstrap); ok {
+		if errs := validateConfig(c, flag.Arg(0)); len(errs) > 0 {
+			for _, err := range errs {
+				logger.Errorf("invalid config: %s", err)
+			}
+			os.Exit(1)
+		}
+		BuildDir = c.BuildDir()
+		SrcDir = c.SrcDir()
+	}
+
+	SrcDir, err = symlinkPolicy.Canonicalize(SrcDir)
+	if err == nil {
+		BuildDir, err = symlinkPolicy.Canonicalize(BuildDir)
+	}
+	if err != nil {
+		fatalf("error canonicalizing paths: %s", err)
+	}
+	ctx.SetSymlinkPolicy(symlinkPolicy)
+
 	stage := StageMain
 	if c, ok := config.(ConfigInterface); ok {
 		if c.GeneratingBootstrapper() {
@@ -103,63 +415,403 @@ func Main(ctx *blueprint.Context, config interface{}, extraNinjaFileDeps ...stri
 		}
 	}
 
+	logger = logger.Scope(stage.String())
+	if product != "" {
+		logger = logger.Scope(product)
+	}
+	ctx.SetLogger(logger)
+
+	startDist(ctx)
+	defer finishDist()
+
 	bootstrapConfig := &Config{
 		stage: stage,
 		topLevelBlueprintsFile: flag.Arg(0),
 		runGoTests:             runGoTests,
+		showProgress:           showProgress,
+		vet: vetConfig{
+			enabled: runGoVet || goVetStrict,
+			strict:  goVetStrict,
+			cmd:     goVetCmd,
+		},
 	}
 
 	ctx.RegisterBottomUpMutator("bootstrap_plugin_deps", pluginDeps)
 	ctx.RegisterModuleType("bootstrap_go_package", newGoPackageModuleFactory(bootstrapConfig))
+	ctx.RegisterModuleType("bootstrap_go_plugin", newGoPluginModuleFactory(bootstrapConfig))
 	ctx.RegisterModuleType("bootstrap_core_go_binary", newGoBinaryModuleFactory(bootstrapConfig, StageBootstrap))
 	ctx.RegisterModuleType("bootstrap_go_binary", newGoBinaryModuleFactory(bootstrapConfig, StagePrimary))
 	ctx.RegisterModuleType("blueprint_go_binary", newGoBinaryModuleFactory(bootstrapConfig, StageMain))
 	ctx.RegisterTopDownMutator("bootstrap_stage", propagateStageBootstrap)
 	ctx.RegisterSingletonType("bootstrap", newSingletonFactory(bootstrapConfig))
+	ctx.RegisterSingletonType("bootstrap_licenses", newLicensesSingletonFactory(bootstrapConfig))
 
 	ctx.RegisterSingletonType("glob", globSingletonFactory(ctx))
 
-	deps, errs := ctx.ParseBlueprintsFiles(bootstrapConfig.topLevelBlueprintsFile)
+	resetGenerators()
+	ctx.RegisterSingletonType("generators", generatorsSingletonFactory)
+
+	if depsBaseline != "" && stage == StageMain {
+		ctx.RegisterSingletonType("deps_baseline", blueprint.NewDepsBaselineSingleton(blueprint.DepsBaseline{
+			File:   depsBaseline,
+			Update: updateDepsBaseline,
+		}))
+	} else if updateDepsBaseline && depsBaseline == "" {
+		fatalf("-update_deps_baseline requires -deps_baseline")
+	}
+
+	if schemaLock != "" && stage == StageMain {
+		ctx.RegisterSingletonType("schema_lock", blueprint.NewSchemaLockSingleton(ctx, blueprint.SchemaLock{
+			File:   schemaLock,
+			Update: updateSchemaLock,
+		}))
+	} else if updateSchemaLock && schemaLock == "" {
+		fatalf("-update_schema_lock requires -schema_lock")
+	}
+	if updateSchemaLock && dryRun {
+		fatalf("-update_schema_lock can't be used with -dry_run, which doesn't write any files")
+	}
+
+	if ideInfoDir != "" && stage == StageMain {
+		ctx.RegisterSingletonType("ide_info", blueprint.NewIDEInfoSingleton(ideInfoDir))
+	}
+
+	var ninjaFileDeps NinjaFileDeps
+
+	if unusedFile != "" {
+		ctx.SetTrackUnusedDefinitions(true)
+	}
+
+	if memoryBudget {
+		ctx.SetMemoryBudgetMode(true)
+	}
+
+	if showProgress {
+		ctx.SetProgressReporter(newProgressReporter(logger.Scope("progress")))
+	}
+
+	if strictNinjaEscapes {
+		ctx.SetStrictNinjaEscapes(true)
+	}
+
+	ctx.SetWarningsAsErrors(werror)
+	for _, w := range warningLevels {
+		ctx.SetWarningLevel(w.category, w.level)
+	}
+
+	if moduleProfile {
+		ctx.SetModuleProfiling(true)
+	}
+
+	if err := ctx.SetPropertyOverrides(overrides); err != nil {
+		fatalf("invalid -override: %s", err)
+	}
+
+	if runtime.GOOS == "windows" {
+		ctx.SetWindowsSymlinks(true)
+	}
+
+	if actionTmpDirs {
+		ctx.SetActionTmpDir(filepath.Join(BuildDir, ".tmp"))
+	}
+
+	if c, ok := config.(ConfigOutputPathPolicy); ok {
+		ctx.SetOutputPathPolicy(c.OutputPathPolicy())
+	}
+
+	if c, ok := config.(ConfigModuleTypePolicy); ok {
+		ctx.SetModuleTypePolicy(c.ModuleTypePolicy())
+	}
+
+	if c, ok := config.(ConfigLicensePolicy); ok && stage == StageMain {
+		ctx.RegisterSingletonType("license_policy", blueprint.NewLicensePolicySingleton(c.LicensePolicy()))
+	}
+
+	if c, ok := config.(ConfigDefaultTargets); ok && stage == StageMain {
+		ctx.SetDefaultTargetPolicy(c.DefaultTargets)
+	}
+
+	if c, ok := config.(ConfigBuildRoots); ok && stage == StageMain {
+		ctx.SetRootModules(c.BuildRootModules())
+		// The Go binaries are needed to regenerate the Ninja file.
+		ctx.SetRootModulesIf(isBootstrapBinaryModule)
+	}
+
+	// The outputs requested by flags other than the Ninja file can't be
+	// reused.
+	fingerprint, fingerprinting := config.(ConfigFingerprint)
+	if fingerprinting && !dryRun && docFile == "" && unusedFile == "" && metricsFile == "" &&
+		provenanceFile == "" && traceDepsFile == "" && !updateDepsBaseline && !updateSchemaLock &&
+		!(distFile != "" && distAlways) && ideInfoDir == "" && moduleGraphFile == "" {
+
+		reused, err := reuseNinjaFile(fingerprint.Fingerprint(), outFile, depFile,
+			bootstrapConfig.topLevelBlueprintsFile, ctx.EnabledMutators(config))
+		if err != nil {
+			fatalf("error checking the inputs of %s: %s", outFile, err)
+		}
+		if reused {
+			logger.Infof("inputs of %s are unchanged, not regenerating it", outFile)
+			return
+		}
+	}
+
+	blueprintsDeps, errs := ctx.ParseBlueprintsFiles(bootstrapConfig.topLevelBlueprintsFile)
 	if len(errs) > 0 {
-		fatalErrors(errs)
+		documentPropertyErrors(ctx, filepath.Dir(bootstrapConfig.topLevelBlueprintsFile), errs)
+		fatalErrors(ctx, errs)
+	}
+	ninjaFileDeps.BlueprintsFiles = blueprintsDeps
+	logger.Scope("parse").Debugf("parsed %d Blueprints files", len(blueprintsDeps))
+
+	for _, o := range ctx.AppliedPropertyOverrides() {
+		verb := "added"
+		if o.Replaced {
+			verb = "replaced"
+		}
+		logger.Scope("override").Infof("%s: %s property %q of module %q with %s",
+			o.Pos, verb, o.Property, o.Module, o.Value)
+	}
+
+	ninjaFileDeps.ConfigFiles = append(ninjaFileDeps.ConfigFiles, extraNinjaFileDeps...)
+
+	if stage == StageMain {
+		artifacts, err := ReadArtifactManifest(BuildDir)
+		if err != nil && !os.IsNotExist(err) {
+			fatalf("error reading artifact manifest: %s", err)
+		}
+		if err == nil {
+			ninjaFileDeps.ConfigFiles = append(ninjaFileDeps.ConfigFiles, artifactManifestPath(BuildDir))
+		}
+		bootstrapConfig.artifacts = make(map[string]Artifact, len(artifacts))
+		for _, artifact := range artifacts {
+			bootstrapConfig.artifacts[artifact.Name] = artifact
+		}
+	}
+	if c, ok := config.(ConfigNinjaFileDeps); ok {
+		ninjaFileDeps.ConfigFiles = append(ninjaFileDeps.ConfigFiles, c.NinjaFileDeps()...)
+	}
+
+	exported, exportsVariables := config.(ConfigExportedNinjaVariables)
+	exportsVariables = exportsVariables && stage == StageMain
+	if exportsVariables {
+		err := exportNinjaVariables(ctx, exported)
+		if err != nil {
+			fatalf("error exporting Ninja variables: %s", err)
+		}
 	}
 
-	// Add extra ninja file dependencies
-	deps = append(deps, extraNinjaFileDeps...)
+	if traceDepsFile != "" {
+		var modules []string
+		if traceDepsModules != "" {
+			modules = strings.Split(traceDepsModules, ",")
+		}
+		ctx.TraceDependencies(modules...)
+	}
 
 	errs = ctx.ResolveDependencies(config)
+
+	// The trace is written even if resolving the dependencies failed, to
+	// help finding the mutator that added an unexpected dependency.
+	if traceDepsFile != "" {
+		err := writeDependencyTrace(ctx, traceDepsFile)
+		if err != nil {
+			fatalf("error writing %s: %s", traceDepsFile, err)
+		}
+	}
+
 	if len(errs) > 0 {
-		fatalErrors(errs)
+		fatalErrors(ctx, errs)
+	}
+
+	if unusedFile != "" {
+		err := writeUnusedReport(ctx, config, unusedFile)
+		if err != nil {
+			fatalf("error writing %s: %s", unusedFile, err)
+		}
 	}
 
 	if docFile != "" {
 		err := writeDocs(ctx, filepath.Dir(bootstrapConfig.topLevelBlueprintsFile), docFile)
 		if err != nil {
-			fatalErrors([]error{err})
+			fatalErrors(ctx, []error{err})
 		}
+		reportDiagnostics(ctx, nil)
 		return
 	}
 
-	extraDeps, errs := ctx.PrepareBuildActions(config)
+	buildActionDeps, errs := ctx.PrepareBuildActions(config)
 	if len(errs) > 0 {
-		fatalErrors(errs)
+		// Singletons like the license policy write reports that explain
+		// the errors.
+		if !dryRun {
+			for _, err := range ctx.WriteSingletonFiles(true) {
+				logger.Errorf("%s", err)
+			}
+		}
+		fatalErrors(ctx, errs)
 	}
-	deps = append(deps, extraDeps...)
+	ninjaFileDeps.BuildActionFiles = buildActionDeps
+	reportDiagnostics(ctx, nil)
 
-	buf := bytes.NewBuffer(nil)
-	err := ctx.WriteBuildFile(buf)
-	if err != nil {
-		fatalf("error generating Ninja file contents: %s", err)
+	// The Ninja files of the bootstrap and primary stages only contain the
+	// bootstrap Go modules, but the main stage can have many more build
+	// statements, so its outputs are only checked when asked for.
+	var outputs []stageOutput
+	if stage != StageMain || checkMainStageOutputs {
+		var err error
+		outputs, err = stageOutputs(ctx)
+		if err != nil {
+			fatalf("error listing the outputs of the %s stage: %s", stage, err)
+		}
+		var outputPathPolicy *pathtools.OutputPathPolicy
+		if c, ok := config.(ConfigOutputPathPolicy); ok {
+			outputPathPolicy = c.OutputPathPolicy()
+		}
+		collisions, err := checkStageOutputs(BuildDir, stage, outputs, outputPathPolicy)
+		if err != nil {
+			fatalf("error reading the outputs of the earlier stages: %s", err)
+		}
+		if len(collisions) > 0 {
+			fatalErrors(ctx, collisions)
+		}
+	}
+
+	if traceFile != "" {
+		// The runtime trace has no room for user events, so the slowest
+		// modules are logged alongside it instead.
+		for _, p := range ctx.SlowestModules(slowestModules) {
+			logger.Scope("profile").Infof("GenerateBuildActions for %s (%s) took %s and allocated %d bytes in %d objects",
+				p.Variant, p.Type, p.Duration, p.AllocBytes, p.Allocs)
+		}
+	}
+
+	if dryRun {
+		err := dryRunBuild(ctx, os.Stdout)
+		if err != nil {
+			fatalf("%s", err)
+		}
+	} else {
+		writeBuildFiles(ctx, config, bootstrapConfig, ninjaFileDeps)
+
+		if stage != StageMain {
+			err := writeStageOutputs(stageOutputsPath(BuildDir, stage), outputs)
+			if err != nil {
+				fatalf("error writing %s: %s", stageOutputsPath(BuildDir, stage), err)
+			}
+		}
+
+		if stage == StageMain {
+			err := writeTargetIndex(ctx, productFile(targetIndexPath(BuildDir), product))
+			if err != nil {
+				fatalf("error writing the target index: %s", err)
+			}
+		}
+
+		if fingerprinting {
+			err := writeNinjaFileRecord(fingerprint.Fingerprint(), outFile,
+				bootstrapConfig.topLevelBlueprintsFile, ctx.SubninjaFiles(), ninjaFileDeps,
+				ctx.EnabledMutators(config))
+			if err != nil {
+				fatalf("error writing %s: %s", ninjaFileRecordPath(outFile), err)
+			}
+		}
+
+		if exportsVariables {
+			err := writeExportedNinjaFile(ctx)
+			if err != nil {
+				fatalf("error writing %s: %s", ExportedNinjaFile, err)
+			}
+		}
+
+		if errs := ctx.WriteSingletonFiles(false); len(errs) > 0 {
+			for _, err := range errs {
+				logger.Errorf("%s", err)
+			}
+			failDist(errs)
+			os.Exit(1)
+		}
+	}
+
+	if provenanceFile != "" {
+		err := writeProvenance(ctx, config, provenanceFile)
+		if err != nil {
+			fatalf("error writing %s: %s", provenanceFile, err)
+		}
 	}
 
+	if metricsFile != "" {
+		err := writeMetrics(ctx, metricsFile)
+		if err != nil {
+			fatalf("error writing %s: %s", metricsFile, err)
+		}
+	}
+
+	if moduleGraphFile != "" {
+		err := writeModuleGraph(ctx, moduleGraphFile, moduleGraphSplit)
+		if err != nil {
+			fatalf("error writing %s: %s", moduleGraphFile, err)
+		}
+	}
+}
+
+// writeBuildFiles writes the Ninja file, its subninjas and its dependency file,
+// and removes the files left behind by a previous build.
+func writeBuildFiles(ctx *blueprint.Context, config interface{}, bootstrapConfig *Config,
+	ninjaFileDeps NinjaFileDeps) {
+
 	const outFilePermissions = 0666
-	err = ioutil.WriteFile(outFile, buf.Bytes(), outFilePermissions)
+	buf := bytes.NewBuffer(nil)
+	if patchNinjaFile {
+		segments, err := ctx.BuildFileSegments()
+		if err != nil {
+			fatalf("error generating Ninja file contents: %s", err)
+		}
+
+		stats, err := pathtools.PatchFile(outFile, segments, outFilePermissions)
+		if err != nil {
+			fatalf("error writing %s: %s", outFile, err)
+		}
+		if stats.Rewritten {
+			logger.Infof("rewrote %s (%d bytes)", outFile, stats.Written)
+		} else {
+			logger.Infof("patched %d of %d parts of %s (%d bytes)", len(stats.Changed),
+				len(segments), outFile, stats.Written)
+		}
+	} else {
+		err := ctx.WriteBuildFile(buf)
+		if err != nil {
+			fatalf("error generating Ninja file contents: %s", err)
+		}
+
+		err = ioutil.WriteFile(outFile, buf.Bytes(), outFilePermissions)
+		if err != nil {
+			fatalf("error writing %s: %s", outFile, err)
+		}
+	}
+
+	for _, subninja := range ctx.SubninjaFiles() {
+		buf.Reset()
+		err := ctx.WriteSubninjaFile(subninja, buf)
+		if err != nil {
+			fatalf("error generating %s contents: %s", subninja, err)
+		}
+
+		err = os.MkdirAll(filepath.Dir(subninja), 0777)
+		if err == nil {
+			err = ioutil.WriteFile(subninja, buf.Bytes(), outFilePermissions)
+		}
+		if err != nil {
+			fatalf("error writing %s: %s", subninja, err)
+		}
+	}
+
+	err := removeStaleSubninjas(outFile, ctx.SubninjaFiles())
 	if err != nil {
-		fatalf("error writing %s: %s", outFile, err)
+		fatalf("error removing stale subninja files: %s", err)
 	}
 
 	if depFile != "" {
-		err := deptools.WriteDepFile(depFile, outFile, deps)
+		err := ninjaFileDeps.WriteDepFile(depFile, outFile)
 		if err != nil {
 			fatalf("error writing depfile: %s", err)
 		}
@@ -171,36 +823,162 @@ func Main(ctx *blueprint.Context, config interface{}, extraNinjaFileDeps ...stri
 			fatalf("error removing abandoned files: %s", err)
 		}
 	}
+}
 
-	if memprofile != "" {
-		f, err := os.Create(memprofile)
+// propertyOverrideFlags is the flag.Value of -override.
+type propertyOverrideFlags []blueprint.PropertyOverride
+
+func (f *propertyOverrideFlags) String() string {
+	return `""`
+}
+
+func (f *propertyOverrideFlags) Set(s string) error {
+	o, err := blueprint.ParsePropertyOverride(s)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, o)
+	return nil
+}
+
+// writeMetrics writes the memory usage of the primary builder, the allocation
+// counters of the arenas used with -memory_budget and, with -module_profile,
+// the profiles of the -slowest_modules modules as JSON.
+func writeMetrics(ctx *blueprint.Context, filename string) error {
+	data, err := metricsJSON(ctx)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0666)
+}
+
+// metricsJSON returns the contents of the -metrics file.
+func metricsJSON(ctx *blueprint.Context) ([]byte, error) {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+
+	metrics := struct {
+		HeapAlloc  uint64
+		TotalAlloc uint64
+		Sys        uint64
+		NumGC      uint32
+		Arenas     blueprint.MemoryStats
+
+		SlowestModules []blueprint.ModuleProfile `json:",omitempty"`
+	}{
+		HeapAlloc:  memStats.HeapAlloc,
+		TotalAlloc: memStats.TotalAlloc,
+		Sys:        memStats.Sys,
+		NumGC:      memStats.NumGC,
+		Arenas:     ctx.MemoryStats(),
+
+		SlowestModules: ctx.SlowestModules(slowestModules),
+	}
+
+	data, err := json.MarshalIndent(metrics, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// writeDependencyTrace writes the dependencies recorded by the Context after
+// -trace_deps enabled tracing them.
+func writeDependencyTrace(ctx *blueprint.Context, filename string) error {
+	buf := bytes.NewBuffer(nil)
+	err := ctx.WriteDependencyTrace(buf)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, buf.Bytes(), 0666)
+}
+
+// writeUnusedReport writes the variables and modules that are not used by the
+// build.  Go binaries and plugins are always considered used, as are the modules
+// for which the config's IsRootModule method returns true.
+func writeUnusedReport(ctx *blueprint.Context, config interface{}, filename string) error {
+	report := ctx.FindUnusedDefinitions(func(module blueprint.Module) bool {
+		switch m := module.(type) {
+		case *goBinary:
+			return true
+		case *goPackage:
+			if m.isPlugin {
+				return true
+			}
+		}
+		if c, ok := config.(ConfigRootModules); ok {
+			return c.IsRootModule(module)
+		}
+		return false
+	})
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if filepath.Ext(filename) == ".json" {
+		return report.WriteJSON(f)
+	}
+	return report.WriteText(f)
+}
+
+// setupLogger creates the logger from the -log_level, -log_file and -log_json
+// flags, and returns a function that closes the log files.
+func setupLogger() func() {
+	logger = logging.New()
+
+	level, err := logging.ParseLevel(logLevel)
+	if err != nil {
+		logger.AddSink(logging.NewConsoleSink(os.Stderr), logging.Info)
+		fatalf("invalid -log_level: %s", err)
+	}
+	logger.AddSink(logging.NewConsoleSink(os.Stderr), level)
+
+	var files []*os.File
+	addFileSink := func(filename string, newSink func(io.Writer) logging.Sink) {
+		if filename == "" {
+			return
+		}
+		f, err := os.Create(filename)
 		if err != nil {
-			fatalf("error opening memprofile: %s", err)
+			fatalf("error opening log file: %s", err)
+		}
+		files = append(files, f)
+		logger.AddSink(newSink(f), logging.Debug)
+	}
+	addFileSink(logFile, logging.NewFileSink)
+	addFileSink(logJSON, logging.NewJSONSink)
+
+	return func() {
+		for _, f := range files {
+			f.Close()
 		}
-		defer f.Close()
-		pprof.WriteHeapProfile(f)
 	}
 }
 
 func fatalf(format string, args ...interface{}) {
-	fmt.Printf(format, args...)
-	fmt.Print("\n")
+	logger.Errorf(format, args...)
+	failDist([]error{fmt.Errorf(format, args...)})
 	os.Exit(1)
 }
 
-func fatalErrors(errs []error) {
-	red := "\x1b[31m"
-	unred := "\x1b[0m"
-
+func fatalErrors(ctx *blueprint.Context, errs []error) {
+	reportDiagnostics(ctx, errs)
 	for _, err := range errs {
 		switch err := err.(type) {
 		case *blueprint.BlueprintError,
 			*blueprint.ModuleError,
-			*blueprint.PropertyError:
-			fmt.Printf("%serror:%s %s\n", red, unred, err.Error())
+			*blueprint.PropertyError,
+			*blueprint.PropertyUnpackError,
+			*blueprint.Diagnostic,
+			*pathtools.OutputPathError:
+			logger.Errorf("%s", err.Error())
 		default:
-			fmt.Printf("%sinternal error:%s %s\n", red, unred, err)
+			logger.Errorf("internal error: %s", err)
 		}
 	}
+	failDist(errs)
 	os.Exit(1)
 }
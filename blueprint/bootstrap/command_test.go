@@ -0,0 +1,64 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import "testing"
+
+func TestProductFile(t *testing.T) {
+	testCases := []struct {
+		filename, product, expected string
+	}{
+		{"build.ninja", "arm", "build-arm.ninja"},
+		{"out/build.ninja.d", "arm", "out/build-arm.ninja.d"},
+		{"out/.bootstrap/build.ninja", "arm", "out/.bootstrap/build-arm.ninja"},
+		{"out/ide_info", "arm", "out/ide_info-arm"},
+		{"out/.hidden", "arm", "out/.hidden-arm"},
+		{"build.ninja", "", "build.ninja"},
+		{"", "arm", ""},
+	}
+
+	for _, testCase := range testCases {
+		got := productFile(testCase.filename, testCase.product)
+		if got != testCase.expected {
+			t.Errorf("productFile(%q, %q): expected %q, got %q", testCase.filename,
+				testCase.product, testCase.expected, got)
+		}
+	}
+}
+
+func TestCheckProducts(t *testing.T) {
+	testCases := []struct {
+		names []string
+		err   string
+	}{
+		{names: []string{""}},
+		{names: []string{"arm", "x86"}},
+		{names: []string{"arm", "x86", "arm"}, err: `duplicate product "arm"`},
+		{names: []string{"", ""}, err: `duplicate product ""`},
+	}
+
+	for _, testCase := range testCases {
+		var products []Product
+		for _, name := range testCase.names {
+			products = append(products, Product{Name: name})
+		}
+		err := checkProducts(products)
+		if testCase.err == "" && err != nil {
+			t.Errorf("%q: unexpected error %q", testCase.names, err)
+		} else if testCase.err != "" && (err == nil || err.Error() != testCase.err) {
+			t.Errorf("%q: expected error %q, got %v", testCase.names, testCase.err, err)
+		}
+	}
+}
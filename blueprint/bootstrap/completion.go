@@ -0,0 +1,224 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/pathtools"
+)
+
+// targetIndexFile is the name of the index of the module names and phony
+// targets of the main stage in the .bootstrap directory.  Each product of
+// MainProducts writes its own index, with the name of the product added.
+const targetIndexFile = "targets"
+
+func targetIndexPath(buildDir string) string {
+	return filepath.Join(buildDir, bootstrapSubDir, targetIndexFile)
+}
+
+// writeTargetIndex writes the sorted names of the modules and the outputs of
+// the phony build statements to filename, one per line.  The index is left
+// untouched if its contents didn't change.
+func writeTargetIndex(ctx *blueprint.Context, filename string) error {
+	statements, err := ctx.BuildStatements()
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	var targets []string
+	add := func(target string) {
+		if !seen[target] {
+			seen[target] = true
+			targets = append(targets, target)
+		}
+	}
+
+	ctx.VisitAllModules(func(module blueprint.Module) {
+		add(ctx.ModuleName(module))
+	})
+	for _, s := range statements {
+		if s.Rule == "phony" {
+			for _, output := range s.Outputs {
+				add(output)
+			}
+		}
+	}
+	sort.Strings(targets)
+
+	buf := &bytes.Buffer{}
+	for _, target := range targets {
+		fmt.Fprintln(buf, target)
+	}
+	return pathtools.WriteFileIfChanged(filename, buf.Bytes(), 0666)
+}
+
+// completeTargets writes the targets in the indexes of all the products in
+// buildDir that start with prefix to w, one per line.  It only reads the
+// indexes, so that it is fast enough to run on every tab press, and writes
+// nothing if the main stage hasn't run yet.
+func completeTargets(w io.Writer, buildDir, prefix string) error {
+	index := targetIndexPath(buildDir)
+	files, err := filepath.Glob(index + "-*")
+	if err != nil {
+		return err
+	}
+	files = append([]string{index}, files...)
+
+	seen := make(map[string]bool)
+	var matches []string
+	for _, file := range files {
+		f, err := os.Open(file)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			target := scanner.Text()
+			if strings.HasPrefix(target, prefix) && !seen[target] {
+				seen[target] = true
+				matches = append(matches, target)
+			}
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("error reading %s: %s", file, err)
+		}
+	}
+	sort.Strings(matches)
+
+	for _, target := range matches {
+		if _, err := fmt.Fprintln(w, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var completionFuncs = template.FuncMap{
+	// shquote quotes a string for bash and zsh.
+	"shquote": func(s string) string {
+		return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+	},
+	// fishquote quotes a string for fish, which only supports \\ and \'
+	// escapes in single quoted strings.
+	"fishquote": func(s string) string {
+		s = strings.Replace(s, `\`, `\\`, -1)
+		return "'" + strings.Replace(s, "'", `\'`, -1) + "'"
+	},
+}
+
+var completionScripts = map[string]*template.Template{
+	"bash": template.Must(template.New("bash").Funcs(completionFuncs).Parse(bashCompletionTemplate)),
+	"zsh":  template.Must(template.New("zsh").Funcs(completionFuncs).Parse(zshCompletionTemplate)),
+	"fish": template.Must(template.New("fish").Funcs(completionFuncs).Parse(fishCompletionTemplate)),
+}
+
+// writeCompletionScript writes the script that completes the module names and
+// phony targets passed to the wrapper scripts in shell to w.  The script runs
+// this primary builder with -complete to find the targets.
+func writeCompletionScript(w io.Writer, shell string) error {
+	tmpl, ok := completionScripts[shell]
+	if !ok {
+		return fmt.Errorf("unsupported shell %q, expected bash, zsh or fish", shell)
+	}
+
+	builder, err := exec.LookPath(os.Args[0])
+	if err == nil {
+		builder, err = filepath.Abs(builder)
+	}
+	if err != nil {
+		return fmt.Errorf("error finding the primary builder: %s", err)
+	}
+
+	return tmpl.Execute(w, struct {
+		Builder string
+		Wrapper string
+	}{builder, bashWrapper.name})
+}
+
+// The completion scripts find the build directory the same way as the wrapper
+// script: from $BUILDDIR, or else the directory containing the wrapper.
+
+const bashCompletionTemplate = `# Completion of the targets of {{.Wrapper}} for bash, generated by
+# {{.Builder}} -completion bash.
+#
+# Load it with: source <({{.Builder}} -completion bash)
+
+_blueprint_complete() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    if [[ "$cur" == -* ]]; then
+        return
+    fi
+    local builddir="${BUILDDIR:-$(dirname "${COMP_WORDS[0]}")}"
+    COMPREPLY=($({{shquote .Builder}} -b "$builddir" -complete "$cur" 2>/dev/null))
+}
+
+complete -F _blueprint_complete {{.Wrapper}}
+`
+
+const zshCompletionTemplate = `#compdef {{.Wrapper}}
+
+# Completion of the targets of {{.Wrapper}} for zsh, generated by
+# {{.Builder}} -completion zsh.
+#
+# Load it with: source <({{.Builder}} -completion zsh)
+
+_blueprint_complete() {
+    if [[ "$PREFIX" == -* ]]; then
+        return 1
+    fi
+    local builddir="${BUILDDIR:-${words[1]:h}}"
+    local -a targets
+    targets=(${(f)"$({{shquote .Builder}} -b "$builddir" -complete "$PREFIX" 2>/dev/null)"})
+    compadd -a targets
+}
+
+compdef _blueprint_complete {{.Wrapper}}
+`
+
+const fishCompletionTemplate = `# Completion of the targets of {{.Wrapper}} for fish, generated by
+# {{.Builder}} -completion fish.
+#
+# Load it with: {{.Builder}} -completion fish | source
+
+function __blueprint_complete
+    set -l cur (commandline -ct)
+    if string match -q -- '-*' $cur
+        return
+    end
+    set -l builddir $BUILDDIR
+    if test -z "$builddir"
+        set builddir (dirname -- (commandline -opc)[1])
+    end
+    {{fishquote .Builder}} -b $builddir -complete $cur 2>/dev/null
+end
+
+complete -c {{.Wrapper}} -f -a '(__blueprint_complete)'
+`
@@ -0,0 +1,218 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/blueprint"
+)
+
+// buildTestModule is a module that builds its outputs with cp, and its phony
+// targets with phony build statements.  The outputs can refer to the value of
+// the dir property as the local variable ${dir}.
+type buildTestModule struct {
+	blueprint.SimpleName
+	properties struct {
+		Dir     string
+		Outputs []string
+		Phony   []string
+	}
+}
+
+func newBuildTestModule() (blueprint.Module, []interface{}) {
+	m := &buildTestModule{}
+	return m, []interface{}{&m.properties, &m.SimpleName.Properties}
+}
+
+func (m *buildTestModule) GenerateBuildActions(ctx blueprint.ModuleContext) {
+	if m.properties.Dir != "" {
+		ctx.Variable(pctx, "dir", m.properties.Dir)
+	}
+	for _, output := range m.properties.Outputs {
+		ctx.Build(pctx, blueprint.BuildParams{
+			Rule:    cp,
+			Outputs: []string{output},
+			Inputs:  []string{"in"},
+		})
+	}
+	if len(m.properties.Phony) > 0 {
+		ctx.Build(pctx, blueprint.BuildParams{
+			Rule:      blueprint.Phony,
+			Outputs:   m.properties.Phony,
+			Implicits: m.properties.Outputs,
+		})
+	}
+}
+
+func runBuildTest(t *testing.T, blueprints string) *blueprint.Context {
+	ctx := blueprint.NewContext()
+	ctx.RegisterModuleType("test_module", newBuildTestModule)
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(blueprints),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) > 0 {
+		t.Fatalf("unexpected parse errors: %v", errs)
+	}
+	errs = ctx.ResolveDependencies(nil)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected dependency errors: %v", errs)
+	}
+	_, errs = ctx.PrepareBuildActions(nil)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors preparing build actions: %v", errs)
+	}
+	return ctx
+}
+
+func TestWriteTargetIndex(t *testing.T) {
+	ctx := runBuildTest(t, `
+		test_module {
+			name: "foo",
+			outputs: ["out/foo"],
+			phony: ["foo-all", "checkbuild"],
+		}
+
+		test_module {
+			name: "bar",
+			outputs: ["out/bar"],
+			phony: ["checkbuild"],
+		}
+
+		test_module {
+			name: "foo-all",
+		}
+	`)
+
+	dir, err := ioutil.TempDir("", "completion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	index := targetIndexPath(dir)
+	if err := os.MkdirAll(filepath.Dir(index), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeTargetIndex(ctx, index); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "bar\ncheckbuild\nfoo\nfoo-all\n"
+	if string(data) != expected {
+		t.Errorf("expected index %q, got %q", expected, string(data))
+	}
+}
+
+func TestCompleteTargets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "completion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Nothing is completed before the main stage has run.
+	buf := &bytes.Buffer{}
+	if err := completeTargets(buf, dir, ""); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected no targets without an index, got %q", buf.String())
+	}
+
+	index := targetIndexPath(dir)
+	if err := os.MkdirAll(filepath.Dir(index), 0777); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		index:             "bar\ncheckbuild\nfoo\nfoo-all\n",
+		index + "-phone":  "checkbuild\nfoo-phone\nradio\n",
+		index + "-tablet": "foo-tablet\n",
+	}
+	for file, contents := range files {
+		if err := ioutil.WriteFile(file, []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		prefix   string
+		expected string
+	}{
+		{"", "bar\ncheckbuild\nfoo\nfoo-all\nfoo-phone\nfoo-tablet\nradio\n"},
+		{"foo", "foo\nfoo-all\nfoo-phone\nfoo-tablet\n"},
+		{"foo-", "foo-all\nfoo-phone\nfoo-tablet\n"},
+		{"check", "checkbuild\n"},
+		{"missing", ""},
+	}
+	for _, testCase := range testCases {
+		buf.Reset()
+		if err := completeTargets(buf, dir, testCase.prefix); err != nil {
+			t.Errorf("%q: unexpected error: %s", testCase.prefix, err)
+			continue
+		}
+		if buf.String() != testCase.expected {
+			t.Errorf("%q: expected %q, got %q", testCase.prefix, testCase.expected, buf.String())
+		}
+	}
+}
+
+func TestWriteCompletionScript(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		buf := &bytes.Buffer{}
+		if err := writeCompletionScript(buf, shell); err != nil {
+			t.Errorf("%s: unexpected error: %s", shell, err)
+			continue
+		}
+		if !strings.Contains(buf.String(), " -complete ") ||
+			!strings.Contains(buf.String(), bashWrapper.name) {
+			t.Errorf("%s: expected the script to run -complete for %s, got:\n%s",
+				shell, bashWrapper.name, buf.String())
+		}
+	}
+
+	err := writeCompletionScript(&bytes.Buffer{}, "csh")
+	if err == nil || err.Error() != `unsupported shell "csh", expected bash, zsh or fish` {
+		t.Errorf("expected an error for csh, got %v", err)
+	}
+}
+
+func TestCompletionQuoting(t *testing.T) {
+	testCases := []struct {
+		fn, in, out string
+	}{
+		{"shquote", "/a b/builder", `'/a b/builder'`},
+		{"shquote", "/it's", `'/it'\''s'`},
+		{"fishquote", "/a b/builder", `'/a b/builder'`},
+		{"fishquote", `/it's\`, `'/it\'s\\'`},
+	}
+	for _, testCase := range testCases {
+		quote := completionFuncs[testCase.fn].(func(string) string)
+		if out := quote(testCase.in); out != testCase.out {
+			t.Errorf("%s(%q): expected %q, got %q", testCase.fn, testCase.in, testCase.out, out)
+		}
+	}
+}
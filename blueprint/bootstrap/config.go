@@ -15,41 +15,36 @@
 package bootstrap
 
 import (
+	"fmt"
+	"path/filepath"
 	"runtime"
+	"sort"
 
 	"github.com/google/blueprint"
+	"github.com/google/blueprint/pathtools"
 )
 
-func bootstrapVariable(name, template string, value func() string) blueprint.Variable {
-	return pctx.VariableFunc(name, func(config interface{}) (string, error) {
-		if c, ok := config.(ConfigInterface); ok && c.GeneratingBootstrapper() {
-			return template, nil
-		}
-		return value(), nil
-	})
-}
-
 var (
 	// These variables are the only configuration needed by the boostrap
 	// modules.  For the first bootstrap stage, they are set to the
 	// variable name enclosed in "@@" so that their values can be easily
 	// replaced in the generated Ninja file.
-	srcDir = bootstrapVariable("srcDir", "@@SrcDir@@", func() string {
+	srcDir = templateVariable(pctx, "srcDir", "@@SrcDir@@", func() string {
 		return SrcDir
 	})
-	buildDir = bootstrapVariable("buildDir", "@@BuildDir@@", func() string {
+	buildDir = templateVariable(pctx, "buildDir", "@@BuildDir@@", func() string {
 		return BuildDir
 	})
-	goRoot = bootstrapVariable("goRoot", "@@GoRoot@@", func() string {
+	goRoot = templateVariable(pctx, "goRoot", "@@GoRoot@@", func() string {
 		return runtime.GOROOT()
 	})
-	compileCmd = bootstrapVariable("compileCmd", "@@GoCompile@@", func() string {
+	compileCmd = templateVariable(pctx, "compileCmd", "@@GoCompile@@", func() string {
 		return "$goRoot/pkg/tool/" + runtime.GOOS + "_" + runtime.GOARCH + "/compile"
 	})
-	linkCmd = bootstrapVariable("linkCmd", "@@GoLink@@", func() string {
+	linkCmd = templateVariable(pctx, "linkCmd", "@@GoLink@@", func() string {
 		return "$goRoot/pkg/tool/" + runtime.GOOS + "_" + runtime.GOARCH + "/link"
 	})
-	bootstrapCmd = bootstrapVariable("bootstrapCmd", "@@Bootstrap@@", func() string {
+	bootstrapCmd = templateVariable(pctx, "bootstrapCmd", "@@Bootstrap@@", func() string {
 		panic("bootstrapCmd is only available for minibootstrap")
 	})
 )
@@ -78,6 +73,215 @@ type ConfigBlueprintToolLocation interface {
 	BlueprintToolLocation() string
 }
 
+type ConfigNinjaFileDeps interface {
+	// NinjaFileDeps should return the files that the configuration was read
+	// from, so that the Ninja file is regenerated when they change.  See
+	// NinjaFileDeps for the other inputs that are tracked automatically.
+	NinjaFileDeps() []string
+}
+
+type ConfigRootModules interface {
+	// IsRootModule should return true if the module is used even if no other
+	// module depends on it, for example because it is built by default.  It
+	// is only used to report unused modules with the -unused flag.
+	IsRootModule(module blueprint.Module) bool
+}
+
+type ConfigOutputPathPolicy interface {
+	// OutputPathPolicy should return the policy that the output paths of all
+	// build statements are checked against before the Ninja file is written.
+	OutputPathPolicy() *pathtools.OutputPathPolicy
+}
+
+type ConfigModuleTypePolicy interface {
+	// ModuleTypePolicy should return the policy that restricts the module
+	// types that can be used in each directory of the source tree.
+	ModuleTypePolicy() *blueprint.ModuleTypePolicy
+}
+
+type ConfigLicensePolicy interface {
+	// LicensePolicy should return the policy that the license kinds of the
+	// dependencies of the modules are checked against in the Main stage.
+	LicensePolicy() blueprint.LicensePolicy
+}
+
+type ConfigDefaultTargets interface {
+	// DefaultTargets should pick the targets that Ninja builds when it is run
+	// without arguments from the outputs that modules and singletons
+	// nominated with BuildParams.DefaultPriority, in the Main stage.  See
+	// blueprint.DefaultTargetPolicy.
+	DefaultTargets(nominated []blueprint.DefaultTarget) []string
+}
+
+type ConfigBuildRoots interface {
+	// BuildRootModules should return the names of the modules that the Main
+	// stage builds.  If it is not empty, the module variants that are not
+	// reachable from these modules are dropped before generating build
+	// actions, see blueprint.Context.SetRootModules.
+	BuildRootModules() []string
+}
+
+type ConfigExportedNinjaVariables interface {
+	// ExportedNinjaVariables should return the configuration values to write
+	// as Ninja variables to ExportedNinjaFile in the build directory, for use
+	// by hand-written Ninja files.  A variable that was exported by the
+	// previous run but is not returned anymore is an error, until the file is
+	// deleted.  It is only used by the Main stage.
+	ExportedNinjaVariables() map[string]string
+}
+
+type ConfigFingerprint interface {
+	// Fingerprint should return the strategy used to detect that the inputs
+	// of the Ninja file changed.  When the primary builder is rerun because
+	// the modification time of an input changed, but none of the inputs
+	// changed according to the fingerprint, it only touches the Ninja file
+	// instead of regenerating it.
+	Fingerprint() pathtools.Fingerprint
+}
+
+// StampInfo is the build information that is linked into the bootstrap Go
+// binaries that set `stamp: true`, using the -X flag of the Go linker.
+type StampInfo struct {
+	// Revision is the VCS revision of the source tree, linked into the
+	// main.BuildRevision string variable.
+	Revision string
+
+	// BuildTime is linked into the main.BuildTime string variable.  It should
+	// not depend on the current time for reproducible builds, for example by
+	// reading it from SOURCE_DATE_EPOCH.
+	BuildTime string
+
+	// Vars are additional values, like configuration identifiers, keyed by
+	// the fully qualified name of the string variable to set, for example
+	// "main.product".
+	Vars map[string]string
+}
+
+type ConfigStamp interface {
+	// Stamp should return the build information to link into stamped
+	// binaries.  It is called once for each stamped binary, and changes to the
+	// returned values cause the binaries to be relinked when the Ninja file is
+	// regenerated.  Binaries are stamped with empty values if the config
+	// doesn't implement ConfigStamp.
+	Stamp() StampInfo
+}
+
+// A PrimaryBuilderInvocation is an additional invocation of the primary builder
+// in the primary stage, for example to generate documentation.
+type PrimaryBuilderInvocation struct {
+	// Inputs are the files read by the invocation, other than the primary
+	// builder itself.
+	Inputs []string
+
+	// Outputs are the files written by the invocation.
+	Outputs []string
+
+	// Args are the arguments passed to the primary builder.
+	Args []string
+
+	// Env are the environment variables set for the invocation, in addition
+	// to the environment Ninja is run with.
+	Env map[string]string
+}
+
+type ConfigBootstrap interface {
+	// BuildDir should return the build output directory.  It overrides the
+	// -b flag.
+	BuildDir() string
+
+	// SrcDir should return the root directory of the source tree, which must
+	// contain the top-level Blueprints file.
+	SrcDir() string
+
+	// Subninjas should return Ninja files that are included at the end of
+	// the main Ninja file with subninja statements.  The paths are relative
+	// to the directory Ninja is run from, and may reference $buildDir.
+	Subninjas() []string
+
+	// PrimaryBuilderInvocations should return the additional invocations of
+	// the primary builder that are added to the primary stage Ninja file.
+	PrimaryBuilderInvocations() []PrimaryBuilderInvocation
+}
+
+// validateConfig checks the values returned by a ConfigBootstrap, so that
+// mistakes are reported when the primary builder starts instead of as broken
+// Ninja files.
+func validateConfig(c ConfigBootstrap, topLevelBlueprintsFile string) []error {
+	var errs []error
+	errorf := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if c.BuildDir() == "" {
+		errorf("BuildDir() must not be empty")
+	}
+
+	// The top-level Blueprints file may be in a subdirectory of SrcDir, for
+	// example if the source tree keeps its build files in a build/ directory.
+	srcDir, blueprintsFile := c.SrcDir(), topLevelBlueprintsFile
+	if filepath.IsAbs(srcDir) != filepath.IsAbs(blueprintsFile) {
+		srcDir, _ = filepath.Abs(srcDir)
+		blueprintsFile, _ = filepath.Abs(blueprintsFile)
+	}
+	if _, err := pathtools.RelativizeToBase(srcDir, blueprintsFile); err != nil {
+		errorf("SrcDir() returned %q, but the top-level Blueprints file %q is not inside it",
+			c.SrcDir(), topLevelBlueprintsFile)
+	}
+
+	subninjas := make(map[string]bool)
+	for i, subninja := range c.Subninjas() {
+		if subninja == "" {
+			errorf("Subninjas()[%d] must not be empty", i)
+		} else if subninjas[subninja] {
+			errorf("Subninjas()[%d]: %q is listed more than once", i, subninja)
+		}
+		subninjas[subninja] = true
+	}
+
+	outputs := make(map[string]int)
+	for i, invocation := range c.PrimaryBuilderInvocations() {
+		if len(invocation.Outputs) == 0 {
+			errorf("PrimaryBuilderInvocations()[%d] has no outputs", i)
+		}
+		if len(invocation.Args) == 0 {
+			errorf("PrimaryBuilderInvocations()[%d] has no arguments", i)
+		}
+		var names []string
+		for name := range invocation.Env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if !isEnvName(name) {
+				errorf("PrimaryBuilderInvocations()[%d]: invalid environment variable name %q", i, name)
+			}
+		}
+		for _, output := range invocation.Outputs {
+			if prev, ok := outputs[output]; ok {
+				errorf("PrimaryBuilderInvocations()[%d]: output %q is also written by PrimaryBuilderInvocations()[%d]",
+					i, output, prev)
+			}
+			outputs[output] = i
+		}
+	}
+
+	return errs
+}
+
+// isEnvName returns true if name is a valid name of an environment variable
+// that can be set in a shell command without quoting.
+func isEnvName(name string) bool {
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
 type Stage int
 
 const (
@@ -86,10 +290,33 @@ const (
 	StageMain
 )
 
+func (s Stage) String() string {
+	switch s {
+	case StageBootstrap:
+		return "bootstrap"
+	case StagePrimary:
+		return "primary"
+	case StageMain:
+		return "main"
+	default:
+		panic(fmt.Errorf("unknown stage %d", int(s)))
+	}
+}
+
 type Config struct {
 	stage Stage
 
 	topLevelBlueprintsFile string
 
 	runGoTests bool
+
+	vet vetConfig
+
+	// showProgress is true if the primary builder shows the progress of
+	// generating the main Ninja file, see -progress.
+	showProgress bool
+
+	// The artifacts promoted by the bootstrap and primary stages, by module
+	// name.  Only set in the main stage.
+	artifacts map[string]Artifact
 }
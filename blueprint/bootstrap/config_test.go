@@ -0,0 +1,112 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"reflect"
+	"testing"
+)
+
+type validateConfigTest struct {
+	srcDir      string
+	buildDir    string
+	subninjas   []string
+	invocations []PrimaryBuilderInvocation
+}
+
+func (c validateConfigTest) SrcDir() string      { return c.srcDir }
+func (c validateConfigTest) BuildDir() string    { return c.buildDir }
+func (c validateConfigTest) Subninjas() []string { return c.subninjas }
+func (c validateConfigTest) PrimaryBuilderInvocations() []PrimaryBuilderInvocation {
+	return c.invocations
+}
+
+func TestValidateConfig(t *testing.T) {
+	testCases := []struct {
+		config     validateConfigTest
+		blueprints string
+		errs       []string
+	}{
+		{
+			config:     validateConfigTest{srcDir: ".", buildDir: "out"},
+			blueprints: "Blueprints",
+		},
+		{
+			config:     validateConfigTest{srcDir: "src", buildDir: "out"},
+			blueprints: "src/build/Blueprints",
+		},
+		{
+			config:     validateConfigTest{srcDir: "src/", buildDir: "out"},
+			blueprints: "./src/Blueprints",
+		},
+		{
+			config:     validateConfigTest{srcDir: "src", buildDir: "out"},
+			blueprints: "other/Blueprints",
+			errs: []string{
+				`SrcDir() returned "src", but the top-level Blueprints file "other/Blueprints" is not inside it`,
+			},
+		},
+		{
+			config:     validateConfigTest{srcDir: "src/build", buildDir: ""},
+			blueprints: "src/Blueprints",
+			errs: []string{
+				`BuildDir() must not be empty`,
+				`SrcDir() returned "src/build", but the top-level Blueprints file "src/Blueprints" is not inside it`,
+			},
+		},
+		{
+			config:     validateConfigTest{srcDir: ".", buildDir: "out", subninjas: []string{"a.ninja", "", "a.ninja"}},
+			blueprints: "Blueprints",
+			errs: []string{
+				`Subninjas()[1] must not be empty`,
+				`Subninjas()[2]: "a.ninja" is listed more than once`,
+			},
+		},
+		{
+			config: validateConfigTest{srcDir: ".", buildDir: "out", invocations: []PrimaryBuilderInvocation{
+				{
+					Outputs: []string{"out/a"},
+					Args:    []string{"-o", "out/a"},
+					Env:     map[string]string{"FOO": "a b", "_BAR_2": "$x"},
+				},
+				{
+					Outputs: []string{"out/b"},
+					Args:    []string{"-o", "out/b"},
+					Env:     map[string]string{"": "", "2X": "", "A B": "", "A=B": "", "A;B": "", "OK": ""},
+				},
+			}},
+			blueprints: "Blueprints",
+			errs: []string{
+				`PrimaryBuilderInvocations()[1]: invalid environment variable name ""`,
+				`PrimaryBuilderInvocations()[1]: invalid environment variable name "2X"`,
+				`PrimaryBuilderInvocations()[1]: invalid environment variable name "A B"`,
+				`PrimaryBuilderInvocations()[1]: invalid environment variable name "A;B"`,
+				`PrimaryBuilderInvocations()[1]: invalid environment variable name "A=B"`,
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		var errs []string
+		for _, err := range validateConfig(testCase.config, testCase.blueprints) {
+			errs = append(errs, err.Error())
+		}
+		if !reflect.DeepEqual(errs, testCase.errs) {
+			t.Errorf("%+v %q: incorrect errors:", testCase.config, testCase.blueprints)
+			t.Errorf("  expected: %q", testCase.errs)
+			t.Errorf("       got: %q", errs)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+
+	"github.com/google/blueprint"
+)
+
+// warningLevelFlags is the flag.Value of -W, which sets the level of the
+// warnings of a category as <category>=<level>.
+type warningLevelFlags []warningLevelFlag
+
+type warningLevelFlag struct {
+	category string
+	level    blueprint.DiagnosticLevel
+}
+
+func (f *warningLevelFlags) String() string {
+	return `""`
+}
+
+func (f *warningLevelFlags) Set(s string) error {
+	eq := strings.IndexByte(s, '=')
+	if eq < 1 {
+		return fmt.Errorf("expected <category>=<level>, got %q", s)
+	}
+	level, err := blueprint.ParseDiagnosticLevel(s[eq+1:])
+	if err != nil {
+		return err
+	}
+	*f = append(*f, warningLevelFlag{s[:eq], level})
+	return nil
+}
+
+// jsonDiagnostic is a diagnostic in the file written with -diagnostics.
+type jsonDiagnostic struct {
+	Level    string `json:"level"`
+	Category string `json:"category,omitempty"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Module   string `json:"module,omitempty"`
+	Property string `json:"property,omitempty"`
+	Message  string `json:"message"`
+}
+
+// reportDiagnostics logs the warnings reported to ctx, and writes them and
+// errs to the -diagnostics file.  Errors are logged by fatalErrors.
+func reportDiagnostics(ctx *blueprint.Context, errs []error) {
+	diagnostics := ctx.Diagnostics()
+	for _, d := range diagnostics {
+		if d.Level == blueprint.DiagnosticWarning {
+			logger.Warningf("%s", d)
+		}
+	}
+
+	if diagnosticsFile == "" {
+		return
+	}
+
+	data, err := diagnosticsJSON(ctx, errs)
+	if err == nil {
+		err = ioutil.WriteFile(diagnosticsFile, data, 0666)
+	}
+	if err != nil {
+		logger.Errorf("error writing %s: %s", diagnosticsFile, err)
+	}
+}
+
+// diagnosticsJSON returns the diagnostics reported to ctx, followed by the
+// errors in errs that ctx didn't record, in the format of the -diagnostics
+// file.
+func diagnosticsJSON(ctx *blueprint.Context, errs []error) ([]byte, error) {
+	diagnostics := ctx.Diagnostics()
+	out := []jsonDiagnostic{}
+	for _, d := range diagnostics {
+		out = append(out, newJSONDiagnostic(d))
+	}
+	for _, err := range errs {
+		if !isDiagnosed(diagnostics, err) {
+			out = append(out, jsonDiagnostic{Level: "error", Message: err.Error()})
+		}
+	}
+
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func newJSONDiagnostic(d *blueprint.Diagnostic) jsonDiagnostic {
+	return jsonDiagnostic{
+		Level:    d.Level.String(),
+		Category: d.Category,
+		File:     d.Pos.Filename,
+		Line:     d.Pos.Line,
+		Column:   d.Pos.Column,
+		Module:   d.Module,
+		Property: d.Property,
+		Message:  d.Message,
+	}
+}
+
+// isDiagnosed returns true if err is one of diagnostics, or the error of one of
+// them.
+func isDiagnosed(diagnostics []*blueprint.Diagnostic, err error) bool {
+	if !reflect.TypeOf(err).Comparable() {
+		return false
+	}
+	for _, d := range diagnostics {
+		if err == error(d) || err == d.Err {
+			return true
+		}
+	}
+	return false
+}
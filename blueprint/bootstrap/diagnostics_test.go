@@ -0,0 +1,66 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/google/blueprint"
+)
+
+func TestDiagnosticsJSON(t *testing.T) {
+	ctx := blueprint.NewContext()
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			unknown_module {
+			    name: "a",
+			}
+		`),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %q", errs)
+	}
+
+	data, err := diagnosticsJSON(ctx, append(errs, errors.New("other error")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []jsonDiagnostic
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	expected := []jsonDiagnostic{
+		{
+			Level:   "error",
+			File:    "Blueprints",
+			Line:    2,
+			Column:  4,
+			Message: `unrecognized module type "unknown_module"`,
+		},
+		{
+			Level:   "error",
+			Message: "other error",
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected diagnostics:\n%#v\ngot:\n%#v", expected, got)
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/blueprint"
+)
+
+// distContext is the Context of the product being generated, which fatalf
+// and fatalErrors archive into the -dist file.  It is cleared once the file
+// is written so that a failure while writing it doesn't write it again.
+var distContext *blueprint.Context
+
+// distModule is a module in the module graph archived by -dist.
+type distModule struct {
+	Name      string    `json:"name"`
+	Variant   string    `json:"variant,omitempty"`
+	Type      string    `json:"type"`
+	Blueprint string    `json:"blueprint"`
+	Deps      []distDep `json:"deps,omitempty"`
+}
+
+type distDep struct {
+	Name    string `json:"name"`
+	Variant string `json:"variant,omitempty"`
+	Kind    string `json:"kind,omitempty"` // set for ModuleGraphEdges
+}
+
+// startDist prepares writing the -dist file for ctx.  Unless -dist_always is
+// set the file left by a previous failure is removed, so that it always
+// belongs to the last run.
+func startDist(ctx *blueprint.Context) {
+	distContext = nil
+	if distFile == "" {
+		return
+	}
+	if !distAlways {
+		err := os.Remove(distFile)
+		if err != nil && !os.IsNotExist(err) {
+			fatalf("error removing %s: %s", distFile, err)
+		}
+	}
+	distContext = ctx
+}
+
+// finishDist writes the -dist file after a successful run if -dist_always is
+// set.
+func finishDist() {
+	if distContext == nil || !distAlways {
+		return
+	}
+	ctx := distContext
+	distContext = nil
+	if err := writeDist(ctx, distFile, nil); err != nil {
+		fatalf("error writing %s: %s", distFile, err)
+	}
+}
+
+// failDist writes the -dist file with errs as the errors of the run, and only
+// logs the errors of writing it, as the run is failing anyway.
+func failDist(errs []error) {
+	if distContext == nil {
+		return
+	}
+	ctx := distContext
+	distContext = nil
+
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("error writing %s: %s", distFile, r)
+		}
+	}()
+	if err := writeDist(ctx, distFile, errs); err != nil {
+		logger.Errorf("error writing %s: %s", distFile, err)
+		return
+	}
+	logger.Infof("wrote %s", distFile)
+}
+
+// writeDist writes a gzipped tar file with the Ninja file, if one exists, and
+// the module graph, metrics and diagnostics of ctx as JSON.  After a failure
+// the Ninja file is the one written by the last successful run.  With
+// -module_graph_split the module graph is stored in the module_graph directory
+// of the archive with the layout of a split -module_graph.
+func writeDist(ctx *blueprint.Context, filename string, errs []error) (err error) {
+	type entry struct {
+		name string
+		data func() ([]byte, error)
+	}
+	var entries []entry
+	if moduleGraphSplit {
+		modules, index := splitModuleGraph(ctx, "none")
+		for _, e := range index.Dirs {
+			dirModules := modules[e.Dir]
+			entries = append(entries, entry{"module_graph/" + e.File, func() ([]byte, error) {
+				return moduleGraphListJSON(dirModules)
+			}})
+		}
+		entries = append(entries, entry{"module_graph/" + moduleGraphIndexName, func() ([]byte, error) {
+			data, err := json.MarshalIndent(index, "", "  ")
+			return append(data, '\n'), err
+		}})
+	} else {
+		entries = append(entries, entry{"module_graph.json", func() ([]byte, error) { return moduleGraphJSON(ctx) }})
+	}
+	entries = append(entries,
+		entry{"metrics.json", func() ([]byte, error) { return metricsJSON(ctx) }},
+		entry{"diagnostics.json", func() ([]byte, error) { return diagnosticsJSON(ctx, errs) }})
+	if _, err := os.Stat(outFile); err == nil {
+		entries = append([]entry{{filepath.Base(outFile), func() ([]byte, error) {
+			return ioutil.ReadFile(outFile)
+		}}}, entries...)
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	now := time.Now()
+	for _, e := range entries {
+		data, err := e.data()
+		if err != nil {
+			return fmt.Errorf("%s: %s", e.name, err)
+		}
+		err = tw.WriteHeader(&tar.Header{
+			Name:    e.name,
+			Mode:    0666,
+			Size:    int64(len(data)),
+			ModTime: now,
+		})
+		if err == nil {
+			_, err = tw.Write(data)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// moduleGraphJSON returns the variants of the modules of ctx with their types,
+// Blueprints files and direct dependencies.
+func moduleGraphJSON(ctx *blueprint.Context) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	g := &moduleGraphWriter{w: buf}
+	ctx.VisitAllModules(func(module blueprint.Module) {
+		g.add(moduleGraphModule(ctx, module))
+	})
+	if err := g.finish(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// moduleGraphListJSON returns modules formatted like moduleGraphJSON.
+func moduleGraphListJSON(modules []distModule) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	g := &moduleGraphWriter{w: buf}
+	for _, m := range modules {
+		g.add(m)
+	}
+	if err := g.finish(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
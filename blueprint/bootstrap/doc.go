@@ -48,8 +48,14 @@
 //
 //   func main() {
 //       // The primary builder should use the global flag set because the
-//       // bootstrap package registers its own flags there.
-//       flag.Parse()
+//       // bootstrap package registers its own flags there.  Its own flags
+//       // should be registered with bootstrap.RegisterFlag, which lists
+//       // them in -help and checks their values before reusing a Ninja
+//       // file, and parsed with bootstrap.ParseFlags, which also reads
+//       // their environment variables.
+//       skipTests := bootstrap.BoolFlag("skip_tests", false, "SKIP_TESTS",
+//           "don't build the tests")
+//       bootstrap.ParseFlags()
 //
 //       // The top-level Blueprints file is passed as the first argument.
 //       srcDir := filepath.Dir(flag.Arg(0))
@@ -65,12 +71,56 @@
 //       ctx.RegisterSingleton("baz", logic.NewBazSingleton())
 //
 //       // Create and initialize the custom Config object.
-//       config := logic.NewConfig(srcDir)
+//       config := logic.NewConfig(srcDir, *skipTests)
 //
 //       // This call never returns
 //       bootstrap.Main(ctx, config)
 //   }
 //
+// Build logic may be split into separately owned Go packages that the primary
+// builder does not depend on directly, using the 'bootstrap_go_plugin' module
+// type.  A plugin is a Go package with a 'pluginFor' property listing the
+// packages or binaries, usually the primary builder, that it should be linked
+// into.  Bootstrap generates a source file for each of those modules that
+// imports all of its plugins, so the plugins can register their module types
+// and singletons from init functions:
+//
+//   bootstrap_go_plugin {
+//       name: "my-build-logic",
+//       pkgPath: "my/custom/build/logic/plugin",
+//       srcs: ["plugin.go"],
+//       deps: ["my-build-logic-core"],
+//       pluginFor: ["my_primary_builder"],
+//   }
+//
+// Third-party Go packages that are vendored into the source tree are marked
+// with a 'vendor_of' property naming the upstream project, and must list their
+// license files in 'licenses'.  Building a bootstrap Go binary fails if it
+// links a vendored package without license files, and the licenses of all
+// vendored packages it links are aggregated into
+// $buildDir/.bootstrap/notices/<binary>.NOTICE:
+//
+//   bootstrap_go_package {
+//       name: "golang-protobuf",
+//       pkgPath: "github.com/golang/protobuf/proto",
+//       srcs: ["proto/lib.go"],
+//       vendor_of: "https://github.com/golang/protobuf",
+//       licenses: ["LICENSE"],
+//   }
+//
+// A bootstrap_go_binary with 'stamp' set to true is linked with build
+// information from the config, if it implements the ConfigStamp interface.
+// The revision and build time are written to the BuildRevision and BuildTime
+// string variables of the main package, and any additional values to the
+// variables named by StampInfo.Vars:
+//
+//   package main
+//
+//   var (
+//       BuildRevision string
+//       BuildTime     string
+//   )
+//
 // Required Source Files
 //
 // There are three files that must be included in the source tree to facilitate
@@ -134,6 +184,32 @@
 //      - Run the Primary stage
 //      - Run the Main stage
 //
+// Extra arguments for the ninja invocation of each stage, like -j, -k or -d,
+// can be set with the MINIBOOTSTRAP_NINJA_ARGS, BOOTSTRAP_NINJA_ARGS and
+// NINJA_ARGS environment variables, either when running the bootstrap script
+// to save them as defaults, or when running the wrapper script.
+//
+// The wrapper scripts are generated by minibp from templates in
+// bootstrap/wrapper.go that share a single list of stages: blueprint.bash for
+// Unix-like systems, and blueprint.ps1 with a blueprint.cmd shim for Windows.
+// Running "minibp -wrappers <dir>" writes the scripts for the host OS, or for
+// the OS given by -wrapper_os, into <dir>.  regen_build_ninja_in.sh uses it to
+// refresh the copies checked into the Blueprint source tree.
+//
+// If FAILURE_REPORT is set when blueprint.bash runs, and the ninja invocation
+// of a stage fails, blueprint.bash writes a JSON report of the failed build
+// statements to the file it names.  The report lists the outputs, command and
+// the end of the output of each failed build statement, along with the module
+// or singleton that generated it, and can be read with ReadFailureReport.
+//
+// The module names and phony targets that can be passed to blueprint.bash can
+// be completed by the shell.  Running "<primary builder> -completion <shell>"
+// prints the completion script for bash, zsh or fish, to be sourced by the
+// shell.  The script runs "<primary builder> -b <builddir> -complete <prefix>",
+// which only reads the index of the targets that the Main stage writes to
+// .bootstrap/targets in the build directory, without parsing any Blueprints
+// files.
+//
 // Previously, we were keeping track of the "state" of the build directory and
 // only going back to previous stages when something had changed. But that
 // added complexity, and failed when there was a build error in the Primary
@@ -142,6 +218,15 @@
 // So now we always run through each stage, and the first two stages will do
 // nothing when nothing has changed.
 //
+// The Bootstrap and Primary stages record the outputs of their Ninja files in
+// .bootstrap/outputs-<stage>.json.  Each stage checks its outputs against the
+// records of the stages before it, and fails if an output is declared by two
+// stages, or is a file in one stage and a directory in the other, naming the
+// build statement of both stages.  The Main stage, whose Ninja file is much
+// larger, only checks its outputs with -check_stage_outputs.  The Ninja files
+// of the stages, which each stage regenerates, and the AllowedCollisions of
+// the output path policy are exempt.
+//
 // During the Bootstrap stage, <builddir>/.minibootstrap/build.ninja, the
 // following actions are taken, if necessary:
 //
@@ -159,11 +244,46 @@
 //      - Run the primary builder to generate build.ninja
 //      - Run the primary builder to extract documentation
 //
+// Binaries built by the Bootstrap or Primary stage that set "promote: true",
+// for example code generators, are published to the Main stage.  The Primary
+// stage writes their paths and content hashes to
+// <builddir>/.bootstrap/artifacts.json before running the primary builder,
+// which reads the manifest back (see ReadArtifactManifest) and provides the
+// binaries as prebuilt host tools: Main stage modules can depend on them with
+// blueprint.AddHostToolDependencies like on any other host tool module.  The
+// manifest is only rewritten when a hash changes, so build.ninja is only
+// regenerated when a promoted binary actually changed, and it is removed when
+// no binary is promoted anymore.  The primary builder checks the hashes when it
+// reads the manifest.
+//
 // Then the main stage is at <builddir>/build.ninja, and will contain all the
 // rules generated by the primary builder. In addition, the bootstrap code
 // adds a phony rule "blueprint_tools" that depends on all blueprint_go_binary
 // rules (bpfmt, bpmodify, etc).
 //
+// Regenerating the Ninja Files
+//
+// Every Ninja file generated by minibp or the primary builder is regenerated
+// by a build statement that depends on the builder binary, and on a depfile
+// that lists the Blueprints files, the configuration files and the files added
+// with AddNinjaFileDeps, including the file lists of globs.  The categories of
+// tracked inputs are described by the NinjaFileDeps type.  A primary builder
+// that reads other inputs, for example a saved copy of the environment
+// variables it used, must report them by passing them to Main or by
+// implementing ConfigNinjaFileDeps in its config, otherwise the Ninja file
+// will not be regenerated when they change.
+//
+// A primary builder that needs the output of a program to evaluate the module
+// graph, for example a code generator that lists the modules it will generate,
+// can run it with RunGenerator.  The program runs in a sandbox that contains
+// only its declared inputs, its output is cached, and the program and its
+// inputs are added to the depfile.
+//
+// The build statement that regenerates a Ninja file from within that same
+// file is marked with "generator = 1", so Ninja does not rerun the builder
+// only because its command line changed, and "ninja -t clean" does not remove
+// the Ninja file.
+//
 // Updating the Bootstrap Ninja File Template
 //
 // The main purpose of the bootstrap stage is to generate the Ninja file for the
@@ -0,0 +1,107 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/pathtools"
+)
+
+// dryRunLargestOutputs is the number of modules and singletons with the
+// largest Ninja file output that -dry_run lists.
+const dryRunLargestOutputs = 10
+
+// dryRunBuild generates the Ninja files without writing them, and writes a
+// summary of the modules and build actions to w.
+func dryRunBuild(ctx *blueprint.Context, w io.Writer) error {
+	counter := &pathtools.ByteCounter{}
+
+	err := ctx.WriteBuildFile(counter)
+	if err != nil {
+		return fmt.Errorf("error generating Ninja file contents: %s", err)
+	}
+	for _, subninja := range ctx.SubninjaFiles() {
+		err := ctx.WriteSubninjaFile(subninja, counter)
+		if err != nil {
+			return fmt.Errorf("error generating %s contents: %s", subninja, err)
+		}
+	}
+
+	summary, err := ctx.BuildSummary(dryRunLargestOutputs)
+	if err != nil {
+		return err
+	}
+
+	modules, actions := 0, 0
+	for _, n := range summary.ModulesByType {
+		modules += n
+	}
+	for _, n := range summary.ActionsByRule {
+		actions += n
+	}
+
+	fmt.Fprintf(w, "Modules by type:\n")
+	writeCounts(w, summary.ModulesByType)
+	fmt.Fprintf(w, "\nActions by rule:\n")
+	writeCounts(w, summary.ActionsByRule)
+
+	fmt.Fprintf(w, "\nLargest Ninja file output:\n")
+	for _, output := range summary.LargestOutputs {
+		name := output.Name
+		if output.Type == "" {
+			name += " (singleton)"
+		} else {
+			name += " (" + output.Type + ")"
+		}
+		fmt.Fprintf(w, "%10d %s\n", output.Bytes, name)
+	}
+
+	fmt.Fprintf(w, "\n%d modules, %d actions, %d bytes of Ninja files\n",
+		modules, actions, counter.N)
+
+	return nil
+}
+
+// writeCounts writes the names in counts with their counts, most common first.
+func writeCounts(w io.Writer, counts map[string]int) {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Sort(countSorter{names, counts})
+
+	for _, name := range names {
+		fmt.Fprintf(w, "%10d %s\n", counts[name], name)
+	}
+}
+
+type countSorter struct {
+	names  []string
+	counts map[string]int
+}
+
+func (s countSorter) Len() int { return len(s.names) }
+func (s countSorter) Less(i, j int) bool {
+	ci, cj := s.counts[s.names[i]], s.counts[s.names[j]]
+	if ci != cj {
+		return ci > cj
+	}
+	return s.names[i] < s.names[j]
+}
+func (s countSorter) Swap(i, j int) { s.names[i], s.names[j] = s.names[j], s.names[i] }
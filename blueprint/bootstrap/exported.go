@@ -0,0 +1,84 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/pathtools"
+)
+
+// ExportedNinjaFile is the name of the file in the build directory that the
+// Main stage writes the Ninja variables of ConfigExportedNinjaVariables to.
+const ExportedNinjaFile = "exported.ninja"
+
+func exportedNinjaFilePath(buildDir string) string {
+	return filepath.Join(buildDir, ExportedNinjaFile)
+}
+
+// exportNinjaVariables exports the Ninja variables of the config, and checks
+// that the variables in the previous exported Ninja file are still exported.
+func exportNinjaVariables(ctx *blueprint.Context, c ConfigExportedNinjaVariables) error {
+	vars := c.ExportedNinjaVariables()
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		err := ctx.ExportNinjaVariable(name, vars[name])
+		if err != nil {
+			return err
+		}
+	}
+
+	filename := exportedNinjaFilePath(BuildDir)
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	previous, err := blueprint.ReadExportedNinjaVariableNames(f)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.CheckExportedNinjaVariables(previous)
+	if err != nil {
+		return fmt.Errorf("%s, but hand-written Ninja files that use %s may refer to them; "+
+			"delete it if the change is intended", err, filename)
+	}
+	return nil
+}
+
+// writeExportedNinjaFile writes the exported Ninja variables, if the file
+// changed.
+func writeExportedNinjaFile(ctx *blueprint.Context) error {
+	buf := &bytes.Buffer{}
+	err := ctx.WriteExportedNinjaFile(buf)
+	if err != nil {
+		return err
+	}
+	return pathtools.WriteFileIfChanged(exportedNinjaFilePath(BuildDir), buf.Bytes(), 0666)
+}
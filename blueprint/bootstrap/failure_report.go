@@ -0,0 +1,321 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// This file writes the failure reports of the wrapper script.  When
+// FAILURE_REPORT is set, blueprint.bash writes the output of each ninja run to
+// a log in the build directory, and if ninja fails it runs minibp
+// -failure_report to turn the log into a JSON report of the build statements
+// that failed, which is easier for continuous integration systems to consume
+// than the console output, where the output of the failed commands may be
+// interleaved with the status lines.  The wrapper script sets NINJA_STATUS to
+// the default status format while logging, so that the status lines can be
+// told apart from the output of the commands.
+
+// A FailureReport describes a failed ninja run of a stage of the wrapper
+// script.
+type FailureReport struct {
+	// Stage is the name of the stage, bootstrap, primary or main.
+	Stage string `json:"stage"`
+
+	// NinjaFile is the Ninja file of the stage.
+	NinjaFile string `json:"ninjaFile"`
+
+	// Failures are the build statements that failed, in the order ninja
+	// reported them.
+	Failures []BuildFailure `json:"failures"`
+
+	// Errors are the errors reported by ninja itself, like a missing input
+	// file, which may be the only reason of the failure.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// A BuildFailure describes a build statement that failed.
+type BuildFailure struct {
+	// Outputs are the outputs of the build statement, as printed by ninja.
+	Outputs []string `json:"outputs"`
+
+	// Module and Variant are the name and variant of the module that
+	// generated the build statement, or Singleton the name of the singleton,
+	// as found in the Ninja file of the stage.  They are empty if the build
+	// statement is not in the Ninja file, for example because it is in a
+	// subninja.
+	Module    string `json:"module,omitempty"`
+	Variant   string `json:"variant,omitempty"`
+	Singleton string `json:"singleton,omitempty"`
+
+	// Command is the command of the build statement.
+	Command string `json:"command"`
+
+	// Output is the end of the output of the command, and OmittedLines the
+	// number of lines before it that were left out.
+	Output       []string `json:"output"`
+	OmittedLines int      `json:"omittedLines,omitempty"`
+}
+
+// ReadFailureReport reads a report written by the wrapper script to the file
+// named by FAILURE_REPORT.
+func ReadFailureReport(filename string) (*FailureReport, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &FailureReport{}
+	if err := json.Unmarshal(data, report); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %s", filename, err)
+	}
+	return report, nil
+}
+
+// writeFailureReport writes the report of the failed ninja run of stage, whose
+// output is in log, to filename.  Only the last lines lines of the output of
+// each failed command are kept.
+func writeFailureReport(filename, buildDir, stage, log string, lines int) error {
+	report := &FailureReport{Stage: stage}
+	for _, s := range wrapperStages {
+		if s.Name == stage {
+			report.NinjaFile = filepath.Join(buildDir, s.NinjaFile)
+		}
+	}
+	if report.NinjaFile == "" {
+		return fmt.Errorf("unknown stage %q", stage)
+	}
+
+	f, err := os.Open(log)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	report.Failures, report.Errors, err = parseNinjaOutput(f, lines)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %s", log, err)
+	}
+
+	if len(report.Failures) > 0 {
+		ninjaFile, err := os.Open(report.NinjaFile)
+		if err != nil {
+			return err
+		}
+		defer ninjaFile.Close()
+
+		owners, err := ninjaFileOwners(ninjaFile)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %s", report.NinjaFile, err)
+		}
+		for i := range report.Failures {
+			failure := &report.Failures[i]
+			for _, output := range failure.Outputs {
+				if owner, ok := owners[filepath.Clean(output)]; ok {
+					failure.Module, failure.Variant, failure.Singleton =
+						owner.module, owner.variant, owner.singleton
+					break
+				}
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, append(data, '\n'), 0666)
+}
+
+// ninjaStatusRegexp matches the status lines of the default NINJA_STATUS.
+var ninjaStatusRegexp = regexp.MustCompile(`^\[\d+/\d+\] `)
+
+// parseNinjaOutput returns the failed build statements and the errors of ninja
+// itself in the output of a ninja run.  Ninja prints "FAILED: " followed by
+// the outputs of a failed build statement, then its command and the output
+// of the command, which ends at the next status line, failure or message of
+// ninja.
+func parseNinjaOutput(r io.Reader, lines int) ([]BuildFailure, []string, error) {
+	var failures []BuildFailure
+	var errors []string
+	var failure *BuildFailure
+	var output []string
+
+	finish := func() {
+		if failure == nil {
+			return
+		}
+		if len(output) > lines {
+			failure.OmittedLines = len(output) - lines
+			output = output[len(output)-lines:]
+		}
+		failure.Output = append([]string{}, output...)
+		failures = append(failures, *failure)
+		failure, output = nil, nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	readCommand := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "FAILED: "):
+			finish()
+			failure = &BuildFailure{Outputs: strings.Fields(strings.TrimPrefix(line, "FAILED: "))}
+			readCommand = true
+		case ninjaStatusRegexp.MatchString(line):
+			finish()
+		case strings.HasPrefix(line, "ninja: "):
+			finish()
+			if strings.HasPrefix(line, "ninja: error: ") {
+				errors = append(errors, strings.TrimPrefix(line, "ninja: "))
+			}
+		case failure != nil && readCommand:
+			failure.Command = line
+			readCommand = false
+		case failure != nil:
+			output = append(output, line)
+		}
+	}
+	finish()
+
+	return failures, errors, scanner.Err()
+}
+
+// A ninjaOwner is the module variant or singleton that generated a build
+// statement, as found in the header comment before its build statements in
+// the Ninja file.
+type ninjaOwner struct {
+	module, variant, singleton string
+}
+
+// ninjaFileOwners returns the owners of the outputs of the build statements of
+// the Ninja file read from r, keyed by their cleaned paths.  The file level
+// variables that the outputs reference are evaluated, but subninjas and
+// includes are not read.
+func ninjaFileOwners(r io.Reader) (map[string]ninjaOwner, error) {
+	owners := make(map[string]ninjaOwner)
+	variables := make(map[string]string)
+	var owner ninjaOwner
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16*1024*1024)
+	var line string
+	for scanner.Scan() {
+		// Long lines are continued on the next line after a trailing $.
+		text := scanner.Text()
+		if line != "" {
+			text = strings.TrimLeft(text, " ")
+		}
+		if dollars := len(text) - len(strings.TrimRight(text, "$")); dollars%2 == 1 {
+			line += text[:len(text)-1]
+			continue
+		}
+		line += text
+		text, line = line, ""
+
+		switch {
+		case strings.HasPrefix(text, "# Module:"):
+			owner = ninjaOwner{module: strings.TrimSpace(strings.TrimPrefix(text, "# Module:"))}
+		case strings.HasPrefix(text, "# Variant:"):
+			owner.variant = strings.TrimSpace(strings.TrimPrefix(text, "# Variant:"))
+		case strings.HasPrefix(text, "# Singleton:"):
+			owner = ninjaOwner{singleton: strings.TrimSpace(strings.TrimPrefix(text, "# Singleton:"))}
+		case strings.HasPrefix(text, "build "):
+			for _, output := range ninjaBuildOutputs(strings.TrimPrefix(text, "build "), variables) {
+				owners[filepath.Clean(output)] = owner
+			}
+		case text == "", text[0] == ' ', text[0] == '#':
+		default:
+			if i := strings.Index(text, " = "); i > 0 && !strings.ContainsAny(text[:i], " $") {
+				value, _ := evalNinjaString(text[i+3:], variables, false)
+				variables[text[:i]] = value
+			}
+		}
+	}
+
+	return owners, scanner.Err()
+}
+
+// ninjaBuildOutputs returns the outputs of a build statement, without the
+// "build " keyword, with their variables evaluated.
+func ninjaBuildOutputs(s string, variables map[string]string) []string {
+	var outputs []string
+	for {
+		s = strings.TrimLeft(s, " ")
+		if s == "" || s[0] == ':' {
+			return outputs
+		}
+		var path string
+		path, s = evalNinjaString(s, variables, true)
+		if path != "|" {
+			outputs = append(outputs, path)
+		}
+	}
+}
+
+// evalNinjaString evaluates the escapes and variable references of a Ninja
+// string.  If path is true the string ends at the first unescaped space or
+// colon, and the rest of s is returned.
+func evalNinjaString(s string, variables map[string]string, path bool) (string, string) {
+	buf := &bytes.Buffer{}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if path && (c == ' ' || c == ':') {
+			return buf.String(), s[i:]
+		}
+		if c != '$' || i+1 == len(s) {
+			buf.WriteByte(c)
+			continue
+		}
+
+		i++
+		switch c = s[i]; {
+		case c == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return buf.String(), ""
+			}
+			buf.WriteString(variables[s[i+1:i+end]])
+			i += end
+		case isNinjaVariableChar(c):
+			end := i
+			for end < len(s) && isNinjaVariableChar(s[end]) {
+				end++
+			}
+			buf.WriteString(variables[s[i:end]])
+			i = end - 1
+		default:
+			// $$, "$ " and $:
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String(), ""
+}
+
+func isNinjaVariableChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '-'
+}
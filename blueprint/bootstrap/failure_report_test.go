@@ -0,0 +1,235 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const failureReportTestOutput = `[1/10] cc foo.o
+[2/10] cc bar.o
+FAILED: out/bar.o
+cc -c bar.c -o out/bar.o
+bar.c:1: error: one
+bar.c:2: error: two
+bar.c:3: error: three
+[3/10] cc baz.o
+FAILED: out/gen/a.h out/gen/b.h
+gen.sh a.h b.h
+gen.sh: failed
+ninja: build stopped: subcommand failed.
+`
+
+func TestParseNinjaOutput(t *testing.T) {
+	failures, errs, err := parseNinjaOutput(strings.NewReader(failureReportTestOutput), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []BuildFailure{
+		{
+			Outputs:      []string{"out/bar.o"},
+			Command:      "cc -c bar.c -o out/bar.o",
+			Output:       []string{"bar.c:2: error: two", "bar.c:3: error: three"},
+			OmittedLines: 1,
+		},
+		{
+			Outputs: []string{"out/gen/a.h", "out/gen/b.h"},
+			Command: "gen.sh a.h b.h",
+			Output:  []string{"gen.sh: failed"},
+		},
+	}
+	if !reflect.DeepEqual(failures, expected) {
+		t.Errorf("incorrect failures:")
+		t.Errorf("  expected: %+v", expected)
+		t.Errorf("       got: %+v", failures)
+	}
+	if len(errs) != 0 {
+		t.Errorf("unexpected ninja errors %q", errs)
+	}
+}
+
+func TestParseNinjaOutputErrors(t *testing.T) {
+	output := `ninja: error: 'missing.c', needed by 'out/missing.o', missing and no known rule to make it
+`
+	failures, errs, err := parseNinjaOutput(strings.NewReader(output), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 0 {
+		t.Errorf("unexpected failures %+v", failures)
+	}
+	expected := []string{"error: 'missing.c', needed by 'out/missing.o', missing and no known rule to make it"}
+	if !reflect.DeepEqual(errs, expected) {
+		t.Errorf("expected ninja errors %q, got %q", expected, errs)
+	}
+}
+
+const failureReportTestNinjaFile = `ninja_required_version = 1.7.0
+
+g.bootstrap.buildDir = out
+
+g.example.genDir = ${g.bootstrap.buildDir}/gen
+
+build ${g.bootstrap.buildDir}/header.o: cc header.c
+
+# # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # #
+# Module:  libbar
+# Variant: arm
+# Type:    example_library
+
+build ${g.bootstrap.buildDir}/bar.o: cc bar.c
+    cflags = -O2
+
+build ${g.bootstrap.buildDir}/with$ space.o ${g.bootstrap.buildDir}/./with$:colon.o $
+        | ${g.example.genDir}/implicit.d: cc with.c
+
+# # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # #
+# Module:  gen
+# Variant:
+
+build ${g.example.genDir}/a.h ${g.example.genDir}/b.h: gen
+
+# # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # #
+# Singleton: phony
+
+build all: phony ${g.bootstrap.buildDir}/bar.o
+`
+
+func TestNinjaFileOwners(t *testing.T) {
+	owners, err := ninjaFileOwners(strings.NewReader(failureReportTestNinjaFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]ninjaOwner{
+		"out/header.o":       {},
+		"out/bar.o":          {module: "libbar", variant: "arm"},
+		"out/with space.o":   {module: "libbar", variant: "arm"},
+		"out/with:colon.o":   {module: "libbar", variant: "arm"},
+		"out/gen/implicit.d": {module: "libbar", variant: "arm"},
+		"out/gen/a.h":        {module: "gen"},
+		"out/gen/b.h":        {module: "gen"},
+		"all":                {singleton: "phony"},
+	}
+	if !reflect.DeepEqual(owners, expected) {
+		t.Errorf("incorrect owners:")
+		t.Errorf("  expected: %+v", expected)
+		t.Errorf("       got: %+v", owners)
+	}
+}
+
+func TestEvalNinjaString(t *testing.T) {
+	variables := map[string]string{
+		"a":     "A",
+		"b.c":   "BC",
+		"d-e_f": "DEF",
+	}
+
+	testCases := []struct {
+		in        string
+		path      bool
+		out, rest string
+	}{
+		{in: "$a ${b.c} $d-e_f", out: "A BC DEF"},
+		{in: "$a.x", out: "A.x"},
+		{in: "$$a$ $:", out: "$a :"},
+		{in: "${missing}x", out: "x"},
+		{in: "trailing$", out: "trailing$"},
+		{in: "${unterminated", out: ""},
+		{in: "$a/out$ 1: rule", path: true, out: "A/out 1", rest: ": rule"},
+		{in: "out$:1 out2", path: true, out: "out:1", rest: " out2"},
+	}
+	for _, testCase := range testCases {
+		out, rest := evalNinjaString(testCase.in, variables, testCase.path)
+		if out != testCase.out || rest != testCase.rest {
+			t.Errorf("evalNinjaString(%q, %v): expected %q, %q, got %q, %q",
+				testCase.in, testCase.path, testCase.out, testCase.rest, out, rest)
+		}
+	}
+}
+
+func TestWriteFailureReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "failure_report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	buildDir := filepath.Join(dir, "out")
+	if err := os.MkdirAll(buildDir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	ninjaFile := filepath.Join(buildDir, "build.ninja")
+	if err := ioutil.WriteFile(ninjaFile, []byte(failureReportTestNinjaFile), 0666); err != nil {
+		t.Fatal(err)
+	}
+	log := filepath.Join(dir, "ninja.log")
+	if err := ioutil.WriteFile(log, []byte(failureReportTestOutput), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	report := filepath.Join(dir, "report.json")
+	if err := writeFailureReport(report, buildDir, "main", log, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadFailureReport(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &FailureReport{
+		Stage:     "main",
+		NinjaFile: ninjaFile,
+		Failures: []BuildFailure{
+			{
+				Outputs:      []string{"out/bar.o"},
+				Module:       "libbar",
+				Variant:      "arm",
+				Command:      "cc -c bar.c -o out/bar.o",
+				Output:       []string{"bar.c:3: error: three"},
+				OmittedLines: 2,
+			},
+			{
+				Outputs: []string{"out/gen/a.h", "out/gen/b.h"},
+				Module:  "gen",
+				Command: "gen.sh a.h b.h",
+				Output:  []string{"gen.sh: failed"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("incorrect report:")
+		t.Errorf("  expected: %+v", expected)
+		t.Errorf("       got: %+v", got)
+	}
+
+	err = writeFailureReport(report, buildDir, "unknown", log, 1)
+	if err == nil || err.Error() != `unknown stage "unknown"` {
+		t.Errorf("expected an error for an unknown stage, got %v", err)
+	}
+
+	if err := ioutil.WriteFile(report, []byte("{"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadFailureReport(report); err == nil || !strings.HasPrefix(err.Error(), "error parsing ") {
+		t.Errorf("expected a parse error, got %v", err)
+	}
+}
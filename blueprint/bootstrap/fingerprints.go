@@ -0,0 +1,195 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"reflect"
+	"time"
+
+	"github.com/google/blueprint/deptools"
+	"github.com/google/blueprint/pathtools"
+)
+
+// This file lets the primary builder skip regenerating a Ninja file whose
+// inputs didn't change.  Ninja reruns the primary builder when the
+// modification time of any file in the depfile changes, even if the file was
+// only touched, for example by a checkout of a different branch that didn't
+// change it.  When the config implements ConfigFingerprint the primary builder
+// records the fingerprints of its inputs next to the Ninja file, and the next
+// invocation compares them before parsing the Blueprints files.  If none of them
+// changed it rewrites the depfile and only touches the Ninja file.
+
+// A ninjaFileRecord records the inputs of the primary builder invocation that
+// wrote a Ninja file.
+type ninjaFileRecord struct {
+	// Fingerprint is the name of the pathtools.Fingerprint of the files.
+	Fingerprint string
+
+	// Args are the arguments of the primary builder.
+	Args []string
+
+	// Flags are the values of the flags registered with RegisterFlag,
+	// which may come from the environment instead of Args.
+	Flags map[string]string `json:",omitempty"`
+
+	// Mutators are the names of the mutators that were enabled for the
+	// config, which change when a feature gated with
+	// blueprint.MutatorHandle.EnabledIf is toggled.
+	Mutators []string `json:",omitempty"`
+
+	// Inputs are the primary builder binary and the top-level Blueprints
+	// file, which are not listed in the depfile.
+	Inputs []recordedFile
+
+	// Outputs are the Ninja file and its subninjas.
+	Outputs []string
+
+	// Deps are the files listed in the depfile of the Ninja file.
+	Deps []recordedFile
+}
+
+type recordedFile struct {
+	Path        string
+	Fingerprint string
+}
+
+func ninjaFileRecordPath(ninjaFile string) string {
+	return ninjaFile + ".fingerprints"
+}
+
+// reuseNinjaFile returns true if ninjaFile was written by a primary builder
+// invocation with the same arguments and none of its inputs changed according
+// to fingerprint, after rewriting its depfile and touching it so that Ninja
+// considers it up to date.
+func reuseNinjaFile(fingerprint pathtools.Fingerprint, ninjaFile, depFile,
+	blueprintsFile string, mutators []string) (bool, error) {
+
+	data, err := ioutil.ReadFile(ninjaFileRecordPath(ninjaFile))
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	var record ninjaFileRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		// A corrupt record is ignored, and rewritten after regenerating.
+		return false, nil
+	}
+
+	if record.Fingerprint != fingerprint.String() || !reflect.DeepEqual(record.Args, os.Args[1:]) ||
+		!reflect.DeepEqual(record.Flags, registeredFlagValues()) ||
+		!reflect.DeepEqual(record.Mutators, mutators) {
+		return false, nil
+	}
+
+	for _, output := range record.Outputs {
+		if _, err := os.Stat(output); err != nil {
+			return false, nil
+		}
+	}
+
+	inputs, err := primaryBuilderInputs(blueprintsFile)
+	if err != nil {
+		return false, err
+	}
+	if len(inputs) != len(record.Inputs) {
+		return false, nil
+	}
+	for i, input := range inputs {
+		if input != record.Inputs[i].Path {
+			return false, nil
+		}
+	}
+
+	deps := make([]string, len(record.Deps))
+	for i, dep := range record.Deps {
+		deps[i] = dep.Path
+	}
+
+	for _, f := range append(record.Inputs, record.Deps...) {
+		changed, err := fingerprint.Changed(f.Path, f.Fingerprint)
+		if changed || err != nil {
+			return false, err
+		}
+	}
+
+	if depFile != "" {
+		err := deptools.WriteDepFile(depFile, ninjaFile, deps)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	now := time.Now()
+	return true, os.Chtimes(ninjaFile, now, now)
+}
+
+// writeNinjaFileRecord records the fingerprints of the inputs of the Ninja file
+// and its subninjas for reuseNinjaFile.
+func writeNinjaFileRecord(fingerprint pathtools.Fingerprint, ninjaFile, blueprintsFile string,
+	subninjas []string, ninjaFileDeps NinjaFileDeps, mutators []string) error {
+
+	record := ninjaFileRecord{
+		Fingerprint: fingerprint.String(),
+		Args:        os.Args[1:],
+		Flags:       registeredFlagValues(),
+		Mutators:    mutators,
+		Outputs:     append([]string{ninjaFile}, subninjas...),
+	}
+
+	inputs, err := primaryBuilderInputs(blueprintsFile)
+	if err != nil {
+		return err
+	}
+
+	fingerprints := func(files []string) ([]recordedFile, error) {
+		ret := make([]recordedFile, len(files))
+		for i, file := range files {
+			f, err := fingerprint.Fingerprint(file)
+			if err != nil {
+				return nil, err
+			}
+			ret[i] = recordedFile{file, f}
+		}
+		return ret, nil
+	}
+
+	record.Inputs, err = fingerprints(inputs)
+	if err == nil {
+		record.Deps, err = fingerprints(ninjaFileDeps.Files())
+	}
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(ninjaFileRecordPath(ninjaFile), append(data, '\n'), 0666)
+}
+
+func primaryBuilderInputs(blueprintsFile string) ([]string, error) {
+	builder, err := exec.LookPath(os.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	return []string{builder, blueprintsFile}, nil
+}
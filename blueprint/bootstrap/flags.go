@@ -0,0 +1,178 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// A Flag is a command line flag of a primary builder, registered with
+// RegisterFlag instead of parsing os.Args in the primary builder, so that it
+// is documented by -help next to the flags of the bootstrap package and its
+// value is part of the inputs checked before reusing a Ninja file.
+type Flag struct {
+	// Name is the name of the flag, without the leading "-".
+	Name string
+
+	// Usage documents the flag in -help.
+	Usage string
+
+	// Env is the name of an environment variable that sets the flag if it
+	// is not on the command line, or empty.  The variable is only read
+	// when the primary builder runs; a build that needs to rerun it when
+	// the variable changes must track the variable itself, for example
+	// with ConfigNinjaFileDeps.
+	Env string
+
+	// Value holds the value of the flag, like the flag.Value of flag.Var.
+	Value flag.Value
+}
+
+var registeredFlags []Flag
+
+// flagEnvironmentApplied is set once the registered flags were set from their
+// environment variables by ParseFlags or Main.
+var flagEnvironmentApplied bool
+
+func init() {
+	flag.Usage = usage
+}
+
+// RegisterFlag registers a flag of the primary builder with the flag package.
+// It must be called before Main, and before ParseFlags if the primary
+// builder parses the flags itself, for example from an init function.
+func RegisterFlag(f Flag) {
+	for _, r := range registeredFlags {
+		if r.Name == f.Name {
+			panic(fmt.Errorf("flag -%s is already registered", f.Name))
+		}
+	}
+	text := f.Usage
+	if f.Env != "" {
+		text += fmt.Sprintf(" (default from $%s)", f.Env)
+	}
+	flag.Var(f.Value, f.Name, text)
+	registeredFlags = append(registeredFlags, f)
+}
+
+// BoolFlag registers a boolean flag of the primary builder with RegisterFlag,
+// and returns the variable that holds its value.
+func BoolFlag(name string, value bool, env, usage string) *bool {
+	fs := flag.NewFlagSet(name, flag.PanicOnError)
+	p := fs.Bool(name, value, usage)
+	RegisterFlag(Flag{Name: name, Usage: usage, Env: env, Value: fs.Lookup(name).Value})
+	return p
+}
+
+// StringFlag registers a string flag of the primary builder with
+// RegisterFlag, and returns the variable that holds its value.
+func StringFlag(name string, value string, env, usage string) *string {
+	fs := flag.NewFlagSet(name, flag.PanicOnError)
+	p := fs.String(name, value, usage)
+	RegisterFlag(Flag{Name: name, Usage: usage, Env: env, Value: fs.Lookup(name).Value})
+	return p
+}
+
+// ParseFlags parses the command line flags with flag.Parse, and sets the flags
+// registered with RegisterFlag that are not on the command line from their
+// environment variables.  A primary builder that reads the values of its flags
+// before calling Main must parse them with ParseFlags instead of flag.Parse,
+// otherwise the environment variables are only applied by Main.
+func ParseFlags() {
+	flag.Parse()
+	if err := applyFlagEnvironment(flag.CommandLine, registeredFlags); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	flagEnvironmentApplied = true
+}
+
+// applyFlagEnvironment sets the flags that were not on the command line parsed
+// by fs from their environment variables.
+func applyFlagEnvironment(fs *flag.FlagSet, flags []Flag) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	for _, f := range flags {
+		if f.Env == "" || set[f.Name] {
+			continue
+		}
+		if value, ok := os.LookupEnv(f.Env); ok {
+			if err := f.Value.Set(value); err != nil {
+				return fmt.Errorf("invalid value %q of $%s for -%s: %s", value, f.Env, f.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// registeredFlagValues returns the values of the registered flags by name.
+func registeredFlagValues() map[string]string {
+	if len(registeredFlags) == 0 {
+		return nil
+	}
+	ret := make(map[string]string, len(registeredFlags))
+	for _, f := range registeredFlags {
+		ret[f.Name] = f.Value.String()
+	}
+	return ret
+}
+
+// usage is the flag.Usage of the primary builder.
+func usage() {
+	printUsage(os.Stderr, os.Args[0], flag.CommandLine, registeredFlags)
+}
+
+// printUsage prints the flags of fs to out, listing the flags of the primary
+// builder in flags after the other flags.
+func printUsage(out io.Writer, name string, fs *flag.FlagSet, flags []Flag) {
+	fmt.Fprintf(out, "Usage of %s:\n", name)
+
+	registered := make(map[string]bool, len(flags))
+	for _, f := range flags {
+		registered[f.Name] = true
+	}
+
+	var builtin, custom []*flag.Flag
+	fs.VisitAll(func(f *flag.Flag) {
+		if registered[f.Name] {
+			custom = append(custom, f)
+		} else {
+			builtin = append(builtin, f)
+		}
+	})
+
+	printFlags(out, builtin)
+	if len(custom) > 0 {
+		fmt.Fprintf(out, "\nFlags of the primary builder:\n")
+		printFlags(out, custom)
+	}
+}
+
+// printFlags prints flags in the format of flag.PrintDefaults.
+func printFlags(out io.Writer, flags []*flag.Flag) {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	fs.SetOutput(out)
+	for _, f := range flags {
+		fs.Var(f.Value, f.Name, f.Usage)
+		fs.Lookup(f.Name).DefValue = f.DefValue
+	}
+	fs.PrintDefaults()
+}
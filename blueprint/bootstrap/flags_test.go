@@ -0,0 +1,191 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/blueprint/pathtools"
+)
+
+func setenv(t *testing.T, key, value string) func() {
+	old, ok := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func TestApplyFlagEnvironment(t *testing.T) {
+	defer setenv(t, "TEST_FLAG_A", "env_a")()
+	defer setenv(t, "TEST_FLAG_B", "env_b")()
+	defer setenv(t, "TEST_FLAG_C", "true")()
+
+	testCases := []struct {
+		args []string
+		a, b string
+		c    bool
+	}{
+		{
+			args: nil,
+			a:    "env_a",
+			b:    "env_b",
+			c:    true,
+		},
+		{
+			args: []string{"-a", "arg_a", "-c=false"},
+			a:    "arg_a",
+			b:    "env_b",
+			c:    false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		a := fs.String("a", "default_a", "")
+		b := fs.String("b", "default_b", "")
+		c := fs.Bool("c", false, "")
+		d := fs.String("d", "default_d", "")
+		flags := []Flag{
+			{Name: "a", Env: "TEST_FLAG_A", Value: fs.Lookup("a").Value},
+			{Name: "b", Env: "TEST_FLAG_B", Value: fs.Lookup("b").Value},
+			{Name: "c", Env: "TEST_FLAG_C", Value: fs.Lookup("c").Value},
+			{Name: "d", Value: fs.Lookup("d").Value},
+		}
+
+		if err := fs.Parse(testCase.args); err != nil {
+			t.Fatal(err)
+		}
+		if err := applyFlagEnvironment(fs, flags); err != nil {
+			t.Fatalf("args %q: unexpected error: %s", testCase.args, err)
+		}
+
+		if *a != testCase.a || *b != testCase.b || *c != testCase.c || *d != "default_d" {
+			t.Errorf("args %q: expected -a=%q -b=%q -c=%v -d=%q, got -a=%q -b=%q -c=%v -d=%q",
+				testCase.args, testCase.a, testCase.b, testCase.c, "default_d", *a, *b, *c, *d)
+		}
+	}
+}
+
+func TestApplyFlagEnvironmentInvalid(t *testing.T) {
+	defer setenv(t, "TEST_FLAG_C", "maybe")()
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Bool("c", false, "")
+	flags := []Flag{{Name: "c", Env: "TEST_FLAG_C", Value: fs.Lookup("c").Value}}
+
+	if err := fs.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	err := applyFlagEnvironment(fs, flags)
+	if err == nil {
+		t.Fatal("expected an error for an invalid value")
+	}
+	if expected := `invalid value "maybe" of $TEST_FLAG_C for -c`; !strings.HasPrefix(err.Error(), expected) {
+		t.Errorf("expected error starting with %q, got %q", expected, err.Error())
+	}
+}
+
+func TestPrintUsage(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Bool("builtin", false, "a builtin flag")
+	fs.Bool("skip_tests", false, "don't build the tests (default from $SKIP_TESTS)")
+	flags := []Flag{{Name: "skip_tests", Env: "SKIP_TESTS", Value: fs.Lookup("skip_tests").Value}}
+
+	buf := &bytes.Buffer{}
+	printUsage(buf, "builder", fs, flags)
+	out := buf.String()
+
+	if !strings.HasPrefix(out, "Usage of builder:\n") {
+		t.Errorf("expected usage to start with the name of the builder, got:\n%s", out)
+	}
+	primary := strings.Index(out, "\nFlags of the primary builder:\n")
+	if primary < 0 {
+		t.Fatalf("expected flags of the primary builder in usage, got:\n%s", out)
+	}
+	if i := strings.Index(out, "-builtin"); i < 0 || i > primary {
+		t.Errorf("expected -builtin before the flags of the primary builder, got:\n%s", out)
+	}
+	if i := strings.Index(out, "-skip_tests"); i < primary {
+		t.Errorf("expected -skip_tests after the other flags, got:\n%s", out)
+	}
+	if !strings.Contains(out, "(default from $SKIP_TESTS)") {
+		t.Errorf("expected the environment variable of -skip_tests in usage, got:\n%s", out)
+	}
+
+	buf.Reset()
+	printUsage(buf, "builder", fs, nil)
+	if strings.Contains(buf.String(), "Flags of the primary builder") {
+		t.Errorf("expected no flags of the primary builder in usage, got:\n%s", buf.String())
+	}
+}
+
+func TestReuseNinjaFileFlags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flags_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ninjaFile := filepath.Join(dir, "build.ninja")
+	blueprintsFile := filepath.Join(dir, "Blueprints")
+	for _, file := range []string{ninjaFile, blueprintsFile} {
+		if err := ioutil.WriteFile(file, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	skipTests := fs.Bool("skip_tests", false, "")
+
+	oldFlags := registeredFlags
+	registeredFlags = []Flag{{Name: "skip_tests", Env: "SKIP_TESTS", Value: fs.Lookup("skip_tests").Value}}
+	defer func() { registeredFlags = oldFlags }()
+
+	fingerprint := pathtools.ContentFingerprint
+	err = writeNinjaFileRecord(fingerprint, ninjaFile, blueprintsFile, nil, NinjaFileDeps{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reuse, err := reuseNinjaFile(fingerprint, ninjaFile, "", blueprintsFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reuse {
+		t.Errorf("expected the Ninja file to be reused with the same flags")
+	}
+
+	*skipTests = true
+	reuse, err = reuseNinjaFile(fingerprint, ninjaFile, "", blueprintsFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reuse {
+		t.Errorf("expected the Ninja file to be regenerated after changing -skip_tests")
+	}
+}
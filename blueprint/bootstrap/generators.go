@@ -0,0 +1,320 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/pathtools"
+)
+
+// This file supports running small generator binaries while the primary
+// builder evaluates the module graph, for example to read a code generation
+// manifest that determines which modules exist or what they depend on.  The
+// generator has to be built before the primary builder runs, for example as a
+// bootstrap_go_binary of an earlier stage, since analysis can't wait for Ninja
+// to build it.
+//
+// Generators run in a sandbox: an empty directory under the build directory
+// into which only the declared inputs are copied, with only the declared
+// environment variables set.  A generator that reads any other file by a
+// relative path fails instead of silently depending on something that isn't
+// tracked.  The sandbox is not a security boundary, absolute paths still work.
+// With -dry_run the sandbox is created in the system temporary directory
+// instead, so that nothing is written to the build directory.  The output
+// is cached by the hashes of the tool, its arguments, its environment and its
+// inputs, so an unchanged generator is not run again when the primary builder
+// is rerun for an unrelated change.  The tool and the inputs are added to the
+// dependencies of the Ninja file, so changing either of them reruns the
+// primary builder and with it the generator.
+
+// A Generator describes a run of a generator binary by RunGenerator.
+type Generator struct {
+	// Tool is the path of the generator binary.
+	Tool string
+
+	// Args are the arguments passed to Tool.  Inputs are found at their
+	// paths relative to SrcDir, which is the working directory of Tool.
+	Args []string
+
+	// Inputs are the files read by Tool, relative to SrcDir.  They are the
+	// only files of the source tree copied into the sandbox.
+	Inputs []string
+
+	// Env are the environment variables of Tool, as NAME=value.  TMPDIR is
+	// set to an empty directory in the sandbox.
+	Env []string
+}
+
+// GeneratorError is returned by RunGenerator when the generator fails.
+type GeneratorError struct {
+	Tool   string
+	Err    error
+	Stderr string
+}
+
+func (e *GeneratorError) Error() string {
+	if e.Stderr == "" {
+		return fmt.Sprintf("generator %s failed: %s", e.Tool, e.Err)
+	}
+	return fmt.Sprintf("generator %s failed: %s\n%s", e.Tool, e.Err, e.Stderr)
+}
+
+var (
+	generatorDepsLock sync.Mutex
+	// generatorDeps are the tools and inputs of the generators run for the
+	// current product, added to the Ninja file dependencies by the
+	// generators singleton.
+	generatorDeps = make(map[string]bool)
+)
+
+// generatorsDir returns the directory of the cache and the sandboxes of
+// RunGenerator.
+func generatorsDir() string {
+	return filepath.Join(BuildDir, ".generators")
+}
+
+// RunGenerator runs a generator and returns what it wrote to stdout, or the
+// output of a previous run with the same tool, arguments, environment and
+// input contents.  It can be called from module factories, mutators and
+// preprocessors, including concurrently, once Main has set SrcDir and
+// BuildDir.  The tool and the inputs are added to the dependencies of the
+// Ninja file even if the generator fails, so fixing them reruns the primary
+// builder.  The cache is never pruned; removing the .generators directory of
+// the build directory clears it.  With -dry_run the cache is neither read nor
+// written.
+func RunGenerator(g Generator) ([]byte, error) {
+	for _, input := range g.Inputs {
+		if !isSrcDirRelative(input) {
+			return nil, &GeneratorError{Tool: g.Tool,
+				Err: fmt.Errorf("input %s is not relative to the source directory", input)}
+		}
+	}
+
+	generatorDepsLock.Lock()
+	generatorDeps[g.Tool] = true
+	for _, input := range g.Inputs {
+		generatorDeps[filepath.Join(SrcDir, input)] = true
+	}
+	generatorDepsLock.Unlock()
+
+	key, err := generatorKey(g)
+	if err != nil {
+		return nil, &GeneratorError{Tool: g.Tool, Err: err}
+	}
+
+	if dryRun {
+		logger.Scope("generator").Debugf("running %s %s", g.Tool, strings.Join(g.Args, " "))
+		return runSandboxed(g)
+	}
+
+	cacheFile := filepath.Join(generatorsDir(), "cache", key)
+	if output, err := ioutil.ReadFile(cacheFile); err == nil {
+		logger.Scope("generator").Debugf("reusing the output of %s %s", g.Tool, strings.Join(g.Args, " "))
+		return output, nil
+	}
+
+	logger.Scope("generator").Debugf("running %s %s", g.Tool, strings.Join(g.Args, " "))
+	output, err := runSandboxed(g)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeFileAtomic(cacheFile, output); err != nil {
+		logger.Scope("generator").Warningf("error caching the output of %s: %s", g.Tool, err)
+	}
+	return output, nil
+}
+
+// generatorKey returns the key of the cached output of the generator, the
+// hash of everything that can change its output.
+func generatorKey(g Generator) (string, error) {
+	h := sha256.New()
+	write := func(strs ...string) {
+		for _, s := range strs {
+			fmt.Fprintf(h, "%d:%s", len(s), s)
+		}
+		h.Write([]byte{0})
+	}
+
+	tool, err := pathtools.FileSHA256(g.Tool)
+	if err != nil {
+		return "", err
+	}
+	if tool == "" {
+		return "", fmt.Errorf("tool doesn't exist")
+	}
+	write(tool)
+	write(g.Args...)
+	write(g.Env...)
+
+	for _, input := range g.Inputs {
+		hash, err := pathtools.FileSHA256(filepath.Join(SrcDir, input))
+		if err != nil {
+			return "", err
+		}
+		if hash == "" {
+			return "", fmt.Errorf("input %s doesn't exist", input)
+		}
+		write(input, hash)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// isSrcDirRelative returns true if path is a relative path that stays inside the
+// source directory.
+func isSrcDirRelative(path string) bool {
+	path = filepath.Clean(path)
+	return !filepath.IsAbs(path) && path != ".." &&
+		!strings.HasPrefix(path, ".."+string(filepath.Separator))
+}
+
+// runSandboxed runs the generator in a new directory containing copies of its
+// inputs, which RunGenerator checked are in the source directory, and removes
+// the directory afterwards.
+func runSandboxed(g Generator) ([]byte, error) {
+	tool, err := filepath.Abs(g.Tool)
+	if err != nil {
+		return nil, &GeneratorError{Tool: g.Tool, Err: err}
+	}
+
+	// With -dry_run nothing is written to the build directory, an empty dir
+	// makes TempDir use the system temporary directory.
+	dir := ""
+	if !dryRun {
+		dir = generatorsDir()
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			return nil, &GeneratorError{Tool: g.Tool, Err: err}
+		}
+	}
+	sandbox, err := ioutil.TempDir(dir, "blueprint-generator-sandbox")
+	if err != nil {
+		return nil, &GeneratorError{Tool: g.Tool, Err: err}
+	}
+	defer os.RemoveAll(sandbox)
+
+	for _, input := range g.Inputs {
+		err := copyFile(filepath.Join(SrcDir, input), filepath.Join(sandbox, "src", input))
+		if err != nil {
+			return nil, &GeneratorError{Tool: g.Tool, Err: err}
+		}
+	}
+
+	tmpDir := filepath.Join(sandbox, "tmp")
+	if err := os.MkdirAll(tmpDir, 0777); err != nil {
+		return nil, &GeneratorError{Tool: g.Tool, Err: err}
+	}
+	workDir := filepath.Join(sandbox, "src")
+	if err := os.MkdirAll(workDir, 0777); err != nil {
+		return nil, &GeneratorError{Tool: g.Tool, Err: err}
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(tool, g.Args...)
+	cmd.Dir = workDir
+	cmd.Env = append(append([]string(nil), g.Env...), "TMPDIR="+tmpDir)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, &GeneratorError{Tool: g.Tool, Err: err, Stderr: stderr.String()}
+	}
+
+	return stdout.Bytes(), nil
+}
+
+func copyFile(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0777); err != nil {
+		return err
+	}
+
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// writeFileAtomic writes a file through a temporary file, so that concurrent
+// readers never see a partially written file.
+func writeFileAtomic(filename string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(filename), ".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// generatorsSingleton adds the tools and inputs of the generators run by
+// RunGenerator to the dependencies of the Ninja file.
+type generatorsSingleton struct{}
+
+func generatorsSingletonFactory() blueprint.Singleton {
+	return &generatorsSingleton{}
+}
+
+func (s *generatorsSingleton) GenerateBuildActions(ctx blueprint.SingletonContext) {
+	generatorDepsLock.Lock()
+	deps := make([]string, 0, len(generatorDeps))
+	for dep := range generatorDeps {
+		deps = append(deps, dep)
+	}
+	generatorDepsLock.Unlock()
+
+	sort.Strings(deps)
+	ctx.AddNinjaFileDeps(deps...)
+}
+
+// resetGenerators forgets the generators run for the previous product.
+func resetGenerators() {
+	generatorDepsLock.Lock()
+	generatorDeps = make(map[string]bool)
+	generatorDepsLock.Unlock()
+}
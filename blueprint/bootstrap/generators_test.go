@@ -0,0 +1,190 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/blueprint/logging"
+)
+
+// setupGeneratorTest points SrcDir and BuildDir at a new temporary directory
+// containing a generator that prints its input and counts its runs in an
+// absolute path outside the sandbox.  It returns the directory, the generator
+// and a function that restores the globals and removes the directory.
+func setupGeneratorTest(t *testing.T) (string, Generator, func()) {
+	dir, err := ioutil.TempDir("", "generators_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldSrcDir, oldBuildDir, oldLogger, oldDryRun := SrcDir, BuildDir, logger, dryRun
+	SrcDir = filepath.Join(dir, "src")
+	BuildDir = filepath.Join(dir, "out")
+	logger = logging.New()
+	dryRun = false
+	resetGenerators()
+
+	tool := filepath.Join(dir, "gen.sh")
+	script := "#!/bin/sh\n" +
+		"echo run >> " + filepath.Join(dir, "runs") + "\n" +
+		"cat input.txt\n"
+	if err := ioutil.WriteFile(tool, []byte(script), 0777); err != nil {
+		t.Fatal(err)
+	}
+	writeGeneratorInput(t, "a")
+
+	return dir, Generator{Tool: tool, Inputs: []string{"input.txt"}}, func() {
+		SrcDir, BuildDir, logger, dryRun = oldSrcDir, oldBuildDir, oldLogger, oldDryRun
+		resetGenerators()
+		os.RemoveAll(dir)
+	}
+}
+
+func writeGeneratorInput(t *testing.T, contents string) {
+	if err := os.MkdirAll(SrcDir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(SrcDir, "input.txt"), []byte(contents), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func generatorRuns(t *testing.T, dir string) int {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "runs"))
+	if os.IsNotExist(err) {
+		return 0
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Count(string(data), "run\n")
+}
+
+func runGenerator(t *testing.T, g Generator, expected string) {
+	output, err := RunGenerator(g)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(output) != expected {
+		t.Errorf("incorrect output:\nexpected: %q\n     got: %q", expected, string(output))
+	}
+}
+
+func TestRunGeneratorCache(t *testing.T) {
+	dir, g, cleanup := setupGeneratorTest(t)
+	defer cleanup()
+
+	runGenerator(t, g, "a")
+	runGenerator(t, g, "a")
+	if runs := generatorRuns(t, dir); runs != 1 {
+		t.Errorf("expected the second run to be cached, generator ran %d times", runs)
+	}
+
+	writeGeneratorInput(t, "b")
+	runGenerator(t, g, "b")
+	if runs := generatorRuns(t, dir); runs != 2 {
+		t.Errorf("expected a changed input to rerun the generator, generator ran %d times", runs)
+	}
+
+	g.Args = []string{"arg"}
+	runGenerator(t, g, "b")
+	if runs := generatorRuns(t, dir); runs != 3 {
+		t.Errorf("expected changed arguments to rerun the generator, generator ran %d times", runs)
+	}
+
+	generatorDepsLock.Lock()
+	for _, dep := range []string{g.Tool, filepath.Join(SrcDir, "input.txt")} {
+		if !generatorDeps[dep] {
+			t.Errorf("missing ninja file dependency %q", dep)
+		}
+	}
+	generatorDepsLock.Unlock()
+}
+
+func TestRunGeneratorFailure(t *testing.T) {
+	_, g, cleanup := setupGeneratorTest(t)
+	defer cleanup()
+
+	script := "#!/bin/sh\necho broken >&2\nexit 1\n"
+	if err := ioutil.WriteFile(g.Tool, []byte(script), 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := RunGenerator(g)
+		genErr, ok := err.(*GeneratorError)
+		if !ok {
+			t.Fatalf("expected a *GeneratorError, got %#v", err)
+		}
+		if genErr.Stderr != "broken\n" {
+			t.Errorf("expected the stderr of the generator, got %q", genErr.Stderr)
+		}
+	}
+
+	// A failure is not cached.
+	cache, _ := ioutil.ReadDir(filepath.Join(generatorsDir(), "cache"))
+	if len(cache) != 0 {
+		t.Errorf("expected no cached outputs, got %d", len(cache))
+	}
+
+	g.Inputs = []string{"missing.txt"}
+	if _, err := RunGenerator(g); err == nil || !strings.Contains(err.Error(), "missing.txt doesn't exist") {
+		t.Errorf("expected an error for the missing input, got %v", err)
+	}
+}
+
+func TestRunGeneratorInputs(t *testing.T) {
+	_, g, cleanup := setupGeneratorTest(t)
+	defer cleanup()
+
+	// The inputs are checked before they are hashed, so the error is the
+	// same whether they exist or not.
+	for _, input := range []string{"..", "../input.txt", "dir/../../input.txt", "/input.txt"} {
+		g.Inputs = []string{input}
+		_, err := RunGenerator(g)
+		if err == nil || !strings.Contains(err.Error(), "is not relative to the source directory") {
+			t.Errorf("%q: expected an error for an input outside the source directory, got %v", input, err)
+		}
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(SrcDir, "..input.txt"), []byte("dots"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	g.Inputs = []string{"..input.txt"}
+	g.Args = []string{"..input.txt"}
+	if err := ioutil.WriteFile(g.Tool, []byte("#!/bin/sh\ncat \"$1\"\n"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	runGenerator(t, g, "dots")
+}
+
+func TestRunGeneratorDryRun(t *testing.T) {
+	dir, g, cleanup := setupGeneratorTest(t)
+	defer cleanup()
+
+	dryRun = true
+	runGenerator(t, g, "a")
+	runGenerator(t, g, "a")
+	if runs := generatorRuns(t, dir); runs != 2 {
+		t.Errorf("expected -dry_run not to use the cache, generator ran %d times", runs)
+	}
+	if _, err := os.Stat(BuildDir); !os.IsNotExist(err) {
+		t.Errorf("expected -dry_run not to create the build directory, got %v", err)
+	}
+}
@@ -42,11 +42,17 @@ import (
 var (
 	globCmd = filepath.Join("$BinDir", "bpglob")
 
+	// symlinkPolicyVar passes the -symlinks policy of the primary builder to
+	// bpglob, so that both write the same paths.
+	symlinkPolicyVar = pctx.VariableFunc("symlinkPolicy", func(interface{}) (string, error) {
+		return symlinkPolicy.String(), nil
+	})
+
 	// globRule rule traverses directories to produce a list of files that match $glob
 	// and writes it to $out if it has changed, and writes the directories to $out.d
 	GlobRule = pctx.StaticRule("GlobRule",
 		blueprint.RuleParams{
-			Command:     fmt.Sprintf(`%s -o $out $excludes "$glob"`, globCmd),
+			Command:     fmt.Sprintf(`%s -o $out -symlinks $symlinkPolicy $excludes "$glob"`, globCmd),
 			CommandDeps: []string{globCmd},
 			Description: "glob $glob",
 
@@ -132,9 +138,12 @@ func (s *globSingleton) GenerateBuildActions(ctx blueprint.SingletonContext) {
 		fileListFile := filepath.Join(BuildDir, ".glob", g.Name)
 		depFile := fileListFile + ".d"
 
-		fileList := strings.Join(g.Files, "\n") + "\n"
-		pathtools.WriteFileIfChanged(fileListFile, []byte(fileList), 0666)
-		deptools.WriteDepFile(depFile, fileListFile, g.Deps)
+		// With -dry_run nothing is written to the build directory.
+		if !dryRun {
+			fileList := strings.Join(g.Files, "\n") + "\n"
+			pathtools.WriteFileIfChanged(fileListFile, []byte(fileList), 0666)
+			deptools.WriteDepFile(depFile, fileListFile, g.Deps)
+		}
 
 		GlobFile(ctx, g.Pattern, g.Excludes, fileListFile, depFile)
 
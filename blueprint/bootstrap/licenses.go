@@ -0,0 +1,103 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/pathtools"
+	"github.com/google/blueprint/proptools"
+)
+
+var (
+	notice = pctx.StaticRule("notice",
+		blueprint.RuleParams{
+			Command:     "($cmds) > $out",
+			Description: "notice $out",
+		},
+		"cmds")
+
+	noticesDir = filepath.Join(bootstrapDir, "notices")
+)
+
+type licensesSingleton struct {
+	config *Config
+}
+
+func newLicensesSingletonFactory(config *Config) func() blueprint.Singleton {
+	return func() blueprint.Singleton {
+		return &licensesSingleton{
+			config: config,
+		}
+	}
+}
+
+// GenerateBuildActions verifies that every vendored package linked into a
+// bootstrap Go binary declares its license files, and aggregates them into
+// .bootstrap/notices/<binary>.NOTICE in the stage that builds the binary.
+func (s *licensesSingleton) GenerateBuildActions(ctx blueprint.SingletonContext) {
+	reported := make(map[*goPackage]bool)
+
+	ctx.VisitAllModulesIf(isBootstrapBinaryModule,
+		func(module blueprint.Module) {
+			binaryModule := module.(*goBinary)
+			if binaryModule.BuildStage() != s.config.stage {
+				return
+			}
+
+			var cmds, licenseFiles []string
+			ctx.VisitDepsDepthFirst(binaryModule, func(module blueprint.Module) {
+				pkg, ok := module.(*goPackage)
+				if !ok || pkg.properties.Vendor_of == "" {
+					return
+				}
+
+				if len(pkg.properties.Licenses) == 0 {
+					if !reported[pkg] {
+						ctx.ModuleErrorf(pkg, "vendored package %q linked into %q must list its license files in licenses",
+							pkg.properties.PkgPath, ctx.ModuleName(binaryModule))
+						reported[pkg] = true
+					}
+					return
+				}
+
+				files := pathtools.PrefixPaths(pkg.properties.Licenses,
+					filepath.Join("$srcDir", ctx.ModuleDir(pkg)))
+				header := fmt.Sprintf("==== %s (vendored from %s) ====",
+					pkg.properties.PkgPath, pkg.properties.Vendor_of)
+				// The paths still contain the $srcDir Ninja variable, so
+				// they are only shell escaped.
+				cmds = append(cmds, "echo "+proptools.NinjaAndShellEscape([]string{header})[0],
+					"cat "+strings.Join(proptools.ShellEscape(files), " "), "echo")
+				licenseFiles = append(licenseFiles, files...)
+			})
+
+			if len(licenseFiles) == 0 {
+				return
+			}
+
+			ctx.Build(pctx, blueprint.BuildParams{
+				Rule:    notice,
+				Outputs: []string{filepath.Join(noticesDir, ctx.ModuleName(binaryModule)+".NOTICE")},
+				Inputs:  licenseFiles,
+				Args: map[string]string{
+					"cmds": strings.Join(cmds, " && "),
+				},
+			})
+		})
+}
@@ -0,0 +1,188 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"strings"
+	"testing"
+)
+
+const licensesTestBlueprints = `
+	bootstrap_go_package {
+		name: "vendored-a",
+		pkgPath: "example.com/a",
+		srcs: ["a.go"],
+		vendor_of: "https://example.com/a",
+		licenses: ["LICENSE"],
+	}
+
+	bootstrap_go_package {
+		name: "vendored-b",
+		pkgPath: "example.com/b",
+		srcs: ["b.go"],
+		vendor_of: "https://example.com/b",
+		licenses: ["COPYING"],
+	}
+
+	bootstrap_go_package {
+		name: "internal",
+		pkgPath: "example.com/internal",
+		srcs: ["internal.go"],
+	}
+
+	bootstrap_core_go_binary {
+		name: "minibp",
+		deps: ["vendored-a", "internal"],
+		srcs: ["minibp.go"],
+	}
+
+	bootstrap_go_binary {
+		name: "builder",
+		deps: ["vendored-b"],
+		srcs: ["builder.go"],
+		primaryBuilder: true,
+	}
+
+	blueprint_go_binary {
+		name: "tool",
+		deps: ["vendored-b", "internal"],
+		srcs: ["tool.go"],
+	}
+
+	blueprint_go_binary {
+		name: "plain",
+		deps: ["internal"],
+		srcs: ["plain.go"],
+	}
+`
+
+func TestLicenseNotices(t *testing.T) {
+	testCases := []struct {
+		stage       Stage
+		notices     []string
+		licenses    []string
+		notNotices  []string
+		notLicenses []string
+	}{
+		{
+			stage:      StageBootstrap,
+			notices:    []string{"minibp.NOTICE"},
+			licenses:   []string{"LICENSE"},
+			notNotices: []string{"builder.NOTICE", "tool.NOTICE", "plain.NOTICE"},
+		},
+		{
+			stage:       StagePrimary,
+			notices:     []string{"builder.NOTICE"},
+			licenses:    []string{"COPYING"},
+			notNotices:  []string{"minibp.NOTICE", "tool.NOTICE", "plain.NOTICE"},
+			notLicenses: []string{"LICENSE"},
+		},
+		{
+			stage:       StageMain,
+			notices:     []string{"tool.NOTICE"},
+			licenses:    []string{"COPYING"},
+			notNotices:  []string{"minibp.NOTICE", "builder.NOTICE", "plain.NOTICE"},
+			notLicenses: []string{"LICENSE"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		out, errs := runBootstrapTest(t, testCase.stage, licensesTestBlueprints)
+		if len(errs) > 0 {
+			t.Errorf("%s: unexpected errors: %v", testCase.stage, errs)
+			continue
+		}
+		for _, n := range testCase.notices {
+			if !strings.Contains(out, "default ${g.bootstrap.buildDir}/.bootstrap/notices/"+n+"\n") {
+				t.Errorf("%s: expected a build statement for %s in:\n%s", testCase.stage, n, out)
+			}
+		}
+		for _, n := range testCase.notNotices {
+			if strings.Contains(out, "notices/"+n) {
+				t.Errorf("%s: unexpected build statement for %s in:\n%s", testCase.stage, n, out)
+			}
+		}
+		for _, l := range testCase.licenses {
+			if !strings.Contains(out, "cat '${g.bootstrap.srcDir}/"+l+"'") {
+				t.Errorf("%s: expected %s to be aggregated in:\n%s", testCase.stage, l, out)
+			}
+		}
+		for _, l := range testCase.notLicenses {
+			if strings.Contains(out, "${g.bootstrap.srcDir}/"+l) {
+				t.Errorf("%s: unexpected %s in:\n%s", testCase.stage, l, out)
+			}
+		}
+	}
+}
+
+func TestLicenseNoticesMissingLicenses(t *testing.T) {
+	blueprints := `
+		bootstrap_go_package {
+			name: "vendored",
+			pkgPath: "example.com/vendored",
+			srcs: ["vendored.go"],
+			vendor_of: "https://example.com/vendored",
+		}
+
+		blueprint_go_binary {
+			name: "tool1",
+			deps: ["vendored"],
+			srcs: ["tool1.go"],
+		}
+
+		blueprint_go_binary {
+			name: "tool2",
+			deps: ["vendored"],
+			srcs: ["tool2.go"],
+		}
+	`
+
+	_, errs := runBootstrapTest(t, StageMain, blueprints)
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %d: %v", len(errs), errs)
+	}
+	expected := `must list its license files in licenses`
+	if !strings.Contains(errs[0].Error(), expected) ||
+		!strings.Contains(errs[0].Error(), `"example.com/vendored"`) {
+		t.Errorf("expected error containing %q, got %q", expected, errs[0])
+	}
+}
+
+func TestLicenseNoticesEscaping(t *testing.T) {
+	blueprints := `
+		bootstrap_go_package {
+			name: "vendored",
+			pkgPath: "example.com/vendored",
+			srcs: ["vendored.go"],
+			vendor_of: "https://example.com/vendored",
+			licenses: ["LICENSE;rm -rf x", "it's COPYING"],
+		}
+
+		blueprint_go_binary {
+			name: "tool",
+			deps: ["vendored"],
+			srcs: ["tool.go"],
+		}
+	`
+
+	out, errs := runBootstrapTest(t, StageMain, blueprints)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	expected := `cat '${g.bootstrap.srcDir}/LICENSE;rm -rf x' '${g.bootstrap.srcDir}/it'\''s COPYING'`
+	if !strings.Contains(out, expected) {
+		t.Errorf("expected %q in:\n%s", expected, out)
+	}
+}
@@ -15,44 +15,11 @@
 package main
 
 import (
-	"flag"
-	"github.com/google/blueprint"
-	"github.com/google/blueprint/bootstrap"
-)
-
-var runAsPrimaryBuilder bool
-var buildPrimaryBuilder bool
-
-func init() {
-	flag.BoolVar(&runAsPrimaryBuilder, "p", false, "run as a primary builder")
-	flag.BoolVar(&buildPrimaryBuilder, "build-primary", false, "build the primary builder")
-}
+	"os"
 
-type Config struct {
-	generatingBootstrapper   bool
-	generatingPrimaryBuilder bool
-}
-
-func (c Config) GeneratingBootstrapper() bool {
-	return c.generatingBootstrapper
-}
-
-func (c Config) GeneratingPrimaryBuilder() bool {
-	return c.generatingPrimaryBuilder
-}
+	"github.com/google/blueprint/bootstrap/minibplib"
+)
 
 func main() {
-	flag.Parse()
-
-	ctx := blueprint.NewContext()
-	if !runAsPrimaryBuilder {
-		ctx.SetIgnoreUnknownModuleTypes(true)
-	}
-
-	config := Config{
-		generatingBootstrapper:   !runAsPrimaryBuilder && !buildPrimaryBuilder,
-		generatingPrimaryBuilder: !runAsPrimaryBuilder && buildPrimaryBuilder,
-	}
-
-	bootstrap.Main(ctx, config)
+	minibplib.Main(os.Args[1:])
 }
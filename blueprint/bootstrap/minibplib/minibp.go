@@ -0,0 +1,152 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package minibplib is the implementation of minibp, the primary builder that
+// only knows the bootstrap module types and builds the other primary builders.
+// Tools can import it to embed minibp as a subcommand next to their own, so
+// that a project can ship a single binary.
+//
+// Importing the package registers the -p and -build-primary flags of minibp
+// and the flags of the bootstrap package with the flag package.
+//
+// Tools that embed minibp can add their own placeholders to the Ninja file
+// template that minibp generates with bootstrap.TemplateVariable, called from
+// an init function of one of their packages.
+package minibplib
+
+import (
+	"flag"
+
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/bootstrap"
+)
+
+var runAsPrimaryBuilder bool
+var buildPrimaryBuilder bool
+
+func init() {
+	flag.BoolVar(&runAsPrimaryBuilder, "p", false, "run as a primary builder")
+	flag.BoolVar(&buildPrimaryBuilder, "build-primary", false, "build the primary builder")
+}
+
+// A Mode is what minibp generates.
+type Mode int
+
+const (
+	// GenerateTemplate generates the Ninja file template of the bootstrap
+	// stage, like build.ninja.in, which builds minibp itself.  This is the
+	// default.
+	GenerateTemplate Mode = iota
+
+	// BuildPrimaryBuilder generates the Ninja file that builds the primary
+	// builder, like -build-primary.
+	BuildPrimaryBuilder
+
+	// RunAsPrimaryBuilder generates the Ninja file of the main stage, like
+	// -p.
+	RunAsPrimaryBuilder
+)
+
+// Options are the options of Run, which correspond to command line flags of
+// minibp.
+type Options struct {
+	Mode Mode
+
+	// BlueprintsFile is the top-level Blueprints file.
+	BlueprintsFile string
+
+	// OutFile is the Ninja file to write, like -o.  If empty, build.ninja.in
+	// is written.
+	OutFile string
+
+	// DepFile is the dependency file to write, like -d.
+	DepFile string
+
+	// BuildDir is the build output directory, like -b.
+	BuildDir string
+
+	// DocFile is the build documentation file to write, like -docs.
+	DocFile string
+
+	// Args are the other flags of the bootstrap package to pass, like
+	// []string{"-t"} to run the Go tests.
+	Args []string
+}
+
+// Config is the config object that minibp passes to the Context and to
+// bootstrap.Main.
+type Config struct {
+	generatingBootstrapper   bool
+	generatingPrimaryBuilder bool
+}
+
+func (c Config) GeneratingBootstrapper() bool {
+	return c.generatingBootstrapper
+}
+
+func (c Config) GeneratingPrimaryBuilder() bool {
+	return c.generatingPrimaryBuilder
+}
+
+// Run runs minibp with opts.  The flags in opts are parsed with the flag
+// package, so Run must only be called once, and not after flag.Parse.  Like
+// bootstrap.Main it exits the process on errors.
+func Run(opts Options) {
+	var args []string
+	addFlag := func(name, value string) {
+		if value != "" {
+			args = append(args, "-"+name, value)
+		}
+	}
+	addFlag("o", opts.OutFile)
+	addFlag("d", opts.DepFile)
+	addFlag("b", opts.BuildDir)
+	addFlag("docs", opts.DocFile)
+	args = append(args, opts.Args...)
+	args = append(args, opts.BlueprintsFile)
+
+	flag.CommandLine.Parse(args)
+	run(opts.Mode)
+}
+
+// Main runs minibp with the command line arguments in args, without the name
+// of the program, for example os.Args[2:] in a tool with a minibp subcommand.
+// The arguments are parsed with the flag package, so Main must only be called
+// once, and not after flag.Parse.  Like bootstrap.Main it exits the process on
+// errors.
+func Main(args []string) {
+	flag.CommandLine.Parse(args)
+
+	mode := GenerateTemplate
+	if runAsPrimaryBuilder {
+		mode = RunAsPrimaryBuilder
+	} else if buildPrimaryBuilder {
+		mode = BuildPrimaryBuilder
+	}
+	run(mode)
+}
+
+func run(mode Mode) {
+	ctx := blueprint.NewContext()
+	if mode != RunAsPrimaryBuilder {
+		ctx.SetIgnoreUnknownModuleTypes(true)
+	}
+
+	config := Config{
+		generatingBootstrapper:   mode == GenerateTemplate,
+		generatingPrimaryBuilder: mode == BuildPrimaryBuilder,
+	}
+
+	bootstrap.Main(ctx, config)
+}
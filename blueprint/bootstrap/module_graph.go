@@ -0,0 +1,357 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/blueprint"
+)
+
+// moduleGraphIndexName is the file in the -module_graph directory that lists
+// the files of the Blueprints directories when -module_graph_split is set.
+const moduleGraphIndexName = "module_graph_index.json"
+
+// moduleGraphIndex is the contents of the moduleGraphIndexName file.
+type moduleGraphIndex struct {
+	Compression string                  `json:"compression"`
+	Dirs        []moduleGraphIndexEntry `json:"dirs"`
+}
+
+type moduleGraphIndexEntry struct {
+	Dir     string `json:"dir"`
+	File    string `json:"file"`
+	Modules int    `json:"modules"`
+}
+
+// moduleGraphCompressions maps the supported -module_graph_compression values
+// to the extension of the files they write.
+var moduleGraphCompressions = map[string]string{
+	"none": "",
+	"gzip": ".gz",
+	"zstd": ".zst",
+}
+
+// moduleGraphCompression returns the compression of the -module_graph file
+// filename, which is -module_graph_compression if it is set, or else implied
+// by the extension of filename unless it is a directory.
+func moduleGraphCompression(filename string, split bool) (string, error) {
+	if moduleGraphCompressionFlag != "" {
+		if _, ok := moduleGraphCompressions[moduleGraphCompressionFlag]; !ok {
+			return "", fmt.Errorf("invalid -module_graph_compression %q, expected none, gzip or zstd",
+				moduleGraphCompressionFlag)
+		}
+		if moduleGraphCompressionFlag == "zstd" {
+			if err := checkZstd(); err != nil {
+				return "", err
+			}
+		}
+		return moduleGraphCompressionFlag, nil
+	}
+	if !split {
+		for compression, ext := range moduleGraphCompressions {
+			if ext != "" && strings.HasSuffix(filename, ext) {
+				if compression == "zstd" {
+					if err := checkZstd(); err != nil {
+						return "", err
+					}
+				}
+				return compression, nil
+			}
+		}
+	}
+	return "none", nil
+}
+
+// checkZstd returns an error if the zstd tool used for zstd compression is not
+// in the PATH, so that the module graph isn't generated just to fail writing it.
+func checkZstd() error {
+	if _, err := exec.LookPath("zstd"); err != nil {
+		return fmt.Errorf("zstd compression of the -module_graph requires the zstd tool in the PATH: %s", err)
+	}
+	return nil
+}
+
+// A ModuleGraphEdgesProvider is a module that references other modules without
+// depending on them, like the modules it requires to be installed with it.  The
+// references are added to the module graphs written with -module_graph and
+// -dist after the dependencies of the module.
+type ModuleGraphEdgesProvider interface {
+	ModuleGraphEdges() []ModuleGraphEdge
+}
+
+// A ModuleGraphEdge is a reference to the module named Name.  Kind describes
+// the reference, for example "required", and must not be empty.
+type ModuleGraphEdge struct {
+	Name string
+	Kind string
+}
+
+// moduleGraphModule returns the variant module of ctx with its type,
+// Blueprints file, direct dependencies and ModuleGraphEdges.
+func moduleGraphModule(ctx *blueprint.Context, module blueprint.Module) distModule {
+	m := distModule{
+		Name:      ctx.ModuleName(module),
+		Variant:   ctx.ModuleSubDir(module),
+		Type:      ctx.ModuleType(module),
+		Blueprint: ctx.BlueprintFile(module),
+	}
+	ctx.VisitDirectDeps(module, func(dep blueprint.Module) {
+		m.Deps = append(m.Deps, distDep{
+			Name:    ctx.ModuleName(dep),
+			Variant: ctx.ModuleSubDir(dep),
+		})
+	})
+	if p, ok := module.(ModuleGraphEdgesProvider); ok {
+		for _, edge := range p.ModuleGraphEdges() {
+			m.Deps = append(m.Deps, distDep{
+				Name: edge.Name,
+				Kind: edge.Kind,
+			})
+		}
+	}
+	return m
+}
+
+// moduleGraphWriter writes modules as a JSON array formatted like
+// json.MarshalIndent, one module at a time, so that the module graph of large
+// trees doesn't have to be held in memory as JSON.
+type moduleGraphWriter struct {
+	w       io.Writer
+	modules int
+	err     error
+}
+
+func (g *moduleGraphWriter) add(m distModule) {
+	if g.err != nil {
+		return
+	}
+	data, err := json.MarshalIndent(m, "  ", "  ")
+	if err != nil {
+		g.err = err
+		return
+	}
+	sep := ",\n  "
+	if g.modules == 0 {
+		sep = "[\n  "
+	}
+	g.modules++
+	if _, err := io.WriteString(g.w, sep); err != nil {
+		g.err = err
+		return
+	}
+	_, g.err = g.w.Write(data)
+}
+
+// finish ends the array, and returns the first error of writing it.
+func (g *moduleGraphWriter) finish() error {
+	if g.err != nil {
+		return g.err
+	}
+	end := "\n]\n"
+	if g.modules == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(g.w, end)
+	return err
+}
+
+// compressingWriter compresses the data written to it into a file.  Close
+// flushes the compressed data and closes the file.
+type compressingWriter struct {
+	io.Writer
+	close func() error
+}
+
+func (w *compressingWriter) Close() error {
+	return w.close()
+}
+
+// createCompressed creates filename and returns a writer that compresses the
+// data written to it into the file with compression.  zstd compression runs
+// the zstd tool, which must be in the PATH, as Go has no zstd package.
+func createCompressed(filename, compression string) (io.WriteCloser, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	switch compression {
+	case "gzip":
+		gw := gzip.NewWriter(f)
+		return &compressingWriter{gw, func() error {
+			err := gw.Close()
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			return err
+		}}, nil
+	case "zstd":
+		cmd := exec.Command("zstd", "-q", "-c")
+		cmd.Stdout = f
+		cmd.Stderr = os.Stderr
+		stdin, err := cmd.StdinPipe()
+		if err == nil {
+			err = cmd.Start()
+		}
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("error running zstd: %s", err)
+		}
+		return &compressingWriter{stdin, func() error {
+			err := stdin.Close()
+			if waitErr := cmd.Wait(); err == nil && waitErr != nil {
+				err = fmt.Errorf("zstd failed: %s", waitErr)
+			}
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			return err
+		}}, nil
+	default:
+		return f, nil
+	}
+}
+
+// writeModuleGraph writes the module graph of ctx as JSON to filename, or with
+// split to a file for each directory with Blueprints files in the directory
+// filename, compressed as set by the -module_graph_compression flag.
+func writeModuleGraph(ctx *blueprint.Context, filename string, split bool) (err error) {
+	compression, err := moduleGraphCompression(filename, split)
+	if err != nil {
+		return err
+	}
+	if split {
+		return writeSplitModuleGraph(ctx, filename, compression)
+	}
+
+	w, err := createCompressed(filename, compression)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	g := &moduleGraphWriter{w: w}
+	ctx.VisitAllModules(func(module blueprint.Module) {
+		g.add(moduleGraphModule(ctx, module))
+	})
+	return g.finish()
+}
+
+// writeSplitModuleGraph writes the modules of each directory with Blueprints
+// files to module_graph.json in the same directory under dir, with the
+// extension of the compression, and lists the files in the
+// moduleGraphIndexName file.  The files listed by the previous index that are
+// not written again are removed.
+func writeSplitModuleGraph(ctx *blueprint.Context, dir, compression string) error {
+	modules, index := splitModuleGraph(ctx, compression)
+
+	written := make(map[string]bool)
+	for _, entry := range index.Dirs {
+		err := writeModuleGraphFile(filepath.Join(dir, filepath.FromSlash(entry.File)),
+			compression, modules[entry.Dir])
+		if err != nil {
+			return err
+		}
+		written[entry.File] = true
+	}
+
+	indexFile := filepath.Join(dir, moduleGraphIndexName)
+	if data, err := ioutil.ReadFile(indexFile); err == nil {
+		var previous moduleGraphIndex
+		if json.Unmarshal(data, &previous) == nil {
+			for _, entry := range previous.Dirs {
+				if !written[entry.File] {
+					err := os.Remove(filepath.Join(dir, filepath.FromSlash(entry.File)))
+					if err != nil && !os.IsNotExist(err) {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(indexFile, append(data, '\n'), 0666)
+}
+
+// splitModuleGraph returns the modules of ctx grouped by the directory of
+// their Blueprints file, and the index of the files they are written to with
+// compression.
+func splitModuleGraph(ctx *blueprint.Context, compression string) (map[string][]distModule, moduleGraphIndex) {
+	modules := make(map[string][]distModule)
+	ctx.VisitAllModules(func(module blueprint.Module) {
+		m := moduleGraphModule(ctx, module)
+		modulesDir := filepath.ToSlash(filepath.Dir(m.Blueprint))
+		modules[modulesDir] = append(modules[modulesDir], m)
+	})
+
+	var dirs []string
+	for modulesDir := range modules {
+		dirs = append(dirs, modulesDir)
+	}
+	sort.Strings(dirs)
+
+	index := moduleGraphIndex{
+		Compression: compression,
+		Dirs:        []moduleGraphIndexEntry{},
+	}
+	for _, modulesDir := range dirs {
+		index.Dirs = append(index.Dirs, moduleGraphIndexEntry{
+			Dir: modulesDir,
+			File: filepath.ToSlash(filepath.Join(modulesDir,
+				"module_graph.json"+moduleGraphCompressions[compression])),
+			Modules: len(modules[modulesDir]),
+		})
+	}
+	return modules, index
+}
+
+func writeModuleGraphFile(filename, compression string, modules []distModule) (err error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+		return err
+	}
+	w, err := createCompressed(filename, compression)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	g := &moduleGraphWriter{w: w}
+	for _, m := range modules {
+		g.add(m)
+	}
+	return g.finish()
+}
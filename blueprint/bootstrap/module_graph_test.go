@@ -0,0 +1,344 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/blueprint"
+)
+
+type moduleGraphTestModule struct {
+	blueprint.SimpleName
+	properties struct {
+		Deps     []string
+		Required []string
+	}
+}
+
+func newModuleGraphTestModule() (blueprint.Module, []interface{}) {
+	m := &moduleGraphTestModule{}
+	return m, []interface{}{&m.properties, &m.SimpleName.Properties}
+}
+
+func (m *moduleGraphTestModule) GenerateBuildActions(blueprint.ModuleContext) {}
+
+func (m *moduleGraphTestModule) DynamicDependencies(blueprint.DynamicDependerModuleContext) []string {
+	return m.properties.Deps
+}
+
+func (m *moduleGraphTestModule) ModuleGraphEdges() []ModuleGraphEdge {
+	var edges []ModuleGraphEdge
+	for _, r := range m.properties.Required {
+		edges = append(edges, ModuleGraphEdge{Name: r, Kind: "required"})
+	}
+	return edges
+}
+
+func setupModuleGraphTest(t *testing.T) *blueprint.Context {
+	ctx := blueprint.NewContext()
+	ctx.RegisterModuleType("test_module", newModuleGraphTestModule)
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			subdirs = ["sub"]
+
+			test_module {
+				name: "a",
+				deps: ["b"],
+				required: ["c", "undefined"],
+			}
+
+			test_module {
+				name: "b",
+			}
+		`),
+		"sub/Blueprints": []byte(`
+			test_module {
+				name: "c",
+			}
+		`),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) > 0 {
+		t.Fatalf("unexpected parse errors: %v", errs)
+	}
+	errs = ctx.ResolveDependencies(nil)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected dependency errors: %v", errs)
+	}
+	return ctx
+}
+
+func TestModuleGraphEdges(t *testing.T) {
+	ctx := setupModuleGraphTest(t)
+
+	data, err := moduleGraphJSON(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var modules []distModule
+	if err := json.Unmarshal(data, &modules); err != nil {
+		t.Fatalf("invalid module graph JSON: %s\n%s", err, data)
+	}
+
+	expected := []distDep{
+		{Name: "b"},
+		{Name: "c", Kind: "required"},
+		{Name: "undefined", Kind: "required"},
+	}
+	for _, m := range modules {
+		if m.Name == "a" {
+			if !reflect.DeepEqual(m.Deps, expected) {
+				t.Errorf("expected deps %v, got %v", expected, m.Deps)
+			}
+			return
+		}
+	}
+	t.Errorf("module a missing from the module graph:\n%s", data)
+}
+
+// readModuleGraphFile returns the decompressed contents of a module graph file.
+func readModuleGraphFile(t *testing.T, filename, compression string) []byte {
+	var data []byte
+	var err error
+	switch compression {
+	case "gzip":
+		var f *os.File
+		f, err = os.Open(filename)
+		if err != nil {
+			break
+		}
+		defer f.Close()
+		var r *gzip.Reader
+		r, err = gzip.NewReader(f)
+		if err != nil {
+			break
+		}
+		data, err = ioutil.ReadAll(r)
+	case "zstd":
+		data, err = exec.Command("zstd", "-q", "-d", "-c", filename).Output()
+	default:
+		data, err = ioutil.ReadFile(filename)
+	}
+	if err != nil {
+		t.Fatalf("error reading %s: %s", filename, err)
+	}
+	return data
+}
+
+func TestWriteModuleGraph(t *testing.T) {
+	ctx := setupModuleGraphTest(t)
+	expected, err := moduleGraphJSON(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "blueprint_module_graph_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func() { moduleGraphCompressionFlag = "" }()
+
+	testCases := []struct {
+		file, flag, compression string
+	}{
+		{"graph.json", "", "none"},
+		{"graph.json.gz", "", "gzip"},
+		{"graph.json", "gzip", "gzip"},
+		{"graph.json.gz", "none", "none"},
+		{"graph.json.zst", "", "zstd"},
+	}
+	for _, testCase := range testCases {
+		if testCase.compression == "zstd" {
+			if _, err := exec.LookPath("zstd"); err != nil {
+				t.Logf("skipping zstd, the zstd tool is not in the PATH")
+				continue
+			}
+		}
+
+		moduleGraphCompressionFlag = testCase.flag
+		filename := filepath.Join(dir, testCase.file)
+		if err := writeModuleGraph(ctx, filename, false); err != nil {
+			t.Errorf("%s with %q: unexpected error: %s", testCase.file, testCase.flag, err)
+			continue
+		}
+		data := readModuleGraphFile(t, filename, testCase.compression)
+		if !bytes.Equal(data, expected) {
+			t.Errorf("%s with %q: expected:\n%s\ngot:\n%s", testCase.file, testCase.flag, expected, data)
+		}
+	}
+}
+
+func TestWriteSplitModuleGraph(t *testing.T) {
+	ctx := setupModuleGraphTest(t)
+
+	dir, err := ioutil.TempDir("", "blueprint_module_graph_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A file listed by a previous index for a directory that no longer has
+	// modules is removed.
+	stale := filepath.Join(dir, "old", "module_graph.json.gz")
+	if err := os.MkdirAll(filepath.Dir(stale), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(stale, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, moduleGraphIndexName),
+		[]byte(`{"compression": "gzip", "dirs": [{"dir": "old", "file": "old/module_graph.json.gz"}]}`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	moduleGraphCompressionFlag = "gzip"
+	defer func() { moduleGraphCompressionFlag = "" }()
+	if err := writeModuleGraph(ctx, dir, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed, got %v", stale, err)
+	}
+
+	var index moduleGraphIndex
+	data, err := ioutil.ReadFile(filepath.Join(dir, moduleGraphIndexName))
+	if err == nil {
+		err = json.Unmarshal(data, &index)
+	}
+	if err != nil {
+		t.Fatalf("error reading the index: %s", err)
+	}
+	expectedIndex := moduleGraphIndex{
+		Compression: "gzip",
+		Dirs: []moduleGraphIndexEntry{
+			{Dir: ".", File: "module_graph.json.gz", Modules: 2},
+			{Dir: "sub", File: "sub/module_graph.json.gz", Modules: 1},
+		},
+	}
+	if !reflect.DeepEqual(index, expectedIndex) {
+		t.Fatalf("expected index %+v, got %+v", expectedIndex, index)
+	}
+
+	// The split files contain the modules of the unsplit module graph.
+	var names []string
+	for _, entry := range index.Dirs {
+		var modules []distModule
+		data := readModuleGraphFile(t, filepath.Join(dir, filepath.FromSlash(entry.File)), "gzip")
+		if err := json.Unmarshal(data, &modules); err != nil {
+			t.Fatalf("invalid module graph %s: %s", entry.File, err)
+		}
+		for _, m := range modules {
+			names = append(names, m.Name)
+		}
+	}
+	if expected := []string{"a", "b", "c"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected modules %q, got %q", expected, names)
+	}
+}
+
+func TestModuleGraphZstdMissing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blueprint_module_graph_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := os.Getenv("PATH")
+	defer os.Setenv("PATH", path)
+	os.Setenv("PATH", dir)
+
+	defer func() { moduleGraphCompressionFlag = "" }()
+	for _, flag := range []string{"zstd", ""} {
+		moduleGraphCompressionFlag = flag
+		_, err := moduleGraphCompression("graph.json.zst", false)
+		if err == nil || !strings.Contains(err.Error(), "requires the zstd tool in the PATH") {
+			t.Errorf("with %q: expected a missing zstd error, got %v", flag, err)
+		}
+	}
+}
+
+func TestDistSplitModuleGraph(t *testing.T) {
+	ctx := setupModuleGraphTest(t)
+
+	dir, err := ioutil.TempDir("", "blueprint_module_graph_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	oldOutFile := outFile
+	defer func() {
+		outFile = oldOutFile
+		moduleGraphSplit = false
+	}()
+	outFile = filepath.Join(dir, "build.ninja")
+	moduleGraphSplit = true
+
+	filename := filepath.Join(dir, "dist.tar.gz")
+	if err := writeDist(ctx, filename, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gr)
+	var names []string
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, h.Name)
+	}
+	sort.Strings(names)
+
+	expected := []string{
+		"diagnostics.json",
+		"metrics.json",
+		"module_graph/module_graph.json",
+		"module_graph/module_graph_index.json",
+		"module_graph/sub/module_graph.json",
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected archive entries %q, got %q", expected, names)
+	}
+}
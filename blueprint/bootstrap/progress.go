@@ -0,0 +1,61 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"time"
+
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/logging"
+)
+
+// progressInterval is the minimum time between two progress messages of a
+// phase, so that large source trees don't flood the terminal and the logs.
+const progressInterval = 100 * time.Millisecond
+
+// progressUnits are the things counted by the phases of the Context.
+var progressUnits = map[string]string{
+	"parse":    "Blueprints files",
+	"generate": "modules",
+}
+
+// newProgressReporter returns the progress reporter of -progress, which logs
+// the progress of each phase to logger at most every progressInterval, and
+// always when the phase finishes.
+func newProgressReporter(logger *logging.Logger) func(blueprint.Progress) {
+	var last time.Time
+	return func(p blueprint.Progress) {
+		now := time.Now()
+		if !p.Finished && now.Sub(last) < progressInterval {
+			return
+		}
+		last = now
+
+		progress := logging.Progress{
+			Done:     p.Done,
+			Total:    p.Total,
+			Finished: p.Finished,
+		}
+		switch {
+		case p.Canceled:
+			logger.Progressf(progress, "%s: canceled after %d of %d %s", p.Phase, p.Done, p.Total,
+				progressUnits[p.Phase])
+		case p.Finished:
+			logger.Progressf(progress, "%s: finished %d %s", p.Phase, p.Done, progressUnits[p.Phase])
+		default:
+			logger.Progressf(progress, "%s: %d/%d %s", p.Phase, p.Done, p.Total, progressUnits[p.Phase])
+		}
+	}
+}
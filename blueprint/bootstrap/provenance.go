@@ -0,0 +1,215 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/pathtools"
+)
+
+const (
+	inTotoStatementType        = "https://in-toto.io/Statement/v0.1"
+	slsaProvenanceType         = "https://slsa.dev/provenance/v0.2"
+	provenanceBuildType        = "https://github.com/google/blueprint/bootstrap@v1"
+	defaultProvenanceBuilderID = "blueprint"
+)
+
+// ProvenanceInfo describes the builder in the provenance attestation written
+// with -provenance.
+type ProvenanceInfo struct {
+	// BuilderID identifies the build platform, for example the URI of the
+	// CI system.  If empty, "blueprint" is used.
+	BuilderID string
+
+	// ToolVersions are the versions of the tools used by the build, like
+	// compilers, keyed by the name of the tool.
+	ToolVersions map[string]string
+}
+
+type ConfigProvenance interface {
+	// Provenance should return the description of the builder to record in
+	// the provenance attestation written with -provenance.
+	Provenance() ProvenanceInfo
+}
+
+type provenanceDigest map[string]string
+
+type provenanceArtifact struct {
+	Name   string           `json:"name,omitempty"`
+	URI    string           `json:"uri,omitempty"`
+	Digest provenanceDigest `json:"digest"`
+}
+
+// provenanceStep is a build statement, with the digests of its inputs.
+type provenanceStep struct {
+	Rule    string               `json:"rule"`
+	Owner   string               `json:"owner"`
+	Outputs []string             `json:"outputs"`
+	Inputs  []provenanceArtifact `json:"inputs,omitempty"`
+	Local   bool                 `json:"local,omitempty"`
+	NoCache bool                 `json:"noCache,omitempty"`
+}
+
+type provenanceStatement struct {
+	Type          string               `json:"_type"`
+	PredicateType string               `json:"predicateType"`
+	Subject       []provenanceArtifact `json:"subject"`
+	Predicate     struct {
+		Builder struct {
+			ID string `json:"id"`
+		} `json:"builder"`
+		BuildType  string `json:"buildType"`
+		Invocation struct {
+			Parameters []string `json:"parameters"`
+		} `json:"invocation"`
+		BuildConfig struct {
+			PrimaryBuilder provenanceArtifact `json:"primaryBuilder"`
+			ToolVersions   map[string]string  `json:"toolVersions,omitempty"`
+			Steps          []provenanceStep   `json:"steps"`
+		} `json:"buildConfig"`
+		Materials []provenanceArtifact `json:"materials"`
+	} `json:"predicate"`
+}
+
+// fileHasher computes the sha256 digests of files, once per file, using the
+// HashCache of -hash_cache.
+type fileHasher map[string]provenanceDigest
+
+// digest returns the digest of the file, or an empty digest if the file
+// doesn't exist, like an output that hasn't been built or a phony target, or is
+// a directory.
+func (h fileHasher) digest(filename string) (provenanceDigest, error) {
+	if d, ok := h[filename]; ok {
+		return d, nil
+	}
+
+	hash, err := pathtools.FileSHA256(filename)
+	if err != nil {
+		return nil, err
+	}
+	d := provenanceDigest{}
+	if hash != "" {
+		d["sha256"] = hash
+	}
+
+	h[filename] = d
+	return d, nil
+}
+
+// writeProvenance writes an in-toto statement with a SLSA provenance predicate
+// that records the rule and inputs of every build statement.  The digests are
+// those of the files when it is written, so the subjects are the outputs that
+// exist, and it should be written after the build, for example by running the
+// primary builder with -dry_run and -provenance.  The materials are the inputs
+// that are not built.
+func writeProvenance(ctx *blueprint.Context, config interface{}, filename string) error {
+	statements, err := ctx.BuildStatements()
+	if err != nil {
+		return err
+	}
+
+	var info ProvenanceInfo
+	if c, ok := config.(ConfigProvenance); ok {
+		info = c.Provenance()
+	}
+	if info.BuilderID == "" {
+		info.BuilderID = defaultProvenanceBuilderID
+	}
+
+	s := &provenanceStatement{
+		Type:          inTotoStatementType,
+		PredicateType: slsaProvenanceType,
+	}
+	s.Predicate.Builder.ID = info.BuilderID
+	s.Predicate.BuildType = provenanceBuildType
+	s.Predicate.Invocation.Parameters = os.Args[1:]
+	s.Predicate.BuildConfig.ToolVersions = info.ToolVersions
+
+	hasher := make(fileHasher)
+
+	primaryBuilder, err := exec.LookPath(os.Args[0])
+	if err != nil {
+		return err
+	}
+	digest, err := hasher.digest(primaryBuilder)
+	if err != nil {
+		return err
+	}
+	s.Predicate.BuildConfig.PrimaryBuilder = provenanceArtifact{URI: primaryBuilder, Digest: digest}
+
+	built := make(map[string]bool)
+	for _, statement := range statements {
+		for _, output := range statement.Outputs {
+			built[output] = true
+		}
+	}
+
+	materials := make(map[string]provenanceDigest)
+	s.Subject = []provenanceArtifact{}
+	s.Predicate.BuildConfig.Steps = make([]provenanceStep, 0, len(statements))
+	for _, statement := range statements {
+		step := provenanceStep{
+			Rule:    statement.Rule,
+			Owner:   statement.Owner,
+			Outputs: statement.Outputs,
+			Local:   statement.Local,
+			NoCache: statement.NoCache,
+		}
+		for _, input := range statement.Inputs {
+			digest, err := hasher.digest(input)
+			if err != nil {
+				return err
+			}
+			step.Inputs = append(step.Inputs, provenanceArtifact{Name: input, Digest: digest})
+			if !built[input] {
+				materials[input] = digest
+			}
+		}
+		s.Predicate.BuildConfig.Steps = append(s.Predicate.BuildConfig.Steps, step)
+
+		for _, output := range statement.Outputs {
+			digest, err := hasher.digest(output)
+			if err != nil {
+				return err
+			}
+			if len(digest) > 0 {
+				s.Subject = append(s.Subject, provenanceArtifact{Name: output, Digest: digest})
+			}
+		}
+	}
+
+	names := make([]string, 0, len(materials))
+	for name := range materials {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	s.Predicate.Materials = make([]provenanceArtifact, 0, len(names))
+	for _, name := range names {
+		s.Predicate.Materials = append(s.Predicate.Materials,
+			provenanceArtifact{URI: name, Digest: materials[name]})
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, append(data, '\n'), 0666)
+}
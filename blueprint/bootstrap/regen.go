@@ -0,0 +1,112 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/deptools"
+)
+
+// NinjaFileDeps lists the inputs of a primary builder invocation that the
+// generated Ninja file depends on.  Ninja reruns the primary builder whenever
+// one of them changes, so anything the primary builder reads that is missing
+// from this list causes the Ninja file to silently go stale.
+//
+// The primary builder binary itself is not listed.  It is a CommandDeps of the
+// rule that regenerates the Ninja file, see regenerateNinjaFile.
+type NinjaFileDeps struct {
+	// BlueprintsFiles are the Blueprints files that were parsed, and the
+	// files and directories that were read to find them.
+	BlueprintsFiles []string
+
+	// ConfigFiles are the files the configuration was read from.  They are
+	// the extraNinjaFileDeps passed to Main, and the files returned by the
+	// config if it implements ConfigNinjaFileDeps.
+	ConfigFiles []string
+
+	// BuildActionFiles are the files added with AddNinjaFileDeps by modules,
+	// singletons and packages while generating build actions.  They include
+	// the file lists of the globs used by modules, which are regenerated by
+	// build statements in the Ninja file itself.
+	BuildActionFiles []string
+}
+
+// Files returns the sorted list of all files in d, without duplicates.
+func (d *NinjaFileDeps) Files() []string {
+	var files []string
+	seen := make(map[string]bool)
+	for _, list := range [][]string{d.BlueprintsFiles, d.ConfigFiles, d.BuildActionFiles} {
+		for _, f := range list {
+			if !seen[f] {
+				seen[f] = true
+				files = append(files, f)
+			}
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// WriteDepFile writes a gcc-style depfile that makes ninjaFile depend on all
+// of the files in d.  It returns an error if ninjaFile is listed as its own
+// dependency, as Ninja would then regenerate it on every invocation.
+func (d *NinjaFileDeps) WriteDepFile(depFile, ninjaFile string) error {
+	files := d.Files()
+	for _, f := range files {
+		if filepath.Clean(f) == filepath.Clean(ninjaFile) {
+			return fmt.Errorf("%s depends on itself", ninjaFile)
+		}
+	}
+	return deptools.WriteDepFile(depFile, ninjaFile, files)
+}
+
+// regenerateNinjaFile adds a build statement that runs builder on the top
+// level Blueprints file to regenerate ninjaFile.  Every input other than the
+// builder binary and the implicits is listed in the depfile written by Main, see
+// NinjaFileDeps.  Inputs that are built by the same Ninja file must be passed
+// as implicits, as Ninja doesn't know about the depfile before the first build.
+//
+// generator must be true if the build statement is written into ninjaFile
+// itself.  It is then marked with generator = 1, so that Ninja doesn't rerun
+// the builder just because the command line changed, and "ninja -t clean"
+// doesn't remove the Ninja file that it is reading.
+//
+// interactive runs the builder in Ninja's console pool, so that it can draw
+// its progress on the terminal.
+func regenerateNinjaFile(ctx blueprint.SingletonContext, ninjaFile, blueprintsFile,
+	builder, extra string, generator, interactive bool, implicits ...string) {
+
+	args := map[string]string{
+		"builder": builder,
+		"extra":   extra,
+	}
+	if generator {
+		args["generator"] = "true"
+	}
+
+	ctx.Build(pctx, blueprint.BuildParams{
+		Rule:      generateBuildNinja,
+		Outputs:   []string{ninjaFile},
+		Inputs:    []string{blueprintsFile},
+		Implicits: implicits,
+		Args:      args,
+
+		Interactive: interactive,
+	})
+}
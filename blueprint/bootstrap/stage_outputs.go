@@ -0,0 +1,167 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/pathtools"
+)
+
+// A stageOutput is an output of a build statement in the Ninja file of a
+// stage, as recorded in the stage outputs file.
+type stageOutput struct {
+	Path  string
+	Owner string
+	Rule  string
+}
+
+// stageOutputsPath returns the path of the file that records the outputs of
+// the Ninja file of stage, in the .bootstrap directory of buildDir.
+func stageOutputsPath(buildDir string, stage Stage) string {
+	return filepath.Join(buildDir, bootstrapSubDir, "outputs-"+stage.String()+".json")
+}
+
+// stageOutputs returns the outputs of the build statements of ctx, except
+// those of phony build statements, which are not files.  The placeholders of
+// the directories in the Ninja file of the bootstrap stage are replaced with
+// the directories, so that the paths compare equal to those of the later
+// stages.
+func stageOutputs(ctx *blueprint.Context) ([]stageOutput, error) {
+	statements, err := ctx.BuildStatements()
+	if err != nil {
+		return nil, err
+	}
+
+	placeholders := strings.NewReplacer("@@BuildDir@@", BuildDir, "@@SrcDir@@", SrcDir)
+
+	var outputs []stageOutput
+	for _, s := range statements {
+		if s.Rule == "phony" {
+			continue
+		}
+		for _, output := range s.Outputs {
+			path := filepath.Clean(placeholders.Replace(output))
+			outputs = append(outputs, stageOutput{path, s.Owner, s.Rule})
+		}
+	}
+	return outputs, nil
+}
+
+// writeStageOutputs records outputs in the stage outputs file of stage, to be
+// checked by the later stages.  The file is left untouched if its contents
+// didn't change.
+func writeStageOutputs(filename string, outputs []stageOutput) error {
+	data, err := json.MarshalIndent(outputs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return pathtools.WriteFileIfChanged(filename, append(data, '\n'), 0666)
+}
+
+// checkStageOutputs checks outputs of stage against the outputs recorded by
+// the stages that run before it, and returns a *pathtools.OutputPathError for
+// every output that is also declared by an earlier stage, or that is a file
+// in one stage and a directory in the other.  Only the earlier stages are
+// checked because their records are always up to date when stage runs, while
+// the records of the later stages may be from before the change that fixes a
+// collision.
+//
+// The Ninja files of the stages are exempt, as each stage regenerates its own
+// Ninja file after the previous stage generated it, as are the outputs of the
+// same rule of the same owner, like the glob file lists that every stage
+// declares for the globs in the Blueprints files, and the allowed collisions
+// of policy.
+func checkStageOutputs(buildDir string, stage Stage, outputs []stageOutput,
+	policy *pathtools.OutputPathPolicy) ([]error, error) {
+
+	exempt := make(map[string]bool)
+	for _, s := range wrapperStages {
+		exempt[filepath.Join(buildDir, s.NinjaFile)] = true
+	}
+	if policy != nil {
+		for _, path := range policy.AllowedCollisions {
+			exempt[filepath.Clean(path)] = true
+		}
+	}
+
+	type earlierOutput struct {
+		stageOutput
+		stage Stage
+	}
+	files := make(map[string]earlierOutput)
+	dirs := make(map[string]earlierOutput)
+	for earlier := StageBootstrap; earlier < stage; earlier++ {
+		data, err := ioutil.ReadFile(stageOutputsPath(buildDir, earlier))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		var recorded []stageOutput
+		if err := json.Unmarshal(data, &recorded); err != nil {
+			return nil, fmt.Errorf("error parsing %s: %s", stageOutputsPath(buildDir, earlier), err)
+		}
+		for _, output := range recorded {
+			files[output.Path] = earlierOutput{output, earlier}
+			for dir := filepath.Dir(output.Path); dir != "." && dir != "/"; dir = filepath.Dir(dir) {
+				if _, ok := dirs[dir]; ok {
+					break
+				}
+				dirs[dir] = earlierOutput{output, earlier}
+			}
+		}
+	}
+
+	var errs []error
+	for _, output := range outputs {
+		if exempt[output.Path] {
+			continue
+		}
+		collision := func(format string, args ...interface{}) {
+			errs = append(errs, &pathtools.OutputPathError{
+				Path:   output.Path,
+				Owner:  fmt.Sprintf("%q in the %s stage", output.Owner, stage),
+				Reason: fmt.Sprintf(format, args...),
+			})
+		}
+
+		if prev, ok := files[output.Path]; ok {
+			if prev.Owner != output.Owner || prev.Rule != output.Rule {
+				collision("also declared by %q in the %s stage", prev.Owner, prev.stage)
+			}
+		} else if prev, ok := dirs[output.Path]; ok {
+			collision("it is a directory containing %q, declared by %q in the %s stage",
+				prev.Path, prev.Owner, prev.stage)
+		}
+
+		for dir := filepath.Dir(output.Path); dir != "." && dir != "/"; dir = filepath.Dir(dir) {
+			if prev, ok := files[dir]; ok {
+				collision("it is inside %q, declared as a file by %q in the %s stage",
+					prev.Path, prev.Owner, prev.stage)
+				break
+			}
+		}
+	}
+
+	return errs, nil
+}
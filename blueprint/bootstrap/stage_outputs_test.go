@@ -0,0 +1,182 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/blueprint/pathtools"
+)
+
+func TestStageOutputs(t *testing.T) {
+	defer func(buildDir, srcDir string) {
+		BuildDir, SrcDir = buildDir, srcDir
+	}(BuildDir, SrcDir)
+	BuildDir, SrcDir = "out", "src"
+
+	ctx := runBuildTest(t, `
+		test_module {
+			name: "foo",
+			outputs: ["@@BuildDir@@/foo", "@@SrcDir@@/./generated"],
+			phony: ["foo-all"],
+		}
+
+		test_module {
+			name: "bar",
+			dir: "@@BuildDir@@/bar",
+			outputs: ["${dir}/bar"],
+		}
+	`)
+
+	outputs, err := stageOutputs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The order of independent modules is not deterministic.
+	byPath := make(map[string]stageOutput)
+	for _, output := range outputs {
+		byPath[output.Path] = output
+	}
+	expected := map[string]stageOutput{
+		"out/foo":       {Path: "out/foo", Owner: "foo", Rule: "g.bootstrap.cp"},
+		"src/generated": {Path: "src/generated", Owner: "foo", Rule: "g.bootstrap.cp"},
+		"out/bar/bar":   {Path: "out/bar/bar", Owner: "bar", Rule: "g.bootstrap.cp"},
+	}
+	if len(outputs) != len(expected) || !reflect.DeepEqual(byPath, expected) {
+		t.Errorf("incorrect outputs:")
+		t.Errorf("  expected: %+v", expected)
+		t.Errorf("       got: %+v", outputs)
+	}
+}
+
+func TestCheckStageOutputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stage_outputs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, bootstrapSubDir), 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	bootstrapOutputs := []stageOutput{
+		{Path: "out/.bootstrap/bin/minibp", Owner: "minibp", Rule: "g.bootstrap.link"},
+		{Path: "out/.bootstrap/globs/1.glob", Owner: "glob", Rule: "g.bootstrap.glob"},
+		{Path: filepath.Join(dir, ".bootstrap/build.ninja"), Owner: "bootstrap", Rule: "g.bootstrap.build.ninja"},
+		{Path: "out/gen/header", Owner: "gen", Rule: "g.bootstrap.cp"},
+	}
+	primaryOutputs := []stageOutput{
+		{Path: "out/.bootstrap/bin/builder", Owner: "builder", Rule: "g.bootstrap.link"},
+	}
+	// The records of the main stage are never read, as they may be stale.
+	mainOutputs := []stageOutput{
+		{Path: "out/main", Owner: "main", Rule: "g.bootstrap.cp"},
+	}
+	for stage, outputs := range map[Stage][]stageOutput{
+		StageBootstrap: bootstrapOutputs,
+		StagePrimary:   primaryOutputs,
+		StageMain:      mainOutputs,
+	} {
+		if err := writeStageOutputs(stageOutputsPath(dir, stage), outputs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	outputs := []stageOutput{
+		// The same output of the same rule of the same owner.
+		{Path: "out/.bootstrap/globs/1.glob", Owner: "glob", Rule: "g.bootstrap.glob"},
+		// The Ninja files of the stages are exempt.
+		{Path: filepath.Join(dir, ".bootstrap/build.ninja"), Owner: "bootstrap", Rule: "g.bootstrap.build.ninja"},
+		// Allowed by the policy.
+		{Path: "out/gen/header", Owner: "other", Rule: "g.bootstrap.cp"},
+		// Not declared by an earlier stage.
+		{Path: "out/main", Owner: "other", Rule: "g.bootstrap.cp"},
+
+		{Path: "out/.bootstrap/bin/minibp", Owner: "copy", Rule: "g.bootstrap.cp"},
+		{Path: "out/.bootstrap/bin/builder", Owner: "builder", Rule: "g.bootstrap.cp"},
+		{Path: "out/.bootstrap/bin", Owner: "bin", Rule: "g.bootstrap.cp"},
+		{Path: "out/.bootstrap/bin/minibp/data", Owner: "data", Rule: "g.bootstrap.cp"},
+	}
+	policy := &pathtools.OutputPathPolicy{
+		AllowedCollisions: []string{"out/gen/./header"},
+	}
+
+	errs, err := checkStageOutputs(dir, StageMain, outputs, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		`"copy" in the main stage: invalid output path "out/.bootstrap/bin/minibp": also declared by "minibp" in the bootstrap stage`,
+		`"builder" in the main stage: invalid output path "out/.bootstrap/bin/builder": also declared by "builder" in the primary stage`,
+		`"bin" in the main stage: invalid output path "out/.bootstrap/bin": it is a directory containing "out/.bootstrap/bin/minibp", declared by "minibp" in the bootstrap stage`,
+		`"data" in the main stage: invalid output path "out/.bootstrap/bin/minibp/data": it is inside "out/.bootstrap/bin/minibp", declared as a file by "minibp" in the bootstrap stage`,
+	}
+	var got []string
+	for _, err := range errs {
+		if _, ok := err.(*pathtools.OutputPathError); !ok {
+			t.Errorf("expected a *pathtools.OutputPathError, got %T", err)
+		}
+		got = append(got, err.Error())
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("incorrect collisions:")
+		t.Errorf("  expected: %q", expected)
+		t.Errorf("       got: %q", got)
+	}
+
+	// The primary stage only checks the records of the bootstrap stage.
+	errs, err = checkStageOutputs(dir, StagePrimary, outputs, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 3 {
+		t.Errorf("expected 3 collisions in the primary stage, got %q", errs)
+	}
+
+	errs, err = checkStageOutputs(dir, StageBootstrap, outputs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 0 {
+		t.Errorf("expected no collisions in the bootstrap stage, got %q", errs)
+	}
+}
+
+func TestCheckStageOutputsInvalidRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stage_outputs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := stageOutputsPath(dir, StageBootstrap)
+	if err := os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, []byte("["), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = checkStageOutputs(dir, StagePrimary, nil, nil)
+	if err == nil || !strings.HasPrefix(err.Error(), "error parsing "+file) {
+		t.Errorf("expected a parse error, got %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+)
+
+// subninjasRecordPath returns the path of the file that lists the subninja
+// files written by singletons along with ninjaFile.
+func subninjasRecordPath(ninjaFile string) string {
+	return ninjaFile + ".subninjas"
+}
+
+// removeStaleSubninjas removes the subninja files that an earlier run wrote
+// along with ninjaFile but that are no longer used, and records subninjas for
+// the next run.
+func removeStaleSubninjas(ninjaFile string, subninjas []string) error {
+	recordFile := subninjasRecordPath(ninjaFile)
+
+	var old []string
+	data, err := ioutil.ReadFile(recordFile)
+	if err == nil {
+		// A corrupt record is ignored, and rewritten below.
+		json.Unmarshal(data, &old)
+	} else if !os.IsNotExist(err) {
+		return err
+	} else if len(subninjas) == 0 {
+		return nil
+	}
+
+	current := make(map[string]bool)
+	for _, subninja := range subninjas {
+		current[subninja] = true
+	}
+	for _, subninja := range old {
+		if !current[subninja] {
+			err := os.Remove(subninja)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	if subninjas == nil {
+		subninjas = []string{}
+	}
+	data, err = json.MarshalIndent(subninjas, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(recordFile, append(data, '\n'), 0666)
+}
@@ -0,0 +1,77 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveStaleSubninjas(t *testing.T) {
+	dir, err := ioutil.TempDir("", "subninjas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ninjaFile := filepath.Join(dir, "build.ninja")
+	a := filepath.Join(dir, "a.ninja")
+	b := filepath.Join(dir, "b.ninja")
+
+	exists := func(file string) bool {
+		_, err := os.Stat(file)
+		return err == nil
+	}
+
+	if err := removeStaleSubninjas(ninjaFile, nil); err != nil {
+		t.Fatal(err)
+	}
+	if exists(subninjasRecordPath(ninjaFile)) {
+		t.Errorf("unexpected record without subninjas")
+	}
+
+	steps := []struct {
+		subninjas []string
+		removed   []string
+		kept      []string
+	}{
+		{subninjas: []string{a, b}, kept: []string{a, b}},
+		{subninjas: []string{b}, removed: []string{a}, kept: []string{b}},
+		{subninjas: nil, removed: []string{a, b}},
+	}
+
+	for i, step := range steps {
+		for _, file := range step.subninjas {
+			if err := ioutil.WriteFile(file, nil, 0666); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := removeStaleSubninjas(ninjaFile, step.subninjas); err != nil {
+			t.Fatalf("step %d: %s", i, err)
+		}
+		for _, file := range step.removed {
+			if exists(file) {
+				t.Errorf("step %d: expected %s to be removed", i, file)
+			}
+		}
+		for _, file := range step.kept {
+			if !exists(file) {
+				t.Errorf("step %d: expected %s to be kept", i, file)
+			}
+		}
+	}
+}
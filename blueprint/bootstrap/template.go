@@ -0,0 +1,74 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/google/blueprint"
+)
+
+// The Ninja file of the bootstrap stage, like build.ninja.in, is a template
+// that is checked into the source tree and shared by every build directory.
+// The values of the variables that depend on the build directory or on the
+// host, like the source directory or the path of the Go compiler, are
+// placeholders like @@SrcDir@@, which bootstrap.bash replaces when it copies
+// the template into .minibootstrap/build.ninja.  The later stages are
+// generated in the build directory, and use the values directly.
+
+var templateEnvRegexp = regexp.MustCompile(`^[A-Z_][A-Z0-9_]*$`)
+
+// TemplateVariable returns a Ninja variable in pctx whose value is the
+// placeholder @@<env>@@ in the Ninja file template of the bootstrap stage,
+// which bootstrap.bash replaces with the value of the environment variable
+// env, and the value returned by value in the later stages.  If value is nil
+// the later stages also use the value of env.  bootstrap.bash fails if env is
+// not set or contains a newline, and saves its value in .blueprint.bootstrap
+// so that the bootstrap stage can rerun bootstrap.bash from the wrapper script.
+//
+// Projects that build their own minibp, for example with the minibplib
+// package, use it to add configuration to the rules of the bootstrap stage
+// without changing bootstrap.bash.  env must be made of upper case letters,
+// digits and underscores, and like the methods of PackageContext
+// TemplateVariable must only be called from an init function.
+func TemplateVariable(pctx blueprint.PackageContext, name, env string,
+	value func() string) blueprint.Variable {
+
+	if !templateEnvRegexp.MatchString(env) {
+		panic(fmt.Errorf("invalid environment variable %q for template variable %q", env, name))
+	}
+	if value == nil {
+		value = func() string {
+			return os.Getenv(env)
+		}
+	}
+	return templateVariable(pctx, name, "@@"+env+"@@", value)
+}
+
+// templateVariable returns a Ninja variable in pctx whose value is
+// placeholder in the Ninja file template of the bootstrap stage, and the value
+// returned by value in the later stages.
+func templateVariable(pctx blueprint.PackageContext, name, placeholder string,
+	value func() string) blueprint.Variable {
+
+	return pctx.VariableFunc(name, func(config interface{}) (string, error) {
+		if c, ok := config.(ConfigInterface); ok && c.GeneratingBootstrapper() {
+			return placeholder, nil
+		}
+		return value(), nil
+	})
+}
@@ -0,0 +1,128 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/blueprint"
+)
+
+var (
+	templateTestPctx = blueprint.NewPackageContext("github.com/google/blueprint/bootstrap/template_test")
+
+	_ = TemplateVariable(templateTestPctx, "templateTestValue", "TEMPLATE_TEST_VALUE",
+		func() string { return "value" })
+	_ = TemplateVariable(templateTestPctx, "templateTestEnv", "TEMPLATE_TEST_ENV", nil)
+
+	templateTestRule = templateTestPctx.StaticRule("templateTest",
+		blueprint.RuleParams{
+			Command: "echo $templateTestValue $templateTestEnv > $out",
+		})
+)
+
+type templateTestConfig struct {
+	bootstrap bool
+}
+
+func (c templateTestConfig) GeneratingBootstrapper() bool   { return c.bootstrap }
+func (c templateTestConfig) GeneratingPrimaryBuilder() bool { return !c.bootstrap }
+
+type templateTestSingleton struct{}
+
+func (templateTestSingleton) GenerateBuildActions(ctx blueprint.SingletonContext) {
+	ctx.Build(templateTestPctx, blueprint.BuildParams{
+		Rule:    templateTestRule,
+		Outputs: []string{"out"},
+	})
+}
+
+func runTemplateTest(t *testing.T, config templateTestConfig) string {
+	ctx := blueprint.NewContext()
+	ctx.RegisterSingletonType("template_test", func() blueprint.Singleton {
+		return templateTestSingleton{}
+	})
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": nil,
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) == 0 {
+		errs = ctx.ResolveDependencies(config)
+	}
+	if len(errs) == 0 {
+		_, errs = ctx.PrepareBuildActions(config)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := ctx.WriteBuildFile(buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestTemplateVariable(t *testing.T) {
+	defer setenv(t, "TEMPLATE_TEST_ENV", "from env")()
+
+	testCases := []struct {
+		name      string
+		bootstrap bool
+		value     string
+		env       string
+	}{
+		{
+			name:      "bootstrap stage",
+			bootstrap: true,
+			value:     "@@TEMPLATE_TEST_VALUE@@",
+			env:       "@@TEMPLATE_TEST_ENV@@",
+		},
+		{
+			name:  "later stages",
+			value: "value",
+			env:   "from env",
+		},
+	}
+
+	for _, testCase := range testCases {
+		out := runTemplateTest(t, templateTestConfig{bootstrap: testCase.bootstrap})
+		for _, line := range []string{
+			"templateTestValue = " + testCase.value + "\n",
+			"templateTestEnv = " + testCase.env + "\n",
+		} {
+			if !strings.Contains(out, line) {
+				t.Errorf("%s: expected Ninja file to contain %q, got:\n%s", testCase.name, line, out)
+			}
+		}
+	}
+}
+
+func TestTemplateVariableInvalidEnv(t *testing.T) {
+	for _, env := range []string{"", "lower", "1ST", "A-B", "A B"} {
+		func() {
+			defer func() {
+				r := recover()
+				if err, ok := r.(error); !ok || !strings.Contains(err.Error(), "invalid environment variable") {
+					t.Errorf("%q: expected a panic for an invalid environment variable, got %v", env, r)
+				}
+			}()
+			TemplateVariable(templateTestPctx, "templateTestInvalid", env, nil)
+		}()
+	}
+}
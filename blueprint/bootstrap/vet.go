@@ -0,0 +1,103 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"path/filepath"
+
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/pathtools"
+	"github.com/google/blueprint/proptools"
+)
+
+var (
+	vet = pctx.StaticRule("vet",
+		blueprint.RuleParams{
+			Command:     "$vetCmd $in || $onFailure; touch $out",
+			Description: "vet $pkg",
+		},
+		"vetCmd", "onFailure", "pkg")
+
+	// defaultVetCmd is the command that -vet runs on the sources of each
+	// package without -vet_cmd.
+	defaultVetCmd = "$goRoot/bin/go tool vet"
+)
+
+// vetConfig is the configuration of the -vet, -vet_strict and -vet_cmd flags.
+type vetConfig struct {
+	// enabled is true if the sources of the bootstrap Go packages and binaries
+	// are checked.
+	enabled bool
+
+	// strict is true if findings fail the build instead of only being
+	// printed.
+	strict bool
+
+	// cmd is the command run on the source files of each package, or empty
+	// for defaultVetCmd.
+	cmd string
+}
+
+// flags returns the flags that pass the configuration on to the primary
+// builder invocations, escaped for Ninja and the shell.
+func (c vetConfig) flags() string {
+	var flags string
+	if c.enabled {
+		flags += " -vet"
+	}
+	if c.strict {
+		flags += " -vet_strict"
+	}
+	if c.cmd != "" {
+		flags += " -vet_cmd " + proptools.NinjaAndShellEscape([]string{c.cmd})[0]
+	}
+	return flags
+}
+
+// buildGoVet adds the build statement that runs the vet command on the
+// sources of a package, and returns the file it touches when the command
+// passes, or when it doesn't but -vet_strict is not set.
+func buildGoVet(ctx blueprint.ModuleContext, config vetConfig, pkgPath string,
+	srcs, genSrcs []string) []string {
+
+	if !config.enabled || len(srcs)+len(genSrcs) == 0 {
+		return nil
+	}
+
+	vetPassed := filepath.Join(bootstrapDir, ctx.ModuleName(), "vet.passed")
+
+	cmd := defaultVetCmd
+	if config.cmd != "" {
+		cmd = proptools.NinjaEscape([]string{config.cmd})[0]
+	}
+
+	onFailure := "true"
+	if config.strict {
+		onFailure = "exit 1"
+	}
+
+	ctx.Build(pctx, blueprint.BuildParams{
+		Rule:    vet,
+		Outputs: []string{vetPassed},
+		Inputs:  append(pathtools.PrefixPaths(srcs, moduleSrcDir(ctx)), genSrcs...),
+		Args: map[string]string{
+			"vetCmd":    cmd,
+			"onFailure": onFailure,
+			"pkg":       pkgPath,
+		},
+	})
+
+	return []string{vetPassed}
+}
@@ -0,0 +1,359 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// A wrapperStage describes one ninja invocation of the wrapper scripts.  The
+// stages are listed in the order the wrapper scripts run them, and every
+// wrapper script is generated from this list so that the stage logic only
+// lives in one place.
+type wrapperStage struct {
+	// Name is the name of the stage, as returned by Stage.String.
+	Name string
+
+	// Comment describes the stage in the generated script.
+	Comment string
+
+	// NinjaFile is the path of the stage's Ninja file, relative to the build
+	// directory, using forward slashes.
+	NinjaFile string
+
+	// ArgsVar is the environment variable holding extra ninja arguments for
+	// the stage.
+	ArgsVar string
+
+	// Main is set for the last stage, which receives the arguments passed to
+	// the wrapper script and can be skipped with SKIP_NINJA.
+	Main bool
+}
+
+var wrapperStages = []wrapperStage{
+	{
+		Name:      "bootstrap",
+		Comment:   "Build minibp and the primary build.ninja",
+		NinjaFile: ".minibootstrap/build.ninja",
+		ArgsVar:   "MINIBOOTSTRAP_NINJA_ARGS",
+	},
+	{
+		Name:      "primary",
+		Comment:   "Build the primary builder and the main build.ninja",
+		NinjaFile: ".bootstrap/build.ninja",
+		ArgsVar:   "BOOTSTRAP_NINJA_ARGS",
+	},
+	{
+		Name:      "main",
+		Comment:   "SKIP_NINJA can be used by wrappers that wish to run ninja themselves.",
+		NinjaFile: "build.ninja",
+		ArgsVar:   "NINJA_ARGS",
+		Main:      true,
+	},
+}
+
+// A wrapperScript is a template for a wrapper script for one shell.
+type wrapperScript struct {
+	name string
+	tmpl *template.Template
+}
+
+var wrapperFuncs = template.FuncMap{
+	"winpath": func(s string) string {
+		return strings.Replace(s, "/", `\`, -1)
+	},
+}
+
+var (
+	bashWrapper = wrapperScript{"blueprint.bash",
+		template.Must(template.New("blueprint.bash").Funcs(wrapperFuncs).Parse(bashWrapperTemplate))}
+	ps1Wrapper = wrapperScript{"blueprint.ps1",
+		template.Must(template.New("blueprint.ps1").Funcs(wrapperFuncs).Parse(ps1WrapperTemplate))}
+	cmdWrapper = wrapperScript{"blueprint.cmd",
+		template.Must(template.New("blueprint.cmd").Funcs(wrapperFuncs).Parse(cmdWrapperTemplate))}
+)
+
+// wrapperScriptsForOS returns the wrapper scripts that are appropriate for
+// running builds on the given GOOS.  Windows gets a PowerShell script, along
+// with a cmd shim that runs it, and every other OS gets the bash script.
+func wrapperScriptsForOS(goos string) []wrapperScript {
+	if goos == "windows" {
+		return []wrapperScript{ps1Wrapper, cmdWrapper}
+	}
+	return []wrapperScript{bashWrapper}
+}
+
+// writeWrapperScripts writes the wrapper scripts for goos into dir.  Scripts
+// are only rewritten if their contents changed, so that their timestamps can
+// be used in restat rules.
+func writeWrapperScripts(dir, goos string) error {
+	for _, script := range wrapperScriptsForOS(goos) {
+		buf := &bytes.Buffer{}
+		err := script.tmpl.Execute(buf, wrapperStages)
+		if err != nil {
+			return fmt.Errorf("error generating %s: %s", script.name, err)
+		}
+
+		file := filepath.Join(dir, script.name)
+		if old, err := ioutil.ReadFile(file); err == nil && bytes.Equal(old, buf.Bytes()) {
+			continue
+		}
+
+		perm := os.FileMode(0666)
+		if filepath.Ext(script.name) == ".bash" {
+			perm = 0777
+		}
+		err = ioutil.WriteFile(file, buf.Bytes(), perm)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const bashWrapperTemplate = `#!/bin/bash
+
+# This file is generated by minibp -wrappers from bootstrap/wrapper.go, do not
+# edit it directly.
+
+# This script is intented to wrap the execution of ninja so that we
+# can do some checks before each ninja run.
+#
+# It can either be run with a standalone Blueprint checkout to generate
+# the minibp binary, or can be used by another script as part of a custom
+# Blueprint-based build system. When used by another script, the following
+# environment variables can be set to configure this script, which are
+# documented below:
+#
+#   BUILDDIR
+#   SKIP_NINJA
+#   FAILURE_REPORT
+{{- range .}}
+#   {{.ArgsVar}}
+{{- end}}
+#
+# When run in a standalone Blueprint checkout, bootstrap.bash will install
+# this script into the $BUILDDIR, where it may be executed.
+#
+# For embedding into a custom build system, the current directory when this
+# script executes should be the same directory that $BOOTSTRAP should be
+# called from.
+
+set -e
+
+# BUILDDIR should be set to the path to store build results. By default,
+# this is the directory containing this script, but can be set explicitly
+# if the custom build system only wants to install their own wrapper.
+[ -z "$BUILDDIR" ] && BUILDDIR=` + "`" + `dirname "${BASH_SOURCE[0]}"` + "`" + `
+
+# NINJA should be set to the path of the ninja executable. By default, this
+# is just "ninja", and will be looked up in $PATH.
+[ -z "$NINJA" ] && NINJA=ninja
+
+# check_ninja_args verifies that the extra arguments for a ninja invocation
+# only change how ninja builds (-j, -k, -l, -d, -w, -v, ...), and not which
+# manifest it reads or whether it builds at all.
+check_ninja_args() {
+    local name="$1"
+    shift
+    for arg in "$@"; do
+        case "$arg" in
+            -f*|-C*|-t*|-n*|-h|--help|--version)
+                echo "Unsupported ninja argument \"$arg\" in $name" >&2
+                exit 1
+                ;;
+        esac
+    done
+}
+
+# FAILURE_REPORT can be set to the path of a JSON file to write a report of
+# the failed build statements to when a ninja invocation fails, for continuous
+# integration systems.  The output of ninja is then also written to
+# .ninja-<stage>.log in $BUILDDIR, with the default NINJA_STATUS.
+#
+# run_ninja runs ninja for the stage named by its first argument.
+run_ninja() {
+    local stage="$1"
+    shift
+    if [ -z "$FAILURE_REPORT" ]; then
+        "${NINJA}" "$@"
+        return
+    fi
+
+    local log="${BUILDDIR}/.ninja-${stage}.log"
+    NINJA_STATUS="[%f/%t] " "${NINJA}" "$@" 2>&1 | tee "$log"
+    local status=${PIPESTATUS[0]}
+    if [ $status -ne 0 ]; then
+        "${BUILDDIR}/.bootstrap/bin/minibp" -b "${BUILDDIR}" -failure_report "${FAILURE_REPORT}" \
+            -failure_stage "$stage" "$log" || true
+        exit $status
+    fi
+}
+[ -n "$FAILURE_REPORT" ] && rm -f "$FAILURE_REPORT"
+
+if [ ! -f "${BUILDDIR}/.blueprint.bootstrap" ]; then
+    echo "Please run bootstrap.bash (.blueprint.bootstrap missing)" >&2
+    exit 1
+fi
+
+# .blueprint.bootstrap provides saved values from the bootstrap.bash script:
+#
+#   BOOTSTRAP
+#   BOOTSTRAP_MANIFEST
+#
+# It may also provide defaults for the per-stage ninja arguments, which are
+# only used if the variables are unset in the environment:
+#
+{{- range .}}
+#   {{.ArgsVar}}
+{{- end}}
+#
+source "${BUILDDIR}/.blueprint.bootstrap"
+
+# MINIBOOTSTRAP_NINJA_ARGS, BOOTSTRAP_NINJA_ARGS and NINJA_ARGS are extra
+# arguments passed to the ninja invocations of the bootstrap, primary and main
+# stages, for example "-j 4 -k 0 -d explain".  Arguments passed to this script
+# are passed to the main stage after NINJA_ARGS.
+{{- range .}}
+check_ninja_args {{.ArgsVar}} ${ {{- .ArgsVar -}} }
+{{- end}}
+
+GEN_BOOTSTRAP_MANIFEST="${BUILDDIR}/.minibootstrap/build.ninja.in"
+if [ -f "${GEN_BOOTSTRAP_MANIFEST}" ]; then
+    if [ "${BOOTSTRAP_MANIFEST}" -nt "${GEN_BOOTSTRAP_MANIFEST}" ]; then
+        "${BOOTSTRAP}" -i "${BOOTSTRAP_MANIFEST}"
+    fi
+else
+    "${BOOTSTRAP}" -i "${BOOTSTRAP_MANIFEST}"
+fi
+{{range .}}
+# {{.Comment}}
+{{- if .Main}}
+if [ -z "$SKIP_NINJA" ]; then
+    run_ninja {{.Name}} -w dupbuild=err ${ {{- .ArgsVar -}} } -f "${BUILDDIR}/{{.NinjaFile}}" "$@"
+else
+    exit 0
+fi
+{{- else}}
+run_ninja {{.Name}} -w dupbuild=err ${ {{- .ArgsVar -}} } -f "${BUILDDIR}/{{.NinjaFile}}"
+{{end}}
+{{- end}}
+`
+
+const ps1WrapperTemplate = `# This file is generated by minibp -wrappers from bootstrap/wrapper.go, do not
+# edit it directly.
+
+# This script is the PowerShell equivalent of blueprint.bash, wrapping the
+# execution of ninja so that we can do some checks before each ninja run.  It
+# reads the same environment variables:
+#
+#   BUILDDIR
+#   SKIP_NINJA
+#   NINJA
+{{- range .}}
+#   {{.ArgsVar}}
+{{- end}}
+#
+# The bootstrap script is still a bash script, and is run with the bash found
+# in $PATH.
+
+$ErrorActionPreference = "Stop"
+
+$BuildDir = $env:BUILDDIR
+if (-not $BuildDir) { $BuildDir = $PSScriptRoot }
+
+$Ninja = $env:NINJA
+if (-not $Ninja) { $Ninja = "ninja" }
+
+function Split-NinjaArgs($Name, $Value) {
+    $result = @()
+    if ($Value) { $result = @($Value -split '\s+' | Where-Object { $_ }) }
+    foreach ($arg in $result) {
+        if ($arg -match '^(-f|-C|-t|-n)' -or $arg -in @("-h", "--help", "--version")) {
+            [Console]::Error.WriteLine("Unsupported ninja argument ""$arg"" in $Name")
+            exit 1
+        }
+    }
+    return ,$result
+}
+
+function Invoke-Checked($Exe) {
+    & $Exe @args
+    if ($LASTEXITCODE -ne 0) { exit $LASTEXITCODE }
+}
+
+$BootstrapFile = Join-Path $BuildDir ".blueprint.bootstrap"
+if (-not (Test-Path $BootstrapFile)) {
+    [Console]::Error.WriteLine("Please run bootstrap.bash (.blueprint.bootstrap missing)")
+    exit 1
+}
+
+# .blueprint.bootstrap is written by bootstrap.bash as bash assignments, either
+# NAME="value", or : ${NAME="value"} for defaults that are only used if the
+# variable is unset in the environment.
+$Saved = @{}
+foreach ($line in Get-Content $BootstrapFile) {
+    if ($line -match '^(\w+)="(.*)"$') {
+        $Saved[$Matches[1]] = $Matches[2]
+    } elseif ($line -match '^: \$\{(\w+)="(.*)"\}$') {
+        if ($null -eq [Environment]::GetEnvironmentVariable($Matches[1])) {
+            $Saved[$Matches[1]] = $Matches[2]
+        }
+    }
+}
+
+function Get-Setting($Name) {
+    if ($Saved.ContainsKey($Name)) { return $Saved[$Name] }
+    return [Environment]::GetEnvironmentVariable($Name)
+}
+
+$Bootstrap = Get-Setting "BOOTSTRAP"
+$BootstrapManifest = Get-Setting "BOOTSTRAP_MANIFEST"
+{{range .}}
+${{.ArgsVar}} = Split-NinjaArgs "{{.ArgsVar}}" (Get-Setting "{{.ArgsVar}}")
+{{- end}}
+
+$GenBootstrapManifest = Join-Path $BuildDir ".minibootstrap\build.ninja.in"
+if (-not (Test-Path $GenBootstrapManifest) -or
+    (Get-Item $BootstrapManifest).LastWriteTime -gt (Get-Item $GenBootstrapManifest).LastWriteTime) {
+    Invoke-Checked bash $Bootstrap -i $BootstrapManifest
+}
+{{range .}}
+# {{.Comment}}
+{{- if .Main}}
+if (-not $env:SKIP_NINJA) {
+    Invoke-Checked $Ninja -w dupbuild=err @{{.ArgsVar}} -f (Join-Path $BuildDir "{{winpath .NinjaFile}}") @args
+}
+{{- else}}
+Invoke-Checked $Ninja -w dupbuild=err @{{.ArgsVar}} -f (Join-Path $BuildDir "{{winpath .NinjaFile}}")
+{{end}}
+{{- end}}
+exit 0
+`
+
+const cmdWrapperTemplate = `@echo off
+rem This file is generated by minibp -wrappers from bootstrap/wrapper.go, do not
+rem edit it directly.
+
+rem Runs blueprint.ps1 from the same directory, for use from cmd.exe.
+powershell -NoProfile -ExecutionPolicy Bypass -File "%~dp0blueprint.ps1" %*
+exit /b %ERRORLEVEL%
+`
@@ -57,3 +57,37 @@ func writeDocs(ctx *blueprint.Context, srcDir, filename string) error {
 
 	return bpdoc.Write(filename, pkgFiles, ctx.ModuleTypePropertyStructs())
 }
+
+// documentPropertyErrors fills in the documentation of the properties that the
+// blueprint.PropertyUnpackErrors in errs refer to, from the sources of the Go
+// packages defined by the modules that were parsed successfully.  Properties
+// whose property structs can't be found are left undocumented.
+func documentPropertyErrors(ctx *blueprint.Context, srcDir string, errs []error) {
+	var propErrs []*blueprint.PropertyUnpackError
+	for _, err := range errs {
+		if propErr, ok := err.(*blueprint.PropertyUnpackError); ok && propErr.DocumentedProperty() != "" {
+			propErrs = append(propErrs, propErr)
+		}
+	}
+	if len(propErrs) == 0 {
+		return
+	}
+
+	pkgFiles := make(map[string][]string)
+	ctx.VisitAllModulesIf(isGoPackageProducer, func(module blueprint.Module) {
+		if m, ok := module.(*goPackage); ok {
+			pkgFiles[m.properties.PkgPath] = pathtools.PrefixPaths(m.properties.Srcs,
+				filepath.Join(srcDir, ctx.ModuleDir(m)))
+		}
+	})
+
+	c := bpdoc.NewContext(pkgFiles)
+	moduleTypePropertyStructs := ctx.ModuleTypePropertyStructs()
+	for _, propErr := range propErrs {
+		property, err := c.ModuleTypeProperty(propErr.ModuleType,
+			moduleTypePropertyStructs[propErr.ModuleType], propErr.DocumentedProperty())
+		if err == nil && property != nil {
+			propErr.Doc = property.Text
+		}
+	}
+}
@@ -0,0 +1,554 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// bpbisect runs two versions of a primary builder on the same tree and
+// compares the module graphs and Ninja files they generate, to find the
+// modules and build statements whose build logic changed, for example when
+// updating blueprint or refactoring a mutator.  Both primary builders must
+// support the -module_graph flag of the bootstrap package, unless
+// -module_graph=false is passed.  It exits with status 1 if the outputs
+// differ.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var (
+	buildDir    = flag.String("b", "", "the build directory passed to both primary builders, a temporary directory if empty")
+	keep        = flag.Bool("keep", false, "keep the temporary directory with the generated files")
+	maxDiffs    = flag.Int("max_diffs", 10, "maximum number of changed modules and build statements to print in full")
+	moduleGraph = flag.Bool("module_graph", true, "compare the module graphs written with -module_graph")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: bpbisect [flags] <old primary builder> <new primary builder> <Blueprints file> [-- <primary builder flags>]\n")
+	flag.PrintDefaults()
+}
+
+func errorf(format string, args ...interface{}) int {
+	fmt.Fprintf(os.Stderr, "bpbisect: "+format+"\n", args...)
+	return 2
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	os.Exit(run())
+}
+
+// run compares the outputs of the primary builders and returns the exit
+// status, so that the deferred cleanup runs before main exits.
+func run() int {
+	args := flag.Args()
+	var builderArgs []string
+	for i, arg := range args {
+		if arg == "--" {
+			args, builderArgs = args[:i], args[i+1:]
+			break
+		}
+	}
+	if len(args) != 3 {
+		usage()
+		return 2
+	}
+	oldBuilder, newBuilder, blueprintsFile := args[0], args[1], args[2]
+
+	tmpDir, err := ioutil.TempDir("", "bpbisect")
+	if err != nil {
+		return errorf("%s", err)
+	}
+	if *keep {
+		fmt.Fprintf(os.Stderr, "bpbisect: keeping the generated files in %s\n", tmpDir)
+	} else {
+		defer os.RemoveAll(tmpDir)
+	}
+
+	dir := *buildDir
+	if dir == "" {
+		dir = filepath.Join(tmpDir, "out")
+	}
+
+	oldResult, err := generate(oldBuilder, "old", tmpDir, dir, blueprintsFile, builderArgs)
+	if err != nil {
+		return errorf("%s", err)
+	}
+	newResult, err := generate(newBuilder, "new", tmpDir, dir, blueprintsFile, builderArgs)
+	if err != nil {
+		return errorf("%s", err)
+	}
+
+	differ := false
+	if *moduleGraph {
+		differ = compareModuleGraphs(os.Stdout, oldResult.modules, newResult.modules) || differ
+	}
+	ninjaDiffer, err := compareNinjaFiles(os.Stdout, oldResult.ninja, newResult.ninja, tmpDir)
+	if err != nil {
+		return errorf("%s", err)
+	}
+
+	if !differ && !ninjaDiffer {
+		fmt.Println("no differences")
+		return 0
+	}
+	return 1
+}
+
+// A result is the output of a primary builder.
+type result struct {
+	modules []graphModule
+	ninja   *ninjaFile
+}
+
+// generate runs the primary builder, with its outputs named after version in
+// tmpDir.
+func generate(builder, version, tmpDir, buildDir, blueprintsFile string, builderArgs []string) (*result, error) {
+	ninjaFile := filepath.Join(tmpDir, version+".ninja")
+	graphFile := filepath.Join(tmpDir, version+".graph.json")
+
+	args := []string{"-b", buildDir, "-o", ninjaFile}
+	if *moduleGraph {
+		args = append(args, "-module_graph", graphFile)
+	}
+	args = append(append(args, builderArgs...), blueprintsFile)
+
+	cmd := exec.Command(builder, args...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s primary builder %s failed: %s", version, builder, err)
+	}
+
+	ret := &result{}
+	var err error
+	if *moduleGraph {
+		ret.modules, err = readModuleGraph(graphFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	ret.ninja, err = readNinjaFile(ninjaFile)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// readModuleGraph reads a file written with -module_graph.
+func readModuleGraph(file string) ([]graphModule, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var modules []graphModule
+	if err := json.Unmarshal(data, &modules); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	return modules, nil
+}
+
+// readNinjaFile reads and parses a Ninja file written by a primary builder.
+func readNinjaFile(file string) (*ninjaFile, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ret, err := parseNinjaFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	return ret, nil
+}
+
+// A graphModule is a module variant in the -module_graph file.
+type graphModule struct {
+	Name      string     `json:"name"`
+	Variant   string     `json:"variant,omitempty"`
+	Type      string     `json:"type"`
+	Blueprint string     `json:"blueprint"`
+	Deps      []graphDep `json:"deps,omitempty"`
+}
+
+type graphDep struct {
+	Name    string `json:"name"`
+	Variant string `json:"variant,omitempty"`
+}
+
+func variantID(name, variant string) string {
+	return name + "{" + variant + "}"
+}
+
+// compareModuleGraphs prints the module variants that were added, removed or
+// changed to w, and returns true if there are any.
+func compareModuleGraphs(w io.Writer, oldModules, newModules []graphModule) bool {
+	oldByID := make(map[string]graphModule)
+	for _, m := range oldModules {
+		oldByID[variantID(m.Name, m.Variant)] = m
+	}
+
+	var added, removed, changed []string
+	var details []string
+	newIDs := make(map[string]bool)
+	for _, m := range newModules {
+		id := variantID(m.Name, m.Variant)
+		newIDs[id] = true
+		old, ok := oldByID[id]
+		if !ok {
+			added = append(added, id)
+			continue
+		}
+		if diff := moduleDiff(old, m); diff != "" {
+			changed = append(changed, id)
+			details = append(details, fmt.Sprintf("%s: %s", id, diff))
+		}
+	}
+	for _, m := range oldModules {
+		if id := variantID(m.Name, m.Variant); !newIDs[id] {
+			removed = append(removed, id)
+		}
+	}
+
+	fmt.Fprintf(w, "module graph: %d added, %d removed, %d changed module variants\n",
+		len(added), len(removed), len(changed))
+	printList(w, "added", added)
+	printList(w, "removed", removed)
+	printList(w, "changed", details)
+
+	return len(added)+len(removed)+len(changed) > 0
+}
+
+// moduleDiff describes the differences between two versions of a module
+// variant, or returns "" if there are none.
+func moduleDiff(old, new graphModule) string {
+	var diffs []string
+	if old.Type != new.Type {
+		diffs = append(diffs, fmt.Sprintf("type %s -> %s", old.Type, new.Type))
+	}
+	if old.Blueprint != new.Blueprint {
+		diffs = append(diffs, fmt.Sprintf("Blueprints file %s -> %s", old.Blueprint, new.Blueprint))
+	}
+	if !reflect.DeepEqual(old.Deps, new.Deps) {
+		oldDeps := make(map[string]bool)
+		for _, dep := range old.Deps {
+			oldDeps[variantID(dep.Name, dep.Variant)] = true
+		}
+		newDeps := make(map[string]bool)
+		var depDiffs []string
+		for _, dep := range new.Deps {
+			id := variantID(dep.Name, dep.Variant)
+			newDeps[id] = true
+			if !oldDeps[id] {
+				depDiffs = append(depDiffs, "+"+id)
+			}
+		}
+		for _, dep := range old.Deps {
+			if id := variantID(dep.Name, dep.Variant); !newDeps[id] {
+				depDiffs = append(depDiffs, "-"+id)
+			}
+		}
+		if len(depDiffs) == 0 {
+			depDiffs = append(depDiffs, "reordered")
+		}
+		diffs = append(diffs, "deps "+strings.Join(depDiffs, " "))
+	}
+	return strings.Join(diffs, ", ")
+}
+
+// printList prints the first -max_diffs entries of list under a heading to w.
+func printList(w io.Writer, heading string, list []string) {
+	if len(list) == 0 {
+		return
+	}
+	fmt.Fprintf(w, " %s:\n", heading)
+	for i, entry := range list {
+		if i == *maxDiffs {
+			fmt.Fprintf(w, "  ... and %d more\n", len(list)-i)
+			break
+		}
+		fmt.Fprintln(w, "  "+strings.TrimLeft(entry, " "))
+	}
+}
+
+// A ninjaFile is the parsed text of a Ninja file, without its comments.
+type ninjaFile struct {
+	// variables are the values of the top-level variables by name.
+	variables map[string]string
+
+	// rules are the definitions of the rules and pools by "rule <name>"
+	// or "pool <name>".
+	rules map[string]*ninjaBlock
+
+	// builds are the build statements by the text of their outputs, in the
+	// order of the file.
+	builds     map[string]*ninjaBlock
+	buildOrder []string
+}
+
+// A ninjaBlock is the text of a rule, pool or build statement including its
+// indented variables.
+type ninjaBlock struct {
+	// owner is the module variant or singleton whose section of the
+	// Ninja file contains the block.
+	owner string
+	text  string
+}
+
+// parseNinjaFile splits a Ninja file into its top-level variables, rules,
+// pools and build statements.  Lines continued with a trailing $ are joined,
+// so that differences in line wrapping are ignored.  The owners of the build
+// statements are read from the comments that blueprint writes at the start of
+// the section of each module variant and singleton.
+func parseNinjaFile(r io.Reader) (*ninjaFile, error) {
+	f := &ninjaFile{
+		variables: make(map[string]string),
+		rules:     make(map[string]*ninjaBlock),
+		builds:    make(map[string]*ninjaBlock),
+	}
+
+	owner, module := "", ""
+	var block *ninjaBlock
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16*1024*1024)
+	var line string
+	for scanner.Scan() {
+		// Long lines are continued on the next line after a trailing $.
+		text := scanner.Text()
+		if line != "" {
+			text = strings.TrimLeft(text, " ")
+		}
+		if dollars := len(text) - len(strings.TrimRight(text, "$")); dollars%2 == 1 {
+			line += text[:len(text)-1]
+			continue
+		}
+		line += text
+		text, line = line, ""
+
+		switch {
+		case strings.HasPrefix(text, "# Module:"):
+			module = strings.TrimSpace(strings.TrimPrefix(text, "# Module:"))
+			owner = "module " + module
+		case strings.HasPrefix(text, "# Variant:"):
+			if variant := strings.TrimSpace(strings.TrimPrefix(text, "# Variant:")); variant != "" {
+				owner = "module " + variantID(module, variant)
+			}
+		case strings.HasPrefix(text, "# Singleton:"):
+			owner = "singleton " + strings.TrimSpace(strings.TrimPrefix(text, "# Singleton:"))
+		case text == "", text[0] == '#':
+		case text[0] == ' ':
+			if block != nil {
+				block.text += "\n" + text
+			}
+		case strings.HasPrefix(text, "build "):
+			outputs := ninjaBuildOutputs(strings.TrimPrefix(text, "build "))
+			if _, ok := f.builds[outputs]; !ok {
+				f.buildOrder = append(f.buildOrder, outputs)
+			}
+			block = &ninjaBlock{owner: owner, text: text}
+			f.builds[outputs] = block
+		case strings.HasPrefix(text, "rule "), strings.HasPrefix(text, "pool "):
+			block = &ninjaBlock{owner: owner, text: text}
+			f.rules[strings.TrimSpace(text)] = block
+		default:
+			block = nil
+			if i := strings.Index(text, " = "); i > 0 && !strings.ContainsAny(text[:i], " $") {
+				f.variables[text[:i]] = text[i+3:]
+			}
+		}
+	}
+
+	return f, scanner.Err()
+}
+
+// ninjaBuildOutputs returns the text of the outputs of a build statement,
+// without the "build " keyword, up to the first unescaped colon.
+func ninjaBuildOutputs(s string) string {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '$':
+			i++
+		case ':':
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// A buildChange is a build statement that was added, removed or changed.
+type buildChange struct {
+	outputs  string
+	owner    string
+	old, new *ninjaBlock
+}
+
+// compareNinjaFiles prints the top-level variables, rules and pools that
+// changed, and the build statements that were added, removed or changed,
+// grouped by the module variant or singleton that owns them, to w, and returns
+// true if there are any.  The first -max_diffs changed build statements are printed
+// as unified diffs, starting with the first module variant or singleton that
+// diverges.
+func compareNinjaFiles(w io.Writer, oldFile, newFile *ninjaFile, tmpDir string) (bool, error) {
+	var variables []string
+	for name, value := range newFile.variables {
+		if oldValue, ok := oldFile.variables[name]; !ok {
+			variables = append(variables, "+"+name)
+		} else if oldValue != value {
+			variables = append(variables, name)
+		}
+	}
+	for name := range oldFile.variables {
+		if _, ok := newFile.variables[name]; !ok {
+			variables = append(variables, "-"+name)
+		}
+	}
+	sort.Strings(variables)
+
+	var rules []string
+	for name, rule := range newFile.rules {
+		if oldRule, ok := oldFile.rules[name]; !ok {
+			rules = append(rules, "+"+name)
+		} else if oldRule.text != rule.text {
+			rules = append(rules, name)
+		}
+	}
+	for name := range oldFile.rules {
+		if _, ok := newFile.rules[name]; !ok {
+			rules = append(rules, "-"+name)
+		}
+	}
+	sort.Strings(rules)
+
+	var changes []buildChange
+	for _, outputs := range newFile.buildOrder {
+		b := newFile.builds[outputs]
+		old := oldFile.builds[outputs]
+		if old == nil || old.text != b.text || old.owner != b.owner {
+			changes = append(changes, buildChange{outputs, b.owner, old, b})
+		}
+	}
+	for _, outputs := range oldFile.buildOrder {
+		if newFile.builds[outputs] == nil {
+			old := oldFile.builds[outputs]
+			changes = append(changes, buildChange{outputs, old.owner, old, nil})
+		}
+	}
+
+	// Group the build statements by owner, in the order in which the owners
+	// first diverge.
+	var owners []string
+	byOwner := make(map[string][]buildChange)
+	added, removed := 0, 0
+	for _, change := range changes {
+		if _, ok := byOwner[change.owner]; !ok {
+			owners = append(owners, change.owner)
+		}
+		byOwner[change.owner] = append(byOwner[change.owner], change)
+		if change.old == nil {
+			added++
+		} else if change.new == nil {
+			removed++
+		}
+	}
+
+	fmt.Fprintf(w, "ninja file: %d added, %d removed, %d changed build statements in %d module variants and singletons\n",
+		added, removed, len(changes)-added-removed, len(owners))
+	printList(w, "changed variables", variables)
+	printList(w, "changed rules and pools", rules)
+	if len(owners) == 0 {
+		return len(variables)+len(rules) > 0, nil
+	}
+
+	fmt.Fprintf(w, "first divergence: %s\n", ownerName(owners[0]))
+	printed := 0
+	for _, owner := range owners {
+		fmt.Fprintf(w, "\n%s: %d build statements differ\n", ownerName(owner), len(byOwner[owner]))
+		for _, change := range byOwner[owner] {
+			if printed == *maxDiffs {
+				continue
+			}
+			printed++
+			switch {
+			case change.old == nil:
+				fmt.Fprintf(w, "+%s\n", strings.Replace(change.new.text, "\n", "\n+", -1))
+			case change.new == nil:
+				fmt.Fprintf(w, "-%s\n", strings.Replace(change.old.text, "\n", "\n-", -1))
+			default:
+				if change.old.owner != change.new.owner {
+					fmt.Fprintf(w, "%s: moved from %s\n", change.outputs, ownerName(change.old.owner))
+				}
+				if change.old.text != change.new.text {
+					data, err := diff(tmpDir, change.old.text, change.new.text)
+					if err != nil {
+						return true, fmt.Errorf("computing diff: %s", err)
+					}
+					w.Write(data)
+				}
+			}
+		}
+	}
+	if printed < len(changes) {
+		fmt.Fprintf(w, "\n... %d more build statements differ, see -max_diffs\n", len(changes)-printed)
+	}
+
+	return true, nil
+}
+
+// ownerName returns the name of the owner of a build statement, which is
+// empty for the build statements at the start of the Ninja file.
+func ownerName(owner string) string {
+	if owner == "" {
+		return "the header of the Ninja file"
+	}
+	return owner
+}
+
+// diff returns the unified diff between the old and new text of a build
+// statement.
+func diff(tmpDir, old, new string) (data []byte, err error) {
+	f1, err := ioutil.TempFile(tmpDir, "old")
+	if err != nil {
+		return
+	}
+	defer os.Remove(f1.Name())
+	defer f1.Close()
+
+	f2, err := ioutil.TempFile(tmpDir, "new")
+	if err != nil {
+		return
+	}
+	defer os.Remove(f2.Name())
+	defer f2.Close()
+
+	f1.WriteString(old + "\n")
+	f2.WriteString(new + "\n")
+
+	data, err = exec.Command("diff", "-u", "-L", "old", "-L", "new", f1.Name(), f2.Name()).CombinedOutput()
+	if len(data) > 0 {
+		// diff exits with a non-zero status when the files don't match.
+		// Ignore that failure as long as we get output.
+		err = nil
+	}
+	return
+}
@@ -0,0 +1,244 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseNinjaFile(t *testing.T) {
+	f, err := readNinjaFile("testdata/old.ninja")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedVariables := map[string]string{
+		"ninja_required_version": "1.7.0",
+		"g.bootstrap.buildDir":   "out",
+		"g.bootstrap.goRoot":     "/usr/lib/go",
+		"g.example.removed":      "true",
+	}
+	if !reflect.DeepEqual(f.variables, expectedVariables) {
+		t.Errorf("incorrect variables:")
+		t.Errorf("  expected: %v", expectedVariables)
+		t.Errorf("       got: %v", f.variables)
+	}
+
+	expectedRule := "rule g.example.cc\n    command = cc -c ${in} -o ${out} ${cflags}"
+	if rule := f.rules["rule g.example.cc"]; rule == nil || rule.text != expectedRule {
+		t.Errorf("expected rule g.example.cc to be %q, got %v", expectedRule, rule)
+	}
+
+	expectedOrder := []string{
+		"${g.bootstrap.buildDir}/build.ninja",
+		"${g.bootstrap.buildDir}/libfoo/foo.o",
+		"${g.bootstrap.buildDir}/libfoo/libfoo.a",
+		"${g.bootstrap.buildDir}/libbar/bar.o",
+		"${g.bootstrap.buildDir}/libbar/old.o",
+		"${g.bootstrap.buildDir}/libbar/a$:b.o",
+		"all",
+	}
+	if !reflect.DeepEqual(f.buildOrder, expectedOrder) {
+		t.Errorf("incorrect build statements:")
+		t.Errorf("  expected: %q", expectedOrder)
+		t.Errorf("       got: %q", f.buildOrder)
+	}
+
+	expectedBuilds := map[string]ninjaBlock{
+		"${g.bootstrap.buildDir}/build.ninja": {
+			owner: "",
+			text:  "build ${g.bootstrap.buildDir}/build.ninja: g.bootstrap.cp Blueprints",
+		},
+		"${g.bootstrap.buildDir}/libfoo/foo.o": {
+			owner: "module libfoo{arm}",
+			text:  "build ${g.bootstrap.buildDir}/libfoo/foo.o: g.example.cc foo.c\n    cflags = -O2",
+		},
+		"${g.bootstrap.buildDir}/libfoo/libfoo.a": {
+			owner: "module libfoo{arm}",
+			text:  "build ${g.bootstrap.buildDir}/libfoo/libfoo.a: g.bootstrap.cp ${g.bootstrap.buildDir}/libfoo/foo.o",
+		},
+		"${g.bootstrap.buildDir}/libbar/bar.o": {
+			owner: "module libbar",
+			text:  "build ${g.bootstrap.buildDir}/libbar/bar.o: g.example.cc bar.c",
+		},
+		"all": {
+			owner: "singleton phony",
+			text:  "build all: phony ${g.bootstrap.buildDir}/libfoo/libfoo.a",
+		},
+	}
+	for outputs, expected := range expectedBuilds {
+		if b := f.builds[outputs]; b == nil || *b != expected {
+			t.Errorf("expected build statement for %q to be %+v, got %+v", outputs, expected, b)
+		}
+	}
+}
+
+func TestNinjaBuildOutputs(t *testing.T) {
+	testCases := []struct {
+		in, out string
+	}{
+		{"a b: rule c", "a b"},
+		{"a$:b: rule c", "a$:b"},
+		{"a$$: rule c", "a$$"},
+		{"a$ b$:: rule", "a$ b$:"},
+		{"no colon", "no colon"},
+	}
+	for _, testCase := range testCases {
+		if out := ninjaBuildOutputs(testCase.in); out != testCase.out {
+			t.Errorf("ninjaBuildOutputs(%q): expected %q, got %q", testCase.in, testCase.out, out)
+		}
+	}
+}
+
+func TestCompareModuleGraphs(t *testing.T) {
+	oldModules, err := readModuleGraph("testdata/old.graph.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newModules, err := readModuleGraph("testdata/new.graph.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if !compareModuleGraphs(buf, oldModules, newModules) {
+		t.Error("expected the module graphs to differ")
+	}
+	expected := `module graph: 2 added, 1 removed, 3 changed module variants
+ added:
+  libfoo{x86}
+  libnew{arm}
+ removed:
+  libold{}
+ changed:
+  libbar{}: deps reordered
+  libbase{}: type example_library -> example_static_library, Blueprints file Blueprints -> base/Blueprints
+  libfoo{arm}: deps +libnew{arm}
+`
+	if buf.String() != expected {
+		t.Errorf("incorrect output:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+
+	buf.Reset()
+	if compareModuleGraphs(buf, oldModules, oldModules) {
+		t.Error("expected the module graphs to be equal")
+	}
+	expected = "module graph: 0 added, 0 removed, 0 changed module variants\n"
+	if buf.String() != expected {
+		t.Errorf("incorrect output:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
+
+func TestCompareNinjaFiles(t *testing.T) {
+	oldFile, err := readNinjaFile("testdata/old.ninja")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newFile, err := readNinjaFile("testdata/new.ninja")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpDir, err := ioutil.TempDir("", "bpbisect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	buf := &bytes.Buffer{}
+	differ, err := compareNinjaFiles(buf, oldFile, newFile, tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !differ {
+		t.Error("expected the Ninja files to differ")
+	}
+	expected := `ninja file: 1 added, 1 removed, 2 changed build statements in 2 module variants and singletons
+ changed variables:
+  +g.example.added
+  -g.example.removed
+  g.bootstrap.goRoot
+ changed rules and pools:
+  +pool g.example.highmem
+  rule g.example.cc
+first divergence: module libfoo{arm}
+
+module libfoo{arm}: 2 build statements differ
+--- old
++++ new
+@@ -1,2 +1,2 @@
+ build ${g.bootstrap.buildDir}/libfoo/foo.o: g.example.cc foo.c
+-    cflags = -O2
++    cflags = -O3
+${g.bootstrap.buildDir}/libbar/bar.o: moved from module libbar
+
+module libbar: 2 build statements differ
++build ${g.bootstrap.buildDir}/libbar/new.o: g.example.cc new.c
+-build ${g.bootstrap.buildDir}/libbar/old.o: g.example.cc old.c
+`
+	if buf.String() != expected {
+		t.Errorf("incorrect output:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+
+	buf.Reset()
+	differ, err = compareNinjaFiles(buf, oldFile, oldFile, tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if differ {
+		t.Error("expected the Ninja files to be equal")
+	}
+	expected = "ninja file: 0 added, 0 removed, 0 changed build statements in 0 module variants and singletons\n"
+	if buf.String() != expected {
+		t.Errorf("incorrect output:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
+
+func TestCompareNinjaFilesMaxDiffs(t *testing.T) {
+	defer func(n int) { *maxDiffs = n }(*maxDiffs)
+	*maxDiffs = 1
+
+	oldFile, err := readNinjaFile("testdata/old.ninja")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newFile, err := readNinjaFile("testdata/new.ninja")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err := compareNinjaFiles(buf, oldFile, newFile, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{
+		"  +g.example.added\n  ... and 2 more\n",
+		"-    cflags = -O2\n",
+		"\n... 3 more build statements differ, see -max_diffs\n",
+	} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("expected output to contain %q, got:\n%s", s, buf.String())
+		}
+	}
+	if strings.Contains(buf.String(), "moved from") {
+		t.Errorf("expected only one build statement to be printed, got:\n%s", buf.String())
+	}
+}
@@ -15,6 +15,8 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"text/scanner"
+	"text/template"
 	"unicode"
 
 	"github.com/google/blueprint/parser"
@@ -30,6 +32,8 @@ var (
 	targetedModules = new(identSet)
 	addIdents       = new(identSet)
 	removeIdents    = new(identSet)
+	addModule       = flag.String("add-module", "", "module definition or template name of a module to add")
+	templateDir     = flag.String("templates", "", "directory containing module templates for -add-module")
 )
 
 func init() {
@@ -69,17 +73,26 @@ func processFile(filename string, in io.Reader, out io.Writer) error {
 		return err
 	}
 
-	r := bytes.NewBuffer(src)
+	file, err := parseFile(filename, src)
+	if err != nil {
+		return err
+	}
 
-	file, errs := parser.Parse(filename, r, parser.NewScope(nil))
-	if len(errs) > 0 {
-		for _, err := range errs {
-			fmt.Fprintln(os.Stderr, err)
+	added := false
+	if *addModule != "" {
+		newSrc, err := insertModule(filename, src, file)
+		if err != nil {
+			return err
+		}
+		file, err = parseFile(filename, newSrc)
+		if err != nil {
+			return err
 		}
-		return fmt.Errorf("%d parsing errors", len(errs))
+		added = true
 	}
 
 	modified, errs := findModules(file)
+	modified = modified || added
 	if len(errs) > 0 {
 		for _, err := range errs {
 			fmt.Fprintln(os.Stderr, err)
@@ -119,6 +132,137 @@ func processFile(filename string, in io.Reader, out io.Writer) error {
 	return err
 }
 
+func parseFile(filename string, src []byte) (*parser.File, error) {
+	file, errs := parser.Parse(filename, bytes.NewBuffer(src), parser.NewScope(nil))
+	if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return nil, fmt.Errorf("%d parsing errors", len(errs))
+	}
+	return file, nil
+}
+
+// newModuleText returns the text of the module to add, either the value of
+// -add-module if it is a module definition, or the template it names expanded
+// with the module name from -m.
+func newModuleText(filename string) (string, error) {
+	if strings.Contains(*addModule, "{") {
+		return *addModule, nil
+	}
+
+	if *templateDir == "" {
+		return "", fmt.Errorf("-templates is required to add a module from template %q", *addModule)
+	}
+	if len(targetedModules.idents) != 1 || targetedModules.all {
+		return "", fmt.Errorf("-m must name the module to add from template %q", *addModule)
+	}
+
+	tmpl, err := template.ParseFiles(filepath.Join(*templateDir, *addModule+".bp"))
+	if err != nil {
+		return "", err
+	}
+
+	buf := &bytes.Buffer{}
+	err = tmpl.Execute(buf, struct{ Name, Dir string }{
+		Name: targetedModules.idents[0],
+		Dir:  filepath.Dir(filename),
+	})
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// insertModule returns src with the module from -add-module inserted before
+// the first module in file whose name sorts after it, or after the end of src
+// if there is none.  Comments directly above that module stay attached to it.
+func insertModule(filename string, src []byte, file *parser.File) ([]byte, error) {
+	text, err := newModuleText(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	newFile, err := parseFile(*addModule, []byte(text))
+	if err != nil {
+		return nil, err
+	}
+	if len(newFile.Defs) != 1 {
+		return nil, fmt.Errorf("-add-module must contain exactly one module, found %d definitions",
+			len(newFile.Defs))
+	}
+	newModule, ok := newFile.Defs[0].(*parser.Module)
+	if !ok {
+		return nil, fmt.Errorf("-add-module must contain a module definition")
+	}
+	name := moduleName(newModule)
+	if name == "" {
+		return nil, fmt.Errorf("module to add must have a name property")
+	}
+
+	offset := len(src)
+	for _, def := range file.Defs {
+		module, ok := def.(*parser.Module)
+		if !ok {
+			continue
+		}
+		existing := moduleName(module)
+		if existing == name {
+			return nil, fmt.Errorf("%s: module %q already exists", module.Pos(), name)
+		}
+		if existing > name {
+			offset = leadingCommentsPos(file, module).Offset
+			break
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	buf.Write(src[:offset])
+	if offset > 0 {
+		if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			buf.WriteString("\n")
+		}
+		if !bytes.HasSuffix(buf.Bytes(), []byte("\n\n")) {
+			buf.WriteString("\n")
+		}
+	}
+	buf.WriteString(strings.TrimSpace(text) + "\n")
+	if offset < len(src) {
+		buf.WriteString("\n")
+	}
+	buf.Write(src[offset:])
+
+	return buf.Bytes(), nil
+}
+
+// moduleName returns the value of the name property of module, or "" if it
+// doesn't have one that is a string.
+func moduleName(module *parser.Module) string {
+	for _, prop := range module.Properties {
+		if prop.Name == "name" && prop.Value.Type() == parser.StringType {
+			return prop.Value.Eval().(*parser.String).Value
+		}
+	}
+	return ""
+}
+
+// leadingCommentsPos returns the position of the first of the comment groups
+// that end on the line directly above module, or of module if there are none.
+func leadingCommentsPos(file *parser.File, module *parser.Module) scanner.Position {
+	pos := module.Pos()
+	for i := len(file.Comments) - 1; i >= 0; i-- {
+		c := file.Comments[i]
+		if c.End().Offset > pos.Offset {
+			continue
+		}
+		if c.End().Line != pos.Line-1 {
+			break
+		}
+		pos = c.Pos()
+	}
+	return pos
+}
+
 func findModules(file *parser.File) (modified bool, errs []error) {
 
 	for _, def := range file.Defs {
@@ -230,14 +374,16 @@ func main() {
 		return
 	}
 
-	if len(targetedModules.idents) == 0 {
-		report(fmt.Errorf("-m parameter is required"))
-		return
-	}
+	if *addModule == "" {
+		if len(targetedModules.idents) == 0 {
+			report(fmt.Errorf("-m parameter is required"))
+			return
+		}
 
-	if len(addIdents.idents) == 0 && len(removeIdents.idents) == 0 {
-		report(fmt.Errorf("-a or -r parameter is required"))
-		return
+		if len(addIdents.idents) == 0 && len(removeIdents.idents) == 0 {
+			report(fmt.Errorf("-a, -r or -add-module parameter is required"))
+			return
+		}
 	}
 
 	for i := 0; i < flag.NArg(); i++ {
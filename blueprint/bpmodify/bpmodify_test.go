@@ -0,0 +1,244 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const insertModuleTestFile = `// header
+
+module {
+    name: "b",
+}
+
+// about d
+module {
+    name: "d",
+}
+`
+
+var insertModuleTestCases = []struct {
+	name   string
+	module string
+	output string
+	err    string
+}{
+	{
+		name:   "first",
+		module: `module { name: "a" }`,
+		output: `// header
+
+module { name: "a" }
+
+module {
+    name: "b",
+}
+
+// about d
+module {
+    name: "d",
+}
+`,
+	},
+	{
+		name:   "middle",
+		module: `module { name: "c" }`,
+		output: `// header
+
+module {
+    name: "b",
+}
+
+module { name: "c" }
+
+// about d
+module {
+    name: "d",
+}
+`,
+	},
+	{
+		name:   "last",
+		module: `module { name: "e" }`,
+		output: `// header
+
+module {
+    name: "b",
+}
+
+// about d
+module {
+    name: "d",
+}
+
+module { name: "e" }
+`,
+	},
+	{
+		name:   "duplicate",
+		module: `module { name: "d" }`,
+		err:    `Blueprints:8:1: module "d" already exists`,
+	},
+	{
+		name:   "no name",
+		module: `module { srcs: ["x"] }`,
+		err:    "module to add must have a name property",
+	},
+	{
+		name:   "two modules",
+		module: `module { name: "a" } module { name: "c" }`,
+		err:    "-add-module must contain exactly one module, found 2 definitions",
+	},
+	{
+		name:   "assignment",
+		module: `x = "{"`,
+		err:    "-add-module must contain a module definition",
+	},
+}
+
+func TestInsertModule(t *testing.T) {
+	defer func(s string) { *addModule = s }(*addModule)
+
+	file, err := parseFile("Blueprints", []byte(insertModuleTestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, testCase := range insertModuleTestCases {
+		*addModule = testCase.module
+		output, err := insertModule("Blueprints", []byte(insertModuleTestFile), file)
+		if testCase.err != "" {
+			if err == nil || err.Error() != testCase.err {
+				t.Errorf("%s: expected error %q, got %v", testCase.name, testCase.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", testCase.name, err)
+			continue
+		}
+		if string(output) != testCase.output {
+			t.Errorf("%s: incorrect output:", testCase.name)
+			t.Errorf("  expected: %q", testCase.output)
+			t.Errorf("       got: %q", string(output))
+		}
+		if _, err := parseFile("Blueprints", output); err != nil {
+			t.Errorf("%s: output does not parse: %s", testCase.name, err)
+		}
+	}
+}
+
+func TestInsertModuleEmptyFile(t *testing.T) {
+	defer func(s string) { *addModule = s }(*addModule)
+
+	*addModule = `module { name: "a" }`
+	file, err := parseFile("Blueprints", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := insertModule("Blueprints", nil, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "module { name: \"a\" }\n"; string(output) != expected {
+		t.Errorf("expected %q, got %q", expected, string(output))
+	}
+}
+
+func TestInsertModuleTemplate(t *testing.T) {
+	defer func(s, dir string, m identSet) {
+		*addModule, *templateDir, *targetedModules = s, dir, m
+	}(*addModule, *templateDir, *targetedModules)
+
+	dir, err := ioutil.TempDir("", "bpmodify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "library.bp"),
+		[]byte("library {\n    name: \"{{.Name}}\",\n    dir: \"{{.Dir}}\",\n}\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := parseFile("foo/Blueprints", []byte(insertModuleTestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	*addModule = "library"
+	*templateDir = ""
+	*targetedModules = identSet{idents: []string{"c"}}
+	_, err = insertModule("foo/Blueprints", []byte(insertModuleTestFile), file)
+	if err == nil || !strings.Contains(err.Error(), "-templates is required") {
+		t.Errorf("expected error about missing -templates, got %v", err)
+	}
+
+	*templateDir = dir
+	output, err := insertModule("foo/Blueprints", []byte(insertModuleTestFile), file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "library {\n    name: \"c\",\n    dir: \"foo\",\n}\n\n// about d"
+	if !strings.Contains(string(output), expected) {
+		t.Errorf("expected output to contain %q, got:\n%s", expected, output)
+	}
+
+	*targetedModules = identSet{all: true}
+	_, err = insertModule("foo/Blueprints", []byte(insertModuleTestFile), file)
+	if err == nil || !strings.Contains(err.Error(), "-m must name the module") {
+		t.Errorf("expected error about -m, got %v", err)
+	}
+}
+
+func TestProcessFileAddModule(t *testing.T) {
+	defer func(s string) { *addModule = s }(*addModule)
+
+	*addModule = `module { name: "c", srcs: ["c.go"] }`
+	out := &bytes.Buffer{}
+	err := processFile("Blueprints", strings.NewReader(insertModuleTestFile), out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `// header
+
+module {
+    name: "b",
+}
+
+module {
+    name: "c",
+    srcs: ["c.go"],
+}
+
+// about d
+module {
+    name: "d",
+}
+`
+	if out.String() != expected {
+		t.Errorf("incorrect output:")
+		t.Errorf("  expected: %q", expected)
+		t.Errorf("       got: %q", out.String())
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// bprefactor applies refactorings to every Blueprints file of a tree, like
+// renaming a module type or a property, or rewriting the string values that
+// match a regular expression.  By default it only prints the unified diffs of
+// the files it would change.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/google/blueprint/parser"
+)
+
+var (
+	// main operation modes
+	list  = flag.Bool("l", false, "list files that would be modified by bprefactor instead of displaying diffs")
+	write = flag.Bool("w", false, "write result to (source) files instead of displaying diffs")
+
+	moduleType  = flag.String("module_type", "", "only refactor modules of this type")
+	match       = flag.String("match", "", "regular expression matching the string values to rewrite")
+	replacement = flag.String("replace", "", "replacement for the values matched by -match, may refer to submatches like $1")
+	property    = flag.String("property", "", "dotted path of the properties whose values -match rewrites")
+
+	renameModuleTypes = new(renameList)
+	renameProperties  = new(renameList)
+)
+
+func init() {
+	flag.Var(renameModuleTypes, "rename_module_type", "rename module type old to new, formatted as old=new (repeatable)")
+	flag.Var(renameProperties, "rename_property", "rename property at dotted path old to new, formatted as old=new (repeatable)")
+}
+
+var (
+	exitCode = 0
+)
+
+func report(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	exitCode = 2
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: bprefactor [flags] path ...\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+// refactorings returns the refactorings requested on the command line.  Module
+// types are renamed last, so that -module_type always names the type a module
+// had before the refactoring.
+func refactorings() ([]parser.Refactoring, error) {
+	var ret []parser.Refactoring
+
+	for _, r := range renameProperties.renames {
+		ret = append(ret, parser.RenameProperty{
+			ModuleType: *moduleType,
+			From:       r.from,
+			To:         r.to,
+		})
+	}
+
+	if *match != "" {
+		pattern, err := regexp.Compile(*match)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -match: %s", err)
+		}
+		ret = append(ret, parser.RewriteValues{
+			ModuleType:  *moduleType,
+			Property:    *property,
+			Pattern:     pattern,
+			Replacement: *replacement,
+		})
+	} else if *property != "" {
+		return nil, fmt.Errorf("-property requires -match")
+	}
+
+	for _, r := range renameModuleTypes.renames {
+		if *moduleType != "" && r.from != *moduleType {
+			continue
+		}
+		ret = append(ret, parser.RenameModuleType{From: r.from, To: r.to})
+	}
+
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("-rename_module_type, -rename_property or -match parameter is required")
+	}
+
+	return ret, nil
+}
+
+func processFile(filename string, refactorings []parser.Refactoring, out io.Writer) error {
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	file, errs := parser.Parse(filename, bytes.NewBuffer(src), parser.NewScope(nil))
+	if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return fmt.Errorf("%d parsing errors", len(errs))
+	}
+
+	changes, errs := parser.Refactor(file, refactorings...)
+	for _, err := range errs {
+		report(err)
+	}
+	if changes == 0 {
+		return nil
+	}
+
+	res, err := parser.Print(file)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(src, res) {
+		return nil
+	}
+
+	switch {
+	case *list:
+		fmt.Fprintln(out, filename)
+	case *write:
+		return ioutil.WriteFile(filename, res, 0644)
+	default:
+		data, err := diff(filename, src, res)
+		if err != nil {
+			return fmt.Errorf("computing diff: %s", err)
+		}
+		out.Write(data)
+	}
+
+	return nil
+}
+
+func walkDir(path string, refactorings []parser.Refactoring) {
+	visitFile := func(path string, f os.FileInfo, err error) error {
+		if err == nil && f.Name() == "Blueprints" {
+			err = processFile(path, refactorings, os.Stdout)
+		}
+		if err != nil {
+			report(err)
+		}
+		return nil
+	}
+
+	filepath.Walk(path, visitFile)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+	}
+
+	refactorings, err := refactorings()
+	if err != nil {
+		report(err)
+		os.Exit(exitCode)
+	}
+
+	for i := 0; i < flag.NArg(); i++ {
+		path := flag.Arg(i)
+		switch dir, err := os.Stat(path); {
+		case err != nil:
+			report(err)
+		case dir.IsDir():
+			walkDir(path, refactorings)
+		default:
+			if err := processFile(path, refactorings, os.Stdout); err != nil {
+				report(err)
+			}
+		}
+	}
+
+	os.Exit(exitCode)
+}
+
+// diff returns the unified diff between the contents of filename before and
+// after the refactoring, labeled like the output of git diff.
+func diff(filename string, b1, b2 []byte) (data []byte, err error) {
+	f1, err := ioutil.TempFile("", "bprefactor")
+	if err != nil {
+		return
+	}
+	defer os.Remove(f1.Name())
+	defer f1.Close()
+
+	f2, err := ioutil.TempFile("", "bprefactor")
+	if err != nil {
+		return
+	}
+	defer os.Remove(f2.Name())
+	defer f2.Close()
+
+	f1.Write(b1)
+	f2.Write(b2)
+
+	label := filepath.ToSlash(filepath.Clean(filename))
+	data, err = exec.Command("diff", "-u", "-L", "a/"+label, "-L", "b/"+label,
+		f1.Name(), f2.Name()).CombinedOutput()
+	if len(data) > 0 {
+		// diff exits with a non-zero status when the files don't match.
+		// Ignore that failure as long as we get output.
+		err = nil
+	}
+	return
+}
+
+type rename struct {
+	from, to string
+}
+
+// renameList is a repeatable flag of old=new renames.
+type renameList struct {
+	renames []rename
+}
+
+func (l *renameList) String() string {
+	var s []string
+	for _, r := range l.renames {
+		s = append(s, r.from+"="+r.to)
+	}
+	return strings.Join(s, ",")
+}
+
+func (l *renameList) Set(s string) error {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("expected old=new, got %q", s)
+	}
+	l.renames = append(l.renames, rename{parts[0], parts[1]})
+	return nil
+}
+
+func (l *renameList) Get() interface{} {
+	return l.renames
+}
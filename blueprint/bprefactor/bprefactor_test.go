@@ -0,0 +1,282 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/blueprint/parser"
+)
+
+// setFlags sets the refactoring flags for a test, and returns a function that
+// restores them.
+func setFlags(t *testing.T, args ...string) func() {
+	l, w, mt, m, r, p := *list, *write, *moduleType, *match, *replacement, *property
+	rmt, rp := *renameModuleTypes, *renameProperties
+	restore := func() {
+		*list, *write, *moduleType, *match, *replacement, *property = l, w, mt, m, r, p
+		*renameModuleTypes, *renameProperties = rmt, rp
+	}
+
+	*renameModuleTypes, *renameProperties = renameList{}, renameList{}
+	for i := 0; i < len(args); i += 2 {
+		if err := flag.Set(args[i], args[i+1]); err != nil {
+			restore()
+			t.Fatalf("-%s=%s: %s", args[i], args[i+1], err)
+		}
+	}
+	return restore
+}
+
+func TestRefactorings(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     []string
+		expected []parser.Refactoring
+		err      string
+	}{
+		{
+			name: "renames",
+			args: []string{
+				"rename_module_type", "cc=cc2",
+				"rename_property", "srcs=sources",
+				"rename_module_type", "java=java2",
+			},
+			expected: []parser.Refactoring{
+				parser.RenameProperty{From: "srcs", To: "sources"},
+				parser.RenameModuleType{From: "cc", To: "cc2"},
+				parser.RenameModuleType{From: "java", To: "java2"},
+			},
+		},
+		{
+			// -module_type drops the module type renames of other types.
+			name: "module type",
+			args: []string{
+				"module_type", "cc",
+				"rename_module_type", "cc=cc2",
+				"rename_module_type", "java=java2",
+				"rename_property", "srcs=sources",
+			},
+			expected: []parser.Refactoring{
+				parser.RenameProperty{ModuleType: "cc", From: "srcs", To: "sources"},
+				parser.RenameModuleType{From: "cc", To: "cc2"},
+			},
+		},
+		{
+			name: "other module type",
+			args: []string{
+				"module_type", "go",
+				"rename_module_type", "cc=cc2",
+			},
+			err: "-rename_module_type, -rename_property or -match parameter is required",
+		},
+		{
+			name: "none",
+			err:  "-rename_module_type, -rename_property or -match parameter is required",
+		},
+		{
+			name: "property without match",
+			args: []string{"property", "srcs", "rename_module_type", "cc=cc2"},
+			err:  "-property requires -match",
+		},
+		{
+			name: "invalid match",
+			args: []string{"match", "a(b"},
+			err:  "invalid -match: ",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			defer setFlags(t, testCase.args...)()
+
+			got, err := refactorings()
+			if testCase.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), testCase.err) {
+					t.Errorf("expected error %q, got %v", testCase.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, testCase.expected) {
+				t.Errorf("expected refactorings:\n%#v\ngot:\n%#v", testCase.expected, got)
+			}
+		})
+	}
+}
+
+func TestRefactoringsMatch(t *testing.T) {
+	defer setFlags(t, "module_type", "cc", "property", "srcs", "match", `^(.*)\.c$`,
+		"replace", "${1}.cpp")()
+
+	got, err := refactorings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected 1 refactoring, got %#v", got)
+	}
+	r, ok := got[0].(parser.RewriteValues)
+	if !ok || r.ModuleType != "cc" || r.Property != "srcs" || r.Replacement != "${1}.cpp" ||
+		r.Pattern.String() != `^(.*)\.c$` {
+		t.Errorf("unexpected refactoring %#v", got[0])
+	}
+}
+
+func TestRenameList(t *testing.T) {
+	l := &renameList{}
+	for _, s := range []string{"a=b", "c=d=e"} {
+		if err := l.Set(s); err != nil {
+			t.Errorf("%q: unexpected error %s", s, err)
+		}
+	}
+	for _, s := range []string{"a", "=b", "a="} {
+		if err := l.Set(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+
+	expected := []rename{{"a", "b"}, {"c", "d=e"}}
+	if !reflect.DeepEqual(l.renames, expected) {
+		t.Errorf("expected renames %v, got %v", expected, l.renames)
+	}
+	if s := l.String(); s != "a=b,c=d=e" {
+		t.Errorf("expected %q, got %q", "a=b,c=d=e", s)
+	}
+}
+
+const processFileTestInput = `cc {
+    name: "a",
+    srcs: ["a.c"],
+}
+`
+
+const processFileTestOutput = `cc2 {
+    name: "a",
+    srcs: ["a.c"],
+}
+`
+
+func TestProcessFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bprefactor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "Blueprints")
+
+	testCases := []struct {
+		name string
+		args []string
+		out  []string
+		file string
+	}{
+		{
+			name: "diff",
+			out: []string{
+				"--- a/" + filepath.ToSlash(filename) + "\n",
+				"+++ b/" + filepath.ToSlash(filename) + "\n",
+				"-cc {\n",
+				"+cc2 {\n",
+			},
+			file: processFileTestInput,
+		},
+		{
+			name: "list",
+			args: []string{"l", "true"},
+			out:  []string{filename + "\n"},
+			file: processFileTestInput,
+		},
+		{
+			name: "write",
+			args: []string{"w", "true"},
+			file: processFileTestOutput,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			defer setFlags(t, append(testCase.args, "rename_module_type", "cc=cc2")...)()
+
+			err := ioutil.WriteFile(filename, []byte(processFileTestInput), 0666)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			refactorings, err := refactorings()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			out := &bytes.Buffer{}
+			if err := processFile(filename, refactorings, out); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, s := range testCase.out {
+				if !strings.Contains(out.String(), s) {
+					t.Errorf("expected output to contain %q, got:\n%s", s, out.String())
+				}
+			}
+			if len(testCase.out) == 0 && out.Len() > 0 {
+				t.Errorf("unexpected output:\n%s", out.String())
+			}
+
+			data, err := ioutil.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != testCase.file {
+				t.Errorf("expected file contents:\n%s\ngot:\n%s", testCase.file, data)
+			}
+		})
+	}
+}
+
+func TestProcessFileUnchanged(t *testing.T) {
+	defer setFlags(t, "rename_module_type", "java=java2")()
+
+	dir, err := ioutil.TempDir("", "bprefactor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "Blueprints")
+	err = ioutil.WriteFile(filename, []byte(processFileTestInput), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refactorings, err := refactorings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	if err := processFile(filename, refactorings, out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() > 0 {
+		t.Errorf("unexpected output for an unchanged file:\n%s", out.String())
+	}
+}
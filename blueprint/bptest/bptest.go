@@ -0,0 +1,288 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bptest is a regression testing framework for primary builders.  It
+// runs the module types, mutators and singletons of a primary builder against
+// an in-memory tree of files, and compares the generated Ninja file, the module
+// graph and the errors with golden files.  Running the tests with
+// -update_golden rewrites the golden files instead, so that the changes to the
+// generated Ninja file can be reviewed with the change to the build logic.
+//
+// A test of a primary builder usually looks like:
+//
+//	func TestLibraries(t *testing.T) {
+//		bptest.Check(t, "testdata", bptest.Case{
+//			Name:     "libraries",
+//			Register: registerModuleTypes,
+//			Files: map[string]string{
+//				"Blueprints": `my_library { name: "libfoo", srcs: ["foo.c"] }`,
+//				"foo.c":      "",
+//			},
+//		})
+//	}
+package bptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/blueprint"
+)
+
+var updateGolden = flag.Bool("update_golden", false,
+	"rewrite the golden files of bptest.Check instead of comparing with them")
+
+// A Case is the input of a golden file test.
+type Case struct {
+	// Name is the base name of the golden files, which are Name+".ninja",
+	// Name+".graph.json" and Name+".errors".
+	Name string
+
+	// Files are the contents of the files in the tree, by path relative to
+	// the top of the tree.
+	Files map[string]string
+
+	// RootFile is the top-level Blueprints file in Files.  If empty,
+	// "Blueprints" is used.
+	RootFile string
+
+	// Config is the config object passed to the Context.
+	Config interface{}
+
+	// Register registers the module types, mutators and singletons of the
+	// primary builder with the Context, and applies any other settings of
+	// the primary builder to it.
+	Register func(ctx *blueprint.Context)
+
+	// Replacements are pairs of old and new strings that are replaced in the
+	// Ninja file and the errors before they are compared, for example to
+	// replace an absolute path in the config with a placeholder.
+	Replacements []string
+}
+
+// A Result is the output of running a Case.
+type Result struct {
+	// Ninja is the normalized Ninja file, or "" if there were errors.
+	Ninja string
+
+	// ModuleGraph is the JSON of the module variants and their direct
+	// dependencies, or "" if the dependencies couldn't be resolved.
+	ModuleGraph string
+
+	// Errors are the errors reported while parsing the files, resolving the
+	// dependencies or generating the build actions.
+	Errors []string
+}
+
+// A moduleGraphNode is a module variant in the module graph JSON.
+type moduleGraphNode struct {
+	ID   string   `json:"id"`
+	Type string   `json:"type"`
+	Dir  string   `json:"dir"`
+	Deps []string `json:"deps,omitempty"`
+}
+
+// Run runs the Case and returns its normalized outputs.
+func Run(c Case) *Result {
+	ctx := blueprint.NewContext()
+	if c.Register != nil {
+		c.Register(ctx)
+	}
+
+	files := make(map[string][]byte, len(c.Files))
+	for name, contents := range c.Files {
+		files[name] = []byte(contents)
+	}
+	ctx.MockFileSystem(files)
+
+	rootFile := c.RootFile
+	if rootFile == "" {
+		rootFile = "Blueprints"
+	}
+
+	replacer := strings.NewReplacer(c.Replacements...)
+	result := &Result{}
+	setErrors := func(errs []error) {
+		for _, err := range errs {
+			result.Errors = append(result.Errors, replacer.Replace(err.Error()))
+		}
+	}
+
+	_, errs := ctx.ParseBlueprintsFiles(rootFile)
+	if len(errs) > 0 {
+		setErrors(errs)
+		return result
+	}
+
+	errs = ctx.ResolveDependencies(c.Config)
+	if len(errs) > 0 {
+		setErrors(errs)
+		return result
+	}
+
+	result.ModuleGraph = moduleGraph(ctx)
+
+	_, errs = ctx.PrepareBuildActions(c.Config)
+	if len(errs) > 0 {
+		setErrors(errs)
+		return result
+	}
+
+	buf := &bytes.Buffer{}
+	if err := ctx.WriteBuildFile(buf); err != nil {
+		setErrors([]error{err})
+		return result
+	}
+	result.Ninja = normalizeNinja(replacer.Replace(buf.String()))
+
+	return result
+}
+
+// moduleGraph returns the JSON of the module variants in the Context, sorted by
+// name, with the VariantIDs of their direct dependencies in order.
+func moduleGraph(ctx *blueprint.Context) string {
+	nodes := []moduleGraphNode{}
+	ctx.VisitAllModules(func(module blueprint.Module) {
+		node := moduleGraphNode{
+			ID:   ctx.ModuleVariantID(module).String(),
+			Type: ctx.ModuleType(module),
+			Dir:  ctx.ModuleDir(module),
+		}
+		ctx.VisitDirectDeps(module, func(dep blueprint.Module) {
+			node.Deps = append(node.Deps, ctx.ModuleVariantID(dep).String())
+		})
+		nodes = append(nodes, node)
+	})
+
+	data, err := json.MarshalIndent(nodes, "", "  ")
+	if err != nil {
+		// The nodes only contain strings.
+		panic(err)
+	}
+	return string(data) + "\n"
+}
+
+// normalizeNinja removes the comment at the top of a Ninja file, which lists
+// the Go packages that defined the variables and rules, trailing whitespace
+// and repeated empty lines, so that golden files only change when build
+// actions change.
+func normalizeNinja(ninja string) string {
+	lines := strings.Split(ninja, "\n")
+	for len(lines) > 0 && strings.HasPrefix(lines[0], "#") {
+		lines = lines[1:]
+	}
+
+	var normalized []string
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t")
+		if line == "" && (len(normalized) == 0 || normalized[len(normalized)-1] == "") {
+			continue
+		}
+		normalized = append(normalized, line)
+	}
+	for len(normalized) > 0 && normalized[len(normalized)-1] == "" {
+		normalized = normalized[:len(normalized)-1]
+	}
+
+	if len(normalized) == 0 {
+		return ""
+	}
+	return strings.Join(normalized, "\n") + "\n"
+}
+
+// Check runs the Case and compares the Ninja file, the module graph and the
+// errors with the golden files in dir.  A golden file that doesn't exist is
+// expected to be empty, and the golden files of empty outputs are not written
+// when the golden files are updated with -update_golden.
+func Check(t testing.TB, dir string, c Case) *Result {
+	result := Run(c)
+
+	var errorLines string
+	if len(result.Errors) > 0 {
+		errorLines = strings.Join(result.Errors, "\n") + "\n"
+	}
+
+	outputs := []struct {
+		ext, got string
+	}{
+		{".ninja", result.Ninja},
+		{".graph.json", result.ModuleGraph},
+		{".errors", errorLines},
+	}
+
+	for _, output := range outputs {
+		golden := filepath.Join(dir, c.Name+output.ext)
+
+		if *updateGolden {
+			if err := updateGoldenFile(golden, output.got); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		expected, err := ioutil.ReadFile(golden)
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+
+		if output.got != string(expected) {
+			t.Errorf("%s: %s differs from the golden file %s, run the test with -update_golden to update it:\n%s",
+				c.Name, strings.TrimPrefix(output.ext, "."), golden, diff(string(expected), output.got))
+		}
+	}
+
+	return result
+}
+
+func updateGoldenFile(golden, contents string) error {
+	if contents == "" {
+		err := os.Remove(golden)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(golden), 0777); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(golden, []byte(contents), 0666)
+}
+
+// diff describes the first line that differs between expected and got.
+func diff(expected, got string) string {
+	expectedLines := strings.Split(expected, "\n")
+	gotLines := strings.Split(got, "\n")
+
+	for i := 0; i < len(expectedLines) || i < len(gotLines); i++ {
+		var e, g string
+		if i < len(expectedLines) {
+			e = expectedLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if e != g || i >= len(expectedLines) || i >= len(gotLines) {
+			return fmt.Sprintf("line %d:\n  expected: %q\n       got: %q", i+1, e, g)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,116 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bptest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/blueprint"
+)
+
+var (
+	pctx = blueprint.NewPackageContext("github.com/google/blueprint/bptest")
+
+	copyRule = pctx.StaticRule("cp",
+		blueprint.RuleParams{
+			Command: "cp $in $out",
+		})
+)
+
+type copyModule struct {
+	blueprint.SimpleName
+	properties struct {
+		Src  string
+		Deps []string
+	}
+}
+
+func newCopyModule() (blueprint.Module, []interface{}) {
+	m := &copyModule{}
+	return m, []interface{}{&m.properties, &m.SimpleName.Properties}
+}
+
+func (m *copyModule) DynamicDependencies(ctx blueprint.DynamicDependerModuleContext) []string {
+	return m.properties.Deps
+}
+
+func (m *copyModule) GenerateBuildActions(ctx blueprint.ModuleContext) {
+	if m.properties.Src == "" {
+		ctx.PropertyErrorf("src", "missing src")
+		return
+	}
+	ctx.Build(pctx, blueprint.BuildParams{
+		Rule:    copyRule,
+		Outputs: []string{"/abs/out/" + ctx.ModuleName()},
+		Inputs:  []string{ctx.ModuleDir() + "/" + m.properties.Src},
+	})
+}
+
+func register(ctx *blueprint.Context) {
+	ctx.RegisterModuleType("copy", newCopyModule)
+}
+
+func TestCheck(t *testing.T) {
+	Check(t, "testdata", Case{
+		Name:     "copy",
+		Register: register,
+		Files: map[string]string{
+			"Blueprints": `
+				subdirs = ["lib"]
+
+				copy {
+				    name: "a",
+				    src: "a.txt",
+				    deps: ["b"],
+				}
+			`,
+			"lib/Blueprints": `
+				copy {
+				    name: "b",
+				    src: "b.txt",
+				}
+			`,
+		},
+		Replacements: []string{"/abs/out/", "${OUT}/"},
+	})
+
+	Check(t, "testdata", Case{
+		Name:     "errors",
+		Register: register,
+		Files: map[string]string{
+			"Blueprints": `
+				copy {
+				    name: "a",
+				}
+			`,
+		},
+	})
+}
+
+func TestNormalizeNinja(t *testing.T) {
+	in := "# header\n#\nninja_required_version = 1.7.0\n\n\n\nrule a  \n    command = a\n\n"
+	expected := "ninja_required_version = 1.7.0\n\nrule a\n    command = a\n"
+	if got := normalizeNinja(in); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	got := diff("a\nb\n", "a\nc\nd\n")
+	if !strings.HasPrefix(got, "line 2:") || !strings.Contains(got, `"b"`) || !strings.Contains(got, `"c"`) {
+		t.Errorf("unexpected diff %q", got)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"bytes"
+
+	"github.com/google/blueprint/pathtools"
+)
+
+// BuildFileSegments returns the Ninja manifest text written by WriteBuildFile
+// split in segments: the global definitions, the build actions of each module
+// and singleton, and the subninja statements.  The segments can be passed to
+// pathtools.PatchFile so that only the segments that changed since the last
+// build are written to the Ninja file.  If this is called before
+// PrepareBuildActions successfully completes then ErrBuildActionsNotReady is
+// returned.
+func (c *Context) BuildFileSegments() ([]pathtools.FileSegment, error) {
+	w := &segmentWriter{buf: bytes.NewBuffer(nil)}
+	nw := newNinjaWriter(w)
+	nw.startSegment = w.startSegment
+
+	nw.Segment("globals")
+	err := c.writeBuildFile(nw)
+	if err != nil {
+		return nil, err
+	}
+	w.startSegment("")
+
+	return w.segments, nil
+}
+
+// segmentWriter collects the text written to it in a new segment each time
+// startSegment is called.
+type segmentWriter struct {
+	segments []pathtools.FileSegment
+	name     string
+	buf      *bytes.Buffer
+}
+
+func (w *segmentWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *segmentWriter) startSegment(name string) {
+	if w.buf.Len() > 0 {
+		w.segments = append(w.segments, pathtools.FileSegment{Name: w.name, Data: w.buf.Bytes()})
+		w.buf = bytes.NewBuffer(nil)
+	}
+	w.name = name
+}
@@ -0,0 +1,74 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestBuildFileSegments(t *testing.T) {
+	ctx := NewContext()
+	ctx.RegisterModuleType("symlink_module", newSymlinkModule)
+	ctx.RegisterSingletonType("build_dir", func() Singleton { return buildDirSingleton{} })
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			symlink_module {
+			    name: "B",
+			    target: "out/bin/b",
+			}
+
+			symlink_module {
+			    name: "A",
+			    target: "out/bin/a",
+			}
+		`),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) == 0 {
+		_, errs = ctx.PrepareBuildActions(nil)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+
+	segments, err := ctx.BuildFileSegments()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	var data []byte
+	for _, segment := range segments {
+		names = append(names, segment.Name)
+		data = append(data, segment.Data...)
+	}
+
+	expectedNames := []string{"globals", `module "A"`, `module "B"`}
+	if !reflect.DeepEqual(names, expectedNames) {
+		t.Errorf("expected segments %q, got %q", expectedNames, names)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	err = ctx.WriteBuildFile(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, buf.Bytes()) {
+		t.Errorf("expected the segments to make up the Ninja file:\n%s\ngot:\n%s", buf.Bytes(), data)
+	}
+}
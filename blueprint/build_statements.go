@@ -0,0 +1,125 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+// A BuildStatement describes a Ninja build statement generated by a module
+// variant or singleton, with its paths evaluated.
+type BuildStatement struct {
+	// Rule is the name of the rule in the Ninja file.
+	Rule string
+
+	// Owner is the string form of the VariantID of the module variant, or
+	// the name of the singleton, that generated the build statement.
+	Owner string
+
+	// Outputs are the explicit outputs followed by the implicit outputs.
+	Outputs []string
+
+	// Inputs are the explicit inputs followed by the implicit inputs,
+	// including the CommandDeps of the rule.
+	Inputs []string
+
+	OrderOnly []string
+
+	// Local and NoCache are those of the RuleParams of the rule.
+	Local   bool
+	NoCache bool
+}
+
+// BuildStatements returns all the build statements in the Ninja files, those of
+// the module variants in dependency order followed by those of the singletons
+// in registration order.  If this is called before PrepareBuildActions
+// successfully completes then ErrBuildActionsNotReady is returned.
+func (c *Context) BuildStatements() ([]BuildStatement, error) {
+	if !c.buildActionsReady {
+		return nil, ErrBuildActionsNotReady
+	}
+
+	var ret []BuildStatement
+	add := func(owner string, actionDefs *localBuildActions) error {
+		localVariables, err := c.localVariableValues(actionDefs)
+		if err != nil {
+			return err
+		}
+
+		for _, def := range actionDefs.buildDefs {
+			s := BuildStatement{
+				Rule:  def.Rule.fullName(c.pkgNames),
+				Owner: owner,
+			}
+
+			// CommandDeps can refer to the arguments of the rule.
+			variables := localVariables
+			if len(def.Args) > 0 {
+				variables = make(map[Variable]*ninjaString, len(localVariables)+len(def.Args))
+				for v, value := range localVariables {
+					variables[v] = value
+				}
+				for v, value := range def.Args {
+					variables[v] = value
+				}
+			}
+
+			var err error
+			eval := func(lists ...[]*ninjaString) []string {
+				var values []string
+				for _, list := range lists {
+					for _, str := range list {
+						if err != nil {
+							return nil
+						}
+						var value string
+						value, err = str.Eval(variables)
+						values = append(values, value)
+					}
+				}
+				return values
+			}
+
+			var commandDeps []*ninjaString
+			if def.RuleDef != nil {
+				commandDeps = def.RuleDef.CommandDeps
+				s.Local = def.RuleDef.Local
+				s.NoCache = def.RuleDef.NoCache
+			}
+
+			s.Outputs = eval(def.Outputs, def.ImplicitOutputs)
+			s.Inputs = eval(def.Inputs, def.Implicits, commandDeps)
+			s.OrderOnly = eval(def.OrderOnly)
+			if err != nil {
+				return err
+			}
+
+			ret = append(ret, s)
+		}
+		return nil
+	}
+
+	for _, module := range c.modulesSorted {
+		err := add(module.variantID().String(), &module.actionDefs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, info := range c.singletonInfo {
+		err := add(info.name, &info.actionDefs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
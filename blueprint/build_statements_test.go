@@ -0,0 +1,215 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildStatements(t *testing.T) {
+	ctx := NewContext()
+	ctx.RegisterModuleType("outputs_module", newOutputsModule)
+	ctx.RegisterSingletonType("verify_elf", NewVerifySingleton(VerifyStep{
+		Name:           "verify_elf",
+		PackageContext: verifyTestPctx,
+		Rule:           verifyTestCheck,
+		StampDir:       "${outDir}/verify",
+		Match: func(module Module, output string) bool {
+			return output == "out/a.elf"
+		},
+	}))
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			outputs_module {
+			    name: "A",
+			    outs: ["a.elf", "a.txt"],
+			}
+		`),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) > 0 {
+		t.Fatalf("unexpected parse errors: %v", errs)
+	}
+
+	if _, err := ctx.BuildStatements(); err != ErrBuildActionsNotReady {
+		t.Errorf("expected ErrBuildActionsNotReady before PrepareBuildActions, got %v", err)
+	}
+
+	_, errs = ctx.PrepareBuildActions(nil)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	statements, err := ctx.BuildStatements()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(statements) != 4 {
+		t.Fatalf("expected 4 build statements, got %v", statements)
+	}
+
+	expected := []BuildStatement{
+		{Rule: "g.verifytest.touch", Owner: "A", Outputs: []string{"out/a.elf"}},
+		{Rule: "g.verifytest.touch", Owner: "A", Outputs: []string{"out/a.txt"}},
+	}
+	if !reflect.DeepEqual(statements[:2], expected) {
+		t.Errorf("expected module build statements %v, got %v", expected, statements[:2])
+	}
+
+	verify := statements[2]
+	if verify.Rule != "g.verifytest.check" || verify.Owner != "verify_elf" ||
+		!reflect.DeepEqual(verify.Inputs, []string{"out/a.elf"}) {
+		t.Errorf("expected the verify_elf singleton to check out/a.elf, got %v", verify)
+	}
+	if phony := statements[3]; phony.Rule != "phony" || phony.Owner != "verify_elf" {
+		t.Errorf("expected the verify_elf singleton to add a phony target, got %v", phony)
+	}
+}
+
+var (
+	buildStatementsTestPctx = NewPackageContext("github.com/google/blueprint/buildstatementstest")
+
+	buildStatementsTestSign = buildStatementsTestPctx.StaticRule("sign",
+		RuleParams{
+			Command: "sign $in $out",
+			Local:   true,
+			NoCache: true,
+		})
+)
+
+type buildStatementsTestSingleton struct{}
+
+func (buildStatementsTestSingleton) GenerateBuildActions(ctx SingletonContext) {
+	ctx.Build(buildStatementsTestPctx, BuildParams{
+		Rule:    buildStatementsTestSign,
+		Outputs: []string{"signed.apk"},
+		Inputs:  []string{"unsigned.apk"},
+	})
+}
+
+func TestBuildStatementsLocalNoCache(t *testing.T) {
+	ctx := NewContext()
+	ctx.RegisterSingletonType("sign", func() Singleton { return buildStatementsTestSingleton{} })
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": nil,
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) == 0 {
+		_, errs = ctx.PrepareBuildActions(nil)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	statements, err := ctx.BuildStatements()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []BuildStatement{
+		{
+			Rule:    "g.buildstatementstest.sign",
+			Owner:   "sign",
+			Outputs: []string{"signed.apk"},
+			Inputs:  []string{"unsigned.apk"},
+			Local:   true,
+			NoCache: true,
+		},
+	}
+	if !reflect.DeepEqual(statements, expected) {
+		t.Errorf("expected build statements %v, got %v", expected, statements)
+	}
+}
+
+type buildStatementsLocalModule struct {
+	SimpleName
+}
+
+func newBuildStatementsLocalModule() (Module, []interface{}) {
+	m := &buildStatementsLocalModule{}
+	return m, []interface{}{&m.SimpleName.Properties}
+}
+
+func (m *buildStatementsLocalModule) GenerateBuildActions(ctx ModuleContext) {
+	ctx.Variable(buildStatementsTestPctx, "outdir", "out/"+ctx.ModuleName())
+	ctx.Build(buildStatementsTestPctx, BuildParams{
+		Rule:    buildStatementsTestSign,
+		Outputs: []string{"${outdir}/signed.apk"},
+		Inputs:  []string{"$outdir/unsigned.apk"},
+	})
+}
+
+type buildStatementsLocalSingleton struct{}
+
+func (buildStatementsLocalSingleton) GenerateBuildActions(ctx SingletonContext) {
+	ctx.Variable(buildStatementsTestPctx, "dist", "out/dist")
+	ctx.Build(buildStatementsTestPctx, BuildParams{
+		Rule:      buildStatementsTestSign,
+		Outputs:   []string{"${dist}/all.apk"},
+		Implicits: []string{"out/A/signed.apk"},
+	})
+}
+
+func TestBuildStatementsLocalVariables(t *testing.T) {
+	ctx := NewContext()
+	ctx.RegisterModuleType("local_module", newBuildStatementsLocalModule)
+	ctx.RegisterSingletonType("dist", func() Singleton { return buildStatementsLocalSingleton{} })
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			local_module {
+			    name: "A",
+			}
+		`),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) == 0 {
+		_, errs = ctx.PrepareBuildActions(nil)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	statements, err := ctx.BuildStatements()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []BuildStatement{
+		{
+			Rule:    "g.buildstatementstest.sign",
+			Owner:   "A",
+			Outputs: []string{"out/A/signed.apk"},
+			Inputs:  []string{"out/A/unsigned.apk"},
+			Local:   true,
+			NoCache: true,
+		},
+		{
+			Rule:    "g.buildstatementstest.sign",
+			Owner:   "dist",
+			Outputs: []string{"out/dist/all.apk"},
+			Inputs:  []string{"out/A/signed.apk"},
+			Local:   true,
+			NoCache: true,
+		},
+	}
+	if !reflect.DeepEqual(statements, expected) {
+		t.Errorf("expected build statements %v, got %v", expected, statements)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"sort"
+
+	"github.com/google/blueprint/pathtools"
+)
+
+// A BuildSummary counts the modules and build actions generated by
+// PrepareBuildActions.
+type BuildSummary struct {
+	// ModulesByType is the number of module variants of each module type.
+	ModulesByType map[string]int
+
+	// ActionsByRule is the number of build statements that use each rule,
+	// by the name of the rule in the Ninja file.
+	ActionsByRule map[string]int
+
+	// LargestOutputs are the estimates of the Ninja file output of the
+	// modules and singletons that write the most, largest first.
+	LargestOutputs []OutputSizeEstimate
+}
+
+// An OutputSizeEstimate is the number of bytes of variables, rules and build
+// statements that a module variant or singleton writes to the Ninja files,
+// not counting the comments that introduce them.
+type OutputSizeEstimate struct {
+	// Name is the string form of the VariantID of the module variant, or the
+	// name of the singleton.
+	Name string
+
+	// Type is the module type of the module, or "" for a singleton.
+	Type string
+
+	Bytes int64
+}
+
+// BuildSummary returns the number of module variants by type and build
+// statements by rule, and the n module variants or singletons with the
+// largest Ninja file output, or all of them if n is negative.  If this is
+// called before PrepareBuildActions successfully completes then
+// ErrBuildActionsNotReady is returned.
+func (c *Context) BuildSummary(n int) (*BuildSummary, error) {
+	if !c.buildActionsReady {
+		return nil, ErrBuildActionsNotReady
+	}
+
+	summary := &BuildSummary{
+		ModulesByType: make(map[string]int),
+		ActionsByRule: make(map[string]int),
+	}
+
+	addActions := func(name, typeName string, defs *localBuildActions) error {
+		for _, def := range defs.buildDefs {
+			summary.ActionsByRule[def.Rule.fullName(c.pkgNames)]++
+		}
+
+		size, err := c.localBuildActionsSize(defs)
+		if err != nil {
+			return err
+		}
+		if size > 0 {
+			summary.LargestOutputs = append(summary.LargestOutputs, OutputSizeEstimate{
+				Name:  name,
+				Type:  typeName,
+				Bytes: size,
+			})
+		}
+		return nil
+	}
+
+	for _, module := range c.modulesSorted {
+		summary.ModulesByType[module.typeName]++
+		err := addActions(module.variantID().String(), module.typeName, &module.actionDefs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, info := range c.singletonInfo {
+		err := addActions(info.name, "", &info.actionDefs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Sort(outputSizeSorter(summary.LargestOutputs))
+	if n >= 0 && n < len(summary.LargestOutputs) {
+		summary.LargestOutputs = summary.LargestOutputs[:n]
+	}
+
+	return summary, nil
+}
+
+// localBuildActionsSize returns the number of bytes that writeLocalBuildActions
+// writes for defs, including the build statements written to subninjas.
+func (c *Context) localBuildActionsSize(defs *localBuildActions) (int64, error) {
+	w := &pathtools.ByteCounter{}
+	nw := newNinjaWriter(w)
+
+	err := c.writeLocalBuildActions(nw, defs)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, def := range defs.buildDefs {
+		if def.Subninja != "" {
+			err := def.WriteTo(nw, c.pkgNames)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return w.N, nil
+}
+
+type outputSizeSorter []OutputSizeEstimate
+
+func (s outputSizeSorter) Len() int { return len(s) }
+func (s outputSizeSorter) Less(i, j int) bool {
+	if s[i].Bytes != s[j].Bytes {
+		return s[i].Bytes > s[j].Bytes
+	}
+	return s[i].Name < s[j].Name
+}
+func (s outputSizeSorter) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
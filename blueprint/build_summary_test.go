@@ -0,0 +1,87 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildSummary(t *testing.T) {
+	ctx := NewContext()
+	ctx.RegisterModuleType("outputs_module", newOutputsModule)
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			outputs_module {
+			    name: "A",
+			    outs: ["a.txt"],
+			}
+
+			outputs_module {
+			    name: "B",
+			    outs: ["b1.txt", "b2.txt", "b3.txt"],
+			}
+
+			outputs_module {
+			    name: "C",
+			}
+		`),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) > 0 {
+		t.Fatalf("unexpected parse errors: %v", errs)
+	}
+
+	if _, err := ctx.BuildSummary(-1); err != ErrBuildActionsNotReady {
+		t.Errorf("expected ErrBuildActionsNotReady before PrepareBuildActions, got %v", err)
+	}
+
+	_, errs = ctx.PrepareBuildActions(nil)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	summary, err := ctx.BuildSummary(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w := map[string]int{"outputs_module": 3}; !reflect.DeepEqual(summary.ModulesByType, w) {
+		t.Errorf("expected modules by type %v, got %v", w, summary.ModulesByType)
+	}
+	if w := map[string]int{"g.verifytest.touch": 4}; !reflect.DeepEqual(summary.ActionsByRule, w) {
+		t.Errorf("expected actions by rule %v, got %v", w, summary.ActionsByRule)
+	}
+
+	if len(summary.LargestOutputs) != 2 {
+		t.Fatalf("expected outputs of 2 modules, got %v", summary.LargestOutputs)
+	}
+	largest, smallest := summary.LargestOutputs[0], summary.LargestOutputs[1]
+	if largest.Name != "B" || largest.Type != "outputs_module" || smallest.Name != "A" {
+		t.Errorf("expected largest outputs from B and A, got %v", summary.LargestOutputs)
+	}
+	if largest.Bytes <= smallest.Bytes || smallest.Bytes == 0 {
+		t.Errorf("expected B to write more than A, got %v", summary.LargestOutputs)
+	}
+
+	summary, err = ctx.BuildSummary(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.LargestOutputs) != 1 || summary.LargestOutputs[0].Name != "B" {
+		t.Errorf("expected only the largest output from B, got %v", summary.LargestOutputs)
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"fmt"
+)
+
+// isConsolePool returns true if pool is Ninja's built-in console pool.
+func isConsolePool(pool Pool) bool {
+	builtin, ok := pool.(*builtinPool)
+	return ok && builtin.name_ == "console"
+}
+
+// inConsolePool returns true if the build statement runs in the console pool,
+// because it is interactive or because of the pool of its rule.  It must be
+// called after the build statement's RuleDef has been set.
+func (def *buildDef) inConsolePool() bool {
+	if def.Pool != nil {
+		return isConsolePool(def.Pool)
+	}
+	return def.RuleDef != nil && def.RuleDef.Pool != nil && isConsolePool(def.RuleDef.Pool)
+}
+
+// A consoleCheckDef is a build statement with the variables its paths are
+// evaluated with and the module or singleton that created it.
+type consoleCheckDef struct {
+	def       *buildDef
+	variables map[Variable]*ninjaString
+	module    *moduleInfo
+	singleton string
+}
+
+func (d *consoleCheckDef) owner() string {
+	if d.module != nil {
+		return d.module.String()
+	}
+	return fmt.Sprintf("singleton %q", d.singleton)
+}
+
+func (d *consoleCheckDef) errorf(format string, args ...interface{}) error {
+	if d.module != nil {
+		return &ModuleError{
+			BlueprintError: BlueprintError{
+				Err: fmt.Errorf(format, args...),
+				Pos: d.module.pos,
+			},
+			module: d.module,
+		}
+	}
+	return fmt.Errorf("%s: %s", d.owner(), fmt.Sprintf(format, args...))
+}
+
+// checkConsoleActions returns an error for every build statement that depends
+// on an output of a build statement in the console pool.  Ninja runs console
+// pool actions one at a time and stops printing the output of other actions
+// while they run, so they must be leaf nodes of the build graph that nothing
+// else waits for.  Phony build statements may depend on them to give them
+// names, and are treated as console pool actions themselves.
+func (c *Context) checkConsoleActions() []error {
+	if !c.hasConsoleActions() {
+		return nil
+	}
+
+	var defs []*consoleCheckDef
+	consoleOutputs := make(map[string]*consoleCheckDef)
+
+	add := func(actionDefs *localBuildActions, module *moduleInfo, singleton string) error {
+		variables, err := c.localVariableValues(actionDefs)
+		if err != nil {
+			return err
+		}
+		for _, def := range actionDefs.buildDefs {
+			d := &consoleCheckDef{def, variables, module, singleton}
+			defs = append(defs, d)
+			if def.inConsolePool() {
+				outputs, err := d.eval(def.Outputs, def.ImplicitOutputs)
+				if err != nil {
+					return err
+				}
+				for _, output := range outputs {
+					consoleOutputs[output] = d
+				}
+			}
+		}
+		return nil
+	}
+
+	for _, module := range c.modulesSorted {
+		if err := add(&module.actionDefs, module, ""); err != nil {
+			return []error{err}
+		}
+	}
+	for _, info := range c.singletonInfo {
+		if err := add(&info.actionDefs, nil, info.name); err != nil {
+			return []error{err}
+		}
+	}
+
+	// The outputs of phony build statements that depend on console pool
+	// actions are outputs of the console pool actions, which phony build
+	// statements may depend on in turn.
+	for changed := true; changed; {
+		changed = false
+		for _, d := range defs {
+			if d.def.Rule != Phony || d.def.inConsolePool() {
+				continue
+			}
+			console, err := d.consoleInput(consoleOutputs)
+			if err != nil {
+				return []error{err}
+			}
+			if console == nil {
+				continue
+			}
+			outputs, err := d.eval(d.def.Outputs, d.def.ImplicitOutputs)
+			if err != nil {
+				return []error{err}
+			}
+			for _, output := range outputs {
+				if _, ok := consoleOutputs[output]; !ok {
+					consoleOutputs[output] = console
+					changed = true
+				}
+			}
+		}
+	}
+
+	var errs []error
+	for _, d := range defs {
+		if d.def.Rule == Phony {
+			continue
+		}
+		input, err := d.consoleInputName(consoleOutputs)
+		if err != nil {
+			return []error{err}
+		}
+		if input != "" {
+			errs = append(errs, d.errorf("%q depends on %q, which is built by a console pool action of %s",
+				d.def.Rule.name(), input, consoleOutputs[input].owner()))
+			if len(errs) >= maxErrors {
+				break
+			}
+		}
+	}
+
+	return errs
+}
+
+func (c *Context) hasConsoleActions() bool {
+	for _, module := range c.modulesSorted {
+		for _, def := range module.actionDefs.buildDefs {
+			if def.inConsolePool() {
+				return true
+			}
+		}
+	}
+	for _, info := range c.singletonInfo {
+		for _, def := range info.actionDefs.buildDefs {
+			if def.inConsolePool() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// consoleInput returns the console pool action that builds one of the inputs
+// of the build statement, or nil if there is none.
+func (d *consoleCheckDef) consoleInput(consoleOutputs map[string]*consoleCheckDef) (*consoleCheckDef, error) {
+	input, err := d.consoleInputName(consoleOutputs)
+	if err != nil || input == "" {
+		return nil, err
+	}
+	return consoleOutputs[input], nil
+}
+
+// consoleInputName returns the first input of the build statement that is
+// built by a console pool action, or "" if there is none.
+func (d *consoleCheckDef) consoleInputName(consoleOutputs map[string]*consoleCheckDef) (string, error) {
+	inputs, err := d.eval(d.def.Inputs, d.def.Implicits, d.def.OrderOnly)
+	if err != nil {
+		return "", err
+	}
+	for _, input := range inputs {
+		if _, ok := consoleOutputs[input]; ok {
+			return input, nil
+		}
+	}
+	return "", nil
+}
+
+func (d *consoleCheckDef) eval(lists ...[]*ninjaString) ([]string, error) {
+	var values []string
+	for _, list := range lists {
+		for _, str := range list {
+			value, err := str.Eval(d.variables)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", d.owner(), err)
+			}
+			values = append(values, value)
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// consoleSingleton flashes out/image with an interactive build statement,
+// and builds the given dependents of the flash target.
+type consoleSingleton struct {
+	dependents []BuildParams
+}
+
+func (s *consoleSingleton) GenerateBuildActions(ctx SingletonContext) {
+	ctx.Build(verifyTestPctx, BuildParams{
+		Rule:    verifyTestTouch,
+		Outputs: []string{"${outDir}/image"},
+	})
+	ctx.Build(verifyTestPctx, BuildParams{
+		Rule:        verifyTestCheck,
+		Outputs:     []string{"${outDir}/flash.stamp"},
+		Inputs:      []string{"${outDir}/image"},
+		Interactive: true,
+	})
+	ctx.Build(verifyTestPctx, BuildParams{
+		Rule:      Phony,
+		Outputs:   []string{"flash"},
+		Implicits: []string{"out/flash.stamp"},
+	})
+	for _, params := range s.dependents {
+		ctx.Build(verifyTestPctx, params)
+	}
+}
+
+func TestConsoleActions(t *testing.T) {
+	testCases := []struct {
+		name       string
+		dependents []BuildParams
+		err        string
+	}{
+		{
+			name: "leaf",
+			dependents: []BuildParams{
+				{Rule: Phony, Outputs: []string{"all"}, Implicits: []string{"flash"}},
+			},
+		},
+		{
+			name: "direct",
+			dependents: []BuildParams{
+				{Rule: verifyTestTouch, Outputs: []string{"out/after"}, OrderOnly: []string{"out/flash.stamp"}},
+			},
+			err: `singleton "console": "touch" depends on "out/flash.stamp", which is built by a console pool action of singleton "console"`,
+		},
+		{
+			name: "phony",
+			dependents: []BuildParams{
+				{Rule: Phony, Outputs: []string{"all"}, Implicits: []string{"flash"}},
+				{Rule: verifyTestTouch, Outputs: []string{"out/after"}, Implicits: []string{"all"}},
+			},
+			err: `singleton "console": "touch" depends on "all", which is built by a console pool action of singleton "console"`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctx := NewContext()
+			ctx.RegisterSingletonType("console", func() Singleton {
+				return &consoleSingleton{testCase.dependents}
+			})
+			ctx.SetPoolPolicy(func(info PoolPolicyInfo) Pool {
+				return poolPolicyTestPool
+			})
+			ctx.MockFileSystem(map[string][]byte{
+				"Blueprints": nil,
+			})
+
+			_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+			if len(errs) == 0 {
+				_, errs = ctx.PrepareBuildActions(nil)
+			}
+
+			if testCase.err != "" {
+				if len(errs) != 1 || errs[0].Error() != testCase.err {
+					t.Fatalf("expected error %q, got %q", testCase.err, errs)
+				}
+				return
+			}
+			if len(errs) > 0 {
+				t.Fatalf("unexpected errors: %q", errs)
+			}
+
+			buf := &bytes.Buffer{}
+			if err := ctx.WriteBuildFile(buf); err != nil {
+				t.Fatalf("unexpected error writing build file: %s", err)
+			}
+			expected := "build ${g.verifytest.outDir}/flash.stamp: g.verifytest.check $\n" +
+				"        ${g.verifytest.outDir}/image\n" +
+				"    pool = console\n"
+			if out := buf.String(); !strings.Contains(out, expected) {
+				t.Errorf("missing build statement %q in:\n%s", expected, out)
+			}
+		})
+	}
+}
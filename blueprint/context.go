@@ -19,6 +19,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"path/filepath"
 	"reflect"
 	"runtime"
@@ -29,7 +30,9 @@ import (
 	"sync/atomic"
 	"text/scanner"
 	"text/template"
+	"time"
 
+	"github.com/google/blueprint/logging"
 	"github.com/google/blueprint/parser"
 	"github.com/google/blueprint/pathtools"
 	"github.com/google/blueprint/proptools"
@@ -87,6 +90,124 @@ type Context struct {
 	// set by SetAllowMissingDependencies
 	allowMissingDependencies bool
 
+	// set by SetVariantNameMangling
+	variantNameMangling VariantNameMangling
+
+	// set by RegisterPreprocessor
+	preprocessors []*preprocessorInfo
+
+	// set by SetDescriptionTemplates
+	descriptionTemplates *descriptionTemplates
+
+	// set by RegisterDependencyInjector
+	dependencyInjectors []*dependencyInjectorInfo
+
+	// set by RegisterDepsResolvedHook
+	depsResolvedHooks []*depsResolvedHookInfo
+
+	// set by SetPropertyVariables
+	propertyVariables map[string]string
+
+	// set by RegisterPackageModuleType, filled in during ParseBlueprintsFiles
+	packages map[string]*moduleInfo
+
+	// set by SetMemoryBudgetMode
+	memoryBudget *memoryBudget
+
+	// set by SetPoolPolicy
+	poolPolicy PoolPolicy
+
+	// set by SetOutputPathPolicy
+	outputPathPolicy *pathtools.OutputPathPolicy
+
+	// set by SetModuleTypePolicy, sorted with the most specific rules first
+	moduleTypeRules []ModuleTypeRule
+
+	// set by SetProgressReporter
+	progressReporter func(Progress)
+
+	// set by SetStrictNinjaEscapes
+	strictNinjaEscapes bool
+
+	// set by SetStrictPropertyConflicts
+	strictPropertyConflicts bool
+
+	// set by SetLogger
+	logger *logging.Logger
+
+	// set by RegisterVariantsMutator
+	variantsMutatorRegistered bool
+
+	// set by SetEnabledCondition
+	enabledPropertySet bool
+	enabledCondition   EnabledCondition
+
+	// set by SetRootModules and SetRootModulesIf
+	rootModules   []string
+	rootModulesIf func(Module) bool
+
+	// set by SetModuleProfiling
+	moduleProfiling bool
+
+	// interns the mutator and variation names of the variationMaps of modules
+	variationNames *variationTable
+
+	// set by SetSymlinkPolicy
+	symlinkPolicy pathtools.SymlinkPolicy
+
+	// set by SetPropertyOverrides, applied during ParseBlueprintsFiles
+	propertyOverrides *propertyOverrides
+
+	// set by SetWindowsSymlinks
+	windowsSymlinks bool
+
+	// set by SetWarningsAsErrors and SetWarningLevel
+	warningsAsErrors bool
+	warningLevels    map[string]DiagnosticLevel
+
+	// filled in by the functions that report warnings and by recordErrors
+	diagnostics     []*Diagnostic
+	diagnosticsLock sync.Mutex
+
+	// filled in by WalkDepsMemoized
+	memoizedWalks map[*MemoizedWalk]*memoizedWalkResults
+
+	// set by TraceDependencies
+	traceAllDeps     bool
+	traceDepsModules map[string]bool
+
+	// set by AddNinjaFileDeps and BaseModuleContext.AddNinjaFileDeps
+	ninjaFileDeps     []string
+	ninjaFileDepsLock sync.Mutex
+
+	// set by SetActionTmpDir
+	actionTmpDir string
+
+	// set by SetDefaultTargetPolicy
+	defaultTargetPolicy DefaultTargetPolicy
+
+	// set during PrepareBuildActions if the default targets are picked by
+	// the default target policy
+	defaultTargets []string
+
+	// set by ExportNinjaVariable
+	exportedVariables map[string]string
+
+	// set by SetParseCache
+	parseCache *ParseCache
+
+	// set during ParseBlueprintsFiles, the Blueprints files evaluated for
+	// import_vars
+	importedFiles  map[string]*importedFile
+	importVarsLock sync.Mutex
+
+	// set by SetTrackUnusedDefinitions, filled in during ParseBlueprintsFiles
+	variableUsage *variableUsage
+
+	// set during ResolveDependencies, the dependency injector that added each
+	// injected dependency
+	injectedDeps map[depEdge]string
+
 	// set during PrepareBuildActions
 	pkgNames        map[*packageContext]string
 	globalVariables map[Variable]*ninjaString
@@ -99,6 +220,13 @@ type Context struct {
 	requiredNinjaMinor int          // For the ninja_required_version variable
 	requiredNinjaMicro int          // For the ninja_required_version variable
 
+	// set during PrepareBuildActions by SingletonContext.AddSubninja
+	subninjas []*ninjaString
+
+	// set during PrepareBuildActions by SingletonContext.BuildInSubninja, in
+	// the order of first use
+	subninjaFiles []string
+
 	// set lazily by sortedModuleNames
 	cachedSortedModuleNames []string
 
@@ -173,6 +301,9 @@ type moduleInfo struct {
 	directDeps  []depInfo
 	missingDeps []string
 
+	// set during ResolveDependencies if TraceDependencies was called
+	depEvents []DependencyEvent
+
 	// set during updateDependencies
 	reverseDeps []*moduleInfo
 	forwardDeps []*moduleInfo
@@ -183,8 +314,24 @@ type moduleInfo struct {
 	// set during each runMutator
 	splitModules []*moduleInfo
 
+	// set during Parse if RegisterVariantsMutator was called, cleared by
+	// the variants mutator
+	variantOverrides []variantOverride
+
+	// set during Parse if SetEnabledCondition was called
+	enabledDef *parser.Property
+
+	// set during ResolveDependencies, the reason the module is disabled or
+	// empty if it is enabled
+	disabledReason string
+
 	// set during PrepareBuildActions
 	actionDefs localBuildActions
+
+	// set during PrepareBuildActions if SetModuleProfiling was called
+	generateDuration   time.Duration
+	generateAllocs     uint64
+	generateAllocBytes uint64
 }
 
 type depInfo struct {
@@ -215,33 +362,6 @@ type Variation struct {
 	Variation string
 }
 
-// A variationMap stores a map of Mutator to Variation to specify a variant of a module.
-type variationMap map[string]string
-
-func (vm variationMap) clone() variationMap {
-	newVm := make(variationMap)
-	for k, v := range vm {
-		newVm[k] = v
-	}
-
-	return newVm
-}
-
-// Compare this variationMap to another one.  Returns true if the every entry in this map
-// is either the same in the other map or doesn't exist in the other map.
-func (vm variationMap) subset(other variationMap) bool {
-	for k, v1 := range vm {
-		if v2, ok := other[k]; ok && v1 != v2 {
-			return false
-		}
-	}
-	return true
-}
-
-func (vm variationMap) equal(other variationMap) bool {
-	return reflect.DeepEqual(vm, other)
-}
-
 type singletonInfo struct {
 	// set during RegisterSingletonType
 	factory   SingletonFactory
@@ -258,6 +378,7 @@ type mutatorInfo struct {
 	bottomUpMutator BottomUpMutator
 	name            string
 	parallel        bool
+	enabled         func(config interface{}) bool
 }
 
 // NewContext creates a new Context object.  The created context initially has
@@ -272,9 +393,11 @@ func NewContext() *Context {
 		moduleNinjaNames: make(map[string]*moduleGroup),
 		globs:            make(map[string]GlobPath),
 		fs:               pathtools.OsFs,
+		variationNames:   newVariationTable(),
 	}
 
 	ctx.RegisterBottomUpMutator("blueprint_deps", blueprintDepsMutator)
+	ctx.RegisterBottomUpMutator("blueprint_path_deps", pathDepsMutator).Parallel()
 
 	return ctx
 }
@@ -455,6 +578,12 @@ type MutatorHandle interface {
 	// method on the mutator context is thread-safe, but the mutator must handle synchronization
 	// for any modifications to global state or any modules outside the one it was invoked on.
 	Parallel() MutatorHandle
+
+	// EnabledIf only runs the mutator if enabled returns true for the config
+	// passed to ResolveDependencies, for example to only install the mutators
+	// of a coverage or sanitizer feature when the config enables it.  The
+	// mutator must not be needed by other mutators when it is disabled.
+	EnabledIf(enabled func(config interface{}) bool) MutatorHandle
 }
 
 func (mutator *mutatorInfo) Parallel() MutatorHandle {
@@ -462,6 +591,32 @@ func (mutator *mutatorInfo) Parallel() MutatorHandle {
 	return mutator
 }
 
+func (mutator *mutatorInfo) EnabledIf(enabled func(config interface{}) bool) MutatorHandle {
+	mutator.enabled = enabled
+	return mutator
+}
+
+// enabledFor returns true if the mutator runs with config.
+func (mutator *mutatorInfo) enabledFor(config interface{}) bool {
+	return mutator.enabled == nil || mutator.enabled(config)
+}
+
+// EnabledMutators returns the names of the registered mutators that run with
+// config, in the order they run.  Enabling or disabling a mutator with
+// MutatorHandle.EnabledIf changes the list, so primary builders that cache
+// their outputs can include it in their cache keys.
+func (c *Context) EnabledMutators(config interface{}) []string {
+	var names []string
+	for _, list := range [][]*mutatorInfo{c.earlyMutatorInfo, c.mutatorInfo} {
+		for _, mutator := range list {
+			if mutator.enabledFor(config) {
+				names = append(names, mutator.name)
+			}
+		}
+	}
+	return names
+}
+
 // RegisterEarlyMutator registers a mutator that will be invoked to split
 // Modules into multiple variant Modules before any dependencies have been
 // created.  Each registered mutator is invoked in registration order once
@@ -514,6 +669,41 @@ func (c *Context) SetAllowMissingDependencies(allowMissingDependencies bool) {
 	c.allowMissingDependencies = allowMissingDependencies
 }
 
+// SetStrictPropertyConflicts makes it an error for a module type to have a
+// property that is defined by more than one field of its property structs,
+// for example by a field and a field promoted from an embedded struct, which
+// are otherwise both set.  The error lists every field that defines the
+// property.  Fields of embedded structs can be excluded with a
+// blueprint:"exclude(name)" tag, see proptools.ExcludedProperties.
+func (c *Context) SetStrictPropertyConflicts(strict bool) {
+	c.strictPropertyConflicts = strict
+}
+
+// SetLogger sets the logger that module implementations write messages to
+// through BaseModuleContext.Logger.  Messages are discarded if no logger is
+// set.
+func (c *Context) SetLogger(logger *logging.Logger) {
+	c.logger = logger
+}
+
+// Logger returns the logger set with SetLogger.
+func (c *Context) Logger() *logging.Logger {
+	return c.logger
+}
+
+// SetVariantNameMangling changes how the variant names of modules are embedded
+// in the names of the Ninja variables, rules and build statements generated
+// for them.  PrepareBuildActions reports an error if two variants of modules
+// end up with the same name.  It panics if the separator contains characters
+// that are invalid in Ninja names, or if the max length can't fit the
+// separator and the hash of a truncated name.
+func (c *Context) SetVariantNameMangling(mangling VariantNameMangling) {
+	if err := mangling.validate(); err != nil {
+		panic(err)
+	}
+	c.variantNameMangling = mangling
+}
+
 // Parse parses a single Blueprints file from r, creating Module objects for
 // each of the module definitions encountered.  If the Blueprints file contains
 // an assignment to the "subdirs" variable, then the subdirectories listed are
@@ -525,18 +715,36 @@ func (c *Context) SetAllowMissingDependencies(allowMissingDependencies bool) {
 // filename specifies the path to the Blueprints file.  These paths are used for
 // error reporting and for determining the module's directory.
 func (c *Context) parse(rootDir, filename string, r io.Reader,
-	scope *parser.Scope) (file *parser.File, subBlueprints []stringAndScope, errs []error) {
+	scope *parser.Scope) (file *parser.File, subBlueprints []stringAndScope, deps []string, errs []error) {
 
 	relBlueprintsFile, err := filepath.Rel(rootDir, filename)
 	if err != nil {
-		return nil, nil, []error{err}
+		return nil, nil, nil, []error{err}
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, nil, []error{err}
 	}
 
 	scope = parser.NewScope(scope)
 	scope.Remove("subdirs")
 	scope.Remove("optional_subdirs")
 	scope.Remove("build")
-	file, errs = parser.ParseAndEval(filename, r, scope)
+	scope.Remove(importVarsVariable)
+
+	deps, errs = c.importVars(filename, data, scope)
+	if len(errs) > 0 {
+		return nil, nil, nil, errs
+	}
+
+	if c.memoryBudget != nil {
+		arena := parser.NewNodeArena()
+		file, errs = parser.ParseAndEvalInArena(filename, bytes.NewReader(data), scope, arena)
+		c.memoryBudget.addASTStats(arena.Stats())
+	} else {
+		file, errs = parser.ParseAndEval(filename, bytes.NewReader(data), scope)
+	}
 	if len(errs) > 0 {
 		for i, err := range errs {
 			if parseErr, ok := err.(*parser.ParseError); ok {
@@ -550,10 +758,14 @@ func (c *Context) parse(rootDir, filename string, r io.Reader,
 
 		// If there were any parse errors don't bother trying to interpret the
 		// result.
-		return nil, nil, errs
+		return nil, nil, nil, errs
 	}
 	file.Name = relBlueprintsFile
 
+	if c.variableUsage != nil {
+		c.variableUsage.addFile(file, scope)
+	}
+
 	subdirs, subdirsPos, err := getLocalStringListFromScope(scope, "subdirs")
 	if err != nil {
 		errs = append(errs, err)
@@ -599,7 +811,7 @@ func (c *Context) parse(rootDir, filename string, r io.Reader,
 		subBlueprintsAndScope[i] = stringAndScope{b, scope}
 	}
 
-	return file, subBlueprintsAndScope, errs
+	return file, subBlueprintsAndScope, deps, errs
 }
 
 type stringAndScope struct {
@@ -619,6 +831,8 @@ type stringAndScope struct {
 func (c *Context) ParseBlueprintsFiles(rootFile string) (deps []string,
 	errs []error) {
 
+	defer func() { c.recordErrors(errs) }()
+
 	c.dependenciesReady = false
 
 	moduleCh := make(chan *moduleInfo)
@@ -643,6 +857,14 @@ func (c *Context) ParseBlueprintsFiles(rootFile string) (deps []string,
 					module, errs = c.processModuleDef(def, file.Name)
 				case *parser.Assignment:
 					// Already handled via Scope object
+				case *parser.Macro:
+					// Already expanded by the parser
+					if _, ok := c.moduleFactories[def.Name]; ok {
+						errs = []error{&BlueprintError{
+							Err: fmt.Errorf("macro %q hides the module type with the same name", def.Name),
+							Pos: def.NamePos,
+						}}
+					}
 				default:
 					panic("unknown definition type")
 				}
@@ -674,7 +896,12 @@ loop:
 		case newErrs := <-errsCh:
 			errs = append(errs, newErrs...)
 		case module := <-moduleCh:
-			newErrs := c.addModule(module)
+			var newErrs []error
+			if _, ok := module.logicModule.(*packageModule); ok {
+				newErrs = c.addPackage(module)
+			} else {
+				newErrs = c.addModule(module)
+			}
 			if len(newErrs) > 0 {
 				errs = append(errs, newErrs...)
 			}
@@ -686,6 +913,14 @@ loop:
 		}
 	}
 
+	if len(errs) == 0 && c.propertyOverrides != nil {
+		errs = c.propertyOverrides.unmatchedErrors()
+	}
+
+	if len(errs) == 0 && c.packages != nil {
+		errs = c.applyPackageDefaults()
+	}
+
 	return deps, errs
 }
 
@@ -703,10 +938,42 @@ type FileHandler func(*parser.File)
 func (c *Context) WalkBlueprintsFiles(rootFile string, handler FileHandler) (deps []string,
 	errs []error) {
 
+	rootFile, err := c.symlinkPolicy.CanonicalizeFs(c.fs, rootFile)
+	if err != nil {
+		return nil, []error{err}
+	}
 	rootDir := filepath.Dir(rootFile)
 
+	if c.parseCache != nil {
+		if files, deps, ok := c.parseCache.get(rootFile); ok {
+			progress := c.startProgress("parse", len(files))
+			for _, file := range files {
+				handler(file)
+				progress.done()
+			}
+			progress.finish(false)
+			return deps, nil
+		}
+		var files []*parser.File
+		parsed := handler
+		handler = func(file *parser.File) {
+			files = append(files, file)
+			parsed(file)
+		}
+		defer func() {
+			if len(errs) == 0 {
+				c.parseCache.put(rootFile, files, deps)
+			}
+		}()
+	}
+
 	blueprintsSet := make(map[string]bool)
 
+	progress := c.startProgress("parse", 0)
+	defer func() {
+		progress.finish(len(errs) > 0)
+	}()
+
 	// Channels to receive data back from parseBlueprintsFile goroutines
 	blueprintsCh := make(chan stringAndScope)
 	errsCh := make(chan []error)
@@ -724,6 +991,7 @@ func (c *Context) WalkBlueprintsFiles(rootFile string, handler FileHandler) (dep
 			return
 		}
 		blueprintsSet[blueprint.string] = true
+		progress.add(1)
 		count++
 		go func() {
 			c.parseBlueprintsFile(blueprint.string, blueprint.Scope, rootDir,
@@ -764,6 +1032,7 @@ loop:
 			startParseBlueprintsFile(blueprint)
 		case <-doneCh:
 			count--
+			progress.done()
 			if len(pending) > 0 {
 				startParseBlueprintsFile(pending[len(pending)-1])
 				pending = pending[:len(pending)-1]
@@ -777,6 +1046,30 @@ loop:
 	return
 }
 
+// OverlayFileSystem causes the Context to read the provided map of filenames to
+// contents instead of the files with the same names, and to include any new
+// files in it in globs.  It can be used to parse Blueprints files with unsaved
+// changes, for example from an editor.  It must be called before
+// ParseBlueprintsFiles.
+func (c *Context) OverlayFileSystem(files map[string][]byte) {
+	c.fs = pathtools.OverlayFs(c.fs, files)
+}
+
+// ReadGitRevision causes the Context to read the Blueprints files, and the
+// files matched by globs, from a revision of the git repository in the
+// directory repo instead of from the working tree, with paths relative to the
+// top of the repository.  It can be used with DiffModules to find the modules
+// changed between two revisions.  It must be called before
+// ParseBlueprintsFiles.
+func (c *Context) ReadGitRevision(repo, rev string) error {
+	fs, err := pathtools.GitFs(repo, rev)
+	if err != nil {
+		return err
+	}
+	c.fs = fs
+	return nil
+}
+
 // MockFileSystem causes the Context to replace all reads with accesses to the provided map of
 // filenames to contents stored as a byte slice.
 func (c *Context) MockFileSystem(files map[string][]byte) {
@@ -803,7 +1096,17 @@ func (c *Context) parseBlueprintsFile(filename string, scope *parser.Scope, root
 		}
 	}()
 
-	file, subBlueprints, errs := c.parse(rootDir, filename, f, scope)
+	file, subBlueprints, importDeps, errs := c.parse(rootDir, filename, f, scope)
+	for _, dep := range importDeps {
+		depsCh <- dep
+	}
+	if len(errs) == 0 {
+		var deps []string
+		deps, errs = c.runPreprocessors(file)
+		for _, dep := range deps {
+			depsCh <- dep
+		}
+	}
 	if len(errs) > 0 {
 		errsCh <- errs
 	} else {
@@ -956,14 +1259,22 @@ func (c *Context) cloneLogicModule(origModule *moduleInfo) (Module, []interface{
 		dst := reflect.ValueOf(newProperties[i]).Elem()
 		src := reflect.ValueOf(origModule.moduleProperties[i]).Elem()
 
-		proptools.CopyProperties(dst, src)
+		if c.memoryBudget != nil {
+			c.memoryBudget.propertyArena.CopyProperties(dst, src)
+		} else {
+			proptools.CopyProperties(dst, src)
+		}
 	}
 
 	return newLogicModule, newProperties
 }
 
+// A variationTransition returns the variation of the dependency dep to use for
+// the variant of a module with the given variation.
+type variationTransition func(variation string, dep depInfo) string
+
 func (c *Context) createVariations(origModule *moduleInfo, mutatorName string,
-	variationNames []string) ([]*moduleInfo, []error) {
+	variationNames []string, transition variationTransition) ([]*moduleInfo, []error) {
 
 	if len(variationNames) == 0 {
 		panic(fmt.Errorf("mutator %q passed zero-length variation list for module %q",
@@ -988,11 +1299,12 @@ func (c *Context) createVariations(origModule *moduleInfo, mutatorName string,
 		}
 
 		newVariant := origModule.variant.clone()
-		newVariant[mutatorName] = variationName
+		newVariant.set(mutatorName, variationName)
 
 		m := *origModule
 		newModule := &m
 		newModule.directDeps = append([]depInfo{}, origModule.directDeps...)
+		newModule.depEvents = append([]DependencyEvent(nil), origModule.depEvents...)
 		newModule.logicModule = newLogicModule
 		newModule.variant = newVariant
 		newModule.dependencyVariant = origModule.dependencyVariant.clone()
@@ -1008,7 +1320,7 @@ func (c *Context) createVariations(origModule *moduleInfo, mutatorName string,
 
 		newModules = append(newModules, newModule)
 
-		newErrs := c.convertDepsToVariation(newModule, mutatorName, variationName)
+		newErrs := c.convertDepsToVariation(newModule, mutatorName, variationName, transition)
 		if len(newErrs) > 0 {
 			errs = append(errs, newErrs...)
 		}
@@ -1024,14 +1336,21 @@ func (c *Context) createVariations(origModule *moduleInfo, mutatorName string,
 	return newModules, errs
 }
 
+// convertDepsToVariation replaces the dependencies of module on modules that
+// were split by the mutator with the variants with the same variation, or the
+// variations returned by transition if it is not nil.
 func (c *Context) convertDepsToVariation(module *moduleInfo,
-	mutatorName, variationName string) (errs []error) {
+	mutatorName, variationName string, transition variationTransition) (errs []error) {
 
 	for i, dep := range module.directDeps {
 		if dep.module.logicModule == nil {
+			depVariationName := variationName
+			if transition != nil {
+				depVariationName = transition(variationName, dep)
+			}
 			var newDep *moduleInfo
 			for _, m := range dep.module.splitModules {
-				if m.variant[mutatorName] == variationName {
+				if m.variant.is(mutatorName, depVariationName) {
 					newDep = m
 					break
 				}
@@ -1039,7 +1358,7 @@ func (c *Context) convertDepsToVariation(module *moduleInfo,
 			if newDep == nil {
 				errs = append(errs, &BlueprintError{
 					Err: fmt.Errorf("failed to find variation %q for module %q needed by %q",
-						variationName, dep.module.Name(), module.Name()),
+						depVariationName, dep.module.Name(), module.Name()),
 					Pos: module.pos,
 				})
 				continue
@@ -1052,9 +1371,9 @@ func (c *Context) convertDepsToVariation(module *moduleInfo,
 }
 
 func (c *Context) prettyPrintVariant(variant variationMap) string {
-	names := make([]string, 0, len(variant))
+	var names []string
 	for _, m := range c.variantMutatorNames {
-		if v, ok := variant[m]; ok {
+		if v, ok := variant.lookup(m); ok {
 			names = append(names, m+":"+v)
 		}
 	}
@@ -1079,19 +1398,77 @@ func (c *Context) processModuleDef(moduleDef *parser.Module,
 		}
 	}
 
+	if err := c.checkModuleType(moduleDef, relBlueprintsFile); err != nil {
+		return nil, []error{err}
+	}
+
 	logicModule, properties := factory()
 
 	module := &moduleInfo{
 		logicModule:       logicModule,
 		typeName:          moduleDef.Type,
 		relBlueprintsFile: relBlueprintsFile,
+		variant:           c.variationNames.newMap(),
+		dependencyVariant: c.variationNames.newMap(),
 	}
 
 	module.moduleProperties = properties
 
-	propertyMap, errs := unpackProperties(moduleDef.Properties, properties...)
+	propertyDefs := moduleDef.Properties
+	var variantsDef *parser.Property
+	if c.variantsMutatorRegistered {
+		propertyDefs, variantsDef = extractProperty(propertyDefs, variantsPropertyName)
+	}
+
+	var enabledDef *parser.Property
+	if c.enabledPropertySet {
+		propertyDefs, enabledDef = extractProperty(propertyDefs, enabledPropertyName)
+	}
+
+	if c.propertyOverrides != nil {
+		propertyDefs = c.propertyOverrides.apply(moduleDef, propertyDefs)
+	}
+
+	if c.strictPropertyConflicts {
+		var errs []error
+		for _, p := range properties {
+			for _, err := range proptools.PropertyConflicts(reflect.TypeOf(p).Elem()) {
+				errs = append(errs, &BlueprintError{
+					Err: fmt.Errorf("module type %q: %s", moduleDef.Type, err),
+					Pos: moduleDef.TypePos,
+				})
+			}
+		}
+		if len(errs) > 0 {
+			return nil, errs
+		}
+	}
+
+	propertyMap, errs := unpackProperties(propertyDefs, properties...)
 	if len(errs) > 0 {
-		return nil, errs
+		return nil, setPropertyErrorsModuleType(errs, moduleDef.Type)
+	}
+
+	if variantsDef != nil {
+		module.variantOverrides, errs = c.unpackVariantOverrides(variantsDef, properties)
+		if len(errs) > 0 {
+			return nil, setPropertyErrorsModuleType(errs, moduleDef.Type)
+		}
+	}
+
+	if enabledDef != nil {
+		errs = checkEnabledProperty(enabledDef)
+		if len(errs) > 0 {
+			return nil, errs
+		}
+		module.enabledDef = enabledDef
+	}
+
+	if c.propertyVariables != nil {
+		errs = interpolateProperties(properties, propertyMap, c.propertyVariables)
+		if len(errs) > 0 {
+			return nil, errs
+		}
 	}
 
 	module.pos = moduleDef.TypePos
@@ -1146,7 +1523,18 @@ func (c *Context) addModule(module *moduleInfo) []error {
 // the modules depended upon are defined and that no circular dependencies
 // exist.
 func (c *Context) ResolveDependencies(config interface{}) []error {
-	errs := c.updateDependencies()
+	errs := c.resolveDependencies(config)
+	c.recordErrors(errs)
+	return errs
+}
+
+func (c *Context) resolveDependencies(config interface{}) []error {
+	errs := c.evaluateEnabledProperties(config)
+	if len(errs) > 0 {
+		return errs
+	}
+
+	errs = c.updateDependencies()
 	if len(errs) > 0 {
 		return errs
 	}
@@ -1156,8 +1544,30 @@ func (c *Context) ResolveDependencies(config interface{}) []error {
 		return errs
 	}
 
+	errs = c.runDependencyInjectors(config)
+	if len(errs) > 0 {
+		return errs
+	}
+
 	c.cloneModules()
 
+	errs = c.checkDisabledDependencies()
+	if len(errs) > 0 {
+		return errs
+	}
+
+	if c.packages != nil {
+		errs = c.checkVisibility()
+		if len(errs) > 0 {
+			return errs
+		}
+	}
+
+	errs = c.runDepsResolvedHooks(config)
+	if len(errs) > 0 {
+		return errs
+	}
+
 	c.dependenciesReady = true
 	return nil
 }
@@ -1310,15 +1720,13 @@ func (c *Context) addVariationDependency(module *moduleInfo, variations []Variat
 
 	// We can't just append variant.Variant to module.dependencyVariants.variantName and
 	// compare the strings because the result won't be in mutator registration order.
-	// Create a new map instead, and then deep compare the maps.
-	var newVariant variationMap
+	// Create a new map instead, and then compare the maps.
+	newVariant := c.variationNames.newMap()
 	if !far {
 		newVariant = module.dependencyVariant.clone()
-	} else {
-		newVariant = make(variationMap)
 	}
 	for _, v := range variations {
-		newVariant[v.Mutator] = v.Variation
+		newVariant.set(v.Mutator, v.Variation)
 	}
 
 	for _, m := range possibleDeps {
@@ -1519,9 +1927,10 @@ func (c *Context) updateDependencies() (errs []error) {
 		for i := len(cycle) - 1; i >= 0; i-- {
 			nextModule := cycle[i]
 			errs = append(errs, &BlueprintError{
-				Err: fmt.Errorf("    %q depends on %q",
+				Err: fmt.Errorf("    %q depends on %q%s",
 					curModule.Name(),
-					nextModule.Name()),
+					nextModule.Name(),
+					c.injectedDepSuffix(curModule, nextModule)),
 				Pos: curModule.pos,
 			})
 			curModule = nextModule
@@ -1619,19 +2028,27 @@ func (c *Context) updateDependencies() (errs []error) {
 // config-specific values.
 //
 // The returned deps is a list of the ninja files dependencies that were added
-// by the modules and singletons via the ModuleContext.AddNinjaFileDeps(),
-// SingletonContext.AddNinjaFileDeps(), and PackageContext.AddNinjaFileDeps()
-// methods.
+// by the modules, mutators and singletons via the
+// BaseModuleContext.AddNinjaFileDeps(), SingletonContext.AddNinjaFileDeps(),
+// PackageContext.AddNinjaFileDeps() and Context.AddNinjaFileDeps() methods,
+// cleaned and without duplicates.
 func (c *Context) PrepareBuildActions(config interface{}) (deps []string, errs []error) {
+	defer func() { c.recordErrors(errs) }()
+
 	c.buildActionsReady = false
 
 	if !c.dependenciesReady {
-		errs := c.ResolveDependencies(config)
+		errs := c.resolveDependencies(config)
 		if len(errs) > 0 {
 			return nil, errs
 		}
 	}
 
+	errs = c.pruneUnreachableModules()
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
 	liveGlobals := newLiveTracker(config)
 
 	c.initSpecialVariables()
@@ -1652,9 +2069,12 @@ func (c *Context) PrepareBuildActions(config interface{}) (deps []string, errs [
 		liveGlobals.addNinjaStringDeps(c.ninjaBuildDir)
 	}
 
+	liveGlobals.addNinjaStringListDeps(c.subninjas)
+
 	pkgNames, depsPackages := c.makeUniquePackageNames(liveGlobals)
 
 	deps = append(deps, depsPackages...)
+	deps = normalizeNinjaFileDeps(append(deps, c.addedNinjaFileDeps()...))
 
 	// This will panic if it finds a problem since it's a programming error.
 	c.checkForVariableReferenceCycles(liveGlobals.variables, pkgNames)
@@ -1664,6 +2084,33 @@ func (c *Context) PrepareBuildActions(config interface{}) (deps []string, errs [
 	c.globalPools = liveGlobals.pools
 	c.globalRules = liveGlobals.rules
 
+	errs = c.resolveSymlinks()
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	errs = c.resolveOrderGroups()
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	errs = c.mergeIdempotentBuildDefs()
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	errs = c.checkConsoleActions()
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	c.applyActionTmpDir()
+
+	errs = c.selectDefaultTargets()
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
 	c.buildActionsReady = true
 
 	return deps, nil
@@ -1675,7 +2122,16 @@ func (c *Context) runMutators(config interface{}) (errs []error) {
 	mutators = append(mutators, c.earlyMutatorInfo...)
 	mutators = append(mutators, c.mutatorInfo...)
 
+	return c.runMutatorList(config, mutators)
+}
+
+// runMutatorList runs the mutators that are enabled for config in order, and
+// stops at the first one that reports errors.
+func (c *Context) runMutatorList(config interface{}, mutators []*mutatorInfo) (errs []error) {
 	for _, mutator := range mutators {
+		if !mutator.enabledFor(config) {
+			continue
+		}
 		if mutator.topDownMutator != nil {
 			errs = c.runMutator(config, mutator, topDownMutator)
 		} else if mutator.bottomUpMutator != nil {
@@ -1733,6 +2189,7 @@ var (
 type reverseDep struct {
 	module *moduleInfo
 	dep    depInfo
+	stack  []string // set if the dependencies of module are traced
 }
 
 func (c *Context) runMutator(config interface{}, mutator *mutatorInfo,
@@ -1750,6 +2207,7 @@ func (c *Context) runMutator(config interface{}, mutator *mutatorInfo,
 	}
 
 	reverseDeps := make(map[*moduleInfo][]depInfo)
+	var reverseDepEvents []reverseDep
 	var rename []rename
 	var replace []replace
 
@@ -1818,6 +2276,9 @@ func (c *Context) runMutator(config interface{}, mutator *mutatorInfo,
 			case globalStateChange := <-globalStateCh:
 				for _, r := range globalStateChange.reverse {
 					reverseDeps[r.module] = append(reverseDeps[r.module], r.dep)
+					if r.stack != nil {
+						reverseDepEvents = append(reverseDepEvents, r)
+					}
 				}
 				replace = append(replace, globalStateChange.replace...)
 				rename = append(rename, globalStateChange.rename...)
@@ -1870,6 +2331,11 @@ func (c *Context) runMutator(config interface{}, mutator *mutatorInfo,
 		c.depsModified++
 	}
 
+	for _, r := range reverseDepEvents {
+		r.module.depEvents = append(r.module.depEvents,
+			newDependencyEvent(r.dep, "AddReverseDependency", mutator.name, r.stack))
+	}
+
 	errs = c.handleRenames(rename)
 	if len(errs) > 0 {
 		return errs
@@ -1940,6 +2406,8 @@ func spliceModules(modules []*moduleInfo, i int, newModules []*moduleInfo) ([]*m
 
 func (c *Context) initSpecialVariables() {
 	c.ninjaBuildDir = nil
+	c.subninjas = nil
+	c.subninjaFiles = nil
 	c.requiredNinjaMajor = 1
 	c.requiredNinjaMinor = 7
 	c.requiredNinjaMicro = 0
@@ -1951,6 +2419,11 @@ func (c *Context) generateModuleBuildActions(config interface{},
 	var deps []string
 	var errs []error
 
+	prefixes, errs := c.moduleNamespacePrefixes()
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
 	cancelCh := make(chan struct{})
 	errsCh := make(chan []error)
 	depsCh := make(chan []string)
@@ -1970,12 +2443,19 @@ func (c *Context) generateModuleBuildActions(config interface{},
 		}
 	}()
 
+	progress := c.startProgress("generate", len(c.modulesSorted))
+
 	c.parallelVisit(bottomUpVisitor, func(module *moduleInfo) bool {
+		defer progress.done()
+
+		if module.disabledReason != "" {
+			return false
+		}
+
 		// The parent scope of the moduleContext's local scope gets overridden to be that of the
 		// calling Go package on a per-call basis.  Since the initial parent scope doesn't matter we
 		// just set it to nil.
-		prefix := moduleNamespacePrefix(module.group.ninjaName + "_" + module.variantName)
-		scope := newLocalScope(nil, prefix)
+		scope := newLocalScope(nil, prefixes[module])
 
 		mctx := &moduleContext{
 			baseModuleContext: baseModuleContext{
@@ -1987,7 +2467,7 @@ func (c *Context) generateModuleBuildActions(config interface{},
 			handledMissingDeps: module.missingDeps == nil,
 		}
 
-		func() {
+		c.profileModule(module, func() {
 			defer func() {
 				if r := recover(); r != nil {
 					in := fmt.Sprintf("GenerateBuildActions for %s", module)
@@ -2000,7 +2480,7 @@ func (c *Context) generateModuleBuildActions(config interface{},
 				}
 			}()
 			mctx.module.logicModule.GenerateBuildActions(mctx)
-		}()
+		})
 
 		if len(mctx.errs) > 0 {
 			errsCh <- mctx.errs
@@ -2022,6 +2502,12 @@ func (c *Context) generateModuleBuildActions(config interface{},
 
 		depsCh <- mctx.ninjaFileDeps
 
+		c.applyPoolPolicy(mctx.actionDefs.buildDefs, PoolPolicyInfo{
+			ModuleName: module.Name(),
+			ModuleType: module.typeName,
+			ModuleDir:  filepath.Dir(module.relBlueprintsFile),
+		})
+
 		newErrs := c.processLocalBuildActions(&module.actionDefs,
 			&mctx.actionDefs, liveGlobals)
 		if len(newErrs) > 0 {
@@ -2034,9 +2520,51 @@ func (c *Context) generateModuleBuildActions(config interface{},
 	cancelCh <- struct{}{}
 	<-cancelCh
 
+	progress.finish(len(errs) > 0)
+
 	return deps, errs
 }
 
+// moduleNamespacePrefixes returns the Ninja namespace prefix for each module
+// variant, mangling the variant names as configured by SetVariantNameMangling.
+func (c *Context) moduleNamespacePrefixes() (map[*moduleInfo]string, []error) {
+	var mutatorNames []string
+	for _, mutator := range c.earlyMutatorInfo {
+		mutatorNames = append(mutatorNames, mutator.name)
+	}
+	for _, mutator := range c.mutatorInfo {
+		mutatorNames = append(mutatorNames, mutator.name)
+	}
+
+	mangling := c.variantNameMangling
+	prefixes := make(map[*moduleInfo]string, len(c.moduleInfo))
+	owners := make(map[string]*moduleInfo, len(c.moduleInfo))
+
+	var errs []error
+
+	for _, module := range c.modulesSorted {
+		variantName := module.variantName
+		if mangling != (VariantNameMangling{}) {
+			variantName = mangling.mangle(mutatorNames, module.variant)
+		}
+
+		prefix := moduleNamespacePrefix(module.group.ninjaName + mangling.separator() + variantName)
+		if other, ok := owners[prefix]; ok {
+			errs = append(errs, &BlueprintError{
+				Err: fmt.Errorf("%s and %s both mangle to Ninja name prefix %q",
+					other, module, prefix),
+				Pos: module.pos,
+			})
+			continue
+		}
+
+		owners[prefix] = module
+		prefixes[module] = prefix
+	}
+
+	return prefixes, errs
+}
+
 func (c *Context) generateSingletonBuildActions(config interface{},
 	liveGlobals *liveTracker) ([]string, []error) {
 
@@ -2081,6 +2609,10 @@ func (c *Context) generateSingletonBuildActions(config interface{},
 
 		deps = append(deps, sctx.ninjaFileDeps...)
 
+		c.applyPoolPolicy(sctx.actionDefs.buildDefs, PoolPolicyInfo{
+			SingletonName: info.name,
+		})
+
 		newErrs := c.processLocalBuildActions(&info.actionDefs,
 			&sctx.actionDefs, liveGlobals)
 		errs = append(errs, newErrs...)
@@ -2111,6 +2643,12 @@ func (c *Context) processLocalBuildActions(out, in *localBuildActions,
 		return errs
 	}
 
+	if c.descriptionTemplates != nil {
+		for _, def := range in.buildDefs {
+			c.descriptionTemplates.apply(def)
+		}
+	}
+
 	out.buildDefs = append(out.buildDefs, in.buildDefs...)
 
 	// We use the now-incorrect set of live "globals" to determine which local
@@ -2281,6 +2819,14 @@ func (c *Context) visitAllModules(visit func(Module)) {
 	}
 }
 
+func (c *Context) visitAllModuleInfos(visit func(*moduleInfo)) {
+	for _, moduleName := range c.sortedModuleNames() {
+		for _, module := range c.modulesFromName(moduleName) {
+			visit(module)
+		}
+	}
+}
+
 func (c *Context) visitAllModulesIf(pred func(Module) bool,
 	visit func(Module)) {
 
@@ -2339,6 +2885,19 @@ func (c *Context) setNinjaBuildDir(value *ninjaString) {
 	}
 }
 
+func (c *Context) addSubninja(value *ninjaString) {
+	c.subninjas = append(c.subninjas, value)
+}
+
+func (c *Context) addSubninjaFile(file string) {
+	for _, f := range c.subninjaFiles {
+		if f == file {
+			return
+		}
+	}
+	c.subninjaFiles = append(c.subninjaFiles, file)
+}
+
 func (c *Context) makeUniquePackageNames(
 	liveGlobals *liveTracker) (map[*packageContext]string, []string) {
 
@@ -2671,13 +3230,25 @@ func (c *Context) VisitAllModuleVariants(module Module,
 // actions to w.  If this is called before PrepareBuildActions successfully
 // completes then ErrBuildActionsNotReady is returned.
 func (c *Context) WriteBuildFile(w io.Writer) error {
+	return c.writeBuildFile(newNinjaWriter(w))
+}
+
+func (c *Context) writeBuildFile(nw *ninjaWriter) error {
 	if !c.buildActionsReady {
 		return ErrBuildActionsNotReady
 	}
 
-	nw := newNinjaWriter(w)
+	err := c.checkOutputPaths()
+	if err != nil {
+		return err
+	}
 
-	err := c.writeBuildFileHeader(nw)
+	err = c.checkNinjaEscapes()
+	if err != nil {
+		return err
+	}
+
+	err = c.writeBuildFileHeader(nw)
 	if err != nil {
 		return err
 	}
@@ -2719,6 +3290,16 @@ func (c *Context) WriteBuildFile(w io.Writer) error {
 		return err
 	}
 
+	err = c.writeSubninjas(nw)
+	if err != nil {
+		return err
+	}
+
+	err = c.writeDefaultTargets(nw)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -2771,8 +3352,18 @@ func (c *Context) writeBuildFileHeader(nw *ninjaWriter) error {
 
 	sort.Sort(&pkgAssociationSorter{pkgs})
 
+	type preprocessorFingerprint struct {
+		Name, Fingerprint string
+	}
+
+	var preprocessors []preprocessorFingerprint
+	for _, p := range c.preprocessors {
+		preprocessors = append(preprocessors, preprocessorFingerprint{p.name, p.fingerprint})
+	}
+
 	params := map[string]interface{}{
-		"Pkgs": pkgs,
+		"Pkgs":          pkgs,
+		"Preprocessors": preprocessors,
 	}
 
 	buf := bytes.NewBuffer(nil)
@@ -2811,6 +3402,100 @@ func (c *Context) writeBuildDir(nw *ninjaWriter) error {
 	return nil
 }
 
+func (c *Context) writeSubninjas(nw *ninjaWriter) error {
+	if len(c.subninjas)+len(c.subninjaFiles) == 0 {
+		return nil
+	}
+
+	nw.Segment("subninjas")
+
+	for _, subninja := range c.subninjas {
+		err := nw.Subninja(subninja.ValueWithEscaper(c.pkgNames, inputEscaper))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, file := range c.subninjaFiles {
+		err := nw.Subninja(file)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nw.BlankLine()
+}
+
+// SubninjaFiles returns the paths of the Ninja files that singletons wrote
+// build statements to with SingletonContext.BuildInSubninja.  Each of them must
+// be written with WriteSubninjaFile, as they are included by the main Ninja
+// file.
+func (c *Context) SubninjaFiles() []string {
+	return append([]string(nil), c.subninjaFiles...)
+}
+
+// WriteSingletonFiles calls WriteFiles on the registered singletons that
+// implement SingletonFileWriter, in the order they were registered, after
+// PrepareBuildActions.  failed is passed to WriteFiles, and must be true if
+// PrepareBuildActions returned errors.
+func (c *Context) WriteSingletonFiles(failed bool) []error {
+	var errs []error
+	for _, info := range c.singletonInfo {
+		if w, ok := info.singleton.(SingletonFileWriter); ok {
+			if err := w.WriteFiles(failed); err != nil {
+				errs = append(errs, fmt.Errorf("error writing the files of singleton %s: %s",
+					info.name, err))
+			}
+		}
+	}
+	return errs
+}
+
+// WriteSubninjaFile writes the build statements for the subninja file with the
+// given path to w.  The rules, pools and variables they use are defined in the
+// main Ninja file.  If this is called before PrepareBuildActions successfully
+// completes then ErrBuildActionsNotReady is returned.
+func (c *Context) WriteSubninjaFile(file string, w io.Writer) error {
+	if !c.buildActionsReady {
+		return ErrBuildActionsNotReady
+	}
+
+	nw := newNinjaWriter(w)
+
+	err := nw.Comment("This file is generated and should not be edited.  It is included by " +
+		"the main Ninja file with subninja.")
+	if err != nil {
+		return err
+	}
+
+	err = nw.BlankLine()
+	if err != nil {
+		return err
+	}
+
+	for _, info := range c.singletonInfo {
+		for _, def := range info.actionDefs.buildDefs {
+			if def.Subninja != file {
+				continue
+			}
+
+			err = def.WriteTo(nw, c.pkgNames)
+			if err != nil {
+				return err
+			}
+
+			if len(def.Args) > 0 {
+				err = nw.BlankLine()
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
 type globalEntity interface {
 	fullName(pkgNames map[*packageContext]string) string
 }
@@ -2998,6 +3683,7 @@ func (c *Context) writeAllModuleActions(nw *ninjaWriter) error {
 			continue
 		}
 
+		nw.Segment(module.String())
 		buf.Reset()
 
 		// In order to make the bootstrap build manifest independent of the
@@ -3062,6 +3748,8 @@ func (c *Context) writeAllSingletonActions(nw *ninjaWriter) error {
 			continue
 		}
 
+		nw.Segment(fmt.Sprintf("singleton %q", info.name))
+
 		// Get the name of the factory function for the module.
 		factory := info.factory
 		factoryFunc := runtime.FuncForPC(reflect.ValueOf(factory).Pointer())
@@ -3149,6 +3837,11 @@ func (c *Context) writeLocalBuildActions(nw *ninjaWriter,
 
 	// Write the build definitions.
 	for _, buildDef := range defs.buildDefs {
+		if buildDef.Subninja != "" {
+			// Written by WriteSubninjaFile
+			continue
+		}
+
 		err := buildDef.WriteTo(nw, c.pkgNames)
 		if err != nil {
 			return err
@@ -3221,7 +3914,11 @@ This file contains variables, rules, and pools with name prefixes indicating
 they were generated by the following Go packages:
 {{range .Pkgs}}
     {{.PkgName}} [from Go package {{.PkgPath}}]{{end}}{{end}}
-
+{{if .Preprocessors}}
+The Blueprints files were preprocessed by:
+{{range .Preprocessors}}
+    {{.Name}} [{{.Fingerprint}}]{{end}}
+{{end}}
 `
 
 var moduleHeaderTemplate = `# # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # 
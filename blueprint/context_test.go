@@ -16,6 +16,8 @@ package blueprint
 
 import (
 	"bytes"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -95,7 +97,7 @@ func TestContextParse(t *testing.T) {
 		}
 	`)
 
-	_, _, errs := ctx.parse(".", "Blueprint", r, nil)
+	_, _, _, errs := ctx.parse(".", "Blueprint", r, nil)
 	if len(errs) > 0 {
 		t.Errorf("unexpected parse errors:")
 		for _, err := range errs {
@@ -201,3 +203,208 @@ func TestWalkDeps(t *testing.T) {
 		t.Fatalf("unexpected walkDeps behaviour: %s\nup should be: GFC", outputUp)
 	}
 }
+
+type subninjaSingleton struct{}
+
+func (s *subninjaSingleton) GenerateBuildActions(ctx SingletonContext) {
+	ctx.AddSubninja(verifyTestPctx, "${outDir}/other.ninja")
+	ctx.AddSubninja(verifyTestPctx, "extra dir/extra.ninja")
+}
+
+func TestAddSubninja(t *testing.T) {
+	ctx := NewContext()
+	ctx.RegisterSingletonType("subninja", func() Singleton { return &subninjaSingleton{} })
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": nil,
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) == 0 {
+		_, errs = ctx.PrepareBuildActions(nil)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := ctx.WriteBuildFile(buf); err != nil {
+		t.Fatalf("unexpected error writing build file: %s", err)
+	}
+
+	expected := "subninja ${g.verifytest.outDir}/other.ninja\n" +
+		"subninja extra$ dir/extra.ninja\n"
+	if !strings.Contains(buf.String(), expected) {
+		t.Errorf("expected build file to contain %q, got:\n%s", expected, buf.String())
+	}
+}
+
+type buildInSubninjaSingleton struct{}
+
+func (s *buildInSubninjaSingleton) GenerateBuildActions(ctx SingletonContext) {
+	ctx.BuildInSubninja(verifyTestPctx, "out/b.ninja", BuildParams{
+		Rule:    verifyTestTouch,
+		Outputs: []string{"${outDir}/b1"},
+	})
+	ctx.BuildInSubninja(verifyTestPctx, "out/a.ninja", BuildParams{
+		Rule:    verifyTestTouch,
+		Outputs: []string{"${outDir}/a"},
+	})
+	ctx.BuildInSubninja(verifyTestPctx, "out/b.ninja", BuildParams{
+		Rule:    verifyTestTouch,
+		Outputs: []string{"${outDir}/b2"},
+	})
+	ctx.Build(verifyTestPctx, BuildParams{
+		Rule:    verifyTestTouch,
+		Outputs: []string{"${outDir}/main"},
+	})
+}
+
+func TestBuildInSubninja(t *testing.T) {
+	ctx := NewContext()
+	ctx.RegisterSingletonType("subninja", func() Singleton { return &buildInSubninjaSingleton{} })
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": nil,
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) == 0 {
+		_, errs = ctx.PrepareBuildActions(nil)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := ctx.WriteBuildFile(buf); err != nil {
+		t.Fatalf("unexpected error writing build file: %s", err)
+	}
+	main := buf.String()
+
+	if !strings.Contains(main, "subninja out/b.ninja\nsubninja out/a.ninja\n") {
+		t.Errorf("missing subninja statements in:\n%s", main)
+	}
+	if !strings.Contains(main, "build ${g.verifytest.outDir}/main:") ||
+		strings.Contains(main, "build ${g.verifytest.outDir}/a:") {
+		t.Errorf("incorrect build statements in main Ninja file:\n%s", main)
+	}
+	if !strings.Contains(main, "rule g.verifytest.touch\n") {
+		t.Errorf("missing rule definition in main Ninja file:\n%s", main)
+	}
+
+	if files := ctx.SubninjaFiles(); !reflect.DeepEqual(files, []string{"out/b.ninja", "out/a.ninja"}) {
+		t.Errorf("incorrect subninja files: %q", files)
+	}
+
+	buf.Reset()
+	if err := ctx.WriteSubninjaFile("out/b.ninja", buf); err != nil {
+		t.Fatalf("unexpected error writing subninja file: %s", err)
+	}
+	expected := "build ${g.verifytest.outDir}/b1: g.verifytest.touch\n" +
+		"default ${g.verifytest.outDir}/b1\n" +
+		"\n" +
+		"build ${g.verifytest.outDir}/b2: g.verifytest.touch\n" +
+		"default ${g.verifytest.outDir}/b2\n" +
+		"\n"
+	if !strings.HasSuffix(buf.String(), expected) {
+		t.Errorf("incorrect subninja file, expected suffix %q, got:\n%s", expected, buf.String())
+	}
+}
+
+func TestMacros(t *testing.T) {
+	ctx := NewContext()
+	ctx.RegisterModuleType("foo_module", newFooModule)
+	ctx.RegisterModuleType("bar_module", newBarModule)
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			subdirs = ["sub"]
+			macro foo_pair(name) {
+				foo_module { name: name }
+				bar_module { name: name + "_bar", deps: [name] }
+			}
+		`),
+		"sub/Blueprints": []byte(`
+			foo_pair { name: "A" }
+		`),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) == 0 {
+		errs = ctx.ResolveDependencies(nil)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+
+	a := ctx.modulesFromName("A")
+	aBar := ctx.modulesFromName("A_bar")
+	if len(a) != 1 || len(aBar) != 1 {
+		t.Fatalf("expected modules A and A_bar")
+	}
+	if deps := aBar[0].directDeps; len(deps) != 1 || deps[0].module != a[0] {
+		t.Errorf("expected A_bar to depend on A, got %v", deps)
+	}
+	if pos := aBar[0].pos; pos.Filename != "sub/Blueprints" || pos.Line != 2 {
+		t.Errorf("expected A_bar at the instantiation, got %s", pos)
+	}
+
+	ctx = NewContext()
+	ctx.RegisterModuleType("foo_module", newFooModule)
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`macro foo_module(name) {}`),
+	})
+	_, errs = ctx.ParseBlueprintsFiles("Blueprints")
+	expected := `Blueprints:1:7: macro "foo_module" hides the module type with the same name`
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Errorf("expected error %q, got %q", expected, errs)
+	}
+}
+
+func TestMutatorEnabledIf(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		ctx := NewContext()
+		ctx.RegisterModuleType("foo_module", newFooModule)
+		ctx.RegisterBottomUpMutator("coverage", func(mctx BottomUpMutatorContext) {
+			mctx.CreateVariations("cov", "nocov")
+		}).EnabledIf(func(config interface{}) bool {
+			return config.(bool)
+		})
+		ctx.RegisterBottomUpMutator("arch", func(mctx BottomUpMutatorContext) {
+			mctx.CreateVariations("arm")
+		})
+		ctx.MockFileSystem(map[string][]byte{
+			"Blueprints": []byte(`
+				foo_module {
+					name: "A",
+				}
+			`),
+		})
+
+		_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+		if len(errs) == 0 {
+			errs = ctx.ResolveDependencies(enabled)
+		}
+		if len(errs) > 0 {
+			t.Fatalf("unexpected errors: %q", errs)
+		}
+
+		var ids []string
+		for _, variant := range ctx.ModuleVariantsForTesting("A") {
+			ids = append(ids, variant.ID)
+		}
+		expectedIDs := []string{"A{arch=arm}"}
+		if enabled {
+			expectedIDs = []string{"A{arch=arm,coverage=cov}", "A{arch=arm,coverage=nocov}"}
+		}
+		if !reflect.DeepEqual(ids, expectedIDs) {
+			t.Errorf("enabled %v: expected variants %q, got %q", enabled, expectedIDs, ids)
+		}
+
+		mutators := strings.Join(ctx.EnabledMutators(enabled), " ")
+		if strings.Contains(mutators, "coverage") != enabled {
+			t.Errorf("enabled %v: unexpected enabled mutators %q", enabled, mutators)
+		}
+		if !strings.Contains(mutators, "arch") {
+			t.Errorf("enabled %v: expected the arch mutator in %q", enabled, mutators)
+		}
+	}
+}
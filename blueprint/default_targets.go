@@ -0,0 +1,174 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A DefaultTarget is an output nominated as a default target of the Ninja file
+// with BuildParams.DefaultPriority.
+type DefaultTarget struct {
+	// Output is the output, with its Ninja variables expanded.
+	Output string
+
+	Priority int
+
+	// Owner is the string form of the VariantID of the module variant, or the
+	// name of the singleton, that nominated the output.
+	Owner string
+}
+
+// A DefaultTargetPolicy picks the default targets of the Ninja file from the
+// nominated outputs, in the order the build statements are written in.  It
+// may return outputs that were not nominated, like phony targets, and the
+// outputs it returns are written to the Ninja file in the order it returns
+// them.  If it returns no outputs then Ninja builds all the outputs when it is
+// run without arguments.
+type DefaultTargetPolicy func(nominated []DefaultTarget) []string
+
+// DefaultTargetsWithPriority returns a DefaultTargetPolicy that picks the
+// nominated outputs with at least the given priority.
+func DefaultTargetsWithPriority(priority int) DefaultTargetPolicy {
+	return func(nominated []DefaultTarget) []string {
+		var ret []string
+		for _, target := range nominated {
+			if target.Priority >= priority {
+				ret = append(ret, target.Output)
+			}
+		}
+		return ret
+	}
+}
+
+// SetDefaultTargetPolicy sets the policy that picks the default targets of the
+// Ninja file from the outputs nominated with BuildParams.DefaultPriority.  By
+// default all the nominated outputs are picked, and if none are nominated the
+// outputs of all the build statements that are not Optional are default
+// targets.
+func (c *Context) SetDefaultTargetPolicy(policy DefaultTargetPolicy) {
+	c.defaultTargetPolicy = policy
+}
+
+// selectDefaultTargets collects the nominated default targets and applies the
+// default target policy to them.  If the default targets are picked by the
+// policy, all the build statements are made Optional so that they don't write
+// their own default statements.
+func (c *Context) selectDefaultTargets() []error {
+	c.defaultTargets = nil
+
+	var nominated []DefaultTarget
+	var errs []error
+	nominate := func(owner string, actionDefs *localBuildActions) {
+		variables, err := c.localVariableValues(actionDefs)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error evaluating default targets of %s: %s", owner, err))
+			return
+		}
+		for _, def := range actionDefs.buildDefs {
+			if def.DefaultPriority == 0 {
+				continue
+			}
+			for _, output := range def.Outputs {
+				value, err := output.Eval(variables)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("error evaluating default target of %s: %s", owner, err))
+					continue
+				}
+				nominated = append(nominated, DefaultTarget{
+					Output:   value,
+					Priority: def.DefaultPriority,
+					Owner:    owner,
+				})
+			}
+		}
+	}
+
+	for _, module := range c.modulesSorted {
+		nominate(module.variantID().String(), &module.actionDefs)
+	}
+	for _, info := range c.singletonInfo {
+		nominate(info.name, &info.actionDefs)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	policy := c.defaultTargetPolicy
+	if policy == nil {
+		if len(nominated) == 0 {
+			return nil
+		}
+		policy = DefaultTargetsWithPriority(1)
+	}
+
+	c.defaultTargets = policy(nominated)
+	if c.defaultTargets == nil {
+		c.defaultTargets = []string{}
+	}
+
+	// A newline can't be escaped in a Ninja path, $ followed by a newline
+	// continues the line instead.
+	for _, target := range c.defaultTargets {
+		if strings.Contains(target, "\n") {
+			errs = append(errs, fmt.Errorf("default target %q contains a newline", target))
+		}
+	}
+	if len(errs) > 0 {
+		c.defaultTargets = nil
+		return errs
+	}
+
+	for _, module := range c.modulesSorted {
+		for _, def := range module.actionDefs.buildDefs {
+			def.Optional = true
+		}
+	}
+	for _, info := range c.singletonInfo {
+		for _, def := range info.actionDefs.buildDefs {
+			def.Optional = true
+		}
+	}
+
+	return nil
+}
+
+// defaultTargetEscaper escapes an output with its Ninja variables expanded to
+// be written to a default statement.
+var defaultTargetEscaper = strings.NewReplacer(
+	"$", "$$",
+	" ", "$ ",
+	":", "$:")
+
+// writeDefaultTargets writes the default statement with the default targets
+// picked by the default target policy, if there are any.
+func (c *Context) writeDefaultTargets(nw *ninjaWriter) error {
+	if len(c.defaultTargets) == 0 {
+		return nil
+	}
+
+	targets := make([]string, len(c.defaultTargets))
+	for i, target := range c.defaultTargets {
+		targets[i] = defaultTargetEscaper.Replace(target)
+	}
+
+	err := nw.Default(targets...)
+	if err != nil {
+		return err
+	}
+
+	return nw.BlankLine()
+}
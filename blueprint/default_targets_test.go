@@ -0,0 +1,208 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var (
+	defaultTargetsTestPctx = NewPackageContext("github.com/google/blueprint/defaulttargetstest")
+
+	_ = defaultTargetsTestPctx.StaticVariable("outDir", "out")
+
+	defaultTargetsTestTouch = defaultTargetsTestPctx.StaticRule("touch",
+		RuleParams{
+			Command: "touch $out",
+		})
+)
+
+type defaultTargetsTestSingleton struct {
+	priorities map[string]int
+}
+
+func (s *defaultTargetsTestSingleton) GenerateBuildActions(ctx SingletonContext) {
+	for _, output := range []string{"a", "b", "c d"} {
+		ctx.Build(defaultTargetsTestPctx, BuildParams{
+			Rule:            defaultTargetsTestTouch,
+			Outputs:         []string{"${outDir}/" + output},
+			DefaultPriority: s.priorities[output],
+		})
+	}
+}
+
+// defaultTargetsTestDefaults returns the default statements of the Ninja file
+// generated with the given priorities and policy.
+func defaultTargetsTestDefaults(t *testing.T, priorities map[string]int,
+	policy DefaultTargetPolicy) []string {
+
+	ctx := NewContext()
+	ctx.RegisterSingletonType("default_targets", func() Singleton {
+		return &defaultTargetsTestSingleton{priorities}
+	})
+	if policy != nil {
+		ctx.SetDefaultTargetPolicy(policy)
+	}
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": nil,
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) == 0 {
+		_, errs = ctx.PrepareBuildActions(nil)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := ctx.WriteBuildFile(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var defaults []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, "default ") {
+			defaults = append(defaults, line)
+		}
+	}
+	return defaults
+}
+
+func TestDefaultTargets(t *testing.T) {
+	testCases := []struct {
+		name       string
+		priorities map[string]int
+		policy     DefaultTargetPolicy
+		defaults   []string
+	}{
+		{
+			name: "not nominated",
+			defaults: []string{
+				"default ${g.defaulttargetstest.outDir}/a",
+				"default ${g.defaulttargetstest.outDir}/b",
+				"default ${g.defaulttargetstest.outDir}/c$ d",
+			},
+		},
+		{
+			name:       "nominated",
+			priorities: map[string]int{"a": 1, "c d": 2},
+			defaults:   []string{"default out/a out/c$ d"},
+		},
+		{
+			name:       "priority",
+			priorities: map[string]int{"a": 1, "c d": 2},
+			policy:     DefaultTargetsWithPriority(2),
+			defaults:   []string{"default out/c$ d"},
+		},
+		{
+			name:       "config",
+			priorities: map[string]int{"a": 1},
+			policy: func(nominated []DefaultTarget) []string {
+				expected := []DefaultTarget{{Output: "out/a", Priority: 1, Owner: "default_targets"}}
+				if !reflect.DeepEqual(nominated, expected) {
+					t.Errorf("expected nominated targets %v, got %v", expected, nominated)
+				}
+				return []string{"out/b", "out/a"}
+			},
+			defaults: []string{"default out/b out/a"},
+		},
+		{
+			name:       "none picked",
+			priorities: map[string]int{"a": 1},
+			policy:     DefaultTargetsWithPriority(2),
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			defaults := defaultTargetsTestDefaults(t, testCase.priorities, testCase.policy)
+			if !reflect.DeepEqual(defaults, testCase.defaults) {
+				t.Errorf("incorrect default statements:\nwant: %q\n got: %q", testCase.defaults, defaults)
+			}
+		})
+	}
+}
+
+type defaultTargetsLocalTestSingleton struct {
+	output string
+}
+
+func (s *defaultTargetsLocalTestSingleton) GenerateBuildActions(ctx SingletonContext) {
+	ctx.Variable(defaultTargetsTestPctx, "loc", "out/local")
+	ctx.Build(defaultTargetsTestPctx, BuildParams{
+		Rule:            defaultTargetsTestTouch,
+		Outputs:         []string{s.output},
+		DefaultPriority: 1,
+	})
+}
+
+func defaultTargetsLocalTest(t *testing.T, output string) (string, []error) {
+	ctx := NewContext()
+	ctx.RegisterSingletonType("default_targets", func() Singleton {
+		return &defaultTargetsLocalTestSingleton{output}
+	})
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": nil,
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) == 0 {
+		_, errs = ctx.PrepareBuildActions(nil)
+	}
+	if len(errs) > 0 {
+		return "", errs
+	}
+
+	buf := &bytes.Buffer{}
+	if err := ctx.WriteBuildFile(buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String(), nil
+}
+
+func TestDefaultTargetsLocalVariable(t *testing.T) {
+	out, errs := defaultTargetsLocalTest(t, "${loc}/x")
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if !strings.Contains(out, "\ndefault out/local/x\n") {
+		t.Errorf("expected a default statement for out/local/x in:\n%s", out)
+	}
+}
+
+func TestDefaultTargetsNewline(t *testing.T) {
+	ctx := NewContext()
+	ctx.SetDefaultTargetPolicy(func([]DefaultTarget) []string {
+		return []string{"out/a\nb"}
+	})
+	ctx.RegisterSingletonType("default_targets", func() Singleton {
+		return &defaultTargetsLocalTestSingleton{"${loc}/x"}
+	})
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": nil,
+	})
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) == 0 {
+		_, errs = ctx.PrepareBuildActions(nil)
+	}
+	expected := `default target "out/a\nb" contains a newline`
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, errs)
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// A DependencyEvent records a dependency added to a module variant while
+// dependency tracing is enabled with TraceDependencies.
+type DependencyEvent struct {
+	// Call is the method that added the dependency, for example
+	// AddVariationDependencies.  The dependency of a module on the module
+	// that called AddReverseDependency is recorded on the former.
+	Call string
+
+	// Mutator is the name of the mutator or dependency injector that added
+	// the dependency.
+	Mutator string
+
+	// Dependency and DependencyVariant identify the module variant that was
+	// added as a dependency.
+	Dependency        string
+	DependencyVariant string
+
+	Tag DependencyTag
+
+	// Stack lists the callers of Call in the mutator or dependency injector as
+	// "function file:line", innermost first.
+	Stack []string
+}
+
+// maxDependencyTraceDepth is the maximum length of DependencyEvent.Stack.
+const maxDependencyTraceDepth = 16
+
+// blueprintPkgPath is the path of this package, used to find the end of the
+// mutator and dependency injector frames of a stack.
+var blueprintPkgPath = reflect.TypeOf(Context{}).PkgPath()
+
+// TraceDependencies enables recording a DependencyEvent for each dependency
+// added by a mutator or a dependency injector to the variants of the named
+// modules, or of all modules if no name is given.  The stack of every call is
+// recorded, so tracing all the modules of a large build is slow.  It must be
+// called before ResolveDependencies.
+func (c *Context) TraceDependencies(modules ...string) {
+	c.traceAllDeps = len(modules) == 0
+	c.traceDepsModules = make(map[string]bool, len(modules))
+	for _, name := range modules {
+		c.traceDepsModules[name] = true
+	}
+}
+
+// DependencyEvents returns the recorded DependencyEvents of a module variant
+// in the order the dependencies were added, except that reverse dependencies
+// are added at the end of each mutator.
+func (c *Context) DependencyEvents(module Module) []DependencyEvent {
+	return c.moduleInfo[module].depEvents
+}
+
+// WriteDependencyTrace writes the recorded DependencyEvents of every traced
+// module variant to w in a human readable form.
+func (c *Context) WriteDependencyTrace(w io.Writer) error {
+	var modules []*moduleInfo
+	for _, module := range c.moduleInfo {
+		if len(module.depEvents) > 0 {
+			modules = append(modules, module)
+		}
+	}
+	sort.Sort(moduleSorter(modules))
+
+	for _, module := range modules {
+		_, err := fmt.Fprintf(w, "%s:\n", module)
+		if err != nil {
+			return err
+		}
+		for _, event := range module.depEvents {
+			dep := fmt.Sprintf("%q", event.Dependency)
+			if event.DependencyVariant != "" {
+				dep += fmt.Sprintf(" variant %q", event.DependencyVariant)
+			}
+			_, err := fmt.Fprintf(w, "  %s with tag %T by %s in %q\n", dep, event.Tag, event.Call,
+				event.Mutator)
+			if err != nil {
+				return err
+			}
+			for _, frame := range event.Stack {
+				_, err := fmt.Fprintf(w, "      %s\n", frame)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// tracingDependencies returns true if the dependencies added to module are
+// recorded.
+func (c *Context) tracingDependencies(module *moduleInfo) bool {
+	return c.traceAllDeps || c.traceDepsModules[module.Name()]
+}
+
+// traceDependencies records the dependencies of module after the first
+// before as added by call in mutator.
+func (c *Context) traceDependencies(module *moduleInfo, before int, call, mutator string) {
+	if !c.tracingDependencies(module) || len(module.directDeps) <= before {
+		return
+	}
+
+	stack := dependencyTraceStack(2)
+	for _, dep := range module.directDeps[before:] {
+		module.depEvents = append(module.depEvents, newDependencyEvent(dep, call, mutator, stack))
+	}
+}
+
+func newDependencyEvent(dep depInfo, call, mutator string, stack []string) DependencyEvent {
+	return DependencyEvent{
+		Call:              call,
+		Mutator:           mutator,
+		Dependency:        dep.module.Name(),
+		DependencyVariant: dep.module.variantName,
+		Tag:               dep.tag,
+		Stack:             stack,
+	}
+}
+
+// dependencyTraceStack returns the frames of the stack of its caller without
+// the innermost skip frames, up to the frame of the Context method that called
+// the mutator or dependency injector.
+func dependencyTraceStack(skip int) []string {
+	pcs := make([]uintptr, maxDependencyTraceDepth)
+	n := runtime.Callers(skip+2, pcs)
+
+	var stack []string
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if strings.HasPrefix(frame.Function, blueprintPkgPath+".(*Context).") ||
+			frame.Function == blueprintPkgPath+".bottomUpMutatorImpl.run" ||
+			frame.Function == blueprintPkgPath+".topDownMutatorImpl.run" {
+			break
+		}
+		stack = append(stack, fmt.Sprintf("%s %s:%d", frame.Function, frame.File, frame.Line))
+		if !more {
+			break
+		}
+	}
+	return stack
+}
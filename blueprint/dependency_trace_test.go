@@ -0,0 +1,114 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+type traceTestDepTag struct {
+	BaseDependencyTag
+}
+
+func addTraceTestDeps(ctx BottomUpMutatorContext) {
+	ctx.AddDependency(ctx.Module(), traceTestDepTag{}, "B")
+}
+
+func TestTraceDependencies(t *testing.T) {
+	ctx := NewContext()
+	ctx.RegisterModuleType("foo_module", newFooModule)
+	ctx.RegisterBottomUpMutator("deps", func(ctx BottomUpMutatorContext) {
+		switch ctx.ModuleName() {
+		case "A":
+			addTraceTestDeps(ctx)
+		case "B":
+			ctx.AddDependency(ctx.Module(), traceTestDepTag{}, "C")
+		case "C":
+			ctx.AddReverseDependency(ctx.Module(), traceTestDepTag{}, "A")
+		}
+	})
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			foo_module {
+			    name: "A",
+			}
+
+			foo_module {
+			    name: "B",
+			}
+
+			foo_module {
+			    name: "C",
+			}
+		`),
+	})
+	ctx.TraceDependencies("A")
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) == 0 {
+		errs = ctx.ResolveDependencies(nil)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+
+	var a, b Module
+	ctx.VisitAllModules(func(m Module) {
+		switch ctx.ModuleName(m) {
+		case "A":
+			a = m
+		case "B":
+			b = m
+		}
+	})
+
+	events := ctx.DependencyEvents(a)
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %+v", events)
+	}
+
+	if e := events[0]; e.Call != "AddDependency" || e.Mutator != "deps" || e.Dependency != "B" ||
+		e.Tag != (traceTestDepTag{}) {
+		t.Errorf("unexpected event %+v", e)
+	} else if len(e.Stack) < 2 || !strings.Contains(e.Stack[0], ".addTraceTestDeps ") ||
+		!strings.Contains(e.Stack[0], "dependency_trace_test.go:") {
+		t.Errorf("expected the stack to start in addTraceTestDeps, got %q", e.Stack)
+	}
+
+	if e := events[1]; e.Call != "AddReverseDependency" || e.Mutator != "deps" || e.Dependency != "C" ||
+		len(e.Stack) != 1 {
+		t.Errorf("unexpected event %+v", e)
+	}
+
+	if events := ctx.DependencyEvents(b); len(events) != 0 {
+		t.Errorf("expected the dependencies of B not to be traced, got %+v", events)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := ctx.WriteDependencyTrace(buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`module "A":`,
+		`  "B" with tag blueprint.traceTestDepTag by AddDependency in "deps"`,
+		`  "C" with tag blueprint.traceTestDepTag by AddReverseDependency in "deps"`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("expected %q in the trace, got:\n%s", line, buf.String())
+		}
+	}
+}
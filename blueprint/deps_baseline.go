@@ -0,0 +1,158 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/blueprint/pathtools"
+)
+
+// A DepsBaseline describes a file that lists the directories that the modules
+// in each directory are allowed to depend on, to enforce the layering of a
+// large source tree.  Each line of the file is a dependency edge, the directory
+// of the Blueprints file of a module followed by the directory of the
+// Blueprints file of one of its direct dependencies, separated by a space.
+// Empty lines and lines starting with "#" are ignored.  Dependencies between
+// modules in the same directory are not listed.
+type DepsBaseline struct {
+	// File is the path of the baseline file.
+	File string
+
+	// Update writes the current dependency edges to File instead of checking
+	// them, to create the baseline or to accept new edges.
+	Update bool
+}
+
+// NewDepsBaselineSingleton returns a SingletonFactory for a singleton that
+// checks that every dependency edge between directories is listed in the
+// baseline file, and reports an error for each new edge.  Edges in the baseline
+// that don't exist anymore are not errors, they are removed the next time the
+// baseline is updated.  With Update, the baseline is written by
+// Context.WriteSingletonFiles.
+func NewDepsBaselineSingleton(baseline DepsBaseline) SingletonFactory {
+	return func() Singleton {
+		return &depsBaselineSingleton{baseline: baseline}
+	}
+}
+
+type depsBaselineSingleton struct {
+	baseline DepsBaseline
+
+	// edges are the dependency edges found by GenerateBuildActions, sorted.
+	edges []depsBaselineEdge
+}
+
+type depsBaselineEdge struct {
+	from, to string
+}
+
+func (e depsBaselineEdge) String() string {
+	return e.from + " " + e.to
+}
+
+func (s *depsBaselineSingleton) GenerateBuildActions(ctx SingletonContext) {
+	// The first pair of modules found for each edge is reported in errors.
+	edges := make(map[depsBaselineEdge][2]Module)
+	ctx.VisitAllModules(func(module Module) {
+		from := ctx.ModuleDir(module)
+		ctx.VisitDirectDeps(module, func(dep Module) {
+			edge := depsBaselineEdge{from, ctx.ModuleDir(dep)}
+			if _, ok := edges[edge]; !ok && edge.from != edge.to {
+				edges[edge] = [2]Module{module, dep}
+			}
+		})
+	})
+
+	sorted := make([]depsBaselineEdge, 0, len(edges))
+	for edge := range edges {
+		sorted = append(sorted, edge)
+	}
+	sort.Sort(depsBaselineEdgeSorter(sorted))
+
+	if s.baseline.Update {
+		s.edges = sorted
+		return
+	}
+
+	ctx.AddNinjaFileDeps(s.baseline.File)
+	allowed, err := readDepsBaseline(ctx.Fs(), s.baseline.File)
+	if err != nil {
+		ctx.Errorf("error reading deps baseline: %s", err)
+		return
+	}
+
+	for _, edge := range sorted {
+		if !allowed[edge] {
+			modules := edges[edge]
+			ctx.ModuleErrorf(modules[0], "depends on %q in %q, which is not allowed by the deps baseline %s",
+				ctx.ModuleName(modules[1]), edge.to, s.baseline.File)
+		}
+	}
+}
+
+// WriteFiles writes the baseline with Update, unless PrepareBuildActions failed.
+func (s *depsBaselineSingleton) WriteFiles(failed bool) error {
+	if !s.baseline.Update || failed {
+		return nil
+	}
+	return writeDepsBaseline(s.baseline.File, s.edges)
+}
+
+func readDepsBaseline(fs pathtools.FileSystem, filename string) (map[depsBaselineEdge]bool, error) {
+	f, err := fs.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	edges := make(map[depsBaselineEdge]bool)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected two directories, found %q", filename, line, text)
+		}
+		edges[depsBaselineEdge{fields[0], fields[1]}] = true
+	}
+	return edges, scanner.Err()
+}
+
+func writeDepsBaseline(filename string, edges []depsBaselineEdge) error {
+	data := []byte("# Generated by blueprint.  Each line allows the modules in the first\n" +
+		"# directory to depend on modules in the second directory.\n")
+	for _, edge := range edges {
+		data = append(data, edge.String()+"\n"...)
+	}
+	return pathtools.WriteFileIfChanged(filename, data, 0666)
+}
+
+type depsBaselineEdgeSorter []depsBaselineEdge
+
+func (s depsBaselineEdgeSorter) Len() int { return len(s) }
+func (s depsBaselineEdgeSorter) Less(i, j int) bool {
+	if s[i].from != s[j].from {
+		return s[i].from < s[j].from
+	}
+	return s[i].to < s[j].to
+}
+func (s depsBaselineEdgeSorter) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,157 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newDepsBaselineTestContext(baseline DepsBaseline, files map[string][]byte) *Context {
+	ctx := NewContext()
+	ctx.RegisterModuleType("foo_module", newFooModule)
+	ctx.RegisterModuleType("bar_module", newBarModule)
+	ctx.RegisterSingletonType("deps_baseline", NewDepsBaselineSingleton(baseline))
+
+	files["Blueprints"] = []byte(`
+		subdirs = ["*"]
+	`)
+	files["a/Blueprints"] = []byte(`
+		foo_module {
+		    name: "A",
+		    deps: ["A2", "B"],
+		}
+
+		bar_module {
+		    name: "A2",
+		}
+	`)
+	files["b/Blueprints"] = []byte(`
+		foo_module {
+		    name: "B",
+		    deps: ["C"],
+		}
+	`)
+	files["c/Blueprints"] = []byte(`
+		bar_module {
+		    name: "C",
+		}
+	`)
+	ctx.MockFileSystem(files)
+	return ctx
+}
+
+func TestDepsBaselineCheck(t *testing.T) {
+	testCases := []struct {
+		baseline string
+		err      string
+	}{
+		{
+			baseline: `
+				# a may depend on b
+				a b
+			`,
+			err: `b/Blueprints:2:3: depends on "C" in "c", which is not allowed by the deps baseline deps_baseline.txt`,
+		},
+		{
+			baseline: `
+				a b
+				b c
+				c d
+			`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		ctx := newDepsBaselineTestContext(DepsBaseline{File: "deps_baseline.txt"}, map[string][]byte{
+			"deps_baseline.txt": []byte(testCase.baseline),
+		})
+
+		_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+		if len(errs) > 0 {
+			t.Fatalf("unexpected parse errors: %q", errs)
+		}
+		errs = ctx.ResolveDependencies(nil)
+		if len(errs) > 0 {
+			t.Fatalf("unexpected dependency errors: %q", errs)
+		}
+
+		deps, errs := ctx.PrepareBuildActions(nil)
+		if testCase.err != "" {
+			if len(errs) != 1 || errs[0].Error() != testCase.err {
+				t.Errorf("expected error %q, got %q", testCase.err, errs)
+			}
+			continue
+		}
+		if len(errs) > 0 {
+			t.Fatalf("unexpected errors: %q", errs)
+		}
+		if len(deps) != 1 || deps[0] != "deps_baseline.txt" {
+			t.Errorf("expected the baseline in the Ninja file deps, got %q", deps)
+		}
+	}
+}
+
+func TestDepsBaselineUpdate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deps_baseline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "deps_baseline.txt")
+	ctx := newDepsBaselineTestContext(DepsBaseline{File: file, Update: true}, map[string][]byte{})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) > 0 {
+		t.Fatalf("unexpected parse errors: %q", errs)
+	}
+	errs = ctx.ResolveDependencies(nil)
+	if len(errs) == 0 {
+		_, errs = ctx.PrepareBuildActions(nil)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+
+	// The baseline is only written by WriteSingletonFiles, and not after
+	// errors.
+	if errs := ctx.WriteSingletonFiles(true); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Fatalf("expected no baseline before WriteSingletonFiles succeeds, got %v", err)
+	}
+	if errs := ctx.WriteSingletonFiles(false); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var edges []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" && !strings.HasPrefix(line, "#") {
+			edges = append(edges, line)
+		}
+	}
+	if strings.Join(edges, ",") != "a b,b c" {
+		t.Errorf("expected edges a b and b c, got %q", edges)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// A DepsResolvedHook is called for every module variant once its dependencies
+// are final, after all mutators and dependency injectors have run and before
+// any module's GenerateBuildActions is called.  It receives the direct
+// dependencies of the variant in order, and can report errors, for example to
+// enforce which directories the modules in a directory may depend on, but
+// can't modify the module or its dependencies.
+type DepsResolvedHook func(ctx DepsResolvedContext, deps []ResolvedDependency)
+
+// A ResolvedDependency is a direct dependency of a module variant.
+type ResolvedDependency struct {
+	Tag    DependencyTag
+	Module Module
+}
+
+type DepsResolvedContext interface {
+	Config() interface{}
+
+	Module() Module
+	ModuleName() string
+	ModuleDir() string
+	ModuleType() string
+
+	OtherModuleName(m Module) string
+	OtherModuleDir(m Module) string
+	OtherModuleType(m Module) string
+
+	// ModuleErrorf reports an error at the definition of the module.
+	ModuleErrorf(format string, args ...interface{})
+}
+
+type depsResolvedHookInfo struct {
+	name string
+	hook DepsResolvedHook
+}
+
+// RegisterDepsResolvedHook registers a DepsResolvedHook that will be called
+// at the end of ResolveDependencies.  Hooks are called in registration order
+// for each module variant, one module variant at a time, in the order the
+// variants are visited by GenerateBuildActions.
+func (c *Context) RegisterDepsResolvedHook(name string, hook DepsResolvedHook) {
+	for _, h := range c.depsResolvedHooks {
+		if h.name == name {
+			panic(fmt.Errorf("deps resolved hook name %s is already registered", name))
+		}
+	}
+
+	c.depsResolvedHooks = append(c.depsResolvedHooks, &depsResolvedHookInfo{
+		name: name,
+		hook: hook,
+	})
+}
+
+type depsResolvedContext struct {
+	context *Context
+	config  interface{}
+	module  *moduleInfo
+	errs    []error
+}
+
+func (d *depsResolvedContext) Config() interface{} { return d.config }
+func (d *depsResolvedContext) Module() Module      { return d.module.logicModule }
+func (d *depsResolvedContext) ModuleName() string  { return d.module.Name() }
+func (d *depsResolvedContext) ModuleType() string  { return d.module.typeName }
+
+func (d *depsResolvedContext) ModuleDir() string {
+	return filepath.Dir(d.module.relBlueprintsFile)
+}
+
+func (d *depsResolvedContext) OtherModuleName(m Module) string {
+	return d.context.ModuleName(m)
+}
+
+func (d *depsResolvedContext) OtherModuleDir(m Module) string {
+	return d.context.ModuleDir(m)
+}
+
+func (d *depsResolvedContext) OtherModuleType(m Module) string {
+	return d.context.ModuleType(m)
+}
+
+func (d *depsResolvedContext) ModuleErrorf(format string, args ...interface{}) {
+	d.errs = append(d.errs, &ModuleError{
+		BlueprintError: BlueprintError{
+			Err: fmt.Errorf(format, args...),
+			Pos: d.module.pos,
+		},
+		module: d.module,
+	})
+}
+
+// runDepsResolvedHooks calls the registered DepsResolvedHooks on every module
+// variant.
+func (c *Context) runDepsResolvedHooks(config interface{}) []error {
+	if len(c.depsResolvedHooks) == 0 {
+		return nil
+	}
+
+	var errs []error
+	for _, module := range c.modulesSorted {
+		deps := make([]ResolvedDependency, len(module.directDeps))
+		for i, dep := range module.directDeps {
+			deps[i] = ResolvedDependency{
+				Tag:    dep.tag,
+				Module: dep.module.logicModule,
+			}
+		}
+
+		for _, h := range c.depsResolvedHooks {
+			ctx := &depsResolvedContext{
+				context: c,
+				config:  config,
+				module:  module,
+			}
+
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						in := fmt.Sprintf("deps resolved hook %q for %s", h.name, module)
+						if err, ok := r.(panicError); ok {
+							err.addIn(in)
+							ctx.errs = append(ctx.errs, err)
+						} else {
+							ctx.errs = append(ctx.errs, newPanicErrorf(r, "%s", in))
+						}
+					}
+				}()
+				h.hook(ctx, deps)
+			}()
+
+			errs = append(errs, ctx.errs...)
+			if len(errs) >= maxErrors {
+				return errs
+			}
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,97 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDepsResolvedHook(t *testing.T) {
+	ctx := NewContext()
+	ctx.RegisterModuleType("foo_module", newFooModule)
+	ctx.RegisterModuleType("bar_module", newBarModule)
+	ctx.RegisterDependencyInjector("license", injectLicenseDeps)
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			subdirs = ["*"]
+
+			bar_module {
+			    name: "license",
+			}
+		`),
+		"public/Blueprints": []byte(`
+			foo_module {
+			    name: "A",
+			}
+		`),
+		"vendor/Blueprints": []byte(`
+			foo_module {
+			    name: "B",
+			    deps: ["A"],
+			}
+		`),
+		"internal/Blueprints": []byte(`
+			foo_module {
+			    name: "C",
+			}
+		`),
+		"public2/Blueprints": []byte(`
+			foo_module {
+			    name: "D",
+			    deps: ["C", "A"],
+			}
+		`),
+	})
+
+	deps := make(map[string][]string)
+	ctx.RegisterDepsResolvedHook("record", func(ctx DepsResolvedContext, resolved []ResolvedDependency) {
+		for _, dep := range resolved {
+			deps[ctx.ModuleName()] = append(deps[ctx.ModuleName()], ctx.OtherModuleName(dep.Module))
+		}
+	})
+	// Modules outside of internal may not depend on modules in internal.
+	ctx.RegisterDepsResolvedHook("internal", func(ctx DepsResolvedContext, resolved []ResolvedDependency) {
+		if ctx.ModuleDir() == "internal" {
+			return
+		}
+		for _, dep := range resolved {
+			if ctx.OtherModuleDir(dep.Module) == "internal" {
+				ctx.ModuleErrorf("may not depend on %s in internal", ctx.OtherModuleName(dep.Module))
+			}
+		}
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) > 0 {
+		t.Fatalf("unexpected parse errors: %q", errs)
+	}
+
+	errs = ctx.ResolveDependencies(nil)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), `public2/Blueprints:2:4: module "D": may not depend on C in internal`) {
+		t.Errorf("expected a single error for D, got %q", errs)
+	}
+
+	expected := map[string][]string{
+		"A": {"license"},
+		"B": {"A", "license"},
+		"C": {"license"},
+		"D": {"C", "A", "license"},
+	}
+	if !reflect.DeepEqual(deps, expected) {
+		t.Errorf("expected resolved deps %q, got %q", expected, deps)
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"fmt"
+	"sync"
+)
+
+// A DepSetOrder is the order in which the elements of a DepSet are returned by
+// ToList.
+type DepSetOrder int
+
+const (
+	// DepSetPreorder returns the direct elements of a set before the
+	// elements of its transitive sets.
+	DepSetPreorder DepSetOrder = iota
+
+	// DepSetPostorder returns the elements of the transitive sets of a set
+	// before its direct elements.
+	DepSetPostorder
+
+	// DepSetTopological returns the elements of a set before the elements of
+	// all the sets it transitively includes, even when those are shared with
+	// other sets, which is the order needed for static libraries on a link
+	// command line.
+	DepSetTopological
+)
+
+func (o DepSetOrder) String() string {
+	switch o {
+	case DepSetPreorder:
+		return "preorder"
+	case DepSetPostorder:
+		return "postorder"
+	case DepSetTopological:
+		return "topological"
+	default:
+		return fmt.Sprintf("DepSetOrder(%d)", int(o))
+	}
+}
+
+// A DepSet is an immutable set of strings, like link libraries or include
+// directories, that is built from a list of direct elements and the sets of
+// the dependencies of a module.  Creating a DepSet doesn't copy the transitive
+// sets, so propagating sets through a dependency graph costs time and memory
+// proportional to the number of edges instead of the number of elements.  The
+// elements are only flattened into a list when ToList is first called.
+type DepSet struct {
+	order      DepSetOrder
+	direct     []string
+	transitive []*DepSet
+
+	flattenOnce sync.Once
+	flattened   []string
+}
+
+// NewDepSet returns a DepSet with the direct elements and all the elements of
+// the transitive sets, which must all have the same order.  Nil transitive
+// sets are ignored.
+func NewDepSet(order DepSetOrder, direct []string, transitive []*DepSet) *DepSet {
+	var nonNil []*DepSet
+	for _, t := range transitive {
+		if t == nil {
+			continue
+		}
+		if t.order != order {
+			panic(fmt.Errorf("incompatible order, new DepSet is %s but transitive DepSet is %s",
+				order, t.order))
+		}
+		nonNil = append(nonNil, t)
+	}
+
+	return &DepSet{
+		order:      order,
+		direct:     append([]string(nil), direct...),
+		transitive: nonNil,
+	}
+}
+
+// A DepSetBuilder collects the direct elements and the transitive sets of a
+// DepSet.
+type DepSetBuilder struct {
+	order      DepSetOrder
+	direct     []string
+	transitive []*DepSet
+}
+
+// NewDepSetBuilder returns a DepSetBuilder for a DepSet with the given order.
+func NewDepSetBuilder(order DepSetOrder) *DepSetBuilder {
+	return &DepSetBuilder{order: order}
+}
+
+// Direct adds direct elements to the DepSet.
+func (b *DepSetBuilder) Direct(direct ...string) *DepSetBuilder {
+	b.direct = append(b.direct, direct...)
+	return b
+}
+
+// Transitive adds transitive sets to the DepSet.
+func (b *DepSetBuilder) Transitive(transitive ...*DepSet) *DepSetBuilder {
+	b.transitive = append(b.transitive, transitive...)
+	return b
+}
+
+// Build returns the DepSet.
+func (b *DepSetBuilder) Build() *DepSet {
+	return NewDepSet(b.order, b.direct, b.transitive)
+}
+
+// Order returns the order of the DepSet.
+func (d *DepSet) Order() DepSetOrder {
+	return d.order
+}
+
+// ToList returns the elements of the DepSet in its order, with duplicates
+// removed.  The list is computed once and shared by all callers, so it must
+// not be modified.  ToList returns nil for a nil DepSet.
+func (d *DepSet) ToList() []string {
+	if d == nil {
+		return nil
+	}
+
+	d.flattenOnce.Do(func() {
+		d.flattened = d.flatten()
+	})
+	return d.flattened
+}
+
+func (d *DepSet) flatten() []string {
+	var list []string
+	seen := make(map[string]bool)
+	add := func(s string) {
+		if !seen[s] {
+			seen[s] = true
+			list = append(list, s)
+		}
+	}
+
+	// Each DepSet is only walked once, even if it is included by multiple
+	// sets.  The topological order is the reverse of a postorder walk that
+	// visits the direct elements and the transitive sets in reverse.
+	visited := make(map[*DepSet]bool)
+	var walk func(*DepSet)
+	walk = func(s *DepSet) {
+		visited[s] = true
+
+		switch d.order {
+		case DepSetPreorder:
+			for _, e := range s.direct {
+				add(e)
+			}
+			for _, t := range s.transitive {
+				if !visited[t] {
+					walk(t)
+				}
+			}
+		case DepSetPostorder:
+			for _, t := range s.transitive {
+				if !visited[t] {
+					walk(t)
+				}
+			}
+			for _, e := range s.direct {
+				add(e)
+			}
+		case DepSetTopological:
+			for i := len(s.transitive) - 1; i >= 0; i-- {
+				if t := s.transitive[i]; !visited[t] {
+					walk(t)
+				}
+			}
+			for i := len(s.direct) - 1; i >= 0; i-- {
+				add(s.direct[i])
+			}
+		}
+	}
+	walk(d)
+
+	if d.order == DepSetTopological {
+		for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+			list[i], list[j] = list[j], list[i]
+		}
+	}
+
+	return list
+}
+
+// A TransitiveSetProvider is a Module that provides DepSets, for example of the
+// libraries it needs to be linked with, to the modules that depend on it.
+type TransitiveSetProvider interface {
+	// TransitiveSet returns the DepSet with the given name, or nil if the
+	// module doesn't provide it.  It is only called after the module's
+	// GenerateBuildActions method has been called.
+	TransitiveSet(name string) *DepSet
+}
+
+// DirectDepTransitiveSets returns the DepSets with the given name provided by
+// the direct dependencies of the current module that are
+// TransitiveSetProviders, in the order of the dependencies, to be used as the
+// transitive sets of the module's own DepSet.
+func DirectDepTransitiveSets(ctx ModuleContext, name string) []*DepSet {
+	var sets []*DepSet
+	ctx.VisitDirectDeps(func(dep Module) {
+		if provider, ok := dep.(TransitiveSetProvider); ok {
+			if set := provider.TransitiveSet(name); set != nil {
+				sets = append(sets, set)
+			}
+		}
+	})
+	return sets
+}
@@ -0,0 +1,145 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"reflect"
+	"testing"
+)
+
+// newTestDepSet returns a diamond of DepSets: a includes b and c, which both
+// include d.
+func newTestDepSet(order DepSetOrder) *DepSet {
+	d := NewDepSet(order, []string{"d", "shared"}, nil)
+	b := NewDepSetBuilder(order).Direct("b", "shared").Transitive(d).Build()
+	c := NewDepSetBuilder(order).Direct("c").Transitive(d, nil).Build()
+	return NewDepSet(order, []string{"a1", "a2"}, []*DepSet{b, c})
+}
+
+func TestDepSetToList(t *testing.T) {
+	testCases := []struct {
+		order    DepSetOrder
+		expected []string
+	}{
+		{
+			order:    DepSetPreorder,
+			expected: []string{"a1", "a2", "b", "shared", "d", "c"},
+		},
+		{
+			order:    DepSetPostorder,
+			expected: []string{"d", "shared", "b", "c", "a1", "a2"},
+		},
+		{
+			order:    DepSetTopological,
+			expected: []string{"a1", "a2", "b", "c", "d", "shared"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		set := newTestDepSet(testCase.order)
+		list := set.ToList()
+		if !reflect.DeepEqual(list, testCase.expected) {
+			t.Errorf("%s: expected %q, got %q", testCase.order, testCase.expected, list)
+		}
+		if again := set.ToList(); &again[0] != &list[0] {
+			t.Errorf("%s: expected ToList to be memoized", testCase.order)
+		}
+	}
+
+	var nilSet *DepSet
+	if list := nilSet.ToList(); list != nil {
+		t.Errorf("expected nil list for nil DepSet, got %q", list)
+	}
+}
+
+func TestDepSetIncompatibleOrder(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic for transitive DepSet with a different order")
+		}
+	}()
+
+	NewDepSet(DepSetPreorder, nil, []*DepSet{NewDepSet(DepSetTopological, nil, nil)})
+}
+
+type depSetTestModule struct {
+	SimpleName
+	properties struct {
+		Libs []string
+	}
+	libs *DepSet
+}
+
+func newDepSetTestModule() (Module, []interface{}) {
+	m := &depSetTestModule{}
+	return m, []interface{}{&m.properties, &m.SimpleName.Properties}
+}
+
+func (m *depSetTestModule) DynamicDependencies(ctx DynamicDependerModuleContext) []string {
+	return m.properties.Libs
+}
+
+func (m *depSetTestModule) GenerateBuildActions(ctx ModuleContext) {
+	m.libs = NewDepSet(DepSetTopological, []string{ctx.ModuleName()},
+		DirectDepTransitiveSets(ctx, "libs"))
+}
+
+func (m *depSetTestModule) TransitiveSet(name string) *DepSet {
+	if name == "libs" {
+		return m.libs
+	}
+	return nil
+}
+
+func TestDirectDepTransitiveSets(t *testing.T) {
+	ctx := NewContext()
+	ctx.RegisterModuleType("lib", newDepSetTestModule)
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			lib {
+			    name: "a",
+			    libs: ["b", "c"],
+			}
+
+			lib {
+			    name: "b",
+			    libs: ["d"],
+			}
+
+			lib {
+			    name: "c",
+			    libs: ["d"],
+			}
+
+			lib {
+			    name: "d",
+			}
+		`),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) == 0 {
+		_, errs = ctx.PrepareBuildActions(nil)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+
+	a := ctx.modulesFromName("a")[0].logicModule.(*depSetTestModule)
+	expected := []string{"a", "b", "c", "d"}
+	if list := a.libs.ToList(); !reflect.DeepEqual(list, expected) {
+		t.Errorf("expected %q, got %q", expected, list)
+	}
+}
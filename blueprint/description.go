@@ -0,0 +1,219 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DescriptionTemplates configures the descriptions that Ninja prints for build
+// statements, so that rule authors don't have to write a Description for
+// every rule to get uniform status output.
+//
+// A template is a string that may contain the following placeholders:
+//
+//	{RuleName}  the name of the rule, as passed to StaticRule or Rule
+//	{Out}       the explicit outputs of the build statement
+//	{ShortOut}  the file names of the explicit outputs, without directories
+//	{In}        the explicit inputs of the build statement
+//	{ShortIn}   the file names of the explicit inputs, without directories
+//
+// For example "{RuleName} {ShortOut}" prints "cc foo.o" for a build statement
+// of the rule "cc" with the output "out/obj/foo.o".
+type DescriptionTemplates struct {
+	// Default is the template used for build statements whose rule doesn't
+	// have a Description.
+	Default string
+
+	// Rules maps rule names to templates that are used for the build
+	// statements of those rules, overriding the rule's Description.
+	Rules map[string]string
+
+	// Verbose causes {ShortOut} and {ShortIn} to print the full paths, like
+	// {Out} and {In}.
+	Verbose bool
+}
+
+// SetDescriptionTemplates sets the templates that are used to generate the
+// descriptions of build statements.  A Description set in BuildParams always
+// takes precedence over the templates.  It panics if a template contains an
+// unknown placeholder.
+func (c *Context) SetDescriptionTemplates(templates DescriptionTemplates) {
+	t := &descriptionTemplates{
+		rules:   make(map[string][]descriptionPart),
+		verbose: templates.Verbose,
+	}
+
+	var err error
+	t.defaultTemplate, err = parseDescriptionTemplate(templates.Default)
+	if err != nil {
+		panic(err)
+	}
+
+	for rule, template := range templates.Rules {
+		t.rules[rule], err = parseDescriptionTemplate(template)
+		if err != nil {
+			panic(fmt.Errorf("rule %s: %s", rule, err))
+		}
+	}
+
+	c.descriptionTemplates = t
+}
+
+type descriptionTemplates struct {
+	defaultTemplate []descriptionPart
+	rules           map[string][]descriptionPart
+	verbose         bool
+}
+
+// A descriptionPart is either literal text or a placeholder of a description
+// template.
+type descriptionPart struct {
+	literal     string
+	placeholder string
+}
+
+var descriptionPlaceholders = map[string]bool{
+	"RuleName": true,
+	"Out":      true,
+	"ShortOut": true,
+	"In":       true,
+	"ShortIn":  true,
+}
+
+func parseDescriptionTemplate(template string) ([]descriptionPart, error) {
+	var parts []descriptionPart
+	for template != "" {
+		start := strings.IndexByte(template, '{')
+		if start < 0 {
+			parts = append(parts, descriptionPart{literal: template})
+			break
+		}
+		end := strings.IndexByte(template[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated placeholder in description template %q", template)
+		}
+		end += start
+
+		placeholder := template[start+1 : end]
+		if !descriptionPlaceholders[placeholder] {
+			return nil, fmt.Errorf("unknown placeholder {%s} in description template", placeholder)
+		}
+
+		if start > 0 {
+			parts = append(parts, descriptionPart{literal: template[:start]})
+		}
+		parts = append(parts, descriptionPart{placeholder: placeholder})
+		template = template[end+1:]
+	}
+	return parts, nil
+}
+
+// apply sets the description of a build statement from the
+// templates, unless the build statement has its own description.  It must be
+// called after the build statement's RuleDef has been set.
+func (t *descriptionTemplates) apply(def *buildDef) {
+	if def.RuleDef == nil || def.Variables["description"] != nil {
+		return
+	}
+
+	template, ok := t.rules[def.Rule.name()]
+	if !ok {
+		if def.RuleDef.Variables["description"] != nil {
+			return
+		}
+		template = t.defaultTemplate
+	}
+	if len(template) == 0 {
+		return
+	}
+
+	var parts []*ninjaString
+	for _, part := range template {
+		switch part.placeholder {
+		case "":
+			parts = append(parts, simpleNinjaString(strings.Replace(part.literal, "$", "$$", -1)))
+		case "RuleName":
+			parts = append(parts, simpleNinjaString(def.Rule.name()))
+		case "Out":
+			parts = appendNinjaStringList(parts, def.Outputs, false)
+		case "ShortOut":
+			parts = appendNinjaStringList(parts, def.Outputs, !t.verbose)
+		case "In":
+			parts = appendNinjaStringList(parts, def.Inputs, false)
+		case "ShortIn":
+			parts = appendNinjaStringList(parts, def.Inputs, !t.verbose)
+		}
+	}
+
+	description := concatNinjaStrings(parts)
+	if strings.HasPrefix(description.strings[0], " ") {
+		description.strings[0] = "$" + description.strings[0]
+	}
+
+	if def.Variables == nil {
+		def.Variables = make(map[string]*ninjaString)
+	}
+	def.Variables["description"] = description
+}
+
+// appendNinjaStringList appends the strings in list to parts, separated by
+// spaces.  If base is true only the part of each string after the last '/' is
+// appended.
+func appendNinjaStringList(parts []*ninjaString, list []*ninjaString, base bool) []*ninjaString {
+	for i, s := range list {
+		if i > 0 {
+			parts = append(parts, simpleNinjaString(" "))
+		}
+		if base {
+			s = ninjaStringBase(s)
+		}
+		parts = append(parts, s)
+	}
+	return parts
+}
+
+// ninjaStringBase returns the part of s after the last '/' in any of its
+// literal strings.  If the last '/' is in the value of a variable s is
+// returned unmodified.
+func ninjaStringBase(s *ninjaString) *ninjaString {
+	for i := len(s.strings) - 1; i >= 0; i-- {
+		if slash := strings.LastIndexByte(s.strings[i], '/'); slash >= 0 {
+			strs := append([]string{s.strings[i][slash+1:]}, s.strings[i+1:]...)
+			return &ninjaString{
+				strings:   strs,
+				variables: s.variables[i:],
+			}
+		}
+	}
+	return s
+}
+
+// concatNinjaStrings returns a new ninjaString containing all of the strings
+// and variables in parts.
+func concatNinjaStrings(parts []*ninjaString) *ninjaString {
+	result := &ninjaString{
+		strings:   []string{""},
+		variables: []Variable{},
+	}
+	for _, part := range parts {
+		last := len(result.strings) - 1
+		result.strings[last] += part.strings[0]
+		result.strings = append(result.strings, part.strings[1:]...)
+		result.variables = append(result.variables, part.variables...)
+	}
+	return result
+}
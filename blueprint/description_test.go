@@ -0,0 +1,102 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDescriptionTemplates(t *testing.T) {
+	testCases := []struct {
+		templates DescriptionTemplates
+		expected  string
+	}{
+		{
+			templates: DescriptionTemplates{},
+			expected:  "",
+		},
+		{
+			templates: DescriptionTemplates{
+				Default: "{RuleName} {ShortOut}",
+			},
+			expected: "    description = touch a.txt\n",
+		},
+		{
+			templates: DescriptionTemplates{
+				Default: "{RuleName} {ShortOut}",
+				Verbose: true,
+			},
+			expected: "    description = touch ${g.verifytest.outDir}/a.txt\n",
+		},
+		{
+			templates: DescriptionTemplates{
+				Default: "{RuleName} {ShortOut}",
+				Rules: map[string]string{
+					"touch": "$$ {Out} {In}",
+				},
+			},
+			expected: "    description = $$$$ ${g.verifytest.outDir}/a.txt \n",
+		},
+	}
+
+	for _, testCase := range testCases {
+		ctx := NewContext()
+		ctx.RegisterModuleType("outputs_module", newOutputsModule)
+		ctx.SetDescriptionTemplates(testCase.templates)
+		ctx.MockFileSystem(map[string][]byte{
+			"Blueprints": []byte(`
+				outputs_module {
+				    name: "A",
+				    outs: ["a.txt"],
+				}
+			`),
+		})
+
+		_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+		if len(errs) == 0 {
+			_, errs = ctx.PrepareBuildActions(nil)
+		}
+		if len(errs) > 0 {
+			t.Fatalf("unexpected errors: %q", errs)
+		}
+
+		buf := &bytes.Buffer{}
+		if err := ctx.WriteBuildFile(buf); err != nil {
+			t.Fatalf("unexpected error writing build file: %s", err)
+		}
+
+		out := buf.String()
+		description := ""
+		if i := strings.Index(out, "    description = "); i >= 0 {
+			description = out[i : i+strings.IndexByte(out[i:], '\n')+1]
+		}
+
+		if description != testCase.expected {
+			t.Errorf("incorrect description for %#v:", testCase.templates)
+			t.Errorf("     got: %q", description)
+			t.Errorf("expected: %q", testCase.expected)
+		}
+	}
+}
+
+func TestDescriptionTemplateErrors(t *testing.T) {
+	for _, template := range []string{"{Foo}", "{Out"} {
+		if _, err := parseDescriptionTemplate(template); err == nil {
+			t.Errorf("expected error for template %q", template)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/scanner"
+)
+
+// A DiagnosticLevel is the severity of a Diagnostic.
+type DiagnosticLevel int
+
+const (
+	// DiagnosticIgnore drops the diagnostics of a category.
+	DiagnosticIgnore DiagnosticLevel = iota
+	DiagnosticWarning
+	DiagnosticError
+)
+
+func (l DiagnosticLevel) String() string {
+	switch l {
+	case DiagnosticIgnore:
+		return "ignore"
+	case DiagnosticWarning:
+		return "warning"
+	case DiagnosticError:
+		return "error"
+	default:
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+}
+
+// ParseDiagnosticLevel returns the DiagnosticLevel named by s, as returned by
+// DiagnosticLevel.String.
+func ParseDiagnosticLevel(s string) (DiagnosticLevel, error) {
+	for l := DiagnosticIgnore; l <= DiagnosticError; l++ {
+		if s == l.String() {
+			return l, nil
+		}
+	}
+	return DiagnosticIgnore, fmt.Errorf("unknown diagnostic level %q", s)
+}
+
+// A Diagnostic is a warning or an error reported to the Context.  Warnings are
+// reported with BaseModuleContext.ModuleWarningf,
+// BaseModuleContext.PropertyWarningf or SingletonContext.Warningf.  Every
+// warning has a category, like "deprecated" or "unused-property", which
+// selects its level with SetWarningLevel and SetWarningsAsErrors.  A warning
+// promoted to an error is also returned as an error by the phase that
+// reported it, so that the phase fails.
+//
+// The errors returned by ParseBlueprintsFiles, ResolveDependencies and
+// PrepareBuildActions are recorded as diagnostics of level DiagnosticError
+// without a category.
+type Diagnostic struct {
+	Level    DiagnosticLevel
+	Category string
+
+	// Pos is the position the diagnostic refers to, if any.
+	Pos scanner.Position
+
+	// Module is the module variant the diagnostic refers to, as formatted
+	// in errors, if any.
+	Module string
+
+	// Property is the property the diagnostic refers to, if any.
+	Property string
+
+	Message string
+
+	// Err is the error returned by a phase of the Context, for errors
+	// that were not promoted from a warning.
+	Err error
+}
+
+func (d *Diagnostic) Error() string {
+	if d.Err != nil {
+		return d.Err.Error()
+	}
+
+	var prefix []string
+	if d.Pos.IsValid() {
+		prefix = append(prefix, d.Pos.String())
+	}
+	if d.Module != "" {
+		prefix = append(prefix, d.Module)
+	}
+	if d.Property != "" {
+		prefix = append(prefix, fmt.Sprintf("property %q", d.Property))
+	}
+	prefix = append(prefix, d.Level.String())
+	return fmt.Sprintf("%s: %s [-W%s]", strings.Join(prefix, ": "), d.Message, d.Category)
+}
+
+// SetWarningsAsErrors promotes all warnings to errors, except those of the
+// categories whose level is set with SetWarningLevel.
+func (c *Context) SetWarningsAsErrors(werror bool) {
+	c.warningsAsErrors = werror
+}
+
+// SetWarningLevel sets the level of the warnings of a category, to promote
+// them to errors or ignore them.
+func (c *Context) SetWarningLevel(category string, level DiagnosticLevel) {
+	if c.warningLevels == nil {
+		c.warningLevels = make(map[string]DiagnosticLevel)
+	}
+	c.warningLevels[category] = level
+}
+
+// Diagnostics returns the warnings reported so far that were not ignored,
+// including those promoted to errors, and the errors returned by the phases
+// of the Context, sorted by position.
+func (c *Context) Diagnostics() []*Diagnostic {
+	c.diagnosticsLock.Lock()
+	ret := append([]*Diagnostic(nil), c.diagnostics...)
+	c.diagnosticsLock.Unlock()
+
+	sort.Stable(diagnosticsByPos(ret))
+	return ret
+}
+
+type diagnosticsByPos []*Diagnostic
+
+func (s diagnosticsByPos) Len() int      { return len(s) }
+func (s diagnosticsByPos) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s diagnosticsByPos) Less(i, j int) bool {
+	a, b := s[i], s[j]
+	if a.Pos.Filename != b.Pos.Filename {
+		return a.Pos.Filename < b.Pos.Filename
+	}
+	if a.Pos.Line != b.Pos.Line {
+		return a.Pos.Line < b.Pos.Line
+	}
+	if a.Pos.Column != b.Pos.Column {
+		return a.Pos.Column < b.Pos.Column
+	}
+	return a.Message < b.Message
+}
+
+// reportWarning sets the level of the warning and records it, and returns it
+// if it was promoted to an error.
+func (c *Context) reportWarning(d *Diagnostic) error {
+	d.Level = DiagnosticWarning
+	if c.warningsAsErrors {
+		d.Level = DiagnosticError
+	}
+	if level, ok := c.warningLevels[d.Category]; ok {
+		d.Level = level
+	}
+	if d.Level == DiagnosticIgnore {
+		return nil
+	}
+
+	c.diagnosticsLock.Lock()
+	c.diagnostics = append(c.diagnostics, d)
+	c.diagnosticsLock.Unlock()
+
+	if d.Level == DiagnosticError {
+		return d
+	}
+	return nil
+}
+
+// recordErrors records the errors returned by a phase of the Context as
+// diagnostics.  Warnings promoted to errors were recorded when they were
+// reported.
+func (c *Context) recordErrors(errs []error) {
+	if len(errs) == 0 {
+		return
+	}
+
+	c.diagnosticsLock.Lock()
+	defer c.diagnosticsLock.Unlock()
+
+	for _, err := range errs {
+		if _, ok := err.(*Diagnostic); ok {
+			continue
+		}
+		c.diagnostics = append(c.diagnostics, newErrorDiagnostic(err))
+	}
+}
+
+// newErrorDiagnostic returns the diagnostic of an error, with the position,
+// module and property of the errors that have them.
+func newErrorDiagnostic(err error) *Diagnostic {
+	d := &Diagnostic{
+		Level:   DiagnosticError,
+		Message: err.Error(),
+		Err:     err,
+	}
+
+	switch err := err.(type) {
+	case *BlueprintError:
+		d.Pos = err.Pos
+		d.Message = err.Err.Error()
+	case *ModuleError:
+		d.Pos = err.Pos
+		d.Module = err.module.String()
+		d.Message = err.Err.Error()
+	case *PropertyError:
+		d.Pos = err.Pos
+		d.Module = err.module.String()
+		d.Property = err.property
+		d.Message = err.Err.Error()
+	case *PropertyUnpackError:
+		d.Pos = err.Pos
+		d.Property = err.Property
+		d.Message = err.Err.Error()
+	}
+
+	return d
+}
+
+func (d *baseModuleContext) ModuleWarningf(category, format string, args ...interface{}) {
+	d.error(d.context.reportWarning(&Diagnostic{
+		Category: category,
+		Pos:      d.module.pos,
+		Module:   d.module.String(),
+		Message:  fmt.Sprintf(format, args...),
+	}))
+}
+
+func (d *baseModuleContext) PropertyWarningf(property, category, format string, args ...interface{}) {
+	pos := d.module.propertyPos[property]
+	if !pos.IsValid() {
+		pos = d.module.pos
+	}
+
+	d.error(d.context.reportWarning(&Diagnostic{
+		Category: category,
+		Pos:      pos,
+		Module:   d.module.String(),
+		Property: property,
+		Message:  fmt.Sprintf(format, args...),
+	}))
+}
+
+func (s *singletonContext) Warningf(category, format string, args ...interface{}) {
+	s.error(s.context.reportWarning(&Diagnostic{
+		Category: category,
+		Message:  fmt.Sprintf(format, args...),
+	}))
+}
@@ -0,0 +1,159 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"reflect"
+	"testing"
+)
+
+type warningModule struct {
+	SimpleName
+	properties struct {
+		Deprecated_srcs []string
+	}
+}
+
+func newWarningModule() (Module, []interface{}) {
+	m := &warningModule{}
+	return m, []interface{}{&m.properties, &m.SimpleName.Properties}
+}
+
+func (m *warningModule) GenerateBuildActions(ctx ModuleContext) {
+	if len(m.properties.Deprecated_srcs) > 0 {
+		ctx.PropertyWarningf("deprecated_srcs", "deprecated", "use srcs instead")
+	}
+	ctx.ModuleWarningf("style", "name should be lower case")
+}
+
+func TestDiagnostics(t *testing.T) {
+	testCases := []struct {
+		name     string
+		werror   bool
+		levels   map[string]DiagnosticLevel
+		warnings []string
+		errs     []string
+	}{
+		{
+			name: "warnings",
+			warnings: []string{
+				`Blueprints:2:5: module "A": warning: name should be lower case [-Wstyle]`,
+				`Blueprints:4:24: module "A": property "deprecated_srcs": warning: use srcs instead [-Wdeprecated]`,
+			},
+		},
+		{
+			name:   "werror",
+			werror: true,
+			levels: map[string]DiagnosticLevel{"style": DiagnosticIgnore},
+			errs: []string{
+				`Blueprints:4:24: module "A": property "deprecated_srcs": error: use srcs instead [-Wdeprecated]`,
+			},
+		},
+		{
+			name:   "promoted",
+			levels: map[string]DiagnosticLevel{"deprecated": DiagnosticError},
+			warnings: []string{
+				`Blueprints:2:5: module "A": warning: name should be lower case [-Wstyle]`,
+			},
+			errs: []string{
+				`Blueprints:4:24: module "A": property "deprecated_srcs": error: use srcs instead [-Wdeprecated]`,
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctx := NewContext()
+			ctx.RegisterModuleType("warning_module", newWarningModule)
+			ctx.SetWarningsAsErrors(testCase.werror)
+			for category, level := range testCase.levels {
+				ctx.SetWarningLevel(category, level)
+			}
+			ctx.MockFileSystem(map[string][]byte{
+				"Blueprints": []byte(`
+				warning_module {
+				    name: "A",
+				    deprecated_srcs: ["a.c"],
+				}
+			`),
+			})
+
+			_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+			if len(errs) > 0 {
+				t.Fatalf("unexpected parse errors: %v", errs)
+			}
+
+			_, errs = ctx.PrepareBuildActions(nil)
+			var gotErrs []string
+			for _, err := range errs {
+				gotErrs = append(gotErrs, err.Error())
+			}
+			if !reflect.DeepEqual(gotErrs, testCase.errs) {
+				t.Errorf("expected errors %q, got %q", testCase.errs, gotErrs)
+			}
+
+			var gotWarnings []string
+			for _, d := range ctx.Diagnostics() {
+				if d.Level == DiagnosticWarning {
+					gotWarnings = append(gotWarnings, d.Error())
+				}
+			}
+			if !reflect.DeepEqual(gotWarnings, testCase.warnings) {
+				t.Errorf("expected warnings %q, got %q", testCase.warnings, gotWarnings)
+			}
+		})
+	}
+}
+
+func TestParseDiagnosticLevel(t *testing.T) {
+	for l := DiagnosticIgnore; l <= DiagnosticError; l++ {
+		if got, err := ParseDiagnosticLevel(l.String()); err != nil || got != l {
+			t.Errorf("expected %v, got %v, %v", l, got, err)
+		}
+	}
+	if _, err := ParseDiagnosticLevel("fatal"); err == nil {
+		t.Errorf("expected an error for an unknown level")
+	}
+}
+
+func TestDiagnosticsErrors(t *testing.T) {
+	ctx := NewContext()
+	ctx.RegisterModuleType("warning_module", newWarningModule)
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			warning_module {
+			    name: "A",
+			    srcs: ["a.c"],
+			}
+		`),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %q", errs)
+	}
+
+	diagnostics := ctx.Diagnostics()
+	if len(diagnostics) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %q", diagnostics)
+	}
+	d := diagnostics[0]
+	if d.Level != DiagnosticError || d.Err != errs[0] || d.Error() != errs[0].Error() {
+		t.Errorf("expected a diagnostic of the error %q, got %#v", errs[0], d)
+	}
+	if d.Pos.Line != 4 || d.Property != "srcs" || d.Message != `unrecognized property "srcs"` {
+		t.Errorf("unexpected position, property or message in %#v", d)
+	}
+}
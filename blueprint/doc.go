@@ -60,6 +60,14 @@
 // asked to generate build rules based on property values, and then singletons
 // can generate any build rules from the output of all modules.
 //
+// Variables assigned in a Blueprints file are visible in the Blueprints files
+// of the subdirectories it lists.  A Blueprints file can also import the
+// variables of a Blueprints file in its own or a parent directory that it is
+// not reached through by listing it in "import_vars", which is evaluated on
+// its own:
+//
+//   import_vars = ["../../Blueprints"]
+//
 // The per-project build logic defines a top level command, referred to in the
 // documentation as the "primary builder".  This command is responsible for
 // registering the module types needed for the project, as well as any
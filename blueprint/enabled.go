@@ -0,0 +1,195 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"fmt"
+	"text/scanner"
+
+	"github.com/google/blueprint/parser"
+)
+
+// enabledPropertyName is the Blueprints property that disables a module when
+// the property is enabled with SetEnabledCondition.
+const enabledPropertyName = "enabled"
+
+// enabledDefaultCondition is the entry of an enabled map that is used when no
+// condition is true.
+const enabledDefaultCondition = "default"
+
+// An EnabledCondition returns whether the named condition of an enabled
+// property is true in the config, for example whether the build targets
+// Linux.  It returns an error if the condition is unknown.
+type EnabledCondition func(config interface{}, condition string) (bool, error)
+
+// SetEnabledCondition enables the enabled property in the Blueprints
+// definitions of modules of all module types.  The property is either a bool,
+// or a map from condition names to bools that selects the value of the first
+// condition that is true, and of the default entry if no condition is true:
+//
+//	cc_binary {
+//	    name: "tool",
+//	    enabled: {
+//	        host_linux: true,
+//	        host_darwin: true,
+//	        default: false,
+//	    },
+//	}
+//
+// The conditions are evaluated with condition and the config passed to
+// ResolveDependencies.  A module is enabled if it doesn't set the property,
+// or if no condition is true and there is no default entry.
+//
+// Disabled modules are mutated and visited like other modules, but
+// GenerateBuildActions is not called for them, and an enabled module that
+// depends on a disabled module is an error that explains why the module is
+// disabled.  SetEnabledCondition must be called before the Blueprints files
+// are parsed.  The condition may be nil if only bools are used.
+func (c *Context) SetEnabledCondition(condition EnabledCondition) {
+	c.enabledPropertySet = true
+	c.enabledCondition = condition
+}
+
+// ModuleEnabled returns false if the module was disabled by its enabled
+// property.  It must be called after ResolveDependencies.
+func (c *Context) ModuleEnabled(logicModule Module) bool {
+	return c.moduleInfo[logicModule].disabledReason == ""
+}
+
+// checkEnabledProperty returns an error if the value of the enabled property
+// is not a bool or a map of bools.
+func checkEnabledProperty(enabledDef *parser.Property) []error {
+	switch value := enabledDef.Value.Eval().(type) {
+	case *parser.Bool:
+		return nil
+	case *parser.Map:
+		var errs []error
+		for _, conditionDef := range value.Properties {
+			if _, ok := conditionDef.Value.Eval().(*parser.Bool); !ok {
+				errs = append(errs, &BlueprintError{
+					Err: fmt.Errorf("%s condition %q must be a bool", enabledPropertyName,
+						conditionDef.Name),
+					Pos: conditionDef.ColonPos,
+				})
+			}
+		}
+		return errs
+	default:
+		return []error{&BlueprintError{
+			Err: fmt.Errorf("%s must be a bool or a map of conditions to bools",
+				enabledPropertyName),
+			Pos: enabledDef.ColonPos,
+		}}
+	}
+}
+
+// evaluateEnabledProperties sets the reason that each module with an enabled
+// property that evaluates to false is disabled.
+func (c *Context) evaluateEnabledProperties(config interface{}) []error {
+	var errs []error
+	c.visitAllModuleInfos(func(module *moduleInfo) {
+		if module.enabledDef == nil || len(errs) >= maxErrors {
+			return
+		}
+
+		reason, err := c.evaluateEnabledProperty(config, module.enabledDef)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		module.disabledReason = reason
+	})
+	return errs
+}
+
+// evaluateEnabledProperty returns why the module is disabled, or "" if it is
+// enabled.
+func (c *Context) evaluateEnabledProperty(config interface{}, enabledDef *parser.Property) (string, error) {
+	disabled := func(pos scanner.Position, format string, args ...interface{}) string {
+		return fmt.Sprintf("%s: ", pos) + fmt.Sprintf(format, args...)
+	}
+
+	switch value := enabledDef.Value.Eval().(type) {
+	case *parser.Bool:
+		if !value.Value {
+			return disabled(enabledDef.ColonPos, "%s is false", enabledPropertyName), nil
+		}
+	case *parser.Map:
+		var defaultDef *parser.Property
+		for _, conditionDef := range value.Properties {
+			if conditionDef.Name == enabledDefaultCondition {
+				defaultDef = conditionDef
+				continue
+			}
+
+			if c.enabledCondition == nil {
+				return "", &BlueprintError{
+					Err: fmt.Errorf("unknown %s condition %q", enabledPropertyName,
+						conditionDef.Name),
+					Pos: conditionDef.ColonPos,
+				}
+			}
+			ok, err := c.enabledCondition(config, conditionDef.Name)
+			if err != nil {
+				return "", &BlueprintError{
+					Err: fmt.Errorf("%s condition %q: %s", enabledPropertyName,
+						conditionDef.Name, err),
+					Pos: conditionDef.ColonPos,
+				}
+			}
+			if ok {
+				if !conditionDef.Value.Eval().(*parser.Bool).Value {
+					return disabled(conditionDef.ColonPos, "%s is false for condition %q",
+						enabledPropertyName, conditionDef.Name), nil
+				}
+				return "", nil
+			}
+		}
+
+		if defaultDef != nil && !defaultDef.Value.Eval().(*parser.Bool).Value {
+			return disabled(defaultDef.ColonPos, "%s is false by default",
+				enabledPropertyName), nil
+		}
+	}
+	return "", nil
+}
+
+// checkDisabledDependencies returns an error for every enabled module that
+// depends on a disabled module.
+func (c *Context) checkDisabledDependencies() []error {
+	var errs []error
+	for _, module := range c.modulesSorted {
+		if module.disabledReason != "" {
+			continue
+		}
+		for _, dep := range module.directDeps {
+			if dep.module.disabledReason == "" {
+				continue
+			}
+			errs = append(errs, &ModuleError{
+				BlueprintError: BlueprintError{
+					Err: fmt.Errorf("depends on disabled module %q (%s)", dep.module.Name(),
+						dep.module.disabledReason),
+					Pos: module.pos,
+				},
+				module: module,
+			})
+			if len(errs) >= maxErrors {
+				return errs
+			}
+		}
+	}
+	return errs
+}
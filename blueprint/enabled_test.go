@@ -0,0 +1,182 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func enabledTestCondition(config interface{}, condition string) (bool, error) {
+	switch condition {
+	case "linux":
+		return config.(string) == "linux", nil
+	case "darwin":
+		return config.(string) == "darwin", nil
+	}
+	return false, fmt.Errorf("unknown condition")
+}
+
+func setupEnabledTest(t *testing.T, config string, bp string) (*Context, []error) {
+	ctx := NewContext()
+	ctx.RegisterModuleType("foo_module", newFooModule)
+	ctx.RegisterModuleType("outputs_module", newOutputsModule)
+	ctx.SetEnabledCondition(enabledTestCondition)
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(bp),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) == 0 {
+		_, errs = ctx.PrepareBuildActions(config)
+	}
+	return ctx, errs
+}
+
+func TestEnabledProperty(t *testing.T) {
+	bp := `
+		outputs_module {
+		    name: "A",
+		    outs: ["a"],
+		    enabled: false,
+		}
+
+		outputs_module {
+		    name: "B",
+		    outs: ["b"],
+		    enabled: {
+		        linux: true,
+		        default: false,
+		    },
+		}
+
+		outputs_module {
+		    name: "C",
+		    outs: ["c"],
+		    enabled: {
+		        darwin: false,
+		    },
+		}
+	`
+
+	testCases := []struct {
+		config  string
+		enabled map[string]bool
+	}{
+		{"linux", map[string]bool{"A": false, "B": true, "C": true}},
+		{"darwin", map[string]bool{"A": false, "B": false, "C": false}},
+	}
+
+	for _, testCase := range testCases {
+		ctx, errs := setupEnabledTest(t, testCase.config, bp)
+		if len(errs) > 0 {
+			t.Fatalf("%s: unexpected errors: %q", testCase.config, errs)
+		}
+
+		buf := &bytes.Buffer{}
+		if err := ctx.WriteBuildFile(buf); err != nil {
+			t.Fatalf("unexpected error writing build file: %s", err)
+		}
+
+		for name, enabled := range testCase.enabled {
+			module := ctx.modulesFromName(name)[0].logicModule
+			if ctx.ModuleEnabled(module) != enabled {
+				t.Errorf("%s: expected %s to be enabled %v", testCase.config, name, enabled)
+			}
+			built := strings.Contains(buf.String(), "${g.verifytest.outDir}/"+strings.ToLower(name)+":")
+			if built != enabled {
+				t.Errorf("%s: expected build statements of %s %v, got %v", testCase.config, name, enabled, built)
+			}
+		}
+	}
+}
+
+func TestEnabledPropertyErrors(t *testing.T) {
+	testCases := []struct {
+		bp   string
+		errs []string
+	}{
+		{
+			bp: `
+				foo_module {
+				    name: "A",
+				    deps: ["B"],
+				}
+
+				foo_module {
+				    name: "B",
+				    enabled: {
+				        linux: false,
+				    },
+				}
+
+				foo_module {
+				    name: "C",
+				    deps: ["B"],
+				    enabled: false,
+				}
+			`,
+			errs: []string{
+				`Blueprints:2:5: module "A": depends on disabled module "B" (Blueprints:10:18: enabled is false for condition "linux")`,
+			},
+		},
+		{
+			bp: `
+				foo_module {
+				    name: "A",
+				    enabled: "yes",
+				}
+
+				foo_module {
+				    name: "B",
+				    enabled: {
+				        linux: "yes",
+				    },
+				}
+			`,
+			errs: []string{
+				`Blueprints:4:16: enabled must be a bool or a map of conditions to bools`,
+				`Blueprints:10:18: enabled condition "linux" must be a bool`,
+			},
+		},
+		{
+			bp: `
+				foo_module {
+				    name: "A",
+				    enabled: {
+				        windows: true,
+				    },
+				}
+			`,
+			errs: []string{
+				`Blueprints:5:20: enabled condition "windows": unknown condition`,
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		_, errs := setupEnabledTest(t, "linux", testCase.bp)
+		var got []string
+		for _, err := range errs {
+			got = append(got, err.Error())
+		}
+		if strings.Join(got, "\n") != strings.Join(testCase.errs, "\n") {
+			t.Errorf("expected errors:\n  %s\ngot:\n  %s", strings.Join(testCase.errs, "\n  "),
+				strings.Join(got, "\n  "))
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const exportedNinjaFileHeader = `******************************************************************************
+***            This file is generated and should not be edited             ***
+******************************************************************************
+
+This file contains the Ninja variables exported by the primary builder for
+use by hand-written Ninja files.  Removing or renaming a variable fails the
+generation of this file until the file is deleted.
+`
+
+var exportedValueEscaper = strings.NewReplacer("$", "$$")
+
+// ExportNinjaVariable adds a variable with a literal value to the Ninja file
+// written by WriteExportedNinjaFile, which hand-written Ninja files can include
+// or subninja to use values of the configuration.  The name may not contain
+// ".", so it can't collide with the names of the variables Blueprint
+// generates.  The value may not contain a newline, which Ninja variables can't
+// hold.
+func (c *Context) ExportNinjaVariable(name, value string) error {
+	if err := validateNinjaName(name); err != nil {
+		return err
+	}
+	if name == "" || strings.Contains(name, ".") {
+		return fmt.Errorf("invalid exported Ninja variable name %q", name)
+	}
+	if strings.Contains(value, "\n") {
+		return fmt.Errorf("value of exported Ninja variable %q contains a newline", name)
+	}
+	if _, exists := c.exportedVariables[name]; exists {
+		return fmt.Errorf("Ninja variable %q is already exported", name)
+	}
+
+	if c.exportedVariables == nil {
+		c.exportedVariables = make(map[string]string)
+	}
+	c.exportedVariables[name] = value
+	return nil
+}
+
+// ExportedNinjaVariables returns the names of the variables added with
+// ExportNinjaVariable, sorted.
+func (c *Context) ExportedNinjaVariables() []string {
+	names := make([]string, 0, len(c.exportedVariables))
+	for name := range c.exportedVariables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WriteExportedNinjaFile writes the variables added with ExportNinjaVariable
+// to w as Ninja variable assignments, sorted by name.
+func (c *Context) WriteExportedNinjaFile(w io.Writer) error {
+	nw := newNinjaWriter(w)
+
+	err := nw.Comment(exportedNinjaFileHeader)
+	if err != nil {
+		return err
+	}
+
+	err = nw.BlankLine()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range c.ExportedNinjaVariables() {
+		value := exportedValueEscaper.Replace(c.exportedVariables[name])
+		if strings.HasPrefix(value, " ") {
+			value = "$" + value
+		}
+		err = nw.Assign(name, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CheckExportedNinjaVariables returns an error if any of the names of
+// previously exported variables, usually read from the previous exported
+// Ninja file with ReadExportedNinjaVariableNames, is no longer exported,
+// because hand-written Ninja files may still refer to it.
+func (c *Context) CheckExportedNinjaVariables(previous []string) error {
+	var removed []string
+	for _, name := range previous {
+		if _, ok := c.exportedVariables[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+
+	if len(removed) > 0 {
+		sort.Strings(removed)
+		return fmt.Errorf("exported Ninja variables %s are no longer exported",
+			strings.Join(quoteStrings(removed), ", "))
+	}
+	return nil
+}
+
+// ReadExportedNinjaVariableNames returns the names of the variables assigned in
+// a file written by WriteExportedNinjaFile.
+func ReadExportedNinjaVariableNames(r io.Reader) ([]string, error) {
+	var names []string
+	continued := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		wasContinued := continued
+		// A line ending in an odd number of "$" continues on the next line.
+		trimmed := strings.TrimRight(line, "$")
+		continued = (len(line)-len(trimmed))%2 == 1
+		if wasContinued || line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.Index(line, " = "); i > 0 {
+			names = append(names, line[:i])
+		}
+	}
+
+	return names, scanner.Err()
+}
+
+func quoteStrings(strs []string) []string {
+	ret := make([]string, len(strs))
+	for i, s := range strs {
+		ret[i] = fmt.Sprintf("%q", s)
+	}
+	return ret
+}
@@ -0,0 +1,84 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExportedNinjaFile(t *testing.T) {
+	ctx := NewContext()
+	for name, value := range map[string]string{
+		"product_out": "out/target/product/generic",
+		"cflags":      "-DPRICE=$5",
+		"banner":      " two words",
+	} {
+		if err := ctx.ExportNinjaVariable(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := ctx.WriteExportedNinjaFile(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "banner = $ two words\n" +
+		"cflags = -DPRICE=$$5\n" +
+		"product_out = out/target/product/generic\n"
+	if out := buf.String(); !strings.HasPrefix(out, "# *****") || !strings.HasSuffix(out, "\n\n"+expected) {
+		t.Errorf("expected exported file ending in:\n%s\ngot:\n%s", expected, out)
+	}
+
+	names, err := ReadExportedNinjaVariableNames(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := []string{"banner", "cflags", "product_out"}; !reflect.DeepEqual(names, w) {
+		t.Errorf("expected names %q, got %q", w, names)
+	}
+
+	if err := ctx.CheckExportedNinjaVariables(names); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	err = ctx.CheckExportedNinjaVariables([]string{"cflags", "product_dir", "arch"})
+	if err == nil || err.Error() != `exported Ninja variables "arch", "product_dir" are no longer exported` {
+		t.Errorf("expected an error for removed variables, got %v", err)
+	}
+}
+
+func TestExportNinjaVariableErrors(t *testing.T) {
+	ctx := NewContext()
+	if err := ctx.ExportNinjaVariable("a", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a", "", "g.pkg.a", "a b"} {
+		if err := ctx.ExportNinjaVariable(name, "2"); err == nil {
+			t.Errorf("%q: expected an error", name)
+		}
+	}
+
+	err := ctx.ExportNinjaVariable("banner", "two\nlines")
+	if err == nil || err.Error() != `value of exported Ninja variable "banner" contains a newline` {
+		t.Errorf("expected an error for a newline in the value, got %v", err)
+	}
+	if names := ctx.ExportedNinjaVariables(); len(names) != 1 {
+		t.Errorf("expected only a to be exported, got %q", names)
+	}
+}
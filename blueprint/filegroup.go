@@ -0,0 +1,466 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/google/blueprint/pathtools"
+	"github.com/google/blueprint/proptools"
+)
+
+// A SourceFileProducer is a Module that provides a list of source files that
+// other modules can refer to using the ":name" syntax in their source lists.
+// The returned paths are relative to the root source directory.  Srcs is only
+// called after the module's GenerateBuildActions method has been called.
+type SourceFileProducer interface {
+	Srcs() []string
+}
+
+type sourceDependencyTag struct {
+	BaseDependencyTag
+}
+
+// SourceDepTag is the DependencyTag used for the dependencies added by
+// ExtractSourceDeps on modules referenced with the ":name" syntax.
+var SourceDepTag DependencyTag = sourceDependencyTag{}
+
+// SrcIsModule returns the name of the module if s is a reference to a module
+// using the ":name" syntax, or an empty string otherwise.
+func SrcIsModule(s string) string {
+	if len(s) > 1 && s[0] == ':' {
+		return s[1:]
+	}
+	return ""
+}
+
+// ExtractSourceDeps adds a dependency with SourceDepTag from the current module
+// on each module referenced using the ":name" syntax in srcs.  It must be called
+// from a BottomUpMutator before ExpandSources is used to expand the same list.
+// Dependencies for properties tagged with `blueprint:"path"` are added
+// automatically and don't need to be extracted.
+func ExtractSourceDeps(ctx BottomUpMutatorContext, srcs []string) {
+	var deps []string
+	seen := make(map[string]bool)
+
+	for _, s := range srcs {
+		if name := SrcIsModule(s); name != "" && !seen[name] {
+			seen[name] = true
+			deps = append(deps, name)
+		}
+	}
+
+	if len(deps) > 0 {
+		ctx.AddDependency(ctx.Module(), SourceDepTag, deps...)
+	}
+}
+
+// pathDepsMutator adds a dependency with SourceDepTag on every module referenced
+// using the ":name" syntax in a property tagged with `blueprint:"path"`, so that
+// those properties can be passed to ExpandSources without the module type
+// having to call ExtractSourceDeps.  References to undefined modules are
+// reported at the position of the property.
+func pathDepsMutator(ctx BottomUpMutatorContext) {
+	mctx := ctx.(*mutatorContext)
+
+	var deps []string
+	seen := make(map[string]bool)
+
+	proptools.VisitPathProperties(mctx.module.moduleProperties,
+		func(propertyName string, values []string) {
+			for _, s := range values {
+				name := SrcIsModule(s)
+				if name == "" || seen[name] {
+					continue
+				}
+				seen[name] = true
+
+				if !ctx.OtherModuleExists(name) && !mctx.context.allowMissingDependencies {
+					ctx.PropertyErrorf(propertyName, "references undefined module %q", name)
+					continue
+				}
+				deps = append(deps, name)
+			}
+		})
+
+	if len(deps) > 0 {
+		ctx.AddDependency(ctx.Module(), SourceDepTag, deps...)
+	}
+}
+
+// A GeneratedSourceProducer is a Module whose build statements generate source
+// files that other modules can refer to using the ":name" syntax in their
+// source lists, instead of hardcoding paths into the output directory of the
+// module.  A module may be both a SourceFileProducer and a
+// GeneratedSourceProducer.  GeneratedSources is only called after the
+// module's GenerateBuildActions method has been called.
+type GeneratedSourceProducer interface {
+	GeneratedSources() GeneratedSources
+}
+
+// GeneratedSources are the outputs of the build statements of a
+// GeneratedSourceProducer that other modules use as sources.  All paths are
+// paths in the Ninja file, like those of the outputs of the build statements.
+type GeneratedSources struct {
+	// Srcs are the generated source files.  Build statements should list
+	// them as inputs, which makes them depend on the generating build
+	// statements.
+	Srcs []string
+
+	// Deps are the other generated files, like headers, that the build
+	// statements using Srcs must list as implicit inputs.
+	Deps []string
+
+	// IncludeDirs are the directories of the generated headers, to be added
+	// to the include path of the modules using the sources.
+	IncludeDirs []string
+}
+
+func (g *GeneratedSources) empty() bool {
+	return len(g.Srcs) == 0 && len(g.Deps) == 0 && len(g.IncludeDirs) == 0
+}
+
+// Sources are the sources returned by ExpandSourcesWithGenerated.
+type Sources struct {
+	// Srcs are the source files, relative to the root source directory.
+	Srcs []string
+
+	// Generated are the generated sources of the referenced
+	// GeneratedSourceProducer modules that are not referenced in the
+	// excludes, without the excluded generated sources.
+	Generated GeneratedSources
+}
+
+// ExpandSources returns the list of source files in srcs, relative to the root
+// source directory.  Globs are expanded, and ":name" references are replaced
+// with the Srcs of the referenced SourceFileProducer modules, which must have
+// been added as dependencies, either automatically for properties tagged with
+// `blueprint:"path"` or with ExtractSourceDeps.  Files in excludes, matching
+// the glob patterns in excludes, or provided by the modules referenced in
+// excludes are removed from the result, whichever way they were listed in
+// srcs.  Both srcs and excludes are relative to the directory of the module's
+// Blueprints file.  References to modules that provide generated sources are
+// reported as errors, module types that support them use
+// ExpandSourcesWithGenerated instead.
+func ExpandSources(ctx ModuleContext, srcs, excludes []string) []string {
+	return expandSources(ctx, srcs, excludes, false).Srcs
+}
+
+// ExpandSourcesWithGenerated is like ExpandSources, but also accepts ":name"
+// references to GeneratedSourceProducer modules, and returns their
+// generated sources separately from the source files.
+func ExpandSourcesWithGenerated(ctx ModuleContext, srcs, excludes []string) Sources {
+	return expandSources(ctx, srcs, excludes, true)
+}
+
+func expandSources(ctx ModuleContext, srcs, excludes []string, allowGenerated bool) Sources {
+	prefix := ctx.ModuleDir()
+
+	sourceDeps := make(map[string]Module)
+	ctx.VisitDirectDeps(func(dep Module) {
+		if ctx.OtherModuleDependencyTag(dep) == SourceDepTag {
+			sourceDeps[ctx.OtherModuleName(dep)] = dep
+		}
+	})
+
+	producerSrcs := func(name string) ([]string, *GeneratedSources, bool) {
+		dep := sourceDeps[name]
+		if dep == nil {
+			if !isMissingDependency(ctx, name) {
+				ctx.ModuleErrorf("missing source dependency %q, was ExtractSourceDeps called?", name)
+			}
+			return nil, nil, false
+		}
+		producer, isProducer := dep.(SourceFileProducer)
+		genProducer, isGenProducer := dep.(GeneratedSourceProducer)
+		if !isProducer && !isGenProducer {
+			ctx.ModuleErrorf("source dependency %q is not a source file producing module", name)
+			return nil, nil, false
+		}
+
+		var srcs []string
+		if isProducer {
+			srcs = producer.Srcs()
+		}
+		var generated *GeneratedSources
+		if isGenProducer {
+			if g := genProducer.GeneratedSources(); !g.empty() {
+				generated = &g
+			}
+		}
+		return srcs, generated, true
+	}
+
+	excluded := make(map[string]bool, len(excludes))
+	excludedModules := make(map[string]bool)
+	excludePatterns := make([]string, 0, len(excludes))
+	var excludeGlobs []string
+	for _, e := range excludes {
+		if name := SrcIsModule(e); name != "" {
+			excludedModules[name] = true
+			srcs, generated, _ := producerSrcs(name)
+			for _, src := range srcs {
+				excluded[src] = true
+			}
+			if generated != nil {
+				for _, src := range generated.Srcs {
+					excluded[src] = true
+				}
+			}
+			continue
+		}
+		e = filepath.Join(prefix, e)
+		excluded[e] = true
+		excludePatterns = append(excludePatterns, e)
+		if pathtools.IsGlob(e) {
+			excludeGlobs = append(excludeGlobs, e)
+		}
+	}
+
+	isExcluded := func(src string) bool {
+		if excluded[src] {
+			return true
+		}
+		for i, pattern := range excludeGlobs {
+			if pattern == "" {
+				continue
+			}
+			match, err := pathtools.Match(pattern, src)
+			if err != nil {
+				ctx.ModuleErrorf("exclude %q: %s", pattern, err.Error())
+				// Report each invalid pattern only once.
+				excludeGlobs[i] = ""
+			} else if match {
+				return true
+			}
+		}
+		return false
+	}
+
+	var expanded Sources
+	seenSrcs, seenDeps, seenIncludeDirs := make(map[string]bool), make(map[string]bool), make(map[string]bool)
+	appendUnique := func(list []string, seen map[string]bool, paths []string) []string {
+		for _, path := range paths {
+			if !seen[path] {
+				seen[path] = true
+				list = append(list, path)
+			}
+		}
+		return list
+	}
+
+	for _, s := range srcs {
+		if name := SrcIsModule(s); name != "" {
+			srcs, generated, ok := producerSrcs(name)
+			if !ok {
+				continue
+			}
+			for _, src := range srcs {
+				if !isExcluded(src) {
+					expanded.Srcs = append(expanded.Srcs, src)
+				}
+			}
+			if generated == nil || excludedModules[name] {
+				continue
+			}
+			if !allowGenerated {
+				ctx.ModuleErrorf("source dependency %q provides generated sources, which are not supported here", name)
+				continue
+			}
+			g := &expanded.Generated
+			for _, src := range generated.Srcs {
+				if !excluded[src] {
+					g.Srcs = appendUnique(g.Srcs, seenSrcs, []string{src})
+				}
+			}
+			g.Deps = appendUnique(g.Deps, seenDeps, generated.Deps)
+			g.IncludeDirs = appendUnique(g.IncludeDirs, seenIncludeDirs, generated.IncludeDirs)
+		} else if pathtools.IsGlob(s) {
+			matches, err := ctx.GlobWithDeps(filepath.Join(prefix, s), excludePatterns)
+			if err != nil {
+				ctx.ModuleErrorf("glob: %s", err.Error())
+				continue
+			}
+			for _, src := range matches {
+				if !excluded[src] {
+					expanded.Srcs = append(expanded.Srcs, src)
+				}
+			}
+		} else if src := filepath.Join(prefix, s); !isExcluded(src) {
+			expanded.Srcs = append(expanded.Srcs, src)
+		}
+	}
+
+	return expanded
+}
+
+// ExpandPathProperty returns ExpandSources of the values of the module
+// property named property, excluding the values of the property of the same
+// struct with the "exclude_" prefix, for example "exclude_srcs" for "srcs" or
+// "target.exclude_srcs" for "target.srcs".  Both properties must be tagged
+// with `blueprint:"path"` so that their ":name" references are added as
+// dependencies, and are treated as empty if they don't exist or are not set.
+func ExpandPathProperty(ctx ModuleContext, property string) []string {
+	srcs, excludes := pathPropertyValues(ctx, property)
+	return ExpandSources(ctx, srcs, excludes)
+}
+
+// ExpandPathPropertyWithGenerated is like ExpandPathProperty, but returns
+// ExpandSourcesWithGenerated of the values of the properties.
+func ExpandPathPropertyWithGenerated(ctx ModuleContext, property string) Sources {
+	srcs, excludes := pathPropertyValues(ctx, property)
+	return ExpandSourcesWithGenerated(ctx, srcs, excludes)
+}
+
+func pathPropertyValues(ctx ModuleContext, property string) (srcs, excludes []string) {
+	excludeProperty := "exclude_" + property
+	if i := strings.LastIndex(property, "."); i >= 0 {
+		excludeProperty = property[:i+1] + "exclude_" + property[i+1:]
+	}
+
+	proptools.VisitPathProperties(ctx.moduleInfo().moduleProperties,
+		func(propertyName string, values []string) {
+			switch propertyName {
+			case property:
+				srcs = append(srcs, values...)
+			case excludeProperty:
+				excludes = append(excludes, values...)
+			}
+		})
+
+	return srcs, excludes
+}
+
+// isMissingDependency returns true if name was a dependency of the module that
+// could not be found while AllowMissingDependencies was set.  It doesn't use
+// GetMissingDependencies, as that marks the missing dependencies as handled.
+func isMissingDependency(ctx ModuleContext, name string) bool {
+	if mctx, ok := ctx.(*moduleContext); ok {
+		for _, missing := range mctx.module.missingDeps {
+			if missing == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RegisterFileGroupModuleTypes registers the built-in "filegroup" and
+// "module_group" module types, and the mutator that adds the dependencies of
+// module_group modules.
+//
+// A filegroup is a named list of source files, which may contain globs and
+// references to other source file producing modules:
+//
+//	filegroup {
+//	    name: "headers",
+//	    srcs: ["include/*.h", ":generated_headers"],
+//	    exclude_srcs: ["include/internal.h"],
+//	}
+//
+// A module_group is a named list of source file producing modules, and
+// provides the sources of all of them.  Both forward the generated sources of
+// the GeneratedSourceProducer modules they reference:
+//
+//	module_group {
+//	    name: "all_headers",
+//	    modules: ["headers", "other_headers"],
+//	}
+func (c *Context) RegisterFileGroupModuleTypes() {
+	c.RegisterModuleType("filegroup", newFileGroupModule)
+	c.RegisterModuleType("module_group", newModuleGroupModule)
+	c.RegisterBottomUpMutator("blueprint_filegroup_deps", fileGroupDepsMutator).Parallel()
+}
+
+func fileGroupDepsMutator(ctx BottomUpMutatorContext) {
+	if m, ok := ctx.Module().(*moduleGroupModule); ok {
+		srcs := make([]string, len(m.properties.Modules))
+		for i, name := range m.properties.Modules {
+			srcs[i] = ":" + strings.TrimPrefix(name, ":")
+		}
+		ExtractSourceDeps(ctx, srcs)
+	}
+}
+
+type fileGroupModule struct {
+	SimpleName
+	properties struct {
+		// Srcs lists the files in the filegroup, relative to the directory of
+		// the Blueprints file.  It may contain globs and ":name" references.
+		Srcs []string `blueprint:"path"`
+
+		// Exclude_srcs lists files, glob patterns or ":name" references to
+		// remove from Srcs.
+		Exclude_srcs []string `blueprint:"path"`
+	}
+
+	srcs Sources
+}
+
+var _ SourceFileProducer = (*fileGroupModule)(nil)
+var _ GeneratedSourceProducer = (*fileGroupModule)(nil)
+
+func newFileGroupModule() (Module, []interface{}) {
+	m := &fileGroupModule{}
+	return m, []interface{}{&m.properties, &m.SimpleName.Properties}
+}
+
+func (m *fileGroupModule) GenerateBuildActions(ctx ModuleContext) {
+	m.srcs = ExpandPathPropertyWithGenerated(ctx, "srcs")
+}
+
+func (m *fileGroupModule) Srcs() []string {
+	return m.srcs.Srcs
+}
+
+func (m *fileGroupModule) GeneratedSources() GeneratedSources {
+	return m.srcs.Generated
+}
+
+type moduleGroupModule struct {
+	SimpleName
+	properties struct {
+		// Modules lists the names of the source file producing modules in the
+		// group.
+		Modules []string
+	}
+
+	srcs Sources
+}
+
+var _ SourceFileProducer = (*moduleGroupModule)(nil)
+var _ GeneratedSourceProducer = (*moduleGroupModule)(nil)
+
+func newModuleGroupModule() (Module, []interface{}) {
+	m := &moduleGroupModule{}
+	return m, []interface{}{&m.properties, &m.SimpleName.Properties}
+}
+
+func (m *moduleGroupModule) GenerateBuildActions(ctx ModuleContext) {
+	srcs := make([]string, len(m.properties.Modules))
+	for i, name := range m.properties.Modules {
+		srcs[i] = ":" + strings.TrimPrefix(name, ":")
+	}
+	m.srcs = ExpandSourcesWithGenerated(ctx, srcs, nil)
+}
+
+func (m *moduleGroupModule) Srcs() []string {
+	return m.srcs.Srcs
+}
+
+func (m *moduleGroupModule) GeneratedSources() GeneratedSources {
+	return m.srcs.Generated
+}
@@ -0,0 +1,302 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type srcsModule struct {
+	SimpleName
+	properties struct {
+		Srcs []string `blueprint:"path"`
+	}
+
+	srcs []string
+}
+
+func newSrcsModule() (Module, []interface{}) {
+	m := &srcsModule{}
+	return m, []interface{}{&m.properties, &m.SimpleName.Properties}
+}
+
+func (m *srcsModule) GenerateBuildActions(ctx ModuleContext) {
+	m.srcs = ExpandSources(ctx, m.properties.Srcs, nil)
+}
+
+type excludeSrcsModule struct {
+	SimpleName
+	properties struct {
+		Srcs         []string `blueprint:"path"`
+		Exclude_srcs []string `blueprint:"path"`
+
+		Target struct {
+			Srcs         []string `blueprint:"path"`
+			Exclude_srcs []string `blueprint:"path"`
+		}
+	}
+
+	srcs, targetSrcs []string
+}
+
+func newExcludeSrcsModule() (Module, []interface{}) {
+	m := &excludeSrcsModule{}
+	return m, []interface{}{&m.properties, &m.SimpleName.Properties}
+}
+
+func (m *excludeSrcsModule) GenerateBuildActions(ctx ModuleContext) {
+	m.srcs = ExpandPathProperty(ctx, "srcs")
+	m.targetSrcs = ExpandPathProperty(ctx, "target.srcs")
+}
+
+type genSrcsModule struct {
+	SimpleName
+}
+
+func newGenSrcsModule() (Module, []interface{}) {
+	m := &genSrcsModule{}
+	return m, []interface{}{&m.SimpleName.Properties}
+}
+
+func (m *genSrcsModule) GenerateBuildActions(ctx ModuleContext) {}
+
+func (m *genSrcsModule) GeneratedSources() GeneratedSources {
+	dir := "out/gen/" + m.Name()
+	return GeneratedSources{
+		Srcs:        []string{dir + "/gen.c"},
+		Deps:        []string{dir + "/include/gen.h"},
+		IncludeDirs: []string{dir + "/include"},
+	}
+}
+
+type withGeneratedSrcsModule struct {
+	SimpleName
+	properties struct {
+		Srcs         []string `blueprint:"path"`
+		Exclude_srcs []string `blueprint:"path"`
+	}
+
+	srcs Sources
+}
+
+func newWithGeneratedSrcsModule() (Module, []interface{}) {
+	m := &withGeneratedSrcsModule{}
+	return m, []interface{}{&m.properties, &m.SimpleName.Properties}
+}
+
+func (m *withGeneratedSrcsModule) GenerateBuildActions(ctx ModuleContext) {
+	m.srcs = ExpandPathPropertyWithGenerated(ctx, "srcs")
+}
+
+func setupFileGroupTest(t *testing.T, bp string) (*Context, []error) {
+	ctx := NewContext()
+	ctx.RegisterFileGroupModuleTypes()
+	ctx.RegisterModuleType("srcs_module", newSrcsModule)
+	ctx.RegisterModuleType("exclude_srcs_module", newExcludeSrcsModule)
+	ctx.RegisterModuleType("gen_srcs_module", newGenSrcsModule)
+	ctx.RegisterModuleType("with_generated_srcs_module", newWithGeneratedSrcsModule)
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			subdirs = ["lib"]
+
+			` + bp),
+		"lib/Blueprints": []byte(`
+			filegroup {
+			    name: "lib_srcs",
+			    srcs: ["*.c", "extra/b.c"],
+			    exclude_srcs: ["internal.c"],
+			}
+
+			filegroup {
+			    name: "lib_headers",
+			    srcs: ["include/*.h"],
+			}
+		`),
+		"lib/a.c":           nil,
+		"lib/internal.c":    nil,
+		"lib/extra/b.c":     nil,
+		"lib/include/lib.h": nil,
+		"main.c":            nil,
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) == 0 {
+		_, errs = ctx.PrepareBuildActions(nil)
+	}
+	return ctx, errs
+}
+
+func TestFileGroup(t *testing.T) {
+	ctx, errs := setupFileGroupTest(t, `
+		module_group {
+		    name: "lib_all",
+		    modules: ["lib_srcs", "lib_headers"],
+		}
+
+		srcs_module {
+		    name: "main",
+		    srcs: ["main.c", ":lib_all"],
+		}
+	`)
+	if len(errs) > 0 {
+		t.Errorf("unexpected errors:")
+		for _, err := range errs {
+			t.Errorf("  %s", err)
+		}
+		t.FailNow()
+	}
+
+	main := ctx.modulesFromName("main")[0].logicModule.(*srcsModule)
+
+	expected := []string{
+		"main.c",
+		"lib/a.c",
+		"lib/extra/b.c",
+		"lib/include/lib.h",
+	}
+	if !reflect.DeepEqual(main.srcs, expected) {
+		t.Errorf("incorrect srcs:")
+		t.Errorf("  expected: %q", expected)
+		t.Errorf("       got: %q", main.srcs)
+	}
+}
+
+func TestFileGroupNotSourceFileProducer(t *testing.T) {
+	_, errs := setupFileGroupTest(t, `
+		srcs_module {
+		    name: "other",
+		}
+
+		srcs_module {
+		    name: "main",
+		    srcs: [":other"],
+		}
+	`)
+
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(),
+		`source dependency "other" is not a source file producing module`) {
+		t.Errorf("expected a single not a source file producing module error, got %q", errs)
+	}
+}
+
+func TestPathPropertyUndefinedModule(t *testing.T) {
+	_, errs := setupFileGroupTest(t, `
+		srcs_module {
+		    name: "main",
+		    srcs: ["main.c", ":missing"],
+		}
+	`)
+
+	expected := `Blueprints:7:11: module "main": srcs: references undefined module "missing"`
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Errorf("expected error %q, got %q", expected, errs)
+	}
+}
+
+func TestExpandPathProperty(t *testing.T) {
+	ctx, errs := setupFileGroupTest(t, `
+		module_group {
+		    name: "lib_all",
+		    modules: ["lib_srcs", "lib_headers"],
+		}
+
+		exclude_srcs_module {
+		    name: "main",
+		    srcs: ["main.c", ":lib_all", "lib/extra/b.c"],
+		    exclude_srcs: [":lib_headers", "lib/extra/*"],
+		    target: {
+		        srcs: ["lib/*.c"],
+		        exclude_srcs: ["lib/a.c"],
+		    },
+		}
+	`)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+
+	main := ctx.modulesFromName("main")[0].logicModule.(*excludeSrcsModule)
+
+	expected := []string{"main.c", "lib/a.c"}
+	if !reflect.DeepEqual(main.srcs, expected) {
+		t.Errorf("expected srcs %q, got %q", expected, main.srcs)
+	}
+
+	expected = []string{"lib/internal.c"}
+	if !reflect.DeepEqual(main.targetSrcs, expected) {
+		t.Errorf("expected target srcs %q, got %q", expected, main.targetSrcs)
+	}
+}
+
+func TestGeneratedSources(t *testing.T) {
+	ctx, errs := setupFileGroupTest(t, `
+		gen_srcs_module {
+		    name: "gen",
+		}
+
+		gen_srcs_module {
+		    name: "excluded_gen",
+		}
+
+		filegroup {
+		    name: "srcs_and_gen",
+		    srcs: ["main.c", ":gen", ":lib_headers"],
+		}
+
+		with_generated_srcs_module {
+		    name: "main",
+		    srcs: [":srcs_and_gen", ":gen", ":excluded_gen"],
+		    exclude_srcs: [":lib_headers", ":excluded_gen"],
+		}
+	`)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+
+	main := ctx.modulesFromName("main")[0].logicModule.(*withGeneratedSrcsModule)
+
+	expected := Sources{
+		Srcs: []string{"main.c"},
+		Generated: GeneratedSources{
+			Srcs:        []string{"out/gen/gen/gen.c"},
+			Deps:        []string{"out/gen/gen/include/gen.h"},
+			IncludeDirs: []string{"out/gen/gen/include"},
+		},
+	}
+	if !reflect.DeepEqual(main.srcs, expected) {
+		t.Errorf("incorrect srcs:")
+		t.Errorf("  expected: %q", expected)
+		t.Errorf("       got: %q", main.srcs)
+	}
+}
+
+func TestGeneratedSourcesNotSupported(t *testing.T) {
+	_, errs := setupFileGroupTest(t, `
+		gen_srcs_module {
+		    name: "gen",
+		}
+
+		srcs_module {
+		    name: "main",
+		    srcs: ["main.c", ":gen"],
+		}
+	`)
+
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(),
+		`source dependency "gen" provides generated sources, which are not supported here`) {
+		t.Errorf("expected a single generated sources not supported error, got %q", errs)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"fmt"
+)
+
+// SetRootModules enables garbage collection of the module graph.  When names
+// is not empty, PrepareBuildActions drops every module variant that is not
+// reachable through dependencies from a variant of one of the named modules,
+// before any GenerateBuildActions method is called.  Dropped variants never
+// generate build actions, and are not visited by singletons.
+//
+// This makes builds of a few targets in a large tree faster, at the cost of
+// leaving the build actions of the rest of the tree out of the Ninja file.
+// Garbage collection is disabled if names is empty, which is the default.
+func (c *Context) SetRootModules(names []string) {
+	c.rootModules = append([]string(nil), names...)
+}
+
+// SetRootModulesIf makes every module variant for which pred returns true a
+// root of the garbage collection enabled by SetRootModules, in addition to the
+// named modules, for example the tools that the build system itself needs.
+func (c *Context) SetRootModulesIf(pred func(Module) bool) {
+	c.rootModulesIf = pred
+}
+
+// pruneUnreachableModules removes the module variants that are not reachable
+// from the root modules from the module graph.
+func (c *Context) pruneUnreachableModules() []error {
+	if len(c.rootModules) == 0 {
+		return nil
+	}
+
+	var errs []error
+	reachable := make(map[*moduleInfo]bool)
+
+	var walk func(module *moduleInfo)
+	walk = func(module *moduleInfo) {
+		if reachable[module] {
+			return
+		}
+		reachable[module] = true
+		for _, dep := range module.directDeps {
+			walk(dep.module)
+		}
+	}
+
+	for _, name := range c.rootModules {
+		group := c.moduleNames[name]
+		if group == nil {
+			errs = append(errs, fmt.Errorf("root module %q is not defined", name))
+			continue
+		}
+		for _, module := range group.modules {
+			walk(module)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	if c.rootModulesIf != nil {
+		for _, module := range c.modulesSorted {
+			if c.rootModulesIf(module.logicModule) {
+				walk(module)
+			}
+		}
+	}
+
+	if len(reachable) == len(c.modulesSorted) {
+		return nil
+	}
+
+	pruned := len(c.modulesSorted) - len(reachable)
+
+	sorted := make([]*moduleInfo, 0, len(reachable))
+	for _, module := range c.modulesSorted {
+		if !reachable[module] {
+			delete(c.moduleInfo, module.logicModule)
+			continue
+		}
+		sorted = append(sorted, module)
+
+		// Unreachable modules may depend on reachable ones, but never the other
+		// way around, so only the reverse dependencies need to be filtered.
+		reverseDeps := module.reverseDeps[:0]
+		for _, rdep := range module.reverseDeps {
+			if reachable[rdep] {
+				reverseDeps = append(reverseDeps, rdep)
+			}
+		}
+		module.reverseDeps = reverseDeps
+	}
+	c.modulesSorted = sorted
+
+	groups := c.moduleGroups[:0]
+	for _, group := range c.moduleGroups {
+		modules := group.modules[:0]
+		for _, module := range group.modules {
+			if reachable[module] {
+				modules = append(modules, module)
+			}
+		}
+		group.modules = modules
+
+		if len(modules) == 0 {
+			delete(c.moduleNames, group.name)
+			continue
+		}
+		groups = append(groups, group)
+	}
+	c.moduleGroups = groups
+	c.cachedSortedModuleNames = nil
+
+	c.Logger().Scope("gc").Debugf("dropped %d of %d module variants not reachable from %v",
+		pruned, pruned+len(sorted), c.rootModules)
+
+	return nil
+}
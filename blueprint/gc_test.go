@@ -0,0 +1,179 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+type gcTestModule struct {
+	SimpleName
+	properties struct {
+		Deps []string
+	}
+	generated bool
+}
+
+func newGCTestModule() (Module, []interface{}) {
+	m := &gcTestModule{}
+	return m, []interface{}{&m.properties, &m.SimpleName.Properties}
+}
+
+func (m *gcTestModule) DynamicDependencies(ctx DynamicDependerModuleContext) []string {
+	return m.properties.Deps
+}
+
+func (m *gcTestModule) GenerateBuildActions(ModuleContext) {
+	m.generated = true
+}
+
+const gcTestBlueprints = `
+	gc_module {
+		name: "A",
+		deps: ["B", "C"],
+	}
+
+	gc_module {
+		name: "B",
+		deps: ["D"],
+	}
+
+	gc_module {
+		name: "C",
+	}
+
+	gc_module {
+		name: "D",
+	}
+
+	gc_module {
+		name: "E",
+		deps: ["D"],
+	}
+`
+
+func setupGCTest(t *testing.T, roots []string,
+	rootsIf func(Module) bool) (*Context, map[string]*gcTestModule, []error) {
+	ctx := NewContext()
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(gcTestBlueprints),
+	})
+	ctx.RegisterModuleType("gc_module", newGCTestModule)
+	ctx.SetRootModules(roots)
+	ctx.SetRootModulesIf(rootsIf)
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) > 0 {
+		t.Fatalf("unexpected parse errors: %v", errs)
+	}
+
+	errs = ctx.ResolveDependencies(nil)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected dep errors: %v", errs)
+	}
+
+	modules := make(map[string]*gcTestModule)
+	for _, name := range []string{"A", "B", "C", "D", "E"} {
+		modules[name] = ctx.modulesFromName(name)[0].logicModule.(*gcTestModule)
+	}
+
+	_, errs = ctx.PrepareBuildActions(nil)
+
+	return ctx, modules, errs
+}
+
+func visitedModuleNames(ctx *Context) []string {
+	var names []string
+	ctx.VisitAllModules(func(m Module) {
+		names = append(names, ctx.ModuleName(m))
+	})
+	sort.Strings(names)
+	return names
+}
+
+func TestSetRootModules(t *testing.T) {
+	testCases := []struct {
+		roots    []string
+		rootsIf  func(Module) bool
+		expected []string
+	}{
+		{
+			roots:    nil,
+			expected: []string{"A", "B", "C", "D", "E"},
+		},
+		{
+			roots:    []string{"A"},
+			expected: []string{"A", "B", "C", "D"},
+		},
+		{
+			roots:    []string{"B", "E"},
+			expected: []string{"B", "D", "E"},
+		},
+		{
+			roots: []string{"C"},
+			rootsIf: func(m Module) bool {
+				return m.Name() == "B"
+			},
+			expected: []string{"B", "C", "D"},
+		},
+		{
+			// The predicate doesn't enable garbage collection by itself.
+			rootsIf: func(m Module) bool {
+				return m.Name() == "B"
+			},
+			expected: []string{"A", "B", "C", "D", "E"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		ctx, modules, errs := setupGCTest(t, testCase.roots, testCase.rootsIf)
+		if len(errs) > 0 {
+			t.Errorf("%v: unexpected errors: %v", testCase.roots, errs)
+			continue
+		}
+
+		if names := visitedModuleNames(ctx); !reflect.DeepEqual(names, testCase.expected) {
+			t.Errorf("%v: expected modules %q, got %q", testCase.roots, testCase.expected, names)
+		}
+
+		var generated []string
+		for name, module := range modules {
+			if module.generated {
+				generated = append(generated, name)
+			}
+		}
+		sort.Strings(generated)
+		if !reflect.DeepEqual(generated, testCase.expected) {
+			t.Errorf("%v: expected generated modules %q, got %q", testCase.roots, testCase.expected, generated)
+		}
+
+		for _, module := range ctx.modulesSorted {
+			for _, rdep := range module.reverseDeps {
+				if ctx.moduleInfo[rdep.logicModule] != rdep {
+					t.Errorf("%v: %s has dropped reverse dependency %s", testCase.roots, module, rdep)
+				}
+			}
+		}
+	}
+}
+
+func TestSetRootModulesUndefined(t *testing.T) {
+	_, _, errs := setupGCTest(t, []string{"A", "F"}, nil)
+	if len(errs) != 1 || errs[0].Error() != `root module "F" is not defined` {
+		t.Errorf("expected undefined root module error, got %v", errs)
+	}
+}
@@ -18,6 +18,8 @@ import (
 	"fmt"
 	"reflect"
 	"sort"
+
+	"github.com/google/blueprint/pathtools"
 )
 
 type GlobPath struct {
@@ -37,6 +39,15 @@ func verifyGlob(fileName, pattern string, excludes []string, g GlobPath) {
 	}
 }
 
+// SetSymlinkPolicy sets how the paths of the Blueprints files and of the files
+// and directories found by globs are canonicalized.  Paths are not modified by
+// default, as with pathtools.PreserveSymlinks.  The same policy must be used by
+// the tools that rerun the globs during the build, like bpglob, so that the
+// results agree.  It must be called before ParseBlueprintsFiles.
+func (c *Context) SetSymlinkPolicy(policy pathtools.SymlinkPolicy) {
+	c.symlinkPolicy = policy
+}
+
 func (c *Context) glob(pattern string, excludes []string) ([]string, error) {
 	fileName := globToFileName(pattern, excludes)
 
@@ -56,6 +67,14 @@ func (c *Context) glob(pattern string, excludes []string) ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
+	files, err = c.symlinkPolicy.CanonicalizeListFs(c.fs, files)
+	if err != nil {
+		return nil, err
+	}
+	deps, err = c.symlinkPolicy.CanonicalizeListFs(c.fs, deps)
+	if err != nil {
+		return nil, err
+	}
 
 	// Store the results
 	c.globLock.Lock()
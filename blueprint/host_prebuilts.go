@@ -0,0 +1,97 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/google/blueprint/proptools"
+)
+
+// A HostPlatformConfig is a config that selects the host platform whose
+// prebuilt tools are used, for example to generate a Ninja file for a
+// different build host.  Without it the platform Blueprint runs on is used.
+type HostPlatformConfig interface {
+	// HostPlatform returns the name of the host platform in the form
+	// <os>-<arch>, for example linux-x86 or darwin-arm64.
+	HostPlatform() string
+}
+
+// HostPlatform returns the name of the host platform selected by config if it
+// implements HostPlatformConfig, or else the name of the platform Blueprint
+// runs on.  The architecture of 32 and 64-bit x86 hosts is called x86, as in
+// the names of the directories of prebuilt toolchains.
+func HostPlatform(config interface{}) string {
+	if c, ok := config.(HostPlatformConfig); ok {
+		if platform := c.HostPlatform(); platform != "" {
+			return platform
+		}
+	}
+
+	arch := runtime.GOARCH
+	if arch == "amd64" || arch == "386" {
+		arch = "x86"
+	}
+	return runtime.GOOS + "-" + arch
+}
+
+// HostPrebuiltPaths maps the names of host platforms, as returned by
+// HostPlatform, to the paths of the prebuilts for those platforms.  A path may
+// contain "${platform}", which is replaced by the name of the platform.
+type HostPrebuiltPaths map[string]string
+
+// SelectHostPrebuilt returns the path of the prebuilt for the host platform
+// selected by config, and an error if there is no prebuilt for the platform
+// or the file doesn't exist.  Paths are relative to the directory the primary
+// builder runs in.
+func SelectHostPrebuilt(config interface{}, paths HostPrebuiltPaths) (string, error) {
+	platform := HostPlatform(config)
+	path, ok := paths[platform]
+	if !ok {
+		var platforms []string
+		for p := range paths {
+			platforms = append(platforms, p)
+		}
+		sort.Strings(platforms)
+		return "", fmt.Errorf("no prebuilt for host platform %q, only for %s", platform,
+			strings.Join(platforms, ", "))
+	}
+
+	path = strings.Replace(path, "${platform}", platform, -1)
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("prebuilt for host platform %q: %s", platform, err)
+	}
+
+	return path, nil
+}
+
+// HostPrebuiltVariable returns a Variable in pctx whose value is the path of
+// the prebuilt tool for the host platform, selected by SelectHostPrebuilt.  A
+// missing prebuilt fails PrepareBuildActions if the variable is used.  Like
+// PackageContext.VariableFunc, it may only be called during a Go package's
+// initialization.
+func HostPrebuiltVariable(pctx PackageContext, name string, paths HostPrebuiltPaths) Variable {
+	return pctx.VariableFunc(name, func(config interface{}) (string, error) {
+		path, err := SelectHostPrebuilt(config, paths)
+		if err != nil {
+			return "", fmt.Errorf("%s: %s", name, err)
+		}
+		return proptools.NinjaEscape([]string{path})[0], nil
+	})
+}
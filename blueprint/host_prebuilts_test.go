@@ -0,0 +1,133 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+var (
+	hostPrebuiltsTestPctx = NewPackageContext("github.com/google/blueprint/hostprebuiltstest")
+
+	hostPrebuiltsTestTool = HostPrebuiltVariable(hostPrebuiltsTestPctx, "tool", HostPrebuiltPaths{
+		"test-ok":      "host_prebuilts_test.go",
+		"test-missing": "host_prebuilts_missing",
+	})
+
+	hostPrebuiltsTestRule = hostPrebuiltsTestPctx.StaticRule("tool", RuleParams{
+		Command: "${tool} $out",
+	})
+)
+
+type hostPlatformConfig string
+
+func (c hostPlatformConfig) HostPlatform() string {
+	return string(c)
+}
+
+type hostPrebuiltsSingleton struct{}
+
+func (hostPrebuiltsSingleton) GenerateBuildActions(ctx SingletonContext) {
+	ctx.Build(hostPrebuiltsTestPctx, BuildParams{
+		Rule:    hostPrebuiltsTestRule,
+		Outputs: []string{"out"},
+	})
+}
+
+func TestHostPlatform(t *testing.T) {
+	if platform := HostPlatform(hostPlatformConfig("darwin-arm64")); platform != "darwin-arm64" {
+		t.Errorf("expected the configured platform, got %q", platform)
+	}
+
+	platform := HostPlatform(nil)
+	if !strings.HasPrefix(platform, runtime.GOOS+"-") {
+		t.Errorf("expected a %s platform, got %q", runtime.GOOS, platform)
+	}
+	if runtime.GOARCH == "amd64" && platform != runtime.GOOS+"-x86" {
+		t.Errorf("expected an x86 platform, got %q", platform)
+	}
+}
+
+func TestSelectHostPrebuilt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "host_prebuilts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "linux-x86"), nil, 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths := HostPrebuiltPaths{
+		"linux-x86":    filepath.Join(dir, "${platform}"),
+		"darwin-arm64": filepath.Join(dir, "${platform}"),
+	}
+
+	path, err := SelectHostPrebuilt(hostPlatformConfig("linux-x86"), paths)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if expected := filepath.Join(dir, "linux-x86"); path != expected {
+		t.Errorf("expected %q, got %q", expected, path)
+	}
+
+	_, err = SelectHostPrebuilt(hostPlatformConfig("darwin-arm64"), paths)
+	if err == nil || !strings.HasPrefix(err.Error(), `prebuilt for host platform "darwin-arm64": `) {
+		t.Errorf("expected an error for the missing prebuilt, got %v", err)
+	}
+
+	_, err = SelectHostPrebuilt(hostPlatformConfig("windows-x86"), paths)
+	expected := `no prebuilt for host platform "windows-x86", only for darwin-arm64, linux-x86`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+}
+
+func TestHostPrebuiltVariable(t *testing.T) {
+	prepare := func(config interface{}) (*Context, []error) {
+		ctx := NewContext()
+		ctx.RegisterSingletonType("host_prebuilts", func() Singleton { return hostPrebuiltsSingleton{} })
+		ctx.MockFileSystem(map[string][]byte{"Blueprints": nil})
+		_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+		if len(errs) == 0 {
+			_, errs = ctx.PrepareBuildActions(config)
+		}
+		return ctx, errs
+	}
+
+	ctx, errs := prepare(hostPlatformConfig("test-ok"))
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := ctx.WriteBuildFile(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "tool = host_prebuilts_test.go\n") {
+		t.Errorf("expected the prebuilt in the Ninja file, got:\n%s", buf.String())
+	}
+
+	_, errs = prepare(hostPlatformConfig("test-missing"))
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), `tool: prebuilt for host platform "test-missing": `) {
+		t.Errorf("expected an error for the missing prebuilt, got %q", errs)
+	}
+}
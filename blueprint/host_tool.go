@@ -0,0 +1,157 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"bytes"
+	"strings"
+)
+
+// A HostToolProvider is a Module that builds a tool that runs on the build
+// host, and that other modules can use in their build statements.
+type HostToolProvider interface {
+	// HostToolPath returns the path of the tool as it should appear in the
+	// Ninja file, or an empty string if the module doesn't provide a tool.
+	// It is only called after the module's GenerateBuildActions method has
+	// been called.
+	HostToolPath() string
+}
+
+type hostToolDependencyTag struct {
+	BaseDependencyTag
+}
+
+// HostToolDepTag is the DependencyTag used for dependencies on
+// HostToolProvider modules.  Module types that need a host tool built for a
+// different variant than their own can add the dependency with
+// AddVariationDependencies or AddFarVariationDependencies using this tag
+// instead of calling AddHostToolDependencies.
+var HostToolDepTag DependencyTag = hostToolDependencyTag{}
+
+// AddHostToolDependencies adds a dependency with HostToolDepTag from the
+// current module on each of the named host tool modules.  It must be called
+// from a BottomUpMutator before ModuleContext.HostToolPath is used to look up
+// the paths of the tools.
+func AddHostToolDependencies(ctx BottomUpMutatorContext, tools ...string) {
+	if len(tools) > 0 {
+		ctx.AddDependency(ctx.Module(), HostToolDepTag, tools...)
+	}
+}
+
+func (m *moduleContext) HostToolPath(name string) string {
+	dep := m.GetDirectDepWithTag(name, HostToolDepTag)
+	if dep == nil {
+		if !isMissingDependency(m, name) {
+			m.ModuleErrorf("missing host tool dependency %q, was AddHostToolDependencies called?", name)
+		}
+		return ""
+	}
+
+	provider, ok := dep.(HostToolProvider)
+	if !ok {
+		m.ModuleErrorf("host tool dependency %q is not a host tool providing module", name)
+		return ""
+	}
+
+	path := provider.HostToolPath()
+	if path == "" {
+		m.ModuleErrorf("host tool dependency %q does not provide a host tool", name)
+		return ""
+	}
+
+	for _, tool := range m.hostTools {
+		if tool == path {
+			return path
+		}
+	}
+	m.hostTools = append(m.hostTools, path)
+
+	return path
+}
+
+// hostToolDeps returns the paths returned by HostToolPath that are referenced
+// by the arguments of a build statement, or by the command of its rule if it
+// is a rule defined by this module.  References to the module's variables and
+// to the arguments are expanded before looking for the paths, so that a tool
+// path passed through a variable is found too.
+func (m *moduleContext) hostToolDeps(def *buildDef) []string {
+	if len(m.hostTools) == 0 {
+		return nil
+	}
+
+	var values []string
+	if rule, ok := def.Rule.(*localRule); ok {
+		values = append(values, expandLocalVariables(rule.def_.Variables["command"], def.Args))
+	}
+	for _, value := range def.Args {
+		values = append(values, expandLocalVariables(value, nil))
+	}
+
+	var deps []string
+	for _, tool := range m.hostTools {
+		for _, value := range values {
+			if containsPath(value, tool) {
+				deps = append(deps, tool)
+				break
+			}
+		}
+	}
+	return deps
+}
+
+// expandLocalVariables returns the value of s with the references to local
+// variables and to the build statement arguments in args replaced by their
+// values.  References to package variables are left as they are, since they
+// can't contain paths only known while generating the build actions of a
+// module.
+func expandLocalVariables(s *ninjaString, args map[Variable]*ninjaString) string {
+	if s == nil {
+		return ""
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(s.strings[0])
+	for i, v := range s.variables {
+		if value, ok := args[v]; ok {
+			buf.WriteString(expandLocalVariables(value, nil))
+		} else if local, ok := v.(*localVariable); ok {
+			buf.WriteString(expandLocalVariables(local.value_, nil))
+		} else {
+			buf.WriteString("${" + v.name() + "}")
+		}
+		buf.WriteString(s.strings[i+1])
+	}
+	return buf.String()
+}
+
+// containsPath returns true if path appears in s, not as part of a longer path.
+func containsPath(s, path string) bool {
+	for {
+		i := strings.Index(s, path)
+		if i < 0 {
+			return false
+		}
+		end := i + len(path)
+		if (i == 0 || !isPathChar(s[i-1])) && (end == len(s) || !isPathChar(s[end])) {
+			return true
+		}
+		s = s[i+1:]
+	}
+}
+
+func isPathChar(c byte) bool {
+	return c != ' ' && c != '\t' && c != '\n' && c != '=' && c != '"' && c != '\'' &&
+		c != ';' && c != '&' && c != '|' && c != '(' && c != ')'
+}
@@ -0,0 +1,204 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+var (
+	hostToolTestPctx = NewPackageContext("github.com/google/blueprint/hosttooltest")
+
+	hostToolTestRun = hostToolTestPctx.StaticRule("run",
+		RuleParams{
+			Command: "$tool $in > $out",
+		},
+		"tool")
+)
+
+type hostToolModule struct {
+	SimpleName
+}
+
+func newHostToolModule() (Module, []interface{}) {
+	m := &hostToolModule{}
+	return m, []interface{}{&m.SimpleName.Properties}
+}
+
+func (m *hostToolModule) GenerateBuildActions(ctx ModuleContext) {}
+
+func (m *hostToolModule) HostToolPath() string {
+	return "out/bin/" + m.Name()
+}
+
+type hostToolUserModule struct {
+	SimpleName
+	properties struct {
+		Tools []string
+	}
+}
+
+func newHostToolUserModule() (Module, []interface{}) {
+	m := &hostToolUserModule{}
+	return m, []interface{}{&m.properties, &m.SimpleName.Properties}
+}
+
+func (m *hostToolUserModule) GenerateBuildActions(ctx ModuleContext) {
+	for _, tool := range m.properties.Tools {
+		path := ctx.HostToolPath(tool)
+		if path == "" {
+			continue
+		}
+
+		ctx.Build(hostToolTestPctx, BuildParams{
+			Rule:    hostToolTestRun,
+			Outputs: []string{"out/" + tool + ".arg"},
+			Inputs:  []string{"in"},
+			Args: map[string]string{
+				"tool": path,
+			},
+		})
+
+		local := ctx.Rule(hostToolTestPctx, tool, RuleParams{
+			Command: path + " --flag $in > $out",
+		})
+		ctx.Build(hostToolTestPctx, BuildParams{
+			Rule:    local,
+			Outputs: []string{"out/" + tool + ".local"},
+			Inputs:  []string{"in"},
+		})
+
+		// The path is also found through a local variable used in the command
+		// of a local rule, directly or through an argument, or in an argument
+		// of a package rule.
+		ctx.Variable(hostToolTestPctx, tool+"_path", path)
+		viaVariable := ctx.Rule(hostToolTestPctx, tool+"_variable", RuleParams{
+			Command: "${" + tool + "_path} $in > $out",
+		})
+		ctx.Build(hostToolTestPctx, BuildParams{
+			Rule:    viaVariable,
+			Outputs: []string{"out/" + tool + ".var"},
+			Inputs:  []string{"in"},
+		})
+		viaArg := ctx.Rule(hostToolTestPctx, tool+"_arg", RuleParams{
+			Command: "$cmd $in > $out",
+		}, "cmd")
+		ctx.Build(hostToolTestPctx, BuildParams{
+			Rule:    viaArg,
+			Outputs: []string{"out/" + tool + ".local_arg"},
+			Inputs:  []string{"in"},
+			Args: map[string]string{
+				"cmd": "${" + tool + "_path} --flag",
+			},
+		})
+		ctx.Build(hostToolTestPctx, BuildParams{
+			Rule:    hostToolTestRun,
+			Outputs: []string{"out/" + tool + ".arg_variable"},
+			Inputs:  []string{"in"},
+			Args: map[string]string{
+				"tool": "${" + tool + "_path}",
+			},
+		})
+	}
+
+	// A build statement that doesn't use any tool gets no extra dependencies.
+	ctx.Build(hostToolTestPctx, BuildParams{
+		Rule:    hostToolTestRun,
+		Outputs: []string{"out/other"},
+		Inputs:  []string{"in"},
+		Args: map[string]string{
+			"tool": "out/bin/other_tool_wrapper",
+		},
+	})
+}
+
+func hostToolTestDepsMutator(ctx BottomUpMutatorContext) {
+	if m, ok := ctx.Module().(*hostToolUserModule); ok {
+		AddHostToolDependencies(ctx, m.properties.Tools...)
+	}
+}
+
+func setupHostToolTest(t *testing.T, bp string) (*Context, []error) {
+	ctx := NewContext()
+	ctx.RegisterModuleType("host_tool", newHostToolModule)
+	ctx.RegisterModuleType("host_tool_user", newHostToolUserModule)
+	ctx.RegisterBottomUpMutator("host_tool_deps", hostToolTestDepsMutator)
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(bp),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) > 0 {
+		t.Fatalf("unexpected parse errors: %q", errs)
+	}
+
+	_, errs = ctx.PrepareBuildActions(nil)
+	return ctx, errs
+}
+
+func TestHostToolPath(t *testing.T) {
+	ctx, errs := setupHostToolTest(t, `
+		host_tool {
+		    name: "other_tool",
+		}
+
+		host_tool_user {
+		    name: "user",
+		    tools: ["other_tool"],
+		}
+	`)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := ctx.WriteBuildFile(buf); err != nil {
+		t.Fatalf("unexpected error writing build file: %s", err)
+	}
+	out := buf.String()
+
+	for _, expected := range []string{
+		"build out/other_tool.arg: g.hosttooltest.run in | out/bin/other_tool\n",
+		"build out/other_tool.local: m.user_.other_tool in | out/bin/other_tool\n",
+		"build out/other_tool.var: m.user_.other_tool_variable in | out/bin/other_tool\n",
+		"build out/other_tool.local_arg: m.user_.other_tool_arg in | out/bin/other_tool\n",
+		"build out/other_tool.arg_variable: g.hosttooltest.run in | out/bin/other_tool\n",
+		"build out/other: g.hosttooltest.run in\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("missing %q in build file:\n%s", expected, out)
+		}
+	}
+}
+
+func TestHostToolPathErrors(t *testing.T) {
+	_, errs := setupHostToolTest(t, `
+		host_tool_user {
+		    name: "not_a_tool",
+		}
+
+		host_tool_user {
+		    name: "user",
+		    tools: ["not_a_tool"],
+		}
+	`)
+
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(),
+		`host tool dependency "not_a_tool" is not a host tool providing module`) {
+		t.Errorf("expected host tool provider error, got %q", errs)
+	}
+}
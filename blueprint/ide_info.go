@@ -0,0 +1,247 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/google/blueprint/pathtools"
+)
+
+// IDEInfoVersion is the version of the format of the files written by the
+// singleton returned by NewIDEInfoSingleton.  It is incremented when a change
+// to the format would break the tools that read them.
+const IDEInfoVersion = 1
+
+// IDEInfo describes how a module builds its sources, for tools that generate
+// IDE projects.
+type IDEInfo struct {
+	// Language is the language of the sources, like "go", "c++" or "java".
+	Language string
+
+	// Srcs are the source files of the module, relative to the top of the
+	// source tree.
+	Srcs []string
+
+	// GeneratedSrcs are the source files of the module that are generated
+	// by the build.
+	GeneratedSrcs []string
+
+	// IncludeDirs are the directories searched for headers or imports.
+	IncludeDirs []string
+
+	// Flags are the flags passed to the compiler.
+	Flags []string
+
+	// Pctx is the PackageContext in whose scope the Ninja variables
+	// referenced by the paths are evaluated, if they reference any.
+	Pctx PackageContext
+}
+
+// An IDEInfoProvider is a module that describes its sources for IDE project
+// generators.  IDEInfo is called after GenerateBuildActions.
+type IDEInfoProvider interface {
+	IDEInfo() IDEInfo
+}
+
+// IDEModuleInfo is the content of the JSON file written for each variant of a
+// module that implements IDEInfoProvider.
+type IDEModuleInfo struct {
+	// Version is IDEInfoVersion.
+	Version int `json:"version"`
+
+	// Name, Variant and Type are the name, variant and module type of the
+	// module.  Variant is empty for modules without variants.
+	Name    string `json:"name"`
+	Variant string `json:"variant,omitempty"`
+	Type    string `json:"type"`
+
+	// Dir is the directory of the module, and Blueprint the Blueprints file
+	// that defines it, relative to the top of the source tree.
+	Dir       string `json:"dir"`
+	Blueprint string `json:"blueprint"`
+
+	// Language, Srcs, GeneratedSrcs, IncludeDirs and Flags are the IDEInfo
+	// of the module, with the Ninja variables in the paths evaluated.
+	Language      string   `json:"language,omitempty"`
+	Srcs          []string `json:"srcs,omitempty"`
+	GeneratedSrcs []string `json:"generated_srcs,omitempty"`
+	IncludeDirs   []string `json:"include_dirs,omitempty"`
+	Flags         []string `json:"flags,omitempty"`
+
+	// Deps are the names of the direct dependencies of the module.
+	Deps []string `json:"deps,omitempty"`
+}
+
+// IDEInfoIndex is the content of the index.json file written next to the
+// files of the modules.
+type IDEInfoIndex struct {
+	// Version is IDEInfoVersion.
+	Version int `json:"version"`
+
+	// Modules are the paths of the IDEModuleInfo files, relative to the
+	// directory of the index, sorted by module name.
+	Modules []string `json:"modules"`
+}
+
+// NewIDEInfoSingleton returns a SingletonFactory for a singleton that writes
+// an IDEModuleInfo JSON file for every variant of the modules that implement
+// IDEInfoProvider into dir, as modules/<module dir>/<name>.json, or
+// <name>@<variant>.json for modules with variants, and an IDEInfoIndex of them
+// as index.json.  The files are written by Context.WriteSingletonFiles.  Files
+// are only rewritten when their content changes, and the files listed in the
+// previous index that belong to modules that don't exist anymore are removed.
+func NewIDEInfoSingleton(dir string) SingletonFactory {
+	return func() Singleton {
+		return &ideInfoSingleton{dir: dir}
+	}
+}
+
+type ideInfoSingleton struct {
+	dir string
+
+	// infos are the module infos found by GenerateBuildActions, and files
+	// the paths of their files relative to dir, in the order of the index.
+	infos []*IDEModuleInfo
+	files []string
+}
+
+func (s *ideInfoSingleton) GenerateBuildActions(ctx SingletonContext) {
+	s.infos, s.files = nil, nil
+
+	ctx.VisitAllModulesIf(isIDEInfoProvider, func(module Module) {
+		info, err := ideModuleInfo(ctx, module)
+		if err != nil {
+			ctx.ModuleErrorf(module, "%s", err)
+			return
+		}
+
+		file := info.Name + ".json"
+		if info.Variant != "" {
+			file = info.Name + "@" + info.Variant + ".json"
+		}
+		file = filepath.Join("modules", info.Dir, file)
+
+		s.infos = append(s.infos, info)
+		s.files = append(s.files, file)
+	})
+}
+
+// WriteFiles writes the files of the modules and the index, unless
+// PrepareBuildActions failed.
+func (s *ideInfoSingleton) WriteFiles(failed bool) error {
+	if failed {
+		return nil
+	}
+
+	index := IDEInfoIndex{
+		Version: IDEInfoVersion,
+		Modules: []string{},
+	}
+	written := make(map[string]bool)
+	for i, info := range s.infos {
+		file := s.files[i]
+		err := writeIDEInfoFile(filepath.Join(s.dir, file), info)
+		if err != nil {
+			return err
+		}
+		index.Modules = append(index.Modules, file)
+		written[file] = true
+	}
+
+	indexFile := filepath.Join(s.dir, "index.json")
+	if data, err := ioutil.ReadFile(indexFile); err == nil {
+		var old IDEInfoIndex
+		if json.Unmarshal(data, &old) == nil {
+			for _, file := range old.Modules {
+				if !written[file] {
+					os.Remove(filepath.Join(s.dir, file))
+				}
+			}
+		}
+	}
+
+	return writeIDEInfoFile(indexFile, index)
+}
+
+func isIDEInfoProvider(module Module) bool {
+	_, ok := module.(IDEInfoProvider)
+	return ok
+}
+
+// ideModuleInfo returns the IDEModuleInfo of a module that implements
+// IDEInfoProvider.
+func ideModuleInfo(ctx SingletonContext, module Module) (*IDEModuleInfo, error) {
+	ide := module.(IDEInfoProvider).IDEInfo()
+
+	eval := func(paths []string) ([]string, error) {
+		if ide.Pctx == nil {
+			return paths, nil
+		}
+		ret := make([]string, len(paths))
+		for i, path := range paths {
+			value, err := ctx.Eval(ide.Pctx, path)
+			if err != nil {
+				return nil, err
+			}
+			ret[i] = value
+		}
+		return ret, nil
+	}
+
+	info := &IDEModuleInfo{
+		Version:   IDEInfoVersion,
+		Name:      ctx.ModuleName(module),
+		Variant:   ctx.ModuleSubDir(module),
+		Type:      ctx.ModuleType(module),
+		Dir:       ctx.ModuleDir(module),
+		Blueprint: ctx.BlueprintFile(module),
+		Language:  ide.Language,
+		Flags:     ide.Flags,
+	}
+
+	var err error
+	if info.Srcs, err = eval(ide.Srcs); err != nil {
+		return nil, err
+	}
+	if info.GeneratedSrcs, err = eval(ide.GeneratedSrcs); err != nil {
+		return nil, err
+	}
+	if info.IncludeDirs, err = eval(ide.IncludeDirs); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	ctx.VisitDirectDeps(module, func(dep Module) {
+		name := ctx.ModuleName(dep)
+		if !seen[name] {
+			seen[name] = true
+			info.Deps = append(info.Deps, name)
+		}
+	})
+
+	return info, nil
+}
+
+func writeIDEInfoFile(filename string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return pathtools.WriteFileIfChanged(filename, append(data, '\n'), 0666)
+}
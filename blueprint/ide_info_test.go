@@ -0,0 +1,150 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type ideInfoTestModule struct {
+	fooModule
+	srcs []string
+}
+
+func newIDEInfoTestModule() (Module, []interface{}) {
+	m := &ideInfoTestModule{}
+	return m, []interface{}{&m.properties, &m.SimpleName.Properties}
+}
+
+func (m *ideInfoTestModule) GenerateBuildActions(ctx ModuleContext) {
+	m.srcs = []string{filepath.Join(ctx.ModuleDir(), ctx.ModuleName()+".go")}
+}
+
+func (m *ideInfoTestModule) IDEInfo() IDEInfo {
+	return IDEInfo{
+		Language:      "go",
+		Srcs:          m.srcs,
+		GeneratedSrcs: []string{"${ideInfoTestOutDir}/gen.go"},
+		Pctx:          ideInfoTestPctx,
+	}
+}
+
+var (
+	ideInfoTestPctx = NewPackageContext("github.com/google/blueprint/ide_info_test")
+
+	_ = ideInfoTestPctx.StaticVariable("ideInfoTestOutDir", "out")
+)
+
+func runIDEInfoTest(t *testing.T, dir, bp string) {
+	ctx := NewContext()
+	ctx.RegisterModuleType("ide_module", newIDEInfoTestModule)
+	ctx.RegisterModuleType("foo_module", newFooModule)
+	ctx.RegisterSingletonType("ide_info", NewIDEInfoSingleton(dir))
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints":     []byte(`subdirs = ["dir"]`),
+		"dir/Blueprints": []byte(bp),
+	})
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) == 0 {
+		errs = ctx.ResolveDependencies(nil)
+	}
+	if len(errs) == 0 {
+		_, errs = ctx.PrepareBuildActions(nil)
+	}
+	if len(errs) == 0 {
+		errs = ctx.WriteSingletonFiles(false)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+}
+
+func readIDEInfoFile(t *testing.T, filename string, v interface{}) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIDEInfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ide_info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	runIDEInfoTest(t, dir, `
+		ide_module {
+			name: "a",
+			deps: ["b", "c", "b"],
+		}
+
+		ide_module {
+			name: "b",
+		}
+
+		foo_module {
+			name: "c",
+		}
+	`)
+
+	var index IDEInfoIndex
+	readIDEInfoFile(t, filepath.Join(dir, "index.json"), &index)
+	wantIndex := IDEInfoIndex{
+		Version: IDEInfoVersion,
+		Modules: []string{"modules/dir/a.json", "modules/dir/b.json"},
+	}
+	if !reflect.DeepEqual(index, wantIndex) {
+		t.Errorf("incorrect index:\nwant: %#v\n got: %#v", wantIndex, index)
+	}
+
+	var info IDEModuleInfo
+	readIDEInfoFile(t, filepath.Join(dir, "modules/dir/a.json"), &info)
+	want := IDEModuleInfo{
+		Version:       IDEInfoVersion,
+		Name:          "a",
+		Type:          "ide_module",
+		Dir:           "dir",
+		Blueprint:     "dir/Blueprints",
+		Language:      "go",
+		Srcs:          []string{"dir/a.go"},
+		GeneratedSrcs: []string{"out/gen.go"},
+		Deps:          []string{"b", "c"},
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("incorrect module info:\nwant: %#v\n got: %#v", want, info)
+	}
+
+	runIDEInfoTest(t, dir, `
+		ide_module {
+			name: "a",
+		}
+	`)
+
+	if _, err := os.Stat(filepath.Join(dir, "modules/dir/b.json")); !os.IsNotExist(err) {
+		t.Errorf("expected the file of the removed module to be removed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "modules/dir/a.json")); err != nil {
+		t.Errorf("expected the file of the remaining module to exist, got %v", err)
+	}
+}
@@ -0,0 +1,280 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// An idempotentDef is a build statement of an idempotent rule, with the
+// module or singleton that created it.
+type idempotentDef struct {
+	def       *buildDef
+	key       string
+	module    *moduleInfo
+	singleton string
+}
+
+func (d *idempotentDef) owner() string {
+	if d.module != nil {
+		return d.module.String()
+	}
+	return fmt.Sprintf("singleton %q", d.singleton)
+}
+
+// mergeIdempotentBuildDefs removes the build statements of rules with
+// RuleParams.Idempotent set that are identical to a build statement of the
+// same rule created earlier, so that every output is built by a single build
+// statement.  Module variants come before singletons, sorted by name and
+// variant, so that the module variant that keeps a merged build statement
+// doesn't depend on the dependency order.  Build statements are identical if
+// their rules, outputs, inputs, arguments and variables other than the
+// description evaluate to the same values.  Rules defined by modules and
+// singletons with Rule are the same if their names and parameters are.  It
+// returns an error for every output built by build statements of idempotent
+// rules that are not identical, sorted by output.
+func (c *Context) mergeIdempotentBuildDefs() []error {
+	if !c.hasIdempotentBuildDefs() {
+		return nil
+	}
+
+	outputs := make(map[string]*idempotentDef)
+	var conflicts []idempotentConflict
+
+	merge := func(actionDefs *localBuildActions, module *moduleInfo, singleton string) error {
+		variables, err := c.localVariableValues(actionDefs)
+		if err != nil {
+			return err
+		}
+
+		buildDefs := actionDefs.buildDefs[:0]
+		for _, def := range actionDefs.buildDefs {
+			if def.RuleDef == nil || !def.RuleDef.Idempotent {
+				buildDefs = append(buildDefs, def)
+				continue
+			}
+
+			d := &idempotentDef{def: def, module: module, singleton: singleton}
+			defOutputs, err := evalNinjaStrings(variables, def.Outputs, def.ImplicitOutputs)
+			if err == nil {
+				d.key, err = c.idempotentKey(def, variables)
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %s", d.owner(), err)
+			}
+
+			duplicate := false
+			for _, output := range defOutputs {
+				other, ok := outputs[output]
+				if !ok {
+					outputs[output] = d
+					continue
+				}
+				if other.key == d.key {
+					duplicate = true
+					break
+				}
+				conflicts = append(conflicts, idempotentConflict{output, fmt.Errorf(
+					"output %q is built by different build statements of %s and %s",
+					output, other.owner(), d.owner())})
+				break
+			}
+			if !duplicate {
+				buildDefs = append(buildDefs, def)
+			}
+		}
+		actionDefs.buildDefs = buildDefs
+		return nil
+	}
+
+	modules := append([]*moduleInfo(nil), c.modulesSorted...)
+	sort.Sort(moduleSorter(modules))
+	for _, module := range modules {
+		if err := merge(&module.actionDefs, module, ""); err != nil {
+			return []error{err}
+		}
+	}
+	for _, info := range c.singletonInfo {
+		if err := merge(&info.actionDefs, nil, info.name); err != nil {
+			return []error{err}
+		}
+	}
+
+	sort.Stable(idempotentConflictsByOutput(conflicts))
+	var errs []error
+	for _, conflict := range conflicts {
+		if len(errs) >= maxErrors {
+			break
+		}
+		errs = append(errs, conflict.err)
+	}
+	return errs
+}
+
+// An idempotentConflict is an output built by different build statements of
+// idempotent rules.
+type idempotentConflict struct {
+	output string
+	err    error
+}
+
+type idempotentConflictsByOutput []idempotentConflict
+
+func (s idempotentConflictsByOutput) Len() int           { return len(s) }
+func (s idempotentConflictsByOutput) Less(i, j int) bool { return s[i].output < s[j].output }
+func (s idempotentConflictsByOutput) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func (c *Context) hasIdempotentBuildDefs() bool {
+	for _, module := range c.modulesSorted {
+		for _, def := range module.actionDefs.buildDefs {
+			if def.RuleDef != nil && def.RuleDef.Idempotent {
+				return true
+			}
+		}
+	}
+	for _, info := range c.singletonInfo {
+		for _, def := range info.actionDefs.buildDefs {
+			if def.RuleDef != nil && def.RuleDef.Idempotent {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// idempotentKey returns a string that is equal for two build statements of
+// the same rule if they are identical.
+func (c *Context) idempotentKey(def *buildDef, variables map[Variable]*ninjaString) (string, error) {
+	rule, err := c.idempotentRuleKey(def, variables)
+	if err != nil {
+		return "", err
+	}
+	key := []string{rule}
+	for _, list := range [][]*ninjaString{def.Outputs, def.ImplicitOutputs, def.Inputs,
+		def.Implicits, def.OrderOnly} {
+
+		values, err := evalNinjaStrings(variables, list)
+		if err != nil {
+			return "", err
+		}
+		key = append(key, fmt.Sprintf("%q", values))
+	}
+
+	var args []string
+	for v, value := range def.Args {
+		s, err := value.Eval(variables)
+		if err != nil {
+			return "", err
+		}
+		args = append(args, fmt.Sprintf("%q=%q", v.name(), s))
+	}
+	for name, value := range def.Variables {
+		if name == "description" {
+			continue
+		}
+		s, err := value.Eval(variables)
+		if err != nil {
+			return "", err
+		}
+		args = append(args, fmt.Sprintf("%q=%q", name, s))
+	}
+	sort.Strings(args)
+	key = append(key, args...)
+
+	if def.Pool != nil {
+		key = append(key, def.Pool.fullName(c.pkgNames))
+	}
+	key = append(key, fmt.Sprint(def.Optional))
+
+	return strings.Join(key, "\n"), nil
+}
+
+// idempotentRuleKey returns a string that is equal for the rules of two build
+// statements if they are the same package-level rule, or local rules with the
+// same name and parameters, so that the build statements of the identical
+// rules that different modules define with Rule can be merged.
+func (c *Context) idempotentRuleKey(def *buildDef, variables map[Variable]*ninjaString) (string, error) {
+	local, ok := def.Rule.(*localRule)
+	if !ok {
+		return def.Rule.fullName(c.pkgNames), nil
+	}
+
+	key := []string{"local " + local.name_}
+	for _, dep := range def.RuleDef.CommandDeps {
+		s, err := evalRuleString(dep, variables)
+		if err != nil {
+			return "", err
+		}
+		key = append(key, fmt.Sprintf("%q", s))
+	}
+
+	var params []string
+	for name, value := range def.RuleDef.Variables {
+		if name == "description" {
+			continue
+		}
+		s, err := evalRuleString(value, variables)
+		if err != nil {
+			return "", err
+		}
+		params = append(params, fmt.Sprintf("%q=%q", name, s))
+	}
+	sort.Strings(params)
+	key = append(key, params...)
+
+	if def.RuleDef.Pool != nil {
+		key = append(key, def.RuleDef.Pool.fullName(c.pkgNames))
+	}
+	key = append(key, fmt.Sprint(def.RuleDef.Local, def.RuleDef.NoCache))
+
+	return strings.Join(key, "\n"), nil
+}
+
+// evalRuleString evaluates the variables in a parameter of a rule that are in
+// variables, and keeps the references to the others, like $in and the
+// arguments of the rule, which are set by each build statement.
+func evalRuleString(s *ninjaString, variables map[Variable]*ninjaString) (string, error) {
+	str := s.strings[0]
+	for i, v := range s.variables {
+		if value, ok := variables[v]; ok {
+			evaluated, err := value.Eval(variables)
+			if err != nil {
+				return "", err
+			}
+			str += evaluated
+		} else {
+			str += "${" + v.name() + "}"
+		}
+		str += s.strings[i+1]
+	}
+	return str, nil
+}
+
+// evalNinjaStrings evaluates the ninjaStrings of the lists in order.
+func evalNinjaStrings(variables map[Variable]*ninjaString, lists ...[]*ninjaString) ([]string, error) {
+	var values []string
+	for _, list := range lists {
+		for _, str := range list {
+			value, err := str.Eval(variables)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+	}
+	return values, nil
+}
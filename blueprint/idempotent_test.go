@@ -0,0 +1,232 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var (
+	idempotentTestPctx = NewPackageContext("github.com/google/blueprint/idempotenttest")
+
+	idempotentTestCopy = idempotentTestPctx.StaticRule("copy",
+		RuleParams{
+			Command:    "cp $in $out",
+			Idempotent: true,
+		})
+)
+
+type copyModule struct {
+	SimpleName
+	properties struct {
+		Copies []string
+
+		// Local_rule copies with a rule defined by the module, that
+		// passes Cpflags to cp.
+		Local_rule bool
+		Cpflags    string
+	}
+}
+
+func newCopyModule() (Module, []interface{}) {
+	m := &copyModule{}
+	return m, []interface{}{&m.properties, &m.SimpleName.Properties}
+}
+
+// GenerateBuildActions copies each file in the copies property, given as
+// <from>:<to>, to out/<to>.
+func (m *copyModule) GenerateBuildActions(ctx ModuleContext) {
+	rule := idempotentTestCopy
+	if m.properties.Local_rule {
+		ctx.Variable(idempotentTestPctx, "cpflags", m.properties.Cpflags)
+		rule = ctx.Rule(idempotentTestPctx, "copy", RuleParams{
+			Command:    "cp $cpflags $in $out",
+			Idempotent: true,
+		})
+	}
+
+	for _, c := range m.properties.Copies {
+		parts := strings.SplitN(c, ":", 2)
+		ctx.Build(idempotentTestPctx, BuildParams{
+			Rule:        rule,
+			Description: "copy for " + ctx.ModuleName(),
+			Inputs:      []string{parts[0]},
+			Outputs:     []string{"out/" + parts[1]},
+		})
+	}
+}
+
+func TestMergeIdempotentBuildDefs(t *testing.T) {
+	testCases := []struct {
+		name       string
+		bp         string
+		statements []BuildStatement
+		err        string
+	}{
+		{
+			name: "merged",
+			bp: `
+				copy_module {
+				    name: "A",
+				    copies: ["shared.txt:shared.txt", "a.txt:a.txt"],
+				}
+				copy_module {
+				    name: "B",
+				    copies: ["shared.txt:shared.txt", "b.txt:b.txt"],
+				}
+			`,
+			// A keeps the merged build statement because it sorts before B.
+			statements: []BuildStatement{
+				{Rule: "g.idempotenttest.copy", Owner: "A", Outputs: []string{"out/a.txt"}, Inputs: []string{"a.txt"}},
+				{Rule: "g.idempotenttest.copy", Owner: "A", Outputs: []string{"out/shared.txt"}, Inputs: []string{"shared.txt"}},
+				{Rule: "g.idempotenttest.copy", Owner: "B", Outputs: []string{"out/b.txt"}, Inputs: []string{"b.txt"}},
+			},
+		},
+		{
+			// B is listed first, but A still keeps the merged build
+			// statement.
+			name: "merged reversed",
+			bp: `
+				copy_module {
+				    name: "B",
+				    copies: ["shared.txt:shared.txt"],
+				}
+				copy_module {
+				    name: "A",
+				    copies: ["shared.txt:shared.txt"],
+				}
+			`,
+			statements: []BuildStatement{
+				{Rule: "g.idempotenttest.copy", Owner: "A", Outputs: []string{"out/shared.txt"}, Inputs: []string{"shared.txt"}},
+			},
+		},
+		{
+			name: "conflict",
+			bp: `
+				copy_module {
+				    name: "A",
+				    copies: ["a.txt:shared.txt"],
+				}
+				copy_module {
+				    name: "B",
+				    copies: ["b.txt:shared.txt"],
+				}
+			`,
+			err: `output "out/shared.txt" is built by different build statements of module "A" and module "B"`,
+		},
+		{
+			name: "merged local rules",
+			bp: `
+				copy_module {
+				    name: "A",
+				    copies: ["shared.txt:shared.txt"],
+				    local_rule: true,
+				    cpflags: "-p",
+				}
+				copy_module {
+				    name: "B",
+				    copies: ["shared.txt:shared.txt"],
+				    local_rule: true,
+				    cpflags: "-p",
+				}
+			`,
+			statements: []BuildStatement{
+				{Rule: "m.A_.copy", Owner: "A", Outputs: []string{"out/shared.txt"}, Inputs: []string{"shared.txt"}},
+			},
+		},
+		{
+			name: "conflict local rules",
+			bp: `
+				copy_module {
+				    name: "A",
+				    copies: ["shared.txt:shared.txt"],
+				    local_rule: true,
+				    cpflags: "-p",
+				}
+				copy_module {
+				    name: "B",
+				    copies: ["shared.txt:shared.txt"],
+				    local_rule: true,
+				}
+			`,
+			err: `output "out/shared.txt" is built by different build statements of module "A" and module "B"`,
+		},
+		{
+			name: "conflict local and package rules",
+			bp: `
+				copy_module {
+				    name: "A",
+				    copies: ["shared.txt:shared.txt"],
+				    local_rule: true,
+				}
+				copy_module {
+				    name: "B",
+				    copies: ["shared.txt:shared.txt"],
+				}
+			`,
+			err: `output "out/shared.txt" is built by different build statements of module "A" and module "B"`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctx := NewContext()
+			ctx.RegisterModuleType("copy_module", newCopyModule)
+			ctx.MockFileSystem(map[string][]byte{
+				"Blueprints": []byte(testCase.bp),
+			})
+
+			_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+			if len(errs) > 0 {
+				t.Fatalf("unexpected parse errors: %v", errs)
+			}
+
+			_, errs = ctx.PrepareBuildActions(nil)
+			if testCase.err != "" {
+				if len(errs) != 1 || errs[0].Error() != testCase.err {
+					t.Fatalf("expected error %q, got %q", testCase.err, errs)
+				}
+				return
+			}
+			if len(errs) > 0 {
+				t.Fatalf("unexpected errors: %v", errs)
+			}
+
+			statements, err := ctx.BuildStatements()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Independent modules have no fixed dependency order.
+			sort.Sort(buildStatementsByOwner(statements))
+			if !reflect.DeepEqual(statements, testCase.statements) {
+				t.Errorf("expected build statements:\n%v\ngot:\n%v", testCase.statements, statements)
+			}
+		})
+	}
+}
+
+type buildStatementsByOwner []BuildStatement
+
+func (s buildStatementsByOwner) Len() int { return len(s) }
+func (s buildStatementsByOwner) Less(i, j int) bool {
+	if s[i].Owner != s[j].Owner {
+		return s[i].Owner < s[j].Owner
+	}
+	return s[i].Outputs[0] < s[j].Outputs[0]
+}
+func (s buildStatementsByOwner) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
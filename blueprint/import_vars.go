@@ -0,0 +1,249 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"text/scanner"
+
+	"github.com/google/blueprint/parser"
+)
+
+// importVarsVariable is the variable that lists the Blueprints files whose
+// variables are imported into a Blueprints file.  It is read before the file
+// is evaluated, so it must be assigned a list of string literals.
+//
+// Each element is the path of a Blueprints file in the same directory as the
+// importing file or in one of its parent directories, relative to the
+// directory of the importing file, for example "../../Blueprints".  The
+// imported file is evaluated on its own, with only the variables it imports
+// itself, so variables can be shared by Blueprints files that are not reached
+// through each other's subdirs.
+const importVarsVariable = "import_vars"
+
+// blueprintsControlVariables are the variables that control how Blueprints
+// files are found, which are not imported through import_vars.
+var blueprintsControlVariables = []string{
+	"subdirs",
+	"optional_subdirs",
+	"build",
+	"subname",
+	importVarsVariable,
+}
+
+// An importedFile is a Blueprints file evaluated for import_vars.
+type importedFile struct {
+	scope *parser.Scope
+	errs  []error
+
+	// deps are the imported file and the files it imports, recursively
+	deps []string
+}
+
+// importVars adds the variables imported by the import_vars assignment in the
+// Blueprints file with the given contents to scope, and returns the imported
+// files.
+func (c *Context) importVars(filename string, data []byte, scope *parser.Scope) ([]string, []error) {
+	c.importVarsLock.Lock()
+	defer c.importVarsLock.Unlock()
+
+	return c.importVarsLocked(filename, data, scope, []string{filename})
+}
+
+// importVarsLocked implements importVars, stack is the list of files that are
+// being evaluated, ending with filename.
+func (c *Context) importVarsLocked(filename string, data []byte, scope *parser.Scope,
+	stack []string) ([]string, []error) {
+
+	imports, pos, errs := findImportVars(filename, data)
+	if len(imports) == 0 || len(errs) > 0 {
+		return nil, errs
+	}
+
+	dir := filepath.Dir(filename)
+	var deps []string
+
+	for _, path := range imports {
+		imported := filepath.Join(dir, path)
+		if !isImportableBlueprints(dir, imported) {
+			errs = append(errs, &BlueprintError{
+				Err: fmt.Errorf("%s: %q is not a Blueprints file in the same or a parent directory",
+					importVarsVariable, path),
+				Pos: pos,
+			})
+			continue
+		}
+
+		for i, f := range stack {
+			if f == imported {
+				cycle := append(append([]string(nil), stack[i:]...), imported)
+				errs = append(errs, &BlueprintError{
+					Err: fmt.Errorf("%s cycle: %s", importVarsVariable, strings.Join(cycle, " -> ")),
+					Pos: pos,
+				})
+				return nil, errs
+			}
+		}
+
+		file, newErrs := c.evalImportedFile(imported, pos, stack)
+		if len(newErrs) > 0 {
+			errs = append(errs, newErrs...)
+			continue
+		}
+		deps = append(deps, file.deps...)
+
+		err := scope.Import(file.scope)
+		if err != nil {
+			errs = append(errs, &BlueprintError{
+				Err: fmt.Errorf("%s: %q: %s", importVarsVariable, path, err),
+				Pos: pos,
+			})
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return deps, nil
+}
+
+// evalImportedFile evaluates the variables of a Blueprints file listed in the
+// import_vars of the last file in stack.  The result is cached, so that each
+// file is only evaluated once.
+func (c *Context) evalImportedFile(filename string, pos scanner.Position, stack []string) (*importedFile, []error) {
+	if file, ok := c.importedFiles[filename]; ok {
+		if len(file.errs) > 0 {
+			return nil, []error{&BlueprintError{
+				Err: fmt.Errorf("%s: cannot import variables from %q, it has errors",
+					importVarsVariable, filename),
+				Pos: pos,
+			}}
+		}
+		return file, nil
+	}
+
+	file := &importedFile{}
+	if c.importedFiles == nil {
+		c.importedFiles = make(map[string]*importedFile)
+	}
+
+	data, err := c.readImportedFile(filename)
+	if err != nil {
+		file.errs = []error{&BlueprintError{
+			Err: fmt.Errorf("%s: %s", importVarsVariable, err),
+			Pos: pos,
+		}}
+		c.importedFiles[filename] = file
+		return nil, file.errs
+	}
+
+	file.scope = parser.NewScope(nil)
+	deps, errs := c.importVarsLocked(filename, data, file.scope, append(stack, filename))
+	if len(errs) == 0 {
+		_, errs = parser.ParseAndEval(filename, bytes.NewReader(data), file.scope)
+		for i, err := range errs {
+			if parseErr, ok := err.(*parser.ParseError); ok {
+				errs[i] = &BlueprintError{
+					Err: parseErr.Err,
+					Pos: parseErr.Pos,
+				}
+			}
+		}
+	}
+	if len(errs) > 0 {
+		file.scope = nil
+		file.errs = errs
+		c.importedFiles[filename] = file
+		return nil, errs
+	}
+
+	for _, name := range blueprintsControlVariables {
+		file.scope.Remove(name)
+	}
+	file.deps = append([]string{filename}, deps...)
+	c.importedFiles[filename] = file
+
+	return file, nil
+}
+
+func (c *Context) readImportedFile(filename string) ([]byte, error) {
+	f, err := c.fs.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ioutil.ReadAll(f)
+}
+
+// findImportVars returns the paths listed by the import_vars assignment of a
+// Blueprints file, and the position of the assignment.  Files that don't
+// mention import_vars are not parsed.
+func findImportVars(filename string, data []byte) ([]string, scanner.Position, []error) {
+	if !bytes.Contains(data, []byte(importVarsVariable)) {
+		return nil, scanner.Position{}, nil
+	}
+
+	// Parse errors are reported when the file is evaluated.
+	file, errs := parser.Parse(filename, bytes.NewReader(data), nil)
+	if len(errs) > 0 {
+		return nil, scanner.Position{}, nil
+	}
+
+	for _, def := range file.Defs {
+		assignment, ok := def.(*parser.Assignment)
+		if !ok || assignment.Name != importVarsVariable {
+			continue
+		}
+
+		newError := func() []error {
+			return []error{&BlueprintError{
+				Err: fmt.Errorf("%s must be assigned a list of string literals", importVarsVariable),
+				Pos: assignment.EqualsPos,
+			}}
+		}
+
+		list, ok := assignment.Value.(*parser.List)
+		if !ok || assignment.Assigner != "=" {
+			return nil, assignment.EqualsPos, newError()
+		}
+
+		var imports []string
+		for _, value := range list.Values {
+			s, ok := value.(*parser.String)
+			if !ok {
+				return nil, assignment.EqualsPos, newError()
+			}
+			imports = append(imports, s.Value)
+		}
+		return imports, assignment.EqualsPos, nil
+	}
+
+	return nil, scanner.Position{}, nil
+}
+
+// isImportableBlueprints returns true if imported is in dir or in one of its
+// parent directories.
+func isImportableBlueprints(dir, imported string) bool {
+	rel, err := filepath.Rel(filepath.Dir(imported), dir)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, "../"))
+}
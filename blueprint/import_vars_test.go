@@ -0,0 +1,177 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func parseImportVarsTest(t *testing.T, files map[string]string) (*Context, []string, []error) {
+	fs := make(map[string][]byte)
+	for name, contents := range files {
+		fs[name] = []byte(contents)
+	}
+
+	ctx := NewContext()
+	ctx.MockFileSystem(fs)
+	ctx.RegisterModuleType("foo_module", newFooModule)
+	ctx.SetTrackUnusedDefinitions(true)
+
+	deps, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	return ctx, deps, errs
+}
+
+func TestImportVars(t *testing.T) {
+	ctx, deps, errs := parseImportVarsTest(t, map[string]string{
+		"Blueprints": `
+			subdirs = ["a", "a/b"]
+			version = "1.0"
+		`,
+		"a/Blueprints": `
+			import_vars = ["../Blueprints"]
+			suffix = "-" + version
+			unused = "x"
+		`,
+		"a/b/Blueprints": `
+			import_vars = ["../Blueprints"]
+			foo_module {
+				name: "b",
+				foo: version + suffix,
+			}
+		`,
+	})
+	if len(errs) > 0 {
+		t.Fatalf("unexpected parse errors: %v", errs)
+	}
+
+	module := ctx.modulesFromName("b")[0].logicModule.(*fooModule)
+	if g, w := module.Foo(), "1.0-1.0"; g != w {
+		t.Errorf("expected foo %q, got %q", w, g)
+	}
+
+	for _, dep := range []string{"Blueprints", "a/Blueprints"} {
+		found := false
+		for _, d := range deps {
+			if d == dep {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected deps %v to contain %q", deps, dep)
+		}
+	}
+
+	errs = ctx.ResolveDependencies(nil)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected dependency errors: %v", errs)
+	}
+
+	var unused []string
+	for _, v := range ctx.FindUnusedDefinitions(nil).Variables {
+		unused = append(unused, v.Name)
+	}
+	if w := []string{"unused"}; !reflect.DeepEqual(unused, w) {
+		t.Errorf("expected unused variables %v, got %v", w, unused)
+	}
+}
+
+func TestImportVarsErrors(t *testing.T) {
+	testCases := []struct {
+		name  string
+		files map[string]string
+		err   string
+	}{
+		{
+			name: "cycle",
+			files: map[string]string{
+				"Blueprints": `
+					subdirs = ["a"]
+				`,
+				"a/Blueprints": `
+					import_vars = ["other.bp"]
+				`,
+				"a/other.bp": `
+					import_vars = ["Blueprints"]
+				`,
+			},
+			err: "a/other.bp:2:18: import_vars cycle: a/Blueprints -> a/other.bp -> a/Blueprints",
+		},
+		{
+			name: "subdirectory",
+			files: map[string]string{
+				"Blueprints": `
+					import_vars = ["a/Blueprints"]
+				`,
+				"a/Blueprints": `
+					x = "x"
+				`,
+			},
+			err: `Blueprints:2:18: import_vars: "a/Blueprints" is not a Blueprints file in the same or a parent directory`,
+		},
+		{
+			name: "not literal",
+			files: map[string]string{
+				"Blueprints": `
+					subdirs = ["a"]
+					parent = ["../Blueprints"]
+				`,
+				"a/Blueprints": `
+					import_vars = parent
+				`,
+			},
+			err: "a/Blueprints:2:18: import_vars must be assigned a list of string literals",
+		},
+		{
+			name: "redefined",
+			files: map[string]string{
+				"Blueprints": `
+					subdirs = ["a", "a/b"]
+				`,
+				"a/Blueprints": `
+					x = "a"
+				`,
+				"a/b/Blueprints": `
+					import_vars = ["../Blueprints"]
+					x = "b"
+				`,
+			},
+			err: "variable already set in inherited scope, previous assignment: x@a/Blueprints:2:",
+		},
+		{
+			name: "missing",
+			files: map[string]string{
+				"Blueprints": `
+					import_vars = ["shared.bp"]
+				`,
+			},
+			err: "Blueprints:2:18: import_vars: ",
+		},
+	}
+
+	for _, testCase := range testCases {
+		_, _, errs := parseImportVarsTest(t, testCase.files)
+		found := false
+		for _, err := range errs {
+			if strings.Contains(err.Error(), testCase.err) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s: expected error containing %q, got %v", testCase.name, testCase.err, errs)
+		}
+	}
+}
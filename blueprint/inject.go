@@ -0,0 +1,179 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"fmt"
+)
+
+// A DependencyInjector adds dependencies between existing modules after all
+// mutators have run, for example to make every module depend on a module that
+// provides a license notice, without modifying each module type.  Dependency
+// injectors are run in registration order, and the dependencies they add are
+// checked for cycles before any module's GenerateBuildActions is called.
+type DependencyInjector func(ctx DependencyInjectorContext)
+
+type DependencyInjectorContext interface {
+	Config() interface{}
+
+	ModuleName(module Module) string
+	ModuleType(module Module) string
+	ModuleErrorf(module Module, format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+
+	// VisitAllModules calls visit for every variant of every module.
+	VisitAllModules(visit func(Module))
+
+	// AddDependency adds a dependency with the given tag from one module
+	// variant on another.  Adding a dependency that already exists with the
+	// same tag has no effect.
+	AddDependency(from Module, tag DependencyTag, to Module)
+}
+
+type dependencyInjectorInfo struct {
+	name     string
+	injector DependencyInjector
+}
+
+// A depEdge is a direct dependency from one module variant on another.
+type depEdge struct {
+	from, to *moduleInfo
+}
+
+// RegisterDependencyInjector registers a DependencyInjector that will be
+// called at the end of ResolveDependencies.  The name is used in errors that
+// involve the dependencies added by the injector, such as dependency cycles.
+func (c *Context) RegisterDependencyInjector(name string, injector DependencyInjector) {
+	for _, i := range c.dependencyInjectors {
+		if i.name == name {
+			panic(fmt.Errorf("dependency injector name %s is already registered", name))
+		}
+	}
+
+	c.dependencyInjectors = append(c.dependencyInjectors, &dependencyInjectorInfo{
+		name:     name,
+		injector: injector,
+	})
+}
+
+type dependencyInjectorContext struct {
+	context *Context
+	config  interface{}
+	info    *dependencyInjectorInfo
+	errs    []error
+}
+
+func (d *dependencyInjectorContext) Config() interface{} {
+	return d.config
+}
+
+func (d *dependencyInjectorContext) ModuleName(logicModule Module) string {
+	return d.context.ModuleName(logicModule)
+}
+
+func (d *dependencyInjectorContext) ModuleType(logicModule Module) string {
+	return d.context.ModuleType(logicModule)
+}
+
+func (d *dependencyInjectorContext) ModuleErrorf(logicModule Module, format string,
+	args ...interface{}) {
+
+	d.errs = append(d.errs, d.context.ModuleErrorf(logicModule, format, args...))
+}
+
+func (d *dependencyInjectorContext) Errorf(format string, args ...interface{}) {
+	d.errs = append(d.errs, fmt.Errorf("dependency injector %s: %s", d.info.name,
+		fmt.Sprintf(format, args...)))
+}
+
+func (d *dependencyInjectorContext) VisitAllModules(visit func(Module)) {
+	d.context.visitAllModules(visit)
+}
+
+func (d *dependencyInjectorContext) AddDependency(from Module, tag DependencyTag, to Module) {
+	if _, ok := tag.(BaseDependencyTag); ok {
+		panic("BaseDependencyTag is not allowed to be used directly!")
+	}
+
+	fromInfo := d.context.moduleInfo[from]
+	toInfo := d.context.moduleInfo[to]
+	if fromInfo == nil || toInfo == nil {
+		panic(fmt.Errorf("AddDependency called with a module that is not in the context"))
+	}
+
+	if fromInfo == toInfo {
+		d.ModuleErrorf(from, "dependency injector %s added a dependency on itself", d.info.name)
+		return
+	}
+
+	for _, dep := range fromInfo.directDeps {
+		if dep.module == toInfo && dep.tag == tag {
+			return
+		}
+	}
+
+	fromInfo.directDeps = append(fromInfo.directDeps, depInfo{toInfo, tag})
+	d.context.traceDependencies(fromInfo, len(fromInfo.directDeps)-1, "AddDependency", d.info.name)
+
+	if d.context.injectedDeps == nil {
+		d.context.injectedDeps = make(map[depEdge]string)
+	}
+	edge := depEdge{fromInfo, toInfo}
+	if _, exists := d.context.injectedDeps[edge]; !exists {
+		d.context.injectedDeps[edge] = d.info.name
+	}
+}
+
+// runDependencyInjectors calls each registered DependencyInjector, and then
+// updates the dependency graph to check for cycles.
+func (c *Context) runDependencyInjectors(config interface{}) (errs []error) {
+	if len(c.dependencyInjectors) == 0 {
+		return nil
+	}
+
+	for _, info := range c.dependencyInjectors {
+		dctx := &dependencyInjectorContext{
+			context: c,
+			config:  config,
+			info:    info,
+		}
+
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					dctx.errs = append(dctx.errs, newPanicErrorf(r,
+						"dependency injector %s", info.name))
+				}
+			}()
+			info.injector(dctx)
+		}()
+
+		if len(dctx.errs) > 0 {
+			return dctx.errs
+		}
+	}
+
+	return c.updateDependencies()
+}
+
+// injectedDepSuffix returns a note naming the dependency injector that added
+// the dependency from one module on another, or an empty string if it wasn't
+// added by a dependency injector.
+func (c *Context) injectedDepSuffix(from, to *moduleInfo) string {
+	if name, ok := c.injectedDeps[depEdge{from, to}]; ok {
+		return fmt.Sprintf(" (added by dependency injector %s)", name)
+	}
+	return ""
+}
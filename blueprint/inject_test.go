@@ -0,0 +1,125 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"strings"
+	"testing"
+)
+
+type injectedDependencyTag struct {
+	BaseDependencyTag
+}
+
+var injectedDepTag = injectedDependencyTag{}
+
+// injectLicenseDeps makes every foo_module depend on the bar_module named
+// "license".
+func injectLicenseDeps(ctx DependencyInjectorContext) {
+	var license Module
+	ctx.VisitAllModules(func(m Module) {
+		if ctx.ModuleName(m) == "license" {
+			license = m
+		}
+	})
+	if license == nil {
+		ctx.Errorf("missing license module")
+		return
+	}
+
+	ctx.VisitAllModules(func(m Module) {
+		if ctx.ModuleType(m) == "foo_module" {
+			ctx.AddDependency(m, injectedDepTag, license)
+		}
+	})
+}
+
+func setupInjectTest(t *testing.T, bp string) (*Context, []error) {
+	ctx := NewContext()
+	ctx.RegisterModuleType("foo_module", newFooModule)
+	ctx.RegisterModuleType("bar_module", newBarModule)
+	ctx.RegisterDependencyInjector("license", injectLicenseDeps)
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(bp),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) > 0 {
+		t.Fatalf("unexpected parse errors: %q", errs)
+	}
+
+	return ctx, ctx.ResolveDependencies(nil)
+}
+
+func TestDependencyInjector(t *testing.T) {
+	ctx, errs := setupInjectTest(t, `
+		foo_module {
+		    name: "A",
+		}
+
+		foo_module {
+		    name: "B",
+		    deps: ["A"],
+		}
+
+		bar_module {
+		    name: "license",
+		}
+	`)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+
+	for _, name := range []string{"A", "B"} {
+		module := ctx.modulesFromName(name)[0]
+		found := false
+		for _, dep := range module.directDeps {
+			if dep.module.Name() == "license" && dep.tag == injectedDepTag {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected %s to depend on license", name)
+		}
+	}
+
+	license := ctx.modulesFromName("license")[0]
+	if len(license.reverseDeps) != 2 {
+		t.Errorf("expected 2 reverse dependencies of license, got %d", len(license.reverseDeps))
+	}
+}
+
+func TestDependencyInjectorCycle(t *testing.T) {
+	_, errs := setupInjectTest(t, `
+		foo_module {
+		    name: "A",
+		}
+
+		bar_module {
+		    name: "license",
+		    deps: ["A"],
+		}
+	`)
+
+	found := false
+	for _, err := range errs {
+		if strings.Contains(err.Error(), `depends on "license" (added by dependency injector license)`) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected dependency cycle through injected dependency, got %q", errs)
+	}
+}
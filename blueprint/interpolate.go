@@ -0,0 +1,177 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/google/blueprint/parser"
+	"github.com/google/blueprint/proptools"
+)
+
+// SetPropertyVariables enables interpolation of variables in the string and
+// string list properties of all modules.  A reference of the form $(name) in
+// a property value in a Blueprints file is replaced with the value of name in
+// vars, and "$$" is replaced with a single "$".  A reference to a name that is
+// not in vars is reported as an error at the position of the value.  Property
+// struct fields tagged with `blueprint:"no_interpolation"`, for example
+// commands that are expanded by the module type itself, are left unmodified.
+//
+// Only the values set in Blueprints files are interpolated, not the default
+// values set by module factories.  SetPropertyVariables must be called before
+// ParseBlueprintsFiles.
+func (c *Context) SetPropertyVariables(vars map[string]string) {
+	c.propertyVariables = make(map[string]string, len(vars))
+	for k, v := range vars {
+		c.propertyVariables[k] = v
+	}
+}
+
+// interpolateProperties interpolates the variables in the values of the fields
+// of propertyStructs that were set from the properties in propertyMap.
+func interpolateProperties(propertyStructs []interface{},
+	propertyMap map[string]*parser.Property, vars map[string]string) []error {
+
+	var errs []error
+	for _, props := range propertyStructs {
+		errs = append(errs, interpolateStructValue("", reflect.ValueOf(props).Elem(),
+			propertyMap, vars)...)
+	}
+	return errs
+}
+
+func interpolateStructValue(namePrefix string, structValue reflect.Value,
+	propertyMap map[string]*parser.Property, vars map[string]string) []error {
+
+	structType := structValue.Type()
+
+	var errs []error
+	for i := 0; i < structValue.NumField(); i++ {
+		field := structType.Field(i)
+		fieldValue := structValue.Field(i)
+
+		if !proptools.IsPropertyField(field) {
+			// This is an unexported field, so just skip it.
+			continue
+		}
+
+		if proptools.HasTag(field, "blueprint", "no_interpolation") ||
+			proptools.HasTag(field, "blueprint", "mutated") {
+			continue
+		}
+
+		propertyName := namePrefix + proptools.PropertyNameForField(field.Name)
+		embedded := field.Anonymous || field.Name == "BlueprintEmbed"
+
+		if fieldValue.Kind() == reflect.Interface {
+			if fieldValue.IsNil() {
+				continue
+			}
+			fieldValue = fieldValue.Elem()
+		}
+		if fieldValue.Kind() == reflect.Ptr {
+			if fieldValue.IsNil() {
+				continue
+			}
+			fieldValue = fieldValue.Elem()
+		}
+
+		if fieldValue.Kind() == reflect.Struct {
+			prefix := propertyName + "."
+			if embedded {
+				prefix = namePrefix
+			}
+			errs = append(errs, interpolateStructValue(prefix, fieldValue, propertyMap, vars)...)
+			continue
+		}
+
+		property := propertyMap[propertyName]
+		if property == nil {
+			continue
+		}
+
+		switch fieldValue.Kind() {
+		case reflect.String:
+			s, err := interpolate(fieldValue.String(), vars)
+			if err != nil {
+				errs = append(errs, &BlueprintError{Err: err, Pos: property.Value.Pos()})
+				continue
+			}
+			fieldValue.SetString(s)
+		case reflect.Slice:
+			if fieldValue.Type().Elem().Kind() != reflect.String {
+				continue
+			}
+			// Index the elements instead of asserting []string to support
+			// slices of named string types.
+			list, _ := property.Value.Eval().(*parser.List)
+			for j := 0; j < fieldValue.Len(); j++ {
+				s, err := interpolate(fieldValue.Index(j).String(), vars)
+				if err != nil {
+					pos := property.Value.Pos()
+					if list != nil && j < len(list.Values) {
+						pos = list.Values[j].Pos()
+					}
+					errs = append(errs, &BlueprintError{Err: err, Pos: pos})
+					continue
+				}
+				fieldValue.Index(j).SetString(s)
+			}
+		}
+	}
+
+	return errs
+}
+
+// interpolate replaces $(name) references in s with their values in vars, and
+// "$$" with "$".
+func interpolate(s string, vars map[string]string) (string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+
+	buf := &bytes.Buffer{}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' {
+			buf.WriteByte(s[i])
+			continue
+		}
+
+		switch {
+		case i+1 < len(s) && s[i+1] == '$':
+			buf.WriteByte('$')
+			i++
+		case i+1 < len(s) && s[i+1] == '(':
+			end := strings.IndexByte(s[i:], ')')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated variable reference in %q", s)
+			}
+			name := s[i+2 : i+end]
+			value, ok := vars[name]
+			if !ok {
+				return "", fmt.Errorf("unknown variable %q in %q", name, s)
+			}
+			buf.WriteString(value)
+			i += end
+		default:
+			return "", fmt.Errorf("invalid '$' in %q, use \"$$\" for a literal '$'", s)
+		}
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"reflect"
+	"testing"
+)
+
+type interpolateList []string
+
+type interpolateModule struct {
+	SimpleName
+	properties struct {
+		Dir    string
+		Opt    *string
+		Srcs   []string
+		Names  interpolateList
+		Cmd    string `blueprint:"no_interpolation"`
+		Nested struct {
+			Path string
+		}
+	}
+}
+
+func newInterpolateModule() (Module, []interface{}) {
+	m := &interpolateModule{}
+	m.properties.Dir = "$(default)"
+	return m, []interface{}{&m.properties, &m.SimpleName.Properties}
+}
+
+func (m *interpolateModule) GenerateBuildActions(ctx ModuleContext) {}
+
+func setupInterpolateTest(t *testing.T, bp string) (*Context, []error) {
+	ctx := NewContext()
+	ctx.RegisterModuleType("interpolate_module", newInterpolateModule)
+	ctx.SetPropertyVariables(map[string]string{
+		"product": "generic",
+		"arch":    "arm64",
+	})
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(bp),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	return ctx, errs
+}
+
+func TestPropertyInterpolation(t *testing.T) {
+	ctx, errs := setupInterpolateTest(t, `
+		interpolate_module {
+		    name: "A",
+		    opt: "device/$(product)",
+		    srcs: ["$(arch)/a.c", "cost_$$5.c"],
+		    names: ["$(product)"],
+		    cmd: "$(location) $(in)",
+		    nested: {
+		        path: "out/$(product)/$(arch)",
+		    },
+		}
+
+		interpolate_module {
+		    name: "B",
+		}
+	`)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+
+	a := ctx.modulesFromName("A")[0].logicModule.(*interpolateModule)
+	if *a.properties.Opt != "device/generic" {
+		t.Errorf("incorrect opt: %q", *a.properties.Opt)
+	}
+	if !reflect.DeepEqual(a.properties.Srcs, []string{"arm64/a.c", "cost_$5.c"}) {
+		t.Errorf("incorrect srcs: %q", a.properties.Srcs)
+	}
+	if !reflect.DeepEqual(a.properties.Names, interpolateList{"generic"}) {
+		t.Errorf("incorrect names: %q", a.properties.Names)
+	}
+	if a.properties.Cmd != "$(location) $(in)" {
+		t.Errorf("incorrect cmd: %q", a.properties.Cmd)
+	}
+	if a.properties.Nested.Path != "out/generic/arm64" {
+		t.Errorf("incorrect nested.path: %q", a.properties.Nested.Path)
+	}
+
+	// Default values set by the factory are not interpolated.
+	b := ctx.modulesFromName("B")[0].logicModule.(*interpolateModule)
+	if b.properties.Dir != "$(default)" {
+		t.Errorf("incorrect dir: %q", b.properties.Dir)
+	}
+}
+
+func TestPropertyInterpolationErrors(t *testing.T) {
+	_, errs := setupInterpolateTest(t, `
+		interpolate_module {
+		    name: "A",
+		    dir: "$(unknown)",
+		    srcs: ["a.c", "$b.c", "$(arch"],
+		}
+	`)
+
+	expected := []string{
+		`Blueprints:4:12: unknown variable "unknown" in "$(unknown)"`,
+		`Blueprints:5:21: invalid '$' in "$b.c", use "$$" for a literal '$'`,
+		`Blueprints:5:29: unterminated variable reference in "$(arch"`,
+	}
+
+	var got []string
+	for _, err := range errs {
+		got = append(got, err.Error())
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("incorrect errors:")
+		t.Errorf("  expected: %q", expected)
+		t.Errorf("       got: %q", got)
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	vars := map[string]string{"a": "x", "b": ""}
+	testCases := []struct {
+		in, out string
+	}{
+		{"", ""},
+		{"plain", "plain"},
+		{"$(a)", "x"},
+		{"$(a)$(b)$(a)", "xx"},
+		{"$$(a)", "$(a)"},
+		{"$$$(a)", "$x"},
+	}
+
+	for _, testCase := range testCases {
+		out, err := interpolate(testCase.in, vars)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", testCase.in, err)
+		} else if out != testCase.out {
+			t.Errorf("interpolate(%q) = %q, expected %q", testCase.in, out, testCase.out)
+		}
+	}
+}
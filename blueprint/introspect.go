@@ -0,0 +1,119 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"sort"
+	"strings"
+)
+
+// A ModuleTypeInfo describes a registered module type.
+type ModuleTypeInfo struct {
+	// Name is the name of the module type in Blueprints files.
+	Name string
+
+	// FactoryPackage is the path of the Go package that defines the
+	// factory function of the module type.
+	FactoryPackage string
+
+	// Properties are the properties that can be set on modules of the type,
+	// sorted by name.
+	Properties []PropertySchema
+}
+
+// A PropertySchema describes a property that can be set in Blueprints files.
+type PropertySchema struct {
+	// Name is the name of the property, with the names of nested properties
+	// separated by ".".
+	Name string
+
+	// Type is the type of the property value in the Blueprints language:
+	// "bool", "string", "list" or "map".
+	Type string
+}
+
+// A SingletonTypeInfo describes a registered singleton type.
+type SingletonTypeInfo struct {
+	// Name is the name the singleton type was registered with.
+	Name string
+
+	// FactoryPackage is the path of the Go package that defines the
+	// factory function of the singleton type.
+	FactoryPackage string
+}
+
+// ModuleTypes returns the module types registered with RegisterModuleType,
+// sorted by name.  The factory of every module type is called to find its
+// properties.
+func (c *Context) ModuleTypes() []ModuleTypeInfo {
+	ret := make([]ModuleTypeInfo, 0, len(c.moduleFactories))
+	for name, factory := range c.moduleFactories {
+		_, properties := factory()
+
+		types := propertyTypes(properties)
+		schema := make([]PropertySchema, 0, len(types))
+		for propertyName, propertyType := range types {
+			schema = append(schema, PropertySchema{
+				Name: propertyName,
+				Type: propertyType,
+			})
+		}
+		sort.Sort(propertySchemaSorter(schema))
+
+		ret = append(ret, ModuleTypeInfo{
+			Name:           name,
+			FactoryPackage: funcPackagePath(funcName(factory)),
+			Properties:     schema,
+		})
+	}
+	sort.Sort(moduleTypeInfoSorter(ret))
+	return ret
+}
+
+// Singletons returns the singleton types registered with
+// RegisterSingletonType, in registration order.
+func (c *Context) Singletons() []SingletonTypeInfo {
+	ret := make([]SingletonTypeInfo, 0, len(c.singletonInfo))
+	for _, info := range c.singletonInfo {
+		ret = append(ret, SingletonTypeInfo{
+			Name:           info.name,
+			FactoryPackage: funcPackagePath(funcName(info.factory)),
+		})
+	}
+	return ret
+}
+
+// funcPackagePath returns the package path of the function with the given
+// full name, which may be a method like "pkg/path.(*type).method" or a closure
+// like "pkg/path.func.func1".
+func funcPackagePath(name string) string {
+	slash := strings.LastIndex(name, "/")
+	if dot := strings.Index(name[slash+1:], "."); dot >= 0 {
+		return name[:slash+1+dot]
+	}
+	return name
+}
+
+type moduleTypeInfoSorter []ModuleTypeInfo
+
+func (s moduleTypeInfoSorter) Len() int           { return len(s) }
+func (s moduleTypeInfoSorter) Less(i, j int) bool { return s[i].Name < s[j].Name }
+func (s moduleTypeInfoSorter) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+type propertySchemaSorter []PropertySchema
+
+func (s propertySchemaSorter) Len() int           { return len(s) }
+func (s propertySchemaSorter) Less(i, j int) bool { return s[i].Name < s[j].Name }
+func (s propertySchemaSorter) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,78 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"reflect"
+	"testing"
+)
+
+type introspectTestSingleton struct{}
+
+func (introspectTestSingleton) GenerateBuildActions(SingletonContext) {}
+
+func TestModuleTypesAndSingletons(t *testing.T) {
+	ctx := NewContext()
+	ctx.RegisterModuleType("override_module", newOverrideTestModule)
+	ctx.RegisterModuleType("outputs_module", newOutputsModule)
+	ctx.RegisterSingletonType("z_singleton", func() Singleton { return introspectTestSingleton{} })
+	ctx.RegisterSingletonType("a_singleton", func() Singleton { return introspectTestSingleton{} })
+
+	moduleTypes := ctx.ModuleTypes()
+	if len(moduleTypes) != 2 {
+		t.Fatalf("expected 2 module types, got %v", moduleTypes)
+	}
+
+	expected := ModuleTypeInfo{
+		Name:           "override_module",
+		FactoryPackage: "github.com/google/blueprint",
+		Properties: []PropertySchema{
+			{"enabled", "bool"},
+			{"name", "string"},
+			{"nested", "map"},
+			{"nested.flag", "string"},
+			{"nested.other", "string"},
+			{"srcs", "list"},
+		},
+	}
+	if moduleTypes[0].Name != "outputs_module" || !reflect.DeepEqual(moduleTypes[1], expected) {
+		t.Errorf("expected module types [outputs_module %v], got %v", expected, moduleTypes)
+	}
+
+	expectedSingletons := []SingletonTypeInfo{
+		{"z_singleton", "github.com/google/blueprint"},
+		{"a_singleton", "github.com/google/blueprint"},
+	}
+	if singletons := ctx.Singletons(); !reflect.DeepEqual(singletons, expectedSingletons) {
+		t.Errorf("expected singletons %v, got %v", expectedSingletons, singletons)
+	}
+}
+
+func TestFuncPackagePath(t *testing.T) {
+	testCases := []struct {
+		in, out string
+	}{
+		{"github.com/google/blueprint.newModule", "github.com/google/blueprint"},
+		{"github.com/google/blueprint/bootstrap.newFactory.func1", "github.com/google/blueprint/bootstrap"},
+		{"github.com/google/blueprint.(*Context).method", "github.com/google/blueprint"},
+		{"main.newModule", "main"},
+	}
+
+	for _, testCase := range testCases {
+		if out := funcPackagePath(testCase.in); out != testCase.out {
+			t.Errorf("%q: expected %q, got %q", testCase.in, testCase.out, out)
+		}
+	}
+}
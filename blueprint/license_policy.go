@@ -0,0 +1,182 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/google/blueprint/pathtools"
+)
+
+// A LicenseKindsProvider is a module that declares the kinds of the licenses
+// that apply to it, like "notice", "reciprocal" or "restricted", so that the
+// dependencies between modules can be checked against a LicensePolicy.
+type LicenseKindsProvider interface {
+	LicenseKinds() []string
+}
+
+// A LicensePolicy describes the license kinds that modules may not depend on,
+// based on their own license kinds.
+type LicensePolicy struct {
+	Rules []LicenseRule
+
+	// Report is the path of a JSON file that the violations are written to,
+	// as a LicenseReport, by Context.WriteSingletonFiles if it is not
+	// empty.  It is written even if there are no violations, and when
+	// PrepareBuildActions failed, as the violations are errors.
+	Report string
+}
+
+// A LicenseRule forbids the modules whose license kinds are all in Kinds from
+// directly depending on a module with one of the license kinds in Deny.  For
+// example, a rule with Kinds ["notice"] and Deny ["restricted"] forbids
+// notice-only modules from depending on restricted modules.  Modules that
+// don't implement LicenseKindsProvider, or that return no kinds, are not
+// checked, and can be depended on by any module.
+type LicenseRule struct {
+	Kinds []string
+	Deny  []string
+
+	// Reason is added to the errors for the dependencies that break the rule.
+	Reason string
+}
+
+// A LicenseReport is the content of the file written to LicensePolicy.Report.
+type LicenseReport struct {
+	Violations []LicenseViolation `json:"violations"`
+}
+
+// A LicenseViolation is a dependency that breaks a LicenseRule.
+type LicenseViolation struct {
+	// Module and Variant are the name and variant of the depending module,
+	// and Kinds its license kinds.
+	Module  string   `json:"module"`
+	Variant string   `json:"variant,omitempty"`
+	Kinds   []string `json:"kinds"`
+
+	// Dep and DepVariant are the name and variant of the dependency, and
+	// DepKinds its license kinds.
+	Dep        string   `json:"dep"`
+	DepVariant string   `json:"depVariant,omitempty"`
+	DepKinds   []string `json:"depKinds"`
+
+	Reason string `json:"reason,omitempty"`
+}
+
+// NewLicensePolicySingleton returns a SingletonFactory for a singleton that
+// reports an error for every direct dependency that breaks a rule of the
+// policy, and writes them to the report file of the policy.
+func NewLicensePolicySingleton(policy LicensePolicy) SingletonFactory {
+	return func() Singleton {
+		return &licensePolicySingleton{policy: policy}
+	}
+}
+
+type licensePolicySingleton struct {
+	policy LicensePolicy
+
+	// report is the report of the last GenerateBuildActions call.
+	report LicenseReport
+}
+
+func (s *licensePolicySingleton) GenerateBuildActions(ctx SingletonContext) {
+	report := LicenseReport{
+		Violations: []LicenseViolation{},
+	}
+	defer func() { s.report = report }()
+
+	ctx.VisitAllModules(func(module Module) {
+		kinds := licenseKinds(module)
+		if len(kinds) == 0 {
+			return
+		}
+
+		ctx.VisitDirectDeps(module, func(dep Module) {
+			depKinds := licenseKinds(dep)
+			for _, rule := range s.policy.Rules {
+				denied := rule.denies(kinds, depKinds)
+				if denied == "" {
+					continue
+				}
+
+				msg := "depends on %q with license kind %q, which is not allowed for modules with license kinds %q"
+				if rule.Reason != "" {
+					ctx.ModuleErrorf(module, msg+": %s", ctx.ModuleName(dep), denied, kinds, rule.Reason)
+				} else {
+					ctx.ModuleErrorf(module, msg, ctx.ModuleName(dep), denied, kinds)
+				}
+
+				report.Violations = append(report.Violations, LicenseViolation{
+					Module:     ctx.ModuleName(module),
+					Variant:    ctx.ModuleSubDir(module),
+					Kinds:      kinds,
+					Dep:        ctx.ModuleName(dep),
+					DepVariant: ctx.ModuleSubDir(dep),
+					DepKinds:   depKinds,
+					Reason:     rule.Reason,
+				})
+				break
+			}
+		})
+	})
+
+}
+
+// WriteFiles writes the report of the policy, if it has one.  It is also
+// written if PrepareBuildActions failed, to list the violations.
+func (s *licensePolicySingleton) WriteFiles(failed bool) error {
+	if s.policy.Report == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s.report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return pathtools.WriteFileIfChanged(s.policy.Report, append(data, '\n'), 0666)
+}
+
+// licenseKinds returns the sorted license kinds of a module, or nil if it
+// doesn't declare any.
+func licenseKinds(module Module) []string {
+	provider, ok := module.(LicenseKindsProvider)
+	if !ok {
+		return nil
+	}
+	kinds := provider.LicenseKinds()
+	if len(kinds) == 0 {
+		return nil
+	}
+	kinds = append([]string(nil), kinds...)
+	sort.Strings(kinds)
+	return kinds
+}
+
+// denies returns the license kind of a dependency with depKinds that the rule
+// forbids for a module with kinds, or "" if the rule allows the dependency.
+func (r LicenseRule) denies(kinds, depKinds []string) string {
+	for _, kind := range kinds {
+		if !inList(kind, r.Kinds) {
+			return ""
+		}
+	}
+	for _, kind := range depKinds {
+		if inList(kind, r.Deny) {
+			return kind
+		}
+	}
+	return ""
+}
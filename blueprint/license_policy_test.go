@@ -0,0 +1,152 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type licenseTestModule struct {
+	SimpleName
+	properties struct {
+		Deps          []string
+		License_kinds []string
+	}
+}
+
+func newLicenseTestModule() (Module, []interface{}) {
+	m := &licenseTestModule{}
+	return m, []interface{}{&m.properties, &m.SimpleName.Properties}
+}
+
+func (m *licenseTestModule) GenerateBuildActions(ModuleContext) {
+}
+
+func (m *licenseTestModule) DynamicDependencies(ctx DynamicDependerModuleContext) []string {
+	return m.properties.Deps
+}
+
+func (m *licenseTestModule) LicenseKinds() []string {
+	return m.properties.License_kinds
+}
+
+func TestLicensePolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "license_policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	report := filepath.Join(dir, "license_report.json")
+
+	ctx := NewContext()
+	ctx.RegisterModuleType("license_module", newLicenseTestModule)
+	ctx.RegisterSingletonType("license_policy", NewLicensePolicySingleton(LicensePolicy{
+		Rules: []LicenseRule{
+			{
+				Kinds:  []string{"notice"},
+				Deny:   []string{"restricted"},
+				Reason: "notice modules are shipped without sources",
+			},
+			{
+				Kinds: []string{"notice", "reciprocal"},
+				Deny:  []string{"proprietary"},
+			},
+		},
+		Report: report,
+	}))
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			license_module {
+				name: "notice",
+				license_kinds: ["notice"],
+				deps: ["restricted", "unlicensed", "mixed", "proprietary"],
+			}
+
+			license_module {
+				name: "mixed",
+				license_kinds: ["notice", "restricted"],
+				deps: ["restricted", "proprietary"],
+			}
+
+			license_module {
+				name: "restricted",
+				license_kinds: ["restricted"],
+			}
+
+			license_module {
+				name: "proprietary",
+				license_kinds: ["proprietary"],
+			}
+
+			license_module {
+				name: "unlicensed",
+				deps: ["restricted"],
+			}
+		`),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) == 0 {
+		_, errs = ctx.PrepareBuildActions(nil)
+	}
+
+	var errStrings []string
+	for _, err := range errs {
+		errStrings = append(errStrings, err.Error())
+	}
+	expectedErrs := []string{
+		`Blueprints:2:4: depends on "restricted" with license kind "restricted", which is not allowed for modules with license kinds ["notice"]: notice modules are shipped without sources`,
+		`Blueprints:2:4: depends on "mixed" with license kind "restricted", which is not allowed for modules with license kinds ["notice"]: notice modules are shipped without sources`,
+		`Blueprints:2:4: depends on "proprietary" with license kind "proprietary", which is not allowed for modules with license kinds ["notice"]`,
+	}
+	if !reflect.DeepEqual(errStrings, expectedErrs) {
+		t.Errorf("incorrect errors:\nwant: %q\n got: %q", expectedErrs, errStrings)
+	}
+
+	if _, err := os.Stat(report); !os.IsNotExist(err) {
+		t.Fatalf("expected no report before WriteSingletonFiles, got %v", err)
+	}
+	if errs := ctx.WriteSingletonFiles(true); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+
+	data, err := ioutil.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got LicenseReport
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Violations) != 3 {
+		t.Fatalf("expected 3 violations, got %#v", got.Violations)
+	}
+	want := LicenseViolation{
+		Module:   "notice",
+		Kinds:    []string{"notice"},
+		Dep:      "mixed",
+		DepKinds: []string{"notice", "restricted"},
+		Reason:   "notice modules are shipped without sources",
+	}
+	if !reflect.DeepEqual(got.Violations[1], want) {
+		t.Errorf("incorrect violation:\nwant: %#v\n got: %#v", want, got.Violations[1])
+	}
+}
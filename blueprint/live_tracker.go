@@ -48,6 +48,13 @@ func (l *liveTracker) AddBuildDefDeps(def *buildDef) error {
 	}
 	def.RuleDef = ruleDef
 
+	if def.Pool != nil {
+		err = l.addPool(def.Pool)
+		if err != nil {
+			return err
+		}
+	}
+
 	err = l.addNinjaStringListDeps(def.Outputs)
 	if err != nil {
 		return err
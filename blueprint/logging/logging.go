@@ -0,0 +1,223 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logging is the logging facility shared by the bootstrap code, the
+// primary builders and the module implementations.  A Logger writes leveled
+// messages to any number of sinks, each with its own minimum level, and can
+// be narrowed to a scope, like the current build phase or module, that is
+// recorded with every message.
+package logging
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Level is the severity of a logged message.
+type Level int
+
+const (
+	Debug Level = iota
+	Info
+	Warning
+	Error
+)
+
+func (l Level) String() string {
+	switch l {
+	case Debug:
+		return "debug"
+	case Info:
+		return "info"
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	default:
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+}
+
+// ParseLevel returns the Level named by s, as returned by Level.String.
+func ParseLevel(s string) (Level, error) {
+	for l := Debug; l <= Error; l++ {
+		if strings.EqualFold(s, l.String()) {
+			return l, nil
+		}
+	}
+	return Debug, fmt.Errorf("unknown log level %q", s)
+}
+
+// An Entry is a single logged message.
+type Entry struct {
+	Time    time.Time
+	Level   Level
+	Scope   string
+	Message string
+
+	// Progress is set for the messages logged with Progressf.
+	Progress *Progress
+}
+
+// Progress is the progress of a long running task, logged with Progressf.
+type Progress struct {
+	Done  int
+	Total int
+
+	// Finished is set on the last message about the task.
+	Finished bool
+}
+
+// A Sink writes logged messages to an output.  Write is never called
+// concurrently for the same Sink.
+type Sink interface {
+	Write(entry *Entry)
+}
+
+// A Logger writes messages to the sinks that were added to it or to the
+// Logger it was derived from with Scope.  Loggers must be created with New,
+// but the zero Logger and a nil *Logger can be used to discard all messages.
+// A Logger is safe for concurrent use.
+type Logger struct {
+	root  *root
+	scope string
+}
+
+type root struct {
+	lock  sync.Mutex
+	sinks []levelSink
+	now   func() time.Time
+}
+
+type levelSink struct {
+	sink Sink
+	min  Level
+}
+
+// New returns a Logger without sinks.
+func New() *Logger {
+	return &Logger{
+		root: &root{now: time.Now},
+	}
+}
+
+// AddSink adds a sink that receives the messages at level min or above logged
+// through the Logger and all the Loggers sharing its sinks.
+func (l *Logger) AddSink(sink Sink, min Level) {
+	l.root.lock.Lock()
+	defer l.root.lock.Unlock()
+
+	l.root.sinks = append(l.root.sinks, levelSink{sink, min})
+}
+
+// Scope returns a Logger sharing the sinks of l that records messages in the
+// scope name nested in the scope of l, for example "bootstrap/parse".
+func (l *Logger) Scope(name string) *Logger {
+	if l == nil || l.root == nil {
+		return l
+	}
+
+	scope := name
+	if l.scope != "" {
+		scope = l.scope + "/" + name
+	}
+	return &Logger{
+		root:  l.root,
+		scope: scope,
+	}
+}
+
+// ScopeName returns the scope of the messages logged through l.
+func (l *Logger) ScopeName() string {
+	if l == nil {
+		return ""
+	}
+	return l.scope
+}
+
+// Enabled returns true if any sink receives messages at the given level, so
+// that expensive messages can be skipped otherwise.
+func (l *Logger) Enabled(level Level) bool {
+	if l == nil || l.root == nil {
+		return false
+	}
+
+	l.root.lock.Lock()
+	defer l.root.lock.Unlock()
+
+	for _, s := range l.root.sinks {
+		if level >= s.min {
+			return true
+		}
+	}
+	return false
+}
+
+// Logf formats a message like fmt.Sprintf and writes it at the given level.
+func (l *Logger) Logf(level Level, format string, args ...interface{}) {
+	l.logf(level, nil, format, args...)
+}
+
+// Progressf writes an info message about the progress of a long running task.
+// Console sinks draw it as a progress bar on a terminal, which is replaced by
+// the next message, and skip it otherwise.  The other sinks write it like any
+// other message.
+func (l *Logger) Progressf(progress Progress, format string, args ...interface{}) {
+	l.logf(Info, &progress, format, args...)
+}
+
+func (l *Logger) logf(level Level, progress *Progress, format string, args ...interface{}) {
+	if l == nil || l.root == nil {
+		return
+	}
+
+	l.root.lock.Lock()
+	defer l.root.lock.Unlock()
+
+	var entry *Entry
+	for _, s := range l.root.sinks {
+		if level < s.min {
+			continue
+		}
+		if entry == nil {
+			entry = &Entry{
+				Time:    l.root.now(),
+				Level:   level,
+				Scope:   l.scope,
+				Message: fmt.Sprintf(format, args...),
+
+				Progress: progress,
+			}
+		}
+		s.sink.Write(entry)
+	}
+}
+
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.Logf(Debug, format, args...)
+}
+
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.Logf(Info, format, args...)
+}
+
+func (l *Logger) Warningf(format string, args ...interface{}) {
+	l.Logf(Warning, format, args...)
+}
+
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.Logf(Error, format, args...)
+}
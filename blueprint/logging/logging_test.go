@@ -0,0 +1,140 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func newTestLogger() *Logger {
+	l := New()
+	l.root.now = func() time.Time {
+		return time.Date(2017, 1, 2, 3, 4, 5, 6000, time.UTC)
+	}
+	return l
+}
+
+func TestSinks(t *testing.T) {
+	console := &bytes.Buffer{}
+	file := &bytes.Buffer{}
+	json := &bytes.Buffer{}
+
+	l := newTestLogger()
+	l.AddSink(NewConsoleSink(console), Info)
+	l.AddSink(NewFileSink(file), Debug)
+	l.AddSink(NewJSONSink(json), Warning)
+
+	l.Infof("building %d modules", 3)
+	phase := l.Scope("main").Scope("cleanup")
+	phase.Debugf("checking %s", "out")
+	phase.Warningf("removing %s", "out/a")
+	l.Errorf("failed")
+
+	expectedConsole := "building 3 modules\n" +
+		"warning: removing out/a\n" +
+		"error: failed\n"
+	if console.String() != expectedConsole {
+		t.Errorf("incorrect console output:\n%s\nexpected:\n%s", console, expectedConsole)
+	}
+
+	expectedFile := "2017-01-02 03:04:05.000006 info    -: building 3 modules\n" +
+		"2017-01-02 03:04:05.000006 debug   main/cleanup: checking out\n" +
+		"2017-01-02 03:04:05.000006 warning main/cleanup: removing out/a\n" +
+		"2017-01-02 03:04:05.000006 error   -: failed\n"
+	if file.String() != expectedFile {
+		t.Errorf("incorrect file output:\n%s\nexpected:\n%s", file, expectedFile)
+	}
+
+	expectedJSON := `{"time":"2017-01-02T03:04:05.000006Z","level":"warning","scope":"main/cleanup","message":"removing out/a"}` + "\n" +
+		`{"time":"2017-01-02T03:04:05.000006Z","level":"error","message":"failed"}` + "\n"
+	if json.String() != expectedJSON {
+		t.Errorf("incorrect JSON output:\n%s\nexpected:\n%s", json, expectedJSON)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	console := &bytes.Buffer{}
+	terminal := &bytes.Buffer{}
+	json := &bytes.Buffer{}
+
+	l := newTestLogger()
+	l.AddSink(NewConsoleSink(console), Info)
+	l.AddSink(&consoleSink{w: terminal, terminal: true}, Info)
+	l.AddSink(NewJSONSink(json), Info)
+
+	l.Progressf(Progress{Done: 1, Total: 3}, "parse 1/3")
+	l.Infof("found %d modules", 2)
+	l.Progressf(Progress{Done: 3, Total: 3}, "parse 3/3")
+	l.Progressf(Progress{Done: 3, Total: 3, Finished: true}, "parse done")
+	l.Infof("done")
+
+	expectedConsole := "found 2 modules\n" +
+		"done\n"
+	if console.String() != expectedConsole {
+		t.Errorf("incorrect console output:\n%q\nexpected:\n%q", console, expectedConsole)
+	}
+
+	expectedTerminal := "\r[==========                    ] parse 1/3\x1b[K" +
+		"\r\x1b[Kfound 2 modules\n" +
+		"\r[==============================] parse 3/3\x1b[K" +
+		"\r\x1b[K" +
+		"done\n"
+	if terminal.String() != expectedTerminal {
+		t.Errorf("incorrect terminal output:\n%q\nexpected:\n%q", terminal, expectedTerminal)
+	}
+
+	expectedJSON := `{"time":"2017-01-02T03:04:05.000006Z","level":"info","message":"parse 1/3","progress":{"done":1,"total":3}}` + "\n" +
+		`{"time":"2017-01-02T03:04:05.000006Z","level":"info","message":"found 2 modules"}` + "\n" +
+		`{"time":"2017-01-02T03:04:05.000006Z","level":"info","message":"parse 3/3","progress":{"done":3,"total":3}}` + "\n" +
+		`{"time":"2017-01-02T03:04:05.000006Z","level":"info","message":"parse done","progress":{"done":3,"total":3,"finished":true}}` + "\n" +
+		`{"time":"2017-01-02T03:04:05.000006Z","level":"info","message":"done"}` + "\n"
+	if json.String() != expectedJSON {
+		t.Errorf("incorrect JSON output:\n%s\nexpected:\n%s", json, expectedJSON)
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	l := newTestLogger()
+	if l.Enabled(Error) {
+		t.Errorf("expected Error to be disabled without sinks")
+	}
+
+	l.AddSink(NewConsoleSink(&bytes.Buffer{}), Warning)
+	scoped := l.Scope("a")
+	if scoped.Enabled(Info) || !scoped.Enabled(Warning) {
+		t.Errorf("expected only Warning and above to be enabled")
+	}
+
+	var nilLogger *Logger
+	nilLogger.Scope("a").Errorf("discarded")
+	if nilLogger.Enabled(Error) {
+		t.Errorf("expected nil Logger to be disabled")
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, level := range []Level{Debug, Info, Warning, Error} {
+		got, err := ParseLevel(level.String())
+		if err != nil || got != level {
+			t.Errorf("ParseLevel(%q): expected %v, got %v, %v", level.String(), level, got, err)
+		}
+	}
+
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Errorf("expected error for unknown level")
+	}
+}
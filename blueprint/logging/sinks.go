@@ -0,0 +1,194 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	colorReset  = "\x1b[0m"
+	colorRed    = "\x1b[31m"
+	colorYellow = "\x1b[33m"
+	colorFaint  = "\x1b[2m"
+)
+
+// progressBarWidth is the number of characters between the brackets of the
+// progress bars drawn by console sinks.
+const progressBarWidth = 30
+
+type consoleSink struct {
+	w     io.Writer
+	color bool
+
+	// terminal is set if w is a terminal, which progress bars are only
+	// drawn on
+	terminal bool
+
+	// bar is set while the last line written is an unfinished progress bar
+	bar bool
+}
+
+// NewConsoleSink returns a Sink for messages meant to be read by a user.  Info
+// messages are written as is, the other levels are prefixed with the level
+// name, and debug messages also with their scope.  The prefixes are colored
+// and progress messages are drawn as progress bars if w is a terminal.
+func NewConsoleSink(w io.Writer) Sink {
+	terminal := isTerminal(w)
+	return &consoleSink{
+		w:        w,
+		color:    terminal,
+		terminal: terminal,
+	}
+}
+
+func (s *consoleSink) Write(e *Entry) {
+	if e.Progress != nil {
+		s.writeProgress(e)
+		return
+	}
+	if s.bar {
+		fmt.Fprint(s.w, clearLine)
+		s.bar = false
+	}
+
+	var prefix, color string
+	switch e.Level {
+	case Debug:
+		prefix, color = "debug: ", colorFaint
+		if e.Scope != "" {
+			prefix = "debug: " + e.Scope + ": "
+		}
+	case Info:
+	case Warning:
+		prefix, color = "warning: ", colorYellow
+	default:
+		prefix, color = e.Level.String()+": ", colorRed
+	}
+
+	if s.color && prefix != "" {
+		prefix = color + prefix + colorReset
+	}
+	fmt.Fprintf(s.w, "%s%s\n", prefix, e.Message)
+}
+
+// clearLine moves the cursor of a terminal to the start of the line and
+// erases the line.
+const clearLine = "\r\x1b[K"
+
+// writeProgress replaces the line of the terminal with a progress bar, or
+// erases it once the task finished.
+func (s *consoleSink) writeProgress(e *Entry) {
+	if !s.terminal {
+		return
+	}
+	if e.Progress.Finished {
+		if s.bar {
+			fmt.Fprint(s.w, clearLine)
+			s.bar = false
+		}
+		return
+	}
+
+	filled := 0
+	if e.Progress.Total > 0 {
+		filled = progressBarWidth * e.Progress.Done / e.Progress.Total
+	}
+	if filled > progressBarWidth {
+		filled = progressBarWidth
+	}
+	fmt.Fprintf(s.w, "\r[%s%s] %s\x1b[K", strings.Repeat("=", filled),
+		strings.Repeat(" ", progressBarWidth-filled), e.Message)
+	s.bar = true
+}
+
+// isTerminal returns true if w is a character device that is likely to
+// interpret color escape sequences.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	if term := os.Getenv("TERM"); term == "" || term == "dumb" {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+type fileSink struct {
+	w io.Writer
+}
+
+// NewFileSink returns a Sink that writes every message on one line with its
+// time, level and scope, for log files.
+func NewFileSink(w io.Writer) Sink {
+	return &fileSink{w}
+}
+
+func (s *fileSink) Write(e *Entry) {
+	scope := e.Scope
+	if scope == "" {
+		scope = "-"
+	}
+	fmt.Fprintf(s.w, "%s %-7s %s: %s\n", e.Time.Format("2006-01-02 15:04:05.000000"),
+		e.Level, scope, e.Message)
+}
+
+type jsonSink struct {
+	enc *json.Encoder
+}
+
+// NewJSONSink returns a Sink that writes every message as a JSON object on its
+// own line, for tools that process the logs.
+func NewJSONSink(w io.Writer) Sink {
+	return &jsonSink{json.NewEncoder(w)}
+}
+
+type jsonEntry struct {
+	Time     string        `json:"time"`
+	Level    string        `json:"level"`
+	Scope    string        `json:"scope,omitempty"`
+	Message  string        `json:"message"`
+	Progress *jsonProgress `json:"progress,omitempty"`
+}
+
+type jsonProgress struct {
+	Done     int  `json:"done"`
+	Total    int  `json:"total"`
+	Finished bool `json:"finished,omitempty"`
+}
+
+func (s *jsonSink) Write(e *Entry) {
+	entry := jsonEntry{
+		Time:    e.Time.Format(time.RFC3339Nano),
+		Level:   e.Level.String(),
+		Scope:   e.Scope,
+		Message: e.Message,
+	}
+	if e.Progress != nil {
+		entry.Progress = &jsonProgress{
+			Done:     e.Progress.Done,
+			Total:    e.Progress.Total,
+			Finished: e.Progress.Finished,
+		}
+	}
+	s.enc.Encode(entry)
+}
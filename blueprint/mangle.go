@@ -14,6 +14,13 @@
 
 package blueprint
 
+import (
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"strings"
+)
+
 func packageNamespacePrefix(packageName string) string {
 	return "g." + packageName + "."
 }
@@ -25,3 +32,79 @@ func moduleNamespacePrefix(moduleName string) string {
 func singletonNamespacePrefix(singletonName string) string {
 	return "s." + singletonName + "."
 }
+
+// VariantNameMangling controls how the variations of a module are embedded in
+// the names of the Ninja variables, rules and build statements generated for
+// it.  The zero value reproduces the default naming, where variation names
+// are joined with "_" in the order the mutators that created them ran.
+type VariantNameMangling struct {
+	// Separator is placed between the module name and each variation name.
+	// If empty, "_" is used.
+	Separator string
+
+	// SortByMutator orders the variation names by the name of the mutator
+	// that created them instead of by mutator registration order.
+	SortByMutator bool
+
+	// MaxLength limits the length of the mangled variant name.  Longer names
+	// are truncated and a hash of the full name is appended to keep them
+	// unique, so it must leave room for Separator and the hash.  Zero means
+	// no limit.
+	MaxLength int
+}
+
+// variantHashLength is the number of hex digits of the variant name hash
+// appended to shortened variant names.
+const variantHashLength = 8
+
+// validate returns an error if the mangled names could contain characters
+// that are invalid in Ninja names, or if MaxLength is too short for the hash.
+func (m VariantNameMangling) validate() error {
+	if m.Separator != "" {
+		if err := validateNinjaName(m.Separator); err != nil {
+			return fmt.Errorf("invalid variant name separator: %s", err)
+		}
+	}
+
+	if min := len(m.separator()) + variantHashLength; m.MaxLength < 0 ||
+		(m.MaxLength > 0 && m.MaxLength < min) {
+		return fmt.Errorf("invalid variant name max length %d, it must be 0 or at least %d",
+			m.MaxLength, min)
+	}
+
+	return nil
+}
+
+func (m VariantNameMangling) separator() string {
+	if m.Separator == "" {
+		return "_"
+	}
+	return m.Separator
+}
+
+// mangle returns the variant portion of a Ninja name built from the given
+// mutator names and the variation each of them selected.
+func (m VariantNameMangling) mangle(mutatorNames []string, variant variationMap) string {
+	if m.SortByMutator {
+		mutatorNames = append([]string(nil), mutatorNames...)
+		sort.Strings(mutatorNames)
+	}
+
+	var variationNames []string
+	for _, mutatorName := range mutatorNames {
+		if variationName := variant.get(mutatorName); variationName != "" {
+			variationNames = append(variationNames, variationName)
+		}
+	}
+
+	sep := m.separator()
+	name := strings.Join(variationNames, sep)
+
+	if m.MaxLength > 0 && len(name) > m.MaxLength {
+		hash := fmt.Sprintf("%0*x", variantHashLength, crc32.ChecksumIEEE([]byte(name)))
+		keep := m.MaxLength - len(sep) - len(hash)
+		name = name[:keep] + sep + hash
+	}
+
+	return name
+}
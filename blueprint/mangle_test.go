@@ -0,0 +1,179 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+var variantNameManglingTestCases = []struct {
+	mangling VariantNameMangling
+	variant  map[string]string
+	out      string
+}{
+	{
+		mangling: VariantNameMangling{},
+		variant:  map[string]string{"arch": "arm64", "link": "shared"},
+		out:      "arm64_shared",
+	},
+	{
+		mangling: VariantNameMangling{Separator: "-"},
+		variant:  map[string]string{"arch": "arm64", "link": "shared"},
+		out:      "arm64-shared",
+	},
+	{
+		mangling: VariantNameMangling{SortByMutator: true},
+		variant:  map[string]string{"arch": "arm64", "link": "shared", "image": "core"},
+		out:      "arm64_core_shared",
+	},
+	{
+		mangling: VariantNameMangling{},
+		variant:  map[string]string{"arch": "arm64", "link": ""},
+		out:      "arm64",
+	},
+	{
+		mangling: VariantNameMangling{MaxLength: 12},
+		variant:  map[string]string{"arch": "arm64", "link": "shared"},
+		out:      "arm64_shared",
+	},
+	{
+		mangling: VariantNameMangling{MaxLength: 11},
+		variant:  map[string]string{"arch": "arm64", "link": "shared"},
+		out:      "ar_610aaa63",
+	},
+}
+
+func TestVariantNameMangling(t *testing.T) {
+	mutatorNames := []string{"arch", "link", "image"}
+
+	for _, testCase := range variantNameManglingTestCases {
+		out := testCase.mangling.mangle(mutatorNames, newVariationMap(newVariationTable(), testCase.variant))
+		if out != testCase.out {
+			t.Errorf("incorrect mangled name for %+v %v:", testCase.mangling, testCase.variant)
+			t.Errorf("  expected: %q", testCase.out)
+			t.Errorf("       got: %q", out)
+		}
+	}
+}
+
+func TestVariantNameManglingCollision(t *testing.T) {
+	ctx := NewContext()
+	ctx.RegisterModuleType("foo_module", newFooModule)
+	ctx.RegisterBottomUpMutator("variants", func(mctx BottomUpMutatorContext) {
+		if mctx.ModuleName() == "A" {
+			mctx.CreateVariations("b_c")
+		} else {
+			mctx.CreateVariations("c")
+		}
+	})
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			foo_module {
+			    name: "A",
+			}
+
+			foo_module {
+			    name: "A_b",
+			}
+		`),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) == 0 {
+		errs = ctx.ResolveDependencies(nil)
+	}
+	if len(errs) > 0 {
+		t.Errorf("unexpected errors:")
+		for _, err := range errs {
+			t.Errorf("  %s", err)
+		}
+		t.FailNow()
+	}
+
+	_, errs = ctx.moduleNamespacePrefixes()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), `prefix "m.A_b_c."`) {
+		t.Errorf("expected a single collision error, got %q", errs)
+	}
+
+	ctx.SetVariantNameMangling(VariantNameMangling{Separator: "."})
+
+	prefixes, errs := ctx.moduleNamespacePrefixes()
+	if len(errs) > 0 {
+		t.Errorf("unexpected mangling errors:")
+		for _, err := range errs {
+			t.Errorf("  %s", err)
+		}
+	}
+
+	var got []string
+	for _, prefix := range prefixes {
+		got = append(got, prefix)
+	}
+	sort.Strings(got)
+	if strings.Join(got, " ") != "m.A.b_c. m.A_b.c." {
+		t.Errorf("unexpected prefixes %q", got)
+	}
+}
+
+func TestVariantNameManglingValidation(t *testing.T) {
+	testCases := []struct {
+		mangling VariantNameMangling
+		err      string
+	}{
+		{VariantNameMangling{}, ""},
+		{VariantNameMangling{Separator: ".-"}, ""},
+		{VariantNameMangling{MaxLength: 9}, ""},
+		{VariantNameMangling{Separator: "--", MaxLength: 10}, ""},
+		{
+			VariantNameMangling{Separator: "/"},
+			`invalid variant name separator: "/" contains an invalid Ninja name character '/' at byte offset 0`,
+		},
+		{
+			VariantNameMangling{Separator: "$"},
+			`invalid variant name separator: "$" contains an invalid Ninja name character '$' at byte offset 0`,
+		},
+		{
+			VariantNameMangling{Separator: "_ "},
+			`invalid variant name separator: "_ " contains an invalid Ninja name character ' ' at byte offset 1`,
+		},
+		{
+			VariantNameMangling{MaxLength: 8},
+			`invalid variant name max length 8, it must be 0 or at least 9`,
+		},
+		{
+			VariantNameMangling{Separator: "--", MaxLength: 9},
+			`invalid variant name max length 9, it must be 0 or at least 10`,
+		},
+		{
+			VariantNameMangling{MaxLength: -1},
+			`invalid variant name max length -1, it must be 0 or at least 9`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		err := testCase.mangling.validate()
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != testCase.err {
+			t.Errorf("incorrect error for %+v:", testCase.mangling)
+			t.Errorf("  expected: %q", testCase.err)
+			t.Errorf("       got: %q", got)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"fmt"
+	"sync"
+)
+
+// A MemoizedWalk computes a result for module variants from the results of
+// their direct dependencies.  The result of each module variant is computed at
+// most once per Context, however many singletons ask for it, and the results
+// of independent module variants are computed in parallel, so it replaces
+// repeated VisitDepsDepthFirst calls that compute the same thing over the same
+// parts of the graph.  A MemoizedWalk is usually a package-scoped variable
+// shared by all the singletons that need its results.
+type MemoizedWalk struct {
+	// Name identifies the walk in panic messages.
+	Name string
+
+	// Compute returns the result of module from the results of the direct
+	// dependencies of module that were followed, in the order of the
+	// dependencies.  It may be called concurrently for different module
+	// variants, and must not modify the results of the dependencies.
+	Compute func(module Module, deps []WalkedDep) interface{}
+
+	// Follow returns true if the dependency of module on dep is part of the
+	// walk.  All the dependencies are followed if it is nil.
+	Follow func(module, dep Module, tag DependencyTag) bool
+}
+
+// A WalkedDep is a direct dependency followed by a MemoizedWalk, with its
+// result.
+type WalkedDep struct {
+	Module Module
+	Tag    DependencyTag
+	Result interface{}
+}
+
+// memoizedWalkResults are the results of a MemoizedWalk for a Context.
+type memoizedWalkResults struct {
+	lock    sync.Mutex
+	results map[*moduleInfo]interface{}
+}
+
+func (r *memoizedWalkResults) get(module *moduleInfo) (interface{}, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	result, ok := r.results[module]
+	return result, ok
+}
+
+func (r *memoizedWalkResults) set(module *moduleInfo, result interface{}) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.results[module] = result
+}
+
+// WalkDepsMemoized returns the result of walk for each of modules, computing
+// the results of the module variants they transitively depend on that were
+// not computed by a previous call with the same walk.  It can only be called
+// once the dependencies are final, and not concurrently with other calls.
+func (c *Context) WalkDepsMemoized(walk *MemoizedWalk, modules ...Module) []interface{} {
+	if c.memoizedWalks == nil {
+		c.memoizedWalks = make(map[*MemoizedWalk]*memoizedWalkResults)
+	}
+	results := c.memoizedWalks[walk]
+	if results == nil {
+		results = &memoizedWalkResults{results: make(map[*moduleInfo]interface{})}
+		c.memoizedWalks[walk] = results
+	}
+
+	followed := func(module *moduleInfo) []depInfo {
+		var deps []depInfo
+		for _, dep := range module.directDeps {
+			if walk.Follow == nil || walk.Follow(module.logicModule, dep.module.logicModule, dep.tag) {
+				deps = append(deps, dep)
+			}
+		}
+		return deps
+	}
+
+	// Find the module variants whose results are missing.
+	needed := make(map[*moduleInfo][]depInfo)
+	var find func(module *moduleInfo)
+	find = func(module *moduleInfo) {
+		if _, ok := needed[module]; ok {
+			return
+		}
+		if _, ok := results.get(module); ok {
+			return
+		}
+		deps := followed(module)
+		needed[module] = deps
+		for _, dep := range deps {
+			find(dep.module)
+		}
+	}
+	for _, module := range modules {
+		find(c.moduleInfo[module])
+	}
+
+	if len(needed) > 0 {
+		var panicked interface{}
+		var panicLock sync.Mutex
+
+		c.parallelVisit(bottomUpVisitor, func(module *moduleInfo) bool {
+			deps, ok := needed[module]
+			if !ok {
+				return false
+			}
+
+			defer func() {
+				if r := recover(); r != nil {
+					panicLock.Lock()
+					defer panicLock.Unlock()
+					if panicked == nil {
+						panicked = newPanicErrorf(r, "memoized walk %s for %s", walk.Name, module)
+					}
+				}
+			}()
+
+			walkedDeps := make([]WalkedDep, len(deps))
+			for i, dep := range deps {
+				result, ok := results.get(dep.module)
+				if !ok {
+					panic(fmt.Errorf("no result for dependency %s", dep.module))
+				}
+				walkedDeps[i] = WalkedDep{dep.module.logicModule, dep.tag, result}
+			}
+			results.set(module, walk.Compute(module.logicModule, walkedDeps))
+			return false
+		})
+
+		if panicked != nil {
+			panic(panicked)
+		}
+	}
+
+	ret := make([]interface{}, len(modules))
+	for i, module := range modules {
+		ret[i], _ = results.get(c.moduleInfo[module])
+	}
+	return ret
+}
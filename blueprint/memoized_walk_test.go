@@ -0,0 +1,166 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memoizedWalkTest collects the names of the transitive dependencies of
+// fooModules and counts the calls to Compute.
+type memoizedWalkTest struct {
+	lock  sync.Mutex
+	calls map[string]int
+	walk  *MemoizedWalk
+}
+
+func newMemoizedWalkTest(ctx *Context, panicOn string) *memoizedWalkTest {
+	w := &memoizedWalkTest{calls: make(map[string]int)}
+	w.walk = &MemoizedWalk{
+		Name: "names",
+		Compute: func(module Module, deps []WalkedDep) interface{} {
+			name := ctx.ModuleName(module)
+			if name == panicOn {
+				panic("compute failed")
+			}
+
+			w.lock.Lock()
+			w.calls[name]++
+			w.lock.Unlock()
+
+			seen := map[string]bool{name: true}
+			for _, dep := range deps {
+				for _, n := range dep.Result.([]string) {
+					seen[n] = true
+				}
+			}
+			var names []string
+			for n := range seen {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			return names
+		},
+		Follow: func(module, dep Module, tag DependencyTag) bool {
+			_, ok := dep.(*fooModule)
+			return ok
+		},
+	}
+	return w
+}
+
+type memoizedWalkSingleton struct {
+	walk    *MemoizedWalk
+	modules []string
+	results *[]interface{}
+}
+
+func (s *memoizedWalkSingleton) GenerateBuildActions(ctx SingletonContext) {
+	var modules []Module
+	for _, name := range s.modules {
+		ctx.VisitAllModules(func(m Module) {
+			if ctx.ModuleName(m) == name {
+				modules = append(modules, m)
+			}
+		})
+	}
+	*s.results = append(*s.results, ctx.WalkDepsMemoized(s.walk, modules...)...)
+}
+
+func runMemoizedWalkTest(t *testing.T, panicOn string) (*memoizedWalkTest, []interface{}, []error) {
+	ctx := NewContext()
+	ctx.RegisterModuleType("foo_module", newFooModule)
+	ctx.RegisterModuleType("bar_module", newBarModule)
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			foo_module {
+			    name: "A",
+			    deps: ["B", "C"],
+			}
+
+			foo_module {
+			    name: "B",
+			    deps: ["D"],
+			}
+
+			foo_module {
+			    name: "C",
+			    deps: ["D", "E"],
+			}
+
+			foo_module {
+			    name: "D",
+			}
+
+			bar_module {
+			    name: "E",
+			}
+		`),
+	})
+
+	w := newMemoizedWalkTest(ctx, panicOn)
+	var results []interface{}
+	ctx.RegisterSingletonType("walk_c", func() Singleton {
+		return &memoizedWalkSingleton{w.walk, []string{"C"}, &results}
+	})
+	ctx.RegisterSingletonType("walk_a_b", func() Singleton {
+		return &memoizedWalkSingleton{w.walk, []string{"A", "B"}, &results}
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) > 0 {
+		t.Fatalf("unexpected parse errors: %q", errs)
+	}
+	_, errs = ctx.PrepareBuildActions(nil)
+	return w, results, errs
+}
+
+func TestWalkDepsMemoized(t *testing.T) {
+	w, results, errs := runMemoizedWalkTest(t, "")
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+
+	expected := []interface{}{
+		[]string{"C", "D"},
+		[]string{"A", "B", "C", "D"},
+		[]string{"B", "D"},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected results %q, got %q", expected, results)
+	}
+
+	expectedCalls := map[string]int{"A": 1, "B": 1, "C": 1, "D": 1}
+	if !reflect.DeepEqual(w.calls, expectedCalls) {
+		t.Errorf("expected calls %v, got %v", expectedCalls, w.calls)
+	}
+}
+
+func TestWalkDepsMemoizedPanic(t *testing.T) {
+	// The failed results are not memoized, so both singletons fail.
+	_, _, errs := runMemoizedWalkTest(t, "D")
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %q", errs)
+	}
+	for _, err := range errs {
+		if !strings.Contains(err.Error(), `panic in memoized walk names for module "D"`) {
+			t.Errorf("expected a panic error, got %q", err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"sync"
+
+	"github.com/google/blueprint/parser"
+	"github.com/google/blueprint/proptools"
+)
+
+// propertyArenaBlockSize is the number of structs or strings allocated at once
+// for the property structs of cloned modules in memory budget mode.
+const propertyArenaBlockSize = 1024
+
+// MemoryStats counts the allocations made from arenas in memory budget mode.
+type MemoryStats struct {
+	AST        parser.NodeArenaStats
+	Properties proptools.ArenaStats
+}
+
+type memoryBudget struct {
+	propertyArena *proptools.Arena
+
+	lock     sync.Mutex
+	astStats parser.NodeArenaStats
+}
+
+// SetMemoryBudgetMode enables allocating the AST nodes of parsed Blueprints
+// files and the nested structs and slices of cloned property structs from
+// arenas, which reduces the memory overhead of large builds at the cost of
+// keeping a block of memory alive as long as any value in it is referenced.
+// It must be called before ParseBlueprintsFiles.
+func (c *Context) SetMemoryBudgetMode(enabled bool) {
+	if enabled {
+		c.memoryBudget = &memoryBudget{
+			propertyArena: proptools.NewArena(propertyArenaBlockSize),
+		}
+	} else {
+		c.memoryBudget = nil
+	}
+}
+
+// MemoryStats returns the allocation counters of the arenas used in memory
+// budget mode, or zero counters if it is not enabled.
+func (c *Context) MemoryStats() MemoryStats {
+	var stats MemoryStats
+	if m := c.memoryBudget; m != nil {
+		m.lock.Lock()
+		stats.AST = m.astStats
+		m.lock.Unlock()
+		stats.Properties = m.propertyArena.Stats()
+	}
+	return stats
+}
+
+func (m *memoryBudget) addASTStats(stats parser.NodeArenaStats) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.astStats.Add(stats)
+}
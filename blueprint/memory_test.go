@@ -0,0 +1,61 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMemoryBudgetMode(t *testing.T) {
+	ctx := NewContext()
+	ctx.RegisterModuleType("foo_module", newFooModule)
+	ctx.RegisterBottomUpMutator("split", func(ctx BottomUpMutatorContext) {
+		ctx.CreateVariations("a", "b")
+	})
+	ctx.SetMemoryBudgetMode(true)
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			foo_module {
+			    name: "A",
+			    foo: "bar",
+			}
+		`),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) == 0 {
+		errs = ctx.ResolveDependencies(nil)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+
+	var foos []string
+	ctx.VisitAllModules(func(m Module) {
+		foos = append(foos, m.(*fooModule).properties.Foo)
+	})
+	if !reflect.DeepEqual(foos, []string{"bar", "bar"}) {
+		t.Errorf("incorrect properties of variants: %q", foos)
+	}
+
+	stats := ctx.MemoryStats()
+	if stats.AST.Nodes != 4 {
+		t.Errorf("expected 4 AST nodes allocated from the arena, got %d", stats.AST.Nodes)
+	}
+	if stats.AST.Blocks != 2 || stats.AST.Bytes == 0 {
+		t.Errorf("incorrect AST block stats: %+v", stats.AST)
+	}
+}
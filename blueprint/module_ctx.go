@@ -19,7 +19,9 @@ import (
 	"path/filepath"
 	"text/scanner"
 
+	"github.com/google/blueprint/logging"
 	"github.com/google/blueprint/pathtools"
+	"github.com/google/blueprint/proptools"
 )
 
 // A Module handles generating all of the Ninja build actions needed to build a
@@ -54,27 +56,27 @@ import (
 // that other modules can link against.  The library Module might implement the
 // following interface:
 //
-//   type LibraryProducer interface {
-//       LibraryFileName() string
-//   }
+//	type LibraryProducer interface {
+//	    LibraryFileName() string
+//	}
 //
-//   func IsLibraryProducer(module blueprint.Module) {
-//       _, ok := module.(LibraryProducer)
-//       return ok
-//   }
+//	func IsLibraryProducer(module blueprint.Module) {
+//	    _, ok := module.(LibraryProducer)
+//	    return ok
+//	}
 //
 // A binary-producing Module that depends on the library Module could then do:
 //
-//   func (m *myBinaryModule) GenerateBuildActions(ctx blueprint.ModuleContext) {
-//       ...
-//       var libraryFiles []string
-//       ctx.VisitDepsDepthFirstIf(IsLibraryProducer,
-//           func(module blueprint.Module) {
-//               libProducer := module.(LibraryProducer)
-//               libraryFiles = append(libraryFiles, libProducer.LibraryFileName())
-//           })
-//       ...
-//   }
+//	func (m *myBinaryModule) GenerateBuildActions(ctx blueprint.ModuleContext) {
+//	    ...
+//	    var libraryFiles []string
+//	    ctx.VisitDepsDepthFirstIf(IsLibraryProducer,
+//	        func(module blueprint.Module) {
+//	            libProducer := module.(LibraryProducer)
+//	            libraryFiles = append(libraryFiles, libProducer.LibraryFileName())
+//	        })
+//	    ...
+//	}
 //
 // to build the list of library file names that should be included in its link
 // command.
@@ -130,6 +132,12 @@ type BaseModuleContext interface {
 	PropertyErrorf(property, fmt string, args ...interface{})
 	Failed() bool
 
+	// ModuleWarningf and PropertyWarningf report a warning of a category
+	// at the definition of the module or of the property, see Diagnostic.
+	// A warning promoted to an error makes Failed return true.
+	ModuleWarningf(category, fmt string, args ...interface{})
+	PropertyWarningf(property, category, fmt string, args ...interface{})
+
 	// GlobWithDeps returns a list of files that match the specified pattern but do not match any
 	// of the patterns in excludes.  It also adds efficient dependencies to rerun the primary
 	// builder whenever a file matching the pattern as added or removed, without rerunning if a
@@ -138,6 +146,14 @@ type BaseModuleContext interface {
 
 	Fs() pathtools.FileSystem
 
+	// Logger returns the logger set with Context.SetLogger, scoped to the
+	// module's name.
+	Logger() *logging.Logger
+
+	// AddNinjaFileDeps adds files that the module or the mutator read, so that
+	// the Ninja file is regenerated when they change.
+	AddNinjaFileDeps(deps ...string)
+
 	moduleInfo() *moduleInfo
 	error(err error)
 }
@@ -166,7 +182,25 @@ type ModuleContext interface {
 	Rule(pctx PackageContext, name string, params RuleParams, argNames ...string) Rule
 	Build(pctx PackageContext, params BuildParams)
 
-	AddNinjaFileDeps(deps ...string)
+	// BuildSymlink adds a build statement that creates a symlink, see
+	// SymlinkParams.  The target is validated and made relative to the
+	// symlink by PrepareBuildActions.
+	BuildSymlink(params SymlinkParams)
+
+	// HostToolPath returns the path of the tool provided by the named
+	// HostToolProvider module, which must have been added as a dependency with
+	// HostToolDepTag.  Build statements that reference the returned path in
+	// their arguments, or in the command of a rule defined by this module,
+	// automatically get an implicit dependency on it, including through
+	// variables defined with Variable and through the arguments.
+	HostToolPath(name string) string
+
+	// PropertiesHash returns a stable hash of the module type and the values
+	// of the properties of the module variant, see proptools.HashProperties,
+	// which changes whenever the Blueprints file or a mutator changes a
+	// property.  It can be used in the keys of caches of the outputs of the
+	// module.
+	PropertiesHash() string
 
 	PrimaryModule() Module
 	FinalModule() Module
@@ -190,6 +224,10 @@ func (d *baseModuleContext) moduleInfo() *moduleInfo {
 	return d.module
 }
 
+func (d *baseModuleContext) AddNinjaFileDeps(deps ...string) {
+	d.context.AddNinjaFileDeps(deps...)
+}
+
 func (d *baseModuleContext) ModuleName() string {
 	return d.module.Name()
 }
@@ -268,6 +306,10 @@ func (d *baseModuleContext) Fs() pathtools.FileSystem {
 	return d.context.fs
 }
 
+func (d *baseModuleContext) Logger() *logging.Logger {
+	return d.context.logger.Scope(d.module.Name())
+}
+
 var _ ModuleContext = (*moduleContext)(nil)
 
 type moduleContext struct {
@@ -276,6 +318,9 @@ type moduleContext struct {
 	ninjaFileDeps      []string
 	actionDefs         localBuildActions
 	handledMissingDeps bool
+
+	// set by HostToolPath, and used by Build to add implicit dependencies
+	hostTools []string
 }
 
 func (m *baseModuleContext) OtherModuleName(logicModule Module) string {
@@ -468,9 +513,22 @@ func (m *moduleContext) Build(pctx PackageContext, params BuildParams) {
 		panic(err)
 	}
 
+	if deps := m.hostToolDeps(def); len(deps) > 0 {
+		implicits, err := parseNinjaStrings(m.scope, deps)
+		if err != nil {
+			panic(err)
+		}
+		def.Implicits = append(def.Implicits, implicits...)
+	}
+
 	m.actionDefs.buildDefs = append(m.actionDefs.buildDefs, def)
 }
 
+func (m *moduleContext) PropertiesHash() string {
+	return proptools.HashProperties(append([]interface{}{m.module.typeName},
+		m.module.moduleProperties...)...)
+}
+
 func (m *moduleContext) AddNinjaFileDeps(deps ...string) {
 	m.ninjaFileDeps = append(m.ninjaFileDeps, deps...)
 }
@@ -607,8 +665,14 @@ func (mctx *mutatorContext) CreateLocalVariations(variationNames ...string) []Mo
 }
 
 func (mctx *mutatorContext) createVariations(variationNames []string, local bool) []Module {
+	return mctx.createVariationsWithTransition(variationNames, local, nil)
+}
+
+func (mctx *mutatorContext) createVariationsWithTransition(variationNames []string, local bool,
+	transition variationTransition) []Module {
+
 	ret := []Module{}
-	modules, errs := mctx.context.createVariations(mctx.module, mctx.name, variationNames)
+	modules, errs := mctx.context.createVariations(mctx.module, mctx.name, variationNames, transition)
 	if len(errs) > 0 {
 		mctx.errs = append(mctx.errs, errs...)
 	}
@@ -616,7 +680,7 @@ func (mctx *mutatorContext) createVariations(variationNames []string, local bool
 	for i, module := range modules {
 		ret = append(ret, module.logicModule)
 		if !local {
-			module.dependencyVariant[mctx.name] = variationNames[i]
+			module.dependencyVariant.set(mctx.name, variationNames[i])
 		}
 	}
 
@@ -635,7 +699,7 @@ func (mctx *mutatorContext) createVariations(variationNames []string, local bool
 // Set all dangling dependencies on the current module to point to the variation
 // with given name.
 func (mctx *mutatorContext) SetDependencyVariation(variationName string) {
-	mctx.context.convertDepsToVariation(mctx.module, mctx.name, variationName)
+	mctx.context.convertDepsToVariation(mctx.module, mctx.name, variationName, nil)
 }
 
 func (mctx *mutatorContext) Module() Module {
@@ -646,12 +710,15 @@ func (mctx *mutatorContext) Module() Module {
 // Does not affect the ordering of the current mutator pass, but will be ordered
 // correctly for all future mutator passes.
 func (mctx *mutatorContext) AddDependency(module Module, tag DependencyTag, deps ...string) {
+	info := mctx.context.moduleInfo[module]
+	before := len(info.directDeps)
 	for _, dep := range deps {
-		errs := mctx.context.addDependency(mctx.context.moduleInfo[module], tag, dep)
+		errs := mctx.context.addDependency(info, tag, dep)
 		if len(errs) > 0 {
 			mctx.errs = append(mctx.errs, errs...)
 		}
 	}
+	mctx.context.traceDependencies(info, before, "AddDependency", mctx.name)
 }
 
 // Add a dependency from the destination to the given module.
@@ -670,9 +737,15 @@ func (mctx *mutatorContext) AddReverseDependency(module Module, tag DependencyTa
 		return
 	}
 
+	var stack []string
+	if mctx.context.tracingDependencies(destModule) {
+		stack = dependencyTraceStack(1)
+	}
+
 	mctx.reverseDeps = append(mctx.reverseDeps, reverseDep{
 		destModule,
 		depInfo{mctx.context.moduleInfo[module], tag},
+		stack,
 	})
 }
 
@@ -683,12 +756,14 @@ func (mctx *mutatorContext) AddReverseDependency(module Module, tag DependencyTa
 func (mctx *mutatorContext) AddVariationDependencies(variations []Variation, tag DependencyTag,
 	deps ...string) {
 
+	before := len(mctx.module.directDeps)
 	for _, dep := range deps {
 		errs := mctx.context.addVariationDependency(mctx.module, variations, tag, dep, false)
 		if len(errs) > 0 {
 			mctx.errs = append(mctx.errs, errs...)
 		}
 	}
+	mctx.context.traceDependencies(mctx.module, before, "AddVariationDependencies", mctx.name)
 }
 
 // AddFarVariationDependencies adds deps as dependencies of the current module, but uses the
@@ -701,16 +776,23 @@ func (mctx *mutatorContext) AddVariationDependencies(variations []Variation, tag
 func (mctx *mutatorContext) AddFarVariationDependencies(variations []Variation, tag DependencyTag,
 	deps ...string) {
 
+	before := len(mctx.module.directDeps)
 	for _, dep := range deps {
 		errs := mctx.context.addVariationDependency(mctx.module, variations, tag, dep, true)
 		if len(errs) > 0 {
 			mctx.errs = append(mctx.errs, errs...)
 		}
 	}
+	mctx.context.traceDependencies(mctx.module, before, "AddFarVariationDependencies", mctx.name)
 }
 
 func (mctx *mutatorContext) AddInterVariantDependency(tag DependencyTag, from, to Module) {
 	mctx.context.addInterVariantDependency(mctx.module, tag, from, to)
+	for _, m := range mctx.module.splitModules {
+		if m.logicModule == from {
+			mctx.context.traceDependencies(m, len(m.directDeps)-1, "AddInterVariantDependency", mctx.name)
+		}
+	}
 }
 
 // ReplaceDependencies replaces all dependencies on the identical variant of the module with the
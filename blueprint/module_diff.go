@@ -0,0 +1,148 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/blueprint/parser"
+)
+
+// A ModuleDiff lists the modules that differ between two trees, for example
+// two git revisions read with ReadGitRevision, by name.
+type ModuleDiff struct {
+	// Added are the modules that are only defined in the new tree.
+	Added []string
+
+	// Removed are the modules that are only defined in the old tree.
+	Removed []string
+
+	// Changed are the modules whose type, Blueprints file or property
+	// values differ.  Moving a module within its Blueprints file or
+	// reformatting it doesn't change it.
+	Changed []string
+}
+
+// Empty returns true if no module was added, removed or changed.
+func (d *ModuleDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffModules compares the modules defined in the Blueprints files parsed by
+// the Contexts of the old and new trees, which must have the same module types
+// registered.  It must be called after
+// ParseBlueprintsFiles and before ResolveDependencies, which modifies the
+// properties of the modules and splits them into variants.  The lists in the
+// returned ModuleDiff are sorted.
+func DiffModules(before, after *Context) *ModuleDiff {
+	diff := &ModuleDiff{}
+
+	for _, name := range after.sortedModuleNames() {
+		beforeModules := before.modulesFromName(name)
+		if len(beforeModules) == 0 {
+			diff.Added = append(diff.Added, name)
+		} else if !moduleDefinitionsEqual(beforeModules[0], after.modulesFromName(name)[0]) {
+			diff.Changed = append(diff.Changed, name)
+		}
+	}
+
+	for _, name := range before.sortedModuleNames() {
+		if len(after.modulesFromName(name)) == 0 {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+
+	return diff
+}
+
+func moduleDefinitionsEqual(a, b *moduleInfo) bool {
+	if a.typeName != b.typeName || a.relBlueprintsFile != b.relBlueprintsFile ||
+		!reflect.DeepEqual(a.moduleProperties, b.moduleProperties) ||
+		enabledValue(a.enabledDef) != enabledValue(b.enabledDef) ||
+		len(a.variantOverrides) != len(b.variantOverrides) {
+		return false
+	}
+
+	for i := range a.variantOverrides {
+		if a.variantOverrides[i].name != b.variantOverrides[i].name ||
+			!reflect.DeepEqual(a.variantOverrides[i].properties, b.variantOverrides[i].properties) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// enabledValue returns the value of an enabled property without positions, so
+// that the values of two properties can be compared.
+func enabledValue(enabledDef *parser.Property) string {
+	if enabledDef == nil {
+		return ""
+	}
+	switch value := enabledDef.Value.Eval().(type) {
+	case *parser.Bool:
+		return strconv.FormatBool(value.Value)
+	case *parser.Map:
+		var conditions []string
+		for _, conditionDef := range value.Properties {
+			conditions = append(conditions,
+				conditionDef.Name+":"+enabledValue(conditionDef))
+		}
+		return "{" + strings.Join(conditions, ",") + "}"
+	}
+	return ""
+}
+
+// Affected returns the names of the added and changed modules and of all the
+// modules in the new tree that depend on them directly or indirectly, sorted.
+// This is the set of modules whose build actions a change may affect.  ctx is
+// the Context of the new tree passed to DiffModules as after, and ResolveDependencies
+// must have been called on it.
+func (d *ModuleDiff) Affected(ctx *Context) []string {
+	dependents := make(map[string][]string)
+	for _, module := range ctx.modulesSorted {
+		for _, dep := range module.directDeps {
+			dependents[dep.module.Name()] = append(dependents[dep.module.Name()], module.Name())
+		}
+	}
+
+	affected := make(map[string]bool)
+	var visit func(name string)
+	visit = func(name string) {
+		if affected[name] {
+			return
+		}
+		affected[name] = true
+		for _, dependent := range dependents[name] {
+			visit(dependent)
+		}
+	}
+
+	for _, names := range [][]string{d.Added, d.Changed} {
+		for _, name := range names {
+			visit(name)
+		}
+	}
+
+	ret := make([]string, 0, len(affected))
+	for name := range affected {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
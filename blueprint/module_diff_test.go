@@ -0,0 +1,113 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffModules(t *testing.T) {
+	parse := func(bp string) *Context {
+		ctx := NewContext()
+		ctx.RegisterModuleType("foo_module", newFooModule)
+		ctx.MockFileSystem(map[string][]byte{
+			"Blueprints": []byte(bp),
+		})
+		_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+		if len(errs) > 0 {
+			t.Fatalf("unexpected parse errors: %q", errs)
+		}
+		return ctx
+	}
+
+	before := parse(`
+		foo_module {
+		    name: "A",
+		    foo: "a",
+		}
+
+		foo_module {
+		    name: "B",
+		    deps: ["A"],
+		}
+
+		foo_module {
+		    name: "C",
+		}
+
+		foo_module {
+		    name: "D",
+		    deps: ["C"],
+		}
+
+		foo_module {
+		    name: "E",
+		    deps: ["B"],
+		}
+
+		foo_module {
+		    name: "F",
+		}
+	`)
+
+	after := parse(`
+		foo_module {
+		    name: "C",
+		}
+
+		foo_module { name: "D", deps: ["C"] }
+
+		foo_module {
+		    name: "A",
+		    foo: "a2",
+		}
+
+		foo_module {
+		    name: "B",
+		    deps: ["A"],
+		}
+
+		foo_module {
+		    name: "E",
+		    deps: ["B"],
+		}
+
+		foo_module {
+		    name: "G",
+		}
+	`)
+
+	diff := DiffModules(before, after)
+	expected := &ModuleDiff{
+		Added:   []string{"G"},
+		Removed: []string{"F"},
+		Changed: []string{"A"},
+	}
+	if !reflect.DeepEqual(diff, expected) {
+		t.Errorf("expected diff %+v, got %+v", expected, diff)
+	}
+
+	if errs := after.ResolveDependencies(nil); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+	if affected, expected := diff.Affected(after), []string{"A", "B", "E", "G"}; !reflect.DeepEqual(affected, expected) {
+		t.Errorf("expected affected modules %q, got %q", expected, affected)
+	}
+
+	if diff := DiffModules(before, before); !diff.Empty() {
+		t.Errorf("expected no difference between a tree and itself, got %+v", diff)
+	}
+}
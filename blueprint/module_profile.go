@@ -0,0 +1,109 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"runtime"
+	"sort"
+	"time"
+)
+
+// A ModuleProfile records the cost of the GenerateBuildActions call of a single
+// module variant.
+type ModuleProfile struct {
+	// Variant is the string form of the VariantID of the module variant.
+	Variant string
+
+	// Type is the module type of the module.
+	Type string
+
+	// Duration is the wall time spent in GenerateBuildActions.
+	Duration time.Duration
+
+	// Allocs and AllocBytes are the number of heap objects and bytes
+	// allocated by the process while GenerateBuildActions ran.
+	Allocs     uint64
+	AllocBytes uint64
+}
+
+// SetModuleProfiling enables recording the wall time and allocations of the
+// GenerateBuildActions call of every module variant, which can be retrieved with
+// SlowestModules after PrepareBuildActions.  Each call is timed on the goroutine
+// that runs it, so profiling doesn't change how the calls are scheduled.  The
+// runtime only counts allocations for the whole process, so those of a call
+// also include the allocations of the calls that ran at the same time, use a
+// memory profile for exact numbers.  It must be called before
+// PrepareBuildActions.
+func (c *Context) SetModuleProfiling(enabled bool) {
+	c.moduleProfiling = enabled
+}
+
+// SlowestModules returns the profiles of the n module variants whose
+// GenerateBuildActions calls took the longest, slowest first, or nil if module
+// profiling is not enabled.  All profiles are returned if n is negative.
+func (c *Context) SlowestModules(n int) []ModuleProfile {
+	if !c.moduleProfiling {
+		return nil
+	}
+
+	var profiles []ModuleProfile
+	for _, module := range c.modulesSorted {
+		if module.disabledReason != "" {
+			continue
+		}
+		profiles = append(profiles, ModuleProfile{
+			Variant:    module.variantID().String(),
+			Type:       module.typeName,
+			Duration:   module.generateDuration,
+			Allocs:     module.generateAllocs,
+			AllocBytes: module.generateAllocBytes,
+		})
+	}
+
+	sort.Sort(moduleProfileSorter(profiles))
+	if n >= 0 && n < len(profiles) {
+		profiles = profiles[:n]
+	}
+	return profiles
+}
+
+// profileModule calls generate, recording its duration and allocations in
+// module if module profiling is enabled.
+func (c *Context) profileModule(module *moduleInfo, generate func()) {
+	if !c.moduleProfiling {
+		generate()
+		return
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	generate()
+	module.generateDuration = time.Since(start)
+	runtime.ReadMemStats(&after)
+	module.generateAllocs = after.Mallocs - before.Mallocs
+	module.generateAllocBytes = after.TotalAlloc - before.TotalAlloc
+}
+
+type moduleProfileSorter []ModuleProfile
+
+func (s moduleProfileSorter) Len() int { return len(s) }
+func (s moduleProfileSorter) Less(i, j int) bool {
+	if s[i].Duration != s[j].Duration {
+		return s[i].Duration > s[j].Duration
+	}
+	return s[i].Variant < s[j].Variant
+}
+func (s moduleProfileSorter) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
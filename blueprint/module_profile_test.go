@@ -0,0 +1,174 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"testing"
+	"time"
+)
+
+type profileTestModule struct {
+	SimpleName
+	properties struct {
+		Sleep      string
+		Rendezvous bool
+		Alloc      bool
+	}
+}
+
+func newProfileTestModule() (Module, []interface{}) {
+	m := &profileTestModule{}
+	return m, []interface{}{&m.properties, &m.SimpleName.Properties}
+}
+
+// profileTestRendezvous is used by pairs of modules with the rendezvous
+// property, which only finish if their GenerateBuildActions calls overlap.
+var profileTestRendezvous = make(chan bool)
+
+// profileTestSink keeps the allocations of modules with the alloc property
+// from being optimized away.
+var profileTestSink []byte
+
+func (m *profileTestModule) GenerateBuildActions(ModuleContext) {
+	if m.properties.Alloc {
+		profileTestSink = make([]byte, 1<<20)
+	}
+	if m.properties.Sleep != "" {
+		d, err := time.ParseDuration(m.properties.Sleep)
+		if err != nil {
+			panic(err)
+		}
+		time.Sleep(d)
+	}
+	if m.properties.Rendezvous {
+		select {
+		case profileTestRendezvous <- true:
+		case <-profileTestRendezvous:
+		case <-time.After(10 * time.Second):
+			panic("GenerateBuildActions calls were not run concurrently")
+		}
+	}
+}
+
+const profileTestBlueprints = `
+	profile_module {
+		name: "fast",
+	}
+
+	profile_module {
+		name: "slow",
+		sleep: "50ms",
+	}
+
+	profile_module {
+		name: "medium",
+		sleep: "20ms",
+	}
+`
+
+func runProfileTest(t *testing.T, bp string, profiling bool) *Context {
+	ctx := NewContext()
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(bp),
+	})
+	ctx.RegisterModuleType("profile_module", newProfileTestModule)
+	ctx.SetModuleProfiling(profiling)
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) > 0 {
+		t.Fatalf("unexpected parse errors: %v", errs)
+	}
+	errs = ctx.ResolveDependencies(nil)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected dependency errors: %v", errs)
+	}
+	_, errs = ctx.PrepareBuildActions(nil)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected build action errors: %v", errs)
+	}
+	return ctx
+}
+
+func TestSlowestModules(t *testing.T) {
+	ctx := runProfileTest(t, profileTestBlueprints, true)
+
+	all := ctx.SlowestModules(-1)
+	if len(all) != 3 {
+		t.Fatalf("expected 3 profiles, got %d: %v", len(all), all)
+	}
+
+	slowest := ctx.SlowestModules(2)
+	if len(slowest) != 2 {
+		t.Fatalf("expected 2 profiles, got %d: %v", len(slowest), slowest)
+	}
+	if slowest[0].Variant != "slow" || slowest[1].Variant != "medium" {
+		t.Errorf("expected slowest modules [slow medium], got [%s %s]",
+			slowest[0].Variant, slowest[1].Variant)
+	}
+	if slowest[0].Type != "profile_module" {
+		t.Errorf("expected type profile_module, got %q", slowest[0].Type)
+	}
+	if slowest[0].Duration < 50*time.Millisecond {
+		t.Errorf("expected slow to take at least 50ms, got %s", slowest[0].Duration)
+	}
+}
+
+func TestModuleProfilingAllocs(t *testing.T) {
+	ctx := runProfileTest(t, `
+			profile_module {
+				name: "alloc",
+				alloc: true,
+			}
+		`, true)
+
+	profiles := ctx.SlowestModules(-1)
+	if len(profiles) != 1 {
+		t.Fatalf("expected 1 profile, got %d: %v", len(profiles), profiles)
+	}
+	if profiles[0].AllocBytes < 1<<20 {
+		t.Errorf("expected alloc to allocate at least 1MiB, got %d bytes", profiles[0].AllocBytes)
+	}
+	if profiles[0].Allocs < 1 {
+		t.Errorf("expected alloc to allocate at least 1 object, got %d", profiles[0].Allocs)
+	}
+}
+
+func TestModuleProfilingConcurrent(t *testing.T) {
+	// The two modules only finish if they run at the same time, which they
+	// can't if profiling serializes the GenerateBuildActions calls.
+	ctx := runProfileTest(t, `
+			profile_module {
+				name: "a",
+				rendezvous: true,
+			}
+
+			profile_module {
+				name: "b",
+				rendezvous: true,
+			}
+		`, true)
+
+	if profiles := ctx.SlowestModules(-1); len(profiles) != 2 {
+		t.Errorf("expected 2 profiles, got %d: %v", len(profiles), profiles)
+	}
+}
+
+func TestSlowestModulesDisabled(t *testing.T) {
+	ctx := runProfileTest(t, profileTestBlueprints, false)
+
+	if profiles := ctx.SlowestModules(10); profiles != nil {
+		t.Errorf("expected no profiles without module profiling, got %v", profiles)
+	}
+}
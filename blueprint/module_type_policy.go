@@ -0,0 +1,120 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/blueprint/parser"
+)
+
+// A ModuleTypePolicy restricts the module types that can be used in the
+// Blueprints files of directory subtrees, for example to only allow prebuilt
+// modules in the directories of vendor code.
+type ModuleTypePolicy struct {
+	// Rules are the rules of the policy.  A module is checked against the
+	// rule with the longest Dir that contains its Blueprints file, and is
+	// allowed if no rule contains it.
+	Rules []ModuleTypeRule
+}
+
+// A ModuleTypeRule restricts the module types that can be used in a directory
+// subtree.
+type ModuleTypeRule struct {
+	// Dir is the root of the subtree, relative to the directory of the root
+	// Blueprints file.  An empty Dir or "." is the whole source tree.
+	Dir string
+
+	// Allow, if not empty, lists the only module types that can be used in
+	// the subtree.
+	Allow []string
+
+	// Deny lists the module types that can't be used in the subtree.
+	Deny []string
+
+	// Reason is added to the errors of the modules that violate the rule.
+	Reason string
+}
+
+// SetModuleTypePolicy sets the policy that ParseBlueprintsFiles enforces on
+// the types of the modules defined in Blueprints files, reporting an error at
+// the module type of every module that violates it.  Module types are not
+// restricted if policy is nil, which is the default.
+func (c *Context) SetModuleTypePolicy(policy *ModuleTypePolicy) {
+	c.moduleTypeRules = nil
+	if policy == nil {
+		return
+	}
+
+	for _, rule := range policy.Rules {
+		rule.Dir = filepath.Clean(rule.Dir)
+		c.moduleTypeRules = append(c.moduleTypeRules, rule)
+	}
+	sort.Stable(moduleTypeRuleSorter(c.moduleTypeRules))
+}
+
+// checkModuleType returns an error if the module type policy doesn't allow the
+// module type of moduleDef in the directory of relBlueprintsFile.
+func (c *Context) checkModuleType(moduleDef *parser.Module, relBlueprintsFile string) error {
+	dir := filepath.Dir(relBlueprintsFile)
+	for _, rule := range c.moduleTypeRules {
+		if rule.Dir != "." && dir != rule.Dir && !strings.HasPrefix(dir, rule.Dir+"/") {
+			continue
+		}
+
+		if (len(rule.Allow) == 0 || inList(moduleDef.Type, rule.Allow)) &&
+			!inList(moduleDef.Type, rule.Deny) {
+			return nil
+		}
+
+		msg := fmt.Sprintf("module type %q is not allowed in %q", moduleDef.Type, rule.Dir)
+		if rule.Reason != "" {
+			msg += ": " + rule.Reason
+		}
+		return &BlueprintError{
+			Err: fmt.Errorf("%s", msg),
+			Pos: moduleDef.TypePos,
+		}
+	}
+	return nil
+}
+
+func inList(s string, list []string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// moduleTypeRuleSorter sorts the most specific rules first.
+type moduleTypeRuleSorter []ModuleTypeRule
+
+func (s moduleTypeRuleSorter) Len() int { return len(s) }
+func (s moduleTypeRuleSorter) Less(i, j int) bool {
+	return ruleDirDepth(s[i].Dir) > ruleDirDepth(s[j].Dir)
+}
+func (s moduleTypeRuleSorter) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+func ruleDirDepth(dir string) int {
+	if dir == "." {
+		return 0
+	}
+	return strings.Count(dir, "/") + 1
+}
@@ -0,0 +1,77 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestModuleTypePolicy(t *testing.T) {
+	policy := &ModuleTypePolicy{
+		Rules: []ModuleTypeRule{
+			{Dir: "", Deny: []string{"bar_module"}, Reason: "use foo_module"},
+			{Dir: "vendor"},
+			{Dir: "vendor/strict/", Allow: []string{"bar_module"}},
+		},
+	}
+
+	testCases := []struct {
+		file string
+		typ  string
+		err  string
+	}{
+		{file: "Blueprints", typ: "foo_module"},
+		{file: "Blueprints", typ: "bar_module",
+			err: `Blueprints:1:1: module type "bar_module" is not allowed in ".": use foo_module`},
+		{file: "a/Blueprints", typ: "bar_module",
+			err: `a/Blueprints:1:1: module type "bar_module" is not allowed in ".": use foo_module`},
+		{file: "vendor/Blueprints", typ: "bar_module"},
+		{file: "vendor/a/Blueprints", typ: "bar_module"},
+		{file: "vendorx/Blueprints", typ: "bar_module",
+			err: `vendorx/Blueprints:1:1: module type "bar_module" is not allowed in ".": use foo_module`},
+		{file: "vendor/strict/Blueprints", typ: "bar_module"},
+		{file: "vendor/strict/a/Blueprints", typ: "foo_module",
+			err: `vendor/strict/a/Blueprints:1:1: module type "foo_module" is not allowed in "vendor/strict"`},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.file+"/"+testCase.typ, func(t *testing.T) {
+			ctx := NewContext()
+			ctx.RegisterModuleType("foo_module", newFooModule)
+			ctx.RegisterModuleType("bar_module", newBarModule)
+			ctx.SetModuleTypePolicy(policy)
+			files := map[string][]byte{
+				"Blueprints": []byte(`build = ["` + testCase.file + `"]`),
+			}
+			files[testCase.file] = []byte(testCase.typ + ` { name: "m" }`)
+			ctx.MockFileSystem(files)
+
+			_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+
+			var got []string
+			for _, err := range errs {
+				got = append(got, err.Error())
+			}
+			sort.Strings(got)
+			if testCase.err == "" && len(got) > 0 {
+				t.Fatalf("unexpected errors: %q", got)
+			}
+			if testCase.err != "" && (len(got) != 1 || got[0] != testCase.err) {
+				t.Fatalf("expected error %q, got %q", testCase.err, got)
+			}
+		})
+	}
+}
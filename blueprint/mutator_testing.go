@@ -0,0 +1,106 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"fmt"
+)
+
+// RunMutatorsForTesting is like ResolveDependencies, but only runs the named
+// mutators, in the order they were registered in, so that a test can check the
+// variants and dependencies that a mutator creates without registering the
+// mutators of a whole build.  The built-in mutators that add the dependencies
+// returned by DynamicDependencies and the path properties always run.  The
+// dependency injectors and the hooks registered with AddDepsResolvedHook are
+// not run, and the Context can't be used to generate build actions afterwards.
+//
+// It is called after ParseBlueprintsFiles, in place of ResolveDependencies,
+// and the results are inspected with ModuleVariantsForTesting or the Visit
+// methods of the Context.
+func (c *Context) RunMutatorsForTesting(config interface{}, names ...string) []error {
+	selected := make(map[string]bool)
+	for _, name := range names {
+		selected[name] = true
+	}
+
+	found := make(map[string]bool)
+	var mutators []*mutatorInfo
+	for _, list := range [][]*mutatorInfo{c.earlyMutatorInfo, c.mutatorInfo} {
+		for _, mutator := range list {
+			if selected[mutator.name] || builtinMutators[mutator.name] {
+				mutators = append(mutators, mutator)
+				found[mutator.name] = true
+			}
+		}
+	}
+
+	var errs []error
+	for _, name := range names {
+		if !found[name] {
+			errs = append(errs, fmt.Errorf("mutator %q is not registered", name))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	errs = c.evaluateEnabledProperties(config)
+	if len(errs) > 0 {
+		return errs
+	}
+
+	errs = c.updateDependencies()
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return c.runMutatorList(config, mutators)
+}
+
+// builtinMutators are the names of the mutators registered by NewContext.
+var builtinMutators = map[string]bool{
+	"blueprint_deps":      true,
+	"blueprint_path_deps": true,
+}
+
+// A VariantForTesting describes a variant of a module after
+// RunMutatorsForTesting or ResolveDependencies.
+type VariantForTesting struct {
+	Module Module
+
+	// ID is the string form of the VariantID of the variant.
+	ID string
+
+	// Deps are the string forms of the VariantIDs of the direct dependencies
+	// of the variant, in the order they were added.
+	Deps []string
+}
+
+// ModuleVariantsForTesting returns the variants of the named module, in the
+// order the mutators created them, or nil if there is no such module.
+func (c *Context) ModuleVariantsForTesting(name string) []VariantForTesting {
+	var ret []VariantForTesting
+	for _, module := range c.modulesFromName(name) {
+		variant := VariantForTesting{
+			Module: module.logicModule,
+			ID:     module.variantID().String(),
+		}
+		for _, dep := range module.directDeps {
+			variant.Deps = append(variant.Deps, dep.module.variantID().String())
+		}
+		ret = append(ret, variant)
+	}
+	return ret
+}
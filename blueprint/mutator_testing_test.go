@@ -0,0 +1,101 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func mutatorTestingContext() *Context {
+	ctx := NewContext()
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			foo_module {
+				name: "A",
+				deps: ["B"],
+			}
+
+			bar_module {
+				name: "B",
+			}
+		`),
+	})
+	ctx.RegisterModuleType("foo_module", newFooModule)
+	ctx.RegisterModuleType("bar_module", newBarModule)
+	ctx.RegisterBottomUpMutator("arch", func(mctx BottomUpMutatorContext) {
+		mctx.CreateVariations("arm", "arm64")
+	})
+	ctx.RegisterBottomUpMutator("link", func(mctx BottomUpMutatorContext) {
+		if _, ok := mctx.Module().(*barModule); ok {
+			mctx.CreateLocalVariations("static", "shared")
+		}
+	})
+	ctx.RegisterTopDownMutator("fail", func(mctx TopDownMutatorContext) {
+		mctx.ModuleErrorf("the fail mutator ran")
+	})
+	return ctx
+}
+
+func TestRunMutatorsForTesting(t *testing.T) {
+	ctx := mutatorTestingContext()
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) > 0 {
+		t.Fatalf("unexpected parse errors: %v", errs)
+	}
+
+	errs = ctx.RunMutatorsForTesting(nil, "arch")
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	expected := []VariantForTesting{
+		{ID: "A{arch=arm}", Deps: []string{"B{arch=arm}"}},
+		{ID: "A{arch=arm64}", Deps: []string{"B{arch=arm64}"}},
+	}
+	variants := ctx.ModuleVariantsForTesting("A")
+	for i := range variants {
+		if _, ok := variants[i].Module.(*fooModule); !ok {
+			t.Errorf("expected variant %s to be a *fooModule, got %T", variants[i].ID, variants[i].Module)
+		}
+		variants[i].Module = nil
+	}
+	if !reflect.DeepEqual(variants, expected) {
+		t.Errorf("incorrect variants:\nwant: %v\n got: %v", expected, variants)
+	}
+
+	if variants := ctx.ModuleVariantsForTesting("C"); variants != nil {
+		t.Errorf("expected no variants for a missing module, got %v", variants)
+	}
+}
+
+func TestRunMutatorsForTestingErrors(t *testing.T) {
+	ctx := mutatorTestingContext()
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) > 0 {
+		t.Fatalf("unexpected parse errors: %v", errs)
+	}
+
+	errs = ctx.RunMutatorsForTesting(nil, "link", "missing")
+	if len(errs) != 1 || errs[0].Error() != `mutator "missing" is not registered` {
+		t.Errorf(`expected an error for the "missing" mutator, got %v`, errs)
+	}
+
+	errs = ctx.RunMutatorsForTesting(nil, "link", "fail")
+	if len(errs) == 0 || !strings.HasSuffix(errs[0].Error(), "the fail mutator ran") {
+		t.Errorf("expected an error from the fail mutator, got %v", errs)
+	}
+}
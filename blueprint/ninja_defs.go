@@ -20,6 +20,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // A Deps value indicates the dependency file format that Ninja should expect to
@@ -69,6 +70,30 @@ type RuleParams struct {
 	// These fields are used internally in Blueprint
 	CommandDeps []string // Command-specific implicit dependencies to prepend to builds
 	Comment     string   // The comment that will appear above the definition.
+
+	// These fields are implemented by wrapping the command in a script for a
+	// POSIX shell, see wrapTimeoutRetryCommand.  They are meant for rules
+	// that are flaky because they use the network, like fetching artifacts
+	// or signing with a remote server.
+	Timeout time.Duration // Kill the command if it runs longer, rounded up to seconds.
+	Retries int           // The number of times to rerun the command if it fails.
+
+	// Idempotent marks a rule whose build statements may be requested more
+	// than once, for example by every module that needs a shared file
+	// copied into place.  Build statements of the rule that have the same
+	// outputs, inputs and arguments are merged into one, see
+	// mergeIdempotentBuildDefs.
+	Idempotent bool
+
+	// Local and NoCache mark a rule whose commands must always run on the
+	// build host, and whose outputs must not be taken from or stored in a
+	// cache, like signing with a key that only exists on the host or
+	// collecting information about the host.  Ninja doesn't know about remote
+	// execution or caching, so they are honored by the primary builders that
+	// wrap commands with remote execution or caching tools, and are exported
+	// in the BuildStatements.
+	Local   bool
+	NoCache bool
 }
 
 // A BuildParams object contains the set of parameters that make up a Ninja
@@ -88,6 +113,39 @@ type BuildParams struct {
 	OrderOnly       []string          // The list of order-only dependencies.
 	Args            map[string]string // The variable/value pairs to set.
 	Optional        bool              // Skip outputting a default statement
+
+	// DefaultPriority nominates the explicit outputs as default targets of
+	// the Ninja file, the targets that Ninja builds when it is run without
+	// arguments, if it is greater than zero.  Once any build statement is
+	// nominated, or a policy is set with SetDefaultTargetPolicy, only the
+	// targets picked by the policy are defaults instead of the outputs of all
+	// the build statements that are not Optional.  See DefaultTarget.
+	DefaultPriority int
+
+	// Interactive marks a build statement that needs the terminal or runs
+	// for a long time, like flashing a device or signing with a key that
+	// prompts for a password.  It runs in the Console pool, which gives it
+	// direct access to the terminal while Ninja buffers the output of the
+	// other actions, and its outputs may not be the inputs of other build
+	// statements except phony ones, so that waiting on it doesn't stall the
+	// rest of the build.  The pool policy is not applied to it.
+	Interactive bool
+
+	// OrderGroup adds the build statement to the named order group of the
+	// module or singleton that defines it.  Build statements of the same
+	// module or singleton can be built after all the build statements of a
+	// group with After, for example to run all the code generators of a
+	// module before any of its compile actions, without listing every
+	// output or making up a stamp file.
+	OrderGroup string
+
+	// After lists the order groups of the same module or singleton that are
+	// built before the build statement.  Each group becomes a phony target
+	// that depends on the outputs of the build statements in the group and
+	// is added to the order-only dependencies of the build statement.
+	// PrepareBuildActions reports an error for a group that has no build
+	// statements, and for groups that are built after each other.
+	After []string
 }
 
 // A poolDef describes a pool definition.  It does not include the name of the
@@ -131,15 +189,21 @@ type ruleDef struct {
 	Comment     string
 	Pool        Pool
 	Variables   map[string]*ninjaString
+	Idempotent  bool
+	Local       bool
+	NoCache     bool
 }
 
 func parseRuleParams(scope scope, params *RuleParams) (*ruleDef,
 	error) {
 
 	r := &ruleDef{
-		Comment:   params.Comment,
-		Pool:      params.Pool,
-		Variables: make(map[string]*ninjaString),
+		Comment:    params.Comment,
+		Pool:       params.Pool,
+		Variables:  make(map[string]*ninjaString),
+		Idempotent: params.Idempotent,
+		Local:      params.Local,
+		NoCache:    params.NoCache,
 	}
 
 	if params.Command == "" {
@@ -155,6 +219,12 @@ func parseRuleParams(scope scope, params *RuleParams) (*ruleDef,
 	if err != nil {
 		return nil, fmt.Errorf("error parsing Command param: %s", err)
 	}
+	if params.Timeout < 0 || params.Retries < 0 {
+		return nil, fmt.Errorf("Timeout and Retries must not be negative")
+	}
+	if params.Timeout > 0 || params.Retries > 0 {
+		value = wrapTimeoutRetryCommand(value, params.Timeout, params.Retries)
+	}
 	r.Variables["command"] = value
 
 	if params.Depfile != "" {
@@ -252,7 +322,13 @@ type buildDef struct {
 	OrderOnly       []*ninjaString
 	Args            map[Variable]*ninjaString
 	Variables       map[string]*ninjaString
+	Pool            Pool        // set by the pool policy, overrides the pool of the rule
+	Subninja        string      // set by BuildInSubninja, the file the statement is written to
+	Symlink         *symlinkDef // set by ModuleContext.BuildSymlink
+	OrderGroup      string
+	After           []string
 	Optional        bool
+	DefaultPriority int
 }
 
 func parseBuildParams(scope scope, params *BuildParams) (*buildDef,
@@ -307,7 +383,21 @@ func parseBuildParams(scope scope, params *BuildParams) (*buildDef,
 		return nil, fmt.Errorf("error parsing OrderOnly param: %s", err)
 	}
 
+	if err := checkOrderGroupNames(params); err != nil {
+		return nil, err
+	}
+	b.OrderGroup = params.OrderGroup
+	b.After = params.After
+
 	b.Optional = params.Optional
+	if params.DefaultPriority < 0 {
+		return nil, fmt.Errorf("DefaultPriority must not be negative")
+	}
+	b.DefaultPriority = params.DefaultPriority
+
+	if params.Interactive {
+		b.Pool = Console
+	}
 
 	if params.Depfile != "" {
 		value, err := parseNinjaString(scope, params.Depfile)
@@ -388,6 +478,13 @@ func (b *buildDef) WriteTo(nw *ninjaWriter, pkgNames map[*packageContext]string)
 		return err
 	}
 
+	if b.Pool != nil {
+		err = nw.ScopedAssign("pool", b.Pool.fullName(pkgNames))
+		if err != nil {
+			return err
+		}
+	}
+
 	var keys []string
 	for k := range args {
 		keys = append(keys, k)
@@ -0,0 +1,264 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A NinjaEscapeError describes a string in the build actions that Ninja would
+// misparse, found by WriteBuildFile when strict Ninja escapes are enabled.
+type NinjaEscapeError struct {
+	// Owner describes the module, singleton or package that defined the
+	// build actions, for example `module "foo" variant "arm"`.
+	Owner string
+
+	// Rule is the name of the rule that the string belongs to, or of the rule
+	// of the build statement, if any.
+	Rule string
+
+	// Field is the Ninja variable, or the kind of path, that holds the string,
+	// for example "command" or "input".
+	Field string
+
+	// Value is the offending string.
+	Value string
+
+	// Reason describes why Ninja would misparse Value.
+	Reason string
+}
+
+func (e *NinjaEscapeError) Error() string {
+	s := e.Owner
+	if e.Rule != "" {
+		s += fmt.Sprintf(": rule %q", e.Rule)
+	}
+	return fmt.Sprintf("%s: %s %q: %s", s, e.Field, e.Value, e.Reason)
+}
+
+// SetStrictNinjaEscapes enables validation of the strings written to the Ninja
+// file by WriteBuildFile.  Rule commands and other variables, build arguments
+// and paths are checked for literal newlines, which would end the Ninja
+// statement and must be written as $\n instead, carriage returns and NUL
+// bytes, and paths are checked for values that Ninja would parse as the "|",
+// "||" or "|@" separators.
+// WriteBuildFile returns a *NinjaEscapeError for the first string that fails
+// validation.  Strict Ninja escapes are disabled by default.
+func (c *Context) SetStrictNinjaEscapes(strict bool) {
+	c.strictNinjaEscapes = strict
+}
+
+func (c *Context) checkNinjaEscapes() error {
+	if !c.strictNinjaEscapes {
+		return nil
+	}
+
+	var globalVariables []Variable
+	for v := range c.globalVariables {
+		globalVariables = append(globalVariables, v)
+	}
+	sort.Sort(variableSorter(globalVariables))
+	for _, v := range globalVariables {
+		err := checkNinjaStringEscapes(c.globalVariables[v], "package "+v.packageContext().pkgPath,
+			"", "variable "+v.name(), false)
+		if err != nil {
+			return err
+		}
+	}
+
+	var globalRules []Rule
+	for r := range c.globalRules {
+		globalRules = append(globalRules, r)
+	}
+	sort.Sort(ruleSorter(globalRules))
+	for _, r := range globalRules {
+		err := checkRuleDefEscapes(c.globalRules[r], "package "+r.packageContext().pkgPath, r.name())
+		if err != nil {
+			return err
+		}
+	}
+
+	modules := make([]*moduleInfo, 0, len(c.moduleInfo))
+	for _, module := range c.moduleInfo {
+		modules = append(modules, module)
+	}
+	sort.Sort(moduleSorter(modules))
+
+	for _, module := range modules {
+		err := checkLocalNinjaEscapes(&module.actionDefs, module.String())
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, info := range c.singletonInfo {
+		err := checkLocalNinjaEscapes(&info.actionDefs, fmt.Sprintf("singleton %q", info.name))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func checkLocalNinjaEscapes(defs *localBuildActions, owner string) error {
+	for _, v := range defs.variables {
+		err := checkNinjaStringEscapes(v.value_, owner, "", "variable "+v.name(), false)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, r := range defs.rules {
+		err := checkRuleDefEscapes(r.def_, owner, r.name())
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, buildDef := range defs.buildDefs {
+		err := checkBuildDefEscapes(buildDef, owner)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func checkRuleDefEscapes(def *ruleDef, owner, rule string) error {
+	names := make([]string, 0, len(def.Variables))
+	for name := range def.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		err := checkNinjaStringEscapes(def.Variables[name], owner, rule, name, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, dep := range def.CommandDeps {
+		err := checkNinjaStringEscapes(dep, owner, rule, "command dependency", true)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func checkBuildDefEscapes(def *buildDef, owner string) error {
+	rule := def.Rule.name()
+
+	paths := []struct {
+		field  string
+		values []*ninjaString
+	}{
+		{"output", def.Outputs},
+		{"implicit output", def.ImplicitOutputs},
+		{"input", def.Inputs},
+		{"implicit input", def.Implicits},
+		{"order-only input", def.OrderOnly},
+	}
+	for _, p := range paths {
+		for _, value := range p.values {
+			err := checkNinjaStringEscapes(value, owner, rule, p.field, true)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	args := make([]Variable, 0, len(def.Args))
+	for v := range def.Args {
+		args = append(args, v)
+	}
+	sort.Sort(variableSorter(args))
+	for _, v := range args {
+		err := checkNinjaStringEscapes(def.Args[v], owner, rule, v.name(), false)
+		if err != nil {
+			return err
+		}
+	}
+
+	names := make([]string, 0, len(def.Variables))
+	for name := range def.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		err := checkNinjaStringEscapes(def.Variables[name], owner, rule, name, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkNinjaStringEscapes checks the literal parts of value, the variables it
+// references are checked where they are defined.
+func checkNinjaStringEscapes(value *ninjaString, owner, rule, field string, path bool) error {
+	if value == nil {
+		return nil
+	}
+
+	newError := func(s, reason string) error {
+		return &NinjaEscapeError{
+			Owner:  owner,
+			Rule:   rule,
+			Field:  field,
+			Value:  s,
+			Reason: reason,
+		}
+	}
+
+	for _, s := range value.strings {
+		switch {
+		case strings.Contains(s, "\n"):
+			return newError(s, "contains a literal newline, which ends the Ninja statement, write $\\n to continue the line")
+		case strings.Contains(s, "\r"):
+			return newError(s, "contains a carriage return")
+		case strings.Contains(s, "\x00"):
+			return newError(s, "contains a NUL byte")
+		}
+	}
+
+	if path && len(value.variables) == 0 {
+		switch value.strings[0] {
+		case "|", "||", "|@":
+			return newError(value.strings[0], "would be parsed as a separator instead of a path")
+		}
+	}
+
+	return nil
+}
+
+type variableSorter []Variable
+
+func (s variableSorter) Len() int           { return len(s) }
+func (s variableSorter) Less(i, j int) bool { return s[i].String() < s[j].String() }
+func (s variableSorter) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+type ruleSorter []Rule
+
+func (s ruleSorter) Len() int           { return len(s) }
+func (s ruleSorter) Less(i, j int) bool { return s[i].String() < s[j].String() }
+func (s ruleSorter) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
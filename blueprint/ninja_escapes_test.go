@@ -0,0 +1,111 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"bytes"
+	"testing"
+)
+
+var ninjaEscapesTestPctx = NewPackageContext("github.com/google/blueprint/ninja_escapes_test")
+
+type ninjaEscapesSingleton struct {
+	command string
+	flags   string
+	input   string
+}
+
+func (s *ninjaEscapesSingleton) GenerateBuildActions(ctx SingletonContext) {
+	rule := ctx.Rule(ninjaEscapesTestPctx, "r", RuleParams{
+		Command: s.command,
+	}, "flags")
+	ctx.Build(ninjaEscapesTestPctx, BuildParams{
+		Rule:    rule,
+		Outputs: []string{"out"},
+		Inputs:  []string{s.input},
+		Args: map[string]string{
+			"flags": s.flags,
+		},
+	})
+}
+
+func TestStrictNinjaEscapes(t *testing.T) {
+	testCases := []struct {
+		name      string
+		singleton ninjaEscapesSingleton
+		strict    bool
+		err       string
+	}{
+		{
+			name:      "valid",
+			singleton: ninjaEscapesSingleton{command: "cp $flags $in $out", flags: "-a", input: "in"},
+			strict:    true,
+		},
+		{
+			name:      "newline not strict",
+			singleton: ninjaEscapesSingleton{command: "echo a\necho b", flags: "-a", input: "in"},
+		},
+		{
+			name:      "newline in command",
+			singleton: ninjaEscapesSingleton{command: "echo a\necho b", flags: "-a", input: "in"},
+			strict:    true,
+			err: `singleton "escapes": rule "r": command "echo a\necho b": ` +
+				`contains a literal newline, which ends the Ninja statement, write $\n to continue the line`,
+		},
+		{
+			name:      "NUL in argument",
+			singleton: ninjaEscapesSingleton{command: "cp $flags $in $out", flags: "-a\x00", input: "in"},
+			strict:    true,
+			err:       `singleton "escapes": rule "r": flags "-a\x00": contains a NUL byte`,
+		},
+		{
+			name:      "separator as input",
+			singleton: ninjaEscapesSingleton{command: "cp $flags $in $out", flags: "-a", input: "||"},
+			strict:    true,
+			err:       `singleton "escapes": rule "r": input "||": would be parsed as a separator instead of a path`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		ctx := NewContext()
+		ctx.MockFileSystem(map[string][]byte{
+			"Blueprints": nil,
+		})
+		singleton := testCase.singleton
+		ctx.RegisterSingletonType("escapes", func() Singleton {
+			return &singleton
+		})
+		ctx.SetStrictNinjaEscapes(testCase.strict)
+
+		_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+		if len(errs) == 0 {
+			_, errs = ctx.PrepareBuildActions(nil)
+		}
+		if len(errs) > 0 {
+			t.Fatalf("%s: unexpected errors: %s", testCase.name, errs)
+		}
+
+		err := ctx.WriteBuildFile(&bytes.Buffer{})
+		if testCase.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %s", testCase.name, err)
+			}
+		} else if err == nil {
+			t.Errorf("%s: expected error %q", testCase.name, testCase.err)
+		} else if err.Error() != testCase.err {
+			t.Errorf("%s: expected error %q, got %q", testCase.name, testCase.err, err.Error())
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AddNinjaFileDeps adds files that the generated Ninja file depends on, so that
+// it is regenerated when they change.  It can be called at any time before
+// PrepareBuildActions, including concurrently by mutators and module
+// factories, for example for config files read while analyzing the modules.
+// The files are returned by PrepareBuildActions.
+func (c *Context) AddNinjaFileDeps(deps ...string) {
+	c.ninjaFileDepsLock.Lock()
+	defer c.ninjaFileDepsLock.Unlock()
+	c.ninjaFileDeps = append(c.ninjaFileDeps, deps...)
+}
+
+func (c *Context) addedNinjaFileDeps() []string {
+	c.ninjaFileDepsLock.Lock()
+	defer c.ninjaFileDepsLock.Unlock()
+	return append([]string(nil), c.ninjaFileDeps...)
+}
+
+// normalizeNinjaFileDeps cleans deps, makes the absolute paths inside the
+// working directory relative to it, and removes the duplicates while keeping
+// the order of the first occurrences.
+func normalizeNinjaFileDeps(deps []string) []string {
+	wd, err := os.Getwd()
+	if err != nil {
+		wd = ""
+	}
+
+	ret := make([]string, 0, len(deps))
+	seen := make(map[string]bool, len(deps))
+	for _, dep := range deps {
+		if dep == "" {
+			continue
+		}
+		dep = filepath.Clean(dep)
+		if wd != "" && filepath.IsAbs(dep) {
+			rel, err := filepath.Rel(wd, dep)
+			if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				dep = rel
+			}
+		}
+		if !seen[dep] {
+			seen[dep] = true
+			ret = append(ret, dep)
+		}
+	}
+	return ret
+}
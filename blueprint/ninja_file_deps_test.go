@@ -0,0 +1,72 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type ninjaFileDepsSingleton struct{}
+
+func (ninjaFileDepsSingleton) GenerateBuildActions(ctx SingletonContext) {
+	ctx.AddNinjaFileDeps("./singleton.txt", "config/a.txt")
+}
+
+func TestAddNinjaFileDeps(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := NewContext()
+	ctx.RegisterModuleType("foo_module", newFooModule)
+	ctx.RegisterBottomUpMutator("deps", func(ctx BottomUpMutatorContext) {
+		ctx.AddNinjaFileDeps("config/../config/a.txt", "config/"+ctx.ModuleName()+".txt")
+	}).Parallel()
+	ctx.RegisterSingletonType("deps", func() Singleton { return ninjaFileDepsSingleton{} })
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			foo_module {
+			    name: "A",
+			}
+		`),
+	})
+
+	ctx.AddNinjaFileDeps(filepath.Join(wd, "context.txt"), "/outside/context.txt")
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) > 0 {
+		t.Fatalf("unexpected parse errors: %q", errs)
+	}
+
+	deps, errs := ctx.PrepareBuildActions(nil)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+
+	expected := []string{
+		"singleton.txt",
+		"config/a.txt",
+		"context.txt",
+		"/outside/context.txt",
+		"config/A.txt",
+	}
+	if !reflect.DeepEqual(deps, expected) {
+		t.Errorf("expected deps %q, got %q", expected, deps)
+	}
+}
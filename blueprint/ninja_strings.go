@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"fmt"
 	"strings"
+	"sync"
 )
 
 const eof = -1
@@ -37,6 +38,56 @@ var (
 type ninjaString struct {
 	strings   []string
 	variables []Variable
+
+	// template is the parsed template the strings are shared with, if any,
+	// which caches their escaped forms.
+	template *ninjaTemplate
+}
+
+// A ninjaTemplate is a parsed ninja string whose variable names haven't been
+// looked up in a scope yet.  It only depends on the string, so it is cached
+// and shared by every ninjaString parsed from the same string in any scope,
+// and must not be modified.
+type ninjaTemplate struct {
+	strings []string
+	names   []string
+
+	// escaped caches the strings escaped with each escaper, which are only
+	// computed when a ninjaString sharing the template is written.
+	escapedLock sync.Mutex
+	escaped     map[*strings.Replacer][]string
+}
+
+// escapedStrings returns the literal strings of the template escaped with
+// escaper.
+func (t *ninjaTemplate) escapedStrings(escaper *strings.Replacer) []string {
+	t.escapedLock.Lock()
+	defer t.escapedLock.Unlock()
+
+	if strs, ok := t.escaped[escaper]; ok {
+		return strs
+	}
+
+	strs := make([]string, len(t.strings))
+	for i, s := range t.strings {
+		strs[i] = escaper.Replace(s)
+	}
+	if t.escaped == nil {
+		t.escaped = make(map[*strings.Replacer][]string)
+	}
+	t.escaped[escaper] = strs
+	return strs
+}
+
+// ninjaTemplates caches the templates of the strings parsed by
+// parseNinjaString, most of which are the commands and arguments of rules
+// that are parsed once per module.  The literal strings of the cached
+// templates are interned in substrings, so that the flags and separators that
+// many different strings contain are only kept in memory once.
+var ninjaTemplates struct {
+	sync.RWMutex
+	templates  map[string]*ninjaTemplate
+	substrings map[string]string
 }
 
 type scope interface {
@@ -52,27 +103,26 @@ func simpleNinjaString(str string) *ninjaString {
 }
 
 type parseState struct {
-	scope       scope
 	str         string
 	pendingStr  string
 	stringStart int
 	varStart    int
-	result      *ninjaString
+	result      *ninjaTemplate
 }
 
-func (ps *parseState) pushVariable(v Variable) {
-	if len(ps.result.variables) == len(ps.result.strings) {
+func (ps *parseState) pushVariable(name string) {
+	if len(ps.result.names) == len(ps.result.strings) {
 		// Last push was a variable, we need a blank string separator
 		ps.result.strings = append(ps.result.strings, "")
 	}
 	if ps.pendingStr != "" {
 		panic("oops, pushed variable with pending string")
 	}
-	ps.result.variables = append(ps.result.variables, v)
+	ps.result.names = append(ps.result.names, name)
 }
 
 func (ps *parseState) pushString(s string) {
-	if len(ps.result.strings) != len(ps.result.variables) {
+	if len(ps.result.strings) != len(ps.result.names) {
 		panic("oops, pushed string after string")
 	}
 	ps.result.strings = append(ps.result.strings, ps.pendingStr+s)
@@ -81,21 +131,91 @@ func (ps *parseState) pushString(s string) {
 
 type stateFunc func(*parseState, int, rune) (stateFunc, error)
 
+// maxParseCacheEntries limits the number of parsed strings cached for each
+// package scope, and the number of templates and substrings cached by
+// parseNinjaTemplate.  Most strings that are parsed repeatedly, like flags
+// passed as build arguments, are seen early, while paths are usually only
+// parsed once.
+const maxParseCacheEntries = 1 << 16
+
 // parseNinjaString parses an unescaped ninja string (i.e. all $<something>
 // occurrences are expected to be variables or $$) and returns a list of the
-// variable names that the string references.
+// variable names that the string references.  The returned ninjaString may be
+// shared with other callers and must not be modified.
 func parseNinjaString(scope scope, str string) (*ninjaString, error) {
+	if strings.IndexByte(str, '$') < 0 {
+		// Strings without variable references are common and don't need the
+		// state machine.  A leading space must be escaped.
+		if len(str) > 0 && str[0] == ' ' {
+			str = "$" + str
+		}
+		return &ninjaString{
+			strings:   []string{str},
+			variables: []Variable{},
+		}, nil
+	}
+
+	cacheScope := parseCacheScope(scope)
+	if cacheScope != nil {
+		cacheScope.parsedLock.RLock()
+		result, ok := cacheScope.parsed[str]
+		cacheScope.parsedLock.RUnlock()
+		if ok {
+			return result, nil
+		}
+	}
+
+	template, err := parseNinjaTemplate(str)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ninjaString{
+		strings:   template.strings,
+		variables: make([]Variable, len(template.names)),
+		template:  template,
+	}
+	for i, name := range template.names {
+		result.variables[i], err = scope.LookupVariable(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cacheScope != nil {
+		cacheScope.parsedLock.Lock()
+		if cacheScope.parsed == nil {
+			cacheScope.parsed = make(map[string]*ninjaString)
+		}
+		if len(cacheScope.parsed) < maxParseCacheEntries {
+			cacheScope.parsed[str] = result
+		}
+		cacheScope.parsedLock.Unlock()
+	}
+
+	return result, nil
+}
+
+// parseNinjaTemplate returns the template of str, parsing it if it isn't
+// cached yet.
+func parseNinjaTemplate(str string) (*ninjaTemplate, error) {
+	ninjaTemplates.RLock()
+	template, ok := ninjaTemplates.templates[str]
+	ninjaTemplates.RUnlock()
+	if ok {
+		return template, nil
+	}
+
 	// naively pre-allocate slices by counting $ signs
 	n := strings.Count(str, "$")
-	result := &ninjaString{
-		strings:   make([]string, 0, n+1),
-		variables: make([]Variable, 0, n),
+	template = &ninjaTemplate{
+		strings: make([]string, 0, n+1),
+		names:   make([]string, 0, n),
 	}
 
 	parseState := &parseState{
-		scope:  scope,
 		str:    str,
-		result: result,
+		result: template,
 	}
 
 	state := parseFirstRuneState
@@ -113,7 +233,47 @@ func parseNinjaString(scope scope, str string) (*ninjaString, error) {
 		return nil, err
 	}
 
-	return result, nil
+	ninjaTemplates.Lock()
+	defer ninjaTemplates.Unlock()
+	if cached, ok := ninjaTemplates.templates[str]; ok {
+		return cached, nil
+	}
+	if len(ninjaTemplates.templates) < maxParseCacheEntries {
+		if ninjaTemplates.templates == nil {
+			ninjaTemplates.templates = make(map[string]*ninjaTemplate)
+			ninjaTemplates.substrings = make(map[string]string)
+		}
+		for i, s := range template.strings {
+			if interned, ok := ninjaTemplates.substrings[s]; ok {
+				template.strings[i] = interned
+			} else if len(ninjaTemplates.substrings) < maxParseCacheEntries {
+				ninjaTemplates.substrings[s] = s
+			}
+		}
+		ninjaTemplates.templates[str] = template
+	}
+
+	return template, nil
+}
+
+// parseCacheScope returns the package scope whose cache of parsed strings can
+// be used for strings parsed in scope, or nil if they can't be cached.  Package
+// scopes are only modified during init, so variable lookups in them always
+// return the same result afterwards.  A local scope resolves variables exactly
+// like its package scope as long as it has no local variables.
+func parseCacheScope(scope scope) *basicScope {
+	switch s := scope.(type) {
+	case *basicScope:
+		if s.parent == nil {
+			return s
+		}
+	case *localScope:
+		parent := s.scope.parent
+		if len(s.scope.variables) == 0 && parent != nil && parent.parent == nil {
+			return parent
+		}
+	}
+	return nil
 }
 
 func parseFirstRuneState(state *parseState, i int, r rune) (stateFunc, error) {
@@ -180,12 +340,7 @@ func parseDollarState(state *parseState, i int, r rune) (stateFunc, error) {
 	case r == '$':
 		// A dollar after the variable name (e.g. "$blah$").  Output the
 		// variable we have and start a new one.
-		v, err := state.scope.LookupVariable(state.str[state.varStart:i])
-		if err != nil {
-			return nil, err
-		}
-
-		state.pushVariable(v)
+		state.pushVariable(state.str[state.varStart:i])
 		state.varStart = i + 1
 		state.stringStart = i
 
@@ -193,12 +348,7 @@ func parseDollarState(state *parseState, i int, r rune) (stateFunc, error) {
 
 	case r == eof:
 		// This is the end of the variable name.
-		v, err := state.scope.LookupVariable(state.str[state.varStart:i])
-		if err != nil {
-			return nil, err
-		}
-
-		state.pushVariable(v)
+		state.pushVariable(state.str[state.varStart:i])
 
 		// We always end with a string, even if it's an empty one.
 		state.pushString("")
@@ -208,12 +358,7 @@ func parseDollarState(state *parseState, i int, r rune) (stateFunc, error) {
 	default:
 		// We've just gone past the end of the variable name, so record what
 		// we have.
-		v, err := state.scope.LookupVariable(state.str[state.varStart:i])
-		if err != nil {
-			return nil, err
-		}
-
-		state.pushVariable(v)
+		state.pushVariable(state.str[state.varStart:i])
 		state.stringStart = i
 		return parseStringState, nil
 	}
@@ -234,12 +379,7 @@ func parseBracketsState(state *parseState, i int, r rune) (stateFunc, error) {
 		}
 
 		// This is the end of the variable name.
-		v, err := state.scope.LookupVariable(state.str[state.varStart:i])
-		if err != nil {
-			return nil, err
-		}
-
-		state.pushVariable(v)
+		state.pushVariable(state.str[state.varStart:i])
 		state.stringStart = i + 1
 		return parseStringState, nil
 
@@ -277,12 +417,38 @@ func (n *ninjaString) Value(pkgNames map[*packageContext]string) string {
 func (n *ninjaString) ValueWithEscaper(pkgNames map[*packageContext]string,
 	escaper *strings.Replacer) string {
 
-	str := escaper.Replace(n.strings[0])
-	for i, v := range n.variables {
-		str += "${" + v.fullName(pkgNames) + "}"
-		str += escaper.Replace(n.strings[i+1])
+	if n.template == nil {
+		if len(n.variables) == 0 {
+			return escaper.Replace(n.strings[0])
+		}
+		strs := make([]string, len(n.strings))
+		for i, s := range n.strings {
+			strs[i] = escaper.Replace(s)
+		}
+		return joinNinjaString(strs, n.variables, pkgNames)
+	}
+
+	return joinNinjaString(n.template.escapedStrings(escaper), n.variables, pkgNames)
+}
+
+// joinNinjaString returns the escaped strings interleaved with references to
+// the variables.
+func joinNinjaString(strs []string, variables []Variable,
+	pkgNames map[*packageContext]string) string {
+
+	if len(variables) == 0 {
+		return strs[0]
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(strs[0])
+	for i, v := range variables {
+		buf.WriteString("${")
+		buf.WriteString(v.fullName(pkgNames))
+		buf.WriteString("}")
+		buf.WriteString(strs[i+1])
 	}
-	return str
+	return buf.String()
 }
 
 func (n *ninjaString) Eval(variables map[Variable]*ninjaString) (string, error) {
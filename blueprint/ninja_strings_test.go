@@ -16,6 +16,7 @@ package blueprint
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -161,3 +162,139 @@ func TestParseNinjaStringWithImportedVar(t *testing.T) {
 		t.Errorf("       got: %#v", output)
 	}
 }
+
+func TestParseNinjaStringCache(t *testing.T) {
+	pkgScope := newScope(nil)
+	pkgVar := &staticVariable{name_: "pkgVar"}
+	pkgScope.AddVariable(pkgVar)
+
+	input := "abc ${pkgVar} def"
+
+	first, err := parseNinjaString(pkgScope, input)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// A local scope without local variables shares its package scope's cache.
+	scope := newLocalScope(pkgScope, "namespace")
+	second, err := parseNinjaString(scope, input)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if first != second {
+		t.Errorf("expected cached ninjaString to be reused for %q", input)
+	}
+
+	// Once a local variable can shadow the package variable the cache must
+	// not be used.
+	localVar, err := scope.AddLocalVariable("pkgVar", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	third, err := parseNinjaString(scope, input)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(third.variables, []Variable{localVar}) {
+		t.Errorf("incorrect variable list:")
+		t.Errorf("  expected: %#v", []Variable{localVar})
+		t.Errorf("       got: %#v", third.variables)
+	}
+}
+
+func BenchmarkParseNinjaString(b *testing.B) {
+	pkgScope := newScope(nil)
+	for _, name := range []string{"cc", "cFlags", "outDir"} {
+		pkgScope.AddVariable(&staticVariable{name_: name})
+	}
+	scope := newLocalScope(pkgScope, "namespace")
+
+	inputs := []string{
+		"${cc} -c ${cFlags} -MD -MF $$out.d -o $$out $$in",
+		"${outDir}/obj/foo.o",
+		"-O2 -Wall -Werror",
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, input := range inputs {
+			if _, err := parseNinjaString(scope, input); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestParseNinjaStringTemplateCache(t *testing.T) {
+	pkgScope := newScope(nil)
+	pkgScope.AddVariable(&staticVariable{name_: "cc"})
+
+	// Rule scopes have their own out and in variables, so the parsed strings
+	// can't be shared, but the templates are.
+	input := "${cc} -c $in -o $out"
+	first, err := parseNinjaString(makeRuleScope(pkgScope, nil), input)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	second, err := parseNinjaString(makeRuleScope(pkgScope, nil), input)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if first == second {
+		t.Errorf("expected different ninjaStrings for different rule scopes")
+	}
+	if first.template == nil || first.template != second.template {
+		t.Errorf("expected the template of %q to be shared", input)
+	}
+	if first.variables[1] == second.variables[1] {
+		t.Errorf("expected $in to be looked up in each rule scope")
+	}
+
+	// The substrings of cached templates are interned.
+	ninjaTemplates.RLock()
+	_, ok := ninjaTemplates.substrings[" -c "]
+	ninjaTemplates.RUnlock()
+	if !ok {
+		t.Errorf("expected substring %q to be interned", " -c ")
+	}
+}
+
+func TestNinjaStringLazyEscaping(t *testing.T) {
+	scope := newLocalScope(nil, "namespace.")
+	_, err := scope.AddLocalVariable("v", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	input := "a b:${v}c d:"
+	ninjaStr, err := parseNinjaString(scope, input)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ninjaStr.template.escaped != nil {
+		t.Errorf("expected no escaped strings before the string is written")
+	}
+
+	pkgNames := map[*packageContext]string{}
+	testCases := []struct {
+		escaper  *strings.Replacer
+		expected string
+	}{
+		{defaultEscaper, "a b:${namespace.v}c d:"},
+		{inputEscaper, "a$ b:${namespace.v}c$ d:"},
+		{outputEscaper, "a$ b$:${namespace.v}c$ d$:"},
+	}
+	for _, testCase := range testCases {
+		for i := 0; i < 2; i++ {
+			if got := ninjaStr.ValueWithEscaper(pkgNames, testCase.escaper); got != testCase.expected {
+				t.Errorf("expected %q, got %q", testCase.expected, got)
+			}
+		}
+	}
+
+	if len(ninjaStr.template.escaped) != len(testCases) {
+		t.Errorf("expected the escaped strings to be cached for %d escapers, got %d",
+			len(testCases), len(ninjaStr.template.escaped))
+	}
+}
@@ -33,6 +33,8 @@ type ninjaWriter struct {
 	writer io.Writer
 
 	justDidBlankLine bool // true if the last operation was a BlankLine
+
+	startSegment func(name string) // set by Context.BuildFileSegments
 }
 
 func newNinjaWriter(writer io.Writer) *ninjaWriter {
@@ -91,12 +93,26 @@ func (n *ninjaWriter) Comment(comment string) error {
 	return nil
 }
 
+// Segment starts a new segment of the Ninja file called name if the file is
+// being split in segments, and does nothing otherwise.
+func (n *ninjaWriter) Segment(name string) {
+	if n.startSegment != nil {
+		n.startSegment(name)
+	}
+}
+
 func (n *ninjaWriter) Pool(name string) error {
 	n.justDidBlankLine = false
 	_, err := fmt.Fprintf(n.writer, "pool %s\n", name)
 	return err
 }
 
+func (n *ninjaWriter) Subninja(file string) error {
+	n.justDidBlankLine = false
+	_, err := fmt.Fprintf(n.writer, "subninja %s\n", file)
+	return err
+}
+
 func (n *ninjaWriter) Rule(name string) error {
 	n.justDidBlankLine = false
 	_, err := fmt.Fprintf(n.writer, "rule %s\n", name)
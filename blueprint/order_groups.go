@@ -0,0 +1,202 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// orderGroupsDir is the directory in the Ninja build directory that the phony
+// targets of the order groups are named after.
+const orderGroupsDir = ".order_groups"
+
+var orderGroupNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.-]*$`)
+
+// checkOrderGroupNames returns an error if the OrderGroup or After params
+// contain an invalid order group name.
+func checkOrderGroupNames(params *BuildParams) error {
+	names := params.After
+	if params.OrderGroup != "" {
+		names = append([]string{params.OrderGroup}, names...)
+	}
+	for _, name := range names {
+		if !orderGroupNameRegexp.MatchString(name) {
+			return fmt.Errorf("invalid order group name %q", name)
+		}
+	}
+	return nil
+}
+
+// resolveOrderGroups adds a phony build statement for every order group of
+// each module and singleton, which depends on the outputs of the build
+// statements in the group, and adds it to the order-only dependencies of the
+// build statements that are built after the group.  It returns an error for
+// every build statement that is built after a group that doesn't exist, and
+// for groups that are built after themselves.
+func (c *Context) resolveOrderGroups() []error {
+	buildDir, err := c.NinjaBuildDir()
+	if err != nil {
+		return []error{err}
+	}
+
+	var errs []error
+	for _, module := range c.modulesSorted {
+		if len(errs) >= maxErrors {
+			break
+		}
+
+		dir := path.Join(buildDir, orderGroupsDir, "modules",
+			filepath.ToSlash(filepath.Dir(module.relBlueprintsFile)), module.Name(), module.variantName)
+		for _, err := range resolveLocalOrderGroups(&module.actionDefs, dir) {
+			errs = append(errs, &ModuleError{
+				BlueprintError: BlueprintError{
+					Err: err,
+					Pos: module.pos,
+				},
+				module: module,
+			})
+		}
+	}
+
+	for _, info := range c.singletonInfo {
+		if len(errs) >= maxErrors {
+			break
+		}
+
+		dir := path.Join(buildDir, orderGroupsDir, "singletons", info.name)
+		for _, err := range resolveLocalOrderGroups(&info.actionDefs, dir) {
+			errs = append(errs, fmt.Errorf("singleton %q: %s", info.name, err))
+		}
+	}
+
+	return errs
+}
+
+// resolveLocalOrderGroups resolves the order groups of the build statements of
+// a single module or singleton, whose phony targets are named after the group
+// in dir.
+func resolveLocalOrderGroups(defs *localBuildActions, dir string) []error {
+	var groups []string
+	outputs := make(map[string][]*ninjaString)
+	after := make(map[string][]string)
+	used := false
+
+	for _, def := range defs.buildDefs {
+		if len(def.After) > 0 {
+			used = true
+		}
+		if def.OrderGroup == "" {
+			continue
+		}
+		if _, ok := outputs[def.OrderGroup]; !ok {
+			groups = append(groups, def.OrderGroup)
+		}
+		outputs[def.OrderGroup] = append(append(outputs[def.OrderGroup],
+			def.Outputs...), def.ImplicitOutputs...)
+		after[def.OrderGroup] = append(after[def.OrderGroup], def.After...)
+	}
+
+	if !used {
+		return nil
+	}
+
+	var errs []error
+	for _, def := range defs.buildDefs {
+		for _, group := range def.After {
+			if _, ok := outputs[group]; !ok {
+				errs = append(errs, fmt.Errorf("%q is built after undefined order group %q",
+					def.Rule.name(), group))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	if cycle := orderGroupCycle(groups, after); cycle != nil {
+		return []error{fmt.Errorf("order groups are built after each other: %s",
+			strings.Join(cycle, " -> "))}
+	}
+
+	targets := make(map[string]*ninjaString)
+	for _, def := range defs.buildDefs {
+		for _, group := range def.After {
+			target, ok := targets[group]
+			if !ok {
+				target = simpleNinjaString(path.Join(dir, group))
+				targets[group] = target
+				defs.buildDefs = append(defs.buildDefs, &buildDef{
+					Comment:   fmt.Sprintf("Order group %q", group),
+					Rule:      Phony,
+					Outputs:   []*ninjaString{target},
+					Implicits: outputs[group],
+					Optional:  true,
+				})
+			}
+			def.OrderOnly = append(def.OrderOnly, target)
+		}
+	}
+
+	return nil
+}
+
+// orderGroupCycle returns the groups of a cycle in the graph of the groups
+// that are built after each other, starting and ending with the same group,
+// or nil if there is none.
+func orderGroupCycle(groups []string, after map[string][]string) []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	var stack []string
+
+	var visit func(group string) []string
+	visit = func(group string) []string {
+		switch state[group] {
+		case visited:
+			return nil
+		case visiting:
+			for i, g := range stack {
+				if g == group {
+					return append(append([]string(nil), stack[i:]...), group)
+				}
+			}
+		}
+
+		state[group] = visiting
+		stack = append(stack, group)
+		for _, dep := range after[group] {
+			if cycle := visit(dep); cycle != nil {
+				return cycle
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[group] = visited
+		return nil
+	}
+
+	for _, group := range groups {
+		if cycle := visit(group); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// orderGroupsSingleton builds the given build statements.
+type orderGroupsSingleton struct {
+	params []BuildParams
+}
+
+func (s *orderGroupsSingleton) GenerateBuildActions(ctx SingletonContext) {
+	for _, params := range s.params {
+		ctx.Build(verifyTestPctx, params)
+	}
+}
+
+func TestOrderGroups(t *testing.T) {
+	testCases := []struct {
+		name     string
+		params   []BuildParams
+		expected []string
+		err      string
+	}{
+		{
+			name: "after",
+			params: []BuildParams{
+				{Rule: verifyTestTouch, Outputs: []string{"${outDir}/gen.h"}, OrderGroup: "gen"},
+				{Rule: verifyTestTouch, Outputs: []string{"out/gen.c"}, ImplicitOutputs: []string{"out/gen.d"},
+					OrderGroup: "gen"},
+				{Rule: verifyTestTouch, Outputs: []string{"out/a.o"}, OrderGroup: "compile", After: []string{"gen"}},
+				{Rule: verifyTestTouch, Outputs: []string{"out/b.o"}, OrderOnly: []string{"out/dir"},
+					OrderGroup: "compile", After: []string{"gen"}},
+				{Rule: verifyTestTouch, Outputs: []string{"out/lib.a"}, After: []string{"compile"}},
+			},
+			expected: []string{
+				"build out/a.o: g.verifytest.touch || .order_groups/singletons/groups/gen\n",
+				"build out/b.o: g.verifytest.touch || out/dir $\n" +
+					"        .order_groups/singletons/groups/gen\n",
+				"build out/lib.a: g.verifytest.touch || .order_groups/singletons/groups/compile\n",
+				"# Order group \"gen\"\n" +
+					"build .order_groups/singletons/groups/gen: phony | $\n" +
+					"        ${g.verifytest.outDir}/gen.h out/gen.c out/gen.d\n",
+				"# Order group \"compile\"\n" +
+					"build .order_groups/singletons/groups/compile: phony | out/a.o out/b.o\n",
+			},
+		},
+		{
+			name: "undefined",
+			params: []BuildParams{
+				{Rule: verifyTestTouch, Outputs: []string{"out/a.o"}, After: []string{"gen"}},
+			},
+			err: `singleton "groups": "touch" is built after undefined order group "gen"`,
+		},
+		{
+			name: "cycle",
+			params: []BuildParams{
+				{Rule: verifyTestTouch, Outputs: []string{"out/a"}, OrderGroup: "a", After: []string{"b"}},
+				{Rule: verifyTestTouch, Outputs: []string{"out/b"}, OrderGroup: "b", After: []string{"c"}},
+				{Rule: verifyTestTouch, Outputs: []string{"out/c"}, OrderGroup: "c", After: []string{"a"}},
+			},
+			err: `singleton "groups": order groups are built after each other: a -> b -> c -> a`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctx := NewContext()
+			ctx.RegisterSingletonType("groups", func() Singleton {
+				return &orderGroupsSingleton{testCase.params}
+			})
+			ctx.MockFileSystem(map[string][]byte{
+				"Blueprints": nil,
+			})
+
+			_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+			if len(errs) == 0 {
+				_, errs = ctx.PrepareBuildActions(nil)
+			}
+
+			if testCase.err != "" {
+				if len(errs) != 1 || errs[0].Error() != testCase.err {
+					t.Fatalf("expected error %q, got %q", testCase.err, errs)
+				}
+				return
+			}
+			if len(errs) > 0 {
+				t.Fatalf("unexpected errors: %q", errs)
+			}
+
+			buf := &bytes.Buffer{}
+			if err := ctx.WriteBuildFile(buf); err != nil {
+				t.Fatalf("unexpected error writing build file: %s", err)
+			}
+			out := buf.String()
+			for _, expected := range testCase.expected {
+				if !strings.Contains(out, expected) {
+					t.Errorf("missing %q in:\n%s", expected, out)
+				}
+			}
+		})
+	}
+}
+
+func TestOrderGroupNames(t *testing.T) {
+	for _, name := range []string{"", ".", "..", "a/b", "a b", "$a"} {
+		err := checkOrderGroupNames(&BuildParams{After: []string{name}})
+		if err == nil {
+			t.Errorf("expected an error for order group name %q", name)
+		}
+	}
+	for _, name := range []string{"gen", "gen.srcs", "_compile-2"} {
+		err := checkOrderGroupNames(&BuildParams{OrderGroup: name})
+		if err != nil {
+			t.Errorf("unexpected error for order group name %q: %s", name, err)
+		}
+	}
+}
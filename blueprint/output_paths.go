@@ -0,0 +1,107 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/blueprint/pathtools"
+)
+
+// SetOutputPathPolicy sets the policy that WriteBuildFile enforces on the
+// outputs and implicit outputs of every build statement, after expanding the
+// Ninja variables they reference.  WriteBuildFile returns a
+// *pathtools.OutputPathError for the first output that violates the policy.
+// Output paths are not checked if policy is nil, which is the default.
+func (c *Context) SetOutputPathPolicy(policy *pathtools.OutputPathPolicy) {
+	c.outputPathPolicy = policy
+}
+
+func (c *Context) checkOutputPaths() error {
+	if c.outputPathPolicy == nil {
+		return nil
+	}
+
+	checker := c.outputPathPolicy.NewChecker()
+
+	modules := make([]*moduleInfo, 0, len(c.moduleInfo))
+	for _, module := range c.moduleInfo {
+		modules = append(modules, module)
+	}
+	sort.Sort(moduleSorter(modules))
+
+	for _, module := range modules {
+		err := c.checkLocalOutputPaths(checker, &module.actionDefs, module.String())
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, info := range c.singletonInfo {
+		err := c.checkLocalOutputPaths(checker, &info.actionDefs,
+			fmt.Sprintf("singleton %q", info.name))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Context) checkLocalOutputPaths(checker *pathtools.OutputPathChecker,
+	defs *localBuildActions, owner string) error {
+
+	variables, err := c.localVariableValues(defs)
+	if err != nil {
+		return err
+	}
+
+	for _, buildDef := range defs.buildDefs {
+		for _, output := range append(buildDef.Outputs, buildDef.ImplicitOutputs...) {
+			path, err := output.Eval(variables)
+			if err != nil {
+				return fmt.Errorf("%s: %s", owner, err)
+			}
+			err = checker.Check(path, owner)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// localVariableValues returns the values of the global variables and the local
+// variables of defs, to evaluate the paths of the build statements in defs.
+func (c *Context) localVariableValues(defs *localBuildActions) (map[Variable]*ninjaString, error) {
+	if len(defs.variables) == 0 {
+		return c.globalVariables, nil
+	}
+
+	variables := make(map[Variable]*ninjaString, len(c.globalVariables)+len(defs.variables))
+	for v, value := range c.globalVariables {
+		variables[v] = value
+	}
+	for _, v := range defs.variables {
+		value, err := v.value(nil)
+		if err != nil {
+			return nil, err
+		}
+		variables[v] = value
+	}
+	return variables, nil
+}
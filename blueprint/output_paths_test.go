@@ -0,0 +1,97 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/blueprint/pathtools"
+)
+
+var (
+	outputPathsTestPctx = NewPackageContext("github.com/google/blueprint/output_paths_test")
+
+	_ = outputPathsTestPctx.StaticVariable("outDir", "/abs/out")
+)
+
+type outputPathsSingleton struct {
+	outputs []string
+}
+
+func (s *outputPathsSingleton) GenerateBuildActions(ctx SingletonContext) {
+	for _, output := range s.outputs {
+		ctx.Build(outputPathsTestPctx, BuildParams{
+			Rule:    Phony,
+			Outputs: []string{output},
+		})
+	}
+}
+
+func TestOutputPathPolicy(t *testing.T) {
+	testCases := []struct {
+		outputs []string
+		policy  *pathtools.OutputPathPolicy
+		err     string
+	}{
+		{
+			outputs: []string{"a", "${outDir}/a"},
+			err:     `singleton "outputs": invalid output path "/abs/out/a": absolute paths are not allowed`,
+		},
+		{
+			outputs: []string{"a", "${outDir}/a"},
+			policy:  &pathtools.OutputPathPolicy{AllowedAbsoluteDirs: []string{"/abs/out"}},
+		},
+		{
+			outputs: []string{"a/b", "a/./b"},
+			err:     `singleton "outputs": invalid output path "a/./b": also declared by singleton "outputs"`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		ctx := NewContext()
+		ctx.MockFileSystem(map[string][]byte{
+			"Blueprints": nil,
+		})
+		ctx.RegisterSingletonType("outputs", func() Singleton {
+			return &outputPathsSingleton{outputs: testCase.outputs}
+		})
+
+		policy := testCase.policy
+		if policy == nil {
+			policy = &pathtools.OutputPathPolicy{}
+		}
+		ctx.SetOutputPathPolicy(policy)
+
+		_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+		if len(errs) == 0 {
+			_, errs = ctx.PrepareBuildActions(nil)
+		}
+		if len(errs) > 0 {
+			t.Fatalf("unexpected errors: %s", errs)
+		}
+
+		err := ctx.WriteBuildFile(&bytes.Buffer{})
+		if testCase.err == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected error %s", testCase.outputs, err)
+			}
+		} else if err == nil {
+			t.Errorf("%q: expected error %q", testCase.outputs, testCase.err)
+		} else if err.Error() != testCase.err {
+			t.Errorf("%q: expected error %q, got %q", testCase.outputs, testCase.err, err.Error())
+		}
+	}
+}
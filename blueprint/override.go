@@ -0,0 +1,275 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"text/scanner"
+
+	"github.com/google/blueprint/parser"
+)
+
+// A PropertyOverride replaces the value of a property of a module in the
+// Blueprints files.
+type PropertyOverride struct {
+	// Module is the name of the module.
+	Module string
+
+	// Property is the name of the property, with the names of nested
+	// properties separated by ".".
+	Property string
+
+	// Value is the new value of the property in the Blueprints language, for
+	// example "true", `"-O0"` or `["a.c", "b.c"]`.
+	Value string
+}
+
+// ParsePropertyOverride parses a PropertyOverride of the form
+// module:property=value.
+func ParsePropertyOverride(s string) (PropertyOverride, error) {
+	colon := strings.Index(s, ":")
+	equals := strings.Index(s, "=")
+	if colon <= 0 || equals < colon+2 {
+		return PropertyOverride{}, fmt.Errorf("invalid property override %q, expected module:property=value", s)
+	}
+
+	return PropertyOverride{
+		Module:   s[:colon],
+		Property: s[colon+1 : equals],
+		Value:    s[equals+1:],
+	}, nil
+}
+
+func (o PropertyOverride) String() string {
+	return o.Module + ":" + o.Property + "=" + o.Value
+}
+
+// An AppliedPropertyOverride is a PropertyOverride that was applied to a
+// module definition.
+type AppliedPropertyOverride struct {
+	PropertyOverride
+
+	// Pos is the position of the module definition.
+	Pos scanner.Position
+
+	// Replaced is true if the property was set in the module definition, and
+	// false if the override added it.
+	Replaced bool
+}
+
+type propertyOverride struct {
+	PropertyOverride
+	value parser.Expression
+}
+
+type propertyOverrides struct {
+	byModule map[string][]*propertyOverride
+
+	lock    sync.Mutex
+	applied []AppliedPropertyOverride
+}
+
+// SetPropertyOverrides sets property values that replace the values in the
+// Blueprints files of the named modules, or are added to them, before the
+// properties are unpacked, so the values are checked against the property
+// types like values in Blueprints files.  Every override must match a module
+// in the Blueprints files, or ParseBlueprintsFiles returns an error.  An error
+// is returned if a value is not a valid expression.  SetPropertyOverrides must
+// be called before ParseBlueprintsFiles.
+func (c *Context) SetPropertyOverrides(overrides []PropertyOverride) error {
+	if len(overrides) == 0 {
+		c.propertyOverrides = nil
+		return nil
+	}
+
+	o := &propertyOverrides{
+		byModule: make(map[string][]*propertyOverride),
+	}
+
+	for _, override := range overrides {
+		value, err := parseOverrideValue(override)
+		if err != nil {
+			return err
+		}
+		o.byModule[override.Module] = append(o.byModule[override.Module], &propertyOverride{
+			PropertyOverride: override,
+			value:            value,
+		})
+	}
+
+	c.propertyOverrides = o
+	return nil
+}
+
+// AppliedPropertyOverrides returns the property overrides that were applied by
+// ParseBlueprintsFiles, sorted by module and property.
+func (c *Context) AppliedPropertyOverrides() []AppliedPropertyOverride {
+	o := c.propertyOverrides
+	if o == nil {
+		return nil
+	}
+
+	o.lock.Lock()
+	applied := append([]AppliedPropertyOverride(nil), o.applied...)
+	o.lock.Unlock()
+
+	sort.Sort(appliedOverrideSorter(applied))
+	return applied
+}
+
+// parseOverrideValue parses the value of override as the value of an
+// assignment in a Blueprints file.
+func parseOverrideValue(override PropertyOverride) (parser.Expression, error) {
+	filename := "<override " + override.String() + ">"
+	file, errs := parser.ParseAndEval(filename, strings.NewReader("value = "+override.Value),
+		parser.NewScope(nil))
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid value in property override %q: %s", override, errs[0])
+	}
+	if len(file.Defs) != 1 {
+		return nil, fmt.Errorf("invalid value in property override %q", override)
+	}
+	return file.Defs[0].(*parser.Assignment).Value, nil
+}
+
+// apply returns the properties of moduleDef with the overrides for the module
+// applied.
+func (o *propertyOverrides) apply(moduleDef *parser.Module,
+	propertyDefs []*parser.Property) []*parser.Property {
+
+	name := ""
+	for _, prop := range propertyDefs {
+		if prop.Name == "name" {
+			if s, ok := prop.Value.Eval().(*parser.String); ok {
+				name = s.Value
+			}
+		}
+	}
+
+	overrides := o.byModule[name]
+	if len(overrides) == 0 {
+		return propertyDefs
+	}
+
+	for _, override := range overrides {
+		var replaced bool
+		propertyDefs, replaced = overrideProperty(propertyDefs,
+			strings.Split(override.Property, "."), override.value)
+
+		o.lock.Lock()
+		o.applied = append(o.applied, AppliedPropertyOverride{
+			PropertyOverride: override.PropertyOverride,
+			Pos:              moduleDef.TypePos,
+			Replaced:         replaced,
+		})
+		o.lock.Unlock()
+	}
+
+	return propertyDefs
+}
+
+// unmatchedErrors returns an error for each override whose module was not
+// found.
+func (o *propertyOverrides) unmatchedErrors() []error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	matched := make(map[string]bool)
+	for _, applied := range o.applied {
+		matched[applied.Module] = true
+	}
+
+	var errs []error
+	for module, overrides := range o.byModule {
+		if !matched[module] {
+			for _, override := range overrides {
+				errs = append(errs, fmt.Errorf("property override %q: no module named %q",
+					override, module))
+			}
+		}
+	}
+	sort.Sort(errorSorter(errs))
+	return errs
+}
+
+// overrideProperty returns a copy of props with the property at path set to
+// value, creating the maps that contain it if necessary, and whether the
+// property was already set.  The parsed properties are not modified.
+func overrideProperty(props []*parser.Property, path []string,
+	value parser.Expression) ([]*parser.Property, bool) {
+
+	ret := make([]*parser.Property, 0, len(props)+1)
+	var existing *parser.Property
+	for _, prop := range props {
+		if prop.Name == path[0] && existing == nil {
+			existing = prop
+			continue
+		}
+		ret = append(ret, prop)
+	}
+
+	pos := value.Pos()
+	newProp := &parser.Property{
+		Name:     path[0],
+		NamePos:  pos,
+		ColonPos: pos,
+		Value:    value,
+	}
+	if existing != nil {
+		newProp.NamePos = existing.NamePos
+		newProp.ColonPos = existing.ColonPos
+	}
+
+	if len(path) == 1 {
+		return append(ret, newProp), existing != nil
+	}
+
+	var mapProps []*parser.Property
+	if existing != nil {
+		if m, ok := existing.Value.Eval().(*parser.Map); ok {
+			mapProps = m.Properties
+		}
+	}
+	// A nested property of a value that isn't a map replaces it, and
+	// unpacking reports the type error.
+	newProps, replaced := overrideProperty(mapProps, path[1:], value)
+	newProp.Value = &parser.Map{
+		LBracePos:  pos,
+		RBracePos:  pos,
+		Properties: newProps,
+	}
+
+	return append(ret, newProp), replaced
+}
+
+type appliedOverrideSorter []AppliedPropertyOverride
+
+func (s appliedOverrideSorter) Len() int { return len(s) }
+func (s appliedOverrideSorter) Less(i, j int) bool {
+	if s[i].Module != s[j].Module {
+		return s[i].Module < s[j].Module
+	}
+	return s[i].Property < s[j].Property
+}
+func (s appliedOverrideSorter) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+type errorSorter []error
+
+func (s errorSorter) Len() int           { return len(s) }
+func (s errorSorter) Less(i, j int) bool { return s[i].Error() < s[j].Error() }
+func (s errorSorter) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
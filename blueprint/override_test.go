@@ -0,0 +1,157 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type overrideTestModule struct {
+	SimpleName
+	properties struct {
+		Srcs    []string
+		Enabled bool
+		Nested  struct {
+			Flag  string
+			Other string
+		}
+	}
+}
+
+func newOverrideTestModule() (Module, []interface{}) {
+	m := &overrideTestModule{}
+	return m, []interface{}{&m.properties, &m.SimpleName.Properties}
+}
+
+func (m *overrideTestModule) GenerateBuildActions(ModuleContext) {
+}
+
+func parseOverrideTest(t *testing.T, overrides ...string) (*Context, []error) {
+	ctx := NewContext()
+	ctx.RegisterModuleType("override_module", newOverrideTestModule)
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			override_module {
+				name: "A",
+				srcs: ["a.c"],
+				nested: {
+					other: "o",
+				},
+			}
+
+			override_module {
+				name: "B",
+				srcs: ["b.c"],
+			}
+		`),
+	})
+
+	var parsed []PropertyOverride
+	for _, s := range overrides {
+		o, err := ParsePropertyOverride(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed = append(parsed, o)
+	}
+	if err := ctx.SetPropertyOverrides(parsed); err != nil {
+		t.Fatal(err)
+	}
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	return ctx, errs
+}
+
+func TestPropertyOverrides(t *testing.T) {
+	ctx, errs := parseOverrideTest(t,
+		`A:srcs=["x.c", "y.c"]`,
+		`A:enabled=true`,
+		`A:nested.flag="-O0"`)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	a := ctx.modulesFromName("A")[0].logicModule.(*overrideTestModule)
+	if w := []string{"x.c", "y.c"}; !reflect.DeepEqual(a.properties.Srcs, w) {
+		t.Errorf("expected srcs %q, got %q", w, a.properties.Srcs)
+	}
+	if !a.properties.Enabled {
+		t.Errorf("expected enabled to be overridden")
+	}
+	if a.properties.Nested.Flag != "-O0" || a.properties.Nested.Other != "o" {
+		t.Errorf("expected nested {-O0 o}, got %v", a.properties.Nested)
+	}
+
+	b := ctx.modulesFromName("B")[0].logicModule.(*overrideTestModule)
+	if w := []string{"b.c"}; !reflect.DeepEqual(b.properties.Srcs, w) || b.properties.Enabled {
+		t.Errorf("expected B to be unmodified, got %v", b.properties)
+	}
+
+	applied := ctx.AppliedPropertyOverrides()
+	var got []string
+	for _, o := range applied {
+		got = append(got, o.Property)
+		if o.Pos.Filename != "Blueprints" || o.Pos.Line != 2 {
+			t.Errorf("expected %s to be applied to the module at Blueprints:2, got %s", o.Property, o.Pos)
+		}
+	}
+	if w := []string{"enabled", "nested.flag", "srcs"}; !reflect.DeepEqual(got, w) {
+		t.Errorf("expected applied overrides %q, got %q", w, got)
+	}
+	if applied[0].Replaced || applied[1].Replaced || !applied[2].Replaced {
+		t.Errorf("expected only srcs to replace a property, got %v", applied)
+	}
+}
+
+func TestPropertyOverrideErrors(t *testing.T) {
+	testCases := []struct {
+		override string
+		err      string
+	}{
+		{`A:enabled="yes"`, `can't assign string value to bool property "enabled"`},
+		{`A:unknown=true`, `unrecognized property "unknown"`},
+		{`C:enabled=true`, `property override "C:enabled=true": no module named "C"`},
+	}
+
+	for _, testCase := range testCases {
+		_, errs := parseOverrideTest(t, testCase.override)
+		if len(errs) != 1 || !strings.Contains(errs[0].Error(), testCase.err) {
+			t.Errorf("%s: expected error %q, got %v", testCase.override, testCase.err, errs)
+		}
+	}
+}
+
+func TestParsePropertyOverride(t *testing.T) {
+	o, err := ParsePropertyOverride(`A:nested.flag="a=b"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := (PropertyOverride{"A", "nested.flag", `"a=b"`}); o != w {
+		t.Errorf("expected %v, got %v", w, o)
+	}
+
+	for _, s := range []string{"A", "A:=true", ":enabled=true", "A=true"} {
+		if _, err := ParsePropertyOverride(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+
+	ctx := NewContext()
+	if err := ctx.SetPropertyOverrides([]PropertyOverride{{"A", "srcs", `["a.c"`}}); err == nil {
+		t.Errorf("expected an error for an invalid value")
+	}
+}
@@ -0,0 +1,309 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/google/blueprint/proptools"
+)
+
+// PackageProperties are the properties of the built-in "package" module type.
+type PackageProperties struct {
+	// Default_visibility is used as the visibility property of the modules in
+	// the directory that don't set it.
+	Default_visibility []string
+
+	// Default_applicable_licenses is used as the applicable_licenses property
+	// of the modules in the directory that don't set it.
+	Default_applicable_licenses []string
+
+	// Default_owners is used as the owners property of the modules in the
+	// directory that don't set it.
+	Default_owners []string
+}
+
+// packageDefaults maps the properties of the package module to the module
+// properties they provide defaults for.
+var packageDefaults = []struct {
+	property string
+	value    func(*PackageProperties) []string
+}{
+	{"visibility", func(p *PackageProperties) []string { return p.Default_visibility }},
+	{"applicable_licenses", func(p *PackageProperties) []string { return p.Default_applicable_licenses }},
+	{"owners", func(p *PackageProperties) []string { return p.Default_owners }},
+}
+
+// RegisterPackageModuleType registers the built-in "package" module type.  A
+// package module provides defaults for the modules defined in the same
+// directory, and may be defined at most once per directory:
+//
+//	package {
+//	    default_visibility: ["//visibility:private"],
+//	    default_applicable_licenses: ["my_license"],
+//	    default_owners: ["team@example.com"],
+//	}
+//
+// After the Blueprints files are parsed, the visibility, applicable_licenses
+// and owners properties of every module in the directory and in the
+// subdirectories without a package module of their own that doesn't set them
+// are set to the defaults, if the module has a []string property with that
+// name.  Package modules are not added to the module graph, so they can't be
+// depended on and are not visited by mutators.
+//
+// The visibility property of a module limits the directories of the modules
+// that may depend on it, which ResolveDependencies checks.  It is a list of
+// rules, any of which can allow a dependency:
+//
+//	"//visibility:public"           any directory, the default
+//	"//visibility:private"          the directory of the module
+//	"//dir:__pkg__"                 the directory dir
+//	"//dir:__subpackages__"         the directory dir and its subdirectories
+//	":__pkg__", ":__subpackages__"  the directory of the module, and with
+//	                                its subdirectories
+func (c *Context) RegisterPackageModuleType() {
+	c.RegisterModuleType("package", newPackageModule)
+	c.packages = make(map[string]*moduleInfo)
+}
+
+type packageModule struct {
+	properties PackageProperties
+}
+
+func newPackageModule() (Module, []interface{}) {
+	m := &packageModule{}
+	return m, []interface{}{&m.properties}
+}
+
+func (m *packageModule) Name() string {
+	return "package"
+}
+
+func (m *packageModule) GenerateBuildActions(ctx ModuleContext) {}
+
+// addPackage records the package module for its directory.  It is called from
+// ParseBlueprintsFiles instead of addModule.
+func (c *Context) addPackage(module *moduleInfo) []error {
+	dir := filepath.Dir(module.relBlueprintsFile)
+	if prev, ok := c.packages[dir]; ok {
+		return []error{
+			&BlueprintError{
+				Err: fmt.Errorf("package already defined in directory %q", dir),
+				Pos: module.pos,
+			},
+			&BlueprintError{
+				Err: fmt.Errorf("<-- previous definition here"),
+				Pos: prev.pos,
+			},
+		}
+	}
+	c.packages[dir] = module
+	return nil
+}
+
+// packageForDir returns the package module of the directory, or of its
+// closest parent directory that has one.
+func (c *Context) packageForDir(dir string) *moduleInfo {
+	for {
+		if pkg := c.packages[dir]; pkg != nil {
+			return pkg
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil
+		}
+		dir = parent
+	}
+}
+
+// applyPackageDefaults sets the properties of each module that were not set in
+// its Blueprints file to the defaults of the closest package module.
+func (c *Context) applyPackageDefaults() []error {
+	var errs []error
+
+	for _, group := range c.moduleGroups {
+		for _, module := range group.modules {
+			pkg := c.packageForDir(filepath.Dir(module.relBlueprintsFile))
+			if pkg == nil {
+				continue
+			}
+			pkgProps := &pkg.logicModule.(*packageModule).properties
+
+			for _, d := range packageDefaults {
+				value := d.value(pkgProps)
+				if value == nil {
+					continue
+				}
+				if _, set := module.propertyPos[d.property]; set {
+					continue
+				}
+				err := setStringListProperty(module.moduleProperties, d.property, value)
+				if err != nil {
+					errs = append(errs, &ModuleError{
+						BlueprintError: BlueprintError{
+							Err: fmt.Errorf("can't apply package default for %q: %s", d.property, err),
+							Pos: module.pos,
+						},
+						module: module,
+					})
+				}
+			}
+		}
+	}
+
+	return errs
+}
+
+// setStringListProperty sets the top level property with the given name in
+// each of the property structs to a copy of value.  Property structs without
+// the property are ignored, properties that are not []string are an error.
+func setStringListProperty(propertyStructs []interface{}, name string, value []string) error {
+	for _, props := range propertyStructs {
+		structValue := reflect.ValueOf(props).Elem()
+		structType := structValue.Type()
+		for i := 0; i < structValue.NumField(); i++ {
+			field := structType.Field(i)
+			if field.PkgPath != "" || proptools.PropertyNameForField(field.Name) != name {
+				continue
+			}
+			if field.Type != reflect.TypeOf([]string(nil)) {
+				return fmt.Errorf("property has type %s, expected []string", field.Type)
+			}
+			structValue.Field(i).Set(reflect.ValueOf(append([]string(nil), value...)))
+		}
+	}
+	return nil
+}
+
+// getStringListProperty returns the value of the top level []string property
+// with the given name in the first of the property structs that has it.
+func getStringListProperty(propertyStructs []interface{}, name string) []string {
+	for _, props := range propertyStructs {
+		structValue := reflect.ValueOf(props).Elem()
+		structType := structValue.Type()
+		for i := 0; i < structValue.NumField(); i++ {
+			field := structType.Field(i)
+			if field.PkgPath != "" || proptools.PropertyNameForField(field.Name) != name {
+				continue
+			}
+			if value, ok := structValue.Field(i).Interface().([]string); ok {
+				return value
+			}
+		}
+	}
+	return nil
+}
+
+// checkVisibility returns an error for each pair of module groups where a
+// variant of the first one depends on a variant of the second one that is not
+// visible to the directory of the first one.
+func (c *Context) checkVisibility() []error {
+	var errs []error
+
+	type edge struct {
+		from, to *moduleGroup
+	}
+	checked := make(map[edge]bool)
+	invalid := make(map[*moduleGroup]bool)
+
+	for _, module := range c.modulesSorted {
+		dir := filepath.Dir(module.relBlueprintsFile)
+		for _, dep := range module.directDeps {
+			e := edge{module.group, dep.module.group}
+			if e.from == e.to || checked[e] {
+				continue
+			}
+			checked[e] = true
+
+			depDir := filepath.Dir(dep.module.relBlueprintsFile)
+			rules := getStringListProperty(dep.module.moduleProperties, "visibility")
+			visible, err := isVisible(rules, depDir, dir)
+			if err != nil {
+				if !invalid[e.to] {
+					invalid[e.to] = true
+					errs = append(errs, &ModuleError{
+						BlueprintError: BlueprintError{
+							Err: err,
+							Pos: dep.module.pos,
+						},
+						module: dep.module,
+					})
+				}
+			} else if !visible {
+				errs = append(errs, &ModuleError{
+					BlueprintError: BlueprintError{
+						Err: fmt.Errorf("depends on %q, which is not visible to directory %q",
+							dep.module.Name(), dir),
+						Pos: module.pos,
+					},
+					module: module,
+				})
+			}
+			if len(errs) >= maxErrors {
+				return errs
+			}
+		}
+	}
+
+	return errs
+}
+
+// isVisible returns true if the visibility rules of a module in depDir allow a
+// module in dir to depend on it.  A module is always visible in its own
+// directory.
+func isVisible(rules []string, depDir, dir string) (bool, error) {
+	if len(rules) == 0 || dir == depDir {
+		return true, nil
+	}
+
+	visible := false
+	for _, rule := range rules {
+		switch rule {
+		case "//visibility:public":
+			visible = true
+			continue
+		case "//visibility:private":
+			continue
+		}
+
+		var ruleDir, target string
+		if i := strings.LastIndexByte(rule, ':'); i >= 0 {
+			ruleDir, target = rule[:i], rule[i+1:]
+		}
+		switch {
+		case ruleDir == "":
+			ruleDir = depDir
+		case strings.HasPrefix(ruleDir, "//"):
+			ruleDir = filepath.Clean("./" + ruleDir[2:])
+		default:
+			return false, fmt.Errorf("invalid visibility rule %q", rule)
+		}
+
+		switch target {
+		case "__pkg__":
+			visible = visible || dir == ruleDir
+		case "__subpackages__":
+			visible = visible || ruleDir == "." || dir == ruleDir ||
+				strings.HasPrefix(dir, ruleDir+string(filepath.Separator))
+		default:
+			return false, fmt.Errorf("invalid visibility rule %q", rule)
+		}
+	}
+
+	return visible, nil
+}
@@ -0,0 +1,253 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+type packagedModule struct {
+	SimpleName
+	properties struct {
+		Visibility          []string
+		Applicable_licenses []string
+		Deps                []string
+	}
+}
+
+func newPackagedModule() (Module, []interface{}) {
+	m := &packagedModule{}
+	return m, []interface{}{&m.properties, &m.SimpleName.Properties}
+}
+
+func (m *packagedModule) DynamicDependencies(ctx DynamicDependerModuleContext) []string {
+	return m.properties.Deps
+}
+
+func (m *packagedModule) GenerateBuildActions(ctx ModuleContext) {}
+
+func TestPackageDefaults(t *testing.T) {
+	ctx := NewContext()
+	ctx.RegisterPackageModuleType()
+	ctx.RegisterModuleType("packaged_module", newPackagedModule)
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			subdirs = ["*"]
+		`),
+		"a/Blueprints": []byte(`
+			package {
+			    default_visibility: ["//visibility:private"],
+			    default_applicable_licenses: ["license"],
+			    default_owners: ["owner"],
+			}
+
+			packaged_module {
+			    name: "A",
+			}
+
+			packaged_module {
+			    name: "B",
+			    visibility: ["//visibility:public"],
+			}
+
+			subdirs = ["sub"]
+		`),
+		"a/sub/Blueprints": []byte(`
+			packaged_module {
+			    name: "D",
+			}
+		`),
+		"c/Blueprints": []byte(`
+			packaged_module {
+			    name: "C",
+			}
+		`),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+
+	testCases := []struct {
+		name                string
+		visibility          []string
+		applicable_licenses []string
+	}{
+		{"A", []string{"//visibility:private"}, []string{"license"}},
+		{"B", []string{"//visibility:public"}, []string{"license"}},
+		{"C", nil, nil},
+		{"D", []string{"//visibility:private"}, []string{"license"}},
+	}
+
+	for _, testCase := range testCases {
+		m := ctx.modulesFromName(testCase.name)[0].logicModule.(*packagedModule)
+		if !reflect.DeepEqual(m.properties.Visibility, testCase.visibility) {
+			t.Errorf("incorrect visibility for %s: %q", testCase.name, m.properties.Visibility)
+		}
+		if !reflect.DeepEqual(m.properties.Applicable_licenses, testCase.applicable_licenses) {
+			t.Errorf("incorrect applicable_licenses for %s: %q", testCase.name,
+				m.properties.Applicable_licenses)
+		}
+	}
+}
+
+func TestPackageDefinedTwice(t *testing.T) {
+	ctx := NewContext()
+	ctx.RegisterPackageModuleType()
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			package {}
+
+			package {
+			    default_owners: ["owner"],
+			}
+		`),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+
+	expected := []string{
+		`Blueprints:4:4: package already defined in directory "."`,
+		`Blueprints:2:4: <-- previous definition here`,
+	}
+	var got []string
+	for _, err := range errs {
+		got = append(got, err.Error())
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("incorrect errors:")
+		t.Errorf("  expected: %q", expected)
+		t.Errorf("       got: %q", got)
+	}
+}
+
+func TestPackageVisibility(t *testing.T) {
+	ctx := NewContext()
+	ctx.RegisterPackageModuleType()
+	ctx.RegisterModuleType("packaged_module", newPackagedModule)
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			subdirs = ["*"]
+		`),
+		"a/Blueprints": []byte(`
+			package {
+			    default_visibility: ["//visibility:private"],
+			}
+
+			packaged_module {
+			    name: "A",
+			}
+
+			packaged_module {
+			    name: "A_user",
+			    deps: ["A", "A_pkg", "A_subpackages"],
+			}
+
+			packaged_module {
+			    name: "A_pkg",
+			    visibility: ["//b:__pkg__"],
+			}
+
+			packaged_module {
+			    name: "A_subpackages",
+			    visibility: [":__subpackages__"],
+			}
+
+			subdirs = ["sub"]
+		`),
+		"a/sub/Blueprints": []byte(`
+			packaged_module {
+			    name: "S",
+			    deps: ["A", "A_subpackages"],
+			}
+		`),
+		"b/Blueprints": []byte(`
+			packaged_module {
+			    name: "B",
+			    deps: ["A", "A_pkg", "A_subpackages", "C", "P"],
+			}
+		`),
+		"c/Blueprints": []byte(`
+			packaged_module {
+			    name: "C",
+			    visibility: ["//visibility:public", "other"],
+			}
+
+			packaged_module {
+			    name: "P",
+			    visibility: ["//visibility:public"],
+			}
+		`),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) == 0 {
+		errs = ctx.ResolveDependencies(nil)
+	}
+
+	expected := []string{
+		`b/Blueprints:2:4: module "B": depends on "A", which is not visible to directory "b"`,
+		`b/Blueprints:2:4: module "B": depends on "A_subpackages", which is not visible to directory "b"`,
+		`a/sub/Blueprints:2:4: module "S": depends on "A", which is not visible to directory "a/sub"`,
+		`c/Blueprints:2:4: module "C": invalid visibility rule "other"`,
+	}
+	sort.Strings(expected)
+
+	var got []string
+	for _, err := range errs {
+		got = append(got, err.Error())
+	}
+	sort.Strings(got)
+
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("incorrect errors:")
+		t.Errorf("  expected: %q", expected)
+		t.Errorf("       got: %q", got)
+	}
+}
+
+func TestIsVisible(t *testing.T) {
+	testCases := []struct {
+		rules   []string
+		depDir  string
+		dir     string
+		visible bool
+	}{
+		{nil, "a", "b", true},
+		{[]string{"//visibility:private"}, "a", "a", true},
+		{[]string{"//visibility:private"}, "a", "b", false},
+		{[]string{"//visibility:private", "//b:__pkg__"}, "a", "b", true},
+		{[]string{"//b:__pkg__"}, "a", "b/c", false},
+		{[]string{"//b:__subpackages__"}, "a", "b/c", true},
+		{[]string{"//b:__subpackages__"}, "a", "bc", false},
+		{[]string{"//:__subpackages__"}, "a", "b", true},
+		{[]string{"//:__pkg__"}, "a", ".", true},
+		{[]string{":__subpackages__"}, "a", "a/b", true},
+		{[]string{":__pkg__"}, "a", "a/b", false},
+	}
+
+	for _, testCase := range testCases {
+		visible, err := isVisible(testCase.rules, testCase.depDir, testCase.dir)
+		if err != nil {
+			t.Errorf("%q %q %q: unexpected error %s", testCase.rules, testCase.depDir, testCase.dir, err)
+		} else if visible != testCase.visible {
+			t.Errorf("%q %q %q: expected %t, got %t", testCase.rules, testCase.depDir, testCase.dir,
+				testCase.visible, visible)
+		}
+	}
+}
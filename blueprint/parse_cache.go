@@ -0,0 +1,74 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"sync"
+
+	"github.com/google/blueprint/parser"
+)
+
+// A ParseCache holds the parsed Blueprints files of source trees, so that
+// several Contexts, for example one for each product of a release build, can
+// be populated from the same tree while reading and parsing the files only
+// once.  The Contexts that share a ParseCache must read the same files, and
+// register the same preprocessors, since the files are cached after they are
+// preprocessed.  The parsed files are not modified by the Contexts, so a
+// ParseCache can be used by several Contexts concurrently.
+type ParseCache struct {
+	lock  sync.Mutex
+	trees map[string]*parsedTree
+}
+
+type parsedTree struct {
+	files []*parser.File
+	deps  []string
+}
+
+func NewParseCache() *ParseCache {
+	return &ParseCache{
+		trees: make(map[string]*parsedTree),
+	}
+}
+
+// SetParseCache causes ParseBlueprintsFiles and WalkBlueprintsFiles to reuse
+// the Blueprints files parsed by a previous Context that used the same
+// ParseCache and root file, and to store the files they parse in it otherwise.
+// Files that fail to parse are not stored.  Unused variables can't be tracked
+// in the files reused from the cache.
+func (c *Context) SetParseCache(cache *ParseCache) {
+	c.parseCache = cache
+}
+
+func (p *ParseCache) get(rootFile string) ([]*parser.File, []string, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	tree, ok := p.trees[rootFile]
+	if !ok {
+		return nil, nil, false
+	}
+	return tree.files, append([]string(nil), tree.deps...), true
+}
+
+func (p *ParseCache) put(rootFile string, files []*parser.File, deps []string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.trees[rootFile] = &parsedTree{
+		files: files,
+		deps:  append([]string(nil), deps...),
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestParseCache(t *testing.T) {
+	cache := NewParseCache()
+
+	newContext := func(files map[string][]byte) *Context {
+		ctx := NewContext()
+		ctx.RegisterModuleType("foo_module", newFooModule)
+		ctx.MockFileSystem(files)
+		ctx.SetParseCache(cache)
+		return ctx
+	}
+
+	parse := func(ctx *Context) []string {
+		deps, errs := ctx.ParseBlueprintsFiles("Blueprints")
+		if len(errs) > 0 {
+			t.Fatalf("unexpected parse errors: %v", errs)
+		}
+		if errs := ctx.ResolveDependencies(nil); len(errs) > 0 {
+			t.Fatalf("unexpected errors: %v", errs)
+		}
+		return deps
+	}
+
+	first := newContext(map[string][]byte{
+		"Blueprints": []byte(`
+			subdirs = ["sub"]
+
+			foo_module {
+			    name: "A",
+			    deps: ["B"],
+			}
+		`),
+		"sub/Blueprints": []byte(`
+			foo_module {
+			    name: "B",
+			}
+		`),
+	})
+	deps := parse(first)
+
+	// The second Context can't read any files, so its modules come from the
+	// cache.
+	second := newContext(map[string][]byte{})
+	if secondDeps := parse(second); !reflect.DeepEqual(secondDeps, deps) {
+		t.Errorf("expected deps %q, got %q", deps, secondDeps)
+	}
+
+	var names []string
+	second.VisitAllModules(func(m Module) {
+		names = append(names, second.ModuleName(m))
+		if second.ModuleName(m) == "A" && len(m.(*fooModule).properties.Deps) != 1 {
+			t.Errorf("expected the properties of A from the parse cache")
+		}
+	})
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, []string{"A", "B"}) {
+		t.Errorf("expected modules B and A from the parse cache, got %q", names)
+	}
+
+	// Files that fail to parse are not cached.
+	failed := NewParseCache()
+	third := newContext(map[string][]byte{})
+	third.SetParseCache(failed)
+	if _, errs := third.ParseBlueprintsFiles("Blueprints"); len(errs) == 0 {
+		t.Errorf("expected an error reading Blueprints without the cache")
+	}
+	if len(failed.trees) != 0 {
+		t.Errorf("expected no cached files after an error, got %v", failed.trees)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"io"
+	"unsafe"
+)
+
+// nodeArenaBlockSize is the number of nodes of each type allocated at once.
+const nodeArenaBlockSize = 256
+
+// A NodeArena allocates the most common AST nodes, strings and properties, in
+// blocks instead of one at a time, which reduces the number of allocations and
+// the per object overhead when parsing many Blueprints files.  The memory of
+// a block is only freed once none of its nodes are referenced.
+//
+// A NodeArena is not safe for concurrent use.
+type NodeArena struct {
+	strings    []String
+	properties []Property
+
+	stats NodeArenaStats
+}
+
+// NodeArenaStats counts the allocations made by a NodeArena.
+type NodeArenaStats struct {
+	Nodes  int64 // number of nodes allocated from the arena
+	Blocks int64 // number of blocks allocated
+	Bytes  int64 // total size of the blocks
+}
+
+// Add adds the counters of other to s.
+func (s *NodeArenaStats) Add(other NodeArenaStats) {
+	s.Nodes += other.Nodes
+	s.Blocks += other.Blocks
+	s.Bytes += other.Bytes
+}
+
+func NewNodeArena() *NodeArena {
+	return &NodeArena{}
+}
+
+// Stats returns the allocation counters of the arena.
+func (a *NodeArena) Stats() NodeArenaStats {
+	return a.stats
+}
+
+func (a *NodeArena) newString() *String {
+	if len(a.strings) == 0 {
+		a.strings = make([]String, nodeArenaBlockSize)
+		a.stats.Blocks++
+		a.stats.Bytes += int64(unsafe.Sizeof(String{})) * nodeArenaBlockSize
+	}
+	s := &a.strings[0]
+	a.strings = a.strings[1:]
+	a.stats.Nodes++
+	return s
+}
+
+func (a *NodeArena) newProperty() *Property {
+	if len(a.properties) == 0 {
+		a.properties = make([]Property, nodeArenaBlockSize)
+		a.stats.Blocks++
+		a.stats.Bytes += int64(unsafe.Sizeof(Property{})) * nodeArenaBlockSize
+	}
+	p := &a.properties[0]
+	a.properties = a.properties[1:]
+	a.stats.Nodes++
+	return p
+}
+
+// ParseAndEvalInArena is like ParseAndEval, but allocates nodes from arena.
+func ParseAndEvalInArena(filename string, r io.Reader, scope *Scope,
+	arena *NodeArena) (file *File, errs []error) {
+
+	p := newParser(filename, r, scope)
+	p.eval = true
+	p.arena = arena
+
+	return parse(p)
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"strings"
 	"text/scanner"
+	"unicode/utf8"
 )
 
 type Node interface {
@@ -27,7 +28,7 @@ type Node interface {
 	End() scanner.Position
 }
 
-// Definition is an Assignment or a Module at the top level of a Blueprints file
+// Definition is an Assignment, a Module or a Macro at the top level of a Blueprints file
 type Definition interface {
 	Node
 	String() string
@@ -60,6 +61,9 @@ type Module struct {
 	Type    string
 	TypePos scanner.Position
 	Map
+
+	// Macro is set on the modules expanded from a macro instantiation.
+	Macro *MacroExpansion
 }
 
 func (m *Module) Copy() *Module {
@@ -296,6 +300,21 @@ type List struct {
 	LBracePos scanner.Position
 	RBracePos scanner.Position
 	Values    []Expression
+
+	// Comments holds the comments attached to the elements of Values, at the same indexes.  It
+	// is nil if no comments are attached to the elements, and may be shorter than Values.  The
+	// comments attached to the elements are not in the Comments of the File.
+	Comments []*ListElementComments
+}
+
+// ListElementComments are the comments attached to an element of a List, that are kept with the
+// element when the list is sorted or the element is removed.
+type ListElementComments struct {
+	// Before is the group of comments on the lines directly above the element, if any.
+	Before *CommentGroup
+
+	// After holds the comments on the rest of the line of the element, if any.
+	After *CommentGroup
 }
 
 func (x *List) Pos() scanner.Position { return x.LBracePos }
@@ -307,9 +326,19 @@ func (x *List) Copy() Expression {
 	for i := range ret.Values {
 		ret.Values[i] = x.Values[i].Copy()
 	}
+	ret.Comments = append([]*ListElementComments(nil), x.Comments...)
 	return &ret
 }
 
+// ElementComments returns the comments attached to element i of the list, or nil if there are
+// none.
+func (x *List) ElementComments(i int) *ListElementComments {
+	if i < len(x.Comments) {
+		return x.Comments[i]
+	}
+	return nil
+}
+
 func (x *List) Eval() Expression {
 	return x
 }
@@ -397,6 +426,13 @@ func (c Comment) End() scanner.Position {
 		pos.Offset += len(comment)
 	}
 	pos.Line += len(c.Comment) - 1
+
+	// Columns count characters, not bytes.
+	last := c.Comment[len(c.Comment)-1]
+	if len(c.Comment) > 1 {
+		pos.Column = 1
+	}
+	pos.Column += utf8.RuneCountInString(last)
 	return pos
 }
 
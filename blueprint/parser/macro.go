@@ -0,0 +1,318 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"fmt"
+	"text/scanner"
+)
+
+// A Macro is a parameterized template of module definitions at the top level
+// of a Blueprints file.  It is instantiated by a module definition with the
+// name of the macro as its type and the arguments as its properties, like
+//
+//	macro host_and_device(name, srcs = []) {
+//	    cc_library { name: name, srcs: srcs }
+//	    cc_library_host { name: name + "_host", srcs: srcs }
+//	}
+//
+//	host_and_device { name: "libfoo", srcs: ["foo.c"] }
+//
+// ParseAndEval replaces every instantiation with the modules of the body of
+// the macro.  The macro is visible to the rest of the file and to the
+// Blueprints files in its subdirs, like variables.
+//
+// Macros are hygienic: the body can only reference the parameters and the
+// variables visible where the macro is defined, which are bound when it is
+// defined, and never the variables visible where it is instantiated.
+// Parameters may not have the names of visible variables, and the body can't
+// define variables or instantiate macros.
+type Macro struct {
+	MacroPos  scanner.Position
+	Name      string
+	NamePos   scanner.Position
+	LParenPos scanner.Position
+	Params    []*MacroParam
+	RParenPos scanner.Position
+	LBracePos scanner.Position
+	Body      []*Module
+	RBracePos scanner.Position
+}
+
+// A MacroParam is a parameter of a Macro.  Default is nil for parameters that
+// must be passed to every instantiation.
+type MacroParam struct {
+	Name      string
+	NamePos   scanner.Position
+	EqualsPos scanner.Position
+	Default   Expression
+}
+
+func (m *Macro) String() string {
+	return fmt.Sprintf("macro %s@%s(%d params){%d modules}", m.Name, m.NamePos,
+		len(m.Params), len(m.Body))
+}
+
+func (m *Macro) Pos() scanner.Position { return m.MacroPos }
+func (m *Macro) End() scanner.Position { return m.RBracePos }
+
+func (m *Macro) definitionTag() {}
+
+// A MacroExpansion records the macro instantiation that a Module was expanded
+// from.
+type MacroExpansion struct {
+	// Macro is the name of the macro.
+	Macro string
+
+	// Call is the position of the type of the instantiation, which is also
+	// the TypePos of the expanded module so that errors about the module
+	// point at the instantiation.
+	Call scanner.Position
+
+	// Definition is the position of the type of the module in the body of
+	// the macro.
+	Definition scanner.Position
+}
+
+// macroKeyword starts a macro definition when it is followed by a name.
+const macroKeyword = "macro"
+
+// parseMacro parses a macro definition after the macro keyword.
+func (p *parser) parseMacro(macroPos scanner.Position) *Macro {
+	macro := &Macro{
+		MacroPos: macroPos,
+		Name:     p.scanner.TokenText(),
+		NamePos:  p.scanner.Position,
+	}
+	p.accept(scanner.Ident)
+
+	macro.LParenPos = p.scanner.Position
+	p.accept('(')
+	for p.tok == scanner.Ident {
+		param := &MacroParam{
+			Name:    p.scanner.TokenText(),
+			NamePos: p.scanner.Position,
+		}
+		p.accept(scanner.Ident)
+		if p.tok == '=' {
+			param.EqualsPos = p.scanner.Position
+			p.accept('=')
+			param.Default = p.parseExpression()
+		}
+		macro.Params = append(macro.Params, param)
+
+		if p.tok != ',' {
+			break
+		}
+		p.accept(',')
+	}
+	macro.RParenPos = p.scanner.Position
+	p.accept(')')
+
+	// The body is evaluated when the macro is instantiated, after the
+	// parameters are bound.
+	eval := p.eval
+	defer func() { p.eval = eval }()
+	p.eval = false
+	macro.LBracePos = p.scanner.Position
+	p.accept('{')
+	for p.tok == scanner.Ident {
+		typ := p.scanner.TokenText()
+		typPos := p.scanner.Position
+		p.accept(scanner.Ident)
+		if p.tok != '{' && p.tok != '(' {
+			p.errorf("expected module definition in the body of macro %q, found %s",
+				macro.Name, scanner.TokenString(p.tok))
+		}
+		macro.Body = append(macro.Body, p.parseModule(typ, typPos))
+	}
+	p.eval = eval
+	macro.RBracePos = p.scanner.Position
+	p.accept('}')
+
+	if p.eval {
+		p.checkMacro(macro)
+		if err := p.scope.AddMacro(macro); err != nil {
+			p.errorAt(macro.NamePos, "%s", err)
+		}
+	}
+
+	return macro
+}
+
+// checkMacro enforces the hygiene rules on a macro definition, and binds the
+// references to variables in its body that are not parameters.
+func (p *parser) checkMacro(macro *Macro) {
+	params := make(map[string]bool)
+	for _, param := range macro.Params {
+		if params[param.Name] {
+			p.errorAt(param.NamePos, "duplicate parameter %q of macro %q", param.Name, macro.Name)
+		}
+		if v, _ := p.scope.Get(param.Name); v != nil {
+			p.errorAt(param.NamePos, "parameter %q of macro %q hides the variable set at %s",
+				param.Name, macro.Name, v.NamePos)
+		}
+		params[param.Name] = true
+	}
+
+	for _, module := range macro.Body {
+		if p.scope.GetMacro(module.Type) != nil {
+			p.errorAt(module.TypePos, "macro %q can't be instantiated in the body of macro %q",
+				module.Type, macro.Name)
+		}
+		for _, property := range module.Properties {
+			p.bindMacroVariables(property.Value, params)
+		}
+	}
+}
+
+// bindMacroVariables sets the values of the variables referenced by e that
+// are not parameters of the macro to their values where the macro is defined.
+func (p *parser) bindMacroVariables(e Expression, params map[string]bool) {
+	switch e := e.(type) {
+	case *Variable:
+		if params[e.Name] {
+			return
+		}
+		assignment, local := p.scope.Get(e.Name)
+		if assignment == nil {
+			p.errorAt(e.NamePos, "variable %q is not set", e.Name)
+		}
+		if local {
+			assignment.Referenced = true
+		}
+		e.Value = assignment.Value
+	case *Operator:
+		p.bindMacroVariables(e.Args[0], params)
+		p.bindMacroVariables(e.Args[1], params)
+	case *List:
+		for _, value := range e.Values {
+			p.bindMacroVariables(value, params)
+		}
+	case *Map:
+		for _, property := range e.Properties {
+			p.bindMacroVariables(property.Value, params)
+		}
+	}
+}
+
+// expandMacro returns the modules of the body of macro with the properties of
+// call as the arguments.
+func (p *parser) expandMacro(macro *Macro, call *Module) []Definition {
+	args := make(map[string]Expression)
+	for _, property := range call.Properties {
+		if !macro.hasParam(property.Name) {
+			p.errorAt(property.NamePos, "macro %q has no parameter %q", macro.Name, property.Name)
+		}
+		if _, ok := args[property.Name]; ok {
+			p.errorAt(property.NamePos, "argument %q of macro %q passed twice", property.Name,
+				macro.Name)
+		}
+		args[property.Name] = property.Value
+	}
+	for _, param := range macro.Params {
+		if _, ok := args[param.Name]; ok {
+			continue
+		}
+		if param.Default == nil {
+			p.errorAt(call.TypePos, "missing argument %q of macro %q", param.Name, macro.Name)
+		}
+		args[param.Name] = param.Default
+	}
+
+	e := &macroExpander{p, macro, call, args}
+	defs := make([]Definition, 0, len(macro.Body))
+	for _, body := range macro.Body {
+		module := &Module{
+			Type:    body.Type,
+			TypePos: call.TypePos,
+			Map:     *e.expand(&body.Map).(*Map),
+			Macro: &MacroExpansion{
+				Macro:      macro.Name,
+				Call:       call.TypePos,
+				Definition: body.TypePos,
+			},
+		}
+		defs = append(defs, module)
+	}
+	return defs
+}
+
+func (m *Macro) hasParam(name string) bool {
+	for _, param := range m.Params {
+		if param.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// macroExpander evaluates the expressions in the body of a macro for an
+// instantiation.
+type macroExpander struct {
+	p     *parser
+	macro *Macro
+	call  *Module
+	args  map[string]Expression
+}
+
+// expand returns a copy of the expression e of the body of the macro with the
+// parameters replaced by the copies of their arguments, and the operators
+// evaluated again.
+func (e *macroExpander) expand(value Expression) Expression {
+	switch v := value.(type) {
+	case *Variable:
+		if v.Value == nil {
+			return e.args[v.Name].Copy()
+		}
+		return v.Copy()
+	case *Operator:
+		ret, err := e.p.evaluateOperator(e.expand(v.Args[0]), e.expand(v.Args[1]),
+			v.Operator, v.OperatorPos)
+		if err != nil {
+			e.errorf(v.OperatorPos, "%s", err)
+		}
+		return ret
+	case *List:
+		ret := *v
+		ret.Values = make([]Expression, len(v.Values))
+		for i, value := range v.Values {
+			ret.Values[i] = e.expand(value)
+			if ret.Values[i].Type() != StringType {
+				e.errorf(value.Pos(), "Expected string in list, found %s", ret.Values[i].Type())
+			}
+		}
+		ret.Comments = append([]*ListElementComments(nil), v.Comments...)
+		return &ret
+	case *Map:
+		ret := *v
+		ret.Properties = make([]*Property, len(v.Properties))
+		for i, property := range v.Properties {
+			newProperty := *property
+			newProperty.Value = e.expand(property.Value)
+			ret.Properties[i] = &newProperty
+		}
+		return &ret
+	default:
+		return v.Copy()
+	}
+}
+
+// errorf reports an error at a position in the body of the macro, and where
+// the macro was instantiated.
+func (e *macroExpander) errorf(pos scanner.Position, format string, args ...interface{}) {
+	e.p.errorAt(pos, "%s, in macro %q instantiated at %s", fmt.Sprintf(format, args...),
+		e.macro.Name, e.call.TypePos)
+}
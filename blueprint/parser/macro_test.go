@@ -0,0 +1,175 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestMacroExpansion(t *testing.T) {
+	r := bytes.NewBufferString(`
+suffix = "_host"
+
+macro pair(name, srcs = [], host_srcs = []) {
+    foo {
+        name: name,
+        srcs: srcs,
+    }
+    foo {
+        name: name + suffix,
+        srcs: srcs + host_srcs,
+    }
+}
+
+name = "ignored"
+
+pair {
+    name: "a",
+    srcs: ["a.c"],
+}
+
+pair(name = "b", host_srcs = ["host.c"])
+`)
+
+	scope := NewScope(nil)
+	file, errs := ParseAndEval("Blueprints", r, scope)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+
+	type module struct {
+		name string
+		srcs []string
+		call int
+		def  int
+	}
+	var got []module
+	for _, def := range file.Defs {
+		m, ok := def.(*Module)
+		if !ok {
+			continue
+		}
+		name, _ := m.GetProperty("name")
+		srcs, _ := m.GetProperty("srcs")
+		var srcStrings []string
+		for _, src := range srcs.Value.Eval().(*List).Values {
+			srcStrings = append(srcStrings, src.(*String).Value)
+		}
+		if m.Macro == nil || m.Macro.Macro != "pair" || m.TypePos != m.Macro.Call {
+			t.Errorf("incorrect expansion of module %s: %#v", name.Value.Eval(), m.Macro)
+			continue
+		}
+		got = append(got, module{
+			name: name.Value.Eval().(*String).Value,
+			srcs: srcStrings,
+			call: m.Macro.Call.Line,
+			def:  m.Macro.Definition.Line,
+		})
+	}
+
+	expected := []module{
+		{name: "a", srcs: []string{"a.c"}, call: 17, def: 5},
+		{name: "a_host", srcs: []string{"a.c"}, call: 17, def: 9},
+		{name: "b", srcs: nil, call: 22, def: 5},
+		{name: "b_host", srcs: []string{"host.c"}, call: 22, def: 9},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("incorrect modules:\n%#v\nexpected:\n%#v", got, expected)
+	}
+
+	if scope.GetMacro("pair") == nil {
+		t.Errorf("expected macro pair in the scope")
+	}
+	if _, ok := file.Defs[1].(*Macro); !ok {
+		t.Errorf("expected the macro definition in the definitions, got %s", file.Defs[1])
+	}
+}
+
+func TestMacroErrors(t *testing.T) {
+	testCases := []struct {
+		input string
+		err   string
+	}{
+		{
+			input: `
+macro m(name) { foo { name: name } }
+m { name: "a", srcs: ["a.c"] }
+`,
+			err: `Blueprints:3:16: macro "m" has no parameter "srcs"`,
+		},
+		{
+			input: `
+macro m(name) { foo { name: name } }
+m {}
+`,
+			err: `Blueprints:3:1: missing argument "name" of macro "m"`,
+		},
+		{
+			input: `
+name = "a"
+macro m(name) { foo { name: name } }
+`,
+			err: `Blueprints:3:9: parameter "name" of macro "m" hides the variable set at Blueprints:2:1`,
+		},
+		{
+			input: `
+macro m(name) { foo { name: name + later } }
+later = "a"
+`,
+			err: `Blueprints:2:36: variable "later" is not set`,
+		},
+		{
+			input: `
+macro m(name) { foo { name: name } }
+macro n(name) { m { name: name } }
+`,
+			err: `Blueprints:3:17: macro "m" can't be instantiated in the body of macro "n"`,
+		},
+		{
+			input: `
+macro m(name) { foo { name: name } }
+macro m(name) { foo { name: name } }
+`,
+			err: `Blueprints:3:7: macro "m" already defined at Blueprints:2:7`,
+		},
+		{
+			input: `
+macro m(name) { x = name }
+`,
+			err: `Blueprints:2:19: expected module definition in the body of macro "m", found "="`,
+		},
+		{
+			input: `
+macro m(name) {
+    foo { name: name + "_x" }
+}
+m { name: ["a"] }
+`,
+			err: `Blueprints:3:22: mismatched type in operator +: list != string, in macro "m" instantiated at Blueprints:5:1`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		r := bytes.NewBufferString(testCase.input)
+		_, errs := ParseAndEval("Blueprints", r, NewScope(nil))
+		if len(errs) != 1 || errs[0].Error() != testCase.err {
+			t.Errorf("test case: %s", testCase.input)
+			t.Errorf("  expected: %q", testCase.err)
+			t.Errorf("       got: %q", errs)
+		}
+	}
+}
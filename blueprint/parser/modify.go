@@ -44,6 +44,9 @@ func RemoveStringFromList(list *List, s string) (modified bool) {
 
 		if sv, ok := v.(*String); ok && sv.Value == s {
 			list.Values = append(list.Values[:i], list.Values[i+1:]...)
+			if i < len(list.Comments) {
+				list.Comments = append(list.Comments[:i], list.Comments[i+1:]...)
+			}
 			return true
 		}
 	}
@@ -15,6 +15,8 @@
 package parser
 
 import (
+	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -26,7 +28,12 @@ import (
 
 var errTooManyErrors = errors.New("too many errors")
 
-const maxErrors = 1
+// errSkipDefinition is used to abandon parsing the current definition after a
+// syntax error.  The parser then skips to the next definition, so that a
+// single run reports the errors in all definitions of a file.
+var errSkipDefinition = errors.New("skip definition")
+
+const maxErrors = 10
 
 type ParseError struct {
 	Err error
@@ -84,16 +91,14 @@ func parse(p *parser) (file *File, errs []error) {
 }
 
 func ParseAndEval(filename string, r io.Reader, scope *Scope) (file *File, errs []error) {
-	p := newParser(r, scope)
+	p := newParser(filename, r, scope)
 	p.eval = true
-	p.scanner.Filename = filename
 
 	return parse(p)
 }
 
 func Parse(filename string, r io.Reader, scope *Scope) (file *File, errs []error) {
-	p := newParser(r, scope)
-	p.scanner.Filename = filename
+	p := newParser(filename, r, scope)
 
 	return parse(p)
 }
@@ -105,14 +110,45 @@ type parser struct {
 	scope    *Scope
 	comments []*CommentGroup
 	eval     bool
+	arena    *NodeArena // optional, set by ParseAndEvalInArena
+
+	// Used to find the start of the next definition after an error
+	depth    int
+	prevLine int
+
+	// Whether the file starts with a byte order mark.  The scanner skips
+	// it, but counts it in the columns of the first line.
+	bom bool
 }
 
-func newParser(r io.Reader, scope *Scope) *parser {
+// utf8BOM is the UTF-8 encoding of the byte order mark.
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+func newParser(filename string, r io.Reader, scope *Scope) *parser {
 	p := &parser{}
 	p.scope = scope
-	p.scanner.Init(r)
+
+	br := bufio.NewReader(r)
+	if start, err := br.Peek(len(utf8BOM)); err == nil && bytes.Equal(start, utf8BOM) {
+		p.bom = true
+	}
+
+	p.scanner.Init(br)
+	p.scanner.Filename = filename
 	p.scanner.Error = func(sc *scanner.Scanner, msg string) {
-		p.errorf(msg)
+		// The scanner recovers from its own errors, so parsing can
+		// continue with the token that it returns.  Errors in the
+		// encoding are reported at the offending character rather than
+		// at the start of the token that contains it.
+		switch msg {
+		case "invalid UTF-8 encoding":
+			p.addErrorAt(p.bomAdjust(sc.Pos()),
+				errors.New("invalid UTF-8 encoding, Blueprints files must be encoded in UTF-8"))
+		case "invalid character NUL":
+			p.addErrorAt(p.bomAdjust(sc.Pos()), errors.New(msg))
+		default:
+			p.addError(errors.New(msg))
+		}
 	}
 	p.scanner.Mode = scanner.ScanIdents | scanner.ScanStrings |
 		scanner.ScanRawStrings | scanner.ScanComments
@@ -120,25 +156,45 @@ func newParser(r io.Reader, scope *Scope) *parser {
 	return p
 }
 
-func (p *parser) error(err error) {
+// addError records an error at the current position.  Parsing stops once
+// maxErrors errors have been recorded.
+func (p *parser) addError(err error) {
 	pos := p.scanner.Position
 	if !pos.IsValid() {
-		pos = p.scanner.Pos()
+		pos = p.bomAdjust(p.scanner.Pos())
 	}
-	err = &ParseError{
+	p.addErrorAt(pos, err)
+}
+
+// addErrorAt records an error at pos.  Parsing stops once maxErrors errors
+// have been recorded.
+func (p *parser) addErrorAt(pos scanner.Position, err error) {
+	p.errors = append(p.errors, &ParseError{
 		Err: err,
 		Pos: pos,
-	}
-	p.errors = append(p.errors, err)
+	})
 	if len(p.errors) >= maxErrors {
 		panic(errTooManyErrors)
 	}
 }
 
+// error records an error at the current position and abandons the current
+// definition.
+func (p *parser) error(err error) {
+	p.addError(err)
+	panic(errSkipDefinition)
+}
+
 func (p *parser) errorf(format string, args ...interface{}) {
 	p.error(fmt.Errorf(format, args...))
 }
 
+// errorAt records an error at pos and abandons the current definition.
+func (p *parser) errorAt(pos scanner.Position, format string, args ...interface{}) {
+	p.addErrorAt(pos, fmt.Errorf(format, args...))
+	panic(errSkipDefinition)
+}
+
 func (p *parser) accept(toks ...rune) bool {
 	for _, tok := range toks {
 		if p.tok != tok {
@@ -153,7 +209,15 @@ func (p *parser) accept(toks ...rune) bool {
 
 func (p *parser) next() {
 	if p.tok != scanner.EOF {
-		p.tok = p.scanner.Scan()
+		switch p.tok {
+		case '{', '[', '(':
+			p.depth++
+		case '}', ']', ')':
+			p.depth--
+		}
+		p.prevLine = p.scanner.Position.Line
+
+		p.tok = p.scan()
 		if p.tok == scanner.Comment {
 			var comments []*Comment
 			for p.tok == scanner.Comment {
@@ -163,7 +227,7 @@ func (p *parser) next() {
 					comments = nil
 				}
 				comments = append(comments, &Comment{lines, p.scanner.Position})
-				p.tok = p.scanner.Scan()
+				p.tok = p.scan()
 			}
 			p.comments = append(p.comments, &CommentGroup{Comments: comments})
 		}
@@ -171,34 +235,106 @@ func (p *parser) next() {
 	return
 }
 
-func (p *parser) parseDefinitions() (defs []Definition) {
+// scan returns the next token from the scanner, with the columns of its
+// position counted in characters from the start of the line, not counting a
+// byte order mark.  Byte order marks in the rest of the file are reported as
+// errors and skipped.
+func (p *parser) scan() rune {
 	for {
+		tok := p.scanner.Scan()
+		p.scanner.Position = p.bomAdjust(p.scanner.Position)
+		if tok != '\uFEFF' {
+			return tok
+		}
+		p.addError(errors.New("unexpected byte order mark, it is only allowed at the start of the file"))
+	}
+}
+
+// bomAdjust returns pos without the byte order mark at the start of the file
+// counted in its column.  The offset still counts it, so that it can be used
+// to index the contents of the file.
+func (p *parser) bomAdjust(pos scanner.Position) scanner.Position {
+	if p.bom && pos.Line == 1 && pos.Column > 1 {
+		pos.Column--
+	}
+	return pos
+}
+
+func (p *parser) parseDefinitions() (defs []Definition) {
+	for p.tok != scanner.EOF {
+		defs = append(defs, p.parseDefinition()...)
+	}
+	return
+}
+
+// parseDefinition parses a single assignment, module or macro definition, and
+// returns it, or the modules a macro instantiation expands to.  If there is an
+// error in the definition it returns nil after skipping to the start of the
+// next definition.
+func (p *parser) parseDefinition() (defs []Definition) {
+	defPos := p.scanner.Position
+	p.depth = 0
+
+	defer func() {
+		if r := recover(); r != nil {
+			if r != errSkipDefinition {
+				panic(r)
+			}
+			defs = nil
+			p.skipToNextDefinition(defPos)
+		}
+	}()
+
+	switch p.tok {
+	case scanner.Ident:
+		ident := p.scanner.TokenText()
+		pos := p.scanner.Position
+
+		p.accept(scanner.Ident)
+
 		switch p.tok {
+		case '+':
+			p.accept('+')
+			return []Definition{p.parseAssignment(ident, pos, "+=")}
+		case '=':
+			return []Definition{p.parseAssignment(ident, pos, "=")}
+		case '{', '(':
+			module := p.parseModule(ident, pos)
+			if p.eval {
+				if macro := p.scope.GetMacro(ident); macro != nil {
+					return p.expandMacro(macro, module)
+				}
+			}
+			return []Definition{module}
 		case scanner.Ident:
-			ident := p.scanner.TokenText()
-			pos := p.scanner.Position
-
-			p.accept(scanner.Ident)
-
-			switch p.tok {
-			case '+':
-				p.accept('+')
-				defs = append(defs, p.parseAssignment(ident, pos, "+="))
-			case '=':
-				defs = append(defs, p.parseAssignment(ident, pos, "="))
-			case '{', '(':
-				defs = append(defs, p.parseModule(ident, pos))
-			default:
-				p.errorf("expected \"=\" or \"+=\" or \"{\" or \"(\", found %s",
-					scanner.TokenString(p.tok))
+			if ident == macroKeyword {
+				return []Definition{p.parseMacro(pos)}
 			}
-		case scanner.EOF:
-			return
+			p.errorf("expected \"=\" or \"+=\" or \"{\" or \"(\", found %s",
+				scanner.TokenString(p.tok))
 		default:
-			p.errorf("expected assignment or module definition, found %s",
+			p.errorf("expected \"=\" or \"+=\" or \"{\" or \"(\", found %s",
 				scanner.TokenString(p.tok))
+		}
+	default:
+		p.errorf("expected assignment or module definition, found %s",
+			scanner.TokenString(p.tok))
+	}
+
+	return nil
+}
+
+// skipToNextDefinition skips tokens until an identifier at the start of a
+// line that is either outside of any brackets, or not indented more than the
+// definition that had the error.
+func (p *parser) skipToNextDefinition(defPos scanner.Position) {
+	for p.tok != scanner.EOF {
+		pos := p.scanner.Position
+		if p.tok == scanner.Ident && pos.Line > p.prevLine &&
+			(p.depth <= 0 || pos.Column <= defPos.Column) {
 			return
 		}
+		p.next()
 	}
 }
 
@@ -294,7 +430,11 @@ func (p *parser) parsePropertyList(isModule, compat bool) (properties []*Propert
 }
 
 func (p *parser) parseProperty(isModule, compat bool) (property *Property) {
-	property = new(Property)
+	if p.arena != nil {
+		property = p.arena.newProperty()
+	} else {
+		property = new(Property)
+	}
 
 	name := p.scanner.TokenText()
 	namePos := p.scanner.Position
@@ -356,6 +496,12 @@ func (p *parser) evaluateOperator(value1, value2 Expression, operator rune,
 			case *String:
 				v.Value += e2.(*String).Value
 			case *List:
+				if l2 := e2.(*List); len(l2.Comments) > 0 {
+					for len(v.Comments) < len(v.Values) {
+						v.Comments = append(v.Comments, nil)
+					}
+					v.Comments = append(v.Comments, l2.Comments...)
+				}
 				v.Values = append(v.Values, e2.(*List).Values...)
 			case *Map:
 				var err error
@@ -492,16 +638,21 @@ func (p *parser) parseStringValue() *String {
 		return nil
 	}
 
-	value := &String{
-		LiteralPos: p.scanner.Position,
-		Value:      str,
+	var value *String
+	if p.arena != nil {
+		value = p.arena.newString()
+	} else {
+		value = new(String)
 	}
+	value.LiteralPos = p.scanner.Position
+	value.Value = str
 	p.accept(scanner.String)
 	return value
 }
 
 func (p *parser) parseListValue() *List {
 	lBracePos := p.scanner.Position
+	firstComment := len(p.comments)
 	if !p.accept('[') {
 		return nil
 	}
@@ -524,13 +675,83 @@ func (p *parser) parseListValue() *List {
 	}
 
 	rBracePos := p.scanner.Position
+	lastComment := len(p.comments)
 	p.accept(']')
 
-	return &List{
+	list := &List{
 		LBracePos: lBracePos,
 		RBracePos: rBracePos,
 		Values:    elements,
 	}
+	p.attachListComments(list, firstComment, lastComment)
+	return list
+}
+
+// attachListComments moves the comments in p.comments[first:last], which are the comments
+// between the braces of the list, that are attached to the elements of the list into
+// list.Comments.  A group of comments ending on the line directly above an element, and starting
+// after the previous element, is attached to the element, and so are the comments that follow an
+// element on the rest of its line.
+func (p *parser) attachListComments(list *List, first, last int) {
+	groups := append([]*CommentGroup(nil), p.comments[first:last]...)
+	var rest []*CommentGroup
+	var comments []*ListElementComments
+	attach := func(i int) *ListElementComments {
+		for len(comments) <= i {
+			comments = append(comments, nil)
+		}
+		if comments[i] == nil {
+			comments[i] = &ListElementComments{}
+		}
+		return comments[i]
+	}
+
+	g := 0
+	prevLine := list.LBracePos.Line
+	for i, value := range list.Values {
+		for ; g < len(groups) && groups[g].Pos().Offset < value.Pos().Offset; g++ {
+			cg := groups[g]
+			if cg.Pos().Line > prevLine && cg.End().Line == value.Pos().Line-1 {
+				attach(i).Before = cg
+			} else {
+				rest = append(rest, cg)
+			}
+		}
+
+		end := value.End()
+		for ; g < len(groups) && groups[g].Pos().Offset < end.Offset; g++ {
+			rest = append(rest, groups[g])
+		}
+
+		nextLine := list.RBracePos.Line
+		if i < len(list.Values)-1 {
+			nextLine = list.Values[i+1].Pos().Line
+		}
+		if g < len(groups) && groups[g].Pos().Line == end.Line && nextLine > end.Line {
+			// The group may continue on the following lines, up to the next element.
+			cg := groups[g]
+			n := 0
+			for n < len(cg.Comments) && cg.Comments[n].End().Line == end.Line {
+				n++
+			}
+			if n > 0 {
+				attach(i).After = &CommentGroup{Comments: cg.Comments[:n]}
+				if n < len(cg.Comments) {
+					groups[g] = &CommentGroup{Comments: cg.Comments[n:]}
+				} else {
+					g++
+				}
+			}
+		}
+		prevLine = end.Line
+	}
+	rest = append(rest, groups[g:]...)
+
+	if comments != nil {
+		list.Comments = comments
+		tail := append([]*CommentGroup(nil), p.comments[last:]...)
+		p.comments = append(append(p.comments[:first], rest...), tail...)
+	}
 }
 
 func (p *parser) parseMapValue() *Map {
@@ -554,12 +775,14 @@ func (p *parser) parseMapValue() *Map {
 type Scope struct {
 	vars          map[string]*Assignment
 	inheritedVars map[string]*Assignment
+	macros        map[string]*Macro
 }
 
 func NewScope(s *Scope) *Scope {
 	newScope := &Scope{
 		vars:          make(map[string]*Assignment),
 		inheritedVars: make(map[string]*Assignment),
+		macros:        make(map[string]*Macro),
 	}
 
 	if s != nil {
@@ -569,11 +792,29 @@ func NewScope(s *Scope) *Scope {
 		for k, v := range s.inheritedVars {
 			newScope.inheritedVars[k] = v
 		}
+		for k, m := range s.macros {
+			newScope.macros[k] = m
+		}
 	}
 
 	return newScope
 }
 
+// AddMacro makes a macro visible in s and the scopes created from it.  It is
+// an error if a macro with the same name is already visible.
+func (s *Scope) AddMacro(macro *Macro) error {
+	if old, ok := s.macros[macro.Name]; ok {
+		return fmt.Errorf("macro %q already defined at %s", macro.Name, old.NamePos)
+	}
+	s.macros[macro.Name] = macro
+	return nil
+}
+
+// GetMacro returns the macro with the given name visible in s, or nil.
+func (s *Scope) GetMacro(name string) *Macro {
+	return s.macros[name]
+}
+
 func (s *Scope) Add(assignment *Assignment) error {
 	if old, ok := s.vars[assignment.Name]; ok {
 		return fmt.Errorf("variable already set, previous assignment: %s", old)
@@ -588,6 +829,25 @@ func (s *Scope) Add(assignment *Assignment) error {
 	return nil
 }
 
+// Import makes the variables that are visible in other visible in s as
+// inherited variables.  It is an error if a variable is already visible in s
+// from a different assignment.
+func (s *Scope) Import(other *Scope) error {
+	for _, vars := range []map[string]*Assignment{other.vars, other.inheritedVars} {
+		for name, assignment := range vars {
+			if old, _ := s.Get(name); old != nil {
+				if old.NamePos == assignment.NamePos {
+					continue
+				}
+				return fmt.Errorf("imported variable %q already set, previous assignment: %s",
+					name, old)
+			}
+			s.inheritedVars[name] = assignment
+		}
+	}
+	return nil
+}
+
 func (s *Scope) Remove(name string) {
 	delete(s.vars, name)
 	delete(s.inheritedVars, name)
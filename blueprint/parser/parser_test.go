@@ -16,7 +16,9 @@ package parser
 
 import (
 	"bytes"
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 	"text/scanner"
 )
@@ -658,4 +660,219 @@ func TestParseValidInput(t *testing.T) {
 	}
 }
 
+func TestParseListComments(t *testing.T) {
+	r := bytes.NewBufferString(`
+foo {
+    srcs: [ // not attached
+        "a.c", // a
+
+        // not attached
+
+        // b
+        "b.c",
+        "c.c", // c
+        // d
+        /* d */
+        "d.c",
+    ],
+}
+`)
+
+	file, errs := Parse("", r, NewScope(nil))
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+
+	list := file.Defs[0].(*Module).Properties[0].Value.(*List)
+
+	text := func(cg *CommentGroup) []string {
+		var ret []string
+		if cg != nil {
+			for _, c := range cg.Comments {
+				ret = append(ret, strings.TrimSpace(c.Text()))
+			}
+		}
+		return ret
+	}
+
+	expected := [][2][]string{
+		{nil, {"a"}},
+		{{"b"}, nil},
+		{nil, {"c"}},
+		{{"d", "d"}, nil},
+	}
+	for i, e := range expected {
+		var got [2][]string
+		if comments := list.ElementComments(i); comments != nil {
+			got = [2][]string{text(comments.Before), text(comments.After)}
+		}
+		if !reflect.DeepEqual(got, e) {
+			t.Errorf("element %d: expected comments %q, got %q", i, e, got)
+		}
+	}
+
+	var fileComments []string
+	for _, cg := range file.Comments {
+		fileComments = append(fileComments, text(cg)...)
+	}
+	if !reflect.DeepEqual(fileComments, []string{"not attached", "not attached"}) {
+		t.Errorf("expected the unattached comments in the file, got %q", fileComments)
+	}
+
+	if !RemoveStringFromList(list, "a.c") || len(list.Comments) != 3 ||
+		!reflect.DeepEqual(text(list.ElementComments(0).Before), []string{"b"}) {
+		t.Errorf("expected the comments of a.c to be removed with it, got %v", list.Comments)
+	}
+}
+
+func TestParseErrorRecovery(t *testing.T) {
+	r := bytes.NewBufferString(`
+foo {
+    name: "a",
+    srcs: ["a" "b"],
+}
+
+bar {
+    name: "b",
+}
+
+baz {
+    name: "c"
+    deps: ["d"],
+}
+
+x = "a" +
+
+qux {
+    name: "e",
+}
+`)
+
+	expectedErrors := []string{
+		`Blueprints:4:16: expected "]", found String`,
+		`Blueprints:13:5: expected "}", found Ident`,
+		`Blueprints:18:1: variable "qux" is not set`,
+	}
+
+	file, errs := ParseAndEval("Blueprints", r, NewScope(nil))
+
+	var errStrings []string
+	for _, err := range errs {
+		errStrings = append(errStrings, err.Error())
+	}
+	if !reflect.DeepEqual(errStrings, expectedErrors) {
+		t.Errorf("incorrect errors:")
+		t.Errorf("  expected: %q", expectedErrors)
+		t.Errorf("       got: %q", errStrings)
+	}
+
+	// The definitions without errors are still returned.
+	var types []string
+	for _, def := range file.Defs {
+		if m, ok := def.(*Module); ok {
+			types = append(types, m.Type)
+		}
+	}
+	if !reflect.DeepEqual(types, []string{"bar", "qux"}) {
+		t.Errorf("expected modules bar and qux, got %q", types)
+	}
+}
+
+func TestParseTooManyErrors(t *testing.T) {
+	input := ""
+	for i := 0; i < 2*maxErrors; i++ {
+		input += "foo { name: }\n"
+	}
+
+	_, errs := ParseAndEval("Blueprints", bytes.NewBufferString(input), NewScope(nil))
+	if len(errs) != maxErrors {
+		t.Errorf("expected %d errors, got %d: %q", maxErrors, len(errs), errs)
+	}
+}
+
+func TestParseEncoding(t *testing.T) {
+	testCases := []struct {
+		name   string
+		input  string
+		errs   []string
+		module string // the position of the first module
+	}{
+		{
+			name:   "byte order mark",
+			input:  "\ufefffoo { name: \"a\" }\n",
+			module: "Blueprints:1:1",
+		},
+		{
+			name:   "non-ASCII",
+			input:  "// ü\nfoo { name: \"é\", srcs: [b] }\nbar { name: \"é\" }\n",
+			errs:   []string{`Blueprints:2:25: variable "b" is not set`},
+			module: "Blueprints:3:1",
+		},
+		{
+			name:  "byte order mark and non-ASCII",
+			input: "\ufefffoo { name: \"é\", srcs: [b] }\n",
+			errs:  []string{`Blueprints:1:25: variable "b" is not set`},
+		},
+		{
+			name:   "invalid UTF-8 in string",
+			input:  "foo { name: \"é\xff\" }\n",
+			errs:   []string{"Blueprints:1:15: invalid UTF-8 encoding, Blueprints files must be encoded in UTF-8"},
+			module: "Blueprints:1:1",
+		},
+		{
+			name:   "invalid UTF-8 in comment",
+			input:  "\ufeff// a\xff\nfoo { name: \"a\" }\n",
+			errs:   []string{"Blueprints:1:5: invalid UTF-8 encoding, Blueprints files must be encoded in UTF-8"},
+			module: "Blueprints:2:1",
+		},
+		{
+			name:   "byte order mark in the middle",
+			input:  "foo { name: \"a\" }\n\ufeff\n",
+			errs:   []string{"Blueprints:2:1: unexpected byte order mark, it is only allowed at the start of the file"},
+			module: "Blueprints:1:1",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			file, errs := ParseAndEval("Blueprints", bytes.NewBufferString(testCase.input), NewScope(nil))
+
+			var errStrings []string
+			for _, err := range errs {
+				errStrings = append(errStrings, err.Error())
+			}
+			if !reflect.DeepEqual(errStrings, testCase.errs) {
+				t.Errorf("incorrect errors:")
+				t.Errorf("  expected: %q", testCase.errs)
+				t.Errorf("       got: %q", errStrings)
+			}
+
+			if testCase.module != "" {
+				if len(file.Defs) == 0 {
+					t.Fatalf("expected a module")
+				}
+				if pos := file.Defs[0].Pos().String(); pos != testCase.module {
+					t.Errorf("expected the module at %s, got %s", testCase.module, pos)
+				}
+			}
+		})
+	}
+}
+
+func TestCommentEnd(t *testing.T) {
+	file, errs := Parse("Blueprints", bytes.NewBufferString("/* ä\n ö */ // ü\n"), NewScope(nil))
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+
+	var ends []string
+	for _, c := range file.Comments[0].Comments {
+		end := c.End()
+		ends = append(ends, fmt.Sprintf("%d:%d", end.Line, end.Column))
+	}
+	if expected := []string{"2:6", "2:11"}; !reflect.DeepEqual(ends, expected) {
+		t.Errorf("expected the comments to end at %q, got %q", expected, ends)
+	}
+}
+
 // TODO: Test error strings
@@ -81,6 +81,8 @@ func (p *printer) printDef(def Definition) {
 		p.printAssignment(assignment)
 	} else if module, ok := def.(*Module); ok {
 		p.printModule(module)
+	} else if macro, ok := def.(*Macro); ok {
+		p.printMacro(macro)
 	} else {
 		panic("Unknown definition")
 	}
@@ -101,6 +103,38 @@ func (p *printer) printModule(module *Module) {
 	p.requestDoubleNewline()
 }
 
+func (p *printer) printMacro(macro *Macro) {
+	p.printToken(macroKeyword, macro.MacroPos)
+	p.requestSpace()
+	p.printToken(macro.Name, macro.NamePos)
+	p.printToken("(", macro.LParenPos)
+	for i, param := range macro.Params {
+		if i > 0 {
+			p.printToken(",", noPos)
+			p.requestSpace()
+		}
+		p.printToken(param.Name, param.NamePos)
+		if param.Default != nil {
+			p.requestSpace()
+			p.printToken("=", param.EqualsPos)
+			p.requestSpace()
+			p.printExpression(param.Default)
+		}
+	}
+	p.printToken(")", macro.RParenPos)
+	p.requestSpace()
+	p.printToken("{", macro.LBracePos)
+	p.requestNewline()
+	p.indent(p.curIndent() + 4)
+	for _, module := range macro.Body {
+		p.printModule(module)
+	}
+	p.unindent(macro.RBracePos)
+	p.pendingNewline = 1
+	p.printToken("}", macro.RBracePos)
+	p.requestDoubleNewline()
+}
+
 func (p *printer) printExpression(value Expression) {
 	switch v := value.(type) {
 	case *Variable:
@@ -118,7 +152,7 @@ func (p *printer) printExpression(value Expression) {
 	case *String:
 		p.printToken(strconv.Quote(v.Value), v.LiteralPos)
 	case *List:
-		p.printList(v.Values, v.LBracePos, v.RBracePos)
+		p.printList(v)
 	case *Map:
 		p.printMap(v)
 	default:
@@ -126,20 +160,30 @@ func (p *printer) printExpression(value Expression) {
 	}
 }
 
-func (p *printer) printList(list []Expression, pos, endPos scanner.Position) {
+func (p *printer) printList(list *List) {
+	pos, endPos := list.LBracePos, list.RBracePos
 	p.requestSpace()
 	p.printToken("[", pos)
-	if len(list) > 1 || pos.Line != endPos.Line {
+	if len(list.Values) > 1 || pos.Line != endPos.Line {
 		p.requestNewline()
 		p.indent(p.curIndent() + 4)
-		for _, value := range list {
+		for i, value := range list.Values {
+			comments := list.ElementComments(i)
+			if comments != nil && comments.Before != nil {
+				p.printEndOfLineCommentsBefore(comments.Before.Pos())
+				p.printComment(comments.Before)
+				p._requestNewline()
+			}
 			p.printExpression(value)
 			p.printToken(",", noPos)
+			if comments != nil && comments.After != nil {
+				p.printTrailingComment(comments.After)
+			}
 			p.requestNewline()
 		}
 		p.unindent(endPos)
 	} else {
-		for _, value := range list {
+		for _, value := range list.Values {
 			p.printExpression(value)
 		}
 	}
@@ -317,6 +361,15 @@ func (p *printer) printComment(cg *CommentGroup) {
 	}
 }
 
+// Print single line comments after the last token, on the same line regardless of their positions
+func (p *printer) printTrailingComment(cg *CommentGroup) {
+	for _, comment := range cg.Comments {
+		p.requestSpace()
+		p.flushSpace()
+		p.output = append(p.output, strings.TrimSpace(comment.Comment[0])...)
+	}
+}
+
 // Print any comments that occur after the last token, and a trailing newline
 func (p *printer) flush() {
 	for _, c := range p.skippedComments {
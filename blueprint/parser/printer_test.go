@@ -25,6 +25,28 @@ var validPrinterTestCases = []struct {
 }{
 	{
 		input: `
+macro pair(name,srcs=[  ]){
+	foo { name: name }
+	// host variant
+	foo { name: name + "_host", srcs: srcs }
+}
+`,
+		output: `
+macro pair(name, srcs = []) {
+    foo {
+        name: name,
+    }
+
+    // host variant
+    foo {
+        name: name + "_host",
+        srcs: srcs,
+    }
+}
+`,
+	},
+	{
+		input: `
 foo {}
 `,
 		output: `
@@ -309,6 +331,40 @@ test { // test
 
 // test
 
+}
+`,
+	},
+	{
+		input: `
+test {
+    srcs: [
+        "c.c", // c
+        // about b
+        "b.c",
+        "a.c", /* a */
+
+        // not attached
+
+        "z.c",
+        /* about y */
+        "y.c",
+    ],
+}
+`,
+		output: `
+test {
+    srcs: [
+        "a.c", /* a */
+        // about b
+        "b.c",
+        "c.c", // c
+
+        // not attached
+
+        /* about y */
+        "y.c",
+        "z.c",
+    ],
 }
 `,
 	},
@@ -0,0 +1,197 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// A Refactoring is a change to the definitions of a Blueprints file parsed
+// with Parse, which can be applied to every Blueprints file of a tree to
+// refactor it.  Apply changes file in place and returns the number of changes
+// it made, and the errors for the definitions it could not change.  The file
+// can then be written back with Print.
+type Refactoring interface {
+	Apply(file *File) (changes int, errs []error)
+}
+
+// Refactor applies refactorings to file in order, and returns the total number
+// of changes they made.
+func Refactor(file *File, refactorings ...Refactoring) (int, []error) {
+	var changes int
+	var errs []error
+	for _, r := range refactorings {
+		n, rErrs := r.Apply(file)
+		changes += n
+		errs = append(errs, rErrs...)
+	}
+	return changes, errs
+}
+
+// RenameModuleType renames the type of the modules of type From, including
+// those in the bodies of macros, to To.
+type RenameModuleType struct {
+	From, To string
+}
+
+func (r RenameModuleType) Apply(file *File) (int, []error) {
+	changes := 0
+	for _, module := range fileModules(file) {
+		if module.Type == r.From {
+			module.Type = r.To
+			changes++
+		}
+	}
+	return changes, nil
+}
+
+// RenameProperty renames the property at the dotted path From, like "srcs" or
+// "target.linux.srcs", to the name To in the same map, in the modules of type
+// ModuleType, or of all types if it is empty.  A module that already has a
+// property named To next to the property is reported as an error and left
+// unchanged.
+type RenameProperty struct {
+	ModuleType string
+	From, To   string
+}
+
+func (r RenameProperty) Apply(file *File) (int, []error) {
+	if strings.Contains(r.To, ".") || r.To == "" {
+		return 0, []error{fmt.Errorf("invalid new property name %q, expected a name without dots", r.To)}
+	}
+
+	changes := 0
+	var errs []error
+	for _, module := range fileModules(file) {
+		if r.ModuleType != "" && module.Type != r.ModuleType {
+			continue
+		}
+		visitProperties(&module.Map, "", func(path string, m *Map, prop *Property) bool {
+			if path != r.From {
+				return true
+			}
+			if existing, found := m.GetProperty(r.To); found {
+				errs = append(errs, fmt.Errorf("%s: can't rename property %q to %q, %s already has a property %q",
+					prop.NamePos, r.From, r.To, existing.NamePos, r.To))
+				return false
+			}
+			prop.Name = r.To
+			changes++
+			return false
+		})
+	}
+	return changes, errs
+}
+
+// RewriteValues replaces the matches of Pattern with Replacement, which may
+// refer to submatches like regexp.Regexp.ReplaceAllString, in the string
+// literals of the properties at the dotted path Property and the values
+// nested in them, of the modules of type ModuleType, or of all types if it is
+// empty.  If Property is empty the string literals of all properties are
+// rewritten, and if ModuleType is empty too the values of the variable
+// assignments as well.
+type RewriteValues struct {
+	ModuleType  string
+	Property    string
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+func (r RewriteValues) Apply(file *File) (int, []error) {
+	changes := 0
+	if r.ModuleType == "" && r.Property == "" {
+		for _, def := range file.Defs {
+			if assignment, ok := def.(*Assignment); ok {
+				changes += r.rewrite(assignment.OrigValue)
+			}
+		}
+	}
+
+	for _, module := range fileModules(file) {
+		if r.ModuleType != "" && module.Type != r.ModuleType {
+			continue
+		}
+		if r.Property == "" {
+			changes += r.rewrite(&module.Map)
+			continue
+		}
+		visitProperties(&module.Map, "", func(path string, m *Map, prop *Property) bool {
+			if path != r.Property {
+				return true
+			}
+			changes += r.rewrite(prop.Value)
+			return false
+		})
+	}
+	return changes, nil
+}
+
+func (r RewriteValues) rewrite(value Expression) int {
+	changes := 0
+	switch v := value.(type) {
+	case *String:
+		if s := r.Pattern.ReplaceAllString(v.Value, r.Replacement); s != v.Value {
+			v.Value = s
+			changes++
+		}
+	case *List:
+		for _, e := range v.Values {
+			changes += r.rewrite(e)
+		}
+	case *Map:
+		for _, prop := range v.Properties {
+			changes += r.rewrite(prop.Value)
+		}
+	case *Operator:
+		changes += r.rewrite(v.Args[0])
+		changes += r.rewrite(v.Args[1])
+	}
+	return changes
+}
+
+// fileModules returns the modules of file, including those in the bodies of
+// its macros.
+func fileModules(file *File) []*Module {
+	var modules []*Module
+	for _, def := range file.Defs {
+		switch def := def.(type) {
+		case *Module:
+			modules = append(modules, def)
+		case *Macro:
+			modules = append(modules, def.Body...)
+		}
+	}
+	return modules
+}
+
+// visitProperties calls visit for each property of m with its dotted path
+// below prefix, and for the properties of its value if it is a map and visit
+// returns true.
+func visitProperties(m *Map, prefix string, visit func(path string, m *Map, prop *Property) bool) {
+	for _, prop := range m.Properties {
+		path := prop.Name
+		if prefix != "" {
+			path = prefix + "." + prop.Name
+		}
+		if !visit(path, m, prop) {
+			continue
+		}
+		if value, ok := prop.Value.(*Map); ok {
+			visitProperties(value, path, visit)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+)
+
+var refactorTestCases = []struct {
+	name         string
+	input        string
+	refactorings []Refactoring
+	output       string
+	changes      int
+	errs         []string
+}{
+	{
+		name: "rename module type",
+		input: `
+cc_lib {
+    name: "foo",
+}
+
+macro pair(name) {
+    cc_lib { name: name }
+}
+
+cc_binary {
+    name: "bar",
+}
+`,
+		refactorings: []Refactoring{RenameModuleType{From: "cc_lib", To: "cc_library"}},
+		output: `
+cc_library {
+    name: "foo",
+}
+
+macro pair(name) {
+    cc_library {
+        name: name,
+    }
+}
+
+cc_binary {
+    name: "bar",
+}
+`,
+		changes: 2,
+	},
+	{
+		name: "rename property",
+		input: `
+cc_library {
+    name: "foo",
+    cflags: ["-Wall"],
+    target: {
+        linux: {
+            cflags: ["-DLINUX"],
+        },
+    },
+}
+
+cc_binary {
+    name: "bar",
+    cflags: ["-O2"],
+}
+`,
+		refactorings: []Refactoring{
+			RenameProperty{ModuleType: "cc_library", From: "cflags", To: "copts"},
+			RenameProperty{From: "target.linux.cflags", To: "copts"},
+		},
+		output: `
+cc_library {
+    name: "foo",
+    copts: ["-Wall"],
+    target: {
+        linux: {
+            copts: ["-DLINUX"],
+        },
+    },
+}
+
+cc_binary {
+    name: "bar",
+    cflags: ["-O2"],
+}
+`,
+		changes: 2,
+	},
+	{
+		name: "rename property conflict",
+		input: `
+cc_library {
+    name: "foo",
+    cflags: ["-Wall"],
+    copts: ["-O2"],
+}
+`,
+		refactorings: []Refactoring{RenameProperty{From: "cflags", To: "copts"}},
+		output: `
+cc_library {
+    name: "foo",
+    cflags: ["-Wall"],
+    copts: ["-O2"],
+}
+`,
+		errs: []string{`<input>:3:5: can't rename property "cflags" to "copts", <input>:4:5 already has a property "copts"`},
+	},
+	{
+		name: "rewrite values of property",
+		input: `
+cc_library {
+    name: "foo",
+    srcs: ["old/a.c"] + ["old/b.c"],
+    include_dirs: ["old"],
+    target: {
+        linux: {
+            srcs: ["old/linux.c"],
+        },
+    },
+}
+`,
+		refactorings: []Refactoring{RewriteValues{
+			Property:    "srcs",
+			Pattern:     regexp.MustCompile(`^old/`),
+			Replacement: "new/",
+		}},
+		output: `
+cc_library {
+    name: "foo",
+    srcs: ["new/a.c"] + ["new/b.c"],
+    include_dirs: ["old"],
+    target: {
+        linux: {
+            srcs: ["old/linux.c"],
+        },
+    },
+}
+`,
+		changes: 2,
+	},
+	{
+		name: "rewrite all values",
+		input: `
+prefix = "old"
+
+cc_library {
+    name: "old_foo",
+    target: {
+        linux: {
+            srcs: ["old.c"],
+        },
+    },
+}
+`,
+		refactorings: []Refactoring{RewriteValues{
+			Pattern:     regexp.MustCompile(`old(_?)`),
+			Replacement: "new$1",
+		}},
+		output: `
+prefix = "new"
+
+cc_library {
+    name: "new_foo",
+    target: {
+        linux: {
+            srcs: ["new.c"],
+        },
+    },
+}
+`,
+		changes: 3,
+	},
+}
+
+func TestRefactor(t *testing.T) {
+	for _, testCase := range refactorTestCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			file, errs := Parse("<input>", bytes.NewBufferString(testCase.input[1:]), NewScope(nil))
+			if len(errs) > 0 {
+				t.Fatalf("unexpected parse errors: %q", errs)
+			}
+
+			changes, errs := Refactor(file, testCase.refactorings...)
+			if changes != testCase.changes {
+				t.Errorf("expected %d changes, got %d", testCase.changes, changes)
+			}
+
+			var errStrings []string
+			for _, err := range errs {
+				errStrings = append(errStrings, err.Error())
+			}
+			if len(errStrings) != len(testCase.errs) {
+				t.Errorf("expected errors %q, got %q", testCase.errs, errStrings)
+			} else {
+				for i := range errStrings {
+					if errStrings[i] != testCase.errs[i] {
+						t.Errorf("expected errors %q, got %q", testCase.errs, errStrings)
+						break
+					}
+				}
+			}
+
+			got, err := Print(file)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if string(got) != testCase.output[1:] {
+				t.Errorf("expected:\n%s\ngot:\n%s", testCase.output[1:], got)
+			}
+		})
+	}
+}
@@ -33,12 +33,18 @@ func SortLists(file *File) {
 }
 
 func SortList(file *File, list *List) {
+	if len(list.Comments) > 0 {
+		for len(list.Comments) < len(list.Values) {
+			list.Comments = append(list.Comments, nil)
+		}
+	}
+
 	for i := 0; i < len(list.Values); i++ {
 		// Find a set of values on contiguous lines
 		line := list.Values[i].Pos().Line
 		var j int
 		for j = i + 1; j < len(list.Values); j++ {
-			if list.Values[j].Pos().Line > line+1 {
+			if elemStart(list, j).Line > line+1 {
 				break
 			}
 			line = list.Values[j].Pos().Line
@@ -46,9 +52,9 @@ func SortList(file *File, list *List) {
 
 		nextPos := list.End()
 		if j < len(list.Values) {
-			nextPos = list.Values[j].Pos()
+			nextPos = elemStart(list, j)
 		}
-		sortSubList(list.Values[i:j], nextPos, file)
+		sortSubList(list, i, j, nextPos, file)
 		i = j - 1
 	}
 }
@@ -59,7 +65,7 @@ func ListIsSorted(list *List) bool {
 		line := list.Values[i].Pos().Line
 		var j int
 		for j = i + 1; j < len(list.Values); j++ {
-			if list.Values[j].Pos().Line > line+1 {
+			if elemStart(list, j).Line > line+1 {
 				break
 			}
 			line = list.Values[j].Pos().Line
@@ -90,7 +96,16 @@ func sortListsInValue(value Expression, file *File) {
 	}
 }
 
-func sortSubList(values []Expression, nextPos scanner.Position, file *File) {
+// elemStart returns the position of element i of the list, or of the comments attached above it.
+func elemStart(list *List, i int) scanner.Position {
+	if comments := list.ElementComments(i); comments != nil && comments.Before != nil {
+		return comments.Before.Pos()
+	}
+	return list.Values[i].Pos()
+}
+
+func sortSubList(list *List, start, end int, nextPos scanner.Position, file *File) {
+	values := list.Values[start:end]
 	l := make(elemList, len(values))
 	for i, v := range values {
 		s, ok := v.(*String)
@@ -99,14 +114,19 @@ func sortSubList(values []Expression, nextPos scanner.Position, file *File) {
 		}
 		n := nextPos
 		if i < len(values)-1 {
-			n = values[i+1].Pos()
+			n = elemStart(list, start+i+1)
 		}
-		l[i] = elem{s.Value, i, v.Pos(), n}
+		l[i] = elem{s.Value, i, elemStart(list, start+i), n}
 	}
 
 	sort.Sort(l)
 
 	copyValues := append([]Expression{}, values...)
+	var elemComments, copyElemComments []*ListElementComments
+	if len(list.Comments) > 0 {
+		elemComments = list.Comments[start:end]
+		copyElemComments = append(copyElemComments, elemComments...)
+	}
 	copyComments := make([]*CommentGroup, len(file.Comments))
 	for i := range file.Comments {
 		cg := *file.Comments[i]
@@ -118,19 +138,39 @@ func sortSubList(values []Expression, nextPos scanner.Position, file *File) {
 		copyComments[i] = &cg
 	}
 
-	curPos := values[0].Pos()
+	curPos := elemStart(list, start)
 	for i, e := range l {
 		values[i] = copyValues[e.i]
-		values[i].(*String).LiteralPos = curPos
+		s := values[i].(*String)
+		lines := s.LiteralPos.Line - e.pos.Line + 1
+
+		// Move the element and its comments to curPos
+		move := func(pos *scanner.Position) {
+			pos.Line += curPos.Line - e.pos.Line
+			pos.Offset += curPos.Offset - e.pos.Offset
+		}
+		move(&s.LiteralPos)
+		if elemComments != nil {
+			elemComments[i] = copyElemComments[e.i]
+			if comments := elemComments[i]; comments != nil {
+				for _, cg := range []*CommentGroup{comments.Before, comments.After} {
+					if cg != nil {
+						for _, c := range cg.Comments {
+							move(&c.Slash)
+						}
+					}
+				}
+			}
+		}
 		for j, c := range copyComments {
-			if c.Pos().Offset > e.pos.Offset && c.Pos().Offset < e.nextPos.Offset {
-				file.Comments[j].Comments[0].Slash.Line = curPos.Line
-				file.Comments[j].Comments[0].Slash.Offset += values[i].Pos().Offset - e.pos.Offset
+			if c.Pos().Offset > e.pos.Offset && c.Pos().Offset < e.nextPos.Offset &&
+				c.Pos().Line < e.pos.Line+lines {
+				move(&file.Comments[j].Comments[0].Slash)
 			}
 		}
 
 		curPos.Offset += e.nextPos.Offset - e.pos.Offset
-		curPos.Line++
+		curPos.Line += lines
 	}
 }
 
@@ -0,0 +1,27 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pathtools
+
+// ByteCounter is an io.Writer that discards its input and counts its length,
+// used to measure the size of a file without writing it.
+type ByteCounter struct {
+	// N is the number of bytes written so far.
+	N int64
+}
+
+func (w *ByteCounter) Write(p []byte) (int, error) {
+	w.N += int64(len(p))
+	return len(p), nil
+}
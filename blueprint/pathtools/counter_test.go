@@ -0,0 +1,29 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pathtools
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestByteCounter(t *testing.T) {
+	w := &ByteCounter{}
+	fmt.Fprintf(w, "abc")
+	fmt.Fprintf(w, "%d", 12345)
+	if w.N != 8 {
+		t.Errorf("expected 8 bytes, got %d", w.N)
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pathtools
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// A Fingerprint is a strategy to detect that a file has changed since an
+// earlier build, trading accuracy for the cost of reading files.
+type Fingerprint interface {
+	// Fingerprint returns a string that changes when the file changes, or an
+	// empty string if the file doesn't exist.
+	Fingerprint(filename string) (string, error)
+
+	// Changed returns whether the file has changed since Fingerprint
+	// returned prev for it.
+	Changed(filename, prev string) (bool, error)
+
+	// String returns the name of the strategy, as accepted by
+	// ParseFingerprint.
+	String() string
+}
+
+var (
+	// ContentFingerprint hashes the contents of files, so that a file that
+	// is touched or rewritten with the same contents is unchanged.  The
+	// fingerprint of a directory is the hash of the names in it.  It reads
+	// every file, which is the most expensive on network filesystems.
+	ContentFingerprint Fingerprint = contentFingerprint{}
+
+	// ModTimeFingerprint uses the size and modification time of files, like
+	// Ninja, and never reads them.
+	ModTimeFingerprint Fingerprint = modTimeFingerprint{}
+
+	// HybridFingerprint uses the size and modification time of files, and
+	// hashes the contents of a file only if its size or modification time
+	// changed, so that touching a file doesn't change it.
+	HybridFingerprint Fingerprint = hybridFingerprint{}
+)
+
+// ParseFingerprint returns the Fingerprint named "content", "mtime" or
+// "hybrid".
+func ParseFingerprint(name string) (Fingerprint, error) {
+	for _, f := range []Fingerprint{ContentFingerprint, ModTimeFingerprint, HybridFingerprint} {
+		if f.String() == name {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown fingerprint %q, expected content, mtime or hybrid", name)
+}
+
+type contentFingerprint struct{}
+
+func (contentFingerprint) String() string { return "content" }
+
+func (contentFingerprint) Fingerprint(filename string) (string, error) {
+	return hashContents(filename)
+}
+
+func (f contentFingerprint) Changed(filename, prev string) (bool, error) {
+	fingerprint, err := f.Fingerprint(filename)
+	return fingerprint != prev, err
+}
+
+type modTimeFingerprint struct{}
+
+func (modTimeFingerprint) String() string { return "mtime" }
+
+func (modTimeFingerprint) Fingerprint(filename string) (string, error) {
+	return statFingerprint(filename)
+}
+
+func (f modTimeFingerprint) Changed(filename, prev string) (bool, error) {
+	fingerprint, err := f.Fingerprint(filename)
+	return fingerprint != prev, err
+}
+
+// The fingerprints of hybridFingerprint are the mtime fingerprint and the
+// content fingerprint separated by a colon.
+type hybridFingerprint struct{}
+
+func (hybridFingerprint) String() string { return "hybrid" }
+
+func (hybridFingerprint) Fingerprint(filename string) (string, error) {
+	stat, err := statFingerprint(filename)
+	if stat == "" || err != nil {
+		return "", err
+	}
+	hash, err := hashContents(filename)
+	if err != nil {
+		return "", err
+	}
+	return stat + ":" + hash, nil
+}
+
+func (hybridFingerprint) Changed(filename, prev string) (bool, error) {
+	stat, err := statFingerprint(filename)
+	if err != nil {
+		return true, err
+	}
+	i := strings.IndexByte(prev, ':')
+	if stat == "" || i < 0 {
+		return stat != prev, nil
+	}
+	if stat == prev[:i] {
+		return false, nil
+	}
+	hash, err := hashContents(filename)
+	return hash != prev[i+1:], err
+}
+
+// statFingerprint returns the size and modification time of the file, or an
+// empty string if it doesn't exist.
+func statFingerprint(filename string) (string, error) {
+	info, err := os.Stat(filename)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d-%d", info.Size(), info.ModTime().UnixNano()), nil
+}
+
+// hashContents returns the hex encoded SHA-256 hash of the contents of the
+// file, or of the sorted names in the directory, or an empty string if it
+// doesn't exist.  Files at least as large as the ChunkThreshold of the
+// installed HashCache are hashed in chunks instead.
+func hashContents(filename string) (string, error) {
+	return cachedHash(filename, contentsHash)
+}
@@ -0,0 +1,101 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pathtools
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFingerprint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fingerprint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "a")
+	write := func(contents string, mtime time.Time) {
+		if err := ioutil.WriteFile(file, []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := time.Unix(1500000000, 0)
+
+	testCases := []struct {
+		name string
+
+		// whether touching the file, changing its contents or
+		// removing it changes it
+		touched, modified, removed bool
+	}{
+		{name: "content", touched: false, modified: true, removed: true},
+		{name: "mtime", touched: true, modified: true, removed: true},
+		{name: "hybrid", touched: false, modified: true, removed: true},
+	}
+
+	for _, testCase := range testCases {
+		fingerprint, err := ParseFingerprint(testCase.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		changed := func(prev string) bool {
+			c, err := fingerprint.Changed(file, prev)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return c
+		}
+
+		write("a", start)
+		prev, err := fingerprint.Fingerprint(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed(prev) {
+			t.Errorf("%s: unchanged file is changed", testCase.name)
+		}
+
+		write("a", start.Add(time.Hour))
+		if changed(prev) != testCase.touched {
+			t.Errorf("%s: expected touched file changed = %v", testCase.name, testCase.touched)
+		}
+
+		write("b", start.Add(time.Hour))
+		if changed(prev) != testCase.modified {
+			t.Errorf("%s: expected modified file changed = %v", testCase.name, testCase.modified)
+		}
+
+		os.Remove(file)
+		if changed(prev) != testCase.removed {
+			t.Errorf("%s: expected removed file changed = %v", testCase.name, testCase.removed)
+		}
+		if f, err := fingerprint.Fingerprint(file); f != "" || err != nil {
+			t.Errorf("%s: expected empty fingerprint for removed file, got %q, %v", testCase.name, f, err)
+		}
+	}
+
+	if _, err := ParseFingerprint("ctime"); err == nil {
+		t.Errorf("expected error for unknown fingerprint")
+	}
+}
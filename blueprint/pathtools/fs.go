@@ -21,6 +21,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 )
 
 // Based on Andrew Gerrand's "10 things you (probably) dont' know about Go"
@@ -55,12 +56,24 @@ func MockFs(files map[string][]byte) FileSystem {
 	return fs
 }
 
+// OverlayFs returns a FileSystem that reads the files in overlay from memory,
+// and all other files from base.  It can be used to analyze unsaved editor
+// buffers, as the files in overlay take precedence over the files in base with
+// the same path, and new files in overlay are returned by globs.
+func OverlayFs(base FileSystem, overlay map[string][]byte) FileSystem {
+	return &overlayFs{
+		base:    base,
+		overlay: MockFs(overlay).(*mockFs),
+	}
+}
+
 type FileSystem interface {
 	Open(name string) (io.ReadCloser, error)
 	Exists(name string) (bool, bool, error)
 	Glob(pattern string, excludes []string) (matches, dirs []string, err error)
 	glob(pattern string) (matches []string, err error)
 	IsDir(name string) (bool, error)
+	EvalSymlinks(name string) (string, error)
 }
 
 // osFs implements FileSystem using the local disk.
@@ -86,6 +99,8 @@ func (osFs) IsDir(name string) (bool, error) {
 	return info.IsDir(), nil
 }
 
+func (osFs) EvalSymlinks(name string) (string, error) { return filepath.EvalSymlinks(name) }
+
 func (fs osFs) Glob(pattern string, excludes []string) (matches, dirs []string, err error) {
 	return startGlob(fs, pattern, excludes)
 }
@@ -133,6 +148,19 @@ func (m *mockFs) IsDir(name string) (bool, error) {
 	return m.dirs[filepath.Clean(name)], nil
 }
 
+// EvalSymlinks returns the clean name of an existing file or directory, as
+// there are no symlinks in a mockFs.
+func (m *mockFs) EvalSymlinks(name string) (string, error) {
+	if exists, _, _ := m.Exists(name); exists {
+		return filepath.Clean(name), nil
+	}
+	return "", &os.PathError{
+		Op:   "lstat",
+		Path: name,
+		Err:  os.ErrNotExist,
+	}
+}
+
 func (m *mockFs) Glob(pattern string, excludes []string) (matches, dirs []string, err error) {
 	return startGlob(m, pattern, excludes)
 }
@@ -150,3 +178,71 @@ func (m *mockFs) glob(pattern string) ([]string, error) {
 	}
 	return matches, nil
 }
+
+// overlayFs implements FileSystem by layering a mockFs over another
+// FileSystem.
+type overlayFs struct {
+	base    FileSystem
+	overlay *mockFs
+}
+
+func (o *overlayFs) Open(name string) (io.ReadCloser, error) {
+	if _, ok := o.overlay.files[filepath.Clean(name)]; ok {
+		return o.overlay.Open(filepath.Clean(name))
+	}
+	return o.base.Open(name)
+}
+
+func (o *overlayFs) Exists(name string) (bool, bool, error) {
+	if exists, isDir, _ := o.overlay.Exists(name); exists {
+		return exists, isDir, nil
+	}
+	return o.base.Exists(name)
+}
+
+func (o *overlayFs) IsDir(name string) (bool, error) {
+	name = filepath.Clean(name)
+	if _, ok := o.overlay.files[name]; ok {
+		return false, nil
+	}
+	if o.overlay.dirs[name] {
+		return true, nil
+	}
+	return o.base.IsDir(name)
+}
+
+func (o *overlayFs) EvalSymlinks(name string) (string, error) {
+	if exists, _, _ := o.overlay.Exists(name); exists {
+		return filepath.Clean(name), nil
+	}
+	return o.base.EvalSymlinks(name)
+}
+
+func (o *overlayFs) Glob(pattern string, excludes []string) (matches, dirs []string, err error) {
+	return startGlob(o, pattern, excludes)
+}
+
+func (o *overlayFs) glob(pattern string) ([]string, error) {
+	matches, err := o.base.glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	overlayMatches, err := o.overlay.glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool, len(matches))
+	for _, m := range matches {
+		found[m] = true
+	}
+	for _, m := range overlayMatches {
+		if !found[m] {
+			matches = append(matches, m)
+		}
+	}
+	sort.Strings(matches)
+
+	return matches, nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pathtools
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestOverlayFs(t *testing.T) {
+	os.Chdir("testdata")
+	defer os.Chdir("..")
+
+	fs := OverlayFs(OsFs, map[string][]byte{
+		"d.ext":   []byte("overlay"),
+		"a/new":   []byte("new"),
+		"f/g.ext": nil,
+	})
+
+	f, err := fs.Open("d.ext")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	contents, _ := ioutil.ReadAll(f)
+	f.Close()
+	if string(contents) != "overlay" {
+		t.Errorf("expected overlay contents for d.ext, got %q", contents)
+	}
+
+	if _, err := fs.Open("e.ext"); err != nil {
+		t.Errorf("unexpected error opening e.ext: %s", err)
+	}
+
+	if exists, isDir, _ := fs.Exists("f"); !exists || !isDir {
+		t.Errorf("expected f to be an overlay directory, got exists=%v isDir=%v", exists, isDir)
+	}
+	if exists, isDir, _ := fs.Exists("c/f/f.ext"); !exists || isDir {
+		t.Errorf("expected c/f/f.ext to be a file, got exists=%v isDir=%v", exists, isDir)
+	}
+
+	testCases := []struct {
+		pattern string
+		matches []string
+	}{
+		{"*", []string{"a", "b", "c", "d.ext", "e.ext", "f"}},
+		{"*.ext", []string{"d.ext", "e.ext"}},
+		{"a/*", []string{"a/a", "a/b", "a/new"}},
+		{"*/g.ext", []string{"f/g.ext"}},
+	}
+
+	for _, testCase := range testCases {
+		matches, _, err := fs.Glob(testCase.pattern, nil)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", testCase.pattern, err)
+			continue
+		}
+		if !reflect.DeepEqual(matches, testCase.matches) {
+			t.Errorf("incorrect matches for %q:", testCase.pattern)
+			t.Errorf("     got: %#v", matches)
+			t.Errorf("expected: %#v", testCase.matches)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pathtools
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// GitFs returns a read-only FileSystem of the files in a revision of the git
+// repository in the directory repo, with paths relative to the top of the
+// repository.  The list of files is read when GitFs is called, and the
+// contents of each file when it is first opened.  Symlinks are files that
+// contain the target of the link, and submodules are not included.  rev may not
+// start with "-", so that it can't be taken for an option of git.
+func GitFs(repo, rev string) (FileSystem, error) {
+	if rev == "" || strings.HasPrefix(rev, "-") {
+		return nil, fmt.Errorf("invalid git revision %q", rev)
+	}
+
+	out, err := git(repo, "ls-tree", "-r", "-z", "--full-tree", rev)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each entry is "<mode> <type> <object>\t<path>".
+	files := make(map[string][]byte)
+	objects := make(map[string]string)
+	for _, entry := range strings.Split(string(out), "\x00") {
+		tab := strings.IndexByte(entry, '\t')
+		if tab < 0 {
+			continue
+		}
+		fields := strings.Fields(entry[:tab])
+		if len(fields) != 3 || fields[1] != "blob" {
+			continue
+		}
+		name := filepath.Clean(entry[tab+1:])
+		files[name] = nil
+		objects[name] = fields[2]
+	}
+
+	return &gitFs{
+		mockFs:   MockFs(files).(*mockFs),
+		repo:     repo,
+		objects:  objects,
+		contents: make(map[string][]byte),
+	}, nil
+}
+
+// gitFs implements FileSystem with the files of a git revision.  The names of
+// the files and directories are in the embedded mockFs, and the contents are
+// read from the objects on demand.
+type gitFs struct {
+	*mockFs
+
+	repo    string
+	objects map[string]string
+
+	lock     sync.Mutex
+	contents map[string][]byte
+}
+
+func (g *gitFs) Open(name string) (io.ReadCloser, error) {
+	name = filepath.Clean(name)
+	object, ok := g.objects[name]
+	if !ok {
+		return nil, &os.PathError{
+			Op:   "open",
+			Path: name,
+			Err:  os.ErrNotExist,
+		}
+	}
+
+	g.lock.Lock()
+	contents, ok := g.contents[name]
+	g.lock.Unlock()
+
+	if !ok {
+		var err error
+		contents, err = git(g.repo, "cat-file", "blob", object)
+		if err != nil {
+			return nil, &os.PathError{
+				Op:   "open",
+				Path: name,
+				Err:  err,
+			}
+		}
+
+		g.lock.Lock()
+		g.contents[name] = contents
+		g.lock.Unlock()
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(contents)), nil
+}
+
+func (g *gitFs) Glob(pattern string, excludes []string) (matches, dirs []string, err error) {
+	return startGlob(g, pattern, excludes)
+}
+
+// git runs git with args in the directory repo and returns its output.
+func git(repo string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = repo
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %s: %s", strings.Join(args, " "), err,
+			strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pathtools
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGitFs(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repo, err := ioutil.TempDir("", "gitfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repo)
+
+	run := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = repo
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s\n%s", args, err, out)
+		}
+	}
+	write := func(name, contents string) {
+		name = filepath.Join(repo, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run("init", "-q")
+	write("Blueprints", "old")
+	write("a/Blueprints", "a")
+	run("add", "-A")
+	run("commit", "-q", "-m", "first")
+	write("Blueprints", "new")
+	write("b/Blueprints", "b")
+	run("add", "-A")
+	run("commit", "-q", "-m", "second")
+
+	fs, err := GitFs(repo, "HEAD~1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := fs.Open("Blueprints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != "old" {
+		t.Errorf("expected the contents of Blueprints in HEAD~1, got %q", contents)
+	}
+
+	if _, err := fs.Open("b/Blueprints"); !os.IsNotExist(err) {
+		t.Errorf("expected b/Blueprints not to exist in HEAD~1, got %v", err)
+	}
+
+	if exists, isDir, _ := fs.Exists("a"); !exists || !isDir {
+		t.Errorf("expected directory a to exist")
+	}
+
+	matches, _, err := fs.Glob("*/Blueprints", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"a/Blueprints"}; !reflect.DeepEqual(matches, expected) {
+		t.Errorf("expected glob matches %q, got %q", expected, matches)
+	}
+
+	if _, err := GitFs(repo, "nonexistent"); err == nil {
+		t.Errorf("expected an error for an unknown revision")
+	}
+
+	for _, rev := range []string{"", "--output=" + filepath.Join(repo, "out"), "-h"} {
+		_, err := GitFs(repo, rev)
+		if err == nil || err.Error() != fmt.Sprintf("invalid git revision %q", rev) {
+			t.Errorf("%q: expected an invalid revision error, got %v", rev, err)
+		}
+	}
+}
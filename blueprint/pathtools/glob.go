@@ -42,6 +42,26 @@ func Glob(pattern string, excludes []string) (matches, deps []string, err error)
 	return startGlob(OsFs, pattern, excludes)
 }
 
+// GlobWithSymlinkPolicy is like Glob, but canonicalizes the matching files and
+// the dependencies with policy.
+func GlobWithSymlinkPolicy(pattern string, excludes []string,
+	policy SymlinkPolicy) (matches, deps []string, err error) {
+
+	matches, deps, err = Glob(pattern, excludes)
+	if err != nil {
+		return nil, nil, err
+	}
+	matches, err = policy.CanonicalizeList(matches)
+	if err != nil {
+		return nil, nil, err
+	}
+	deps, err = policy.CanonicalizeList(deps)
+	if err != nil {
+		return nil, nil, err
+	}
+	return matches, deps, nil
+}
+
 func startGlob(fs FileSystem, pattern string, excludes []string) (matches, deps []string, err error) {
 	if filepath.Base(pattern) == "**" {
 		return nil, nil, GlobLastRecursiveErr
@@ -227,6 +247,12 @@ func filterDotFiles(matches []string) []string {
 	return ret
 }
 
+// Match returns true if name matches pattern using the same rules as the excludes of Glob:
+// those of filepath.Match, but supporting hierarchical patterns (a/*) and recursive globs (**).
+func Match(pattern, name string) (bool, error) {
+	return match(pattern, name)
+}
+
 // match returns true if name matches pattern using the same rules as filepath.Match, but supporting
 // hierarchical patterns (a/*) and recursive globs (**).
 func match(pattern, name string) (bool, error) {
@@ -359,7 +385,15 @@ func HasGlob(in []string) bool {
 // should be used instead, as they will automatically set up dependencies
 // to rerun the primary builder when the list of matching files changes.
 func GlobWithDepFile(glob, fileListFile, depFile string, excludes []string) (files []string, err error) {
-	files, deps, err := Glob(glob, excludes)
+	return GlobWithDepFileAndSymlinkPolicy(glob, fileListFile, depFile, excludes, PreserveSymlinks)
+}
+
+// GlobWithDepFileAndSymlinkPolicy is like GlobWithDepFile, but canonicalizes
+// the matching files and the dependencies with policy before writing them.
+func GlobWithDepFileAndSymlinkPolicy(glob, fileListFile, depFile string, excludes []string,
+	policy SymlinkPolicy) (files []string, err error) {
+
+	files, deps, err := GlobWithSymlinkPolicy(glob, excludes, policy)
 	if err != nil {
 		return nil, err
 	}
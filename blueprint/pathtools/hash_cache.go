@@ -0,0 +1,405 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pathtools
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A HashCache remembers the hashes of the contents of files, keyed by the
+// device, inode, size and modification time of the files, so that files that
+// didn't change are not read again, even by another process when the cache
+// is saved to a file.  It is used by ContentFingerprint, HybridFingerprint and
+// FileSHA256 once it is installed with SetHashCache.
+//
+// A file modified within racyWindow of being hashed is not cached, since it
+// could be modified again without its modification time changing.
+type HashCache struct {
+	// ChunkThreshold is the size from which files are split in chunks with
+	// content-defined boundaries that are hashed in parallel, if it is
+	// positive.  The hash of a chunked file is not its SHA-256 hash, so it
+	// is only used for fingerprints.
+	ChunkThreshold int64
+
+	filename string
+
+	lock    sync.Mutex
+	entries map[hashCacheKey]string
+	used    map[hashCacheKey]bool
+	changed bool
+}
+
+type hashCacheKey struct {
+	dev, ino    uint64
+	size, mtime int64
+	kind        string
+}
+
+const (
+	hashCacheHeader = "# blueprint hash cache v1"
+	racyWindow      = 2 * time.Second
+)
+
+// The kinds of hashes in a HashCache
+const (
+	contentsHash = "contents" // hashContents of files and directories
+	chunkedHash  = "chunked"  // hashContents of files above the ChunkThreshold
+	sha256Hash   = "sha256"   // FileSHA256
+)
+
+// NewHashCache returns a HashCache that reads and saves its entries to
+// filename, or that is kept in memory if filename is empty.  A missing or
+// corrupt file is treated as empty, and replaced by Save.
+func NewHashCache(filename string) (*HashCache, error) {
+	c := &HashCache{
+		filename: filename,
+		entries:  make(map[hashCacheKey]string),
+		used:     make(map[hashCacheKey]bool),
+	}
+	if filename == "" {
+		return c, nil
+	}
+
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	if !s.Scan() || s.Text() != hashCacheHeader {
+		c.changed = true
+		return c, nil
+	}
+	for s.Scan() {
+		key, hash, ok := parseHashCacheEntry(s.Text())
+		if !ok {
+			c.entries = make(map[hashCacheKey]string)
+			c.changed = true
+			return c, nil
+		}
+		c.entries[key] = hash
+	}
+	return c, s.Err()
+}
+
+// parseHashCacheEntry parses a line of the cache file, with the fields of the
+// key and the hash separated by spaces.
+func parseHashCacheEntry(line string) (hashCacheKey, string, bool) {
+	fields := strings.Fields(line)
+	if len(fields) != 6 {
+		return hashCacheKey{}, "", false
+	}
+	var key hashCacheKey
+	var errs [4]error
+	key.dev, errs[0] = strconv.ParseUint(fields[0], 10, 64)
+	key.ino, errs[1] = strconv.ParseUint(fields[1], 10, 64)
+	key.size, errs[2] = strconv.ParseInt(fields[2], 10, 64)
+	key.mtime, errs[3] = strconv.ParseInt(fields[3], 10, 64)
+	for _, err := range errs {
+		if err != nil {
+			return hashCacheKey{}, "", false
+		}
+	}
+	key.kind = fields[4]
+	return key, fields[5], true
+}
+
+// Save writes the entries that were used since the HashCache was created to
+// its file, so that the entries of files that were deleted or modified are
+// dropped.  It does nothing if the cache is kept in memory or no entries
+// changed.
+func (c *HashCache) Save() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.filename == "" || (!c.changed && len(c.used) == len(c.entries)) {
+		return nil
+	}
+
+	lines := make([]string, 0, len(c.used))
+	for key := range c.used {
+		lines = append(lines, fmt.Sprintf("%d %d %d %d %s %s",
+			key.dev, key.ino, key.size, key.mtime, key.kind, c.entries[key]))
+	}
+	sort.Strings(lines)
+
+	tmp, err := ioutil.TempFile(filepath.Dir(c.filename), filepath.Base(c.filename))
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	fmt.Fprintln(w, hashCacheHeader)
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+	err = w.Flush()
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.filename)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// key returns the key of the file in the cache, or false if it can't be
+// cached.
+func (c *HashCache) key(info os.FileInfo, kind string) (hashCacheKey, bool) {
+	if c == nil || time.Since(info.ModTime()) < racyWindow {
+		return hashCacheKey{}, false
+	}
+	dev, ino, ok := fileID(info)
+	if !ok {
+		return hashCacheKey{}, false
+	}
+	return hashCacheKey{
+		dev:   dev,
+		ino:   ino,
+		size:  info.Size(),
+		mtime: info.ModTime().UnixNano(),
+		kind:  kind,
+	}, true
+}
+
+func (c *HashCache) get(key hashCacheKey) (string, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	hash, ok := c.entries[key]
+	if ok {
+		c.used[key] = true
+	}
+	return hash, ok
+}
+
+func (c *HashCache) put(key hashCacheKey, hash string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.entries[key] = hash
+	c.used[key] = true
+	c.changed = true
+}
+
+var (
+	hashCacheLock    sync.Mutex
+	currentHashCache *HashCache
+)
+
+// SetHashCache installs the HashCache used to hash files, or removes it if c
+// is nil.
+func SetHashCache(c *HashCache) {
+	hashCacheLock.Lock()
+	defer hashCacheLock.Unlock()
+	currentHashCache = c
+}
+
+func getHashCache() *HashCache {
+	hashCacheLock.Lock()
+	defer hashCacheLock.Unlock()
+	return currentHashCache
+}
+
+// FileSHA256 returns the hex encoded SHA-256 hash of the contents of the
+// file, or an empty string if it doesn't exist or is a directory.
+func FileSHA256(filename string) (string, error) {
+	return cachedHash(filename, sha256Hash)
+}
+
+// cachedHash returns the hash of the file of the kind contentsHash or
+// sha256Hash, from the installed HashCache if it has it.
+func cachedHash(filename string, kind string) (string, error) {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() && kind == sha256Hash {
+		return "", nil
+	}
+
+	c := getHashCache()
+	if kind == contentsHash && !info.IsDir() && c != nil && c.ChunkThreshold > 0 &&
+		info.Size() >= c.ChunkThreshold {
+		kind = chunkedHash
+	}
+
+	key, cacheable := c.key(info, kind)
+	if cacheable {
+		if hash, ok := c.get(key); ok {
+			return hash, nil
+		}
+	}
+
+	var hash string
+	switch {
+	case info.IsDir():
+		names, err := f.Readdirnames(-1)
+		if err != nil {
+			return "", err
+		}
+		sort.Strings(names)
+		h := sha256.New()
+		for _, name := range names {
+			io.WriteString(h, name+"\n")
+		}
+		hash = hex.EncodeToString(h.Sum(nil))
+	case kind == chunkedHash:
+		hash, err = hashChunks(f)
+	default:
+		h := sha256.New()
+		_, err = io.Copy(h, f)
+		hash = hex.EncodeToString(h.Sum(nil))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if cacheable {
+		c.put(key, hash)
+	}
+	return hash, nil
+}
+
+// The sizes of the chunks of hashChunks.  A boundary is found where the low
+// bits of a rolling hash of the contents are zero, so the chunks are 1 MiB on
+// average.
+const (
+	minChunkSize = 256 * 1024
+	maxChunkSize = 8 * 1024 * 1024
+	chunkMask    = 1<<20 - 1
+)
+
+// gearTable maps each byte to a random value for the rolling hash.
+var gearTable [256]uint64
+
+func init() {
+	// splitmix64, so that the table is the same in every process.
+	x := uint64(0x9e3779b97f4a7c15)
+	for i := range gearTable {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gearTable[i] = z ^ (z >> 31)
+	}
+}
+
+// hashChunks splits the contents of r into chunks with content-defined
+// boundaries, so that the boundaries don't move when bytes are inserted or
+// removed elsewhere in the file, hashes the chunks in parallel and returns the
+// hex encoded SHA-256 hash of their hashes, prefixed with "chunked-".
+func hashChunks(r io.Reader) (string, error) {
+	type chunk struct {
+		data []byte
+		sum  [sha256.Size]byte
+		done chan struct{}
+	}
+
+	var chunks []*chunk
+	sem := make(chan struct{}, runtime.NumCPU())
+
+	// The buffers of the chunks are reused once they are hashed, so that at
+	// most one more buffer than the number of chunks being hashed is needed.
+	free := make(chan []byte, runtime.NumCPU()+1)
+	newBuf := func() []byte {
+		select {
+		case buf := <-free:
+			return buf[:0]
+		default:
+			return make([]byte, 0, maxChunkSize)
+		}
+	}
+
+	hashChunk := func(data []byte) {
+		c := &chunk{data: data, done: make(chan struct{})}
+		chunks = append(chunks, c)
+		sem <- struct{}{}
+		go func() {
+			c.sum = sha256.Sum256(c.data)
+			select {
+			case free <- c.data:
+			default:
+			}
+			c.data = nil
+			<-sem
+			close(c.done)
+		}()
+	}
+
+	block := make([]byte, 1024*1024)
+	buf := newBuf()
+	var rolling uint64
+	for {
+		n, err := io.ReadFull(r, block)
+		data := block[:n]
+		start := 0
+		for i, b := range data {
+			rolling = rolling<<1 + gearTable[b]
+			size := len(buf) + i + 1 - start
+			if size >= maxChunkSize || (size >= minChunkSize && rolling&chunkMask == 0) {
+				hashChunk(append(buf, data[start:i+1]...))
+				buf = newBuf()
+				start = i + 1
+			}
+		}
+		buf = append(buf, data[start:]...)
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			for _, c := range chunks {
+				<-c.done
+			}
+			return "", err
+		}
+	}
+	if len(buf) > 0 || len(chunks) == 0 {
+		hashChunk(buf)
+	}
+
+	h := sha256.New()
+	for _, c := range chunks {
+		<-c.done
+		h.Write(c.sum[:])
+	}
+	return "chunked-" + hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,142 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pathtools
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHashCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hash_cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer SetHashCache(nil)
+
+	file := filepath.Join(dir, "a")
+	mtime := time.Unix(1500000000, 0)
+	write := func(contents string) {
+		if err := ioutil.WriteFile(file, []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sha := func(contents string) string {
+		sum := sha256.Sum256([]byte(contents))
+		return hex.EncodeToString(sum[:])
+	}
+	expectHash := func(expected string) {
+		if hash, err := hashContents(file); err != nil {
+			t.Fatal(err)
+		} else if hash != expected {
+			t.Errorf("expected hash %q, got %q", expected, hash)
+		}
+	}
+
+	cacheFile := filepath.Join(dir, "hash_cache")
+	cache, err := NewHashCache(cacheFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetHashCache(cache)
+
+	write("foo")
+	expectHash(sha("foo"))
+
+	// Rewriting the file with the same size and modification time is not
+	// detected, the hash comes from the cache.
+	write("bar")
+	expectHash(sha("foo"))
+
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	cache, err = NewHashCache(cacheFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetHashCache(cache)
+	expectHash(sha("foo"))
+	if hash, err := FileSHA256(file); err != nil || hash != sha("bar") {
+		t.Errorf("expected FileSHA256 to be cached separately, got %q, %v", hash, err)
+	}
+
+	mtime = mtime.Add(time.Second)
+	write("bar")
+	expectHash(sha("bar"))
+
+	// Recently modified files are not cached.
+	mtime = time.Now()
+	write("baz")
+	expectHash(sha("baz"))
+	write("qux")
+	expectHash(sha("qux"))
+
+	cache.ChunkThreshold = 1
+	if hash, err := hashContents(file); err != nil || !strings.HasPrefix(hash, "chunked-") {
+		t.Errorf("expected a chunked hash, got %q, %v", hash, err)
+	}
+	if hash, err := FileSHA256(file); err != nil || hash != sha("qux") {
+		t.Errorf("expected FileSHA256 not to be chunked, got %q, %v", hash, err)
+	}
+
+	// A corrupt cache file is ignored.
+	if err := ioutil.WriteFile(cacheFile, []byte("corrupt"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if cache, err := NewHashCache(cacheFile); err != nil || len(cache.entries) != 0 {
+		t.Errorf("expected an empty cache from a corrupt file, got %v, %v", cache, err)
+	}
+}
+
+func TestHashChunks(t *testing.T) {
+	data := make([]byte, 8*maxChunkSize)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	hash := func(data []byte) string {
+		hash, err := hashChunks(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+
+	h := hash(data)
+	if h != hash(data) {
+		t.Errorf("expected the same hash for the same contents")
+	}
+
+	modified := append([]byte{0}, data...)
+	if h == hash(modified) {
+		t.Errorf("expected a different hash for different contents")
+	}
+
+	if hash(nil) == hash([]byte{0}) {
+		t.Errorf("expected a different hash for different small contents")
+	}
+}
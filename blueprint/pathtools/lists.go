@@ -15,6 +15,7 @@
 package pathtools
 
 import (
+	"fmt"
 	"path/filepath"
 	"strings"
 )
@@ -38,10 +39,41 @@ func ReplaceExtensions(paths []string, extension string) []string {
 	return result
 }
 
+// ReplaceExtension returns path with the extension of its last element
+// replaced by extension, which must not include the leading dot.  Paths whose
+// last element has no extension are returned unchanged, even if a directory
+// name contains a dot.
 func ReplaceExtension(path string, extension string) string {
 	dot := strings.LastIndex(path, ".")
-	if dot == -1 {
+	if dot == -1 || dot < strings.LastIndex(path, "/") {
 		return path
 	}
 	return path[:dot+1] + extension
 }
+
+// RelativizeToBase returns path relative to base.  Unlike filepath.Rel, it
+// returns an error instead of a path starting with ".." if path is not inside
+// base, so it can also be used to check that a path is inside a directory.
+// base and path must either both be absolute or both be relative.
+func RelativizeToBase(base, path string) (string, error) {
+	if filepath.IsAbs(base) != filepath.IsAbs(path) {
+		return "", fmt.Errorf("cannot relativize %q to %q, only one of them is absolute", path, base)
+	}
+
+	rel, err := filepath.Rel(base, path)
+	if err != nil {
+		return "", err
+	}
+	if escapesBase(rel) {
+		return "", fmt.Errorf("%q is not inside %q", path, base)
+	}
+	return rel, nil
+}
+
+// escapesBase returns true if the clean relative path refers to a file outside
+// of the directory it is relative to.  filepath.Clean and filepath.Rel use the
+// OS separator, so a path starting with "..\" escapes the base on Windows.
+func escapesBase(path string) bool {
+	return path == ".." || strings.HasPrefix(path, "../") ||
+		strings.HasPrefix(path, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,96 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pathtools
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestReplaceExtension(t *testing.T) {
+	testCases := []struct {
+		path, extension, expected string
+	}{
+		{"a/b.c", "o", "a/b.o"},
+		{"a/b.c.d", "o", "a/b.c.o"},
+		{"a/b", "o", "a/b"},
+		{"a.d/b", "o", "a.d/b"},
+		{"a.d/b.c", "o", "a.d/b.o"},
+	}
+
+	for _, testCase := range testCases {
+		got := ReplaceExtension(testCase.path, testCase.extension)
+		if got != testCase.expected {
+			t.Errorf("ReplaceExtension(%q, %q): expected %q, got %q",
+				testCase.path, testCase.extension, testCase.expected, got)
+		}
+	}
+}
+
+func TestRelativizeToBase(t *testing.T) {
+	testCases := []struct {
+		base, path, expected string
+		err                  bool
+	}{
+		{base: "a", path: "a/b/c", expected: "b/c"},
+		{base: "a/", path: "a/./b", expected: "b"},
+		{base: "a", path: "a", expected: "."},
+		{base: ".", path: "b", expected: "b"},
+		{base: "/a", path: "/a/b", expected: "b"},
+		{base: "a", path: "b/c", err: true},
+		{base: "a", path: "a/../b", err: true},
+		{base: "a/b", path: "a", err: true},
+		{base: "a", path: "/a/b", err: true},
+		{base: "/a", path: "a/b", err: true},
+	}
+
+	for _, testCase := range testCases {
+		got, err := RelativizeToBase(testCase.base, testCase.path)
+		if testCase.err {
+			if err == nil {
+				t.Errorf("RelativizeToBase(%q, %q): expected error, got %q",
+					testCase.base, testCase.path, got)
+			}
+		} else if err != nil {
+			t.Errorf("RelativizeToBase(%q, %q): unexpected error %s",
+				testCase.base, testCase.path, err)
+		} else if got != testCase.expected {
+			t.Errorf("RelativizeToBase(%q, %q): expected %q, got %q",
+				testCase.base, testCase.path, testCase.expected, got)
+		}
+	}
+}
+
+func TestEscapesBase(t *testing.T) {
+	testCases := []struct {
+		path     string
+		expected bool
+	}{
+		{"..", true},
+		{"../a", true},
+		{filepath.Join("..", "a"), true},
+		{".." + string(filepath.Separator) + "a", true},
+		{".", false},
+		{"a", false},
+		{"..a", false},
+		{"a/..b", false},
+	}
+
+	for _, testCase := range testCases {
+		if got := escapesBase(testCase.path); got != testCase.expected {
+			t.Errorf("escapesBase(%q): expected %t, got %t", testCase.path, testCase.expected, got)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pathtools
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A FileSegment is a named part of a file written by PatchFile.
+type FileSegment struct {
+	Name string
+	Data []byte
+}
+
+// PatchStats describes the writes made by PatchFile.
+type PatchStats struct {
+	// Rewritten is true if the whole file was written, because it didn't
+	// exist, it was modified since the last PatchFile or it couldn't be
+	// patched.
+	Rewritten bool
+
+	// Written is the number of bytes written to the file.
+	Written int64
+
+	// Changed lists the names of the segments that were written.
+	Changed []string
+}
+
+// patchIndexHeader is the first line of the segment index of a file.
+const patchIndexHeader = "# blueprint segment index v1"
+
+// patchIndexEntry is the position and the hash of a segment in a file.
+type patchIndexEntry struct {
+	offset, length int64
+	hash           string
+	name           string
+}
+
+// PatchIndexPath returns the path of the segment index that PatchFile keeps
+// next to filename.
+func PatchIndexPath(filename string) string {
+	return filename + ".segments"
+}
+
+// PatchFile writes the concatenation of the data of segments to filename.
+// The offsets and hashes of the segments are recorded in an index next to the
+// file, and if the file wasn't modified since it was last written by
+// PatchFile only the segments that changed or moved are written into it.
+// Otherwise the whole file is rewritten.  The modification time of the file is
+// updated even if none of its contents changed.
+//
+// The index is removed before the file is patched so that a file left
+// half-patched by an interrupted PatchFile is rewritten by the next one.
+func PatchFile(filename string, segments []FileSegment, perm os.FileMode) (PatchStats, error) {
+	entries := make([]patchIndexEntry, len(segments))
+	var size int64
+	for i, segment := range segments {
+		hash := sha256.Sum256(segment.Data)
+		entries[i] = patchIndexEntry{
+			offset: size,
+			length: int64(len(segment.Data)),
+			hash:   hex.EncodeToString(hash[:]),
+			name:   segment.Name,
+		}
+		size += entries[i].length
+	}
+
+	indexFile := PatchIndexPath(filename)
+	old, ok := readPatchIndex(filename, indexFile)
+	err := os.Remove(indexFile)
+	if err != nil && !os.IsNotExist(err) {
+		return PatchStats{}, err
+	}
+
+	var stats PatchStats
+	if ok {
+		stats, err = patchSegments(filename, segments, entries, old, size)
+	}
+	if !ok || err != nil {
+		stats, err = rewriteSegments(filename, segments, perm)
+	}
+	if err != nil {
+		return stats, err
+	}
+
+	return stats, writePatchIndex(filename, indexFile, entries)
+}
+
+// patchSegments writes the segments whose entries don't match the entries of
+// the same segments in the index into filename.
+func patchSegments(filename string, segments []FileSegment, entries, old []patchIndexEntry,
+	size int64) (PatchStats, error) {
+
+	var stats PatchStats
+	f, err := os.OpenFile(filename, os.O_WRONLY, 0)
+	if err != nil {
+		return stats, err
+	}
+	defer f.Close()
+
+	for i, entry := range entries {
+		if i < len(old) && old[i].offset == entry.offset && old[i].hash == entry.hash {
+			continue
+		}
+		_, err = f.WriteAt(segments[i].Data, entry.offset)
+		if err != nil {
+			return stats, err
+		}
+		stats.Written += entry.length
+		stats.Changed = append(stats.Changed, entry.name)
+	}
+
+	err = f.Truncate(size)
+	if err != nil {
+		return stats, err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return stats, err
+	}
+
+	now := time.Now()
+	return stats, os.Chtimes(filename, now, now)
+}
+
+// rewriteSegments writes all of segments to filename.
+func rewriteSegments(filename string, segments []FileSegment, perm os.FileMode) (PatchStats, error) {
+	stats := PatchStats{Rewritten: true}
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return stats, err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for _, segment := range segments {
+		_, err = w.Write(segment.Data)
+		if err != nil {
+			return stats, err
+		}
+		stats.Written += int64(len(segment.Data))
+		stats.Changed = append(stats.Changed, segment.Name)
+	}
+
+	err = w.Flush()
+	if err != nil {
+		return stats, err
+	}
+	return stats, f.Close()
+}
+
+// readPatchIndex returns the entries of the index of filename, and false if the
+// index is missing or corrupt or filename doesn't match it.  The size and
+// modification time of the file are checked, as well as the contents of its
+// first and last segments.
+func readPatchIndex(filename, indexFile string) ([]patchIndexEntry, bool) {
+	data, err := ioutil.ReadFile(indexFile)
+	if err != nil {
+		return nil, false
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) < 2 || lines[0] != patchIndexHeader {
+		return nil, false
+	}
+
+	var size, mtime int64
+	_, err = fmt.Sscanf(lines[1], "%d %d", &size, &mtime)
+	if err != nil {
+		return nil, false
+	}
+
+	var entries []patchIndexEntry
+	var offset int64
+	for _, line := range lines[2:] {
+		fields := strings.SplitN(line, " ", 4)
+		if len(fields) != 4 {
+			return nil, false
+		}
+		entry := patchIndexEntry{hash: fields[2], name: fields[3]}
+		entry.offset, err = strconv.ParseInt(fields[0], 10, 64)
+		if err != nil || entry.offset != offset {
+			return nil, false
+		}
+		entry.length, err = strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || entry.length < 0 {
+			return nil, false
+		}
+		offset += entry.length
+		entries = append(entries, entry)
+	}
+	if offset != size {
+		return nil, false
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil || info.Size() != size || info.ModTime().UnixNano() != mtime {
+		return nil, false
+	}
+
+	if len(entries) > 0 {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, false
+		}
+		defer f.Close()
+
+		for _, entry := range []patchIndexEntry{entries[0], entries[len(entries)-1]} {
+			buf := make([]byte, entry.length)
+			_, err := f.ReadAt(buf, entry.offset)
+			hash := sha256.Sum256(buf)
+			if err != nil || hex.EncodeToString(hash[:]) != entry.hash {
+				return nil, false
+			}
+		}
+	}
+
+	return entries, true
+}
+
+// writePatchIndex writes the index of filename, with its current size and
+// modification time followed by a line for each segment.
+func writePatchIndex(filename, indexFile string, entries []patchIndexEntry) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+
+	buf := bytes.NewBuffer(nil)
+	fmt.Fprintln(buf, patchIndexHeader)
+	fmt.Fprintf(buf, "%d %d\n", info.Size(), info.ModTime().UnixNano())
+	for _, entry := range entries {
+		fmt.Fprintf(buf, "%d %d %s %s\n", entry.offset, entry.length, entry.hash,
+			strings.Replace(entry.name, "\n", " ", -1))
+	}
+
+	return ioutil.WriteFile(indexFile, buf.Bytes(), 0666)
+}
@@ -0,0 +1,86 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pathtools
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPatchFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "patch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "build.ninja")
+	patch := func(expected PatchStats, segments ...string) {
+		var fileSegments []FileSegment
+		var contents string
+		for i, s := range segments {
+			fileSegments = append(fileSegments, FileSegment{Name: "abc"[i : i+1], Data: []byte(s)})
+			contents += s
+		}
+
+		stats, err := PatchFile(file, fileSegments, 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(stats, expected) {
+			t.Errorf("expected %+v, got %+v", expected, stats)
+		}
+
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != contents {
+			t.Errorf("expected contents %q, got %q", contents, data)
+		}
+	}
+
+	// There is no index the first time.
+	patch(PatchStats{Rewritten: true, Written: 9, Changed: []string{"a", "b", "c"}},
+		"foo", "bar", "baz")
+
+	patch(PatchStats{}, "foo", "bar", "baz")
+
+	// A segment that changed without moving is written alone.
+	patch(PatchStats{Written: 3, Changed: []string{"b"}}, "foo", "qux", "baz")
+
+	// The segments after a segment that changed its length move.
+	patch(PatchStats{Written: 7, Changed: []string{"b", "c"}}, "foo", "quux", "baz")
+
+	// Shrinking the file truncates it.
+	patch(PatchStats{Written: 2, Changed: []string{"b"}}, "foo", "qu")
+
+	// The file is rewritten if it was modified since it was patched.
+	err = ioutil.WriteFile(file, []byte("xxxqu"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch(PatchStats{Rewritten: true, Written: 5, Changed: []string{"a", "b"}}, "foo", "qu")
+
+	// The file is rewritten if the index is missing.
+	err = os.Remove(PatchIndexPath(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch(PatchStats{Rewritten: true, Written: 5, Changed: []string{"a", "b"}}, "foo", "qu")
+}
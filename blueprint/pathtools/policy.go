@@ -0,0 +1,112 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pathtools
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// An OutputPathPolicy describes the output paths that build statements may
+// declare.  By default outputs must be relative paths that stay inside the
+// directory Ninja is run from, and each output may only be declared once.
+// The allowlists relax these rules for the paths a project needs.
+type OutputPathPolicy struct {
+	// AllowedAbsoluteDirs lists the directories that absolute output paths
+	// may be in.
+	AllowedAbsoluteDirs []string
+
+	// AllowedParentDirs lists the directories outside of the directory
+	// Ninja is run from, like "../dist", that relative output paths may be in.
+	AllowedParentDirs []string
+
+	// AllowedCollisions lists the output paths that may be declared by more
+	// than one build statement, for example because only one of the Ninja
+	// files declaring them is used at a time.
+	AllowedCollisions []string
+}
+
+// An OutputPathError is returned by OutputPathChecker.Check for an output path
+// that violates the policy.
+type OutputPathError struct {
+	Path   string
+	Owner  string
+	Reason string
+}
+
+func (e *OutputPathError) Error() string {
+	return fmt.Sprintf("%s: invalid output path %q: %s", e.Owner, e.Path, e.Reason)
+}
+
+// An OutputPathChecker checks output paths against an OutputPathPolicy,
+// remembering the paths it has seen to detect collisions.
+type OutputPathChecker struct {
+	policy  OutputPathPolicy
+	outputs map[string]string
+}
+
+// NewChecker returns an OutputPathChecker that enforces the policy.
+func (p *OutputPathPolicy) NewChecker() *OutputPathChecker {
+	return &OutputPathChecker{
+		policy:  *p,
+		outputs: make(map[string]string),
+	}
+}
+
+// Check returns an *OutputPathError if path is an absolute path or escapes
+// the directory Ninja is run from without being allowed by the policy, or if
+// it was already declared by a different owner.  owner describes the build
+// statement declaring path in error messages.
+func (c *OutputPathChecker) Check(path, owner string) error {
+	clean := filepath.Clean(path)
+
+	if filepath.IsAbs(clean) {
+		if !inAnyDir(clean, c.policy.AllowedAbsoluteDirs) {
+			return &OutputPathError{path, owner, "absolute paths are not allowed"}
+		}
+	} else if escapesBase(clean) {
+		if !inAnyDir(clean, c.policy.AllowedParentDirs) {
+			return &OutputPathError{path, owner, `paths outside of the build directory ("..") are not allowed`}
+		}
+	}
+
+	if prev, ok := c.outputs[clean]; ok {
+		if !containsPath(c.policy.AllowedCollisions, clean) {
+			return &OutputPathError{path, owner, "also declared by " + prev}
+		}
+	} else {
+		c.outputs[clean] = owner
+	}
+
+	return nil
+}
+
+func inAnyDir(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if _, err := RelativizeToBase(filepath.Clean(dir), path); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func containsPath(paths []string, path string) bool {
+	for _, p := range paths {
+		if filepath.Clean(p) == path {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pathtools
+
+import (
+	"testing"
+)
+
+func TestOutputPathPolicy(t *testing.T) {
+	policy := &OutputPathPolicy{
+		AllowedAbsoluteDirs: []string{"/tmp/dist"},
+		AllowedParentDirs:   []string{"../shared/"},
+		AllowedCollisions:   []string{"out/./stamp"},
+	}
+
+	testCases := []struct {
+		path  string
+		owner string
+		err   string
+	}{
+		{path: "out/a.o", owner: "a"},
+		{path: "/tmp/dist/a.zip", owner: "a"},
+		{path: "../shared/b.o", owner: "b"},
+		{path: "out/stamp", owner: "a"},
+		{path: "out/stamp", owner: "b"},
+		{
+			path:  "/tmp/a.o",
+			owner: "a",
+			err:   `a: invalid output path "/tmp/a.o": absolute paths are not allowed`,
+		},
+		{
+			path:  "out/../../b.o",
+			owner: "b",
+			err:   `b: invalid output path "out/../../b.o": paths outside of the build directory ("..") are not allowed`,
+		},
+		{
+			path:  "out//a.o",
+			owner: "b",
+			err:   `b: invalid output path "out//a.o": also declared by a`,
+		},
+	}
+
+	checker := policy.NewChecker()
+	for _, testCase := range testCases {
+		err := checker.Check(testCase.path, testCase.owner)
+		if testCase.err == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected error %s", testCase.path, err)
+			}
+		} else if err == nil {
+			t.Errorf("%q: expected error %q", testCase.path, testCase.err)
+		} else if err.Error() != testCase.err {
+			t.Errorf("%q: expected error %q, got %q", testCase.path, testCase.err, err.Error())
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pathtools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// A SymlinkPolicy describes how paths that go through symlinks are
+// canonicalized.  Every tool that writes paths that are compared with each
+// other, like the primary builder writing glob results and the Ninja file
+// dependencies, and bpglob updating the glob results during the build, must
+// use the same policy, or the paths they write will disagree when the source
+// tree is reached through a symlink.
+type SymlinkPolicy int
+
+const (
+	// PreserveSymlinks leaves paths as they are, so a path through a
+	// symlink refers to the symlink.  It is the default.
+	PreserveSymlinks SymlinkPolicy = iota
+
+	// ResolveSymlinks replaces the symlinks in paths with their targets.
+	// Relative paths stay relative to the working directory, but are
+	// computed from the physical working directory, so ".." in a path
+	// refers to the same directory as it does for the kernel.
+	ResolveSymlinks
+)
+
+func (p SymlinkPolicy) String() string {
+	switch p {
+	case PreserveSymlinks:
+		return "preserve"
+	case ResolveSymlinks:
+		return "resolve"
+	default:
+		return fmt.Sprintf("SymlinkPolicy(%d)", int(p))
+	}
+}
+
+// ParseSymlinkPolicy returns the SymlinkPolicy named by s, either "preserve"
+// or "resolve".
+func ParseSymlinkPolicy(s string) (SymlinkPolicy, error) {
+	switch s {
+	case "preserve":
+		return PreserveSymlinks, nil
+	case "resolve":
+		return ResolveSymlinks, nil
+	default:
+		return PreserveSymlinks, fmt.Errorf("unknown symlink policy %q, expected preserve or resolve", s)
+	}
+}
+
+// Canonicalize returns the canonical form of path under the policy.  With
+// ResolveSymlinks, the symlinks in the longest prefix of path that exists are
+// resolved, and the rest of path is appended, so paths of files that don't
+// exist yet can be canonicalized too.
+func (p SymlinkPolicy) Canonicalize(path string) (string, error) {
+	return p.CanonicalizeFs(OsFs, path)
+}
+
+// CanonicalizeFs is like Canonicalize, but resolves the symlinks in fs.
+func (p SymlinkPolicy) CanonicalizeFs(fs FileSystem, path string) (string, error) {
+	if p != ResolveSymlinks {
+		return path, nil
+	}
+
+	resolved, err := resolveExistingPrefix(fs, path)
+	if err != nil {
+		return "", err
+	}
+	if filepath.IsAbs(path) || !filepath.IsAbs(resolved) {
+		return resolved, nil
+	}
+
+	// A symlink in the relative path points to an absolute path, make it
+	// relative to the physical working directory again.
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	wd, err = fs.EvalSymlinks(wd)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Rel(wd, resolved)
+}
+
+// CanonicalizeList calls Canonicalize on each element of paths, and returns a
+// new slice containing the canonical paths.
+func (p SymlinkPolicy) CanonicalizeList(paths []string) ([]string, error) {
+	return p.CanonicalizeListFs(OsFs, paths)
+}
+
+// CanonicalizeListFs is like CanonicalizeList, but resolves the symlinks in
+// fs.
+func (p SymlinkPolicy) CanonicalizeListFs(fs FileSystem, paths []string) ([]string, error) {
+	if p != ResolveSymlinks || paths == nil {
+		return paths, nil
+	}
+
+	ret := make([]string, len(paths))
+	for i, path := range paths {
+		canonical, err := p.CanonicalizeFs(fs, path)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = canonical
+	}
+	return ret, nil
+}
+
+// resolveExistingPrefix resolves the symlinks in the longest prefix of path
+// that exists in fs.
+func resolveExistingPrefix(fs FileSystem, path string) (string, error) {
+	resolved, err := fs.EvalSymlinks(path)
+	if err == nil {
+		return resolved, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	dir, file := filepath.Split(path)
+	dir = filepath.Clean(dir)
+	if dir == path {
+		return path, nil
+	}
+	resolvedDir, err := resolveExistingPrefix(fs, dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(resolvedDir, file), nil
+}
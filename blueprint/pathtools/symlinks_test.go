@@ -0,0 +1,188 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pathtools
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// setupSymlinkTree creates a source tree under real/ that is reached through
+// the symlink link/, and an output directory out/ inside it that is a symlink
+// to elsewhere/out, and changes to the directory of link/out.  It returns a
+// function that restores the working directory and removes the tree.
+func setupSymlinkTree(t *testing.T) (string, func()) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmp, err := ioutil.TempDir("", "symlinks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp, err = filepath.EvalSymlinks(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup := func() {
+		os.Chdir(wd)
+		os.RemoveAll(tmp)
+	}
+
+	for _, dir := range []string{"real/src", "elsewhere/out"} {
+		if err := os.MkdirAll(filepath.Join(tmp, dir), 0777); err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{"real/src/a.c", "real/src/b.c"} {
+		if err := ioutil.WriteFile(filepath.Join(tmp, file), nil, 0666); err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"link":     "real",
+		"real/out": "../elsewhere/out",
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, filepath.Join(tmp, link)); err != nil {
+			cleanup()
+			t.Skipf("symlinks not supported: %s", err)
+		}
+	}
+
+	if err := os.Chdir(filepath.Join(tmp, "link/out")); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+
+	return tmp, cleanup
+}
+
+func TestCanonicalize(t *testing.T) {
+	tmp, cleanup := setupSymlinkTree(t)
+	defer cleanup()
+
+	testCases := []struct {
+		policy SymlinkPolicy
+		in     string
+		out    string
+	}{
+		{PreserveSymlinks, "../src/a.c", "../src/a.c"},
+		{PreserveSymlinks, filepath.Join(tmp, "link/src/a.c"), filepath.Join(tmp, "link/src/a.c")},
+
+		// The working directory is physically elsewhere/out, so ".." is
+		// elsewhere, where there is no src.
+		{ResolveSymlinks, ".", "."},
+		{ResolveSymlinks, "gen/x.c", "gen/x.c"},
+		{ResolveSymlinks, "../src/a.c", "../src/a.c"},
+		{ResolveSymlinks, filepath.Join(tmp, "link/src/a.c"), filepath.Join(tmp, "real/src/a.c")},
+		{ResolveSymlinks, filepath.Join(tmp, "link/src/new/c.c"), filepath.Join(tmp, "real/src/new/c.c")},
+		{ResolveSymlinks, filepath.Join(tmp, "link/out/gen"), filepath.Join(tmp, "elsewhere/out/gen")},
+		{ResolveSymlinks, "../../real/src/a.c", "../../real/src/a.c"},
+		{ResolveSymlinks, "../../link/src", "../../real/src"},
+	}
+
+	for _, testCase := range testCases {
+		out, err := testCase.policy.Canonicalize(testCase.in)
+		if err != nil {
+			t.Errorf("%s %q: unexpected error %s", testCase.policy, testCase.in, err)
+			continue
+		}
+		if out != testCase.out {
+			t.Errorf("%s %q: expected %q, got %q", testCase.policy, testCase.in, testCase.out, out)
+		}
+	}
+}
+
+func TestCanonicalizeFs(t *testing.T) {
+	tmp, cleanup := setupSymlinkTree(t)
+	defer cleanup()
+
+	// A mock filesystem has no symlinks, even where the disk has them.
+	linkPath := filepath.Join(tmp, "link/src/a.c")
+	fs := MockFs(map[string][]byte{
+		linkPath:      nil,
+		"Blueprints":  nil,
+		"dir/file.go": nil,
+	})
+
+	testCases := []struct {
+		in, out string
+	}{
+		{linkPath, linkPath},
+		{filepath.Join(tmp, "link/src/new.c"), filepath.Join(tmp, "link/src/new.c")},
+		{"Blueprints", "Blueprints"},
+		{"./dir/../dir/file.go", "dir/file.go"},
+		{"dir/new/x.c", "dir/new/x.c"},
+	}
+
+	for _, testCase := range testCases {
+		out, err := ResolveSymlinks.CanonicalizeFs(fs, testCase.in)
+		if err != nil {
+			t.Errorf("%q: unexpected error %s", testCase.in, err)
+			continue
+		}
+		if out != testCase.out {
+			t.Errorf("%q: expected %q, got %q", testCase.in, testCase.out, out)
+		}
+	}
+}
+
+func TestGlobWithSymlinkPolicy(t *testing.T) {
+	tmp, cleanup := setupSymlinkTree(t)
+	defer cleanup()
+
+	pattern := filepath.Join(tmp, "link/src/*.c")
+
+	matches, deps, err := GlobWithSymlinkPolicy(pattern, nil, PreserveSymlinks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := []string{filepath.Join(tmp, "link/src/a.c"), filepath.Join(tmp, "link/src/b.c")}; !reflect.DeepEqual(matches, w) {
+		t.Errorf("preserve: expected matches %q, got %q", w, matches)
+	}
+	if w := []string{filepath.Join(tmp, "link/src")}; !reflect.DeepEqual(deps, w) {
+		t.Errorf("preserve: expected deps %q, got %q", w, deps)
+	}
+
+	matches, deps, err = GlobWithSymlinkPolicy(pattern, nil, ResolveSymlinks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := []string{filepath.Join(tmp, "real/src/a.c"), filepath.Join(tmp, "real/src/b.c")}; !reflect.DeepEqual(matches, w) {
+		t.Errorf("resolve: expected matches %q, got %q", w, matches)
+	}
+	if w := []string{filepath.Join(tmp, "real/src")}; !reflect.DeepEqual(deps, w) {
+		t.Errorf("resolve: expected deps %q, got %q", w, deps)
+	}
+}
+
+func TestParseSymlinkPolicy(t *testing.T) {
+	for _, policy := range []SymlinkPolicy{PreserveSymlinks, ResolveSymlinks} {
+		parsed, err := ParseSymlinkPolicy(policy.String())
+		if err != nil || parsed != policy {
+			t.Errorf("%s: expected %s, got %s, %v", policy, policy, parsed, err)
+		}
+	}
+	if _, err := ParseSymlinkPolicy("follow"); err == nil {
+		t.Errorf("expected an error for an unknown policy")
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+// A PoolPolicy returns the Ninja pool for a build statement, or nil to use the
+// pool of the build statement's rule.  It allows the primary builder to
+// throttle resource hungry build statements, for example all links or all
+// build statements of a module type, without setting the pool in every rule.
+//
+// A PoolPolicy is called from multiple goroutines, so it must be reentrant.
+type PoolPolicy func(info PoolPolicyInfo) Pool
+
+// PoolPolicyInfo describes the build statement passed to a PoolPolicy.
+type PoolPolicyInfo struct {
+	// The name, type and directory of the module that created the build
+	// statement, or empty for singletons.
+	ModuleName string
+	ModuleType string
+	ModuleDir  string
+
+	// The name of the singleton that created the build statement, or empty
+	// for modules.
+	SingletonName string
+
+	// The name of the rule of the build statement, as passed to StaticRule,
+	// RuleFunc or ModuleContext.Rule.
+	RuleName string
+}
+
+// SetPoolPolicy sets the PoolPolicy that assigns the pools of the build
+// statements created by modules and singletons.  The pool returned by the
+// policy overrides the Pool of the rule, and is defined in the Ninja file even
+// if no rule uses it.  Interactive build statements are not passed to the
+// policy.
+func (c *Context) SetPoolPolicy(policy PoolPolicy) {
+	c.poolPolicy = policy
+}
+
+// applyPoolPolicy sets the pool of each build statement in defs that the pool
+// policy returns a pool for.
+func (c *Context) applyPoolPolicy(defs []*buildDef, info PoolPolicyInfo) {
+	if c.poolPolicy == nil {
+		return
+	}
+
+	for _, def := range defs {
+		if def.Pool == Console {
+			continue
+		}
+		info.RuleName = def.Rule.name()
+		def.Pool = c.poolPolicy(info)
+	}
+}
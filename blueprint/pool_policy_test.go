@@ -0,0 +1,81 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+var poolPolicyTestPool = verifyTestPctx.StaticPool("heavy", PoolParams{
+	Depth: 2,
+})
+
+func TestPoolPolicy(t *testing.T) {
+	ctx := NewContext()
+	ctx.RegisterModuleType("outputs_module", newOutputsModule)
+	ctx.SetPoolPolicy(func(info PoolPolicyInfo) Pool {
+		if info.ModuleDir == "heavy" && info.RuleName == "touch" {
+			return poolPolicyTestPool
+		}
+		return nil
+	})
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			subdirs = ["*"]
+		`),
+		"heavy/Blueprints": []byte(`
+			outputs_module {
+			    name: "A",
+			    outs: ["a.txt"],
+			}
+		`),
+		"light/Blueprints": []byte(`
+			outputs_module {
+			    name: "B",
+			    outs: ["b.txt"],
+			}
+		`),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) == 0 {
+		_, errs = ctx.PrepareBuildActions(nil)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := ctx.WriteBuildFile(buf); err != nil {
+		t.Fatalf("unexpected error writing build file: %s", err)
+	}
+	out := buf.String()
+
+	if !strings.Contains(out, "pool g.verifytest.heavy\n    depth = 2\n") {
+		t.Errorf("missing pool definition in:\n%s", out)
+	}
+
+	expected := "build ${g.verifytest.outDir}/a.txt: g.verifytest.touch\n" +
+		"    pool = g.verifytest.heavy\n"
+	if !strings.Contains(out, expected) {
+		t.Errorf("missing build statement %q in:\n%s", expected, out)
+	}
+
+	if strings.Count(out, "pool = ") != 1 {
+		t.Errorf("expected a single build statement with a pool in:\n%s", out)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"fmt"
+	"text/scanner"
+
+	"github.com/google/blueprint/parser"
+	"github.com/google/blueprint/pathtools"
+)
+
+// A Preprocessor is called on every parsed Blueprints file before the module
+// definitions in it are unpacked into property structs.  It may modify the
+// file in place, for example to expand project specific macros into module
+// definitions.  Variables in the file have already been evaluated.
+//
+// Preprocessors are called from multiple goroutines, one per Blueprints file.
+// New AST nodes should copy the positions of the nodes they are derived from,
+// so that errors reported for them point at the original Blueprints file
+// location.
+type Preprocessor func(ctx PreprocessorContext, file *parser.File)
+
+// A PreprocessorContext is passed to a Preprocessor.
+type PreprocessorContext interface {
+	// BlueprintsFile returns the path of the Blueprints file being processed,
+	// relative to the directory of the root Blueprints file.
+	BlueprintsFile() string
+
+	// Errorf reports an error at the given position of the Blueprints file.
+	Errorf(pos scanner.Position, format string, args ...interface{})
+
+	// AddNinjaFileDeps adds files that the preprocessor read, so that the
+	// Ninja file is regenerated when they change.
+	AddNinjaFileDeps(deps ...string)
+
+	Fs() pathtools.FileSystem
+}
+
+type preprocessorInfo struct {
+	name         string
+	fingerprint  string
+	preprocessor Preprocessor
+}
+
+// RegisterPreprocessor registers a Preprocessor that will be called on every
+// Blueprints file after it has been parsed.  Preprocessors are called in
+// registration order.  The fingerprint should change whenever the behavior of
+// the preprocessor changes, for example by including a version number; the
+// name and fingerprint of every preprocessor are written to the header of the
+// Ninja file, so a change causes the Ninja file to be rewritten even if the
+// generated build actions are the same.
+func (c *Context) RegisterPreprocessor(name, fingerprint string, preprocessor Preprocessor) {
+	for _, p := range c.preprocessors {
+		if p.name == name {
+			panic(fmt.Errorf("preprocessor name %s is already registered", name))
+		}
+	}
+
+	c.preprocessors = append(c.preprocessors, &preprocessorInfo{
+		name:         name,
+		fingerprint:  fingerprint,
+		preprocessor: preprocessor,
+	})
+}
+
+type preprocessorContext struct {
+	context       *Context
+	file          *parser.File
+	ninjaFileDeps []string
+	errs          []error
+}
+
+func (p *preprocessorContext) BlueprintsFile() string {
+	return p.file.Name
+}
+
+func (p *preprocessorContext) Errorf(pos scanner.Position, format string, args ...interface{}) {
+	p.errs = append(p.errs, &BlueprintError{
+		Err: fmt.Errorf(format, args...),
+		Pos: pos,
+	})
+}
+
+func (p *preprocessorContext) AddNinjaFileDeps(deps ...string) {
+	p.ninjaFileDeps = append(p.ninjaFileDeps, deps...)
+}
+
+func (p *preprocessorContext) Fs() pathtools.FileSystem {
+	return p.context.fs
+}
+
+// runPreprocessors calls each registered Preprocessor on file, and returns the
+// Ninja file dependencies they added.
+func (c *Context) runPreprocessors(file *parser.File) (deps []string, errs []error) {
+	for _, info := range c.preprocessors {
+		pctx := &preprocessorContext{
+			context: c,
+			file:    file,
+		}
+
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					pctx.errs = append(pctx.errs, newPanicErrorf(r,
+						"preprocessor %s for %s", info.name, file.Name))
+				}
+			}()
+			info.preprocessor(pctx, file)
+		}()
+
+		deps = append(deps, pctx.ninjaFileDeps...)
+		if len(pctx.errs) > 0 {
+			return deps, pctx.errs
+		}
+	}
+
+	return deps, nil
+}
@@ -0,0 +1,146 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/blueprint/parser"
+)
+
+// expandFooPairs replaces each foo_pair module with two foo_modules named
+// <name>_a and <name>_b.
+func expandFooPairs(ctx PreprocessorContext, file *parser.File) {
+	var defs []parser.Definition
+	for _, def := range file.Defs {
+		m, ok := def.(*parser.Module)
+		if !ok || m.Type != "foo_pair" {
+			defs = append(defs, def)
+			continue
+		}
+
+		name, found := m.GetProperty("name")
+		if !found {
+			ctx.Errorf(m.TypePos, "foo_pair must have a name")
+			continue
+		}
+
+		for _, suffix := range []string{"_a", "_b"} {
+			module := m.Copy()
+			module.Type = "foo_module"
+			prop, _ := module.GetProperty("name")
+			prop.Value = &parser.String{
+				LiteralPos: name.Value.Pos(),
+				Value:      name.Value.(*parser.String).Value + suffix,
+			}
+			defs = append(defs, module)
+		}
+	}
+	file.Defs = defs
+}
+
+func TestPreprocessor(t *testing.T) {
+	ctx := NewContext()
+	ctx.RegisterModuleType("foo_module", newFooModule)
+	ctx.RegisterPreprocessor("foo_pairs", "v1", expandFooPairs)
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			foo_pair {
+			    name: "A",
+			}
+
+			foo_pair {
+			    foo: "no name",
+			}
+
+			foo_pair {
+			    name: "B",
+			    deps: ["A_a", "missing"],
+			}
+		`),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) != 1 || errs[0].Error() != "Blueprints:6:4: foo_pair must have a name" {
+		t.Errorf("expected preprocessor error, got %q", errs)
+	}
+
+	ctx = NewContext()
+	ctx.RegisterModuleType("foo_module", newFooModule)
+	ctx.RegisterPreprocessor("foo_pairs", "v1", expandFooPairs)
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			foo_pair {
+			    name: "A",
+			}
+
+			foo_pair {
+			    name: "B",
+			    deps: ["A_a", "missing"],
+			}
+		`),
+	})
+
+	_, errs = ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) == 0 {
+		errs = ctx.ResolveDependencies(nil)
+	}
+
+	// The dependency error is reported at the position of the original
+	// foo_pair module.
+	if len(errs) == 0 || !strings.HasPrefix(errs[0].Error(), "Blueprints:6:4: ") {
+		t.Fatalf("expected dependency error at Blueprints:6:4, got %q", errs)
+	}
+
+	ctx = NewContext()
+	ctx.RegisterModuleType("foo_module", newFooModule)
+	ctx.RegisterPreprocessor("foo_pairs", "v1", expandFooPairs)
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			foo_pair {
+			    name: "A",
+			}
+
+			foo_pair {
+			    name: "B",
+			    deps: ["A_a"],
+			}
+		`),
+	})
+
+	_, errs = ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) == 0 {
+		_, errs = ctx.PrepareBuildActions(nil)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+
+	for _, name := range []string{"A_a", "A_b", "B_a", "B_b"} {
+		if ctx.moduleNames[name] == nil {
+			t.Errorf("missing expanded module %q", name)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := ctx.WriteBuildFile(buf); err != nil {
+		t.Fatalf("unexpected error writing build file: %s", err)
+	}
+	if !strings.Contains(buf.String(), "#     foo_pairs [v1]\n") {
+		t.Errorf("missing preprocessor fingerprint in build file header:\n%s", buf.String())
+	}
+}
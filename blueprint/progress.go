@@ -0,0 +1,104 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import "sync"
+
+// Progress is the progress of a phase of evaluating the Blueprints files,
+// passed to the function set with SetProgressReporter.
+type Progress struct {
+	// Phase is "parse" while parsing the Blueprints files, and "generate"
+	// while generating the build actions of the modules.
+	Phase string
+
+	// Done is the number of Blueprints files parsed or of module variants
+	// generated.
+	Done int
+
+	// Total is the number of Blueprints files found so far, which grows as
+	// parsing finds more of them, or the number of module variants.
+	Total int
+
+	// Finished is set in the last report of the phase, and Canceled too if
+	// the phase stopped before it was done because of errors.
+	Finished bool
+	Canceled bool
+}
+
+// SetProgressReporter sets a function that is called every time a Blueprints
+// file is parsed or the build actions of a module variant are generated, and
+// once more at the end of each phase, so that a primary builder can show the
+// progress of evaluating large source trees.  The calls are serialized, but
+// they are made from the goroutines doing the work, so report should return
+// quickly.
+func (c *Context) SetProgressReporter(report func(Progress)) {
+	c.progressReporter = report
+}
+
+// progressTracker counts the progress of a phase for the progress reporter.
+// The methods of a nil progressTracker do nothing.
+type progressTracker struct {
+	lock     sync.Mutex
+	report   func(Progress)
+	progress Progress
+}
+
+// startProgress returns the progressTracker of a phase with total steps, or
+// nil if there is no progress reporter.
+func (c *Context) startProgress(phase string, total int) *progressTracker {
+	if c.progressReporter == nil {
+		return nil
+	}
+	p := &progressTracker{
+		report:   c.progressReporter,
+		progress: Progress{Phase: phase, Total: total},
+	}
+	p.report(p.progress)
+	return p
+}
+
+// add adds n steps to the total of the phase.
+func (p *progressTracker) add(n int) {
+	if p == nil {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.progress.Total += n
+}
+
+// done reports that a step of the phase is done.
+func (p *progressTracker) done() {
+	if p == nil {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.progress.Done++
+	p.report(p.progress)
+}
+
+// finish reports the end of the phase, which stopped early if canceled is
+// true.
+func (p *progressTracker) finish(canceled bool) {
+	if p == nil {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.progress.Finished = true
+	p.progress.Canceled = canceled
+	p.report(p.progress)
+}
@@ -0,0 +1,95 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestProgressReporter(t *testing.T) {
+	var lock sync.Mutex
+	last := make(map[string]Progress)
+	reports := make(map[string]int)
+
+	ctx := NewContext()
+	ctx.RegisterModuleType("foo_module", newFooModule)
+	ctx.RegisterModuleType("bar_module", newBarModule)
+	ctx.SetProgressReporter(func(p Progress) {
+		lock.Lock()
+		defer lock.Unlock()
+		if last[p.Phase].Finished {
+			t.Errorf("%s: reported %#v after the phase finished", p.Phase, p)
+		}
+		last[p.Phase] = p
+		reports[p.Phase]++
+	})
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			subdirs = ["a", "b"]
+			foo_module { name: "A", deps: ["B"] }
+		`),
+		"a/Blueprints": []byte(`bar_module { name: "B" }`),
+		"b/Blueprints": []byte(`bar_module { name: "C" }`),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) == 0 {
+		errs = ctx.ResolveDependencies(nil)
+	}
+	if len(errs) == 0 {
+		_, errs = ctx.PrepareBuildActions(nil)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+
+	expected := map[string]Progress{
+		"parse":    {Phase: "parse", Done: 3, Total: 3, Finished: true},
+		"generate": {Phase: "generate", Done: 3, Total: 3, Finished: true},
+	}
+	if !reflect.DeepEqual(last, expected) {
+		t.Errorf("incorrect last progress:\n%#v\nexpected:\n%#v", last, expected)
+	}
+	// The phases report once when they start, once per step and once when
+	// they finish.
+	if reports["parse"] != 5 || reports["generate"] != 5 {
+		t.Errorf("expected 5 reports per phase, got %v", reports)
+	}
+}
+
+func TestProgressReporterCanceled(t *testing.T) {
+	var last Progress
+
+	ctx := NewContext()
+	ctx.RegisterModuleType("foo_module", newFooModule)
+	ctx.SetProgressReporter(func(p Progress) {
+		last = p
+	})
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`foo_module { name: "A"`),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) == 0 {
+		t.Fatalf("expected parse errors")
+	}
+
+	expected := Progress{Phase: "parse", Done: 1, Total: 1, Finished: true, Canceled: true}
+	if last != expected {
+		t.Errorf("incorrect last progress:\n%#v\nexpected:\n%#v", last, expected)
+	}
+}
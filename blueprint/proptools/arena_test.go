@@ -0,0 +1,102 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proptools
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestArenaCloneProperties(t *testing.T) {
+	type nested struct {
+		S []string
+	}
+	type props struct {
+		A []string
+		B *nested
+		C nested
+	}
+
+	arena := NewArena(16)
+
+	in := &props{
+		A: []string{"a1", "a2"},
+		B: &nested{S: []string{"b"}},
+		C: nested{S: []string{"c1", "c2", "c3"}},
+	}
+
+	var clones []*props
+	for i := 0; i < 20; i++ {
+		clones = append(clones, arena.CloneProperties(reflect.ValueOf(in).Elem()).Interface().(*props))
+	}
+
+	for _, clone := range clones {
+		if !reflect.DeepEqual(clone, in) {
+			t.Fatalf("incorrect clone:\n%#v\nexpected:\n%#v", clone, in)
+		}
+	}
+
+	// Appending to a slice allocated from the arena must not modify the
+	// slice allocated after it.
+	clones[0].A = append(clones[0].A, "x")
+	if clones[0].B.S[0] != "b" {
+		t.Errorf("append overwrote arena slice: %q", clones[0].B.S)
+	}
+
+	stats := arena.Stats()
+	expected := ArenaStats{
+		Structs:      40,
+		StructBlocks: 4,
+		Strings:      120,
+		StringBlocks: 8,
+	}
+	stats.Bytes = 0
+	if stats != expected {
+		t.Errorf("incorrect stats: %+v, expected %+v", stats, expected)
+	}
+}
+
+func TestArenaCloneEmptyAndNamedSlices(t *testing.T) {
+	type name string
+	type props struct {
+		Empty []string
+		Nil   []string
+		Names []name
+	}
+
+	arena := NewArena(16)
+
+	in := &props{
+		Empty: []string{},
+		Names: []name{"a", "b"},
+	}
+
+	clone := arena.CloneProperties(reflect.ValueOf(in).Elem()).Interface().(*props)
+	if !reflect.DeepEqual(clone, in) {
+		t.Fatalf("incorrect clone:\n%#v\nexpected:\n%#v", clone, in)
+	}
+
+	// An explicitly empty list must stay distinguishable from an unset one.
+	if clone.Empty == nil {
+		t.Errorf("empty slice was cloned as nil")
+	}
+	if clone.Nil != nil {
+		t.Errorf("nil slice was cloned as %#v", clone.Nil)
+	}
+
+	if stats := arena.Stats(); stats.Strings != 0 {
+		t.Errorf("expected no strings allocated from the arena, got %d", stats.Strings)
+	}
+}
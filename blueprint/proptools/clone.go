@@ -22,12 +22,22 @@ import (
 )
 
 func CloneProperties(structValue reflect.Value) reflect.Value {
-	result := reflect.New(structValue.Type())
-	CopyProperties(result.Elem(), structValue)
+	return cloneProperties(structValue, nil)
+}
+
+func cloneProperties(structValue reflect.Value, arena *Arena) reflect.Value {
+	result := arena.new(structValue.Type())
+	copyProperties(result.Elem(), structValue, arena)
 	return result
 }
 
 func CopyProperties(dstValue, srcValue reflect.Value) {
+	copyProperties(dstValue, srcValue, nil)
+}
+
+// copyProperties copies srcValue into dstValue, allocating new nested structs
+// and slices from arena if it is not nil.
+func copyProperties(dstValue, srcValue reflect.Value, arena *Arena) {
 	typ := dstValue.Type()
 	if srcValue.Type() != typ {
 		panic(fmt.Errorf("can't copy mismatching types (%s <- %s)",
@@ -35,7 +45,7 @@ func CopyProperties(dstValue, srcValue reflect.Value) {
 	}
 
 	for i, field := range typeFields(typ) {
-		if field.PkgPath != "" {
+		if !IsPropertyField(field) {
 			// The field is not exported so just skip it.
 			continue
 		}
@@ -49,15 +59,14 @@ func CopyProperties(dstValue, srcValue reflect.Value) {
 		case reflect.Bool, reflect.String, reflect.Int, reflect.Uint:
 			dstFieldValue.Set(srcFieldValue)
 		case reflect.Struct:
-			CopyProperties(dstFieldValue, srcFieldValue)
+			copyProperties(dstFieldValue, srcFieldValue, arena)
 		case reflect.Slice:
 			if !srcFieldValue.IsNil() {
 				if field.Type.Elem().Kind() != reflect.String {
 					panic(fmt.Errorf("can't copy field %q: slice elements are not strings", field.Name))
 				}
 				if srcFieldValue != dstFieldValue {
-					newSlice := reflect.MakeSlice(field.Type, srcFieldValue.Len(),
-						srcFieldValue.Len())
+					newSlice := arena.makeStringSlice(field.Type, srcFieldValue.Len())
 					reflect.Copy(newSlice, srcFieldValue)
 					dstFieldValue.Set(newSlice)
 				}
@@ -104,10 +113,10 @@ func CopyProperties(dstValue, srcValue reflect.Value) {
 			case reflect.Struct:
 				if !dstFieldValue.IsNil() {
 					// Re-use the existing allocation.
-					CopyProperties(dstFieldValue.Elem(), srcFieldValue)
+					copyProperties(dstFieldValue.Elem(), srcFieldValue, arena)
 					break
 				} else {
-					newValue := CloneProperties(srcFieldValue)
+					newValue := cloneProperties(srcFieldValue, arena)
 					if dstFieldInterfaceValue.IsValid() {
 						dstFieldInterfaceValue.Set(newValue)
 					} else {
@@ -133,7 +142,7 @@ func ZeroProperties(structValue reflect.Value) {
 	typ := structValue.Type()
 
 	for i, field := range typeFields(typ) {
-		if field.PkgPath != "" {
+		if !IsPropertyField(field) {
 			// The field is not exported so just skip it.
 			continue
 		}
@@ -191,7 +200,7 @@ func CloneEmptyProperties(structValue reflect.Value) reflect.Value {
 func cloneEmptyProperties(dstValue, srcValue reflect.Value) {
 	typ := srcValue.Type()
 	for i, field := range typeFields(typ) {
-		if field.PkgPath != "" {
+		if !IsPropertyField(field) {
 			// The field is not exported so just skip it.
 			continue
 		}
@@ -0,0 +1,175 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proptools
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// IsPropertyField returns true if the field of a property struct can hold
+// properties, which is true of exported fields and of embedded structs of
+// unexported types, like a struct of shared properties embedded in an
+// exported mixin from another package, since their exported fields are
+// promoted.
+func IsPropertyField(field reflect.StructField) bool {
+	return field.PkgPath == "" || (field.Anonymous && field.Type.Kind() == reflect.Struct)
+}
+
+// ExcludedProperties returns the names of the properties of an embedded
+// struct that are excluded from the struct that embeds it with exclude(name)
+// entries in the blueprint tag of the field, for example
+// `blueprint:"exclude(cflags),exclude(srcs)"`.  Excluded properties can't be
+// set in Blueprints files, and don't conflict with properties of the same name.
+func ExcludedProperties(field reflect.StructField) []string {
+	var ret []string
+	for _, entry := range strings.Split(field.Tag.Get("blueprint"), ",") {
+		if strings.HasPrefix(entry, "exclude(") && strings.HasSuffix(entry, ")") {
+			ret = append(ret, strings.TrimSuffix(strings.TrimPrefix(entry, "exclude("), ")"))
+		}
+	}
+	return ret
+}
+
+// AddExcludedProperties returns excluded with the properties excluded by the
+// tag of the embedded field added, with namePrefix prepended to their names.
+// excluded is not modified, and may be nil.
+func AddExcludedProperties(field reflect.StructField, namePrefix string,
+	excluded map[string]bool) map[string]bool {
+
+	names := ExcludedProperties(field)
+	if len(names) == 0 {
+		return excluded
+	}
+	ret := make(map[string]bool, len(excluded)+len(names))
+	for name := range excluded {
+		ret[name] = true
+	}
+	for _, name := range names {
+		ret[namePrefix+name] = true
+	}
+	return ret
+}
+
+// A PropertyConflictError describes a property that is defined by more than
+// one field of a property struct, including the fields promoted from
+// embedded structs.
+type PropertyConflictError struct {
+	// Type is the property struct.
+	Type reflect.Type
+
+	// Property is the name of the property.
+	Property string
+
+	// Fields are the paths of the fields that define the property from
+	// Type, each followed by the struct type that declares it.
+	Fields []string
+}
+
+func (e *PropertyConflictError) Error() string {
+	return fmt.Sprintf("property %q of %s is defined here and here:\n    %s\n"+
+		"exclude all but one of them with a blueprint:\"exclude(%s)\" tag on the embedded fields",
+		e.Property, e.Type, strings.Join(e.Fields, "\n    "), lastPropertyName(e.Property))
+}
+
+func lastPropertyName(name string) string {
+	return name[strings.LastIndexByte(name, '.')+1:]
+}
+
+var (
+	propertyConflictsLock  sync.Mutex
+	propertyConflictsCache = make(map[reflect.Type][]error)
+)
+
+// PropertyConflicts returns a *PropertyConflictError for each property that
+// is defined by more than one field of the property struct type, at any
+// depth of embedding or nesting, in the order of the fields.
+// Properties excluded with ExcludedProperties are not counted.
+func PropertyConflicts(structType reflect.Type) []error {
+	propertyConflictsLock.Lock()
+	errs, ok := propertyConflictsCache[structType]
+	propertyConflictsLock.Unlock()
+	if ok {
+		return errs
+	}
+
+	defs := make(map[string][]string)
+	var names []string
+	var walk func(t reflect.Type, goPath, namePrefix string, excluded map[string]bool)
+	walk = func(t reflect.Type, goPath, namePrefix string, excluded map[string]bool) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !IsPropertyField(field) || HasTag(field, "blueprint", "mutated") {
+				continue
+			}
+
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			fieldPath := goPath + "." + field.Name
+
+			if (field.Anonymous || field.Name == "BlueprintEmbed") && fieldType.Kind() == reflect.Struct {
+				walk(fieldType, fieldPath, namePrefix, AddExcludedProperties(field, namePrefix, excluded))
+				continue
+			}
+
+			name := namePrefix + PropertyNameForField(field.Name)
+			if excluded[name] {
+				continue
+			}
+			if _, ok := defs[name]; !ok {
+				names = append(names, name)
+			}
+			defs[name] = append(defs[name], fmt.Sprintf("%s (%s)", fieldPath, typeName(t)))
+
+			if fieldType.Kind() == reflect.Struct {
+				walk(fieldType, fieldPath, name+".", nil)
+			}
+		}
+	}
+	root := structType.Name()
+	if root == "" {
+		root = "struct"
+	}
+	walk(structType, root, "", nil)
+
+	for _, name := range names {
+		if len(defs[name]) > 1 {
+			errs = append(errs, &PropertyConflictError{
+				Type:     structType,
+				Property: name,
+				Fields:   defs[name],
+			})
+		}
+	}
+
+	propertyConflictsLock.Lock()
+	propertyConflictsCache[structType] = errs
+	propertyConflictsLock.Unlock()
+
+	return errs
+}
+
+// typeName returns the name of a struct type qualified with the full path of
+// its package, or its definition if it is unnamed.
+func typeName(t reflect.Type) string {
+	if t.Name() == "" || t.PkgPath() == "" {
+		return t.String()
+	}
+	return t.PkgPath() + "." + t.Name()
+}
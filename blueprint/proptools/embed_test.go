@@ -0,0 +1,163 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proptools
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type sharedProperties struct {
+	Cflags []string
+	Srcs   []string
+}
+
+type Mixin struct {
+	sharedProperties
+	Enabled *bool
+}
+
+func TestIsPropertyField(t *testing.T) {
+	structType := reflect.TypeOf(struct {
+		sharedProperties
+		Exported   string
+		unexported string
+	}{})
+
+	for i, expected := range []bool{true, true, false} {
+		if got := IsPropertyField(structType.Field(i)); got != expected {
+			t.Errorf("field %s: expected %v, got %v", structType.Field(i).Name, expected, got)
+		}
+	}
+}
+
+func TestExcludedProperties(t *testing.T) {
+	field, _ := reflect.TypeOf(struct {
+		Mixin `blueprint:"mutated,exclude(cflags),exclude(enabled)"`
+	}{}).FieldByName("Mixin")
+
+	got := ExcludedProperties(field)
+	if expected := []string{"cflags", "enabled"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	excluded := map[string]bool{"srcs": true}
+	added := AddExcludedProperties(field, "nested.", excluded)
+	expected := map[string]bool{"srcs": true, "nested.cflags": true, "nested.enabled": true}
+	if !reflect.DeepEqual(added, expected) {
+		t.Errorf("expected %v, got %v", expected, added)
+	}
+	if len(excluded) != 1 {
+		t.Errorf("expected AddExcludedProperties not to modify its argument, got %v", excluded)
+	}
+}
+
+func TestPropertyConflicts(t *testing.T) {
+	testCases := []struct {
+		name       string
+		properties interface{}
+		errs       []string
+	}{
+		{
+			name: "none",
+			properties: struct {
+				Mixin
+				Name string
+			}{},
+		},
+		{
+			name: "promoted",
+			properties: struct {
+				Mixin
+				Cflags []string
+			}{},
+			errs: []string{
+				`property "cflags" of struct { proptools.Mixin; Cflags []string } is defined here and here:
+    struct.Mixin.sharedProperties.Cflags (github.com/google/blueprint/proptools.sharedProperties)
+    struct.Cflags (struct { proptools.Mixin; Cflags []string })
+exclude all but one of them with a blueprint:"exclude(cflags)" tag on the embedded fields`,
+			},
+		},
+		{
+			name: "nested",
+			properties: struct {
+				Nested struct {
+					sharedProperties
+					Mixin
+				}
+			}{},
+			errs: []string{`property "nested.cflags"`, `property "nested.srcs"`},
+		},
+		{
+			name: "excluded",
+			properties: struct {
+				Mixin  `blueprint:"exclude(cflags)"`
+				Cflags []string
+			}{},
+		},
+		{
+			name: "excluded nested",
+			properties: struct {
+				Nested struct {
+					sharedProperties `blueprint:"exclude(srcs)"`
+					Mixin            `blueprint:"exclude(cflags)"`
+				}
+			}{},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			errs := PropertyConflicts(reflect.TypeOf(testCase.properties))
+			if len(errs) != len(testCase.errs) {
+				t.Fatalf("expected %d errors, got %q", len(testCase.errs), errs)
+			}
+			for i, err := range errs {
+				if _, ok := err.(*PropertyConflictError); !ok {
+					t.Errorf("expected *PropertyConflictError, got %T", err)
+				}
+				if !strings.HasPrefix(err.Error(), testCase.errs[i]) {
+					t.Errorf("expected error starting with:\n%s\ngot:\n%s", testCase.errs[i], err)
+				}
+			}
+		})
+	}
+}
+
+func TestEmbeddedUnexportedStruct(t *testing.T) {
+	src := &struct{ Mixin }{}
+	src.Cflags = []string{"-a"}
+	src.Srcs = []string{"a.c"}
+
+	clone := CloneProperties(reflect.ValueOf(src).Elem()).Interface().(*struct{ Mixin })
+	if !reflect.DeepEqual(clone, src) {
+		t.Errorf("expected clone %v, got %v", src, clone)
+	}
+
+	extension := &struct{ Mixin }{}
+	extension.Cflags = []string{"-b"}
+	if err := AppendProperties(clone, extension, nil); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"-a", "-b"}; !reflect.DeepEqual(clone.Cflags, expected) {
+		t.Errorf("expected appended cflags %q, got %q", expected, clone.Cflags)
+	}
+
+	ZeroProperties(reflect.ValueOf(clone).Elem())
+	if clone.Cflags != nil || clone.Srcs != nil {
+		t.Errorf("expected zeroed properties, got %v", clone)
+	}
+}
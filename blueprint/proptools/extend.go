@@ -242,7 +242,7 @@ func extendPropertiesRecursive(dstValues []reflect.Value, srcValue reflect.Value
 
 	srcType := srcValue.Type()
 	for i, srcField := range typeFields(srcType) {
-		if srcField.PkgPath != "" {
+		if !IsPropertyField(srcField) {
 			// The field is not exported so just skip it.
 			continue
 		}
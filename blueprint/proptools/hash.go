@@ -0,0 +1,132 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proptools
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// hashPropertiesVersion is the version of the encoding of property values that
+// HashProperties hashes.  It must be incremented whenever the encoding changes,
+// so that hashes of different encodings never match.
+const hashPropertiesVersion = 1
+
+// HashProperties returns a stable hash of the values of property structs, or
+// pointers to them, for use in the keys of caches.  The hash only depends on
+// the names and values of the exported fields, including those of embedded
+// structs, and the values that pointers, interfaces, slices and maps refer
+// to, so it is the same in every run and for copies of the structs made with
+// CloneProperties.  Map entries are hashed in a sorted order.  A nil pointer,
+// slice or map hashes differently from an empty one, since properties treat
+// them differently.  The hash starts with the version of the encoding, like
+// "v1-", which changes when the encoding does.  HashProperties panics if a
+// property struct contains a function, channel or unsafe pointer.
+func HashProperties(propertyStructs ...interface{}) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "proptools.HashProperties v%d\n", hashPropertiesVersion)
+	for _, propertyStruct := range propertyStructs {
+		hashValue(h, reflect.ValueOf(propertyStruct))
+		io.WriteString(h, "\n")
+	}
+	return fmt.Sprintf("v%d-%s", hashPropertiesVersion, hex.EncodeToString(h.Sum(nil)))
+}
+
+// hashValue writes an unambiguous encoding of v to h.  Map entries are encoded
+// into buffers first so that they can be sorted.
+func hashValue(h io.Writer, v reflect.Value) {
+	if !v.IsValid() {
+		io.WriteString(h, "nil")
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		io.WriteString(h, strconv.FormatBool(v.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		io.WriteString(h, strconv.FormatInt(v.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		io.WriteString(h, strconv.FormatUint(v.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		io.WriteString(h, strconv.FormatFloat(v.Float(), 'g', -1, 64))
+	case reflect.String:
+		io.WriteString(h, strconv.Quote(v.String()))
+	case reflect.Ptr:
+		if v.IsNil() {
+			io.WriteString(h, "nil")
+		} else {
+			io.WriteString(h, "&")
+			hashValue(h, v.Elem())
+		}
+	case reflect.Interface:
+		if v.IsNil() {
+			io.WriteString(h, "nil")
+		} else {
+			fmt.Fprintf(h, "(%s)", v.Elem().Type())
+			hashValue(h, v.Elem())
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			io.WriteString(h, "nil")
+			return
+		}
+		fmt.Fprintf(h, "[%d:", v.Len())
+		for i := 0; i < v.Len(); i++ {
+			hashValue(h, v.Index(i))
+			io.WriteString(h, ",")
+		}
+		io.WriteString(h, "]")
+	case reflect.Map:
+		if v.IsNil() {
+			io.WriteString(h, "nil")
+			return
+		}
+		entries := make([]string, 0, v.Len())
+		for _, key := range v.MapKeys() {
+			buf := &bytes.Buffer{}
+			hashValue(buf, key)
+			buf.WriteString(":")
+			hashValue(buf, v.MapIndex(key))
+			entries = append(entries, buf.String())
+		}
+		sort.Strings(entries)
+		fmt.Fprintf(h, "map[%d:", len(entries))
+		for _, entry := range entries {
+			io.WriteString(h, entry)
+			io.WriteString(h, ",")
+		}
+		io.WriteString(h, "]")
+	case reflect.Struct:
+		io.WriteString(h, "{")
+		for i, field := range typeFields(v.Type()) {
+			if !IsPropertyField(field) {
+				continue
+			}
+			io.WriteString(h, field.Name)
+			io.WriteString(h, ":")
+			hashValue(h, v.Field(i))
+			io.WriteString(h, ",")
+		}
+		io.WriteString(h, "}")
+	default:
+		panic(fmt.Errorf("can't hash property value of kind %s", v.Kind()))
+	}
+}
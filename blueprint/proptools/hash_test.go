@@ -0,0 +1,147 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proptools
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type hashTestEmbedded struct {
+	E string
+}
+
+type hashTestProps struct {
+	hashTestEmbedded
+	S *string
+	B *bool
+	L []string
+	M map[string]int
+	I interface{}
+
+	unexported string
+}
+
+var hashPropertiesTestCases = []struct {
+	name string
+	in1  interface{}
+	in2  interface{}
+	out  bool
+}{
+	{
+		name: "equal",
+		in1:  &hashTestProps{S: StringPtr("a"), L: []string{"b", "c"}},
+		in2:  &hashTestProps{S: StringPtr("a"), L: []string{"b", "c"}},
+		out:  true,
+	},
+	{
+		name: "unexported",
+		in1:  &hashTestProps{unexported: "a"},
+		in2:  &hashTestProps{unexported: "b"},
+		out:  true,
+	},
+	{
+		name: "map order",
+		in1:  &hashTestProps{M: map[string]int{"a": 1, "b": 2, "c": 3}},
+		in2:  &hashTestProps{M: map[string]int{"c": 3, "b": 2, "a": 1}},
+		out:  true,
+	},
+	{
+		name: "different string",
+		in1:  &hashTestProps{S: StringPtr("a")},
+		in2:  &hashTestProps{S: StringPtr("b")},
+		out:  false,
+	},
+	{
+		name: "nil pointer",
+		in1:  &hashTestProps{B: nil},
+		in2:  &hashTestProps{B: BoolPtr(false)},
+		out:  false,
+	},
+	{
+		name: "nil slice",
+		in1:  &hashTestProps{L: nil},
+		in2:  &hashTestProps{L: []string{}},
+		out:  false,
+	},
+	{
+		name: "list boundaries",
+		in1:  &hashTestProps{L: []string{"a,b"}},
+		in2:  &hashTestProps{L: []string{"a", "b"}},
+		out:  false,
+	},
+	{
+		name: "map values",
+		in1:  &hashTestProps{M: map[string]int{"a": 1}},
+		in2:  &hashTestProps{M: map[string]int{"a": 2}},
+		out:  false,
+	},
+	{
+		name: "embedded",
+		in1:  &hashTestProps{hashTestEmbedded: hashTestEmbedded{E: "a"}},
+		in2:  &hashTestProps{hashTestEmbedded: hashTestEmbedded{E: "b"}},
+		out:  false,
+	},
+	{
+		name: "interface type",
+		in1:  &hashTestProps{I: &struct{ A string }{"a"}},
+		in2:  &hashTestProps{I: &hashTestEmbedded{"a"}},
+		out:  false,
+	},
+}
+
+func TestHashProperties(t *testing.T) {
+	for _, testCase := range hashPropertiesTestCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			hash1 := HashProperties(testCase.in1)
+			hash2 := HashProperties(testCase.in2)
+			if !strings.HasPrefix(hash1, "v1-") {
+				t.Errorf("expected hash %q to start with the version", hash1)
+			}
+			if (hash1 == hash2) != testCase.out {
+				t.Errorf("expected equal hashes %v, got %q and %q", testCase.out, hash1, hash2)
+			}
+		})
+	}
+}
+
+func TestHashPropertiesClone(t *testing.T) {
+	props := &struct {
+		hashTestEmbedded
+		S *string
+		L []string
+	}{
+		hashTestEmbedded: hashTestEmbedded{E: "a"},
+		S:                StringPtr("b"),
+		L:                []string{"c"},
+	}
+	clone := CloneProperties(reflect.ValueOf(props).Elem()).Interface()
+	if HashProperties(props) != HashProperties(clone) {
+		t.Errorf("expected a clone to have the same hash")
+	}
+	if HashProperties(props) == HashProperties(props, clone) {
+		t.Errorf("expected the hash to depend on the number of property structs")
+	}
+}
+
+func TestHashPropertiesUnsupported(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("expected a panic for a function property")
+		}
+	}()
+	HashProperties(&struct{ F func() }{})
+}
@@ -0,0 +1,199 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proptools
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A ninjaSegment is a part of a string in Ninja syntax, either literal text or
+// a reference to a Ninja variable.
+type ninjaSegment struct {
+	text     string // the literal text, with the "$" escapes unescaped
+	variable string // the name of the referenced variable, if text is empty
+	ref      string // the reference as written, either $name or ${name}
+}
+
+func isNinjaVariableChar(c byte, bracketed bool) bool {
+	switch {
+	case 'a' <= c && c <= 'z',
+		'A' <= c && c <= 'Z',
+		'0' <= c && c <= '9',
+		c == '_',
+		c == '-':
+		return true
+	case c == '.':
+		return bracketed
+	default:
+		return false
+	}
+}
+
+// parseNinjaSegments splits s into literal text and variable references using
+// the same rules as Ninja: "$$", "$ " and "$:" are a literal "$", space and
+// colon, "$" followed by a newline is a line continuation that is removed
+// together with the indentation of the next line, and "$name" or "${name}" is
+// a variable reference.  Any other use of "$" is an error.
+func parseNinjaSegments(s string) ([]ninjaSegment, error) {
+	var segments []ninjaSegment
+	var text []byte
+
+	flush := func() {
+		if len(text) > 0 {
+			segments = append(segments, ninjaSegment{text: string(text)})
+			text = text[:0]
+		}
+	}
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' {
+			text = append(text, s[i])
+			continue
+		}
+
+		start := i
+		i++
+		switch {
+		case i == len(s):
+			return nil, fmt.Errorf("unexpected end of string after '$' in %q", s)
+		case s[i] == '$', s[i] == ' ', s[i] == ':':
+			text = append(text, s[i])
+		case s[i] == '\n':
+			for i+1 < len(s) && s[i+1] == ' ' {
+				i++
+			}
+		case s[i] == '{':
+			end := i + 1
+			for end < len(s) && isNinjaVariableChar(s[end], true) {
+				end++
+			}
+			if end == len(s) {
+				return nil, fmt.Errorf("unexpected end of string in variable name in %q", s)
+			}
+			if s[end] != '}' {
+				return nil, fmt.Errorf("invalid character in variable name at byte offset %d in %q", end, s)
+			}
+			if end == i+1 {
+				return nil, fmt.Errorf("empty variable name at byte offset %d in %q", end, s)
+			}
+			flush()
+			segments = append(segments, ninjaSegment{variable: s[i+1 : end], ref: s[start : end+1]})
+			i = end
+		case isNinjaVariableChar(s[i], false):
+			end := i
+			for end < len(s) && isNinjaVariableChar(s[end], false) {
+				end++
+			}
+			flush()
+			segments = append(segments, ninjaSegment{variable: s[i:end], ref: s[start:end]})
+			i = end - 1
+		default:
+			return nil, fmt.Errorf("invalid character after '$' at byte offset %d in %q", i, s)
+		}
+	}
+	flush()
+
+	return segments, nil
+}
+
+// NinjaVariableReferences returns the names of the Ninja variables referenced
+// by s, in order of appearance, or an error if s is not a valid Ninja string.
+func NinjaVariableReferences(s string) ([]string, error) {
+	segments, err := parseNinjaSegments(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, segment := range segments {
+		if segment.ref != "" {
+			names = append(names, segment.variable)
+		}
+	}
+	return names, nil
+}
+
+// NinjaShellEscapeArg escapes a single argument for the Command of a Ninja
+// rule, which is expanded once by Ninja and then again by sh -c.  Unlike
+// NinjaAndShellEscape, arg is in Ninja syntax: "$name" and "${name}" are
+// references to Ninja variables, like $in, $out or the rule's Args, and are
+// kept as references, while "$$" is a literal "$".  The literal text around
+// the references is escaped for both Ninja and the shell, so it reaches the
+// command unmodified.
+//
+// The values of the referenced variables are not quoted, so they are split
+// into words by the shell like the Ninja variables of a RuleParams.Command
+// usually are, and must already be escaped for the shell.
+//
+// An error is returned if arg contains a "$" that is neither an escape nor the
+// start of a variable reference, or a literal newline, which can't be written
+// into a Ninja file.
+func NinjaShellEscapeArg(arg string) (string, error) {
+	if arg == "" {
+		return "''", nil
+	}
+
+	segments, err := parseNinjaSegments(arg)
+	if err != nil {
+		return "", err
+	}
+
+	ret := ""
+	for _, segment := range segments {
+		if segment.ref != "" {
+			ret += segment.ref
+			continue
+		}
+		if strings.ContainsAny(segment.text, "\n\r") {
+			return "", fmt.Errorf("newline in %q can't be used in a Ninja command", arg)
+		}
+		ret += ninjaEscaper.Replace(shellQuoteArg(segment.text))
+	}
+	return ret, nil
+}
+
+// shellQuoteArg quotes s as a single shell word if necessary.  Unlike
+// ShellEscape, spaces are quoted too.
+func shellQuoteArg(s string) string {
+	if strings.IndexByte(s, ' ') == -1 && ShellEscape([]string{s})[0] == s {
+		return s
+	}
+	return `'` + singleQuoteReplacer.Replace(s) + `'`
+}
+
+// NinjaShellEscapeArgs calls NinjaShellEscapeArg on each element of args, and
+// returns a new slice containing the escaped arguments.
+func NinjaShellEscapeArgs(args []string) ([]string, error) {
+	ret := make([]string, len(args))
+	for i, arg := range args {
+		escaped, err := NinjaShellEscapeArg(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %s", i, err)
+		}
+		ret[i] = escaped
+	}
+	return ret, nil
+}
+
+// NinjaShellCommand returns a command line for RuleParams.Command that runs
+// args, escaping each argument with NinjaShellEscapeArg.
+func NinjaShellCommand(args ...string) (string, error) {
+	escaped, err := NinjaShellEscapeArgs(args)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(escaped, " "), nil
+}
@@ -0,0 +1,183 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proptools
+
+import (
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var ninjaShellEscapeArgTestCases = []struct {
+	name string
+	in   string
+	out  string
+	err  string
+}{
+	{
+		name: "no escaping",
+		in:   `test`,
+		out:  `test`,
+	},
+	{
+		name: "empty",
+		in:   ``,
+		out:  `''`,
+	},
+	{
+		name: "space",
+		in:   `a b`,
+		out:  `'a b'`,
+	},
+	{
+		name: "escaped $",
+		in:   `$$HOME`,
+		out:  `'$$HOME'`,
+	},
+	{
+		name: "single quote",
+		in:   `it's`,
+		out:  `'it'\''s'`,
+	},
+	{
+		name: "variable",
+		in:   `$out`,
+		out:  `$out`,
+	},
+	{
+		name: "bracketed variable",
+		in:   `${g.pkg.tool}`,
+		out:  `${g.pkg.tool}`,
+	},
+	{
+		name: "variables and text",
+		in:   `--flag=${in} $$x;$out`,
+		out:  `--flag=${in}' $$x;'$out`,
+	},
+	{
+		name: "ORIGIN",
+		in:   `-Wl,--rpath,$${ORIGIN}/../lib`,
+		out:  `'-Wl,--rpath,$${ORIGIN}/../lib'`,
+	},
+	{
+		name: "escaped space and colon",
+		in:   `a$ b$:c`,
+		out:  `'a b:c'`,
+	},
+	{
+		name: "line continuation",
+		in:   "a$\n    b",
+		out:  `ab`,
+	},
+	{
+		name: "unescaped $",
+		in:   `cost: $%5`,
+		err:  `invalid character after '$' at byte offset 7 in "cost: $%5"`,
+	},
+	{
+		name: "trailing $",
+		in:   `test$`,
+		err:  `unexpected end of string after '$' in "test$"`,
+	},
+	{
+		name: "unterminated variable",
+		in:   `${out`,
+		err:  `unexpected end of string in variable name in "${out"`,
+	},
+	{
+		name: "empty variable",
+		in:   `${}`,
+		err:  `empty variable name at byte offset 2 in "${}"`,
+	},
+	{
+		name: "newline",
+		in:   "a\nb",
+		err:  `newline in "a\nb" can't be used in a Ninja command`,
+	},
+}
+
+func TestNinjaShellEscapeArg(t *testing.T) {
+	for _, testCase := range ninjaShellEscapeArgTestCases {
+		got, err := NinjaShellEscapeArg(testCase.in)
+		if testCase.err != "" {
+			if err == nil || err.Error() != testCase.err {
+				t.Errorf("%s: expected error %q, got %q, %v", testCase.name, testCase.err, got, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", testCase.name, err)
+		} else if got != testCase.out {
+			t.Errorf("%s: expected `%s` got `%s`", testCase.name, testCase.out, got)
+		}
+	}
+}
+
+func TestNinjaVariableReferences(t *testing.T) {
+	got, err := NinjaVariableReferences(`$in -o ${out} $$notvar ${g.pkg.x}-$flags`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"in", "out", "g.pkg.x", "flags"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+// expandNinja expands a Ninja string the way Ninja does for a rule command,
+// using vars for the variable values.
+func expandNinja(t *testing.T, s string, vars map[string]string) string {
+	segments, err := parseNinjaSegments(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret := ""
+	for _, segment := range segments {
+		if segment.ref != "" {
+			ret += vars[segment.variable]
+		} else {
+			ret += segment.text
+		}
+	}
+	return ret
+}
+
+func TestExternalNinjaShellCommand(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	args := []string{"printf", `%s\n`, `a b`, `it's`, `$$HOME`, `"quoted"`, `--in=$in`, `${flags}x`, `;`, ``}
+	vars := map[string]string{
+		"in":    "src/a.c",
+		"flags": "-O2",
+	}
+	expected := []string{"a b", "it's", "$HOME", `"quoted"`, "--in=src/a.c", "-O2x", ";", ""}
+
+	cmd, err := NinjaShellCommand(args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := exec.Command("/bin/sh", "-c", expandNinja(t, cmd, vars)).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(got), "\n"), "\n")
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("command %s: expected %q, got %q", cmd, expected, lines)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proptools
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// VisitPathProperties calls visit with the property name and the values of
+// every string, *string or []string field tagged with `blueprint:"path"` in
+// the given property structs, including fields of nested and embedded structs.
+// Unset *string fields and fields of nil struct pointers are skipped.  Property
+// names of nested structs are joined with ".", as in Blueprints files.
+func VisitPathProperties(propertyStructs []interface{},
+	visit func(propertyName string, values []string)) {
+
+	for _, props := range propertyStructs {
+		structValue := reflect.ValueOf(props)
+		if structValue.Kind() != reflect.Ptr || structValue.Elem().Kind() != reflect.Struct {
+			panic(fmt.Errorf("properties must be a pointer to a struct, got %T", props))
+		}
+		visitPathProperties("", structValue.Elem(), visit)
+	}
+}
+
+func visitPathProperties(namePrefix string, structValue reflect.Value,
+	visit func(string, []string)) {
+
+	structType := structValue.Type()
+
+	for i := 0; i < structValue.NumField(); i++ {
+		field := structType.Field(i)
+		fieldValue := structValue.Field(i)
+
+		if !IsPropertyField(field) {
+			// This is an unexported field, so just skip it.
+			continue
+		}
+
+		propertyName := namePrefix + PropertyNameForField(field.Name)
+		isPath := HasTag(field, "blueprint", "path")
+
+		if fieldValue.Kind() == reflect.Interface {
+			if fieldValue.IsNil() {
+				continue
+			}
+			fieldValue = fieldValue.Elem()
+		}
+
+		switch fieldValue.Kind() {
+		case reflect.String:
+			if isPath {
+				visit(propertyName, []string{fieldValue.String()})
+			}
+		case reflect.Slice:
+			if isPath && fieldValue.Type().Elem().Kind() == reflect.String {
+				// Index the elements instead of asserting []string to
+				// support slices of named string types.
+				values := make([]string, fieldValue.Len())
+				for j := range values {
+					values[j] = fieldValue.Index(j).String()
+				}
+				visit(propertyName, values)
+			}
+		case reflect.Ptr:
+			if fieldValue.IsNil() {
+				continue
+			}
+			switch fieldValue.Elem().Kind() {
+			case reflect.String:
+				if isPath {
+					visit(propertyName, []string{fieldValue.Elem().String()})
+				}
+			case reflect.Struct:
+				visitNestedPathProperties(field, propertyName, namePrefix,
+					fieldValue.Elem(), visit)
+			}
+		case reflect.Struct:
+			visitNestedPathProperties(field, propertyName, namePrefix, fieldValue, visit)
+		}
+	}
+}
+
+func visitNestedPathProperties(field reflect.StructField, propertyName, namePrefix string,
+	structValue reflect.Value, visit func(string, []string)) {
+
+	// Embedded structs and BlueprintEmbed fields share the property name
+	// prefix of their parent, like in unpackStructValue.
+	if field.Anonymous || field.Name == "BlueprintEmbed" {
+		visitPathProperties(namePrefix, structValue, visit)
+	} else {
+		visitPathProperties(propertyName+".", structValue, visit)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proptools
+
+import (
+	"reflect"
+	"testing"
+)
+
+type EmbeddedPathProps struct {
+	Embedded_srcs []string `blueprint:"path"`
+}
+
+type pathName string
+type pathList []string
+
+type pathProps struct {
+	EmbeddedPathProps
+
+	Srcs    []string `blueprint:"path"`
+	Cflags  []string
+	Main    string  `blueprint:"path"`
+	Version *string `blueprint:"path"`
+	Unset   *string `blueprint:"path"`
+
+	Target struct {
+		Host struct {
+			Srcs []string `blueprint:"path"`
+		}
+	}
+
+	Nested *struct {
+		Data []string `blueprint:"path"`
+	}
+
+	Named []pathName `blueprint:"path"`
+	List  pathList   `blueprint:"path"`
+
+	unexported []string `blueprint:"path"`
+}
+
+func TestVisitPathProperties(t *testing.T) {
+	props := &pathProps{
+		EmbeddedPathProps: EmbeddedPathProps{
+			Embedded_srcs: []string{":embedded"},
+		},
+		Srcs:       []string{"a.c", ":b"},
+		Cflags:     []string{":not_a_path"},
+		Main:       "main.c",
+		Version:    StringPtr(":version"),
+		Named:      []pathName{":named"},
+		List:       pathList{":list"},
+		unexported: []string{":unexported"},
+	}
+	props.Target.Host.Srcs = []string{":host"}
+
+	var got []string
+	VisitPathProperties([]interface{}{props}, func(name string, values []string) {
+		for _, v := range values {
+			got = append(got, name+"="+v)
+		}
+	})
+
+	expected := []string{
+		"embedded_srcs=:embedded",
+		"srcs=a.c",
+		"srcs=:b",
+		"main=main.c",
+		"version=:version",
+		"target.host.srcs=:host",
+		"named=:named",
+		"list=:list",
+	}
+
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("incorrect path properties:")
+		t.Errorf("  expected: %q", expected)
+		t.Errorf("       got: %q", got)
+	}
+}
@@ -11,6 +11,8 @@ mkdir ${OUT}
   ${SRC}/bootstrap.bash
   ./blueprint.bash
   ${SRC}/bootstrap.bash -r
+  .bootstrap/bin/minibp -wrappers ${SRC} -wrapper_os linux
+  .bootstrap/bin/minibp -wrappers ${SRC} -wrapper_os windows
 )
 
 rm -rf ${OUT}
@@ -0,0 +1,157 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/google/blueprint/pathtools"
+)
+
+// A SchemaLock describes a file that records a hash of the property schema of
+// every registered module type, the names and types of the properties that
+// can be set in Blueprints files.  Checking it in makes every change to the
+// build language, like a new module type or a removed property, show up as a
+// change to the file that can be reviewed.  Each line of the file is the name
+// of a module type followed by the hash of its schema, separated by a space.
+// Empty lines and lines starting with "#" are ignored.
+type SchemaLock struct {
+	// File is the path of the schema lock file.
+	File string
+
+	// Update writes the current schemas to File instead of checking them,
+	// to create the file or to accept changes.
+	Update bool
+}
+
+// NewSchemaLockSingleton returns a SingletonFactory for a singleton that
+// checks that the property schema of every module type registered with ctx
+// matches the schema lock file, and reports an error for every module type
+// that was added, removed or changed since the file was last updated.  With
+// Update, the file is written by Context.WriteSingletonFiles.
+func NewSchemaLockSingleton(ctx *Context, lock SchemaLock) SingletonFactory {
+	return func() Singleton {
+		return &schemaLockSingleton{moduleTypes: ctx.ModuleTypes, lock: lock}
+	}
+}
+
+type schemaLockSingleton struct {
+	moduleTypes func() []ModuleTypeInfo
+	lock        SchemaLock
+
+	// types and hashes are the module types and their schema hashes found
+	// by GenerateBuildActions with Update.
+	types  []ModuleTypeInfo
+	hashes map[string]string
+}
+
+func (s *schemaLockSingleton) GenerateBuildActions(ctx SingletonContext) {
+	moduleTypes := s.moduleTypes()
+	hashes := make(map[string]string, len(moduleTypes))
+	for _, t := range moduleTypes {
+		hashes[t.Name] = schemaHash(t.Properties)
+	}
+
+	if s.lock.Update {
+		s.types, s.hashes = moduleTypes, hashes
+		return
+	}
+
+	ctx.AddNinjaFileDeps(s.lock.File)
+	locked, order, err := readSchemaLock(ctx.Fs(), s.lock.File)
+	if err != nil {
+		ctx.Errorf("error reading schema lock: %s", err)
+		return
+	}
+
+	for _, t := range moduleTypes {
+		hash, ok := locked[t.Name]
+		if !ok {
+			ctx.Errorf("module type %q is not in the schema lock %s", t.Name, s.lock.File)
+		} else if hash != hashes[t.Name] {
+			ctx.Errorf("the property schema of module type %q doesn't match the schema lock %s",
+				t.Name, s.lock.File)
+		}
+	}
+	for _, name := range order {
+		if _, ok := hashes[name]; !ok {
+			ctx.Errorf("module type %q in the schema lock %s is not registered", name, s.lock.File)
+		}
+	}
+}
+
+// WriteFiles writes the schema lock with Update, unless PrepareBuildActions
+// failed.
+func (s *schemaLockSingleton) WriteFiles(failed bool) error {
+	if !s.lock.Update || failed {
+		return nil
+	}
+	return writeSchemaLock(s.lock.File, s.types, s.hashes)
+}
+
+// schemaHash returns the hash of the properties of a module type, which are
+// sorted by name.
+func schemaHash(properties []PropertySchema) string {
+	h := sha256.New()
+	for _, p := range properties {
+		fmt.Fprintf(h, "%s %s\n", p.Name, p.Type)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// readSchemaLock returns the hashes in the schema lock file by module type,
+// and the module types in the order of the file.
+func readSchemaLock(fs pathtools.FileSystem, filename string) (map[string]string, []string, error) {
+	f, err := fs.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	hashes := make(map[string]string)
+	var order []string
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, nil, fmt.Errorf("%s:%d: expected a module type and a hash, found %q",
+				filename, line, text)
+		}
+		if _, ok := hashes[fields[0]]; ok {
+			return nil, nil, fmt.Errorf("%s:%d: module type %q is listed more than once",
+				filename, line, fields[0])
+		}
+		hashes[fields[0]] = fields[1]
+		order = append(order, fields[0])
+	}
+	return hashes, order, scanner.Err()
+}
+
+func writeSchemaLock(filename string, moduleTypes []ModuleTypeInfo, hashes map[string]string) error {
+	data := []byte("# Generated by blueprint.  Each line is a module type and the hash of the\n" +
+		"# names and types of its properties.\n")
+	for _, t := range moduleTypes {
+		data = append(data, t.Name+" "+hashes[t.Name]+"\n"...)
+	}
+	return pathtools.WriteFileIfChanged(filename, data, 0666)
+}
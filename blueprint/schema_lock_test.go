@@ -0,0 +1,124 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func schemaLockTestContext(lock SchemaLock, moduleTypes map[string]ModuleFactory,
+	files map[string][]byte) *Context {
+
+	ctx := NewContext()
+	for name, factory := range moduleTypes {
+		ctx.RegisterModuleType(name, factory)
+	}
+	ctx.RegisterSingletonType("schema_lock", NewSchemaLockSingleton(ctx, lock))
+	files["Blueprints"] = nil
+	ctx.MockFileSystem(files)
+	return ctx
+}
+
+func TestSchemaLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schema_lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "schema_lock.txt")
+	locked := map[string]ModuleFactory{
+		"foo_module": newFooModule,
+		"bar_module": newBarModule,
+	}
+	ctx := schemaLockTestContext(SchemaLock{File: file, Update: true}, locked, map[string][]byte{})
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) == 0 {
+		_, errs = ctx.PrepareBuildActions(nil)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Fatalf("expected no schema lock before WriteSingletonFiles, got %v", err)
+	}
+	if errs := ctx.WriteSingletonFiles(false); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name        string
+		moduleTypes map[string]ModuleFactory
+		errs        []string
+	}{
+		{
+			name:        "unchanged",
+			moduleTypes: locked,
+		},
+		{
+			name: "changed",
+			moduleTypes: map[string]ModuleFactory{
+				"foo_module": newFooModule,
+				"bar_module": newFooModule,
+			},
+			errs: []string{
+				`the property schema of module type "bar_module" doesn't match the schema lock schema_lock.txt`,
+			},
+		},
+		{
+			name: "added and removed",
+			moduleTypes: map[string]ModuleFactory{
+				"foo_module": newFooModule,
+				"baz_module": newBarModule,
+			},
+			errs: []string{
+				`module type "baz_module" is not in the schema lock schema_lock.txt`,
+				`module type "bar_module" in the schema lock schema_lock.txt is not registered`,
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctx := schemaLockTestContext(SchemaLock{File: "schema_lock.txt"}, testCase.moduleTypes,
+				map[string][]byte{"schema_lock.txt": data})
+			_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+			if len(errs) > 0 {
+				t.Fatalf("unexpected parse errors: %q", errs)
+			}
+
+			deps, errs := ctx.PrepareBuildActions(nil)
+			var got []string
+			for _, err := range errs {
+				got = append(got, err.Error())
+			}
+			if !reflect.DeepEqual(got, testCase.errs) {
+				t.Errorf("expected errors %q, got %q", testCase.errs, got)
+			}
+			if len(errs) == 0 && !reflect.DeepEqual(deps, []string{"schema_lock.txt"}) {
+				t.Errorf("expected the schema lock in the Ninja file deps, got %q", deps)
+			}
+		})
+	}
+}
@@ -17,6 +17,7 @@ package blueprint
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"unicode"
 	"unicode/utf8"
 )
@@ -60,6 +61,10 @@ type basicScope struct {
 	pools     map[string]Pool
 	rules     map[string]Rule
 	imports   map[string]*basicScope
+
+	// parsed caches the results of parseNinjaString for package scopes
+	parsed     map[string]*ninjaString
+	parsedLock sync.RWMutex
 }
 
 func newScope(parent *basicScope) *basicScope {
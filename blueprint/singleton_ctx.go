@@ -16,6 +16,8 @@ package blueprint
 
 import (
 	"fmt"
+	"strings"
+
 	"github.com/google/blueprint/pathtools"
 )
 
@@ -23,6 +25,19 @@ type Singleton interface {
 	GenerateBuildActions(SingletonContext)
 }
 
+// A SingletonFileWriter is a Singleton that writes files outside of the Ninja
+// file, like reports, from what it found in GenerateBuildActions.  The files are
+// only written by Context.WriteSingletonFiles, so that the primary builder can
+// skip them on a dry run, or when a later step fails.
+type SingletonFileWriter interface {
+	Singleton
+
+	// WriteFiles writes the files for the last GenerateBuildActions call.
+	// failed is true if PrepareBuildActions returned errors, in which case
+	// only the files that explain the errors should be written.
+	WriteFiles(failed bool) error
+}
+
 type SingletonContext interface {
 	Config() interface{}
 
@@ -34,6 +49,10 @@ type SingletonContext interface {
 
 	ModuleErrorf(module Module, format string, args ...interface{})
 	Errorf(format string, args ...interface{})
+
+	// Warningf reports a warning of a category, see Diagnostic.  A warning
+	// promoted to an error makes Failed return true.
+	Warningf(category, format string, args ...interface{})
 	Failed() bool
 
 	Variable(pctx PackageContext, name, value string)
@@ -46,6 +65,21 @@ type SingletonContext interface {
 	// set at most one time for a single build, later calls are ignored.
 	SetNinjaBuildDir(pctx PackageContext, value string)
 
+	// AddSubninja adds a Ninja file that is included at the end of the
+	// generated Ninja file with a subninja statement, for example one written
+	// by another tool.  The path may reference Ninja variables in the scope of
+	// the PackageContext.
+	AddSubninja(pctx PackageContext, file string)
+
+	// BuildInSubninja is like Build, but the build statement is written to the
+	// Ninja file with the given path, relative to the directory Ninja is run
+	// from, instead of the main Ninja file.  The file is included at the end
+	// of the main Ninja file with a subninja statement, so variables assigned
+	// in it don't leak into the main file, and is written by
+	// Context.WriteSubninjaFile.  Subninja files are included in the order
+	// they are first used.  The path must not reference Ninja variables.
+	BuildInSubninja(pctx PackageContext, file string, params BuildParams)
+
 	// Eval takes a string with embedded ninja variables, and returns a string
 	// with all of the variables recursively expanded. Any variables references
 	// are expanded in the scope of the PackageContext.
@@ -53,12 +87,26 @@ type SingletonContext interface {
 
 	VisitAllModules(visit func(Module))
 	VisitAllModulesIf(pred func(Module) bool, visit func(Module))
+	VisitDirectDeps(module Module, visit func(Module))
 	VisitDepsDepthFirst(module Module, visit func(Module))
 	VisitDepsDepthFirstIf(module Module, pred func(Module) bool,
 		visit func(Module))
 
 	VisitAllModuleVariants(module Module, visit func(Module))
 
+	// WalkDepsMemoized returns the result of walk for each of modules, see
+	// MemoizedWalk.  The results are shared with the other singletons.
+	WalkDepsMemoized(walk *MemoizedWalk, modules ...Module) []interface{}
+
+	// VisitAllModuleOutputsIf calls visit for each output of the build
+	// statements generated by every module for which pred returns true.  The
+	// outputs have their Ninja variables expanded but remain Ninja-escaped, so
+	// they can be passed directly as inputs to build statements added by the
+	// singleton.  This allows a singleton to add actions that check the outputs
+	// of the whole build graph without each module type having to opt in.
+	VisitAllModuleOutputsIf(pred func(module Module, output string) bool,
+		visit func(module Module, output string))
+
 	PrimaryModule(module Module) Module
 	FinalModule(module Module) Module
 
@@ -169,6 +217,23 @@ func (s *singletonContext) Build(pctx PackageContext, params BuildParams) {
 	s.actionDefs.buildDefs = append(s.actionDefs.buildDefs, def)
 }
 
+func (s *singletonContext) BuildInSubninja(pctx PackageContext, file string, params BuildParams) {
+	if file == "" || strings.ContainsAny(file, "$ \n") {
+		panic(fmt.Errorf("invalid subninja file name %q", file))
+	}
+
+	s.scope.ReparentTo(pctx)
+
+	def, err := parseBuildParams(s.scope, &params)
+	if err != nil {
+		panic(err)
+	}
+	def.Subninja = file
+
+	s.context.addSubninjaFile(file)
+	s.actionDefs.buildDefs = append(s.actionDefs.buildDefs, def)
+}
+
 func (s *singletonContext) Eval(pctx PackageContext, str string) (string, error) {
 	s.scope.ReparentTo(pctx)
 
@@ -200,6 +265,17 @@ func (s *singletonContext) SetNinjaBuildDir(pctx PackageContext, value string) {
 	s.context.setNinjaBuildDir(ninjaValue)
 }
 
+func (s *singletonContext) AddSubninja(pctx PackageContext, file string) {
+	s.scope.ReparentTo(pctx)
+
+	ninjaValue, err := parseNinjaString(s.scope, file)
+	if err != nil {
+		panic(err)
+	}
+
+	s.context.addSubninja(ninjaValue)
+}
+
 func (s *singletonContext) VisitAllModules(visit func(Module)) {
 	s.context.VisitAllModules(visit)
 }
@@ -210,6 +286,10 @@ func (s *singletonContext) VisitAllModulesIf(pred func(Module) bool,
 	s.context.VisitAllModulesIf(pred, visit)
 }
 
+func (s *singletonContext) VisitDirectDeps(module Module, visit func(Module)) {
+	s.context.VisitDirectDeps(module, visit)
+}
+
 func (s *singletonContext) VisitDepsDepthFirst(module Module,
 	visit func(Module)) {
 
@@ -222,6 +302,10 @@ func (s *singletonContext) VisitDepsDepthFirstIf(module Module,
 	s.context.VisitDepsDepthFirstIf(module, pred, visit)
 }
 
+func (s *singletonContext) WalkDepsMemoized(walk *MemoizedWalk, modules ...Module) []interface{} {
+	return s.context.WalkDepsMemoized(walk, modules...)
+}
+
 func (s *singletonContext) PrimaryModule(module Module) Module {
 	return s.context.PrimaryModule(module)
 }
@@ -234,6 +318,39 @@ func (s *singletonContext) VisitAllModuleVariants(module Module, visit func(Modu
 	s.context.VisitAllModuleVariants(module, visit)
 }
 
+func (s *singletonContext) VisitAllModuleOutputsIf(pred func(Module, string) bool,
+	visit func(Module, string)) {
+
+	s.context.visitAllModuleInfos(func(module *moduleInfo) {
+		variables := s.globals.variables
+		if len(module.actionDefs.variables) > 0 {
+			variables = make(map[Variable]*ninjaString, len(s.globals.variables)+
+				len(module.actionDefs.variables))
+			for v, value := range s.globals.variables {
+				variables[v] = value
+			}
+			for _, v := range module.actionDefs.variables {
+				variables[v] = v.value_
+			}
+		}
+
+		for _, def := range module.actionDefs.buildDefs {
+			for _, outputs := range [][]*ninjaString{def.Outputs, def.ImplicitOutputs} {
+				for _, output := range outputs {
+					str, err := output.Eval(variables)
+					if err != nil {
+						s.ModuleErrorf(module.logicModule, "failed to expand output: %s", err)
+						continue
+					}
+					if pred(module.logicModule, str) {
+						visit(module.logicModule, str)
+					}
+				}
+			}
+		}
+	})
+}
+
 func (s *singletonContext) AddNinjaFileDeps(deps ...string) {
 	s.ninjaFileDeps = append(s.ninjaFileDeps, deps...)
 }
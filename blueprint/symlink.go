@@ -0,0 +1,208 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/blueprint/proptools"
+)
+
+var (
+	symlinkPctx = NewPackageContext("github.com/google/blueprint/symlink")
+
+	// symlinkRule creates a symlink to $target, which is relative to the
+	// directory of the symlink, and quoted for the shell by resolveSymlinks.
+	symlinkRule = symlinkPctx.StaticRule("symlink",
+		RuleParams{
+			Command:     "rm -f $out && ln -s $target $out",
+			Description: "symlink $out",
+		},
+		"target")
+
+	// symlinkWindowsRule creates a directory junction to $in, or copies $in
+	// if it is a file, since creating symlinks on Windows needs developer
+	// mode or administrator rights.
+	symlinkWindowsRule = symlinkPctx.StaticRule("symlink_windows",
+		RuleParams{
+			Command: `cmd /c "(if exist "$out" rmdir "$out" 2>NUL || del /q "$out" 2>NUL) & ` +
+				`if exist "$in\*" (mklink /J "$out" "$in" >NUL) else (copy /y "$in" "$out" >NUL)"`,
+			Description: "symlink $out",
+		},
+		"target")
+)
+
+// SymlinkParams describes a symlink created by ModuleContext.BuildSymlink.
+type SymlinkParams struct {
+	// Output is the path of the symlink.
+	Output string
+
+	// Target is the path of the file or directory the symlink points to,
+	// relative to the working directory of Ninja like Output.  The symlink
+	// refers to it with a path relative to the directory of Output, so the
+	// build directory can be moved.  It is an input of the build statement.
+	Target string
+
+	// AllowOutsideBuildDir allows Target to be outside of the Ninja build
+	// directory, for example a directory of the source tree.
+	AllowOutsideBuildDir bool
+}
+
+// symlinkDef is the part of a build statement created by BuildSymlink that is
+// resolved by resolveSymlinks once the Ninja variables have values.
+type symlinkDef struct {
+	allowOutsideBuildDir bool
+}
+
+// SetWindowsSymlinks makes ModuleContext.BuildSymlink create directory junctions,
+// and copies of files, with commands for the Windows cmd shell instead of
+// symlinks with a POSIX shell.  It must be called before PrepareBuildActions.
+func (c *Context) SetWindowsSymlinks(windows bool) {
+	c.windowsSymlinks = windows
+}
+
+func (m *moduleContext) BuildSymlink(params SymlinkParams) {
+	rule := symlinkRule
+	if m.context.windowsSymlinks {
+		rule = symlinkWindowsRule
+	}
+
+	m.Build(symlinkPctx, BuildParams{
+		Rule:    rule,
+		Outputs: []string{params.Output},
+		Inputs:  []string{params.Target},
+		Args: map[string]string{
+			// Set by resolveSymlinks.
+			"target": "",
+		},
+	})
+
+	def := m.actionDefs.buildDefs[len(m.actionDefs.buildDefs)-1]
+	def.Symlink = &symlinkDef{allowOutsideBuildDir: params.AllowOutsideBuildDir}
+}
+
+// resolveSymlinks sets the target of every build statement created by
+// BuildSymlink to the path of its input relative to the directory of its
+// output, and returns an error for every target outside of the Ninja build
+// directory that isn't allowed to be.
+func (c *Context) resolveSymlinks() []error {
+	buildDir, err := c.NinjaBuildDir()
+	if err != nil {
+		return []error{err}
+	}
+	if buildDir == "" {
+		buildDir = "."
+	}
+
+	var errs []error
+	for _, module := range c.modulesSorted {
+		if len(errs) >= maxErrors {
+			break
+		}
+
+		var variables map[Variable]*ninjaString
+		for _, def := range module.actionDefs.buildDefs {
+			if def.Symlink == nil {
+				continue
+			}
+			if variables == nil {
+				variables, err = c.localVariableValues(&module.actionDefs)
+				if err != nil {
+					return []error{err}
+				}
+			}
+
+			err := c.resolveSymlink(def, variables, buildDir)
+			if err != nil {
+				errs = append(errs, &ModuleError{
+					BlueprintError: BlueprintError{
+						Err: err,
+						Pos: module.pos,
+					},
+					module: module,
+				})
+			}
+		}
+	}
+
+	return errs
+}
+
+func (c *Context) resolveSymlink(def *buildDef, variables map[Variable]*ninjaString,
+	buildDir string) error {
+
+	output, err := def.Outputs[0].Eval(variables)
+	if err != nil {
+		return err
+	}
+	target, err := def.Inputs[0].Eval(variables)
+	if err != nil {
+		return err
+	}
+
+	if !def.Symlink.allowOutsideBuildDir && !pathWithin(target, buildDir) {
+		return fmt.Errorf("target %q of symlink %q is outside of the build directory %q",
+			target, output, buildDir)
+	}
+
+	rel, err := relativeSymlinkTarget(output, target)
+	if err != nil {
+		return fmt.Errorf("symlink %q: %s", output, err)
+	}
+
+	// The paths were evaluated from Ninja strings, so a "$" in them is
+	// still escaped as "$$", and spaces and colons are literal in the
+	// value of a variable.  Quote the target for the shell, which would
+	// otherwise split it at spaces and expand the "$" that Ninja
+	// unescapes.
+	for v := range def.Args {
+		if v.name() == "target" {
+			def.Args[v] = simpleNinjaString(proptools.ShellEscape([]string{rel})[0])
+		}
+	}
+	return nil
+}
+
+// relativeSymlinkTarget returns the path of target relative to the directory
+// of the symlink, or target if it is absolute.
+func relativeSymlinkTarget(symlink, target string) (string, error) {
+	if path.IsAbs(target) {
+		return target, nil
+	}
+	if path.IsAbs(symlink) {
+		return "", fmt.Errorf("an absolute symlink can't have a relative target %q", target)
+	}
+	rel, err := filepath.Rel(filepath.FromSlash(path.Dir(symlink)), filepath.FromSlash(target))
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// pathWithin returns true if p is dir or a path in dir.  Both are either
+// absolute, or relative to the same directory.
+func pathWithin(p, dir string) bool {
+	p, dir = path.Clean(p), path.Clean(dir)
+	if path.IsAbs(p) != path.IsAbs(dir) {
+		return false
+	}
+	if dir == "." {
+		return p != ".." && !strings.HasPrefix(p, "../")
+	}
+	return p == dir || strings.HasPrefix(p, strings.TrimSuffix(dir, "/")+"/")
+}
@@ -0,0 +1,159 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+var symlinkTestPctx = NewPackageContext("github.com/google/blueprint/symlinktest")
+
+type symlinkModule struct {
+	SimpleName
+	properties struct {
+		Target        string
+		Allow_outside bool
+	}
+}
+
+func newSymlinkModule() (Module, []interface{}) {
+	m := &symlinkModule{}
+	return m, []interface{}{&m.properties, &m.SimpleName.Properties}
+}
+
+func (m *symlinkModule) GenerateBuildActions(ctx ModuleContext) {
+	ctx.BuildSymlink(SymlinkParams{
+		Output:               "out/links/" + ctx.ModuleName(),
+		Target:               m.properties.Target,
+		AllowOutsideBuildDir: m.properties.Allow_outside,
+	})
+}
+
+type buildDirSingleton struct{}
+
+func (buildDirSingleton) GenerateBuildActions(ctx SingletonContext) {
+	ctx.SetNinjaBuildDir(symlinkTestPctx, "out")
+}
+
+func TestBuildSymlink(t *testing.T) {
+	testCases := []struct {
+		name   string
+		bp     string
+		target string
+		err    string
+	}{
+		{
+			name: "in build dir",
+			bp: `
+				symlink_module {
+				    name: "A",
+				    target: "out/bin/a",
+				}
+			`,
+			target: "target = ../bin/a",
+		},
+		{
+			name: "outside build dir",
+			bp: `
+				symlink_module {
+				    name: "A",
+				    target: "src/a",
+				}
+			`,
+			err: `Blueprints:2:5: module "A": target "src/a" of symlink "out/links/A" is outside of the build directory "out"`,
+		},
+		{
+			name: "allowed outside build dir",
+			bp: `
+				symlink_module {
+				    name: "A",
+				    target: "src/a",
+				    allow_outside: true,
+				}
+			`,
+			target: "target = ../../src/a",
+		},
+		{
+			name: "special characters",
+			bp: `
+				symlink_module {
+				    name: "A",
+				    target: "out/bin/a b:c$$d",
+				}
+			`,
+			target: "target = '../bin/a b:c$$d'\n",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctx := NewContext()
+			ctx.RegisterModuleType("symlink_module", newSymlinkModule)
+			ctx.RegisterSingletonType("build_dir", func() Singleton { return buildDirSingleton{} })
+			ctx.MockFileSystem(map[string][]byte{
+				"Blueprints": []byte(testCase.bp),
+			})
+
+			_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+			if len(errs) > 0 {
+				t.Fatalf("unexpected parse errors: %v", errs)
+			}
+
+			_, errs = ctx.PrepareBuildActions(nil)
+			if testCase.err != "" {
+				if len(errs) != 1 || errs[0].Error() != testCase.err {
+					t.Fatalf("expected error %q, got %q", testCase.err, errs)
+				}
+				return
+			}
+			if len(errs) > 0 {
+				t.Fatalf("unexpected errors: %v", errs)
+			}
+
+			buf := &bytes.Buffer{}
+			if err := ctx.WriteBuildFile(buf); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(buf.String(), testCase.target) {
+				t.Errorf("expected %q in the Ninja file:\n%s", testCase.target, buf)
+			}
+		})
+	}
+}
+
+func TestPathWithin(t *testing.T) {
+	testCases := []struct {
+		path, dir string
+		within    bool
+	}{
+		{"out/a", "out", true},
+		{"out", "out", true},
+		{"out/../src/a", "out", false},
+		{"outer/a", "out", false},
+		{"a/b", ".", true},
+		{"../a", ".", false},
+		{"/out/a", "/out", true},
+		{"/out/a", "out", false},
+	}
+
+	for _, testCase := range testCases {
+		if got := pathWithin(testCase.path, testCase.dir); got != testCase.within {
+			t.Errorf("pathWithin(%q, %q): expected %v, got %v", testCase.path, testCase.dir,
+				testCase.within, got)
+		}
+	}
+}
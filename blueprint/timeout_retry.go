@@ -0,0 +1,62 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"fmt"
+	"time"
+)
+
+// wrapTimeoutRetryCommand returns command wrapped in a script for a POSIX
+// shell that implements the Timeout and Retries of RuleParams.  The command
+// runs in a subshell in the background, and a watchdog subshell kills it and
+// its child processes with SIGTERM when the timeout expires, which fails the
+// attempt with status 143.  The watchdog's sleep doesn't inherit stderr, so
+// that Ninja doesn't wait for it after the watchdog is killed.  A failed
+// attempt is retried up to retries times, with a message on stderr, and the
+// status of the last attempt is the status of the script.
+func wrapTimeoutRetryCommand(command *ninjaString, timeout time.Duration, retries int) *ninjaString {
+	var prefix, suffix string
+	if timeout > 0 {
+		seconds := int64((timeout + time.Second - 1) / time.Second)
+		prefix = "("
+		suffix = fmt.Sprintf(") & pid=$$!; "+
+			"(sleep %d 2>/dev/null; echo \"command timed out after %ds\" >&2; "+
+			"pkill -TERM -P $$pid 2>/dev/null; kill -TERM $$pid 2>/dev/null) >/dev/null & watchdog=$$!; "+
+			"wait $$pid; status=$$?; kill $$watchdog 2>/dev/null",
+			seconds, seconds)
+	} else {
+		prefix = "("
+		suffix = "); status=$$?"
+	}
+
+	if retries > 0 {
+		prefix = "attempt=0; while :; do " + prefix
+		suffix += fmt.Sprintf("; [ $$status -eq 0 ] && break; "+
+			"attempt=$$((attempt+1)); [ $$attempt -gt %d ] && break; "+
+			"echo \"command failed with status $$status, retrying ($$attempt of %d)\" >&2; done",
+			retries, retries)
+	}
+	suffix += "; exit $$status"
+
+	strs := append([]string(nil), command.strings...)
+	strs[0] = prefix + strs[0]
+	strs[len(strs)-1] += suffix
+
+	return &ninjaString{
+		strings:   strs,
+		variables: command.variables,
+	}
+}
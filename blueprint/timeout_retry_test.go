@@ -0,0 +1,116 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runTimeoutRetryCommand returns the stderr and exit status of command
+// wrapped with the timeout and retries.
+func runTimeoutRetryCommand(t *testing.T, command string, timeout time.Duration,
+	retries int) (string, int) {
+
+	def, err := parseRuleParams(newScope(nil), &RuleParams{
+		Command: command,
+		Timeout: timeout,
+		Retries: retries,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := strings.Replace(def.Variables["command"].Value(nil), "$$", "$", -1)
+
+	cmd := exec.Command("/bin/sh", "-c", script)
+	stderr, err := cmd.CombinedOutput()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return string(stderr), exitErr.Sys().(interface {
+			ExitStatus() int
+		}).ExitStatus()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return string(stderr), 0
+}
+
+func TestTimeoutRetry(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("no /bin/sh")
+	}
+
+	dir, err := ioutil.TempDir("", "timeout_retry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	counter := filepath.Join(dir, "counter")
+
+	t.Run("retry", func(t *testing.T) {
+		// Fails the first two times it runs.
+		flaky := "echo x >> " + counter + "; [ $$(wc -l < " + counter + ") -gt 2 ]"
+		out, status := runTimeoutRetryCommand(t, flaky, 0, 3)
+		if status != 0 {
+			t.Errorf("expected the flaky command to succeed, got status %d: %s", status, out)
+		}
+		if strings.Count(out, "retrying") != 2 {
+			t.Errorf("expected 2 retries, got:\n%s", out)
+		}
+	})
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		out, status := runTimeoutRetryCommand(t, "exit 3", 0, 2)
+		if status != 3 {
+			t.Errorf("expected status 3, got %d", status)
+		}
+		if !strings.Contains(out, "retrying (2 of 2)") || strings.Contains(out, "3 of 2") {
+			t.Errorf("expected 2 retries, got:\n%s", out)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		start := time.Now()
+		out, status := runTimeoutRetryCommand(t, "sleep 30", 500*time.Millisecond, 0)
+		if status == 0 {
+			t.Errorf("expected the command to fail")
+		}
+		if !strings.Contains(out, "command timed out after 1s") {
+			t.Errorf("expected a timeout message, got:\n%s", out)
+		}
+		if d := time.Since(start); d > 10*time.Second {
+			t.Errorf("expected the command to be killed after 1s, took %s", d)
+		}
+	})
+
+	t.Run("fast", func(t *testing.T) {
+		start := time.Now()
+		out, status := runTimeoutRetryCommand(t, "true", 10*time.Second, 1)
+		if status != 0 || out != "" {
+			t.Errorf("expected the command to succeed silently, got status %d: %s", status, out)
+		}
+		if d := time.Since(start); d > 5*time.Second {
+			t.Errorf("expected the command not to wait for the watchdog, took %s", d)
+		}
+	})
+
+	if _, err := parseRuleParams(newScope(nil), &RuleParams{Command: "true", Retries: -1}); err == nil {
+		t.Errorf("expected an error for negative Retries")
+	}
+}
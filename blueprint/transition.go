@@ -0,0 +1,265 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// A TransitionMutator creates the variants of modules on a single axis, like a
+// BottomUpMutator calling CreateVariations, but only creates the variants that
+// are needed.  Each module is split into the variations returned by Split,
+// plus the variations that the variants of the modules that depend on it
+// request through their dependencies, so a variant of a module is only created
+// if the module itself or one of its dependers needs it.
+//
+// The variations requested through a dependency are computed in two steps.
+// OutgoingTransition is called with the variation of the depending variant,
+// and returns the variation that it wants the dependency in.
+// IncomingTransition is then called with that variation on the dependency,
+// which can map it to one of the variations it supports.  For example, a
+// module that is only built for the host can map every requested variation to
+// "host".
+//
+// Once the variations of all modules are known, Mutate is called on each new
+// variant, and can modify its properties for the variation.
+//
+// The transitions must only depend on their arguments, the modules and the
+// config, as they may be computed more than once.
+type TransitionMutator interface {
+	// Split returns the variations that the module is built in on its own,
+	// which must not be empty.  The empty variation "" adds nothing to the
+	// variant name.
+	Split(ctx SplitTransitionContext) []string
+
+	// OutgoingTransition returns the variation that the variant of the
+	// depending module with the variation sourceVariation requests for one
+	// of its dependencies.
+	OutgoingTransition(ctx OutgoingTransitionContext, sourceVariation string) string
+
+	// IncomingTransition returns the variation of the dependency to use when
+	// incomingVariation is requested by one of its dependers.
+	IncomingTransition(ctx IncomingTransitionContext, incomingVariation string) string
+
+	// Mutate is called on each variant created by the mutator, with its
+	// variation.
+	Mutate(ctx BottomUpMutatorContext, variation string)
+}
+
+// SplitTransitionContext is passed to TransitionMutator.Split.
+type SplitTransitionContext interface {
+	BaseModuleContext
+
+	Module() Module
+}
+
+// OutgoingTransitionContext is passed to TransitionMutator.OutgoingTransition.
+type OutgoingTransitionContext interface {
+	// Module returns the depending module.
+	Module() Module
+
+	// OtherModule returns the dependency.
+	OtherModule() Module
+
+	// DepTag returns the tag of the dependency.
+	DepTag() DependencyTag
+
+	Config() interface{}
+}
+
+// IncomingTransitionContext is passed to TransitionMutator.IncomingTransition.
+type IncomingTransitionContext interface {
+	// Module returns the dependency.
+	Module() Module
+
+	Config() interface{}
+}
+
+type outgoingTransitionContext struct {
+	source Module
+	dep    Module
+	tag    DependencyTag
+	config interface{}
+}
+
+func (ctx *outgoingTransitionContext) Module() Module        { return ctx.source }
+func (ctx *outgoingTransitionContext) OtherModule() Module   { return ctx.dep }
+func (ctx *outgoingTransitionContext) DepTag() DependencyTag { return ctx.tag }
+func (ctx *outgoingTransitionContext) Config() interface{}   { return ctx.config }
+
+type incomingTransitionContext struct {
+	module Module
+	config interface{}
+}
+
+func (ctx *incomingTransitionContext) Module() Module      { return ctx.module }
+func (ctx *incomingTransitionContext) Config() interface{} { return ctx.config }
+
+type transitionMutatorImpl struct {
+	name    string
+	mutator TransitionMutator
+
+	// requests holds the variations requested for each module by its
+	// dependers, filled in by the top down pass and consumed by the bottom
+	// up pass.
+	lock     sync.Mutex
+	requests map[*moduleInfo][]string
+
+	// variations holds the variations of each module, computed by the top
+	// down pass.
+	variations map[*moduleInfo][]string
+}
+
+// transitionMutatorHandle is the MutatorHandle of the passes that implement
+// a TransitionMutator.
+type transitionMutatorHandle []*mutatorInfo
+
+func (h transitionMutatorHandle) Parallel() MutatorHandle {
+	for _, info := range h {
+		info.Parallel()
+	}
+	return h
+}
+
+func (h transitionMutatorHandle) EnabledIf(enabled func(config interface{}) bool) MutatorHandle {
+	for _, info := range h {
+		info.EnabledIf(enabled)
+	}
+	return h
+}
+
+// RegisterTransitionMutator registers a TransitionMutator, which creates
+// variants with the given mutator name.  It is run as three mutator passes in
+// registration order: a top down pass that computes the variations of every
+// module from Split and the transitions of its dependers, a bottom up pass
+// that creates the variants and connects each dependency to the variant
+// selected by the transitions, and a bottom up pass named name + "_mutate"
+// that calls Mutate on every variant.
+//
+// The mutator name must be unique to all bottom up or early mutators in the
+// Context.
+func (c *Context) RegisterTransitionMutator(name string, mutator TransitionMutator) MutatorHandle {
+	impl := &transitionMutatorImpl{
+		name:       name,
+		mutator:    mutator,
+		requests:   make(map[*moduleInfo][]string),
+		variations: make(map[*moduleInfo][]string),
+	}
+
+	return transitionMutatorHandle{
+		c.RegisterTopDownMutator(name, impl.topDownMutator).(*mutatorInfo),
+		c.RegisterBottomUpMutator(name, impl.bottomUpMutator).(*mutatorInfo),
+		c.RegisterBottomUpMutator(name+"_mutate", impl.mutateMutator).(*mutatorInfo),
+	}
+}
+
+// transition returns the variation of the dependency dep of the variant of
+// source with the given variation.
+func (t *transitionMutatorImpl) transition(config interface{}, source Module, variation string,
+	dep Module, tag DependencyTag) string {
+
+	outgoing := t.mutator.OutgoingTransition(&outgoingTransitionContext{
+		source: source,
+		dep:    dep,
+		tag:    tag,
+		config: config,
+	}, variation)
+
+	return t.mutator.IncomingTransition(&incomingTransitionContext{
+		module: dep,
+		config: config,
+	}, outgoing)
+}
+
+// topDownMutator computes the variations of a module.  All of its dependers
+// have been visited, so the variations they request are known.
+func (t *transitionMutatorImpl) topDownMutator(mctx TopDownMutatorContext) {
+	module := mctx.(*mutatorContext).module
+	config := mctx.Config()
+
+	split := t.mutator.Split(mctx)
+	if len(split) == 0 {
+		panic(fmt.Errorf("transition mutator %q returned no variations from Split for %s",
+			t.name, module))
+	}
+
+	t.lock.Lock()
+	requested := t.requests[module]
+	delete(t.requests, module)
+	t.lock.Unlock()
+
+	variations := appendNewVariations(nil, split...)
+	sort.Strings(requested)
+	variations = appendNewVariations(variations, requested...)
+
+	for _, dep := range module.directDeps {
+		var depVariations []string
+		for _, variation := range variations {
+			depVariation := t.transition(config, module.logicModule, variation,
+				dep.module.logicModule, dep.tag)
+			depVariations = appendNewVariations(depVariations, depVariation)
+		}
+
+		t.lock.Lock()
+		t.requests[dep.module] = appendNewVariations(t.requests[dep.module], depVariations...)
+		t.lock.Unlock()
+	}
+
+	t.lock.Lock()
+	t.variations[module] = variations
+	t.lock.Unlock()
+}
+
+// bottomUpMutator creates the variants of a module, and connects the
+// dependencies of each variant to the variants selected by the transitions.
+// The dependencies have already been split.
+func (t *transitionMutatorImpl) bottomUpMutator(mctx BottomUpMutatorContext) {
+	mc := mctx.(*mutatorContext)
+	config := mctx.Config()
+	origModule := mc.module.logicModule
+
+	t.lock.Lock()
+	variations := t.variations[mc.module]
+	delete(t.variations, mc.module)
+	t.lock.Unlock()
+
+	mc.createVariationsWithTransition(variations, false, func(variation string, dep depInfo) string {
+		// The first variant of a split module reuses the original module,
+		// which is the one the top down pass passed to the transitions.
+		return t.transition(config, origModule, variation,
+			dep.module.splitModules[0].logicModule, dep.tag)
+	})
+}
+
+func (t *transitionMutatorImpl) mutateMutator(mctx BottomUpMutatorContext) {
+	module := mctx.(*mutatorContext).module
+	t.mutator.Mutate(mctx, module.variant.get(t.name))
+}
+
+// appendNewVariations appends the variations that are not already in list.
+func appendNewVariations(list []string, variations ...string) []string {
+outer:
+	for _, variation := range variations {
+		for _, v := range list {
+			if v == variation {
+				continue outer
+			}
+		}
+		list = append(list, variation)
+	}
+	return list
+}
@@ -0,0 +1,176 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type transitionTestModule struct {
+	SimpleName
+	properties struct {
+		Deps     []string
+		Split    []string
+		Outgoing string
+		Incoming string
+
+		Mutated string `blueprint:"mutated"`
+	}
+}
+
+func newTransitionTestModule() (Module, []interface{}) {
+	m := &transitionTestModule{}
+	return m, []interface{}{&m.properties, &m.SimpleName.Properties}
+}
+
+func (m *transitionTestModule) DynamicDependencies(ctx DynamicDependerModuleContext) []string {
+	return m.properties.Deps
+}
+
+func (m *transitionTestModule) GenerateBuildActions(ModuleContext) {
+}
+
+type testTransitionMutator struct{}
+
+func (testTransitionMutator) Split(ctx SplitTransitionContext) []string {
+	return ctx.Module().(*transitionTestModule).properties.Split
+}
+
+func (testTransitionMutator) OutgoingTransition(ctx OutgoingTransitionContext, variation string) string {
+	if outgoing := ctx.Module().(*transitionTestModule).properties.Outgoing; outgoing != "" {
+		return outgoing
+	}
+	return variation
+}
+
+func (testTransitionMutator) IncomingTransition(ctx IncomingTransitionContext, variation string) string {
+	if incoming := ctx.Module().(*transitionTestModule).properties.Incoming; incoming != "" {
+		return incoming
+	}
+	return variation
+}
+
+func (testTransitionMutator) Mutate(ctx BottomUpMutatorContext, variation string) {
+	ctx.Module().(*transitionTestModule).properties.Mutated = variation
+}
+
+func setupTransitionTest(t *testing.T, bp string) (*Context, []error) {
+	ctx := NewContext()
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(bp),
+	})
+	ctx.RegisterModuleType("transition_module", newTransitionTestModule)
+	ctx.RegisterTransitionMutator("t", testTransitionMutator{}).Parallel()
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) > 0 {
+		t.Fatalf("unexpected parse errors: %v", errs)
+	}
+	return ctx, ctx.ResolveDependencies(nil)
+}
+
+func TestTransitionMutator(t *testing.T) {
+	ctx, errs := setupTransitionTest(t, `
+		transition_module {
+			name: "A",
+			split: ["a", "b"],
+			deps: ["B"],
+		}
+
+		transition_module {
+			name: "B",
+			split: ["a"],
+			deps: ["C"],
+		}
+
+		transition_module {
+			name: "C",
+			split: ["c"],
+			incoming: "c",
+		}
+
+		transition_module {
+			name: "D",
+			split: ["d"],
+		}
+
+		transition_module {
+			name: "E",
+			split: ["a"],
+			outgoing: "b",
+			deps: ["F"],
+		}
+
+		transition_module {
+			name: "F",
+			split: ["x"],
+		}
+	`)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected dep errors: %v", errs)
+	}
+
+	var variants []string
+	deps := make(map[string][]string)
+	ctx.VisitAllModules(func(m Module) {
+		module := m.(*transitionTestModule)
+		variant := ctx.ModuleName(m) + "{" + ctx.ModuleSubDir(m) + "}"
+		variants = append(variants, variant)
+		if g, w := module.properties.Mutated, ctx.ModuleSubDir(m); g != w {
+			t.Errorf("expected Mutate to be called on %s with %q, got %q", variant, w, g)
+		}
+		ctx.VisitDirectDeps(m, func(dep Module) {
+			deps[variant] = append(deps[variant], ctx.ModuleName(dep)+"{"+ctx.ModuleSubDir(dep)+"}")
+		})
+	})
+	sort.Strings(variants)
+
+	expectedVariants := []string{
+		"A{a}", "A{b}",
+		"B{a}", "B{b}",
+		"C{c}",
+		"D{d}",
+		"E{a}",
+		"F{b}", "F{x}",
+	}
+	if !reflect.DeepEqual(variants, expectedVariants) {
+		t.Errorf("expected variants %q, got %q", expectedVariants, variants)
+	}
+
+	expectedDeps := map[string][]string{
+		"A{a}": {"B{a}"},
+		"A{b}": {"B{b}"},
+		"B{a}": {"C{c}"},
+		"B{b}": {"C{c}"},
+		"E{a}": {"F{b}"},
+	}
+	if !reflect.DeepEqual(deps, expectedDeps) {
+		t.Errorf("expected deps %q, got %q", expectedDeps, deps)
+	}
+}
+
+func TestTransitionMutatorEmptySplit(t *testing.T) {
+	_, errs := setupTransitionTest(t, `
+		transition_module {
+			name: "A",
+		}
+	`)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), `returned no variations from Split for module "A"`) {
+		t.Errorf("expected an error for an empty Split, got %v", errs)
+	}
+}
@@ -24,6 +24,70 @@ import (
 	"github.com/google/blueprint/proptools"
 )
 
+// A PropertyUnpackError describes a property in a Blueprints file that could
+// not be unpacked into the property structs of its module type, either
+// because it has the wrong type or because no property has its name.
+type PropertyUnpackError struct {
+	BlueprintError
+
+	// ModuleType is the type of the module that the property was set on.
+	ModuleType string
+
+	// Property is the name of the property, with "." separating the names of
+	// nested properties.
+	Property string
+
+	// Suggestion is the name of the recognized property that is closest to
+	// Property, if Property is not recognized.
+	Suggestion string
+
+	// Type is the expected type of Property, or of Suggestion if Property is
+	// not recognized.
+	Type string
+
+	// Doc is the documentation of the property named by Property or
+	// Suggestion, if known.  Blueprint doesn't have access to the source of the
+	// property structs, so it is left for the caller to fill in, for example
+	// using bpdoc.
+	Doc string
+}
+
+func (e *PropertyUnpackError) Error() string {
+	msg := e.BlueprintError.Error()
+	if e.Doc != "" {
+		name := e.Property
+		if e.Suggestion != "" {
+			name = e.Suggestion
+		}
+		doc := strings.Replace(strings.TrimSpace(e.Doc), "\n", "\n        ", -1)
+		msg += fmt.Sprintf("\n    %s (%s):\n        %s", name, e.Type, doc)
+	}
+	return msg
+}
+
+// DocumentedProperty returns the name of the property whose documentation
+// belongs in Doc, the suggested property for an unrecognized property.
+func (e *PropertyUnpackError) DocumentedProperty() string {
+	if e.Suggestion != "" {
+		return e.Suggestion
+	}
+	if e.Type == "" {
+		return ""
+	}
+	return e.Property
+}
+
+// setPropertyErrorsModuleType sets the module type of the PropertyUnpackErrors
+// in errs, and returns errs.
+func setPropertyErrorsModuleType(errs []error, moduleType string) []error {
+	for _, err := range errs {
+		if propErr, ok := err.(*PropertyUnpackError); ok {
+			propErr.ModuleType = moduleType
+		}
+	}
+	return errs
+}
+
 type packedProperty struct {
 	property *parser.Property
 	unpacked bool
@@ -49,7 +113,7 @@ func unpackProperties(propertyDefs []*parser.Property,
 			panic("properties must be a pointer to a struct")
 		}
 
-		newErrs := unpackStructValue("", propertiesValue, propertyMap, "", "")
+		newErrs := unpackStructValue("", propertiesValue, propertyMap, "", "", nil)
 		errs = append(errs, newErrs...)
 
 		if len(errs) >= maxErrors {
@@ -59,13 +123,25 @@ func unpackProperties(propertyDefs []*parser.Property,
 
 	// Report any properties that didn't have corresponding struct fields as
 	// errors.
+	var knownProperties map[string]string
 	result := make(map[string]*parser.Property)
 	for name, packedProperty := range propertyMap {
 		result[name] = packedProperty.property
 		if !packedProperty.unpacked {
-			err := &BlueprintError{
-				Err: fmt.Errorf("unrecognized property %q", name),
-				Pos: packedProperty.property.ColonPos,
+			err := &PropertyUnpackError{
+				BlueprintError: BlueprintError{
+					Err: fmt.Errorf("unrecognized property %q", name),
+					Pos: packedProperty.property.ColonPos,
+				},
+				Property: name,
+			}
+			if knownProperties == nil {
+				knownProperties = propertyTypes(propertiesStructs)
+			}
+			if suggestion := closestPropertyName(name, knownProperties); suggestion != "" {
+				err.Err = fmt.Errorf("unrecognized property %q, did you mean %q?", name, suggestion)
+				err.Suggestion = suggestion
+				err.Type = knownProperties[suggestion]
 			}
 			errs = append(errs, err)
 		}
@@ -118,8 +194,12 @@ func buildPropertyMap(namePrefix string, propertyDefs []*parser.Property,
 	return
 }
 
+// unpackStructValue unpacks the properties in propertyMap into the fields of
+// structValue, except for the properties in excluded, which were excluded
+// from an embedded struct by the tag of its field.
 func unpackStructValue(namePrefix string, structValue reflect.Value,
-	propertyMap map[string]*packedProperty, filterKey, filterValue string) []error {
+	propertyMap map[string]*packedProperty, filterKey, filterValue string,
+	excluded map[string]bool) []error {
 
 	structType := structValue.Type()
 
@@ -137,14 +217,19 @@ func unpackStructValue(namePrefix string, structValue reflect.Value,
 			field.Anonymous = true
 		}
 
-		if field.PkgPath != "" {
+		if !proptools.IsPropertyField(field) {
 			// This is an unexported field, so just skip it.
 			continue
 		}
 
 		propertyName := namePrefix + proptools.PropertyNameForField(field.Name)
+		if !field.Anonymous && excluded[propertyName] {
+			continue
+		}
 
-		if !fieldValue.CanSet() {
+		// The exported fields of embedded structs of unexported types are
+		// settable even though the embedded struct isn't.
+		if field.PkgPath == "" && !fieldValue.CanSet() {
 			panic(fmt.Errorf("field %s is not settable", propertyName))
 		}
 
@@ -202,7 +287,8 @@ func unpackStructValue(namePrefix string, structValue reflect.Value,
 		}
 
 		if field.Anonymous && fieldValue.Kind() == reflect.Struct {
-			newErrs := unpackStructValue(namePrefix, fieldValue, propertyMap, filterKey, filterValue)
+			newErrs := unpackStructValue(namePrefix, fieldValue, propertyMap, filterKey, filterValue,
+				proptools.AddExcludedProperties(field, namePrefix, excluded))
 			errs = append(errs, newErrs...)
 			continue
 		}
@@ -242,20 +328,20 @@ func unpackStructValue(namePrefix string, structValue reflect.Value,
 
 		switch kind := fieldValue.Kind(); kind {
 		case reflect.Bool:
-			newErrs = unpackBool(fieldValue, packedProperty.property)
+			newErrs = unpackBool(fieldValue, packedProperty.property, propertyName)
 		case reflect.String:
-			newErrs = unpackString(fieldValue, packedProperty.property)
+			newErrs = unpackString(fieldValue, packedProperty.property, propertyName)
 		case reflect.Slice:
-			newErrs = unpackSlice(fieldValue, packedProperty.property)
+			newErrs = unpackSlice(fieldValue, packedProperty.property, propertyName)
 		case reflect.Ptr:
 			switch ptrKind := fieldValue.Type().Elem().Kind(); ptrKind {
 			case reflect.Bool:
 				newValue := reflect.New(fieldValue.Type().Elem())
-				newErrs = unpackBool(newValue.Elem(), packedProperty.property)
+				newErrs = unpackBool(newValue.Elem(), packedProperty.property, propertyName)
 				fieldValue.Set(newValue)
 			case reflect.String:
 				newValue := reflect.New(fieldValue.Type().Elem())
-				newErrs = unpackString(newValue.Elem(), packedProperty.property)
+				newErrs = unpackString(newValue.Elem(), packedProperty.property, propertyName)
 				fieldValue.Set(newValue)
 			default:
 				panic(fmt.Errorf("unexpected pointer kind %s", ptrKind))
@@ -278,7 +364,7 @@ func unpackStructValue(namePrefix string, structValue reflect.Value,
 					localFilterKey, localFilterValue = k, v
 				}
 			}
-			newErrs = unpackStruct(propertyName+".", fieldValue,
+			newErrs = unpackStruct(propertyName, fieldValue,
 				packedProperty.property, propertyMap, localFilterKey, localFilterValue)
 		default:
 			panic(fmt.Errorf("unexpected kind %s", kind))
@@ -292,40 +378,47 @@ func unpackStructValue(namePrefix string, structValue reflect.Value,
 	return errs
 }
 
-func unpackBool(boolValue reflect.Value, property *parser.Property) []error {
+// propertyTypeError returns the error for a property that was set to a value
+// of a different type than its property struct field.
+func propertyTypeError(property *parser.Property, propertyName, expectedType string) []error {
+	return []error{
+		&PropertyUnpackError{
+			BlueprintError: BlueprintError{
+				Err: fmt.Errorf("can't assign %s value to %s property %q",
+					property.Value.Type(), expectedType, property.Name),
+				Pos: property.Value.Pos(),
+			},
+			Property: propertyName,
+			Type:     expectedType,
+		},
+	}
+}
+
+func unpackBool(boolValue reflect.Value, property *parser.Property, propertyName string) []error {
 	b, ok := property.Value.Eval().(*parser.Bool)
 	if !ok {
-		return []error{
-			fmt.Errorf("%s: can't assign %s value to bool property %q",
-				property.Value.Pos(), property.Value.Type(), property.Name),
-		}
+		return propertyTypeError(property, propertyName, "bool")
 	}
 	boolValue.SetBool(b.Value)
 	return nil
 }
 
 func unpackString(stringValue reflect.Value,
-	property *parser.Property) []error {
+	property *parser.Property, propertyName string) []error {
 
 	s, ok := property.Value.Eval().(*parser.String)
 	if !ok {
-		return []error{
-			fmt.Errorf("%s: can't assign %s value to string property %q",
-				property.Value.Pos(), property.Value.Type(), property.Name),
-		}
+		return propertyTypeError(property, propertyName, "string")
 	}
 	stringValue.SetString(s.Value)
 	return nil
 }
 
-func unpackSlice(sliceValue reflect.Value, property *parser.Property) []error {
+func unpackSlice(sliceValue reflect.Value, property *parser.Property, propertyName string) []error {
 
 	l, ok := property.Value.Eval().(*parser.List)
 	if !ok {
-		return []error{
-			fmt.Errorf("%s: can't assign %s value to list property %q",
-				property.Value.Pos(), property.Value.Type(), property.Name),
-		}
+		return propertyTypeError(property, propertyName, "list")
 	}
 
 	list := make([]string, len(l.Values))
@@ -342,24 +435,23 @@ func unpackSlice(sliceValue reflect.Value, property *parser.Property) []error {
 	return nil
 }
 
-func unpackStruct(namePrefix string, structValue reflect.Value,
+func unpackStruct(propertyName string, structValue reflect.Value,
 	property *parser.Property, propertyMap map[string]*packedProperty,
 	filterKey, filterValue string) []error {
 
 	m, ok := property.Value.Eval().(*parser.Map)
 	if !ok {
-		return []error{
-			fmt.Errorf("%s: can't assign %s value to map property %q",
-				property.Value.Pos(), property.Value.Type(), property.Name),
-		}
+		return propertyTypeError(property, propertyName, "map")
 	}
 
+	namePrefix := propertyName + "."
+
 	errs := buildPropertyMap(namePrefix, m.Properties, propertyMap)
 	if len(errs) > 0 {
 		return errs
 	}
 
-	return unpackStructValue(namePrefix, structValue, propertyMap, filterKey, filterValue)
+	return unpackStructValue(namePrefix, structValue, propertyMap, filterKey, filterValue, nil)
 }
 
 func HasFilter(field reflect.StructTag) (k, v string, err error) {
@@ -387,3 +479,108 @@ func HasFilter(field reflect.StructTag) (k, v string, err error) {
 
 	return "", "", nil
 }
+
+// propertyTypes returns the names of the properties that can be set in
+// Blueprints files for the given property structs, mapped to their types.
+func propertyTypes(propertiesStructs []interface{}) map[string]string {
+	types := make(map[string]string)
+	for _, properties := range propertiesStructs {
+		addPropertyTypes("", reflect.ValueOf(properties).Elem().Type(), types, nil)
+	}
+	return types
+}
+
+func addPropertyTypes(namePrefix string, structType reflect.Type, types map[string]string,
+	excluded map[string]bool) {
+
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if !proptools.IsPropertyField(field) || proptools.HasTag(field, "blueprint", "mutated") {
+			continue
+		}
+
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+
+		if field.Anonymous || field.Name == "BlueprintEmbed" {
+			if fieldType.Kind() == reflect.Struct {
+				addPropertyTypes(namePrefix, fieldType, types,
+					proptools.AddExcludedProperties(field, namePrefix, excluded))
+			}
+			continue
+		}
+
+		propertyName := namePrefix + proptools.PropertyNameForField(field.Name)
+		if excluded[propertyName] {
+			continue
+		}
+		switch fieldType.Kind() {
+		case reflect.Bool:
+			types[propertyName] = "bool"
+		case reflect.String:
+			types[propertyName] = "string"
+		case reflect.Slice:
+			types[propertyName] = "list"
+		case reflect.Struct:
+			types[propertyName] = "map"
+			addPropertyTypes(propertyName+".", fieldType, types, nil)
+		case reflect.Interface:
+			// The type of an interface property depends on the value of the
+			// field, which isn't known here.
+			types[propertyName] = "map"
+		}
+	}
+}
+
+// closestPropertyName returns the name in types with the smallest edit
+// distance to name, or "" if none of them is close enough to be a likely typo.
+func closestPropertyName(name string, types map[string]string) string {
+	maxDistance := len(name) / 3
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+
+	closest := ""
+	closestDistance := maxDistance + 1
+	for candidate := range types {
+		d := editDistance(name, candidate)
+		if d < closestDistance || (d == closestDistance && candidate < closest) {
+			closest, closestDistance = candidate, d
+		}
+	}
+	return closest
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
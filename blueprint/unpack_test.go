@@ -18,6 +18,8 @@ import (
 	"bytes"
 	"fmt"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
 	"text/scanner"
 
@@ -498,9 +500,58 @@ var validUnpackTestCases = []struct {
 			},
 		},
 	},
+
+	// Anonymous struct of an unexported type
+	{
+		input: `
+			m {
+				name: "abc",
+				nested: {
+					name: "def",
+				},
+			}
+		`,
+		output: []interface{}{
+			struct {
+				embeddedStruct
+				Nested struct {
+					embeddedStruct
+				}
+			}{
+				embeddedStruct: embeddedStruct{
+					Name: "abc",
+				},
+				Nested: struct {
+					embeddedStruct
+				}{
+					embeddedStruct: embeddedStruct{
+						Name: "def",
+					},
+				},
+			},
+		},
+	},
+
+	// Anonymous struct with an excluded property
+	{
+		input: `
+			m {
+				name: "abc",
+			}
+		`,
+		output: []interface{}{
+			struct {
+				Name           string
+				EmbeddedStruct `blueprint:"exclude(name)"`
+			}{
+				Name: "abc",
+			},
+		},
+	},
 }
 
 type EmbeddedStruct struct{ Name string }
+type embeddedStruct struct{ Name string }
 type EmbeddedInterface interface{}
 
 func TestUnpackProperties(t *testing.T) {
@@ -563,6 +614,103 @@ func TestUnpackProperties(t *testing.T) {
 	}
 }
 
+var propertyErrorTestCases = []struct {
+	input string
+	errs  []string
+}{
+	{
+		input: `
+			m {
+				srcz: ["a.c"],
+				nested: {
+					fo: "abc",
+				},
+				unknown: true,
+			}
+		`,
+		errs: []string{
+			`<input>:3:9: unrecognized property "srcz", did you mean "srcs"?`,
+			`<input>:5:8: unrecognized property "nested.fo", did you mean "nested.foo"?`,
+			`<input>:7:12: unrecognized property "unknown"`,
+		},
+	},
+	{
+		input: `
+			m {
+				srcs: "a.c",
+				enabled: ["true"],
+				nested: true,
+			}
+		`,
+		errs: []string{
+			`<input>:3:11: can't assign string value to list property "srcs"`,
+			`<input>:4:14: can't assign list value to bool property "enabled"`,
+			`<input>:5:13: can't assign bool value to map property "nested"`,
+		},
+	},
+}
+
+func TestUnpackPropertyErrors(t *testing.T) {
+	for _, testCase := range propertyErrorTestCases {
+		file, errs := parser.ParseAndEval("<input>", bytes.NewBufferString(testCase.input),
+			parser.NewScope(nil))
+		if len(errs) != 0 {
+			t.Fatalf("unexpected parse errors: %v", errs)
+		}
+
+		properties := &struct {
+			Srcs    []string
+			Enabled *bool
+			Nested  struct {
+				Foo string
+			}
+		}{}
+
+		_, errs = unpackProperties(file.Defs[0].(*parser.Module).Properties, properties)
+
+		var got []string
+		for _, err := range errs {
+			if _, ok := err.(*PropertyUnpackError); !ok {
+				t.Errorf("expected *PropertyUnpackError, got %T", err)
+			}
+			got = append(got, err.Error())
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, testCase.errs) {
+			t.Errorf("test case: %s", testCase.input)
+			t.Errorf("incorrect errors:")
+			t.Errorf("  expected: %q", testCase.errs)
+			t.Errorf("       got: %q", got)
+		}
+	}
+}
+
+func TestPropertyUnpackErrorDoc(t *testing.T) {
+	err := &PropertyUnpackError{
+		BlueprintError: BlueprintError{
+			Err: fmt.Errorf(`unrecognized property "srcz", did you mean "srcs"?`),
+			Pos: scanner.Position{Filename: "Blueprints", Line: 3, Column: 8},
+		},
+		ModuleType: "m",
+		Property:   "srcz",
+		Suggestion: "srcs",
+		Type:       "list",
+		Doc:        "list of source files.\nMay contain globs.\n",
+	}
+
+	if p := err.DocumentedProperty(); p != "srcs" {
+		t.Errorf("expected documented property %q, got %q", "srcs", p)
+	}
+
+	expected := `Blueprints:3:8: unrecognized property "srcz", did you mean "srcs"?
+    srcs (list):
+        list of source files.
+        May contain globs.`
+	if got := err.Error(); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
 func mkpos(offset, line, column int) scanner.Position {
 	return scanner.Position{
 		Offset: offset,
@@ -570,3 +718,56 @@ func mkpos(offset, line, column int) scanner.Position {
 		Column: column,
 	}
 }
+
+type conflictingPropertiesModule struct {
+	SimpleName
+	properties struct {
+		Name string
+		EmbeddedStruct
+		Nested struct {
+			EmbeddedStruct `blueprint:"exclude(name)"`
+			Name           string
+		}
+	}
+}
+
+func newConflictingPropertiesModule() (Module, []interface{}) {
+	m := &conflictingPropertiesModule{}
+	return m, []interface{}{&m.properties, &m.SimpleName.Properties}
+}
+
+func (m *conflictingPropertiesModule) GenerateBuildActions(ModuleContext) {}
+
+func TestStrictPropertyConflicts(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		ctx := NewContext()
+		ctx.SetStrictPropertyConflicts(strict)
+		ctx.RegisterModuleType("conflicting_module", newConflictingPropertiesModule)
+		ctx.MockFileSystem(map[string][]byte{
+			"Blueprints": []byte(`
+				conflicting_module {
+				    name: "A",
+				}
+			`),
+		})
+
+		_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+		if !strict {
+			if len(errs) > 0 {
+				t.Errorf("unexpected errors: %q", errs)
+			}
+			continue
+		}
+
+		if len(errs) != 1 {
+			t.Fatalf("expected 1 error, got %q", errs)
+		}
+		expected := `Blueprints:2:5: module type "conflicting_module": property "name" of`
+		if !strings.HasPrefix(errs[0].Error(), expected) {
+			t.Errorf("expected error starting with %q, got %q", expected, errs[0])
+		}
+		if !strings.Contains(errs[0].Error(), "EmbeddedStruct.Name") {
+			t.Errorf("expected error to list the EmbeddedStruct.Name field, got %q", errs[0])
+		}
+	}
+}
@@ -0,0 +1,281 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/scanner"
+
+	"github.com/google/blueprint/parser"
+)
+
+// builtinVariables are the variables that are read by Blueprint itself, and
+// so are never reported as unused.
+var builtinVariables = map[string]bool{
+	"subdirs":          true,
+	"optional_subdirs": true,
+	"build":            true,
+	"subname":          true,
+	importVarsVariable: true,
+}
+
+// An UnusedDefinition is a variable or module definition in a Blueprints file
+// that is not used.
+type UnusedDefinition struct {
+	Name   string `json:"name"`
+	Type   string `json:"type,omitempty"` // the module type, empty for variables
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+// An UnusedReport lists the unused definitions found by
+// FindUnusedDefinitions, sorted by position.
+type UnusedReport struct {
+	Variables []UnusedDefinition `json:"variables"`
+	Modules   []UnusedDefinition `json:"modules"`
+}
+
+// WriteJSON writes the report as a JSON object.
+func (r *UnusedReport) WriteJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// WriteText writes the report in a human readable form, one definition per
+// line.
+func (r *UnusedReport) WriteText(w io.Writer) error {
+	for _, v := range r.Variables {
+		_, err := fmt.Fprintf(w, "%s:%d:%d: unused variable %q\n", v.File, v.Line, v.Column, v.Name)
+		if err != nil {
+			return err
+		}
+	}
+	for _, m := range r.Modules {
+		_, err := fmt.Fprintf(w, "%s:%d:%d: unused module %q (%s)\n", m.File, m.Line, m.Column, m.Name, m.Type)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d unused variables, %d unused modules\n", len(r.Variables), len(r.Modules))
+	return err
+}
+
+type variableUsage struct {
+	sync.Mutex
+
+	defs []*parser.Assignment
+
+	// the variables referenced by the value of each variable
+	refs map[*parser.Assignment][]*parser.Assignment
+
+	// the variables referenced by module definitions, and by the variables
+	// read by Blueprint itself, like subdirs and build
+	moduleRefs map[*parser.Assignment]bool
+}
+
+// SetTrackUnusedDefinitions enables recording the variable definitions and
+// references in the parsed Blueprints files, which is needed by
+// FindUnusedDefinitions.  It must be called before ParseBlueprintsFiles.
+func (c *Context) SetTrackUnusedDefinitions(track bool) {
+	if track {
+		c.variableUsage = &variableUsage{
+			refs:       make(map[*parser.Assignment][]*parser.Assignment),
+			moduleRefs: make(map[*parser.Assignment]bool),
+		}
+	} else {
+		c.variableUsage = nil
+	}
+}
+
+// addFile records the variables defined and referenced in a parsed and
+// evaluated Blueprints file.  Variable references are resolved in the final
+// scope of the file, which is safe because a variable can't be redefined once
+// it has been referenced.
+func (u *variableUsage) addFile(file *parser.File, scope *parser.Scope) {
+	u.Lock()
+	defer u.Unlock()
+
+	for _, def := range file.Defs {
+		switch def := def.(type) {
+		case *parser.Assignment:
+			// A += assignment modifies the variable defined by an earlier
+			// assignment, which is also the one returned by the scope.
+			assignment, _ := scope.Get(def.Name)
+			if assignment == nil {
+				continue
+			}
+			builtin := builtinVariables[def.Name]
+			if def.Assigner == "=" && !builtin {
+				u.defs = append(u.defs, def)
+			}
+			visitVariables(def.OrigValue, func(v *parser.Variable) {
+				ref, _ := scope.Get(v.Name)
+				if ref == nil {
+					return
+				}
+				if builtin {
+					// The variables read by Blueprint use the variables
+					// they reference like a module does.
+					u.moduleRefs[ref] = true
+					return
+				}
+				u.refs[assignment] = append(u.refs[assignment], ref)
+			})
+		case *parser.Module:
+			visitVariables(&def.Map, func(v *parser.Variable) {
+				if ref, _ := scope.Get(v.Name); ref != nil {
+					u.moduleRefs[ref] = true
+				}
+			})
+		}
+	}
+}
+
+// visitVariables calls visit for every variable reference in e.  The values of
+// the referenced variables are not visited.
+func visitVariables(e parser.Expression, visit func(*parser.Variable)) {
+	switch e := e.(type) {
+	case *parser.Variable:
+		visit(e)
+	case *parser.Operator:
+		visitVariables(e.Args[0], visit)
+		visitVariables(e.Args[1], visit)
+	case *parser.List:
+		for _, value := range e.Values {
+			visitVariables(value, visit)
+		}
+	case *parser.Map:
+		for _, property := range e.Properties {
+			visitVariables(property.Value, visit)
+		}
+	}
+}
+
+// FindUnusedDefinitions returns the variables that are not referenced by any
+// module, directly or through other variables, and the modules that no module
+// in another module group depends on.  Modules are not reported if isRoot
+// returns true for any of their variants; it should return true for modules
+// that are built directly, and for modules that are used other than through
+// dependencies, like defaults.  Variables are only reported if
+// SetTrackUnusedDefinitions was called before ParseBlueprintsFiles.
+//
+// FindUnusedDefinitions must be called after ResolveDependencies.
+func (c *Context) FindUnusedDefinitions(isRoot func(Module) bool) *UnusedReport {
+	if !c.dependenciesReady {
+		panic("FindUnusedDefinitions called before ResolveDependencies")
+	}
+
+	report := &UnusedReport{}
+
+	if u := c.variableUsage; u != nil {
+		// Variables imported with import_vars are evaluated separately from
+		// the definitions in the file that defines them, so references are
+		// matched to definitions by position.
+		defsByPos := make(map[scanner.Position]*parser.Assignment, len(u.defs))
+		for _, def := range u.defs {
+			defsByPos[def.NamePos] = def
+		}
+
+		used := make(map[*parser.Assignment]bool)
+		var markUsed func(*parser.Assignment)
+		markUsed = func(assignment *parser.Assignment) {
+			if def, ok := defsByPos[assignment.NamePos]; ok {
+				assignment = def
+			}
+			if used[assignment] {
+				return
+			}
+			used[assignment] = true
+			for _, ref := range u.refs[assignment] {
+				markUsed(ref)
+			}
+		}
+		for assignment := range u.moduleRefs {
+			markUsed(assignment)
+		}
+
+		for _, def := range u.defs {
+			if !used[def] {
+				report.Variables = append(report.Variables, UnusedDefinition{
+					Name:   def.Name,
+					File:   def.NamePos.Filename,
+					Line:   def.NamePos.Line,
+					Column: def.NamePos.Column,
+				})
+			}
+		}
+	}
+
+	for _, group := range c.moduleGroups {
+		if !isModuleGroupUsed(group, isRoot) {
+			module := group.modules[0]
+			report.Modules = append(report.Modules, UnusedDefinition{
+				Name:   group.name,
+				Type:   module.typeName,
+				File:   module.pos.Filename,
+				Line:   module.pos.Line,
+				Column: module.pos.Column,
+			})
+		}
+	}
+
+	sort.Sort(unusedDefinitionSorter(report.Variables))
+	sort.Sort(unusedDefinitionSorter(report.Modules))
+
+	return report
+}
+
+func isModuleGroupUsed(group *moduleGroup, isRoot func(Module) bool) bool {
+	for _, module := range group.modules {
+		if isRoot != nil && isRoot(module.logicModule) {
+			return true
+		}
+		for _, reverseDep := range module.reverseDeps {
+			if reverseDep.group != group {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type unusedDefinitionSorter []UnusedDefinition
+
+func (s unusedDefinitionSorter) Len() int {
+	return len(s)
+}
+
+func (s unusedDefinitionSorter) Less(i, j int) bool {
+	if s[i].File != s[j].File {
+		return s[i].File < s[j].File
+	}
+	if s[i].Line != s[j].Line {
+		return s[i].Line < s[j].Line
+	}
+	return s[i].Column < s[j].Column
+}
+
+func (s unusedDefinitionSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
@@ -0,0 +1,157 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestFindUnusedDefinitions(t *testing.T) {
+	ctx := NewContext()
+	ctx.RegisterModuleType("foo_module", newFooModule)
+	ctx.RegisterModuleType("bar_module", newBarModule)
+	ctx.SetTrackUnusedDefinitions(true)
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			subdirs = ["sub"]
+
+			inherited = true
+			appended = ["B"]
+			extra = ["c"]
+			appended += extra
+			unused = "d"
+			only_in_unused = "e"
+			unused_chain = only_in_unused
+
+			foo_module {
+			    name: "A",
+			    deps: appended,
+			}
+
+			bar_module {
+			    name: "B",
+			}
+		`),
+		"sub/Blueprints": []byte(`
+			bar_module {
+			    name: "C",
+			    deps: ["D"],
+			    bar: true,
+			}
+
+			bar_module {
+			    name: "D",
+			    bar: inherited,
+			}
+
+			bar_module {
+			    name: "c",
+			}
+		`),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) == 0 {
+		errs = ctx.ResolveDependencies(nil)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+
+	report := ctx.FindUnusedDefinitions(func(m Module) bool {
+		_, isFoo := m.(*fooModule)
+		return isFoo
+	})
+
+	expected := &UnusedReport{
+		Variables: []UnusedDefinition{
+			{Name: "unused", File: "Blueprints", Line: 8, Column: 4},
+			{Name: "only_in_unused", File: "Blueprints", Line: 9, Column: 4},
+			{Name: "unused_chain", File: "Blueprints", Line: 10, Column: 4},
+		},
+		Modules: []UnusedDefinition{
+			{Name: "C", Type: "bar_module", File: "sub/Blueprints", Line: 2, Column: 4},
+		},
+	}
+
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("incorrect report:")
+		t.Errorf("  expected: %+v", expected)
+		t.Errorf("       got: %+v", report)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := report.WriteText(buf); err != nil {
+		t.Fatal(err)
+	}
+	expectedText := `Blueprints:8:4: unused variable "unused"
+Blueprints:9:4: unused variable "only_in_unused"
+Blueprints:10:4: unused variable "unused_chain"
+sub/Blueprints:2:4: unused module "C" (bar_module)
+3 unused variables, 1 unused modules
+`
+	if buf.String() != expectedText {
+		t.Errorf("incorrect text report:")
+		t.Errorf("  expected: %q", expectedText)
+		t.Errorf("       got: %q", buf.String())
+	}
+}
+
+func TestFindUnusedDefinitionsBuiltinVariables(t *testing.T) {
+	ctx := NewContext()
+	ctx.RegisterModuleType("bar_module", newBarModule)
+	ctx.SetTrackUnusedDefinitions(true)
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			sub_dirs = ["sub"]
+			dirs = sub_dirs
+			build_files = ["other.bp"]
+			subdirs = dirs
+			build = build_files
+			unused = "x"
+		`),
+		"sub/Blueprints": []byte(`
+			bar_module {
+			    name: "A",
+			}
+		`),
+		"other.bp": []byte(`
+			bar_module {
+			    name: "B",
+			}
+		`),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) == 0 {
+		errs = ctx.ResolveDependencies(nil)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+
+	report := ctx.FindUnusedDefinitions(func(Module) bool { return true })
+
+	expected := []UnusedDefinition{
+		{Name: "unused", File: "Blueprints", Line: 7, Column: 4},
+	}
+	if !reflect.DeepEqual(report.Variables, expected) {
+		t.Errorf("incorrect unused variables:")
+		t.Errorf("  expected: %+v", expected)
+		t.Errorf("       got: %+v", report.Variables)
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A VariantID identifies a single variant of a module by the module name and
+// the variations that the mutators created it with.  Unlike the variant name,
+// which depends on the order the mutators were registered in, the string form
+// of a VariantID is canonical, so it can be used to refer to a variant from
+// logs, query output, caches and external tools across runs.
+//
+// The string form is the module name, followed by the variations sorted by
+// mutator name in braces if there are any:
+//
+//	libfoo
+//	libfoo{arch=arm64,link=shared}
+//
+// The characters '\', '{', '}', ',' and '=' are escaped with a backslash in
+// module names, mutator names and variation names.
+type VariantID struct {
+	Name string
+
+	// Variations are the variations of the variant.  They are sorted by
+	// Mutator in the VariantIDs returned by Blueprint.
+	Variations []Variation
+}
+
+// NewVariantID returns the VariantID for the variant of the named module with
+// the given variations, which may be in any order.
+func NewVariantID(name string, variations ...Variation) VariantID {
+	id := VariantID{
+		Name:       name,
+		Variations: append([]Variation(nil), variations...),
+	}
+	sort.Sort(variationsByMutator(id.Variations))
+	return id
+}
+
+func (id VariantID) String() string {
+	s := variantIDEscaper.Replace(id.Name)
+	if len(id.Variations) == 0 {
+		return s
+	}
+
+	sorted := append([]Variation(nil), id.Variations...)
+	sort.Sort(variationsByMutator(sorted))
+
+	variations := make([]string, len(sorted))
+	for i, v := range sorted {
+		variations[i] = variantIDEscaper.Replace(v.Mutator) + "=" +
+			variantIDEscaper.Replace(v.Variation)
+	}
+	return s + "{" + strings.Join(variations, ",") + "}"
+}
+
+// Equal returns true if the two VariantIDs refer to the same variant.
+func (id VariantID) Equal(other VariantID) bool {
+	return id.String() == other.String()
+}
+
+var variantIDEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`{`, `\{`,
+	`}`, `\}`,
+	`,`, `\,`,
+	`=`, `\=`)
+
+// ParseVariantID parses the string form of a VariantID, as returned by
+// VariantID.String.  The variations may be listed in any order, but each
+// mutator may only appear once.
+func ParseVariantID(s string) (VariantID, error) {
+	var id VariantID
+
+	// Split s at the unescaped special characters into tokens holding the
+	// unescaped text between them and the special character that ended the
+	// text, or 0 for the end of the string.
+	type token struct {
+		text string
+		end  byte
+	}
+	var tokens []token
+	var text []byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			if i+1 == len(s) {
+				return id, fmt.Errorf("invalid variant ID %q: trailing backslash", s)
+			}
+			i++
+			text = append(text, s[i])
+		case '{', '}', ',', '=':
+			tokens = append(tokens, token{string(text), c})
+			text = text[:0]
+		default:
+			text = append(text, c)
+		}
+	}
+	tokens = append(tokens, token{string(text), 0})
+
+	id.Name = tokens[0].text
+	if id.Name == "" {
+		return id, fmt.Errorf("invalid variant ID %q: empty module name", s)
+	}
+
+	switch tokens[0].end {
+	case 0:
+		return id, nil
+	case '{':
+	default:
+		return id, fmt.Errorf("invalid variant ID %q: unexpected %q after module name", s, tokens[0].end)
+	}
+
+	last := tokens[len(tokens)-1]
+	if len(tokens) < 3 || last.end != 0 || last.text != "" || tokens[len(tokens)-2].end != '}' {
+		return id, fmt.Errorf("invalid variant ID %q: variations must be a list of mutator=variation in braces", s)
+	}
+
+	// The remaining tokens alternate between mutator names ending with '='
+	// and variation names ending with ',' or the final '}'.
+	seen := make(map[string]bool)
+	variations := tokens[1 : len(tokens)-1]
+	for i := 0; i < len(variations); i += 2 {
+		mutator := variations[i]
+		if mutator.end != '=' || i+1 == len(variations) {
+			return id, fmt.Errorf("invalid variant ID %q: variations must be a list of mutator=variation in braces", s)
+		}
+		variation := variations[i+1]
+		expectedEnd := byte(',')
+		if i+2 == len(variations) {
+			expectedEnd = '}'
+		}
+		if variation.end != expectedEnd {
+			return id, fmt.Errorf("invalid variant ID %q: variations must be a list of mutator=variation in braces", s)
+		}
+		if mutator.text == "" {
+			return id, fmt.Errorf("invalid variant ID %q: empty mutator name", s)
+		}
+		if seen[mutator.text] {
+			return id, fmt.Errorf("invalid variant ID %q: duplicate mutator %q", s, mutator.text)
+		}
+		seen[mutator.text] = true
+		id.Variations = append(id.Variations, Variation{mutator.text, variation.text})
+	}
+
+	sort.Sort(variationsByMutator(id.Variations))
+	return id, nil
+}
+
+type variationsByMutator []Variation
+
+func (l variationsByMutator) Len() int           { return len(l) }
+func (l variationsByMutator) Less(i, j int) bool { return l[i].Mutator < l[j].Mutator }
+func (l variationsByMutator) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
+func (module *moduleInfo) variantID() VariantID {
+	id := VariantID{Name: module.Name()}
+	module.variant.each(func(mutator, variation string) {
+		id.Variations = append(id.Variations, Variation{mutator, variation})
+	})
+	sort.Sort(variationsByMutator(id.Variations))
+	return id
+}
+
+// ModuleVariantID returns the VariantID of a module variant.
+func (c *Context) ModuleVariantID(logicModule Module) VariantID {
+	return c.moduleInfo[logicModule].variantID()
+}
+
+// ModuleForVariantID returns the module variant that id refers to, or nil if
+// there is no such variant.
+func (c *Context) ModuleForVariantID(id VariantID) Module {
+	s := id.String()
+	for _, module := range c.modulesFromName(id.Name) {
+		if module.variantID().String() == s {
+			return module.logicModule
+		}
+	}
+	return nil
+}
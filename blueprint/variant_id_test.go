@@ -0,0 +1,157 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"reflect"
+	"testing"
+)
+
+var variantIDTestCases = []struct {
+	in  string
+	id  VariantID
+	out string
+	err string
+}{
+	{
+		in: "libfoo",
+		id: VariantID{Name: "libfoo"},
+	},
+	{
+		in: "libfoo{arch=arm64,link=shared}",
+		id: VariantID{Name: "libfoo", Variations: []Variation{{"arch", "arm64"}, {"link", "shared"}}},
+	},
+	{
+		in:  "libfoo{link=shared,arch=arm64}",
+		id:  VariantID{Name: "libfoo", Variations: []Variation{{"arch", "arm64"}, {"link", "shared"}}},
+		out: "libfoo{arch=arm64,link=shared}",
+	},
+	{
+		in: "libfoo{arch=}",
+		id: VariantID{Name: "libfoo", Variations: []Variation{{"arch", ""}}},
+	},
+	{
+		in: `a\{b\}{m\=1=x\,y\\}`,
+		id: VariantID{Name: "a{b}", Variations: []Variation{{"m=1", `x,y\`}}},
+	},
+	{
+		in:  "",
+		err: `invalid variant ID "": empty module name`,
+	},
+	{
+		in:  "libfoo{}",
+		err: `invalid variant ID "libfoo{}": variations must be a list of mutator=variation in braces`,
+	},
+	{
+		in:  "libfoo{arch=arm",
+		err: `invalid variant ID "libfoo{arch=arm": variations must be a list of mutator=variation in braces`,
+	},
+	{
+		in:  "libfoo{arch=arm}x",
+		err: `invalid variant ID "libfoo{arch=arm}x": variations must be a list of mutator=variation in braces`,
+	},
+	{
+		in:  "libfoo{arch,link=shared}",
+		err: `invalid variant ID "libfoo{arch,link=shared}": variations must be a list of mutator=variation in braces`,
+	},
+	{
+		in:  "libfoo{arch=arm,arch=x86}",
+		err: `invalid variant ID "libfoo{arch=arm,arch=x86}": duplicate mutator "arch"`,
+	},
+	{
+		in:  "libfoo=x",
+		err: `invalid variant ID "libfoo=x": unexpected '=' after module name`,
+	},
+	{
+		in:  `libfoo\`,
+		err: `invalid variant ID "libfoo\\": trailing backslash`,
+	},
+}
+
+func TestParseVariantID(t *testing.T) {
+	for _, testCase := range variantIDTestCases {
+		id, err := ParseVariantID(testCase.in)
+		if testCase.err != "" {
+			if err == nil || err.Error() != testCase.err {
+				t.Errorf("%q: expected error %q, got %v", testCase.in, testCase.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %s", testCase.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(id, testCase.id) {
+			t.Errorf("%q: expected %#v, got %#v", testCase.in, testCase.id, id)
+		}
+
+		out := testCase.out
+		if out == "" {
+			out = testCase.in
+		}
+		if s := id.String(); s != out {
+			t.Errorf("%q: expected String() %q, got %q", testCase.in, out, s)
+		}
+	}
+}
+
+func TestModuleVariantID(t *testing.T) {
+	ctx := NewContext()
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			foo_module {
+				name: "A",
+			}
+		`),
+	})
+	ctx.RegisterModuleType("foo_module", newFooModule)
+	ctx.RegisterBottomUpMutator("link", func(mctx BottomUpMutatorContext) {
+		mctx.CreateVariations("static", "shared")
+	})
+	ctx.RegisterBottomUpMutator("arch", func(mctx BottomUpMutatorContext) {
+		mctx.CreateVariations("arm64")
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) > 0 {
+		t.Fatalf("unexpected parse errors: %v", errs)
+	}
+	errs = ctx.ResolveDependencies(nil)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected dep errors: %v", errs)
+	}
+
+	var ids []string
+	ctx.VisitAllModules(func(m Module) {
+		id := ctx.ModuleVariantID(m)
+		ids = append(ids, id.String())
+		if found := ctx.ModuleForVariantID(id); found != m {
+			t.Errorf("ModuleForVariantID(%s) returned the wrong module", id)
+		}
+	})
+
+	expected := []string{"A{arch=arm64,link=static}", "A{arch=arm64,link=shared}"}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected %q, got %q", expected, ids)
+	}
+
+	id := NewVariantID("A", Variation{"link", "shared"}, Variation{"arch", "arm64"})
+	if m := ctx.ModuleForVariantID(id); m == nil || ctx.ModuleVariantID(m).String() != id.String() {
+		t.Errorf("ModuleForVariantID(%s) didn't find the variant", id)
+	}
+	if m := ctx.ModuleForVariantID(NewVariantID("A", Variation{"link", "shared"})); m != nil {
+		t.Errorf("expected no variant for a partial VariantID")
+	}
+}
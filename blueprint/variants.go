@@ -0,0 +1,174 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"fmt"
+	"reflect"
+	"text/scanner"
+
+	"github.com/google/blueprint/parser"
+	"github.com/google/blueprint/proptools"
+)
+
+// variantsPropertyName is the Blueprints property that lists the variants
+// created by the mutator registered with RegisterVariantsMutator.
+const variantsPropertyName = "variants"
+
+// A variantOverride holds the properties set for one entry of a variants
+// block, unpacked into empty copies of the module's property structs.
+type variantOverride struct {
+	name       string
+	pos        scanner.Position
+	properties []interface{}
+}
+
+// RegisterVariantsMutator registers a BottomUpMutator named name that splits
+// every module with a variants block in its Blueprints definition into one
+// variant per entry of the block, for example:
+//
+//     cc_library {
+//         name: "foo",
+//         srcs: ["foo.c"],
+//         variants: {
+//             fast: { cflags: ["-O3"] },
+//             debug: { cflags: ["-O0", "-g"], srcs: ["debug.c"] },
+//         },
+//     }
+//
+// The properties of each entry are appended to the module's properties in
+// its variant, with the same semantics as proptools.AppendProperties.  The
+// variants are created with CreateVariations, so a module that depends on a
+// module split by the mutator depends on the variant with the same name if it
+// was split by the mutator too, and on the first variant otherwise.
+//
+// The variants property is only recognized if RegisterVariantsMutator is
+// called before the Blueprints files are parsed.
+func (c *Context) RegisterVariantsMutator(name string) MutatorHandle {
+	c.variantsMutatorRegistered = true
+	return c.RegisterBottomUpMutator(name, variantsMutator)
+}
+
+func variantsMutator(ctx BottomUpMutatorContext) {
+	overrides := ctx.moduleInfo().variantOverrides
+	if len(overrides) == 0 {
+		return
+	}
+
+	names := make([]string, len(overrides))
+	for i, override := range overrides {
+		names[i] = override.name
+	}
+
+	ctx.CreateVariations(names...)
+
+	for i, variant := range ctx.(*mutatorContext).newModules {
+		variant.variantOverrides = nil
+		for j, properties := range variant.moduleProperties {
+			err := proptools.AppendProperties(properties, overrides[i].properties[j], nil)
+			if err != nil {
+				ctx.Errorf(overrides[i].pos, "variant %q: %s", overrides[i].name, err)
+			}
+		}
+	}
+}
+
+// extractProperty returns the property definitions without the named
+// property, and the named property if it was defined.
+func extractProperty(propertyDefs []*parser.Property, name string) ([]*parser.Property, *parser.Property) {
+	for i, propertyDef := range propertyDefs {
+		if propertyDef.Name == name {
+			rest := make([]*parser.Property, 0, len(propertyDefs)-1)
+			rest = append(rest, propertyDefs[:i]...)
+			rest = append(rest, propertyDefs[i+1:]...)
+			return rest, propertyDef
+		}
+	}
+	return propertyDefs, nil
+}
+
+// unpackVariantOverrides unpacks each entry of a variants property into empty
+// copies of the module's property structs.
+func (c *Context) unpackVariantOverrides(variantsDef *parser.Property,
+	properties []interface{}) ([]variantOverride, []error) {
+
+	variantsMap, ok := variantsDef.Value.Eval().(*parser.Map)
+	if !ok || len(variantsMap.Properties) == 0 {
+		return nil, []error{&BlueprintError{
+			Err: fmt.Errorf("%s must be a non-empty map of variant names to properties",
+				variantsPropertyName),
+			Pos: variantsDef.ColonPos,
+		}}
+	}
+
+	var overrides []variantOverride
+	var errs []error
+	seen := make(map[string]*parser.Property)
+	for _, variantDef := range variantsMap.Properties {
+		if prev, ok := seen[variantDef.Name]; ok {
+			errs = append(errs,
+				&BlueprintError{
+					Err: fmt.Errorf("variant %q already defined", variantDef.Name),
+					Pos: variantDef.ColonPos,
+				},
+				&BlueprintError{
+					Err: fmt.Errorf("<-- previous definition here"),
+					Pos: prev.ColonPos,
+				})
+			continue
+		}
+		seen[variantDef.Name] = variantDef
+
+		variantMap, ok := variantDef.Value.Eval().(*parser.Map)
+		if !ok {
+			errs = append(errs, &BlueprintError{
+				Err: fmt.Errorf("variant %q must be a map of properties", variantDef.Name),
+				Pos: variantDef.ColonPos,
+			})
+			continue
+		}
+
+		for _, propertyDef := range variantMap.Properties {
+			if propertyDef.Name == "name" {
+				errs = append(errs, &BlueprintError{
+					Err: fmt.Errorf("variant %q cannot set the name property", variantDef.Name),
+					Pos: propertyDef.ColonPos,
+				})
+			}
+		}
+
+		variantProperties := make([]interface{}, len(properties))
+		for i, p := range properties {
+			variantProperties[i] = proptools.CloneEmptyProperties(reflect.ValueOf(p).Elem()).Interface()
+		}
+
+		propertyMap, newErrs := unpackProperties(variantMap.Properties, variantProperties...)
+		if len(newErrs) == 0 && c.propertyVariables != nil {
+			newErrs = interpolateProperties(variantProperties, propertyMap, c.propertyVariables)
+		}
+		errs = append(errs, newErrs...)
+
+		overrides = append(overrides, variantOverride{
+			name:       variantDef.Name,
+			pos:        variantDef.ColonPos,
+			properties: variantProperties,
+		})
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return overrides, nil
+}
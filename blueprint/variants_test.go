@@ -0,0 +1,184 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type variantsTestModule struct {
+	SimpleName
+	properties struct {
+		Srcs   []string
+		Cflags []string
+		Debug  *bool
+		Deps   []string
+	}
+}
+
+func newVariantsTestModule() (Module, []interface{}) {
+	m := &variantsTestModule{}
+	return m, []interface{}{&m.properties, &m.SimpleName.Properties}
+}
+
+func (m *variantsTestModule) DynamicDependencies(ctx DynamicDependerModuleContext) []string {
+	return m.properties.Deps
+}
+
+func (m *variantsTestModule) GenerateBuildActions(ctx ModuleContext) {}
+
+func setupVariantsTest(t *testing.T, bp string) (*Context, []error) {
+	ctx := NewContext()
+	ctx.RegisterModuleType("test", newVariantsTestModule)
+	ctx.RegisterVariantsMutator("variants")
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(bp),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) > 0 {
+		return ctx, errs
+	}
+
+	return ctx, ctx.ResolveDependencies(nil)
+}
+
+func TestVariantsMutator(t *testing.T) {
+	ctx, errs := setupVariantsTest(t, `
+		test {
+		    name: "foo",
+		    srcs: ["foo.c"],
+		    cflags: ["-Wall"],
+		    deps: ["bar"],
+		    variants: {
+		        fast: { cflags: ["-O3"] },
+		        debug: { cflags: ["-O0"], srcs: ["debug.c"], debug: true },
+		    },
+		}
+
+		test {
+		    name: "bar",
+		    variants: {
+		        fast: {},
+		        debug: { debug: true },
+		    },
+		}
+
+		test {
+		    name: "baz",
+		    deps: ["bar"],
+		}
+	`)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %q", errs)
+	}
+
+	foos := ctx.modulesFromName("foo")
+	if len(foos) != 2 {
+		t.Fatalf("expected 2 variants of foo, got %d", len(foos))
+	}
+
+	fast := foos[0].logicModule.(*variantsTestModule)
+	debug := foos[1].logicModule.(*variantsTestModule)
+	if foos[0].variantName != "fast" || foos[1].variantName != "debug" {
+		t.Errorf("expected variants fast and debug, got %q and %q",
+			foos[0].variantName, foos[1].variantName)
+	}
+
+	if expected := []string{"-Wall", "-O3"}; !reflect.DeepEqual(fast.properties.Cflags, expected) {
+		t.Errorf("fast: expected cflags %q, got %q", expected, fast.properties.Cflags)
+	}
+	if expected := []string{"foo.c"}; !reflect.DeepEqual(fast.properties.Srcs, expected) {
+		t.Errorf("fast: expected srcs %q, got %q", expected, fast.properties.Srcs)
+	}
+	if fast.properties.Debug != nil {
+		t.Errorf("fast: expected debug to be unset")
+	}
+
+	if expected := []string{"-Wall", "-O0"}; !reflect.DeepEqual(debug.properties.Cflags, expected) {
+		t.Errorf("debug: expected cflags %q, got %q", expected, debug.properties.Cflags)
+	}
+	if expected := []string{"foo.c", "debug.c"}; !reflect.DeepEqual(debug.properties.Srcs, expected) {
+		t.Errorf("debug: expected srcs %q, got %q", expected, debug.properties.Srcs)
+	}
+	if debug.properties.Debug == nil || !*debug.properties.Debug {
+		t.Errorf("debug: expected debug to be true")
+	}
+
+	bars := ctx.modulesFromName("bar")
+	if dep := foos[1].directDeps[0].module; dep != bars[1] {
+		t.Errorf("expected foo debug to depend on bar debug, got %s", dep)
+	}
+
+	baz := ctx.modulesFromName("baz")
+	if len(baz) != 1 {
+		t.Fatalf("expected baz not to be split, got %d variants", len(baz))
+	}
+	if dep := baz[0].directDeps[0].module; dep != bars[0] {
+		t.Errorf("expected baz to depend on the first variant of bar, got %s", dep)
+	}
+}
+
+func TestVariantsMutatorErrors(t *testing.T) {
+	testCases := []struct {
+		bp   string
+		errs []string
+	}{
+		{
+			bp: `
+				test {
+				    name: "foo",
+				    variants: ["a"],
+				}
+			`,
+			errs: []string{
+				"Blueprints:4:17: variants must be a non-empty map of variant names to properties",
+			},
+		},
+		{
+			bp: `
+				test {
+				    name: "foo",
+				    variants: {
+				        a: { name: "bar" },
+				        b: { unknown: true },
+				        a: {},
+				    },
+				}
+			`,
+			errs: []string{
+				`Blueprints:5:22: variant "a" cannot set the name property`,
+				`Blueprints:6:25: unrecognized property "unknown"`,
+				`Blueprints:7:14: variant "a" already defined`,
+				`Blueprints:5:14: <-- previous definition here`,
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		_, errs := setupVariantsTest(t, testCase.bp)
+
+		var got []string
+		for _, err := range errs {
+			got = append(got, err.Error())
+		}
+		if !reflect.DeepEqual(got, testCase.errs) {
+			t.Errorf("incorrect errors for:\n%s\nexpected:\n  %s\ngot:\n  %s", testCase.bp,
+				strings.Join(testCase.errs, "\n  "), strings.Join(got, "\n  "))
+		}
+	}
+}
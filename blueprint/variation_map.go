@@ -0,0 +1,246 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// A variationMap stores the variation that each mutator selected for a variant
+// of a module.  Mutator and variation names are interned in the variationTable
+// of the Context, and the map is a vector of variation indexes, one per
+// mutator, packed into variationBits bits each.  Index 0 means that the mutator didn't select a
+// variation, which is different from selecting the empty variation.  Comparing
+// variationMaps only compares the packed vectors, which is much cheaper than
+// comparing maps of strings in graphs with many mutators.
+//
+// The zero value is an empty map that can't be modified, modifiable maps are
+// returned by variationTable.newMap or cloned from one.  A variationMap must be
+// cloned before it is modified if it is shared.  Only variationMaps of the same
+// variationTable can be compared.
+type variationMap struct {
+	names  *variationTable
+	packed []uint64
+}
+
+const (
+	variationBits        = 16
+	variationsPerWord    = 64 / variationBits
+	variationMask        = 1<<variationBits - 1
+	maxVariationsPerName = variationMask
+)
+
+// A variationTable interns the mutator and variation names of the
+// variationMaps of a Context.  Mutators are numbered in the order they are
+// first seen, which may differ from their registration order.  The table is
+// owned by the Context so that the names of discarded Contexts, for example in
+// tests or in a primary builder generating several products, are freed with
+// them.
+type variationTable struct {
+	lock sync.RWMutex
+
+	mutators     map[string]int
+	mutatorNames []string
+
+	// variations and variationNames are indexed by mutator number.
+	// variationNames[m][0] is unused.
+	variations     []map[string]uint64
+	variationNames [][]string
+}
+
+func newVariationTable() *variationTable {
+	return &variationTable{
+		mutators: make(map[string]int),
+	}
+}
+
+// newMap returns an empty variationMap that interns its names in t.
+func (t *variationTable) newMap() variationMap {
+	return variationMap{names: t}
+}
+
+// lookup returns the number of the mutator and the index of the variation, or
+// false if either one was never interned.
+func (t *variationTable) lookup(mutator, variation string) (int, uint64, bool) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	m, ok := t.mutators[mutator]
+	if !ok {
+		return 0, 0, false
+	}
+	v, ok := t.variations[m][variation]
+	return m, v, ok
+}
+
+// intern returns the number of the mutator and the index of the variation,
+// interning them if necessary.
+func (t *variationTable) intern(mutator, variation string) (int, uint64) {
+	if m, v, ok := t.lookup(mutator, variation); ok {
+		return m, v
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	m, ok := t.mutators[mutator]
+	if !ok {
+		m = len(t.mutatorNames)
+		t.mutators[mutator] = m
+		t.mutatorNames = append(t.mutatorNames, mutator)
+		t.variations = append(t.variations, make(map[string]uint64))
+		t.variationNames = append(t.variationNames, []string{""})
+	}
+
+	v, ok := t.variations[m][variation]
+	if !ok {
+		v = uint64(len(t.variationNames[m]))
+		if v > maxVariationsPerName {
+			panic(fmt.Errorf("mutator %q has more than %d variations", mutator, maxVariationsPerName))
+		}
+		t.variations[m][variation] = v
+		t.variationNames[m] = append(t.variationNames[m], variation)
+	}
+	return m, v
+}
+
+func (t *variationTable) names(m int, v uint64) (mutator, variation string) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.mutatorNames[m], t.variationNames[m][v]
+}
+
+// index returns the variation index of mutator number m.
+func (vm variationMap) index(m int) uint64 {
+	word := m / variationsPerWord
+	if word >= len(vm.packed) {
+		return 0
+	}
+	return vm.packed[word] >> (uint(m%variationsPerWord) * variationBits) & variationMask
+}
+
+// get returns the variation selected by the mutator, or "" if it didn't select
+// one.
+func (vm variationMap) get(mutator string) string {
+	variation, _ := vm.lookup(mutator)
+	return variation
+}
+
+// lookup returns the variation selected by the mutator, and whether it selected
+// one.
+func (vm variationMap) lookup(mutator string) (string, bool) {
+	if vm.names == nil {
+		return "", false
+	}
+
+	vm.names.lock.RLock()
+	m, ok := vm.names.mutators[mutator]
+	vm.names.lock.RUnlock()
+	if !ok {
+		return "", false
+	}
+
+	v := vm.index(m)
+	if v == 0 {
+		return "", false
+	}
+	_, variation := vm.names.names(m, v)
+	return variation, true
+}
+
+// is returns true if the mutator selected the variation.
+func (vm variationMap) is(mutator, variation string) bool {
+	if vm.names == nil {
+		return false
+	}
+	m, v, ok := vm.names.lookup(mutator, variation)
+	return ok && vm.index(m) == v
+}
+
+// set selects the variation for the mutator.
+func (vm *variationMap) set(mutator, variation string) {
+	if vm.names == nil {
+		panic("variationMap has no variationTable")
+	}
+	m, v := vm.names.intern(mutator, variation)
+	word := m / variationsPerWord
+	for len(vm.packed) <= word {
+		vm.packed = append(vm.packed, 0)
+	}
+	shift := uint(m%variationsPerWord) * variationBits
+	vm.packed[word] = vm.packed[word]&^(variationMask<<shift) | v<<shift
+}
+
+// each calls f for each mutator that selected a variation, in the order the
+// mutators were interned.
+func (vm variationMap) each(f func(mutator, variation string)) {
+	for m := 0; m < len(vm.packed)*variationsPerWord; m++ {
+		if v := vm.index(m); v != 0 {
+			f(vm.names.names(m, v))
+		}
+	}
+}
+
+func (vm variationMap) String() string {
+	var names []string
+	vm.each(func(mutator, variation string) {
+		names = append(names, mutator+":"+variation)
+	})
+	return strings.Join(names, ",")
+}
+
+func (vm variationMap) clone() variationMap {
+	return variationMap{vm.names, append([]uint64(nil), vm.packed...)}
+}
+
+// Compare this variationMap to another one.  Returns true if the every entry in this map
+// is either the same in the other map or doesn't exist in the other map.
+func (vm variationMap) subset(other variationMap) bool {
+	for i, a := range vm.packed {
+		var b uint64
+		if i < len(other.packed) {
+			b = other.packed[i]
+		}
+		if a == b || a == 0 || b == 0 {
+			continue
+		}
+		for shift := uint(0); shift < 64; shift += variationBits {
+			x, y := a>>shift&variationMask, b>>shift&variationMask
+			if x != 0 && y != 0 && x != y {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (vm variationMap) equal(other variationMap) bool {
+	a, b := vm.packed, other.packed
+	if len(a) < len(b) {
+		a, b = b, a
+	}
+	for i := range a {
+		var y uint64
+		if i < len(b) {
+			y = b[i]
+		}
+		if a[i] != y {
+			return false
+		}
+	}
+	return true
+}
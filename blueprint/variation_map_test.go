@@ -0,0 +1,171 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func newVariationMap(names *variationTable, m map[string]string) variationMap {
+	vm := names.newMap()
+	for mutator, variation := range m {
+		vm.set(mutator, variation)
+	}
+	return vm
+}
+
+func TestVariationMap(t *testing.T) {
+	names := newVariationTable()
+	a := newVariationMap(names, map[string]string{"arch": "arm64", "link": "shared", "image": ""})
+
+	if a.get("arch") != "arm64" || a.get("link") != "shared" {
+		t.Errorf("unexpected variations in %v", a)
+	}
+	if v, ok := a.lookup("image"); v != "" || !ok {
+		t.Errorf("expected the empty image variation, got %q, %v", v, ok)
+	}
+	if _, ok := a.lookup("unused"); ok {
+		t.Errorf("expected no unused variation")
+	}
+	if !a.is("arch", "arm64") || a.is("arch", "x86") || a.is("unused", "") {
+		t.Errorf("unexpected result from is")
+	}
+
+	got := make(map[string]string)
+	a.each(func(mutator, variation string) {
+		got[mutator] = variation
+	})
+	if expected := map[string]string{"arch": "arm64", "link": "shared", "image": ""}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected variations %q, got %q", expected, got)
+	}
+
+	b := a.clone()
+	b.set("link", "static")
+	if a.get("link") != "shared" {
+		t.Errorf("modifying a clone modified the original")
+	}
+	if a.equal(b) || !a.equal(a.clone()) {
+		t.Errorf("unexpected result from equal")
+	}
+	if a.subset(b) {
+		t.Errorf("expected %v not to be a subset of %v", a, b)
+	}
+
+	// Mutators interned after the ones in a are stored in later words, which a
+	// doesn't have.
+	c := names.newMap()
+	for _, m := range []string{"m1", "m2", "m3", "m4", "m5"} {
+		c.set(m, "x")
+	}
+	c.set("arch", "arm64")
+	if !a.subset(c) || !c.subset(a) {
+		t.Errorf("expected %v and %v to be subsets of each other", a, c)
+	}
+	if a.equal(c) || c.equal(a) {
+		t.Errorf("expected %v and %v not to be equal", a, c)
+	}
+
+	d := names.newMap()
+	d.set("m5", "x")
+	d.set("m5", "")
+	d.set("m5", "y")
+	if d.get("m5") != "y" {
+		t.Errorf("expected the last variation set, got %q", d.get("m5"))
+	}
+}
+
+func TestVariationMapZeroValue(t *testing.T) {
+	var vm variationMap
+	if _, ok := vm.lookup("arch"); ok || vm.is("arch", "") || vm.String() != "" {
+		t.Errorf("expected the zero variationMap to be empty")
+	}
+	if !vm.equal(newVariationTable().newMap()) {
+		t.Errorf("expected the zero variationMap to equal an empty map")
+	}
+}
+
+func TestVariationTablePerContext(t *testing.T) {
+	ctx1 := NewContext()
+	ctx2 := NewContext()
+	if ctx1.variationNames == ctx2.variationNames {
+		t.Fatalf("expected each Context to have its own variationTable")
+	}
+
+	a := ctx1.variationNames.newMap()
+	a.set("ctx1_mutator", "a")
+	b := ctx2.variationNames.newMap()
+	b.set("ctx2_mutator", "b")
+
+	// Each table numbers its mutators from 0, and doesn't see the names
+	// interned by the other Context.
+	if a.packed[0] != b.packed[0] {
+		t.Errorf("expected the first mutator of each table to get the same number")
+	}
+	if _, _, ok := ctx2.variationNames.lookup("ctx1_mutator", "a"); ok {
+		t.Errorf("expected ctx1_mutator not to be interned in the table of ctx2")
+	}
+	if a.get("ctx1_mutator") != "a" || b.get("ctx2_mutator") != "b" || b.get("ctx1_mutator") != "" {
+		t.Errorf("unexpected variations %v and %v", a, b)
+	}
+}
+
+func BenchmarkVariationMap(b *testing.B) {
+	names := newVariationTable()
+	mutators := make([]string, 24)
+	for i := range mutators {
+		mutators[i] = fmt.Sprintf("mutator%d", i)
+	}
+	base := names.newMap()
+	for _, m := range mutators {
+		base.set(m, "variation")
+	}
+
+	b.Run("set", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			vm := base.clone()
+			vm.set(mutators[i%len(mutators)], "other")
+		}
+	})
+
+	b.Run("equal", func(b *testing.B) {
+		other := base.clone()
+		for i := 0; i < b.N; i++ {
+			if !base.equal(other) {
+				b.Fatal("expected equal maps")
+			}
+		}
+	})
+
+	b.Run("subset", func(b *testing.B) {
+		other := names.newMap()
+		other.set(mutators[len(mutators)-1], "variation")
+		for i := 0; i < b.N; i++ {
+			if !other.subset(base) {
+				b.Fatal("expected a subset")
+			}
+		}
+	})
+
+	b.Run("get", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if base.get(mutators[i%len(mutators)]) != "variation" {
+				b.Fatal("unexpected variation")
+			}
+		}
+	})
+}
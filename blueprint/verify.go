@@ -0,0 +1,90 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// A VerifyStep describes a check that is run on every module output in the
+// build graph that matches a predicate, for example checking that every ELF
+// file passes a linter.
+type VerifyStep struct {
+	// Name is the name of the phony Ninja target that depends on every check.
+	Name string
+
+	// PackageContext is the context that Rule and StampDir are evaluated in.
+	PackageContext PackageContext
+
+	// Rule is run once for each matching output, with $in set to the output
+	// and $out set to a stamp file that the rule must create on success.
+	Rule Rule
+
+	// StampDir is the directory the stamp files are written to.  Each stamp
+	// file mirrors the path of the output it verifies, which must not have
+	// ".." components that leave StampDir.
+	StampDir string
+
+	// Match selects the module outputs to verify.
+	Match func(module Module, output string) bool
+}
+
+// NewVerifySingleton returns a SingletonFactory for a singleton that adds the
+// build statements for a VerifyStep.  The phony target is only added if at
+// least one output matched.
+func NewVerifySingleton(step VerifyStep) SingletonFactory {
+	return func() Singleton {
+		return &verifySingleton{step}
+	}
+}
+
+type verifySingleton struct {
+	step VerifyStep
+}
+
+func (v *verifySingleton) GenerateBuildActions(ctx SingletonContext) {
+	var stamps []string
+
+	ctx.VisitAllModuleOutputsIf(v.step.Match, func(module Module, output string) {
+		rel := strings.TrimPrefix(filepath.Clean(output), "/")
+		if rel == ".." || strings.HasPrefix(rel, "../") {
+			ctx.ModuleErrorf(module, "output %q of verify step %q would have a stamp file outside of %q",
+				output, v.step.Name, v.step.StampDir)
+			return
+		}
+		stamp := filepath.Join(v.step.StampDir, rel) + ".verified"
+
+		ctx.Build(v.step.PackageContext, BuildParams{
+			Rule:     v.step.Rule,
+			Outputs:  []string{stamp},
+			Inputs:   []string{output},
+			Optional: true,
+		})
+
+		stamps = append(stamps, stamp)
+	})
+
+	if len(stamps) == 0 {
+		return
+	}
+
+	ctx.Build(v.step.PackageContext, BuildParams{
+		Rule:      Phony,
+		Outputs:   []string{v.step.Name},
+		Implicits: stamps,
+		Optional:  true,
+	})
+}
@@ -0,0 +1,156 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blueprint
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+var (
+	verifyTestPctx = NewPackageContext("github.com/google/blueprint/verifytest")
+
+	_ = verifyTestPctx.StaticVariable("outDir", "out")
+
+	verifyTestTouch = verifyTestPctx.StaticRule("touch",
+		RuleParams{
+			Command: "touch $out",
+		})
+
+	verifyTestCheck = verifyTestPctx.StaticRule("check",
+		RuleParams{
+			Command: "check $in && touch $out",
+		})
+)
+
+type outputsModule struct {
+	SimpleName
+	properties struct {
+		Outs []string
+	}
+}
+
+func newOutputsModule() (Module, []interface{}) {
+	m := &outputsModule{}
+	return m, []interface{}{&m.properties, &m.SimpleName.Properties}
+}
+
+func (m *outputsModule) GenerateBuildActions(ctx ModuleContext) {
+	for _, out := range m.properties.Outs {
+		ctx.Build(verifyTestPctx, BuildParams{
+			Rule:    verifyTestTouch,
+			Outputs: []string{"${outDir}/" + out},
+		})
+	}
+}
+
+func TestVerifySingleton(t *testing.T) {
+	ctx := NewContext()
+	ctx.RegisterModuleType("outputs_module", newOutputsModule)
+	ctx.RegisterSingletonType("verify_elf", NewVerifySingleton(VerifyStep{
+		Name:           "verify_elf",
+		PackageContext: verifyTestPctx,
+		Rule:           verifyTestCheck,
+		StampDir:       "${outDir}/verify",
+		Match: func(module Module, output string) bool {
+			return strings.HasSuffix(output, ".elf")
+		},
+	}))
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			outputs_module {
+			    name: "A",
+			    outs: ["a.elf", "a.txt"],
+			}
+
+			outputs_module {
+			    name: "B",
+			    outs: ["b.elf"],
+			}
+		`),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) == 0 {
+		_, errs = ctx.PrepareBuildActions(nil)
+	}
+	if len(errs) > 0 {
+		t.Errorf("unexpected errors:")
+		for _, err := range errs {
+			t.Errorf("  %s", err)
+		}
+		t.FailNow()
+	}
+
+	buf := &bytes.Buffer{}
+	if err := ctx.WriteBuildFile(buf); err != nil {
+		t.Fatalf("unexpected error writing build file: %s", err)
+	}
+	out := buf.String()
+
+	expected := []string{
+		"build ${g.verifytest.outDir}/verify/out/a.elf.verified: g.verifytest.check $\n        out/a.elf\n",
+		"build ${g.verifytest.outDir}/verify/out/b.elf.verified: g.verifytest.check $\n        out/b.elf\n",
+		"build verify_elf: phony | ${g.verifytest.outDir}/verify/out/a.elf.verified $\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(out, e) {
+			t.Errorf("missing %q in build file:\n%s", e, out)
+		}
+	}
+
+	if strings.Contains(out, "a.txt.verified") {
+		t.Errorf("unexpected verify step for a.txt in build file:\n%s", out)
+	}
+
+	// The verify steps only run when the phony target is requested.
+	if strings.Contains(out, "default verify_elf") {
+		t.Errorf("unexpected default verify_elf in build file:\n%s", out)
+	}
+}
+
+func TestVerifySingletonOutsideStampDir(t *testing.T) {
+	ctx := NewContext()
+	ctx.RegisterModuleType("outputs_module", newOutputsModule)
+	ctx.RegisterSingletonType("verify_elf", NewVerifySingleton(VerifyStep{
+		Name:           "verify_elf",
+		PackageContext: verifyTestPctx,
+		Rule:           verifyTestCheck,
+		StampDir:       "${outDir}/verify",
+		Match: func(module Module, output string) bool {
+			return strings.HasSuffix(output, ".elf")
+		},
+	}))
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			outputs_module {
+			    name: "A",
+			    outs: ["../../a.elf", "../b.elf"],
+			}
+		`),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	if len(errs) == 0 {
+		_, errs = ctx.PrepareBuildActions(nil)
+	}
+
+	// out/../b.elf is b.elf, whose stamp file stays in the stamp directory.
+	expected := `Blueprints:2:4: output "out/../../a.elf" of verify step "verify_elf" would have a stamp file outside of "${outDir}/verify"`
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Errorf("expected error %q, got %q", expected, errs)
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"strings"
 
 	"github.com/google/blueprint"
+	"github.com/google/blueprint/bootstrap"
 	"github.com/google/blueprint/pathtools"
 )
 
@@ -284,11 +285,13 @@ type ModuleBase struct {
 	installFiles       Paths
 	checkbuildFiles    Paths
 
-	// Used by buildTargetSingleton to create checkbuild and per-directory build targets
+	// Used by buildTargetSingleton to create install, checkbuild and per-directory build targets
 	// Only set on the final variant of each module
-	installTarget    string
-	checkbuildTarget string
-	blueprintDir     string
+	installTarget     string
+	checkbuildTarget  string
+	blueprintDir      string
+	allInstalledFiles Paths
+	allRequired       []string
 
 	hooks hooks
 
@@ -428,24 +431,28 @@ func (p *ModuleBase) InstallInSanitizerDir() bool {
 func (a *ModuleBase) generateModuleTarget(ctx blueprint.ModuleContext) {
 	allInstalledFiles := Paths{}
 	allCheckbuildFiles := Paths{}
+	allRequired := []string{}
 	ctx.VisitAllModuleVariants(func(module blueprint.Module) {
 		a := module.(Module).base()
 		allInstalledFiles = append(allInstalledFiles, a.installFiles...)
 		allCheckbuildFiles = append(allCheckbuildFiles, a.checkbuildFiles...)
+		for _, r := range a.commonProperties.Required {
+			if !inList(r, allRequired) {
+				allRequired = append(allRequired, r)
+			}
+		}
 	})
 
 	deps := []string{}
 
-	if len(allInstalledFiles) > 0 {
+	// The install target is written by buildTargetSingleton, which adds the installed files of
+	// the required modules to it.
+	if len(allInstalledFiles) > 0 || len(allRequired) > 0 {
 		name := ctx.ModuleName() + "-install"
-		ctx.Build(pctx, blueprint.BuildParams{
-			Rule:      blueprint.Phony,
-			Outputs:   []string{name},
-			Implicits: allInstalledFiles.Strings(),
-			Optional:  ctx.Config().(Config).EmbeddedInMake(),
-		})
 		deps = append(deps, name)
 		a.installTarget = name
+		a.allInstalledFiles = allInstalledFiles
+		a.allRequired = allRequired
 	}
 
 	if len(allCheckbuildFiles) > 0 {
@@ -890,6 +897,19 @@ func (ctx *androidModuleContext) RequiredModuleNames() []string {
 	return ctx.module.base().commonProperties.Required
 }
 
+var _ bootstrap.ModuleGraphEdgesProvider = (*ModuleBase)(nil)
+
+// ModuleGraphEdges adds the modules listed in required to the module graph
+// written by the primary builder, since they are installed with the module
+// without being dependencies.
+func (a *ModuleBase) ModuleGraphEdges() []bootstrap.ModuleGraphEdge {
+	var edges []bootstrap.ModuleGraphEdge
+	for _, r := range a.commonProperties.Required {
+		edges = append(edges, bootstrap.ModuleGraphEdge{Name: r, Kind: "required"})
+	}
+	return edges
+}
+
 func (ctx *androidModuleContext) Glob(globPattern string, excludes []string) Paths {
 	ret, err := ctx.GlobWithDeps(globPattern, excludes)
 	if err != nil {
@@ -922,12 +942,24 @@ func (c *buildTargetSingleton) GenerateBuildActions(ctx blueprint.SingletonConte
 
 	modulesInDir := make(map[string][]string)
 
+	// The final variant of each module that has an install target, by module name
+	installModules := make(map[string]*ModuleBase)
+	var installModuleNames []string
+	moduleNames := make(map[string]bool)
+
 	ctx.VisitAllModules(func(module blueprint.Module) {
+		moduleNames[ctx.ModuleName(module)] = true
 		if a, ok := module.(Module); ok {
 			blueprintDir := a.base().blueprintDir
 			installTarget := a.base().installTarget
 			checkbuildTarget := a.base().checkbuildTarget
 
+			if installTarget != "" {
+				name := ctx.ModuleName(module)
+				installModules[name] = a.base()
+				installModuleNames = append(installModuleNames, name)
+			}
+
 			if checkbuildTarget != "" {
 				checkbuildDeps = append(checkbuildDeps, checkbuildTarget)
 				modulesInDir[blueprintDir] = append(modulesInDir[blueprintDir], checkbuildTarget)
@@ -939,8 +971,49 @@ func (c *buildTargetSingleton) GenerateBuildActions(ctx blueprint.SingletonConte
 		}
 	})
 
+	embeddedInMake := ctx.Config().(Config).EmbeddedInMake()
+
+	// Create a <module>-install target for each module that installs files or requires other
+	// modules, that depends on the files installed by the module and by the modules it
+	// requires, transitively.  The installed files are used instead of the install targets of
+	// the required modules so that modules can require each other.
+	// Each undefined required module is only reported once, by the first module
+	// that requires it, even though it is visited from every module that
+	// requires it directly or transitively.
+	reportedMissing := make(map[string]bool)
+	for _, name := range installModuleNames {
+		a := installModules[name]
+		var installed Paths
+		visited := map[string]bool{name: true}
+		var visit func(a *ModuleBase)
+		visit = func(a *ModuleBase) {
+			installed = append(installed, a.allInstalledFiles...)
+			for _, r := range a.allRequired {
+				if visited[r] {
+					continue
+				}
+				visited[r] = true
+				if required, ok := installModules[r]; ok {
+					visit(required)
+				} else if !moduleNames[r] && !embeddedInMake && !reportedMissing[r] {
+					// When embedded in Make the required module may be defined by Make.
+					reportedMissing[r] = true
+					ctx.ModuleErrorf(a.module, "required module %q is not defined", r)
+				}
+			}
+		}
+		visit(a)
+
+		ctx.Build(pctx, blueprint.BuildParams{
+			Rule:      blueprint.Phony,
+			Outputs:   []string{a.installTarget},
+			Implicits: installed.Strings(),
+			Optional:  embeddedInMake,
+		})
+	}
+
 	suffix := ""
-	if ctx.Config().(Config).EmbeddedInMake() {
+	if embeddedInMake {
 		suffix = "-soong"
 	}
 
@@ -0,0 +1,88 @@
+// Copyright 2016 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package android
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/blueprint/bootstrap"
+)
+
+func TestRequiredModuleErrors(t *testing.T) {
+	buildDir, err := ioutil.TempDir("", "soong_module_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(buildDir)
+
+	config := TestConfig(buildDir)
+
+	ctx := NewTestContext()
+	ctx.RegisterModuleType("source", ModuleFactoryAdaptor(newSourceModule))
+	ctx.RegisterSingletonType("buildtarget", BuildTargetSingleton)
+	ctx.Register()
+	ctx.MockFileSystem(map[string][]byte{
+		"Blueprints": []byte(`
+			source {
+				name: "a",
+				required: ["missing"],
+			}
+
+			source {
+				name: "b",
+				required: ["a", "missing", "also_missing"],
+			}
+
+			source {
+				name: "c",
+				required: ["b"],
+			}
+		`),
+	})
+
+	_, errs := ctx.ParseBlueprintsFiles("Blueprints")
+	fail(t, errs)
+	_, errs = ctx.PrepareBuildActions(config)
+
+	// "missing" is visited from a, b and c but only reported once.
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	if len(errs) != 2 ||
+		!strings.Contains(messages[0], `Blueprints:2:4: required module "missing" is not defined`) ||
+		!strings.Contains(messages[1], `Blueprints:7:4: required module "also_missing" is not defined`) {
+		t.Errorf("expected one error for each undefined required module, got:\n%s",
+			strings.Join(messages, "\n"))
+	}
+}
+
+func TestModuleGraphEdges(t *testing.T) {
+	m := newSourceModule().(*sourceModule)
+	m.base().commonProperties.Required = []string{"a", "b"}
+
+	expected := []bootstrap.ModuleGraphEdge{
+		{Name: "a", Kind: "required"},
+		{Name: "b", Kind: "required"},
+	}
+	if edges := m.ModuleGraphEdges(); !reflect.DeepEqual(edges, expected) {
+		t.Errorf("expected edges %v, got %v", expected, edges)
+	}
+}
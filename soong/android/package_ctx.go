@@ -16,6 +16,7 @@ package android
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/google/blueprint"
 	"github.com/google/blueprint/pathtools"
@@ -150,9 +151,13 @@ func (p AndroidPackageContext) AndroidStaticRule(name string, params blueprint.R
 	}, argNames...)
 }
 
-// AndroidGomaStaticRule wraps blueprint.StaticRule but uses goma's parallelism if goma is enabled
+// AndroidGomaStaticRule wraps blueprint.StaticRule but uses goma's parallelism if goma is enabled,
+// unless the rule must run locally or uncached
 func (p AndroidPackageContext) AndroidGomaStaticRule(name string, params blueprint.RuleParams,
 	argNames ...string) blueprint.Rule {
+	if params.Local || params.NoCache {
+		return p.AndroidStaticRule(name, params, argNames...)
+	}
 	return p.StaticRule(name, params, argNames...)
 }
 
@@ -165,6 +170,25 @@ func (p AndroidPackageContext) AndroidRuleFunc(name string,
 			// local parallelism value
 			params.Pool = localPool
 		}
+		params.Command = localCommand(params)
 		return params, err
 	}, argNames...)
 }
+
+// localCommand returns the command of a rule with the environment variables that stop the
+// CC_WRAPPER and JAVAC_WRAPPER tools from running it remotely if it is marked Local, or from
+// caching its outputs if it is marked NoCache.  Goma caches the outputs of the commands it runs
+// remotely, so NoCache rules run locally too.
+func localCommand(params blueprint.RuleParams) string {
+	var env []string
+	if params.Local || params.NoCache {
+		env = append(env, "GOMA_DISABLED=true")
+	}
+	if params.NoCache {
+		env = append(env, "CCACHE_DISABLE=1")
+	}
+	if len(env) == 0 {
+		return params.Command
+	}
+	return "export " + strings.Join(env, " ") + "; " + params.Command
+}
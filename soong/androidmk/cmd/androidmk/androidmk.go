@@ -2,9 +2,11 @@ package main
 
 import (
 	"bytes"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"text/scanner"
 
@@ -48,10 +50,14 @@ func (f *bpFile) insertExtraComment(s string) {
 	f.bpPos.Line++
 }
 
+// translationErrorPrefix starts the comments that replace the constructs that
+// could not be translated.
+const translationErrorPrefix = "ANDROIDMK TRANSLATION ERROR"
+
 func (f *bpFile) errorf(node mkparser.Node, s string, args ...interface{}) {
 	orig := node.Dump()
 	s = fmt.Sprintf(s, args...)
-	f.insertExtraComment(fmt.Sprintf("// ANDROIDMK TRANSLATION ERROR: %s", s))
+	f.insertExtraComment(fmt.Sprintf("// %s: %s", translationErrorPrefix, s))
 
 	lines := strings.Split(orig, "\n")
 	for _, l := range lines {
@@ -72,22 +78,76 @@ type conditional struct {
 	eq   bool
 }
 
+var (
+	write = flag.Bool("w", false, "write the Android.bp file next to each Android.mk file instead of printing it")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: androidmk [-w] Android.mk...\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
 func main() {
-	b, err := ioutil.ReadFile(os.Args[1])
-	if err != nil {
-		fmt.Println(err.Error())
-		return
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 || (flag.NArg() > 1 && !*write) {
+		usage()
 	}
 
-	output, errs := convertFile(os.Args[1], bytes.NewBuffer(b))
-	if len(errs) > 0 {
-		for _, err := range errs {
-			fmt.Fprintln(os.Stderr, "ERROR: ", err)
+	failed := false
+	for _, filename := range flag.Args() {
+		errs := processFile(filename)
+		if len(errs) > 0 {
+			for _, err := range errs {
+				fmt.Fprintln(os.Stderr, "ERROR: ", err)
+			}
+			failed = true
 		}
+	}
+
+	if failed {
 		os.Exit(1)
 	}
+}
+
+// processFile converts an Android.mk file, and prints the result or writes it to
+// the Android.bp file in the same directory.  The constructs that could not be
+// translated are left as comments in the result, and are counted on stderr so
+// that they can be fixed by hand.
+func processFile(filename string) []error {
+	bpFile := filepath.Join(filepath.Dir(filename), "Android.bp")
+	if *write {
+		if _, err := os.Stat(bpFile); err == nil {
+			return []error{fmt.Errorf("%s already exists", bpFile)}
+		}
+	}
+
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return []error{err}
+	}
+
+	output, errs := convertFile(filename, bytes.NewBuffer(b))
+	if len(errs) > 0 {
+		return errs
+	}
+
+	if n := strings.Count(output, translationErrorPrefix); n > 0 {
+		fmt.Fprintf(os.Stderr, "%s: %d constructs could not be translated, see the %q comments\n",
+			filename, n, translationErrorPrefix)
+	}
 
-	fmt.Print(output)
+	if !*write {
+		fmt.Print(output)
+		return nil
+	}
+
+	if err := ioutil.WriteFile(bpFile, []byte(output), 0666); err != nil {
+		return []error{err}
+	}
+	return nil
 }
 
 func convertFile(filename string, buffer *bytes.Buffer) (string, []error) {
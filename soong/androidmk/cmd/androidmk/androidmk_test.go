@@ -372,6 +372,24 @@ include $(BUILD_SHARED_LIBRARY)
 cc_library_shared {
 	tags: ["debug"],
 }
+`,
+	},
+	{
+		desc: "Untranslated include",
+		in: `
+include $(CLEAR_VARS)
+LOCAL_MODULE := foo
+include $(LOCAL_PATH)/extra.mk
+include $(BUILD_SHARED_LIBRARY)
+`,
+
+		expected: `
+cc_library_shared {
+	name: "foo",
+	// ANDROIDMK TRANSLATION ERROR: unsupported include
+	// include $(LOCAL_PATH)/extra.mk
+
+}
 `,
 	},
 }
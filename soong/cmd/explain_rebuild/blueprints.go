@@ -0,0 +1,117 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/blueprint/parser"
+)
+
+// blueprintsFiles parses the Blueprints files that define modules on demand,
+// to find the properties that set values used in commands.
+type blueprintsFiles struct {
+	files map[string]*parser.File
+}
+
+func newBlueprintsFiles() *blueprintsFiles {
+	return &blueprintsFiles{files: make(map[string]*parser.File)}
+}
+
+// file returns the parsed Blueprints file, or nil if it can't be parsed.
+func (b *blueprintsFiles) file(filename string) *parser.File {
+	if file, ok := b.files[filename]; ok {
+		return file
+	}
+
+	var file *parser.File
+	if f, err := os.Open(filename); err == nil {
+		var errs []error
+		file, errs = parser.ParseAndEval(filename, f, parser.NewScope(nil))
+		f.Close()
+		if len(errs) > 0 {
+			file = nil
+		}
+	}
+	b.files[filename] = file
+	return file
+}
+
+// module returns the definition of the module of o.
+func (b *blueprintsFiles) module(o *owner) *parser.Module {
+	if o == nil || o.Module == "" {
+		return nil
+	}
+	file := b.file(o.definedFile())
+	if file == nil {
+		return nil
+	}
+
+	// Defined is file:line:col
+	pos := strings.TrimPrefix(o.Defined, o.definedFile()+":")
+	line, err := strconv.Atoi(strings.SplitN(pos, ":", 2)[0])
+	if err != nil {
+		return nil
+	}
+
+	for _, def := range file.Defs {
+		if module, ok := def.(*parser.Module); ok && module.TypePos.Line == line {
+			return module
+		}
+	}
+	return nil
+}
+
+// propertiesSetting returns the properties of the module of o whose values,
+// or values in their lists, are token or a suffix of token, like "-DFOO" in
+// cflags or "include" in "-Iinclude".
+func (b *blueprintsFiles) propertiesSetting(o *owner, token string) []string {
+	module := b.module(o)
+	if module == nil {
+		return nil
+	}
+
+	var ret []string
+	var walk func(prefix string, properties []*parser.Property)
+	walk = func(prefix string, properties []*parser.Property) {
+		for _, p := range properties {
+			name := prefix + p.Name
+			matches := func(s *parser.String) bool {
+				return s.Value != "" && strings.HasSuffix(token, s.Value)
+			}
+			found := false
+			switch v := p.Value.Eval().(type) {
+			case *parser.String:
+				found = matches(v)
+			case *parser.List:
+				for _, value := range v.Values {
+					if s, ok := value.Eval().(*parser.String); ok && matches(s) {
+						found = true
+					}
+				}
+			case *parser.Map:
+				walk(name+".", v.Properties)
+			}
+			if found {
+				ret = append(ret, fmt.Sprintf("property %s at %s", name, p.NamePos))
+			}
+		}
+	}
+	walk("", module.Properties)
+	return ret
+}
@@ -0,0 +1,360 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// An explanation describes why the outputs of a build statement are rebuilt.
+// It is up to date if there are no reasons.
+type explanation struct {
+	edge    *edge
+	reasons []*reason
+}
+
+func (x *explanation) dirty() bool { return len(x.reasons) > 0 }
+
+type reason struct {
+	text    string
+	details []string
+
+	// cause is the explanation of input, an input that is rebuilt
+	input string
+	cause *explanation
+}
+
+// An explainer finds why outputs are rebuilt with a simplified version of the
+// checks ninja does, using the .ninja_log and .ninja_deps of the last build,
+// and attributes the changes to the modules that generated the build
+// statements.
+type explainer struct {
+	manifest *manifest
+	log      map[string]logEntry
+	deps     map[string][]string
+
+	// previous is the ninja file of the last build, if known, used to find
+	// the variables that changed in commands.
+	previous *manifest
+
+	// stat returns the modification time of a file in nanoseconds, and false
+	// if it doesn't exist.
+	stat func(path string) (int64, bool)
+
+	explanations map[*edge]*explanation
+	blueprints   *blueprintsFiles
+	moduleDirs   map[string][]*owner
+}
+
+func newExplainer(m *manifest, log map[string]logEntry, deps map[string][]string) *explainer {
+	x := &explainer{
+		manifest:     m,
+		log:          log,
+		deps:         deps,
+		stat:         statMtime,
+		explanations: make(map[*edge]*explanation),
+		blueprints:   newBlueprintsFiles(),
+		moduleDirs:   make(map[string][]*owner),
+	}
+
+	seen := make(map[*owner]bool)
+	for _, e := range m.edges {
+		if o := e.owner; o != nil && !seen[o] && o.definedFile() != "" {
+			seen[o] = true
+			dir := filepath.Dir(o.definedFile())
+			x.moduleDirs[dir] = append(x.moduleDirs[dir], o)
+		}
+	}
+
+	return x
+}
+
+func statMtime(path string) (int64, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, false
+	}
+	return info.ModTime().UnixNano(), true
+}
+
+// explain returns the explanation of the build statement that produces
+// output.
+func (x *explainer) explain(output string) (*explanation, error) {
+	e, ok := x.manifest.producers[filepath.Clean(output)]
+	if !ok {
+		return nil, fmt.Errorf("unknown target %q", output)
+	}
+	return x.explainEdge(e), nil
+}
+
+func (x *explainer) explainEdge(e *edge) *explanation {
+	if ex, ok := x.explanations[e]; ok {
+		return ex
+	}
+	ex := &explanation{edge: e}
+	x.explanations[e] = ex
+
+	addReason := func(details []string, format string, args ...interface{}) *reason {
+		r := &reason{text: fmt.Sprintf(format, args...), details: details}
+		ex.reasons = append(ex.reasons, r)
+		return r
+	}
+
+	m := x.manifest
+	phony := e.rule == phonyRule
+	inputs := e.inputs()
+
+	// The oldest output is compared with the inputs.
+	outputMtime := int64(-1)
+	for _, out := range e.outs {
+		if mtime, ok := x.stat(out); ok {
+			if outputMtime < 0 || mtime < outputMtime {
+				outputMtime = mtime
+			}
+		} else if !phony || len(inputs) == 0 {
+			addReason(nil, "output %s doesn't exist", out)
+		}
+	}
+
+	var entry logEntry
+	hasEntry := false
+	if !phony {
+		generator := m.ruleBool(e, "generator")
+		entry, hasEntry = x.log[e.outs[0]]
+		if !hasEntry {
+			if !generator {
+				addReason(nil, "there is no command for %s in the .ninja_log", e.outs[0])
+			}
+		} else if command, err := m.command(e); err != nil {
+			addReason(nil, "error evaluating the command: %s", err)
+		} else if !generator && hashCommand(command) != entry.commandHash {
+			addReason(x.commandChanges(e), "the command changed")
+		}
+
+		if hasEntry && m.ruleBool(e, "restat") {
+			outputMtime = entry.mtime
+		}
+		hasEntry = hasEntry && !generator
+
+		if m.ruleBool(e, "deps") {
+			if deps, ok := x.deps[e.outs[0]]; ok {
+				inputs = append(inputs[:len(inputs):len(inputs)], deps...)
+			} else {
+				addReason(nil, "there are no dependencies of %s in the .ninja_deps", e.outs[0])
+			}
+		}
+	}
+
+	newestInput, newestMtime := "", int64(-1)
+	newer := false
+	for _, in := range inputs {
+		if p, ok := m.producers[in]; ok {
+			if cause := x.explainEdge(p); cause.dirty() {
+				r := addReason(nil, "input %s is rebuilt", in)
+				r.input, r.cause = in, cause
+				continue
+			}
+		}
+
+		mtime, ok := x.mtime(in)
+		if !ok {
+			addReason(nil, "input %s doesn't exist", in)
+			continue
+		}
+		if mtime > newestMtime {
+			newestInput, newestMtime = in, mtime
+		}
+		if !phony && outputMtime >= 0 && mtime > outputMtime {
+			newer = true
+			addReason(x.inputOwner(in, e), "input %s is newer than the output", in)
+		}
+	}
+
+	if hasEntry && !newer && newestMtime > entry.mtime {
+		addReason(x.inputOwner(newestInput, e),
+			"the mtime of %s in the .ninja_log is older than input %s", e.outs[0], newestInput)
+	}
+
+	return ex
+}
+
+// mtime returns the modification time of a path, which for the outputs of
+// phony build statements that don't exist is the newest of their inputs.
+func (x *explainer) mtime(path string) (int64, bool) {
+	if mtime, ok := x.stat(path); ok {
+		return mtime, true
+	}
+	e, ok := x.manifest.producers[path]
+	if !ok || e.rule != phonyRule || len(e.inputs()) == 0 {
+		return 0, false
+	}
+	newest := int64(-1)
+	for _, in := range e.inputs() {
+		if mtime, ok := x.mtime(in); ok && mtime > newest {
+			newest = mtime
+		}
+	}
+	return newest, newest >= 0
+}
+
+// ruleBool returns true if the variable is set to a non-empty value for the
+// build statement, like ninja's boolean rule variables.
+func (m *manifest) ruleBool(e *edge, name string) bool {
+	value, err := m.lookup(e, name, 0)
+	return err == nil && value != ""
+}
+
+// inputOwner describes the module that owns a source file, which is the
+// module in the closest directory to the file, preferring the module of the
+// build statement.
+func (x *explainer) inputOwner(input string, e *edge) []string {
+	if e.owner != nil && e.owner.definedFile() != "" {
+		if dir := filepath.Dir(e.owner.definedFile()); isInDir(input, dir) {
+			return []string{fmt.Sprintf("%s is in the directory of %s defined at %s",
+				input, e.owner, e.owner.Defined)}
+		}
+	}
+
+	for dir := filepath.Dir(input); ; dir = filepath.Dir(dir) {
+		if owners, ok := x.moduleDirs[dir]; ok {
+			var details []string
+			for _, o := range owners {
+				details = append(details, fmt.Sprintf("%s is in the directory of %s defined at %s",
+					input, o, o.Defined))
+			}
+			return details
+		}
+		if dir == "." || dir == "/" {
+			return nil
+		}
+	}
+}
+
+func isInDir(path, dir string) bool {
+	return dir == "." || strings.HasPrefix(path, dir+"/")
+}
+
+// commandChanges compares the variables used by the command of the build
+// statement with the previous ninja file, and finds the properties of the
+// module that set the new values.
+func (x *explainer) commandChanges(e *edge) []string {
+	if x.previous == nil {
+		return nil
+	}
+
+	prev, ok := x.previous.producers[e.outs[0]]
+	if !ok {
+		return []string{fmt.Sprintf("%s is not built by the previous ninja file", e.outs[0])}
+	}
+	if prev.rule.name != e.rule.name {
+		return []string{fmt.Sprintf("the rule changed from %s to %s", prev.rule.name, e.rule.name)}
+	}
+
+	var details []string
+	if prev.rule.vars["command"] != e.rule.vars["command"] {
+		details = append(details, fmt.Sprintf("the command of rule %s changed", e.rule.name))
+	}
+
+	for _, name := range x.manifest.commandVars(e) {
+		value, err := x.manifest.lookup(e, name, 0)
+		if err != nil {
+			continue
+		}
+		prevValue, err := x.previous.lookup(prev, name, 0)
+		if err != nil || value == prevValue {
+			continue
+		}
+		details = append(details, fmt.Sprintf("$%s changed from %q to %q", name, prevValue, value))
+
+		prevTokens := make(map[string]bool)
+		for _, token := range strings.Fields(prevValue) {
+			prevTokens[token] = true
+		}
+		for _, token := range strings.Fields(value) {
+			if prevTokens[token] {
+				continue
+			}
+			for _, p := range x.blueprints.propertiesSetting(e.owner, token) {
+				details = append(details, fmt.Sprintf("    %s is set by %s", token, p))
+			}
+		}
+	}
+
+	return details
+}
+
+// commandVars returns the variables referenced by the command of the build
+// statement, directly or through the variables of the rule.
+func (m *manifest) commandVars(e *edge) []string {
+	var names []string
+	seen := make(map[string]bool)
+	var walk func(s string)
+	walk = func(s string) {
+		for _, name := range referencedVars(s) {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			names = append(names, name)
+			if _, isBuildVar := e.vars[name]; !isBuildVar {
+				if value, ok := e.rule.vars[name]; ok {
+					walk(value)
+				}
+			}
+		}
+	}
+	walk(e.rule.vars["command"])
+	walk(e.rule.vars["rspfile_content"])
+	return names
+}
+
+// write writes the explanation of why the output is rebuilt, with the
+// explanations of the inputs that are rebuilt indented below.  Explanations
+// that were already written are referred to.
+func (ex *explanation) write(w io.Writer, output string, indent string, written map[*explanation]bool) {
+	e := ex.edge
+	fmt.Fprintf(w, "%s%s: rule %s", indent, output, e.rule.name)
+	if e.owner != nil {
+		fmt.Fprintf(w, " of %s", e.owner)
+	}
+	if e.owner != nil && e.owner.Type != "" {
+		fmt.Fprintf(w, ", %s defined at %s", e.owner.Type, e.owner.Defined)
+	}
+	fmt.Fprintln(w)
+
+	if !ex.dirty() {
+		fmt.Fprintf(w, "%s    is up to date\n", indent)
+		return
+	}
+	if written[ex] {
+		fmt.Fprintf(w, "%s    is rebuilt, see above\n", indent)
+		return
+	}
+	written[ex] = true
+
+	for _, r := range ex.reasons {
+		fmt.Fprintf(w, "%s    %s\n", indent, r.text)
+		for _, d := range r.details {
+			fmt.Fprintf(w, "%s        %s\n", indent, d)
+		}
+		if r.cause != nil {
+			r.cause.write(w, r.input, indent+"        ", written)
+		}
+	}
+}
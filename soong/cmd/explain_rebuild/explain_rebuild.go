@@ -0,0 +1,124 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// explain_rebuild explains why ninja rebuilds outputs.  For each output it
+// finds the inputs that changed, or that the command changed, using the
+// .ninja_log and .ninja_deps of the last build, and attributes them to the
+// modules and Blueprints files that generated the build statements.  With
+// the ninja file of the last build, it also reports the variables of the
+// command that changed, and the module properties that set their new values.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+var (
+	ninjaFile     = flag.String("ninja", "", "ninja file of the build")
+	previousNinja = flag.String("previous", "", "ninja file of the last build, to find the variables that changed in commands")
+	buildDir      = flag.String("build_dir", "", "directory of the .ninja_log and .ninja_deps files, defaults to the builddir of the ninja file")
+	chdir         = flag.String("C", "", "directory to change to before doing anything else, like ninja's -C")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: explain_rebuild -ninja <ninja file> [flags] <output>...\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if *ninjaFile == "" || flag.NArg() == 0 {
+		usage()
+	}
+
+	if *chdir != "" {
+		if err := os.Chdir(*chdir); err != nil {
+			fatalf("%s", err)
+		}
+	}
+
+	m, err := readManifest(*ninjaFile)
+	if err != nil {
+		fatalf("%s", err)
+	}
+
+	dir := *buildDir
+	if dir == "" {
+		dir = m.vars["builddir"]
+	}
+
+	log := map[string]logEntry{}
+	if f, err := os.Open(filepath.Join(dir, ".ninja_log")); err == nil {
+		log, err = parseNinjaLog(f)
+		f.Close()
+		if err != nil {
+			fatalf("%s: %s", filepath.Join(dir, ".ninja_log"), err)
+		}
+	} else if !os.IsNotExist(err) {
+		fatalf("%s", err)
+	}
+
+	deps := map[string][]string{}
+	if f, err := os.Open(filepath.Join(dir, ".ninja_deps")); err == nil {
+		deps, err = parseNinjaDeps(f)
+		f.Close()
+		if err != nil {
+			fatalf("%s: %s", filepath.Join(dir, ".ninja_deps"), err)
+		}
+	} else if !os.IsNotExist(err) {
+		fatalf("%s", err)
+	}
+
+	x := newExplainer(m, log, deps)
+	if *previousNinja != "" {
+		if x.previous, err = readManifest(*previousNinja); err != nil {
+			fatalf("%s", err)
+		}
+	}
+
+	written := make(map[*explanation]bool)
+	for _, output := range flag.Args() {
+		ex, err := x.explain(output)
+		if err != nil {
+			fatalf("%s", err)
+		}
+		ex.write(os.Stdout, filepath.Clean(output), "", written)
+	}
+}
+
+func readManifest(filename string) (*manifest, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m, err := parseManifest(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	return m, nil
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "explain_rebuild: "+format+"\n", args...)
+	os.Exit(1)
+}
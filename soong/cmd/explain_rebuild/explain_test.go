@@ -0,0 +1,176 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const explainTestNinja = `
+builddir = out
+cflags = -Wall
+
+rule cc
+    command = cc $cflags $localFlags -c $in -o $out
+    deps = gcc
+    depfile = $out.d
+
+rule gen
+    command = gen $in > $out
+    restat = true
+
+build all: phony out/foo.o out/bar.o
+
+# # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # #
+# Module:  libfoo
+# Variant: android_arm
+# Type:    cc_library
+# Factory: android/soong/cc.LibraryFactory
+# Defined: foo/Android.bp:1:1
+
+build out/gen/foo.h: gen foo/foo.h.in
+
+build out/foo.o: cc foo/foo.c | out/gen/foo.h
+    localFlags = LOCAL_FLAGS
+
+build out/bar.o: cc foo/bar.c
+    localFlags = -DBAR
+`
+
+const explainTestBlueprints = `cc_library {
+    name: "libfoo",
+    cflags: ["-DFOO"],
+    include_dirs: ["foo/include"],
+}
+`
+
+func parseExplainTestNinja(t *testing.T, localFlags string) *manifest {
+	m, err := parseManifest(strings.NewReader(
+		strings.Replace(explainTestNinja, "LOCAL_FLAGS", localFlags, -1)))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return m
+}
+
+func TestExplain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "explain_rebuild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	if err := os.Mkdir("foo", 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join("foo", "Android.bp"), []byte(explainTestBlueprints), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	m := parseExplainTestNinja(t, "-DFOO -Ifoo/include")
+	previous := parseExplainTestNinja(t, "-Ifoo/include")
+
+	command := func(m *manifest, output string) uint64 {
+		command, err := m.command(m.producers[output])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hashCommand(command)
+	}
+
+	log := map[string]logEntry{
+		"out/gen/foo.h": {mtime: 5, commandHash: command(m, "out/gen/foo.h")},
+		"out/foo.o":     {mtime: 20, commandHash: command(previous, "out/foo.o")},
+		"out/bar.o":     {mtime: 20, commandHash: command(m, "out/bar.o")},
+	}
+	deps := map[string][]string{
+		"out/foo.o": {"foo/foo.h"},
+		"out/bar.o": {"foo/bar.h"},
+	}
+	mtimes := map[string]int64{
+		"foo/foo.h.in":  10,
+		"out/gen/foo.h": 5,
+		"foo/foo.c":     1,
+		"foo/foo.h":     1,
+		"out/foo.o":     20,
+		"foo/bar.c":     1,
+		"foo/bar.h":     30,
+		"out/bar.o":     20,
+	}
+
+	x := newExplainer(m, log, deps)
+	x.previous = previous
+	x.stat = func(path string) (int64, bool) {
+		mtime, ok := mtimes[path]
+		return mtime, ok
+	}
+
+	ex, err := x.explain("all")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	buf := &bytes.Buffer{}
+	ex.write(buf, "all", "", make(map[*explanation]bool))
+
+	libfoo := "module libfoo (android_arm), cc_library defined at foo/Android.bp:1:1"
+	expected := strings.Join([]string{
+		"all: rule phony",
+		"    input out/foo.o is rebuilt",
+		"        out/foo.o: rule cc of " + libfoo,
+		"            the command changed",
+		`                $localFlags changed from "-Ifoo/include" to "-DFOO -Ifoo/include"`,
+		"                    -DFOO is set by property cflags at foo/Android.bp:3:5",
+		"            input out/gen/foo.h is rebuilt",
+		"                out/gen/foo.h: rule gen of " + libfoo,
+		"                    input foo/foo.h.in is newer than the output",
+		"                        foo/foo.h.in is in the directory of module libfoo (android_arm) defined at foo/Android.bp:1:1",
+		"    input out/bar.o is rebuilt",
+		"        out/bar.o: rule cc of " + libfoo,
+		"            input foo/bar.h is newer than the output",
+		"                foo/bar.h is in the directory of module libfoo (android_arm) defined at foo/Android.bp:1:1",
+		"",
+	}, "\n")
+	if buf.String() != expected {
+		t.Errorf("incorrect explanation:\nexpected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	mtimes["foo/bar.h"] = 1
+	x.explanations = make(map[*edge]*explanation)
+	ex, err = x.explain("out/bar.o")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ex.dirty() {
+		t.Errorf("expected out/bar.o to be up to date, got %v", ex.reasons)
+	}
+
+	if _, err := x.explain("out/missing.o"); err == nil {
+		t.Errorf("expected an error for an unknown target")
+	}
+}
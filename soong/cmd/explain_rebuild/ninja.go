@@ -0,0 +1,499 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// An owner is the module variant or singleton that generated a build
+// statement, from the header comment Blueprint writes before its build
+// statements.
+type owner struct {
+	Module    string
+	Variant   string
+	Type      string
+	Defined   string // The position of the module definition, file:line:col
+	Singleton string
+}
+
+func (o *owner) String() string {
+	switch {
+	case o == nil:
+		return "<unknown>"
+	case o.Singleton != "":
+		return "singleton " + o.Singleton
+	case o.Variant != "":
+		return "module " + o.Module + " (" + o.Variant + ")"
+	default:
+		return "module " + o.Module
+	}
+}
+
+// definedFile returns the Blueprints file that defines the module.
+func (o *owner) definedFile() string {
+	if o == nil || o.Defined == "" {
+		return ""
+	}
+	f := o.Defined
+	for i := 0; i < 2; i++ {
+		if colon := strings.LastIndexByte(f, ':'); colon >= 0 {
+			f = f[:colon]
+		}
+	}
+	return f
+}
+
+type rule struct {
+	name string
+	vars map[string]string // Unevaluated, they are evaluated for each edge
+}
+
+// An edge is a build statement.
+type edge struct {
+	rule  *rule
+	owner *owner
+
+	outs         []string
+	explicitOuts int
+
+	ins         []string
+	explicitIns int
+	implicitIns int // The order-only inputs follow the implicit inputs
+
+	vars map[string]string // Evaluated when parsed, like ninja does
+}
+
+func (e *edge) explicitInputs() []string  { return e.ins[:e.explicitIns] }
+func (e *edge) explicitOutputs() []string { return e.outs[:e.explicitOuts] }
+
+// inputs returns the explicit and implicit inputs, those that cause the
+// outputs to be rebuilt.
+func (e *edge) inputs() []string { return e.ins[:e.explicitIns+e.implicitIns] }
+
+var phonyRule = &rule{name: "phony", vars: map[string]string{}}
+
+// A manifest is a parsed ninja file.
+type manifest struct {
+	vars      map[string]string
+	rules     map[string]*rule
+	edges     []*edge
+	producers map[string]*edge
+}
+
+// parseManifest parses a ninja file written by Blueprint.  Includes,
+// subninjas and scoped rules aren't supported, since Blueprint doesn't use
+// them.
+func parseManifest(r io.Reader) (*manifest, error) {
+	m := &manifest{
+		vars:      make(map[string]string),
+		rules:     map[string]*rule{"phony": phonyRule},
+		producers: make(map[string]*edge),
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16*1024*1024)
+
+	var o *owner
+	var curRule *rule
+	var curEdge *edge
+	lineNum := 0
+
+	var line string
+	for scanner.Scan() {
+		lineNum++
+		text := scanner.Text()
+		if line != "" {
+			text = strings.TrimLeft(text, " ")
+		}
+		line += text
+		if hasContinuation(line) {
+			line = line[:len(line)-1]
+			continue
+		}
+		full := line
+		line = ""
+
+		errorf := func(format string, args ...interface{}) error {
+			return fmt.Errorf("line %d: %s", lineNum, fmt.Sprintf(format, args...))
+		}
+
+		if strings.HasPrefix(full, "#") {
+			comment := strings.TrimPrefix(full, "#")
+			field := func(prefix string) (string, bool) {
+				if strings.HasPrefix(comment, " "+prefix+":") {
+					return strings.TrimSpace(strings.TrimPrefix(comment, " "+prefix+":")), true
+				}
+				return "", false
+			}
+			if v, ok := field("Module"); ok {
+				o = &owner{Module: v}
+			} else if v, ok := field("Singleton"); ok {
+				o = &owner{Singleton: v}
+			} else if v, ok := field("Variant"); ok && o != nil {
+				o.Variant = v
+			} else if v, ok := field("Type"); ok && o != nil {
+				o.Type = v
+			} else if v, ok := field("Defined"); ok && o != nil {
+				o.Defined = v
+			}
+			continue
+		}
+
+		if strings.TrimSpace(full) == "" {
+			continue
+		}
+
+		if full[0] == ' ' {
+			name, value, ok := splitBinding(full)
+			if !ok {
+				return nil, errorf("invalid binding %q", full)
+			}
+			if curRule != nil {
+				curRule.vars[name] = value
+			} else if curEdge != nil {
+				lookup := func(v string) (string, error) {
+					if value, ok := curEdge.vars[v]; ok {
+						return value, nil
+					}
+					return m.vars[v], nil
+				}
+				value, err := evalNinjaString(value, lookup, 0)
+				if err != nil {
+					return nil, errorf("%s", err)
+				}
+				curEdge.vars[name] = value
+			}
+			continue
+		}
+
+		if curEdge != nil {
+			if err := m.addEdgePaths(curEdge); err != nil {
+				return nil, err
+			}
+		}
+		curRule, curEdge = nil, nil
+
+		switch {
+		case strings.HasPrefix(full, "rule "):
+			curRule = &rule{
+				name: strings.TrimSpace(strings.TrimPrefix(full, "rule ")),
+				vars: make(map[string]string),
+			}
+			m.rules[curRule.name] = curRule
+		case strings.HasPrefix(full, "build "):
+			e, err := m.parseEdge(strings.TrimPrefix(full, "build "), o)
+			if err != nil {
+				return nil, errorf("%s", err)
+			}
+			curEdge = e
+		case strings.HasPrefix(full, "pool "), strings.HasPrefix(full, "default "):
+			// Pools and defaults don't affect why outputs are rebuilt
+		case strings.HasPrefix(full, "include "), strings.HasPrefix(full, "subninja "):
+			return nil, errorf("%q is not supported", full)
+		default:
+			name, value, ok := splitBinding(full)
+			if !ok {
+				return nil, errorf("unexpected %q", full)
+			}
+			lookup := func(v string) (string, error) { return m.vars[v], nil }
+			value, err := evalNinjaString(value, lookup, 0)
+			if err != nil {
+				return nil, errorf("%s", err)
+			}
+			m.vars[name] = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if curEdge != nil {
+		if err := m.addEdgePaths(curEdge); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// splitBinding splits a "name = value" line.
+func splitBinding(line string) (name, value string, ok bool) {
+	i := strings.IndexByte(line, '=')
+	if i < 0 {
+		return "", "", false
+	}
+	return strings.TrimSpace(line[:i]), strings.TrimLeft(line[i+1:], " "), true
+}
+
+// parseEdge parses the first line of a build statement.  The paths are
+// stored unevaluated, they are evaluated by addEdgePaths once the bindings of
+// the build statement have been read.
+func (m *manifest) parseEdge(build string, o *owner) (*edge, error) {
+	colon := unescapedIndex(build, ':')
+	if colon < 0 {
+		return nil, fmt.Errorf("missing ':' in build statement %q", build)
+	}
+
+	e := &edge{
+		owner: o,
+		vars:  make(map[string]string),
+	}
+
+	outs := splitNinjaList(build[:colon])
+	ins := splitNinjaList(build[colon+1:])
+	if len(ins) == 0 {
+		return nil, fmt.Errorf("missing rule in build statement %q", build)
+	}
+	ruleName := ins[0]
+	ins = ins[1:]
+
+	var ok bool
+	if e.rule, ok = m.rules[ruleName]; !ok {
+		return nil, fmt.Errorf("unknown rule %q", ruleName)
+	}
+
+	e.explicitOuts = -1
+	for _, out := range outs {
+		if out == "|" {
+			e.explicitOuts = len(e.outs)
+			continue
+		}
+		e.outs = append(e.outs, out)
+	}
+	if e.explicitOuts < 0 {
+		e.explicitOuts = len(e.outs)
+	}
+
+	e.explicitIns, e.implicitIns = -1, -1
+	for _, in := range ins {
+		switch in {
+		case "|":
+			e.explicitIns = len(e.ins)
+		case "||":
+			if e.explicitIns < 0 {
+				e.explicitIns = len(e.ins)
+			}
+			e.implicitIns = len(e.ins) - e.explicitIns
+		default:
+			e.ins = append(e.ins, in)
+		}
+	}
+	if e.explicitIns < 0 {
+		e.explicitIns = len(e.ins)
+	}
+	if e.implicitIns < 0 {
+		e.implicitIns = len(e.ins) - e.explicitIns
+	}
+
+	return e, nil
+}
+
+func (m *manifest) addEdgePaths(e *edge) error {
+	lookup := func(v string) (string, error) {
+		if value, ok := e.vars[v]; ok {
+			return value, nil
+		}
+		return m.vars[v], nil
+	}
+
+	for _, paths := range [][]string{e.outs, e.ins} {
+		for i, p := range paths {
+			value, err := evalNinjaString(p, lookup, 0)
+			if err != nil {
+				return err
+			}
+			paths[i] = path.Clean(value)
+		}
+	}
+
+	m.edges = append(m.edges, e)
+	for _, out := range e.outs {
+		m.producers[out] = e
+	}
+	return nil
+}
+
+// lookup returns the value of a variable in the scope of the build
+// statement, evaluating the variables of the rule like ninja does.
+func (m *manifest) lookup(e *edge, name string, depth int) (string, error) {
+	switch name {
+	case "in":
+		return shellEscapedList(e.explicitInputs(), " "), nil
+	case "in_newline":
+		return shellEscapedList(e.explicitInputs(), "\n"), nil
+	case "out":
+		return shellEscapedList(e.explicitOutputs(), " "), nil
+	}
+
+	if value, ok := e.vars[name]; ok {
+		return value, nil
+	}
+	if value, ok := e.rule.vars[name]; ok {
+		return evalNinjaString(value, func(v string) (string, error) {
+			return m.lookup(e, v, depth+1)
+		}, depth+1)
+	}
+	return m.vars[name], nil
+}
+
+// command returns the command of the build statement as ninja hashes it for
+// the .ninja_log, with the contents of the response file.
+func (m *manifest) command(e *edge) (string, error) {
+	command, err := m.lookup(e, "command", 0)
+	if err != nil {
+		return "", err
+	}
+	rspfileContent, err := m.lookup(e, "rspfile_content", 0)
+	if err != nil {
+		return "", err
+	}
+	if rspfileContent != "" {
+		command += ";rspfile=" + rspfileContent
+	}
+	return command, nil
+}
+
+// hasContinuation returns true if line ends with an unescaped '$'.
+func hasContinuation(line string) bool {
+	dollars := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '$'; i-- {
+		dollars++
+	}
+	return dollars%2 == 1
+}
+
+// unescapedIndex returns the index of the first c in s that isn't escaped
+// with '$', or -1.
+func unescapedIndex(s string, c byte) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '$' {
+			i++
+		} else if s[i] == c {
+			return i
+		}
+	}
+	return -1
+}
+
+// splitNinjaList splits s on unescaped spaces.
+func splitNinjaList(s string) []string {
+	var list []string
+	for {
+		s = strings.TrimLeft(s, " ")
+		if s == "" {
+			return list
+		}
+		i := unescapedIndex(s, ' ')
+		if i < 0 {
+			return append(list, s)
+		}
+		list = append(list, s[:i])
+		s = s[i:]
+	}
+}
+
+// evalNinjaString unescapes s and replaces references to variables with the
+// values returned by lookup.
+func evalNinjaString(s string, lookup func(string) (string, error), depth int) (string, error) {
+	if depth > 100 {
+		return "", fmt.Errorf("variable expansion of %q is too deep", s)
+	}
+
+	var ret []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' {
+			ret = append(ret, s[i])
+			continue
+		}
+
+		i++
+		if i == len(s) {
+			return "", fmt.Errorf("unexpected end of string after '$' in %q", s)
+		}
+
+		var name string
+		switch c := s[i]; {
+		case c == '$' || c == ' ' || c == ':' || c == '\n':
+			ret = append(ret, c)
+			continue
+		case c == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated variable reference in %q", s)
+			}
+			name = s[i+1 : i+end]
+			i += end
+		default:
+			end := i
+			for end < len(s) && isSimpleVarChar(s[end]) {
+				end++
+			}
+			name = s[i:end]
+			i = end - 1
+		}
+
+		value, err := lookup(name)
+		if err != nil {
+			return "", err
+		}
+		ret = append(ret, value...)
+	}
+
+	return string(ret), nil
+}
+
+// referencedVars returns the names of the variables referenced by s, in
+// order.
+func referencedVars(s string) []string {
+	var names []string
+	evalNinjaString(s, func(name string) (string, error) {
+		names = append(names, name)
+		return "", nil
+	}, 0)
+	return names
+}
+
+func isSimpleVarChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '-'
+}
+
+// shellEscapedList joins paths with sep, quoting the paths that contain
+// characters that aren't safe in a shell like ninja does for $in and $out.
+func shellEscapedList(paths []string, sep string) string {
+	escaped := make([]string, len(paths))
+	for i, p := range paths {
+		escaped[i] = shellEscape(p)
+	}
+	return strings.Join(escaped, sep)
+}
+
+func shellEscape(s string) string {
+	safe := true
+	for i := 0; i < len(s) && safe; i++ {
+		c := s[i]
+		safe = c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+			c == '_' || c == '+' || c == ',' || c == '-' || c == '.' || c == '/'
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
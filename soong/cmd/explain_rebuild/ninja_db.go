@@ -0,0 +1,189 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// A logEntry is the record in the .ninja_log of the last time an output was
+// built.
+type logEntry struct {
+	mtime       int64 // In nanoseconds, as written by ninja 1.9 and later
+	commandHash uint64
+}
+
+// parseNinjaLog reads a .ninja_log file and returns the latest entry of each
+// output.
+func parseNinjaLog(r io.Reader) (map[string]logEntry, error) {
+	entries := make(map[string]logEntry)
+
+	s := bufio.NewScanner(r)
+	header := true
+	for s.Scan() {
+		if header {
+			if hdr := s.Text(); hdr != "# ninja log v5" {
+				return nil, fmt.Errorf("unknown ninja log header %q", hdr)
+			}
+			header = false
+			continue
+		}
+
+		fields := strings.Split(s.Text(), "\t")
+		if len(fields) < 5 {
+			return nil, fmt.Errorf("invalid ninja log entry %q", s.Text())
+		}
+		mtime, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ninja log entry %q: %v", s.Text(), err)
+		}
+		hash, err := strconv.ParseUint(fields[4], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ninja log entry %q: %v", s.Text(), err)
+		}
+
+		// Later entries are from later builds, and replace the earlier ones.
+		entries[fields[3]] = logEntry{mtime: mtime, commandHash: hash}
+	}
+
+	return entries, s.Err()
+}
+
+const ninjaDepsSignature = "# ninjadeps\n"
+
+// parseNinjaDeps reads a .ninja_deps file, and returns the dependencies
+// discovered from the depfiles of each output, like headers.
+//
+// The file starts with a signature and a version, followed by records that
+// start with their size.  A record with the high bit of the size set is the
+// dependencies of an output, which are ids of paths.  Other records are paths,
+// padded to a multiple of 4 bytes, followed by the one's complement of their
+// id.  Later records for an output replace the earlier ones.
+func parseNinjaDeps(r io.Reader) (map[string][]string, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(data, []byte(ninjaDepsSignature)) || len(data) < len(ninjaDepsSignature)+4 {
+		return nil, fmt.Errorf("invalid ninja deps signature")
+	}
+	data = data[len(ninjaDepsSignature):]
+	version := binary.LittleEndian.Uint32(data)
+	data = data[4:]
+
+	// Version 4 increased the size of the mtime of the output from 4 bytes to 8.
+	var mtimeSize int
+	switch version {
+	case 3:
+		mtimeSize = 4
+	case 4:
+		mtimeSize = 8
+	default:
+		return nil, fmt.Errorf("unsupported ninja deps version %d", version)
+	}
+
+	var paths []string
+	deps := make(map[int][]int)
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, fmt.Errorf("truncated ninja deps record")
+		}
+		size := binary.LittleEndian.Uint32(data)
+		isDeps := size&0x80000000 != 0
+		size &= 0x7fffffff
+		data = data[4:]
+		if uint32(len(data)) < size || size%4 != 0 || size < 4 {
+			return nil, fmt.Errorf("invalid ninja deps record size %d", size)
+		}
+		record := data[:size]
+		data = data[size:]
+
+		if isDeps {
+			if len(record) < 4+mtimeSize {
+				return nil, fmt.Errorf("invalid ninja deps record size %d", size)
+			}
+			out := int(binary.LittleEndian.Uint32(record))
+			record = record[4+mtimeSize:]
+			ids := make([]int, len(record)/4)
+			for i := range ids {
+				ids[i] = int(binary.LittleEndian.Uint32(record[4*i:]))
+			}
+			deps[out] = ids
+		} else {
+			id := ^binary.LittleEndian.Uint32(record[len(record)-4:])
+			if int(id) != len(paths) {
+				return nil, fmt.Errorf("invalid ninja deps path id %d, expected %d", id, len(paths))
+			}
+			paths = append(paths, string(bytes.TrimRight(record[:len(record)-4], "\x00")))
+		}
+	}
+
+	ret := make(map[string][]string, len(deps))
+	for out, ids := range deps {
+		if out >= len(paths) {
+			return nil, fmt.Errorf("invalid ninja deps path id %d", out)
+		}
+		list := make([]string, len(ids))
+		for i, id := range ids {
+			if id >= len(paths) {
+				return nil, fmt.Errorf("invalid ninja deps path id %d", id)
+			}
+			list[i] = paths[id]
+		}
+		ret[paths[out]] = list
+	}
+	return ret, nil
+}
+
+// hashCommand returns the hash of a command that ninja stores in the
+// .ninja_log, MurmurHash64A with ninja's seed.
+func hashCommand(command string) uint64 {
+	const seed = 0xDECAFBADDECAFBAD
+	const m = 0xc6a4a7935bd1e995
+	const r = 47
+
+	data := []byte(command)
+	h := uint64(seed) ^ (uint64(len(data)) * m)
+
+	for len(data) >= 8 {
+		k := binary.LittleEndian.Uint64(data)
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+		data = data[8:]
+	}
+
+	if len(data) > 0 {
+		for i := len(data) - 1; i >= 0; i-- {
+			h ^= uint64(data[i]) << (8 * uint(i))
+		}
+		h *= m
+	}
+
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
@@ -0,0 +1,133 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHashCommand(t *testing.T) {
+	testCases := []struct {
+		command string
+		hash    uint64
+	}{
+		{"", 0x87c2bc0beaf1d91d},
+		{"cc -c foo.c -o foo.o", 0xc1cfc0967c85181b},
+		{"touch out", 0x8ea3cc54bdccad2c},
+	}
+
+	for _, testCase := range testCases {
+		if hash := hashCommand(testCase.command); hash != testCase.hash {
+			t.Errorf("expected hash %x of %q, got %x", testCase.hash, testCase.command, hash)
+		}
+	}
+}
+
+func TestParseNinjaLog(t *testing.T) {
+	log := "# ninja log v5\n" +
+		"0\t10\t100\tout/foo.o\tc1cfc0967c85181b\n" +
+		"0\t10\t100\tout/bar.o\t1\n" +
+		"20\t30\t200\tout/foo.o\t8ea3cc54bdccad2c\n"
+
+	entries, err := parseNinjaLog(strings.NewReader(log))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := map[string]logEntry{
+		"out/foo.o": {mtime: 200, commandHash: 0x8ea3cc54bdccad2c},
+		"out/bar.o": {mtime: 100, commandHash: 1},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("incorrect entries:")
+		t.Errorf("  expected: %v", expected)
+		t.Errorf("       got: %v", entries)
+	}
+
+	if _, err := parseNinjaLog(strings.NewReader("# ninja log v4\n")); err == nil {
+		t.Errorf("expected an error for an unknown version")
+	}
+}
+
+// ninjaDepsWriter writes a .ninja_deps file in the format of version 4.
+type ninjaDepsWriter struct {
+	bytes.Buffer
+	ids map[string]uint32
+}
+
+func newNinjaDepsWriter() *ninjaDepsWriter {
+	w := &ninjaDepsWriter{ids: make(map[string]uint32)}
+	w.WriteString(ninjaDepsSignature)
+	binary.Write(w, binary.LittleEndian, uint32(4))
+	return w
+}
+
+func (w *ninjaDepsWriter) id(path string) uint32 {
+	if id, ok := w.ids[path]; ok {
+		return id
+	}
+	id := uint32(len(w.ids))
+	w.ids[path] = id
+
+	padded := []byte(path)
+	for len(padded)%4 != 0 {
+		padded = append(padded, 0)
+	}
+	binary.Write(w, binary.LittleEndian, uint32(len(padded)+4))
+	w.Write(padded)
+	binary.Write(w, binary.LittleEndian, ^id)
+	return id
+}
+
+func (w *ninjaDepsWriter) deps(output string, mtime int64, inputs ...string) {
+	ids := []uint32{w.id(output)}
+	for _, in := range inputs {
+		ids = append(ids, w.id(in))
+	}
+	binary.Write(w, binary.LittleEndian, uint32(4*len(ids)+8)|0x80000000)
+	binary.Write(w, binary.LittleEndian, ids[0])
+	binary.Write(w, binary.LittleEndian, mtime)
+	binary.Write(w, binary.LittleEndian, ids[1:])
+}
+
+func TestParseNinjaDeps(t *testing.T) {
+	w := newNinjaDepsWriter()
+	w.deps("out/foo.o", 100, "foo.h", "bar.h")
+	w.deps("out/bar.o", 100, "bar.h")
+	w.deps("out/foo.o", 200, "foo.h", "baz/baz.h")
+
+	deps, err := parseNinjaDeps(&w.Buffer)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := map[string][]string{
+		"out/foo.o": {"foo.h", "baz/baz.h"},
+		"out/bar.o": {"bar.h"},
+	}
+	if !reflect.DeepEqual(deps, expected) {
+		t.Errorf("incorrect deps:")
+		t.Errorf("  expected: %v", expected)
+		t.Errorf("       got: %v", deps)
+	}
+
+	if _, err := parseNinjaDeps(strings.NewReader("# ninjadeps\n\x05\x00\x00\x00")); err == nil {
+		t.Errorf("expected an error for an unsupported version")
+	}
+}
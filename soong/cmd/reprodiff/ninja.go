@@ -0,0 +1,201 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Producer describes the module and rule that created an output file.
+type Producer struct {
+	Module string
+	Rule   string
+}
+
+// parseNinjaOutputs reads a ninja file generated by Blueprint and returns the
+// producer of each output, keyed by output path.  Blueprint writes a
+// "# Module:" or "# Singleton:" comment before the build statements of each
+// module and singleton, which is used to attribute the outputs.  Top level
+// variables are expanded in output paths, rule level variables are not.
+func parseNinjaOutputs(r io.Reader) (map[string]Producer, error) {
+	vars := make(map[string]string)
+	outputs := make(map[string]Producer)
+
+	owner := ""
+	var builds []string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16*1024*1024)
+
+	var line string
+	for scanner.Scan() {
+		line += scanner.Text()
+		if hasContinuation(line) {
+			line = line[:len(line)-1]
+			continue
+		}
+		full := line
+		line = ""
+
+		switch {
+		case strings.HasPrefix(full, "# Module:"):
+			owner = strings.TrimSpace(strings.TrimPrefix(full, "# Module:"))
+		case strings.HasPrefix(full, "# Variant:"):
+			if variant := strings.TrimSpace(strings.TrimPrefix(full, "# Variant:")); variant != "" {
+				owner += " (" + variant + ")"
+			}
+		case strings.HasPrefix(full, "# Singleton:"):
+			owner = "singleton " + strings.TrimSpace(strings.TrimPrefix(full, "# Singleton:"))
+		case strings.HasPrefix(full, "build "):
+			builds = append(builds, owner+"\n"+strings.TrimPrefix(full, "build "))
+		case full == "" || full[0] == ' ' || full[0] == '#':
+			// Blank lines, comments and indented rule or build variables
+		default:
+			if i := strings.Index(full, "="); i > 0 {
+				vars[strings.TrimSpace(full[:i])] = strings.TrimLeft(full[i+1:], " ")
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// Variables may be defined after the build statements that use them, so
+	// the build statements are only expanded after reading the whole file.
+	for _, build := range builds {
+		i := strings.IndexByte(build, '\n')
+		owner, build := build[:i], build[i+1:]
+
+		colon := unescapedIndex(build, ':')
+		if colon < 0 {
+			return nil, fmt.Errorf("missing ':' in build statement %q", build)
+		}
+
+		rule := ""
+		if fields := strings.Fields(build[colon+1:]); len(fields) > 0 {
+			rule = fields[0]
+		}
+
+		for _, output := range splitNinjaList(build[:colon]) {
+			if output == "|" {
+				continue
+			}
+			path, err := expandNinjaString(output, vars, 0)
+			if err != nil {
+				return nil, err
+			}
+			outputs[path] = Producer{Module: owner, Rule: rule}
+		}
+	}
+
+	return outputs, nil
+}
+
+// hasContinuation returns true if line ends with an unescaped '$'.
+func hasContinuation(line string) bool {
+	dollars := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '$'; i-- {
+		dollars++
+	}
+	return dollars%2 == 1
+}
+
+// unescapedIndex returns the index of the first c in s that isn't escaped
+// with '$', or -1.
+func unescapedIndex(s string, c byte) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '$' {
+			i++
+		} else if s[i] == c {
+			return i
+		}
+	}
+	return -1
+}
+
+// splitNinjaList splits s on unescaped spaces.
+func splitNinjaList(s string) []string {
+	var list []string
+	for {
+		s = strings.TrimLeft(s, " ")
+		if s == "" {
+			return list
+		}
+		i := unescapedIndex(s, ' ')
+		if i < 0 {
+			return append(list, s)
+		}
+		list = append(list, s[:i])
+		s = s[i:]
+	}
+}
+
+// expandNinjaString unescapes s and replaces references to the variables in
+// vars with their expanded values.
+func expandNinjaString(s string, vars map[string]string, depth int) (string, error) {
+	if depth > 100 {
+		return "", fmt.Errorf("variable expansion of %q is too deep", s)
+	}
+
+	var ret []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' {
+			ret = append(ret, s[i])
+			continue
+		}
+
+		i++
+		if i == len(s) {
+			return "", fmt.Errorf("unexpected end of string after '$' in %q", s)
+		}
+
+		var name string
+		switch c := s[i]; {
+		case c == '$' || c == ' ' || c == ':' || c == '\n':
+			ret = append(ret, c)
+			continue
+		case c == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated variable reference in %q", s)
+			}
+			name = s[i+1 : i+end]
+			i += end
+		default:
+			end := i
+			for end < len(s) && isSimpleVarChar(s[end]) {
+				end++
+			}
+			name = s[i:end]
+			i = end - 1
+		}
+
+		value, err := expandNinjaString(vars[name], vars, depth+1)
+		if err != nil {
+			return "", err
+		}
+		ret = append(ret, value...)
+	}
+
+	return string(ret), nil
+}
+
+func isSimpleVarChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '-'
+}
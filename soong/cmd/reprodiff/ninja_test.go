@@ -0,0 +1,91 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testNinja = `
+g.android.soong.common.OutDir = out/soong
+
+rule g.cc.cc
+    command = cc -c $in -o $out
+
+# # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # #
+# Module:  libfoo
+# Variant: android_arm_shared
+# Type:    cc_library
+# Factory: android/soong/cc.LibraryFactory
+# Defined: external/foo/Android.bp:1:1
+
+m.libfoo_android_arm_shared.objDir = ${g.android.soong.common.OutDir}/obj/libfoo
+
+build ${m.libfoo_android_arm_shared.objDir}/foo.o $
+        ${m.libfoo_android_arm_shared.objDir}/foo$ bar.o | $
+        ${m.libfoo_android_arm_shared.objDir}/foo.d: g.cc.cc external/foo/foo.c
+    cFlags = -O2
+
+# # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # #
+# Singleton: dist
+# Factory:   android/soong/android.DistSingleton
+
+build out/dist/foo$:1.zip: g.android.soong.common.Zip out/soong/obj/libfoo/foo.o
+`
+
+func TestParseNinjaOutputs(t *testing.T) {
+	outputs, err := parseNinjaOutputs(strings.NewReader(testNinja))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	libfoo := Producer{Module: "libfoo (android_arm_shared)", Rule: "g.cc.cc"}
+	expected := map[string]Producer{
+		"out/soong/obj/libfoo/foo.o":     libfoo,
+		"out/soong/obj/libfoo/foo bar.o": libfoo,
+		"out/soong/obj/libfoo/foo.d":     libfoo,
+		"out/dist/foo:1.zip":             {Module: "singleton dist", Rule: "g.android.soong.common.Zip"},
+	}
+
+	if !reflect.DeepEqual(outputs, expected) {
+		t.Errorf("incorrect outputs:")
+		t.Errorf("  expected: %v", expected)
+		t.Errorf("       got: %v", outputs)
+	}
+}
+
+func TestCompareHashes(t *testing.T) {
+	a := map[string]string{"same": "1", "changed": "2", "removed": "3"}
+	b := map[string]string{"same": "1", "changed": "4", "added": "5"}
+
+	diffs := compareHashes(a, b)
+	got := make(map[string]string)
+	for _, d := range diffs {
+		got[d.path] = d.status
+	}
+
+	expected := map[string]string{
+		"changed": "differs",
+		"removed": "only in A",
+		"added":   "only in B",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("incorrect differences:")
+		t.Errorf("  expected: %v", expected)
+		t.Errorf("       got: %v", got)
+	}
+}
@@ -0,0 +1,278 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// reprodiff compares the outputs of two builds of the same source tree, and
+// reports the files that differ grouped by the module and rule that produced
+// them, to help track down sources of non-determinism.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	ninjaFile      = flag.String("ninja", "", "ninja file of the build, used to attribute outputs to modules and rules")
+	outPrefix      = flag.String("prefix", "out", "path of the output directory as used in the ninja file")
+	installedFiles = flag.String("installed_files", "", "fileslist manifest relative to each output directory (e.g. target/product/generic/installed-files.json) to compare by installed path")
+	exclude        = flag.String("exclude", ".ninja_log,.ninja_deps,.lock", "comma separated list of file name patterns that are not compared")
+	para           = flag.Int("para", runtime.NumCPU(), "number of files to hash in parallel")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: reprodiff [flags] <output dir A> <output dir B>\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+// A difference is a file that is not identical in both builds.
+type difference struct {
+	path   string
+	status string
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		usage()
+	}
+	dirA, dirB := flag.Arg(0), flag.Arg(1)
+
+	var producers map[string]Producer
+	if *ninjaFile != "" {
+		f, err := os.Open(*ninjaFile)
+		if err != nil {
+			fatalf("%s", err)
+		}
+		producers, err = parseNinjaOutputs(f)
+		f.Close()
+		if err != nil {
+			fatalf("%s: %s", *ninjaFile, err)
+		}
+	}
+
+	hashesA, err := hashTree(dirA)
+	if err != nil {
+		fatalf("%s", err)
+	}
+	hashesB, err := hashTree(dirB)
+	if err != nil {
+		fatalf("%s", err)
+	}
+
+	groups := make(map[Producer][]difference)
+	for _, d := range compareHashes(hashesA, hashesB) {
+		output := filepath.Join(*outPrefix, d.path)
+		producer, ok := producers[output]
+		if !ok {
+			producer = Producer{Module: "<unknown>"}
+		}
+		d.path = output
+		groups[producer] = append(groups[producer], d)
+	}
+
+	if *installedFiles != "" {
+		installedA, err := readInstalledFiles(filepath.Join(dirA, *installedFiles))
+		if err != nil {
+			fatalf("%s", err)
+		}
+		installedB, err := readInstalledFiles(filepath.Join(dirB, *installedFiles))
+		if err != nil {
+			fatalf("%s", err)
+		}
+		producer := Producer{Module: "installed files (" + *installedFiles + ")"}
+		groups[producer] = compareHashes(installedA, installedB)
+	}
+
+	if printReport(os.Stdout, groups) {
+		os.Exit(1)
+	}
+}
+
+// hashTree returns the sha256 of every file in dir, keyed by its path relative
+// to dir.
+func hashTree(dir string) (map[string]string, error) {
+	var excludes []string
+	if *exclude != "" {
+		excludes = strings.Split(*exclude, ",")
+	}
+
+	paths := make(chan string)
+	hashes := make(map[string]string)
+	var lock sync.Mutex
+	var firstErr error
+
+	var wg sync.WaitGroup
+	for i := 0; i < *para; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				hash, err := hashFile(filepath.Join(dir, path))
+				lock.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				hashes[path] = hash
+				lock.Unlock()
+			}
+		}()
+	}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		for _, pattern := range excludes {
+			if match, _ := filepath.Match(pattern, info.Name()); match {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		paths <- rel
+		return nil
+	})
+	close(paths)
+	wg.Wait()
+
+	if err != nil {
+		return nil, err
+	}
+	return hashes, firstErr
+}
+
+// hashFile returns the sha256 of a file, or of the target of a symlink.
+func hashFile(path string) (string, error) {
+	h := sha256.New()
+
+	if target, err := os.Readlink(path); err == nil {
+		io.WriteString(h, target)
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		if _, err := io.Copy(h, f); err != nil {
+			return "", err
+		}
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// readInstalledFiles reads a manifest written by the fileslist tool and
+// returns the sha256 of each installed file, keyed by its installed path.
+func readInstalledFiles(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []struct {
+		SHA256 string
+		Name   string
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	hashes := make(map[string]string, len(entries))
+	for _, e := range entries {
+		hashes[e.Name] = e.SHA256
+	}
+	return hashes, nil
+}
+
+func compareHashes(a, b map[string]string) []difference {
+	var diffs []difference
+	for path, hashA := range a {
+		if hashB, ok := b[path]; !ok {
+			diffs = append(diffs, difference{path, "only in A"})
+		} else if hashA != hashB {
+			diffs = append(diffs, difference{path, "differs"})
+		}
+	}
+	for path := range b {
+		if _, ok := a[path]; !ok {
+			diffs = append(diffs, difference{path, "only in B"})
+		}
+	}
+	return diffs
+}
+
+// printReport writes the differences grouped by producer, and returns true if
+// there were any.
+func printReport(w io.Writer, groups map[Producer][]difference) bool {
+	var producers []Producer
+	total := 0
+	for producer, diffs := range groups {
+		if len(diffs) > 0 {
+			producers = append(producers, producer)
+			total += len(diffs)
+		}
+	}
+
+	sort.Slice(producers, func(i, j int) bool {
+		if producers[i].Module != producers[j].Module {
+			return producers[i].Module < producers[j].Module
+		}
+		return producers[i].Rule < producers[j].Rule
+	})
+
+	for _, producer := range producers {
+		diffs := groups[producer]
+		sort.Slice(diffs, func(i, j int) bool { return diffs[i].path < diffs[j].path })
+
+		if producer.Rule != "" {
+			fmt.Fprintf(w, "%s (rule %s):\n", producer.Module, producer.Rule)
+		} else {
+			fmt.Fprintf(w, "%s:\n", producer.Module)
+		}
+		for _, d := range diffs {
+			fmt.Fprintf(w, "    %-9s %s\n", d.status, d.path)
+		}
+	}
+
+	fmt.Fprintf(w, "%d differing files in %d groups\n", total, len(producers))
+
+	return total > 0
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "reprodiff: "+format+"\n", args...)
+	os.Exit(1)
+}
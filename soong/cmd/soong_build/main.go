@@ -26,7 +26,7 @@ import (
 )
 
 func main() {
-	flag.Parse()
+	bootstrap.ParseFlags()
 
 	// The top-level Blueprints file is passed as the first argument.
 	srcDir := filepath.Dir(flag.Arg(0))
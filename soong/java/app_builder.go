@@ -56,6 +56,8 @@ var (
 		blueprint.RuleParams{
 			Command:     `java -jar $signapkCmd $certificates $in $out`,
 			CommandDeps: []string{"$signapkCmd"},
+			Local:       true,
+			NoCache:     true,
 		},
 		"certificates")
 
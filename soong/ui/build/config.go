@@ -39,6 +39,9 @@ type configImpl struct {
 	verbose   bool
 	dist      bool
 
+	// The source of the ninja weight list, see ninjaWeightSourceLog
+	ninjaWeightSource string
+
 	// From the product config
 	katiArgs     []string
 	ninjaArgs    []string
@@ -152,6 +155,9 @@ func (c *configImpl) parseArgs(ctx Context, args []string) {
 		arg := strings.TrimSpace(args[i])
 		if arg == "--make-mode" {
 			continue
+		} else if strings.HasPrefix(arg, "--ninja_weight_source=") {
+			c.ninjaWeightSource = strings.TrimPrefix(arg, "--ninja_weight_source=")
+			continue
 		} else if arg == "showcommands" {
 			c.verbose = true
 			continue
@@ -270,6 +276,17 @@ func (c *configImpl) NinjaArgs() []string {
 	return c.ninjaArgs
 }
 
+// NinjaWeightSource returns where the weights of the ninja weight list are read
+// from, either "ninja_log" or the path of a file of declared weights, or an
+// empty string if no weight list should be used.
+func (c *configImpl) NinjaWeightSource() string {
+	return c.ninjaWeightSource
+}
+
+func (c *configImpl) NinjaWeightListFile() string {
+	return filepath.Join(c.OutDir(), ".ninja_weight_list")
+}
+
 func (c *configImpl) SoongOutDir() string {
 	return filepath.Join(c.OutDir(), "soong")
 }
@@ -52,6 +52,19 @@ func runNinja(ctx Context, config Config) {
 	}
 	args = append(args, "-w", "dupbuild=err")
 
+	// Weight lists are only supported by ninja builds that schedule the
+	// actions on the critical path first.
+	if config.NinjaWeightSource() != "" && writeNinjaWeightList(ctx, config) {
+		weightArgs := []string{"-o", "usesweightlist=yes", "--weight_list=" + config.NinjaWeightListFile()}
+		if _, err := os.Stat(config.NinjaWeightListFile()); err != nil {
+			ctx.Verbosef("Not using the ninja weight list: %v", err)
+		} else if !ninjaSupportsArgs(ctx, config, executable, weightArgs) {
+			ctx.Verboseln("Not using the ninja weight list, ninja doesn't support it")
+		} else {
+			args = append(args, weightArgs...)
+		}
+	}
+
 	cmd := Command(ctx, config, "ninja", executable, args...)
 	cmd.Environment.AppendFromKati(config.KatiEnvFile())
 
@@ -103,6 +116,15 @@ func runNinja(ctx Context, config Config) {
 	cmd.RunOrFatal()
 }
 
+// ninjaSupportsArgs returns true if the ninja executable accepts args.  Ninja
+// parses its arguments in order and exits at --version, so unsupported
+// arguments before it make it fail with a usage error.
+func ninjaSupportsArgs(ctx Context, config Config, executable string, args []string) bool {
+	cmd := Command(ctx, config, "ninja version", executable, append(args, "--version")...)
+	_, err := cmd.CombinedOutput()
+	return err == nil
+}
+
 type statusChecker struct {
 	prevTime time.Time
 }
@@ -0,0 +1,161 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ninjaWeightSourceLog is the --ninja_weight_source value that uses the
+// durations of the actions in the .ninja_log of the previous build as weights.
+// Any other value is the path of a file of declared weights, in the same
+// format as the weight list.
+const ninjaWeightSourceLog = "ninja_log"
+
+// writeNinjaWeightList writes the weight list that ninja uses to prioritize
+// the actions on the critical path.  Each line of the weight list contains an
+// output path and the expected duration of the action that produces it in
+// milliseconds, separated by a comma.  It returns false if there are no
+// weights, for example on the first build with the ninja_log source.
+func writeNinjaWeightList(ctx Context, config Config) bool {
+	ctx.BeginTrace("ninja weight list")
+	defer ctx.EndTrace()
+
+	source := config.NinjaWeightSource()
+
+	var weights map[string]int
+	var err error
+	if source == ninjaWeightSourceLog {
+		weights, err = readWeightsFromFile(filepath.Join(config.OutDir(), ".ninja_log"), parseNinjaLogWeights)
+		if os.IsNotExist(err) {
+			ctx.Verboseln("No .ninja_log, not using a ninja weight list")
+			return false
+		}
+	} else {
+		weights, err = readWeightsFromFile(source, parseDeclaredWeights)
+	}
+	if err != nil {
+		ctx.Fatalf("Failed to read ninja weights from %s: %v", source, err)
+	}
+	if len(weights) == 0 {
+		return false
+	}
+
+	buf := &bytes.Buffer{}
+	writeWeights(buf, weights)
+	if err := ioutil.WriteFile(config.NinjaWeightListFile(), buf.Bytes(), 0666); err != nil {
+		ctx.Fatalf("Failed to write ninja weight list: %v", err)
+	}
+	return true
+}
+
+func readWeightsFromFile(path string, parse func(io.Reader) (map[string]int, error)) (map[string]int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parse(f)
+}
+
+// parseNinjaLogWeights returns the duration in milliseconds of the last run of
+// the action that produced each output in a .ninja_log file.
+func parseNinjaLogWeights(r io.Reader) (map[string]int, error) {
+	weights := make(map[string]int)
+
+	s := bufio.NewScanner(r)
+	header := true
+	for s.Scan() {
+		if header {
+			if hdr := s.Text(); hdr != "# ninja log v5" {
+				return nil, fmt.Errorf("unknown ninja log header %q", hdr)
+			}
+			header = false
+			continue
+		}
+
+		fields := strings.Split(s.Text(), "\t")
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("invalid ninja log entry %q", s.Text())
+		}
+		begin, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid ninja log entry %q: %v", s.Text(), err)
+		}
+		end, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid ninja log entry %q: %v", s.Text(), err)
+		}
+
+		// Later entries are from later builds, and replace the earlier ones.
+		weights[fields[3]] = end - begin
+	}
+
+	return weights, s.Err()
+}
+
+// parseDeclaredWeights parses a file of declared weights, with an output path
+// and a weight separated by a comma on each line.  Empty lines and lines
+// starting with '#' are ignored.
+func parseDeclaredWeights(r io.Reader) (map[string]int, error) {
+	weights := make(map[string]int)
+
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+
+		comma := strings.LastIndexByte(text, ',')
+		if comma < 1 {
+			return nil, fmt.Errorf("line %d: expected <output>,<weight>, got %q", line, text)
+		}
+		weight, err := strconv.Atoi(strings.TrimSpace(text[comma+1:]))
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("line %d: invalid weight in %q", line, text)
+		}
+		weights[strings.TrimSpace(text[:comma])] = weight
+	}
+
+	return weights, s.Err()
+}
+
+// writeWeights writes weights in the weight list format, heaviest first.
+func writeWeights(w io.Writer, weights map[string]int) {
+	outputs := make([]string, 0, len(weights))
+	for output := range weights {
+		outputs = append(outputs, output)
+	}
+	sort.Slice(outputs, func(i, j int) bool {
+		if weights[outputs[i]] != weights[outputs[j]] {
+			return weights[outputs[i]] > weights[outputs[j]]
+		}
+		return outputs[i] < outputs[j]
+	})
+
+	for _, output := range outputs {
+		fmt.Fprintf(w, "%s,%d\n", output, weights[output])
+	}
+}
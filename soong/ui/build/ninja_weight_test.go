@@ -0,0 +1,131 @@
+// Copyright 2017 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseNinjaLogWeights(t *testing.T) {
+	log := "# ninja log v5\n" +
+		"0\t100\t0\tout/a.o\t1234\n" +
+		"5\t3000\t0\tout/b.o\t5678\n" +
+		"10\t50\t0\tout/a.o\t1234\n"
+
+	weights, err := parseNinjaLogWeights(strings.NewReader(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]int{
+		"out/a.o": 40,
+		"out/b.o": 2995,
+	}
+	if !reflect.DeepEqual(weights, expected) {
+		t.Errorf("incorrect weights %v, expected %v", weights, expected)
+	}
+
+	if _, err := parseNinjaLogWeights(strings.NewReader("# ninja log v4\n")); err == nil {
+		t.Error("expected error for unknown ninja log version")
+	}
+}
+
+func TestParseDeclaredWeights(t *testing.T) {
+	testCases := []struct {
+		in      string
+		weights map[string]int
+		err     string
+	}{
+		{
+			in:      "# comment\n\nout/a.o,10\n out/b,c.o , 20 \n",
+			weights: map[string]int{"out/a.o": 10, "out/b,c.o": 20},
+		},
+		{
+			in:  "out/a.o\n",
+			err: `line 1: expected <output>,<weight>, got "out/a.o"`,
+		},
+		{
+			in:  "out/a.o,1\nout/b.o,-1\n",
+			err: `line 2: invalid weight in "out/b.o,-1"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		weights, err := parseDeclaredWeights(strings.NewReader(tc.in))
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%q: expected error %q, got %v", tc.in, tc.err, err)
+			}
+		} else if err != nil {
+			t.Errorf("%q: unexpected error %v", tc.in, err)
+		} else if !reflect.DeepEqual(weights, tc.weights) {
+			t.Errorf("%q: incorrect weights %v, expected %v", tc.in, weights, tc.weights)
+		}
+	}
+}
+
+func TestWriteWeights(t *testing.T) {
+	buf := &bytes.Buffer{}
+	writeWeights(buf, map[string]int{
+		"out/a.o": 10,
+		"out/c.o": 20,
+		"out/b.o": 10,
+	})
+
+	expected := "out/c.o,20\nout/a.o,10\nout/b.o,10\n"
+	if buf.String() != expected {
+		t.Errorf("incorrect weight list %q, expected %q", buf.String(), expected)
+	}
+}
+
+func TestNinjaSupportsArgs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ninja_weight_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The fake ninja without weight list support rejects -o like a ninja
+	// build from upstream does.
+	scripts := map[string]string{
+		"ninja_weights":    "#!/bin/sh\nexit 0\n",
+		"ninja_no_weights": "#!/bin/sh\n[ \"$1\" != -o ]\n",
+	}
+	for name, script := range scripts {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(script), 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := testContext()
+	config := Config{&configImpl{environ: &Environment{}}}
+	args := []string{"-o", "usesweightlist=yes", "--weight_list=weights"}
+
+	if !ninjaSupportsArgs(ctx, config, filepath.Join(dir, "ninja_weights"), args) {
+		t.Errorf("expected ninja_weights to support the weight list")
+	}
+	if ninjaSupportsArgs(ctx, config, filepath.Join(dir, "ninja_no_weights"), args) {
+		t.Errorf("expected ninja_no_weights not to support the weight list")
+	}
+	if ninjaSupportsArgs(ctx, config, filepath.Join(dir, "missing"), args) {
+		t.Errorf("expected a missing ninja not to support the weight list")
+	}
+}